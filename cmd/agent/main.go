@@ -8,6 +8,7 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
@@ -16,6 +17,7 @@ import (
 	"syscall"
 
 	"gmha/internal/agent"
+	"gmha/internal/agent/mysqlcheck"
 	"gmha/internal/buildinfo"
 )
 
@@ -30,6 +32,12 @@ func main() {
 		fmt.Println(buildinfo.CurrentVersion())
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "mysql-credential" {
+		if err := setMySQLCredential(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	configPath := flag.String("config", "/home/gmha/agent/agent.yaml", "agent config path")
 	flag.Parse()
 
@@ -45,3 +53,35 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// setMySQLCredential 更新本机 MySQL 采集配置中某个实例的账号密码。
+// Manager 在账号密码轮换时通过命令任务调用：agentd mysql-credential
+// --file <mysql-heartbeat.json> --port 3306 --username mha --password-base64 <...>；
+// 带 --check 时只校验配置中的账号密码与参数一致，不修改文件。
+func setMySQLCredential(args []string) error {
+	flags := flag.NewFlagSet("mysql-credential", flag.ContinueOnError)
+	file := flags.String("file", "/home/gmha/agent/"+mysqlcheck.DefaultConfigFile, "mysql heartbeat config path")
+	port := flags.Int("port", 0, "mysql port")
+	username := flags.String("username", "", "mysql username")
+	encoded := flags.String("password-base64", "", "base64 encoded mysql password")
+	check := flags.Bool("check", false, "only verify the stored credentials")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	password, err := base64.StdEncoding.DecodeString(*encoded)
+	if err != nil {
+		return fmt.Errorf("invalid --password-base64: %w", err)
+	}
+	if *check {
+		if err := mysqlcheck.CheckInstanceCredentials(*file, *port, *username, string(password)); err != nil {
+			return err
+		}
+		fmt.Printf("mysql_credential_verified port=%d username=%s\n", *port, *username)
+		return nil
+	}
+	if err := mysqlcheck.SetInstanceCredentials(*file, *port, *username, string(password)); err != nil {
+		return err
+	}
+	fmt.Printf("mysql_credential_updated port=%d username=%s\n", *port, *username)
+	return nil
+}
@@ -0,0 +1,350 @@
+// Package baseline 采集主机操作系统基线相关的事实（内核参数、透明大页、NUMA、
+// I/O 调度器、mysqld 资源限制、时间同步、SELinux、防火墙与数据目录挂载选项），
+// 定期上报 Manager，由 Manager 按集群基线评估。
+package baseline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	agentmysqldynamic "gmha/internal/agent/mysqldynamic"
+	baselinedomain "gmha/internal/domain/baseline"
+)
+
+const ReportPath = "/api/v1/baseline/report"
+
+// Collector 每个周期采集一次主机事实并上报。Manager 的响应带回集群基线检查的
+// 内核参数列表，列表变化时立即按新列表重新采集一次。
+type Collector struct {
+	agentID      string
+	machineID    string
+	managerAddrs []string
+	envs         func() ([]*agentmysqldynamic.CollectEnv, error)
+	client       *http.Client
+	interval     time.Duration
+	logger       *log.Logger
+
+	root       string
+	run        func(ctx context.Context, name string, args ...string) (string, error)
+	sysctlKeys []string
+}
+
+func NewCollector(agentID, machineID string, managerAddrs []string, envs func() ([]*agentmysqldynamic.CollectEnv, error)) *Collector {
+	addrs := make([]string, 0, len(managerAddrs))
+	for _, addr := range managerAddrs {
+		if addr = strings.TrimRight(strings.TrimSpace(addr), "/"); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return &Collector{
+		agentID: agentID, machineID: machineID, managerAddrs: addrs, envs: envs,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: 10 * time.Minute,
+		logger:   log.Default(),
+		root:     "/",
+		run:      runCommand,
+	}
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	if len(c.managerAddrs) == 0 || c.machineID == "" {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) tick(ctx context.Context) {
+	for attempt := 0; attempt < 2; attempt++ {
+		report := c.Collect(ctx)
+		var response baselinedomain.ReportResponse
+		if err := c.post(ctx, report, &response); err != nil {
+			if ctx.Err() == nil {
+				c.logger.Printf("baseline collector: report: %v", err)
+			}
+			return
+		}
+		keys := slices.Clone(response.SysctlKeys)
+		slices.Sort(keys)
+		if slices.Equal(keys, c.sysctlKeys) {
+			return
+		}
+		c.sysctlKeys = keys
+	}
+}
+
+// Collect 读取本机事实。无法读取的项不上报，Manager 会显示为未知；不适用的项
+// 上报 n/a。
+func (c *Collector) Collect(ctx context.Context) baselinedomain.Report {
+	hostname, _ := os.Hostname()
+	report := baselinedomain.Report{MachineID: c.machineID, AgentID: c.agentID, Hostname: hostname, Facts: make(map[string]string)}
+	facts := report.Facts
+	fail := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+
+	for _, key := range c.sysctlKeys {
+		if value, err := c.read(filepath.Join("proc/sys", strings.ReplaceAll(key, ".", "/"))); err == nil {
+			facts[baselinedomain.FactSysctlPrefix+key] = strings.Join(strings.Fields(value), " ")
+		}
+	}
+	for fact, name := range map[string]string{baselinedomain.FactTHPEnabled: "enabled", baselinedomain.FactTHPDefrag: "defrag"} {
+		if value, err := c.read("sys/kernel/mm/transparent_hugepage/" + name); err == nil {
+			facts[fact] = selectedOption(value)
+		}
+	}
+
+	pids := c.mysqldPIDs()
+	nodes := c.numaNodes()
+	facts[baselinedomain.FactNUMANodes] = fmt.Sprint(nodes)
+	switch {
+	case nodes <= 1 || len(pids) == 0:
+		facts[baselinedomain.FactNUMAInterleave] = baselinedomain.FactNotApplicable
+	default:
+		interleaved := true
+		for _, pid := range pids {
+			interleaved = interleaved && c.interleaved(pid)
+		}
+		facts[baselinedomain.FactNUMAInterleave] = fmt.Sprint(interleaved)
+	}
+	for fact, limit := range map[string]string{baselinedomain.FactUlimitNoFile: "Max open files", baselinedomain.FactUlimitNProc: "Max processes"} {
+		if len(pids) == 0 {
+			facts[fact] = baselinedomain.FactNotApplicable
+			continue
+		}
+		if value, ok := c.minLimit(pids, limit); ok {
+			facts[fact] = value
+		}
+	}
+
+	for device, scheduler := range c.ioSchedulers() {
+		facts[baselinedomain.FactIOScheduler+":"+device] = scheduler
+	}
+	if value, err := c.timeSync(ctx); err == nil {
+		facts[baselinedomain.FactTimeSync] = value
+	} else {
+		fail("time sync: %v", err)
+	}
+	facts[baselinedomain.FactSELinux] = c.selinux()
+	if value, err := c.firewall(ctx); err == nil {
+		facts[baselinedomain.FactFirewall] = value
+	} else {
+		fail("firewall: %v", err)
+	}
+	if err := c.mounts(facts); err != nil {
+		fail("mounts: %v", err)
+	}
+	return report
+}
+
+func (c *Collector) read(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(c.root, path))
+	return strings.TrimSpace(string(data)), err
+}
+
+func (c *Collector) mysqldPIDs() []string {
+	entries, err := os.ReadDir(filepath.Join(c.root, "proc"))
+	if err != nil {
+		return nil
+	}
+	pids := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.Trim(entry.Name(), "0123456789") != "" {
+			continue
+		}
+		if comm, err := c.read(filepath.Join("proc", entry.Name(), "comm")); err == nil && comm == "mysqld" {
+			pids = append(pids, entry.Name())
+		}
+	}
+	return pids
+}
+
+func (c *Collector) numaNodes() int {
+	matches, _ := filepath.Glob(filepath.Join(c.root, "sys/devices/system/node/node[0-9]*"))
+	return len(matches)
+}
+
+// interleaved 通过 numa_maps 判断 mysqld 的内存策略；numactl --interleave 与
+// innodb_numa_interleave=ON 都会在映射上留下 interleave 策略。
+func (c *Collector) interleaved(pid string) bool {
+	data, err := os.ReadFile(filepath.Join(c.root, "proc", pid, "numa_maps"))
+	return err == nil && bytes.Contains(data, []byte(" interleave"))
+}
+
+func (c *Collector) minLimit(pids []string, name string) (string, bool) {
+	best, found := "", false
+	for _, pid := range pids {
+		data, err := c.read(filepath.Join("proc", pid, "limits"))
+		if err != nil {
+			continue
+		}
+		value, ok := parseLimit(data, name)
+		if !ok {
+			continue
+		}
+		if !found || lessLimit(value, best) {
+			best, found = value, true
+		}
+	}
+	return best, found
+}
+
+func (c *Collector) ioSchedulers() map[string]string {
+	out := make(map[string]string)
+	entries, err := os.ReadDir(filepath.Join(c.root, "sys/block"))
+	if err != nil {
+		return out
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if skipBlockDevice(name) {
+			continue
+		}
+		if value, err := c.read(filepath.Join("sys/block", name, "queue/scheduler")); err == nil && value != "" {
+			out[name] = selectedOption(value)
+		}
+	}
+	return out
+}
+
+func (c *Collector) timeSync(ctx context.Context) (string, error) {
+	if out, err := c.run(ctx, "timedatectl", "show", "-p", "NTPSynchronized", "--value"); err == nil {
+		switch strings.TrimSpace(out) {
+		case "yes":
+			return "true", nil
+		case "no":
+			return "false", nil
+		}
+	}
+	out, err := c.run(ctx, "chronyc", "-n", "tracking")
+	if err != nil {
+		return "", fmt.Errorf("timedatectl 与 chronyc 均不可用")
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "Leap status" {
+			return fmt.Sprint(strings.TrimSpace(value) == "Normal"), nil
+		}
+	}
+	return "false", nil
+}
+
+func (c *Collector) selinux() string {
+	value, err := c.read("sys/fs/selinux/enforce")
+	switch {
+	case err != nil:
+		return "disabled"
+	case value == "1":
+		return "enforcing"
+	default:
+		return "permissive"
+	}
+}
+
+func (c *Collector) firewall(ctx context.Context) (string, error) {
+	out, err := c.run(ctx, "systemctl", "is-active", "firewalld")
+	if strings.TrimSpace(out) == "active" {
+		return "active", nil
+	}
+	if status, ufwErr := c.run(ctx, "ufw", "status"); ufwErr == nil && strings.Contains(status, "Status: active") {
+		return "active", nil
+	}
+	if err != nil && strings.TrimSpace(out) == "" {
+		return "", fmt.Errorf("systemctl 不可用: %v", err)
+	}
+	return "inactive", nil
+}
+
+// mounts 为每个 MySQL 数据目录找到所在挂载点，上报其类型与挂载选项。
+func (c *Collector) mounts(facts map[string]string) error {
+	var dirs []string
+	if c.envs != nil {
+		envs, err := c.envs()
+		if err != nil {
+			return err
+		}
+		for _, env := range envs {
+			if env != nil && strings.TrimSpace(env.Static.DataDir) != "" {
+				dirs = append(dirs, env.Static.DataDir)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		facts[baselinedomain.FactMountOptions] = baselinedomain.FactNotApplicable
+		facts[baselinedomain.FactMountFSType] = baselinedomain.FactNotApplicable
+		return nil
+	}
+	table, err := c.read("proc/self/mounts")
+	if err != nil {
+		return err
+	}
+	entries := parseMounts(table)
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(filepath.Join(c.root, dir)); err == nil {
+			if rel, err := filepath.Rel(c.root, resolved); err == nil {
+				dir = "/" + rel
+			}
+		}
+		if entry, ok := mountFor(entries, dir); ok {
+			facts[baselinedomain.FactMountOptions+":"+entry.point] = entry.options
+			facts[baselinedomain.FactMountFSType+":"+entry.point] = entry.fstype
+		}
+	}
+	return nil
+}
+
+func (c *Collector) post(ctx context.Context, report baselinedomain.Report, out any) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, addr := range c.managerAddrs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+ReportPath, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		func() {
+			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				lastErr = fmt.Errorf("POST %s: http %d", ReportPath, resp.StatusCode)
+				return
+			}
+			lastErr = json.NewDecoder(resp.Body).Decode(out)
+		}()
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	return string(out), err
+}
@@ -0,0 +1,168 @@
+package baseline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	agentmysqldynamic "gmha/internal/agent/mysqldynamic"
+	baselinedomain "gmha/internal/domain/baseline"
+)
+
+func writeFake(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const fakeLimits = `Limit                     Soft Limit           Hard Limit           Units
+Max processes             65536                65536                processes
+Max open files            %s                %s                files
+`
+
+func fakeHost(t *testing.T) string {
+	root := t.TempDir()
+	writeFake(t, root, "proc/sys/vm/swappiness", "1\n")
+	writeFake(t, root, "proc/sys/net/ipv4/ip_local_port_range", "1024\t65000\n")
+	writeFake(t, root, "sys/kernel/mm/transparent_hugepage/enabled", "always madvise [never]\n")
+	writeFake(t, root, "sys/kernel/mm/transparent_hugepage/defrag", "[always] defer madvise never\n")
+	writeFake(t, root, "sys/devices/system/node/node0/cpulist", "0-3")
+	writeFake(t, root, "sys/devices/system/node/node1/cpulist", "4-7")
+	writeFake(t, root, "sys/block/sda/queue/scheduler", "[mq-deadline] kyber bfq none\n")
+	writeFake(t, root, "sys/block/nvme0n1/queue/scheduler", "[none] mq-deadline\n")
+	writeFake(t, root, "sys/block/loop0/queue/scheduler", "[none]\n")
+	writeFake(t, root, "proc/101/comm", "mysqld\n")
+	writeFake(t, root, "proc/101/limits", fmt.Sprintf(fakeLimits, "65535", "65535"))
+	writeFake(t, root, "proc/101/numa_maps", "7f00 interleave:0-1 anon=1\n")
+	writeFake(t, root, "proc/202/comm", "mysqld\n")
+	writeFake(t, root, "proc/202/limits", fmt.Sprintf(fakeLimits, "1024", "1024"))
+	writeFake(t, root, "proc/202/numa_maps", "7f00 default anon=1\n")
+	writeFake(t, root, "proc/303/comm", "bash\n")
+	writeFake(t, root, "proc/self/mounts", "/dev/sda1 / xfs rw,relatime 0 0\n/dev/sdb1 /data\\040disk xfs rw,noatime,nodiratime 0 0\n")
+	if err := os.MkdirAll(filepath.Join(root, "data disk/mysql/3306"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestCollectReadsHostFacts(t *testing.T) {
+	root := fakeHost(t)
+	collector := NewCollector("agent-1", "m1", nil, func() ([]*agentmysqldynamic.CollectEnv, error) {
+		return []*agentmysqldynamic.CollectEnv{{Static: agentmysqldynamic.StaticMySQLInfoRef{DataDir: "/data disk/mysql/3306"}}}, nil
+	})
+	collector.root = root
+	collector.sysctlKeys = []string{"net.ipv4.ip_local_port_range", "vm.swappiness", "vm.missing"}
+	collector.run = func(_ context.Context, name string, args ...string) (string, error) {
+		switch name {
+		case "timedatectl":
+			return "yes\n", nil
+		case "systemctl":
+			return "inactive\n", errors.New("exit status 3")
+		}
+		return "", errors.New("not found")
+	}
+
+	report := collector.Collect(context.Background())
+	want := map[string]string{
+		"sysctl.net.ipv4.ip_local_port_range": "1024 65000",
+		"sysctl.vm.swappiness":                "1",
+		"thp.enabled":                         "never",
+		"thp.defrag":                          "always",
+		"numa.nodes":                          "2",
+		"numa.interleave":                     "false",
+		"ulimit.nofile":                       "1024",
+		"ulimit.nproc":                        "65536",
+		"io.scheduler:sda":                    "mq-deadline",
+		"io.scheduler:nvme0n1":                "none",
+		"time.sync":                           "true",
+		"selinux":                             "disabled",
+		"firewall":                            "inactive",
+		"mount.options:/data disk":            "rw,noatime,nodiratime",
+		"mount.fstype:/data disk":             "xfs",
+	}
+	if !reflect.DeepEqual(report.Facts, want) {
+		t.Fatalf("facts = %#v", report.Facts)
+	}
+	if report.MachineID != "m1" || report.AgentID != "agent-1" || len(report.Errors) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestCollectMarksFactsNotApplicableWithoutMySQL(t *testing.T) {
+	root := t.TempDir()
+	writeFake(t, root, "sys/devices/system/node/node0/cpulist", "0-3")
+	writeFake(t, root, "sys/fs/selinux/enforce", "1")
+	collector := NewCollector("agent-1", "m1", nil, nil)
+	collector.root = root
+	collector.run = func(_ context.Context, name string, _ ...string) (string, error) {
+		if name == "chronyc" {
+			return "Reference ID    : 0A000001\nLeap status     : Not synchronised\n", nil
+		}
+		if name == "systemctl" {
+			return "active\n", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	facts := collector.Collect(context.Background()).Facts
+	for key, value := range map[string]string{
+		baselinedomain.FactNUMAInterleave: "n/a",
+		baselinedomain.FactUlimitNoFile:   "n/a",
+		baselinedomain.FactMountOptions:   "n/a",
+		baselinedomain.FactTimeSync:       "false",
+		baselinedomain.FactSELinux:        "enforcing",
+		baselinedomain.FactFirewall:       "active",
+	} {
+		if facts[key] != value {
+			t.Fatalf("%s = %q, want %q (facts %#v)", key, facts[key], value, facts)
+		}
+	}
+}
+
+func TestTickRecollectsWhenSysctlKeysChange(t *testing.T) {
+	root := fakeHost(t)
+	var reports []baselinedomain.Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != ReportPath {
+			http.NotFound(w, r)
+			return
+		}
+		var report baselinedomain.Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		reports = append(reports, report)
+		_ = json.NewEncoder(w).Encode(baselinedomain.ReportResponse{Status: "fail", SysctlKeys: []string{"vm.swappiness"}})
+	}))
+	defer server.Close()
+
+	collector := NewCollector("agent-1", "m1", []string{"http://127.0.0.1:1", server.URL + "/"}, nil)
+	collector.root = root
+	collector.run = func(context.Context, string, ...string) (string, error) { return "", errors.New("not found") }
+	collector.tick(context.Background())
+	if len(reports) != 2 {
+		t.Fatalf("reports = %d, want the first one and a re-collection", len(reports))
+	}
+	if _, ok := reports[0].Facts["sysctl.vm.swappiness"]; ok {
+		t.Fatalf("first report already has sysctl facts: %#v", reports[0].Facts)
+	}
+	if reports[1].Facts["sysctl.vm.swappiness"] != "1" {
+		t.Fatalf("second report = %#v", reports[1].Facts)
+	}
+	collector.tick(context.Background())
+	if len(reports) != 3 {
+		t.Fatalf("unchanged keys should not re-collect, reports = %d", len(reports))
+	}
+}
@@ -0,0 +1,116 @@
+package baseline
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// selectedOption returns the bracketed choice of sysfs files such as
+// "always madvise [never]"; files with a single value return it as is.
+func selectedOption(value string) string {
+	if start := strings.IndexByte(value, '['); start >= 0 {
+		if end := strings.IndexByte(value[start:], ']'); end > 0 {
+			return value[start+1 : start+end]
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// parseLimit reads the soft limit of one row of /proc/<pid>/limits.
+func parseLimit(limits, name string) (string, bool) {
+	for _, line := range strings.Split(limits, "\n") {
+		if !strings.HasPrefix(line, name+" ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, name))
+		if len(fields) == 0 {
+			return "", false
+		}
+		return fields[0], true
+	}
+	return "", false
+}
+
+func lessLimit(a, b string) bool {
+	if a == "unlimited" {
+		return false
+	}
+	if b == "unlimited" {
+		return true
+	}
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return x < y
+}
+
+// skipBlockDevice ignores virtual and stacked devices whose scheduler is
+// decided by the disks underneath.
+func skipBlockDevice(name string) bool {
+	for _, prefix := range []string{"loop", "ram", "zram", "dm-", "sr", "md", "nbd"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type mountEntry struct {
+	point   string
+	fstype  string
+	options string
+}
+
+func parseMounts(table string) []mountEntry {
+	entries := make([]mountEntry, 0)
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		entries = append(entries, mountEntry{point: unescapeMount(fields[1]), fstype: fields[2], options: fields[3]})
+	}
+	return entries
+}
+
+// unescapeMount decodes the octal escapes /proc/mounts uses for spaces and
+// other special characters in mount points.
+func unescapeMount(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if n, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// mountFor returns the mount holding dir: the longest mount point that is
+// dir or one of its parents. Later entries win on ties as they shadow
+// earlier mounts on the same point.
+func mountFor(entries []mountEntry, dir string) (mountEntry, bool) {
+	dir = path.Clean(dir)
+	best, found := mountEntry{}, false
+	for _, entry := range entries {
+		point := path.Clean(entry.point)
+		if point != "/" && dir != point && !strings.HasPrefix(dir, point+"/") {
+			continue
+		}
+		if !found || len(point) >= len(best.point) {
+			entry.point = point
+			best, found = entry, true
+		}
+	}
+	return best, found
+}
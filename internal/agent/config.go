@@ -25,6 +25,9 @@ type Config struct {
 	ManagerGRPCAddrs  []string
 	HeartbeatInterval time.Duration
 	Token             string
+	// UpgradePublicKey is the Manager key that signs self-upgrade tasks; the
+	// self-upgrade capability is only advertised when it is set.
+	UpgradePublicKey string
 }
 
 // LoadConfig 从指定路径加载代理配置文件，解析 key:value 格式的配置项并返回 Config 结构体。
@@ -78,6 +81,8 @@ func LoadConfig(path string) (Config, error) {
 			cfg.HeartbeatInterval = d
 		case "token":
 			cfg.Token = value
+		case "upgrade_public_key":
+			cfg.UpgradePublicKey = value
 		}
 	}
 	if err := scanner.Err(); err != nil {
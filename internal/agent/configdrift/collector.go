@@ -0,0 +1,199 @@
+// Package configdrift 采集本机每个 MySQL 实例的三份配置：磁盘上 my.cnf 的
+// [mysqld] 选项、performance_schema.global_variables 中的运行值以及
+// mysqld-auto.cnf 持久化的变量，定期上报 Manager 做漂移比对。
+package configdrift
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	agentmysqldynamic "gmha/internal/agent/mysqldynamic"
+	driftdomain "gmha/internal/domain/configdrift"
+)
+
+const ReportPath = "/api/v1/mysql/config-drift/report"
+
+// Collector 每个周期采集一次并上报。my.cnf 路径由 Manager 在响应中下发（安装时
+// 记录在实例上），路径变化时立即重新采集一次。
+type Collector struct {
+	agentID      string
+	machineID    string
+	managerAddrs []string
+	envs         func() ([]*agentmysqldynamic.CollectEnv, error)
+	client       *http.Client
+	interval     time.Duration
+	logger       *log.Logger
+
+	configPaths map[int]string
+}
+
+func NewCollector(agentID, machineID string, managerAddrs []string, envs func() ([]*agentmysqldynamic.CollectEnv, error)) *Collector {
+	addrs := make([]string, 0, len(managerAddrs))
+	for _, addr := range managerAddrs {
+		if addr = strings.TrimRight(strings.TrimSpace(addr), "/"); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return &Collector{
+		agentID: agentID, machineID: machineID, managerAddrs: addrs, envs: envs,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		interval:    10 * time.Minute,
+		logger:      log.Default(),
+		configPaths: map[int]string{},
+	}
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	if len(c.managerAddrs) == 0 || c.machineID == "" {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) tick(ctx context.Context) {
+	for attempt := 0; attempt < 2; attempt++ {
+		report, err := c.Collect(ctx)
+		if err != nil {
+			c.logger.Printf("config drift collector: %v", err)
+			return
+		}
+		if len(report.Instances) == 0 {
+			return
+		}
+		var response driftdomain.ReportResponse
+		if err := c.post(ctx, report, &response); err != nil {
+			if ctx.Err() == nil {
+				c.logger.Printf("config drift collector: report: %v", err)
+			}
+			return
+		}
+		if response.ConfigPaths == nil {
+			response.ConfigPaths = map[int]string{}
+		}
+		if maps.Equal(response.ConfigPaths, c.configPaths) {
+			return
+		}
+		c.configPaths = response.ConfigPaths
+	}
+}
+
+// Collect 读取本机所有实例。连不上的实例只上报错误；Manager 尚未下发 my.cnf
+// 路径时不上报配置文件内容。
+func (c *Collector) Collect(ctx context.Context) (driftdomain.Report, error) {
+	envs, err := c.envs()
+	if err != nil {
+		return driftdomain.Report{}, err
+	}
+	report := driftdomain.Report{MachineID: c.machineID, AgentID: c.agentID, Instances: make([]driftdomain.InstanceReport, 0, len(envs))}
+	seen := make(map[int]bool)
+	for _, env := range envs {
+		if env == nil || env.Static.Port <= 0 || seen[env.Static.Port] {
+			continue
+		}
+		seen[env.Static.Port] = true
+		item := driftdomain.InstanceReport{Port: env.Static.Port, ConfigPath: c.configPaths[env.Static.Port]}
+		if item.ConfigPath == "" {
+			item.ConfigError = "Manager 未登记 my.cnf 路径"
+		} else if config, err := ParseMyCnf(item.ConfigPath); err != nil {
+			item.ConfigError = err.Error()
+		} else {
+			item.Config = config
+		}
+		item.Runtime, item.Persisted, err = queryVariables(ctx, env)
+		if err != nil {
+			item.Error = err.Error()
+		}
+		report.Instances = append(report.Instances, item)
+	}
+	return report, nil
+}
+
+// queryVariables 读取全部全局变量；persisted_variables 在 5.7 上不存在，读取
+// 失败时视为没有持久化变量。
+func queryVariables(ctx context.Context, env *agentmysqldynamic.CollectEnv) (map[string]string, map[string]string, error) {
+	db, err := env.OpenDB(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	runtime, err := queryNameValues(ctx, db, "SELECT VARIABLE_NAME, VARIABLE_VALUE FROM performance_schema.global_variables")
+	if err != nil {
+		if runtime, err = queryNameValues(ctx, db, "SHOW GLOBAL VARIABLES"); err != nil {
+			return nil, nil, err
+		}
+	}
+	persisted, err := queryNameValues(ctx, db, "SELECT VARIABLE_NAME, VARIABLE_VALUE FROM performance_schema.persisted_variables")
+	if err != nil {
+		persisted = nil
+	}
+	return runtime, persisted, nil
+}
+
+func queryNameValues(ctx context.Context, db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[string]string)
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		out[strings.ToLower(name)] = value.String
+	}
+	return out, rows.Err()
+}
+
+func (c *Collector) post(ctx context.Context, report driftdomain.Report, out any) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, addr := range c.managerAddrs {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr+ReportPath, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		func() {
+			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				lastErr = fmt.Errorf("POST %s: http %d", ReportPath, resp.StatusCode)
+				return
+			}
+			lastErr = json.NewDecoder(resp.Body).Decode(out)
+		}()
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
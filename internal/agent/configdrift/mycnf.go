@@ -0,0 +1,103 @@
+package configdrift
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const maxIncludeDepth = 8
+
+// ParseMyCnf 按 mysqld 的读取规则解析 [mysqld] 与 [server] 段：支持 !include 与
+// !includedir，后出现的值覆盖先出现的；不带值的选项记为 ON。选项名统一为小写、
+// 以下划线分隔并去掉 loose_ 前缀。
+func ParseMyCnf(path string) (map[string]string, error) {
+	out := make(map[string]string)
+	if err := parseMyCnfFile(path, out, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func parseMyCnfFile(path string, out map[string]string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: !include 嵌套超过 %d 层", path, maxIncludeDepth)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	active := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case strings.HasPrefix(line, "!includedir"):
+			dir := strings.TrimSpace(strings.TrimPrefix(line, "!includedir"))
+			matches, _ := filepath.Glob(filepath.Join(dir, "*.cnf"))
+			sort.Strings(matches)
+			for _, match := range matches {
+				if err := parseMyCnfFile(match, out, depth+1); err != nil {
+					return err
+				}
+			}
+			continue
+		case strings.HasPrefix(line, "!include"):
+			if err := parseMyCnfFile(strings.TrimSpace(strings.TrimPrefix(line, "!include")), out, depth+1); err != nil {
+				return err
+			}
+			continue
+		case line[0] == '[':
+			section := strings.ToLower(strings.TrimSpace(strings.Trim(line, "[]")))
+			active = section == "mysqld" || section == "server"
+			continue
+		}
+		if !active {
+			continue
+		}
+		name, value, hasValue := strings.Cut(line, "=")
+		name = optionName(name)
+		if name == "" {
+			continue
+		}
+		if !hasValue {
+			out[name] = "ON"
+			continue
+		}
+		out[name] = optionValue(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func optionName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if index := strings.IndexAny(name, "#;"); index >= 0 {
+		name = strings.TrimSpace(name[:index])
+	}
+	name = strings.ReplaceAll(name, "-", "_")
+	return strings.TrimPrefix(name, "loose_")
+}
+
+// optionValue 去掉行尾注释与成对的引号；引号内的 # 不是注释。
+func optionValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return value[1 : end+1]
+		}
+	}
+	if index := strings.Index(value, "#"); index >= 0 {
+		value = value[:index]
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,73 @@
+package configdrift
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMyCnfReadsServerSectionsAndIncludes(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	if err := os.MkdirAll(confd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(confd, "10-tuning.cnf"), "[mysqld]\nmax_connections = 2000\n")
+	write(filepath.Join(confd, "README"), "[mysqld]\nmax_connections = 1\n")
+	write(filepath.Join(dir, "extra.cnf"), "[server]\nloose-group_replication_start_on_boot = OFF\n")
+	main := filepath.Join(dir, "my.cnf")
+	write(main, `# managed by gmha
+[client]
+port = 3307
+
+[mysqld]
+port = 3306
+max-connections = 1000 # overridden below
+innodb_buffer_pool_size = "8G"
+sql_mode = 'STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION'
+skip-name-resolve
+; comment
+!includedir `+confd+`
+!include `+filepath.Join(dir, "extra.cnf")+`
+
+[mysqldump]
+quick
+`)
+
+	config, err := ParseMyCnf(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"port":                            "3306",
+		"max_connections":                 "2000",
+		"innodb_buffer_pool_size":         "8G",
+		"sql_mode":                        "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION",
+		"skip_name_resolve":               "ON",
+		"group_replication_start_on_boot": "OFF",
+	}
+	if len(config) != len(want) {
+		t.Fatalf("config = %#v", config)
+	}
+	for name, value := range want {
+		if config[name] != value {
+			t.Fatalf("%s = %q, want %q (config %#v)", name, config[name], value, config)
+		}
+	}
+}
+
+func TestParseMyCnfRejectsMissingInclude(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my.cnf")
+	if err := os.WriteFile(path, []byte("[mysqld]\n!include /nonexistent/gmha.cnf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseMyCnf(path); err == nil {
+		t.Fatal("expected missing include to fail")
+	}
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	agentcore "gmha/internal/agent/core"
+	"gmha/internal/buildinfo"
+	taskdomain "gmha/internal/domain/task"
+)
+
+// maxAgentBinaryBytes bounds a downloaded Agent binary.
+const maxAgentBinaryBytes = 512 << 20
+
+// appliedUpgradesFile lists the self-upgrade task IDs this Agent has already
+// accepted, one "<task_id> <expires_at>" per line. It lives next to agentd so
+// it survives the restart that every upgrade ends with.
+const appliedUpgradesFile = "agentd.applied-upgrades"
+
+// AgentSelfUpgradeHandler replaces the running agentd without SSH: it verifies
+// the Manager signature, downloads and checks the new binary, swaps it
+// atomically next to a backup and exits so systemd (Restart=always) starts the
+// new version.
+type AgentSelfUpgradeHandler struct {
+	managerHTTPAddr string
+	installDir      string
+	machineID       string
+	publicKey       ed25519.PublicKey
+	client          *http.Client
+	currentVersion  func() string
+	restart         func()
+	now             func() time.Time
+	appliedMu       sync.Mutex
+}
+
+// NewAgentSelfUpgradeHandler pins publicKey, the base64 ed25519 key from
+// agent.yaml, and only accepts tasks signed for machineID.
+func NewAgentSelfUpgradeHandler(managerHTTPAddr, installDir, machineID, publicKey string) (*AgentSelfUpgradeHandler, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("upgrade_public_key is not a valid base64 ed25519 public key")
+	}
+	return &AgentSelfUpgradeHandler{
+		managerHTTPAddr: strings.TrimRight(managerHTTPAddr, "/"),
+		installDir:      strings.TrimSpace(installDir),
+		machineID:       strings.TrimSpace(machineID),
+		publicKey:       ed25519.PublicKey(key),
+		client:          &http.Client{Timeout: 10 * time.Minute},
+		currentVersion:  buildinfo.CurrentVersion,
+		restart:         restartAgentProcess,
+		now:             time.Now,
+	}, nil
+}
+
+func (h *AgentSelfUpgradeHandler) Type() string { return string(taskdomain.TypeAgentSelfUpgrade) }
+
+func (h *AgentSelfUpgradeHandler) Handle(ctx context.Context, task taskdomain.DispatchTask, reporter *agentcore.Reporter) error {
+	var spec taskdomain.AgentSelfUpgradeSpec
+	if err := json.Unmarshal(task.Spec, &spec); err != nil {
+		return fmt.Errorf("decode agent self-upgrade spec: %w", err)
+	}
+	step := firstStep(task.Steps)
+	started := time.Now().UTC()
+	_ = reporter.Report(taskdomain.ReportEnvelope{
+		TaskID: task.ID, Status: taskdomain.StatusRunning, Progress: 5, CurrentStep: step.StepName,
+		Step: &taskdomain.StepReport{StepID: step.ID, StepNo: step.StepNo, StepName: step.StepName, Status: taskdomain.StepRunning, Message: "正在校验签名并准备新版本 Agent", StartedAt: &started},
+	})
+	baseURL := agentcore.ManagerHTTPAddrFromContext(ctx)
+	if baseURL == "" {
+		baseURL = h.managerHTTPAddr
+	}
+	result, err := h.upgrade(ctx, task.ID, spec, baseURL)
+	if err != nil {
+		return err
+	}
+	payload, _ := json.Marshal(result)
+	finished := time.Now().UTC()
+	message := fmt.Sprintf("Agent 已从 %s 替换为 %s，备份 %s，即将由 systemd 重启", result.PreviousVersion, result.Version, result.BackupPath)
+	reportErr := reporter.Report(taskdomain.ReportEnvelope{
+		TaskID: task.ID, Status: taskdomain.StatusSuccess, Progress: 100, CurrentStep: step.StepName, Result: payload,
+		Step:  &taskdomain.StepReport{StepID: step.ID, StepNo: step.StepNo, StepName: step.StepName, Status: taskdomain.StepSuccess, Message: message, StartedAt: &started, FinishedAt: &finished},
+		Event: &taskdomain.Event{TaskID: task.ID, StepID: step.ID, EventType: taskdomain.EventInfo, Content: message},
+	})
+	// The binary on disk is already the new version, so restart even if the
+	// report could not be delivered; the Manager checks the next heartbeat.
+	go h.restart()
+	return reportErr
+}
+
+// upgrade verifies the spec for taskID and swaps the binary. It returns before
+// the process restarts.
+func (h *AgentSelfUpgradeHandler) upgrade(ctx context.Context, taskID string, spec taskdomain.AgentSelfUpgradeSpec, baseURL string) (taskdomain.AgentSelfUpgradeResult, error) {
+	if err := h.verify(taskID, spec); err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, err
+	}
+	if err := h.markApplied(spec); err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, err
+	}
+	target := filepath.Join(h.installDir, "agentd")
+	info, err := os.Stat(target)
+	if err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("stat current agent binary: %w", err)
+	}
+	previous := h.currentVersion()
+	candidate := filepath.Join(h.installDir, fmt.Sprintf(".agentd.%d.candidate", time.Now().UnixNano()))
+	defer os.Remove(candidate)
+	if spec.RestoreVersion != "" {
+		backup := agentBackupPath(h.installDir, spec.RestoreVersion)
+		if err := copyAgentBinary(backup, candidate, info.Mode()); err != nil {
+			return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("restore backup %s: %w", backup, err)
+		}
+	} else if err := h.download(ctx, managerResourceURL(baseURL, spec.DownloadURL, "/api/v1/packages/"), candidate, spec.SHA256); err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, err
+	}
+	want := spec.Version
+	if spec.RestoreVersion != "" {
+		want = spec.RestoreVersion
+	}
+	output, err := exec.CommandContext(ctx, candidate, "--version").CombinedOutput()
+	if err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("new agent binary failed --version: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if got := strings.TrimSpace(string(output)); !sameAgentVersion(got, want) {
+		return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("new agent binary reports version %q, expected %q", got, want)
+	}
+	backup := agentBackupPath(h.installDir, previous)
+	if err := copyAgentBinary(target, backup, info.Mode()); err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("backup current agent binary: %w", err)
+	}
+	if err := os.Rename(candidate, target); err != nil {
+		return taskdomain.AgentSelfUpgradeResult{}, fmt.Errorf("replace agent binary: %w", err)
+	}
+	return taskdomain.AgentSelfUpgradeResult{PreviousVersion: previous, Version: want, BackupPath: backup}, nil
+}
+
+func (h *AgentSelfUpgradeHandler) verify(taskID string, spec taskdomain.AgentSelfUpgradeSpec) error {
+	signature, err := base64.StdEncoding.DecodeString(spec.Signature)
+	if err != nil || !ed25519.Verify(h.publicKey, spec.SigningPayload(), signature) {
+		return errors.New("self-upgrade task signature is invalid for the pinned Manager key")
+	}
+	if h.machineID == "" || spec.MachineID != h.machineID {
+		return fmt.Errorf("self-upgrade task is signed for machine %q, not this one", spec.MachineID)
+	}
+	if strings.TrimSpace(taskID) == "" || spec.TaskID != taskID {
+		return fmt.Errorf("self-upgrade spec is signed for task %q, not %q", spec.TaskID, taskID)
+	}
+	if h.now().After(spec.ExpiresAt) {
+		return fmt.Errorf("self-upgrade task expired at %s", spec.ExpiresAt.Format(time.RFC3339))
+	}
+	if strings.TrimSpace(spec.Version) == "" {
+		return errors.New("version is required")
+	}
+	if spec.RestoreVersion == "" && (strings.TrimSpace(spec.DownloadURL) == "" || len(spec.SHA256) != sha256.Size*2) {
+		return errors.New("download_url and sha256 are required")
+	}
+	if arch := normalizeAgentArch(spec.Arch); arch != "" && arch != "未识别" && arch != normalizeAgentArch(runtime.GOARCH) {
+		return fmt.Errorf("package architecture %s does not match host %s", spec.Arch, runtime.GOARCH)
+	}
+	return nil
+}
+
+// markApplied records spec.TaskID as consumed before anything is replaced, so a
+// signed task is honoured at most once even if it is dispatched again before
+// it expires. Entries are dropped once their signature has expired; a ledger
+// that cannot be read or written refuses the upgrade rather than risk a replay.
+func (h *AgentSelfUpgradeHandler) markApplied(spec taskdomain.AgentSelfUpgradeSpec) error {
+	h.appliedMu.Lock()
+	defer h.appliedMu.Unlock()
+	path := filepath.Join(h.installDir, appliedUpgradesFile)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read applied self-upgrade tasks: %w", err)
+	}
+	var kept []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[0] == spec.TaskID {
+			return fmt.Errorf("self-upgrade task %s was already applied", spec.TaskID)
+		}
+		if expires, err := time.Parse(time.RFC3339, fields[1]); err == nil && h.now().After(expires) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	kept = append(kept, spec.TaskID+" "+spec.ExpiresAt.UTC().Format(time.RFC3339))
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, []byte(strings.Join(kept, "\n")+"\n"), 0o600); err != nil {
+		return fmt.Errorf("record applied self-upgrade task: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return fmt.Errorf("record applied self-upgrade task: %w", err)
+	}
+	return nil
+}
+
+func (h *AgentSelfUpgradeHandler) download(ctx context.Context, url, path, checksum string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download agent binary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download agent binary failed: %s", resp.Status)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, maxAgentBinaryBytes+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("download agent binary: %w", err)
+	}
+	if written > maxAgentBinaryBytes {
+		return fmt.Errorf("agent binary exceeds %d bytes", maxAgentBinaryBytes)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(got, checksum) {
+		return fmt.Errorf("agent binary sha256 %s does not match %s", got, checksum)
+	}
+	return os.Chmod(path, 0o755)
+}
+
+func agentBackupPath(installDir, version string) string {
+	return filepath.Join(installDir, "agentd.backup-"+strings.ReplaceAll(strings.TrimSpace(version), "/", "_"))
+}
+
+func copyAgentBinary(source, target string, mode os.FileMode) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(content, []byte("\x7fELF")) && !bytes.HasPrefix(content, []byte("#!")) {
+		return fmt.Errorf("%s is not an executable", source)
+	}
+	return os.WriteFile(target, content, mode.Perm()|0o111)
+}
+
+func normalizeAgentArch(arch string) string {
+	switch strings.ToLower(strings.TrimSpace(arch)) {
+	case "amd64", "x86_64":
+		return "x86_64"
+	case "arm64", "aarch64":
+		return "aarch64"
+	default:
+		return strings.ToLower(strings.TrimSpace(arch))
+	}
+}
+
+func sameAgentVersion(left, right string) bool {
+	normalize := func(value string) string {
+		value = strings.TrimSpace(value)
+		if fields := strings.Fields(value); len(fields) > 0 {
+			value = fields[len(fields)-1]
+		}
+		return strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(value, "V"), "v"))
+	}
+	return normalize(left) != "" && normalize(left) == normalize(right)
+}
+
+// restartAgentProcess stops the Agent gracefully after the task report has
+// been flushed; systemd restarts the unit with the new binary.
+func restartAgentProcess() {
+	time.Sleep(2 * time.Second)
+	if process, err := os.FindProcess(os.Getpid()); err == nil && process.Signal(syscall.SIGTERM) == nil {
+		return
+	}
+	os.Exit(0)
+}
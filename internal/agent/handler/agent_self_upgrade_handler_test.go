@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	taskdomain "gmha/internal/domain/task"
+)
+
+const newAgentScript = "#!/bin/sh\necho V1.2.0\n"
+
+func newSelfUpgradeFixture(t *testing.T) (*AgentSelfUpgradeHandler, ed25519.PrivateKey, string) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "agentd"), []byte("#!/bin/sh\necho V1.1.0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewAgentSelfUpgradeHandler("", dir, "machine-01", base64.StdEncoding.EncodeToString(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.currentVersion = func() string { return "V1.1.0" }
+	handler.restart = func() {}
+	return handler, private, dir
+}
+
+func signSelfUpgrade(key ed25519.PrivateKey, spec taskdomain.AgentSelfUpgradeSpec, expires time.Time) taskdomain.AgentSelfUpgradeSpec {
+	if spec.MachineID == "" {
+		spec.MachineID = "machine-01"
+	}
+	if spec.TaskID == "" {
+		spec.TaskID = "task-01"
+	}
+	spec.ExpiresAt = expires.UTC().Truncate(time.Second)
+	spec.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, spec.SigningPayload()))
+	return spec
+}
+
+func TestAgentSelfUpgradeVerifiesDownloadAndSwapsBinary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/packages/gmha-agent/gmha-V1.2.0" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(newAgentScript))
+	}))
+	defer server.Close()
+	handler, key, dir := newSelfUpgradeFixture(t)
+	sum := sha256.Sum256([]byte(newAgentScript))
+	spec := taskdomain.AgentSelfUpgradeSpec{
+		Version: "V1.2.0", Arch: runtime.GOARCH, PackageName: "gmha-V1.2.0",
+		DownloadURL: "/api/v1/packages/gmha-agent/gmha-V1.2.0", SHA256: hex.EncodeToString(sum[:]),
+	}
+
+	result, err := handler.upgrade(context.Background(), "task-01", signSelfUpgrade(key, spec, time.Now().Add(time.Hour)), server.URL)
+	if err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	if result.PreviousVersion != "V1.1.0" || result.Version != "V1.2.0" || result.BackupPath != filepath.Join(dir, "agentd.backup-V1.1.0") {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "agentd")); string(content) != newAgentScript {
+		t.Fatalf("agentd was not replaced: %q", content)
+	}
+	if content, _ := os.ReadFile(result.BackupPath); !strings.Contains(string(content), "V1.1.0") {
+		t.Fatalf("backup does not hold the previous binary: %q", content)
+	}
+
+	// Restoring the backup needs neither the package store nor a checksum.
+	handler.currentVersion = func() string { return "V1.2.0" }
+	restore := taskdomain.AgentSelfUpgradeSpec{TaskID: "task-02", Version: "V1.1.0", RestoreVersion: "V1.1.0"}
+	if _, err := handler.upgrade(context.Background(), "task-02", signSelfUpgrade(key, restore, time.Now().Add(time.Hour)), ""); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "agentd")); !strings.Contains(string(content), "V1.1.0") {
+		t.Fatalf("agentd was not restored: %q", content)
+	}
+}
+
+func TestAgentSelfUpgradeRejectsUntrustedTasks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(newAgentScript))
+	}))
+	defer server.Close()
+	handler, key, dir := newSelfUpgradeFixture(t)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	sum := sha256.Sum256([]byte(newAgentScript))
+	spec := taskdomain.AgentSelfUpgradeSpec{
+		Version: "V1.2.0", PackageName: "gmha-V1.2.0",
+		DownloadURL: "/api/v1/packages/gmha-agent/gmha-V1.2.0", SHA256: hex.EncodeToString(sum[:]),
+	}
+	tampered := signSelfUpgrade(key, spec, time.Now().Add(time.Hour))
+	tampered.Version = "V9.9.9"
+	wrongSum := spec
+	wrongSum.SHA256 = strings.Repeat("0", 64)
+	otherMachine := spec
+	otherMachine.MachineID = "machine-02"
+	retargeted := signSelfUpgrade(key, spec, time.Now().Add(time.Hour))
+	retargeted.MachineID = "machine-02"
+	otherTask := spec
+	otherTask.TaskID = "task-02"
+
+	cases := map[string]taskdomain.AgentSelfUpgradeSpec{
+		"other key": signSelfUpgrade(otherKey, spec, time.Now().Add(time.Hour)),
+		"tampered":  tampered,
+		"expired":   signSelfUpgrade(key, spec, time.Now().Add(-time.Minute)),
+		"checksum":  signSelfUpgrade(key, wrongSum, time.Now().Add(time.Hour)),
+		"replayed":  signSelfUpgrade(key, otherMachine, time.Now().Add(time.Hour)),
+		"retarget":  retargeted,
+		"retask":    signSelfUpgrade(key, otherTask, time.Now().Add(time.Hour)),
+	}
+	for name, candidate := range cases {
+		if _, err := handler.upgrade(context.Background(), "task-01", candidate, server.URL); err == nil {
+			t.Fatalf("%s: upgrade should be rejected", name)
+		}
+		if content, _ := os.ReadFile(filepath.Join(dir, "agentd")); !strings.Contains(string(content), "V1.1.0") {
+			t.Fatalf("%s: agentd must stay untouched, got %q", name, content)
+		}
+	}
+}
+
+func TestAgentSelfUpgradeRefusesReplayedTaskID(t *testing.T) {
+	handler, key, dir := newSelfUpgradeFixture(t)
+	if err := os.WriteFile(agentBackupPath(dir, "V1.0.0"), []byte("#!/bin/sh\necho V1.0.0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	downgrade := signSelfUpgrade(key, taskdomain.AgentSelfUpgradeSpec{Version: "V1.0.0", RestoreVersion: "V1.0.0"}, time.Now().Add(time.Hour))
+	if _, err := handler.upgrade(context.Background(), "task-01", downgrade, ""); err != nil {
+		t.Fatalf("first restore: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "agentd"), []byte("#!/bin/sh\necho V1.1.0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ledger survives the restart: a fresh handler on the same install
+	// directory still refuses the captured task, even re-dispatched under its ID.
+	restarted, err := NewAgentSelfUpgradeHandler("", dir, "machine-01", base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.currentVersion = func() string { return "V1.1.0" }
+	if _, err := restarted.upgrade(context.Background(), "task-01", downgrade, ""); err == nil || !strings.Contains(err.Error(), "already applied") {
+		t.Fatalf("replayed task should be refused, got %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "agentd")); !strings.Contains(string(content), "V1.1.0") {
+		t.Fatalf("agentd must stay untouched, got %q", content)
+	}
+
+	// Expired entries are pruned so the ledger does not grow without bound.
+	restarted.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	fresh := signSelfUpgrade(key, taskdomain.AgentSelfUpgradeSpec{TaskID: "task-02", Version: "V1.0.0", RestoreVersion: "V1.0.0"}, time.Now().Add(3*time.Hour))
+	if _, err := restarted.upgrade(context.Background(), "task-02", fresh, ""); err != nil {
+		t.Fatalf("fresh task: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, appliedUpgradesFile)); strings.Contains(string(content), "task-01") || !strings.Contains(string(content), "task-02") {
+		t.Fatalf("unexpected ledger %q", content)
+	}
+}
@@ -85,3 +85,20 @@ func TestModernTopologyDoesNotProvisionCloneAccountUnlessRequested(t *testing.T)
 		}
 	}
 }
+
+func TestTopologyReplicationUsesManagedCAWhenProvided(t *testing.T) {
+	spec := mysql57TopologySpec()
+	spec.Node.RequiresReplicationSetup = true
+	spec.Node.SourceIP, spec.Node.SourcePort = "10.0.0.1", 3306
+	if command := topologyReplicationCommand(spec); strings.Contains(command, "MASTER_SSL") {
+		t.Fatalf("replication without CA must stay plaintext: %s", command)
+	}
+	spec.Node.ReplicationSSLCA = "/data/3306/tls/ca.pem"
+	spec.Node.ReplicationSSLVerify = true
+	command := topologyReplicationCommand(spec)
+	for _, expected := range []string{"SOURCE_SSL=1, SOURCE_SSL_CA=", "SOURCE_SSL_VERIFY_SERVER_CERT=1", "MASTER_SSL=1, MASTER_SSL_CA=", "MASTER_SSL_VERIFY_SERVER_CERT=1", "/data/3306/tls/ca.pem"} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("replication command missing %q: %s", expected, command)
+		}
+	}
+}
@@ -3,17 +3,21 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	agentcore "gmha/internal/agent/core"
 	"gmha/internal/agent/mysqlcheck"
+	certdomain "gmha/internal/domain/certificate"
 	taskdomain "gmha/internal/domain/task"
 	mysqlapp "gmha/internal/mysql"
 )
@@ -119,6 +123,10 @@ func (r *mysqlInstallRunner) run() error {
 			return r.writeFileStep(step, r.spec.EnvFilePath, r.spec.EnvContent)
 		},
 		func(step taskdomain.DispatchStep) error {
+			// Certificates go first so my.cnf never references missing ssl_* files.
+			if err := writeMySQLTLSFiles(r.spec.TLS, r.spec.MySQLUser); err != nil {
+				return r.failStep(step, err)
+			}
 			return r.writeFileStep(step, r.spec.MyCnfPath, r.spec.MyCnfContent)
 		},
 		func(step taskdomain.DispatchStep) error {
@@ -758,6 +766,60 @@ func (r *mysqlInstallRunner) writeFileStep(step taskdomain.DispatchStep, path, c
 	return r.successStep(step, "文件已写入 "+path, "")
 }
 
+// writeMySQLTLSFiles installs the Manager-issued CA, certificate and key into
+// the instance TLS directory. Files are renamed into place so a reinstall never
+// leaves MySQL reading a half-written key.
+func writeMySQLTLSFiles(spec *taskdomain.MySQLTLSSpec, owner string) error {
+	if spec == nil {
+		return nil
+	}
+	dir := filepath.Clean(strings.TrimSpace(spec.Directory))
+	if !filepath.IsAbs(dir) || dir == "/" {
+		return fmt.Errorf("invalid TLS directory %q", spec.Directory)
+	}
+	if strings.TrimSpace(spec.CAPEM) == "" || strings.TrimSpace(spec.CertPEM) == "" || strings.TrimSpace(spec.KeyPEM) == "" {
+		return errors.New("TLS spec requires CA, certificate and key")
+	}
+	account, err := user.Lookup(owner)
+	if err != nil {
+		return fmt.Errorf("lookup MySQL user %s: %w", owner, err)
+	}
+	uid, _ := strconv.Atoi(account.Uid)
+	gid, _ := strconv.Atoi(account.Gid)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return err
+	}
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{name: certdomain.CAFileName, content: spec.CAPEM, mode: 0o644},
+		{name: certdomain.CertFileName, content: spec.CertPEM, mode: 0o644},
+		{name: certdomain.KeyFileName, content: spec.KeyPEM, mode: 0o600},
+	}
+	for _, file := range files {
+		target := filepath.Join(dir, file.name)
+		temp := target + ".gmha-tmp"
+		if err := os.WriteFile(temp, []byte(file.content), file.mode); err != nil {
+			return err
+		}
+		if err := os.Chmod(temp, file.mode); err != nil {
+			return err
+		}
+		if err := os.Chown(temp, uid, gid); err != nil {
+			return err
+		}
+		if err := os.Rename(temp, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *mysqlInstallRunner) optimizeLimitsStep(step taskdomain.DispatchStep) error {
 	startedAt := r.markStepStarted(step)
 	_ = r.reporter.Report(taskdomain.ReportEnvelope{
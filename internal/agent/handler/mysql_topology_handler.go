@@ -290,22 +290,24 @@ func topologyReplicationCommand(spec taskdomain.MySQLTopologySpec) string {
 		)
 	}
 	newSQL := fmt.Sprintf(
-		"CHANGE REPLICATION SOURCE TO SOURCE_HOST='%s', SOURCE_PORT=%d, SOURCE_USER='%s', SOURCE_PASSWORD='%s', SOURCE_AUTO_POSITION=1, SOURCE_CONNECT_RETRY=2, SOURCE_RETRY_COUNT=30, SOURCE_DELAY=%d; START REPLICA; SET GLOBAL read_only=%s; SET GLOBAL super_read_only=%s;",
+		"CHANGE REPLICATION SOURCE TO SOURCE_HOST='%s', SOURCE_PORT=%d, SOURCE_USER='%s', SOURCE_PASSWORD='%s', SOURCE_AUTO_POSITION=1, SOURCE_CONNECT_RETRY=2, SOURCE_RETRY_COUNT=30, SOURCE_DELAY=%d%s; START REPLICA; SET GLOBAL read_only=%s; SET GLOBAL super_read_only=%s;",
 		mysqlSQLEscape(node.SourceIP),
 		node.SourcePort,
 		mysqlSQLEscape(spec.ReplicationUser),
 		mysqlSQLEscape(spec.ReplicationPassword),
 		node.ReplicationDelaySeconds,
+		topologyReplicationTLSOptions(node, "SOURCE"),
 		mysqlBool(node.ReadOnly),
 		mysqlBool(node.SuperReadOnly),
 	)
 	oldSQL := fmt.Sprintf(
-		"CHANGE MASTER TO MASTER_HOST='%s', MASTER_PORT=%d, MASTER_USER='%s', MASTER_PASSWORD='%s', MASTER_AUTO_POSITION=1, MASTER_CONNECT_RETRY=2, MASTER_RETRY_COUNT=30, MASTER_DELAY=%d; START SLAVE; SET GLOBAL read_only=%s; SET GLOBAL super_read_only=%s;",
+		"CHANGE MASTER TO MASTER_HOST='%s', MASTER_PORT=%d, MASTER_USER='%s', MASTER_PASSWORD='%s', MASTER_AUTO_POSITION=1, MASTER_CONNECT_RETRY=2, MASTER_RETRY_COUNT=30, MASTER_DELAY=%d%s; START SLAVE; SET GLOBAL read_only=%s; SET GLOBAL super_read_only=%s;",
 		mysqlSQLEscape(node.SourceIP),
 		node.SourcePort,
 		mysqlSQLEscape(spec.ReplicationUser),
 		mysqlSQLEscape(spec.ReplicationPassword),
 		node.ReplicationDelaySeconds,
+		topologyReplicationTLSOptions(node, "MASTER"),
 		mysqlBool(node.ReadOnly),
 		mysqlBool(node.SuperReadOnly),
 	)
@@ -317,6 +319,20 @@ func topologyReplicationCommand(spec taskdomain.MySQLTopologySpec) string {
 	)
 }
 
+// topologyReplicationTLSOptions returns the SSL clause for CHANGE REPLICATION
+// SOURCE (prefix SOURCE) or CHANGE MASTER (prefix MASTER). It is empty unless
+// the Manager attached a CA for this replica.
+func topologyReplicationTLSOptions(node taskdomain.MySQLTopologyNodeSpec, prefix string) string {
+	if strings.TrimSpace(node.ReplicationSSLCA) == "" {
+		return ""
+	}
+	options := fmt.Sprintf(", %s_SSL=1, %s_SSL_CA='%s'", prefix, prefix, mysqlSQLEscape(node.ReplicationSSLCA))
+	if node.ReplicationSSLVerify {
+		options += fmt.Sprintf(", %s_SSL_VERIFY_SERVER_CERT=1", prefix)
+	}
+	return options
+}
+
 func topologyVerifyCommand(spec taskdomain.MySQLTopologySpec) string {
 	node := spec.Node
 	if !node.RequiresReplicationSetup || strings.TrimSpace(node.SourceIP) == "" {
@@ -5,19 +5,23 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	agentbaseline "gmha/internal/agent/baseline"
 	agentcollect "gmha/internal/agent/collect"
+	agentconfigdrift "gmha/internal/agent/configdrift"
 	agentcore "gmha/internal/agent/core"
 	agentdynamic "gmha/internal/agent/dynamic"
 	agenthandler "gmha/internal/agent/handler"
 	"gmha/internal/agent/mysqlcheck"
 	agentmysqldynamic "gmha/internal/agent/mysqldynamic"
 	"gmha/internal/agent/selfcheck"
+	agentslowlog "gmha/internal/agent/slowlog"
 	"gmha/internal/buildinfo"
 	dynamicdomain "gmha/internal/domain/dynamic"
 	hbdomain "gmha/internal/domain/heartbeat"
@@ -38,6 +42,15 @@ func Run(ctx context.Context, cfg Config) error {
 		agenthandler.NewMySQLTopologyHandler(),
 		agenthandler.NewFlameGraphHandler(),
 	)
+	// Self-upgrade is only advertised when agent.yaml pins the Manager signing
+	// key; without it the Manager keeps upgrading this Agent over SSH.
+	if strings.TrimSpace(cfg.UpgradePublicKey) != "" {
+		if selfUpgrade, err := agenthandler.NewAgentSelfUpgradeHandler(cfg.ManagerHTTPAddr, cfg.InstallDir, cfg.MachineID, cfg.UpgradePublicKey); err != nil {
+			log.Printf("agent self-upgrade disabled: %v", err)
+		} else {
+			dispatcher.Register(selfUpgrade)
+		}
+	}
 	receiver := agentcore.NewReceiver(strings.Join(cfg.ManagerHTTPAddrs, ","), cfg.AgentID, cfg.MachineID, dispatcher)
 	go func() {
 		_ = receiver.Run(ctx)
@@ -70,6 +83,24 @@ func Run(ctx context.Context, cfg Config) error {
 	mysqlDynamicManager.Start(ctx, dynamicdomain.BuildDefaultMySQLDynamicCollectConfig())
 	defer mysqlDynamicManager.StopMySQLDynamicCollectors()
 
+	// log_output=FILE 的实例由 Agent 读取慢日志文件并按游标上报 Manager。
+	slowLogCollector := agentslowlog.NewCollector(cfg.AgentID, cfg.MachineID, cfg.ManagerHTTPAddrs, func() ([]*agentmysqldynamic.CollectEnv, error) {
+		return agentmysqldynamic.BuildCollectEnvs(mysqlConfigPath)
+	})
+	go slowLogCollector.Run(ctx)
+
+	// 主机基线事实定期上报 Manager，由 Manager 按集群基线评估。
+	baselineCollector := agentbaseline.NewCollector(cfg.AgentID, cfg.MachineID, cfg.ManagerHTTPAddrs, func() ([]*agentmysqldynamic.CollectEnv, error) {
+		return agentmysqldynamic.BuildCollectEnvs(mysqlConfigPath)
+	})
+	go baselineCollector.Run(ctx)
+
+	// my.cnf、运行值与持久化变量定期上报 Manager 做配置漂移比对。
+	configDriftCollector := agentconfigdrift.NewCollector(cfg.AgentID, cfg.MachineID, cfg.ManagerHTTPAddrs, func() ([]*agentmysqldynamic.CollectEnv, error) {
+		return agentmysqldynamic.BuildCollectEnvs(mysqlConfigPath)
+	})
+	go configDriftCollector.Run(ctx)
+
 	go func() {
 		for {
 			resp, recvErr := stream.Recv()
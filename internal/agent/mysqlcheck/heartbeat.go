@@ -285,6 +285,49 @@ func UpsertInstance(path string, instance InstanceConfig) error {
 	return writeConfig(path, cfg)
 }
 
+// SetInstanceCredentials 更新配置文件中指定端口实例的采集账号和密码，其他字段保持不变。
+// 实例不存在时返回错误，避免为未纳管的端口凭空生成配置。
+func SetInstanceCredentials(path string, port int, username, password string) error {
+	username = strings.TrimSpace(username)
+	if port <= 0 || username == "" || password == "" {
+		return errors.New("mysql heartbeat credentials require port, username and password")
+	}
+	cfg, _, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	updated := false
+	for i := range cfg.Instances {
+		if normalizeInstance(cfg.Instances[i]).Port == port {
+			cfg.Instances[i].Username = username
+			cfg.Instances[i].Password = password
+			updated = true
+		}
+	}
+	if !updated {
+		return fmt.Errorf("mysql heartbeat config has no instance on port %d", port)
+	}
+	return writeConfig(path, cfg)
+}
+
+// CheckInstanceCredentials 校验配置文件中指定端口实例的采集账号和密码与给定值一致。
+func CheckInstanceCredentials(path string, port int, username, password string) error {
+	cfg, _, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	for _, item := range cfg.Instances {
+		if normalizeInstance(item).Port != port {
+			continue
+		}
+		if strings.TrimSpace(item.Username) != strings.TrimSpace(username) || item.Password != password {
+			return fmt.Errorf("mysql heartbeat credentials on port %d do not match", port)
+		}
+		return nil
+	}
+	return fmt.Errorf("mysql heartbeat config has no instance on port %d", port)
+}
+
 // EnsureInstance 确保指定 MySQL 实例的心跳表已创建。
 func EnsureInstance(ctx context.Context, instance InstanceConfig) error {
 	instance = normalizeInstance(instance)
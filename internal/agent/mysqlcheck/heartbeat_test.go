@@ -0,0 +1,39 @@
+package mysqlcheck
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSetInstanceCredentialsKeepsOtherFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	if err := UpsertInstance(path, InstanceConfig{Port: 3306, Username: "mha", Password: "old", ManagementUsername: "root", ManagementPassword: "root-secret", DataDir: "/data/mysql"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpsertInstance(path, InstanceConfig{Port: 3307, Username: "mha", Password: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetInstanceCredentials(path, 3306, "mha", "new"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := cfg.Instances[0], cfg.Instances[1]
+	if first.Password != "new" || first.ManagementPassword != "root-secret" || first.DataDir != "/data/mysql" {
+		t.Fatalf("unexpected updated instance: %+v", first)
+	}
+	if second.Password != "old" {
+		t.Fatalf("other instance must keep its password: %+v", second)
+	}
+	if err := CheckInstanceCredentials(path, 3306, "mha", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckInstanceCredentials(path, 3307, "mha", "new"); err == nil {
+		t.Fatal("stale password must fail the check")
+	}
+	if err := SetInstanceCredentials(path, 3310, "mha", "new"); err == nil {
+		t.Fatal("unknown port must be rejected")
+	}
+}
@@ -0,0 +1,303 @@
+package slowlog
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	agentmysqldynamic "gmha/internal/agent/mysqldynamic"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	IngestPath = "/api/v1/sql-diagnostics/slow-log/ingest"
+	CursorPath = "/api/v1/sql-diagnostics/slow-log/cursor"
+
+	maxBatchEvents    = 500
+	maxBatchTextBytes = 2 << 20
+	maxEventTextBytes = 64 << 10
+	maxBatchesPerTick = 20
+	maxDigestCache    = 10000
+)
+
+var errCursorConflict = errors.New("slow log cursor conflict")
+
+// Collector 为本机每个已登记 MySQL 实例跟踪慢日志文件。仅当 slow_query_log 开启且
+// log_output 只含 FILE 时生效；含 TABLE 的实例已由 Manager 从 mysql.slow_log 采集，
+// 再读文件会重复计数。
+type Collector struct {
+	agentID      string
+	machineID    string
+	managerAddrs []string
+	envs         func() ([]*agentmysqldynamic.CollectEnv, error)
+	client       *http.Client
+	interval     time.Duration
+	logger       *log.Logger
+
+	states map[int]*instanceState
+}
+
+type instanceState struct {
+	tailer        *Tailer
+	checkedAt     time.Time
+	digestCache   map[string][2]string
+	serverDigests bool
+}
+
+func NewCollector(agentID, machineID string, managerAddrs []string, envs func() ([]*agentmysqldynamic.CollectEnv, error)) *Collector {
+	addrs := make([]string, 0, len(managerAddrs))
+	for _, addr := range managerAddrs {
+		if addr = strings.TrimRight(strings.TrimSpace(addr), "/"); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return &Collector{
+		agentID: agentID, machineID: machineID, managerAddrs: addrs, envs: envs,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: 10 * time.Second,
+		logger:   log.Default(),
+		states:   make(map[int]*instanceState),
+	}
+}
+
+func (c *Collector) Run(ctx context.Context) {
+	if len(c.managerAddrs) == 0 || c.machineID == "" {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	defer c.closeAll()
+	for {
+		c.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Collector) tick(ctx context.Context) {
+	envs, err := c.envs()
+	if err != nil {
+		c.logger.Printf("slow log collector: load mysql instances: %v", err)
+		return
+	}
+	seen := make(map[int]bool, len(envs))
+	for _, env := range envs {
+		if env == nil || env.Static.Port <= 0 {
+			continue
+		}
+		seen[env.Static.Port] = true
+		if err := c.collect(ctx, env); err != nil && ctx.Err() == nil {
+			c.logger.Printf("slow log collector: port %d: %v", env.Static.Port, err)
+		}
+	}
+	for port, state := range c.states {
+		if !seen[port] {
+			if state.tailer != nil {
+				state.tailer.Close()
+			}
+			delete(c.states, port)
+		}
+	}
+}
+
+func (c *Collector) collect(ctx context.Context, env *agentmysqldynamic.CollectEnv) error {
+	port := env.Static.Port
+	state := c.states[port]
+	if state == nil {
+		state = &instanceState{digestCache: make(map[string][2]string), serverDigests: true}
+		c.states[port] = state
+	}
+	db, err := env.OpenDB(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if state.checkedAt.IsZero() || time.Since(state.checkedAt) >= time.Minute {
+		state.checkedAt = time.Now()
+		path, fileOutput, tableOutput, err := mysqlapp.SlowLogFileSettings(ctx, db)
+		if err != nil {
+			return err
+		}
+		if !fileOutput || tableOutput || path == "" {
+			if state.tailer != nil {
+				state.tailer.Close()
+				state.tailer = nil
+			}
+			return nil
+		}
+		if state.tailer == nil || state.tailer.Path() != path {
+			if state.tailer != nil {
+				state.tailer.Close()
+			}
+			state.tailer = NewTailer(path)
+		}
+	}
+	if state.tailer == nil {
+		return nil
+	}
+	if !state.tailer.Opened() {
+		if err := c.resume(ctx, state.tailer, port); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < maxBatchesPerTick; i++ {
+		batch, ok, err := state.tailer.Next()
+		if err != nil {
+			state.tailer.Close()
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if len(batch.Events) > 0 || batch.End > batch.Start {
+			c.digest(ctx, db, state, batch.Events)
+			err = c.ship(ctx, port, batch)
+			if errors.Is(err, errCursorConflict) {
+				return c.resume(ctx, state.tailer, port)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := state.tailer.Commit(batch); err != nil {
+			state.tailer.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// digest 优先使用服务器的 STATEMENT_DIGEST（MySQL 8.0），与 performance_schema 摘要一致；
+// 5.7 不支持时由 Manager 使用归一化文本的哈希兜底。
+func (c *Collector) digest(ctx context.Context, db *sql.DB, state *instanceState, events []sqldomain.StatementEvent) {
+	if !state.serverDigests {
+		return
+	}
+	for index := range events {
+		normalized := mysqlapp.NormalizeDigestText(events[index].SQLText)
+		if cached, ok := state.digestCache[normalized]; ok {
+			events[index].Digest, events[index].DigestText = cached[0], cached[1]
+			continue
+		}
+		digest, text, err := mysqlapp.StatementDigest(ctx, db, events[index].SQLText)
+		if err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "statement_digest") {
+				state.serverDigests = false
+				return
+			}
+			continue
+		}
+		if len(state.digestCache) >= maxDigestCache {
+			state.digestCache = make(map[string][2]string)
+		}
+		state.digestCache[normalized] = [2]string{digest, text}
+		events[index].Digest, events[index].DigestText = digest, text
+	}
+}
+
+func (c *Collector) resume(ctx context.Context, tailer *Tailer, port int) error {
+	var resp struct {
+		Found  bool                    `json:"found"`
+		Cursor sqldomain.SlowLogCursor `json:"cursor"`
+	}
+	query := url.Values{"machine_id": {c.machineID}, "port": {strconv.Itoa(port)}}
+	if err := c.do(ctx, http.MethodGet, CursorPath+"?"+query.Encode(), nil, &resp); err != nil {
+		return err
+	}
+	return tailer.Resume(resp.Cursor, resp.Found)
+}
+
+func (c *Collector) ship(ctx context.Context, port int, batch Batch) error {
+	events := batch.Events
+	for {
+		// 大批次拆成多次请求：除最后一段外，每段都以下一条事件的偏移结束，游标保持连续。
+		part := sqldomain.SlowLogBatch{
+			AgentID: c.agentID, MachineID: c.machineID, Port: port,
+			FileID: batch.FileID, Path: batch.Path, StartOffset: batch.Start, EndOffset: batch.End,
+		}
+		size, textBytes := 0, 0
+		for size < len(events) && size < maxBatchEvents {
+			text := events[size].SQLText
+			if len(text) > maxEventTextBytes {
+				text = strings.ToValidUTF8(text[:maxEventTextBytes], "")
+				events[size].SQLText = text
+			}
+			if size > 0 && textBytes+len(text) > maxBatchTextBytes {
+				break
+			}
+			textBytes += len(text)
+			size++
+		}
+		if size < len(events) {
+			part.Events, events = events[:size], events[size:]
+			part.EndOffset = int64(events[0].EventID)
+		} else {
+			part.Events, events = events, nil
+		}
+		if err := c.do(ctx, http.MethodPost, IngestPath, part, nil); err != nil {
+			return err
+		}
+		if events == nil {
+			return nil
+		}
+		batch.Start = part.EndOffset
+	}
+}
+
+func (c *Collector) do(ctx context.Context, method, path string, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	var lastErr error
+	for _, addr := range c.managerAddrs {
+		req, err := http.NewRequestWithContext(ctx, method, addr+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		func() {
+			defer resp.Body.Close()
+			switch {
+			case resp.StatusCode == http.StatusConflict:
+				lastErr = errCursorConflict
+			case resp.StatusCode >= 300:
+				lastErr = fmt.Errorf("%s %s: http %d", method, path, resp.StatusCode)
+			case out != nil:
+				lastErr = json.NewDecoder(resp.Body).Decode(out)
+			default:
+				lastErr = nil
+			}
+		}()
+		if lastErr == nil || errors.Is(lastErr, errCursorConflict) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+func (c *Collector) closeAll() {
+	for _, state := range c.states {
+		if state.tailer != nil {
+			state.tailer.Close()
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package slowlog 负责在 Agent 侧跟踪 MySQL 慢查询日志文件，解析为语句事件后
+// 按游标分批上报 Manager。log_output=FILE 的实例无法通过 mysql.slow_log 表采集，
+// 只能由本机 Agent 读取文件。
+package slowlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const maxChunkBytes = 4 << 20
+
+// Batch 是一次读取得到的待上报数据；只有 Manager 确认后才调用 Commit 推进偏移。
+type Batch struct {
+	FileID string
+	Path   string
+	Start  int64
+	End    int64
+	Events []sqldomain.StatementEvent
+
+	parser mysqlapp.SlowLogParser
+	rotate bool
+}
+
+// Tailer 跟踪单个慢日志文件。文件以设备号和 inode 标识：logrotate 改名后先把旧句柄读完，
+// 再从新文件开头继续；copytruncate 截断后从 0 重新读取。截断不会改变 inode，
+// 因此每次截断递增 generation 并写入 FileID（"dev:ino#N"），Manager 把截断后的
+// 内容当作新文件接收，而不是当作已入库的重复批次丢弃。
+type Tailer struct {
+	path       string
+	file       *os.File
+	baseID     string
+	generation int
+	fileID     string
+	offset     int64
+	lastSize   int64
+	parser     mysqlapp.SlowLogParser
+}
+
+func NewTailer(path string) *Tailer {
+	return &Tailer{path: path, lastSize: -1}
+}
+
+func (t *Tailer) Path() string { return t.path }
+
+// Resume 打开当前路径上的文件并定位到 Manager 游标。游标属于其他文件时从头读取；
+// 没有游标时从文件末尾开始，避免首次接入就回灌历史慢日志。同一文件的游标代数
+// 落后于本地（截断后尚未确认），或游标超出文件长度（Agent 停止期间被截断）时，
+// 从 0 开始读取新一代内容，不会回到旧偏移落在条目中间。
+func (t *Tailer) Resume(cursor sqldomain.SlowLogCursor, found bool) error {
+	t.Close()
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	base := fileIdentity(info)
+	if base != t.baseID {
+		t.baseID, t.generation = base, 0
+	}
+	t.file, t.lastSize, t.parser = file, -1, mysqlapp.SlowLogParser{}
+	cursorBase, cursorGeneration := splitFileID(cursor.FileID)
+	switch {
+	case !found:
+		t.offset = info.Size()
+	case cursorBase == base:
+		// 重启后本地代数丢失，以 Manager 记录的代数为准。
+		if cursorGeneration > t.generation {
+			t.generation = cursorGeneration
+		}
+		if cursorGeneration == t.generation && cursor.Offset <= info.Size() {
+			t.offset = cursor.Offset
+			break
+		}
+		if cursorGeneration == t.generation {
+			t.generation++
+		}
+		t.offset = 0
+	default:
+		t.offset = 0
+	}
+	t.fileID = joinFileID(base, t.generation)
+	return nil
+}
+
+func (t *Tailer) Opened() bool { return t.file != nil }
+
+func (t *Tailer) Close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file = nil
+	}
+}
+
+// Next 读取下一批完整条目。ok=false 表示暂无新数据。文件在两次轮询之间没有增长时，
+// 末尾条目视为已写完；否则保留到下一次，以免把正在写入的多行语句截断。
+func (t *Tailer) Next() (Batch, bool, error) {
+	if t.file == nil {
+		return Batch{}, false, fmt.Errorf("slow log %s is not opened", t.path)
+	}
+	info, err := t.file.Stat()
+	if err != nil {
+		return Batch{}, false, err
+	}
+	size := info.Size()
+	if size < t.offset {
+		t.generation++
+		t.fileID = joinFileID(t.baseID, t.generation)
+		t.offset, t.parser = 0, mysqlapp.SlowLogParser{}
+	}
+	rotated := false
+	if current, err := os.Stat(t.path); err == nil && !os.SameFile(current, info) {
+		rotated = true
+	}
+	final := rotated || size == t.lastSize
+	t.lastSize = size
+	if t.offset >= size {
+		if rotated {
+			return Batch{FileID: t.fileID, Path: t.path, Start: t.offset, End: t.offset, parser: t.parser, rotate: true}, true, nil
+		}
+		return Batch{}, false, nil
+	}
+	length := size - t.offset
+	if length > maxChunkBytes {
+		length, final = maxChunkBytes, false
+	}
+	buf := make([]byte, length)
+	n, err := t.file.ReadAt(buf, t.offset)
+	if err != nil && err != io.EOF {
+		return Batch{}, false, err
+	}
+	buf = buf[:n]
+	events, consumed, next := t.parser.Parse(buf, final)
+	if consumed == 0 && n == maxChunkBytes {
+		// 单条语句超过读取窗口时强制切分，避免游标永远停在同一位置。
+		events, consumed, next = t.parser.Parse(buf, true)
+		if consumed == 0 {
+			consumed = n
+		}
+	}
+	batch := Batch{FileID: t.fileID, Path: t.path, Start: t.offset, End: t.offset + int64(consumed), parser: next}
+	for _, event := range events {
+		event.EventID += uint64(t.offset)
+		batch.Events = append(batch.Events, event)
+	}
+	batch.rotate = rotated && batch.End >= size
+	if consumed == 0 && !batch.rotate {
+		return Batch{}, false, nil
+	}
+	return batch, true, nil
+}
+
+// Commit 在 Manager 确认后推进偏移；旧文件读完后切换到路径上的新文件。
+func (t *Tailer) Commit(batch Batch) error {
+	if batch.FileID != t.fileID {
+		return nil
+	}
+	t.offset, t.parser = batch.End, batch.parser
+	if !batch.rotate {
+		return nil
+	}
+	return t.Resume(sqldomain.SlowLogCursor{}, true)
+}
+
+func joinFileID(base string, generation int) string {
+	if generation == 0 {
+		return base
+	}
+	return base + "#" + strconv.Itoa(generation)
+}
+
+func splitFileID(id string) (string, int) {
+	base, suffix, ok := strings.Cut(id, "#")
+	if !ok {
+		return id, 0
+	}
+	generation, err := strconv.Atoi(suffix)
+	if err != nil || generation < 0 {
+		return id, 0
+	}
+	return base, generation
+}
+
+func fileIdentity(info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+	}
+	return fmt.Sprintf("%s:%d", info.Name(), info.ModTime().UnixNano())
+}
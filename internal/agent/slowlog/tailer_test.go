@@ -0,0 +1,122 @@
+package slowlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+)
+
+func slowEntry(id, sql string) string {
+	return "# Time: 2026-07-23T01:00:0" + id + ".000000Z\n" +
+		"# User@Host: app[app] @  [10.0.0.8]  Id: " + id + "\n" +
+		"# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 1\n" +
+		"SET timestamp=1784768400;\n" + sql + ";\n"
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// poll is one collector round: read once and acknowledge.
+func poll(t *testing.T, tailer *Tailer) []string {
+	t.Helper()
+	batch, ok, err := tailer.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, event := range batch.Events {
+		out = append(out, event.SQLText)
+	}
+	if err := tailer.Commit(batch); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestTailerFollowsRotationAndTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.log")
+	appendFile(t, path, slowEntry("1", "select 1"))
+	tailer := NewTailer(path)
+	defer tailer.Close()
+	if err := tailer.Resume(sqldomain.SlowLogCursor{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := poll(t, tailer); len(got) != 0 {
+		t.Fatalf("a first start must skip existing content, got %v", got)
+	}
+
+	appendFile(t, path, slowEntry("2", "select 2")+slowEntry("3", "select 3"))
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 2" {
+		t.Fatalf("the last entry of a growing file must wait, got %v", got)
+	}
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 3" {
+		t.Fatalf("the last entry is emitted once the file stops growing, got %v", got)
+	}
+
+	appendFile(t, path, slowEntry("4", "select 4"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, slowEntry("5", "select 5"))
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 4" {
+		t.Fatalf("rotation must finish the old file first, got %v", got)
+	}
+	poll(t, tailer)
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 5" {
+		t.Fatalf("the new file is read from the start, got %v", got)
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, slowEntry("6", "select 6")[:20])
+	poll(t, tailer)
+	appendFile(t, path, slowEntry("6", "select 6")[20:])
+	poll(t, tailer)
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 6" {
+		t.Fatalf("a truncated file is read from the start, got %v", got)
+	}
+}
+
+func TestTailerResumesFromManagerCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.log")
+	first := slowEntry("1", "select 1")
+	appendFile(t, path, first+slowEntry("2", "select 2"))
+	tailer := NewTailer(path)
+	defer tailer.Close()
+	if err := tailer.Resume(sqldomain.SlowLogCursor{}, true); err != nil {
+		t.Fatal(err)
+	}
+	id := tailer.fileID
+	tailer.Close()
+
+	if err := tailer.Resume(sqldomain.SlowLogCursor{FileID: id, Offset: int64(len(first))}, true); err != nil {
+		t.Fatal(err)
+	}
+	poll(t, tailer)
+	if got := poll(t, tailer); len(got) != 1 || got[0] != "select 2" {
+		t.Fatalf("resume must continue at the cursor, got %v", got)
+	}
+	if err := tailer.Resume(sqldomain.SlowLogCursor{FileID: "other", Offset: 99}, true); err != nil {
+		t.Fatal(err)
+	}
+	poll(t, tailer)
+	poll(t, tailer)
+	if tailer.offset != int64(len(first)+len(slowEntry("2", "select 2"))) {
+		t.Fatalf("a cursor of another file restarts at 0, offset=%d", tailer.offset)
+	}
+}
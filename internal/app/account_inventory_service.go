@@ -0,0 +1,683 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+	machinedomain "gmha/internal/domain/machine"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	// accountInventoryInterval is how often every running instance is
+	// collected in the background; Collect refreshes one on demand.
+	accountInventoryInterval = 24 * time.Hour
+	accountInventoryTick     = 10 * time.Minute
+	accountSyncTimeout       = 5 * time.Minute
+
+	AccountSyncPlanned   = "planned"
+	AccountSyncInSync    = "in_sync"
+	AccountSyncSucceeded = "succeeded"
+	AccountSyncFailed    = "failed"
+)
+
+var (
+	ErrAccountInventoryNotFound = errors.New("账号清单不存在，请先采集")
+	ErrAccountSyncRunning       = errors.New("该集群正在同步账号")
+)
+
+// accountAuthString matches the authentication string of a CREATE USER
+// statement so sync previews never show password hashes.
+var accountAuthString = regexp.MustCompile(`(?i)( AS )(0x[0-9A-F]+|'(?:[^'\\]|\\.|'')*')`)
+
+type accountInventoryTasks interface {
+	CreateBatchTrackingTask(context.Context, string, string, string) (TaskDetail, error)
+	FinalizeBatchTrackingTask(context.Context, string, int, int) error
+	RunExecTask(context.Context, string, string, ExecTaskOptions, time.Duration) (string, string, error)
+}
+
+type accountInventoryCollectFunc func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential) (inventorydomain.Snapshot, error)
+
+type accountDefinitionsFunc func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential, string, [][2]string) (map[string][]string, error)
+
+// AccountInventoryNode identifies the instance a comparison or sync result
+// belongs to.
+type AccountInventoryNode struct {
+	MachineID     string    `json:"machine_id"`
+	MachineName   string    `json:"machine_name,omitempty"`
+	MachineIP     string    `json:"machine_ip,omitempty"`
+	Port          int       `json:"port"`
+	Role          string    `json:"role,omitempty"`
+	ServerVersion string    `json:"server_version,omitempty"`
+	CollectedAt   time.Time `json:"collected_at"`
+}
+
+type AccountInventoryFinding struct {
+	Cluster string `json:"cluster"`
+	AccountInventoryNode
+	inventorydomain.Finding
+}
+
+type AccountInventoryReplicaDiff struct {
+	Replica     AccountInventoryNode         `json:"replica"`
+	InSync      bool                         `json:"in_sync"`
+	Differences []inventorydomain.Difference `json:"differences"`
+}
+
+// AccountInventoryComparison compares every replica of a cluster with its
+// primary using the latest collected inventories.
+type AccountInventoryComparison struct {
+	Cluster  string                        `json:"cluster"`
+	Primary  AccountInventoryNode          `json:"primary"`
+	Replicas []AccountInventoryReplicaDiff `json:"replicas"`
+}
+
+type AccountInventoryTarget struct {
+	MachineID string `json:"machine_id"`
+	Port      int    `json:"port"`
+}
+
+// AccountSyncRequest makes replica accounts match the primary. Replicas
+// defaults to every replica of the cluster; accounts that only exist on a
+// replica are dropped only with DropExtra.
+type AccountSyncRequest struct {
+	Cluster   string                   `json:"cluster"`
+	Replicas  []AccountInventoryTarget `json:"replicas,omitempty"`
+	DropExtra bool                     `json:"drop_extra,omitempty"`
+	DryRun    bool                     `json:"dry_run,omitempty"`
+	Confirm   string                   `json:"confirm,omitempty"`
+}
+
+type AccountSyncReplicaResult struct {
+	Replica     AccountInventoryNode         `json:"replica"`
+	Status      string                       `json:"status"`
+	Differences []inventorydomain.Difference `json:"differences"`
+	// Statements are the SQL run on the replica with authentication strings
+	// masked.
+	Statements []string `json:"statements,omitempty"`
+	TaskID     string   `json:"task_id,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	// Remaining counts the differences left after the replica was collected
+	// again.
+	Remaining int `json:"remaining"`
+}
+
+type AccountSyncResult struct {
+	Cluster      string                     `json:"cluster"`
+	DryRun       bool                       `json:"dry_run"`
+	ParentTaskID string                     `json:"parent_task_id,omitempty"`
+	Primary      AccountInventoryNode       `json:"primary"`
+	Replicas     []AccountSyncReplicaResult `json:"replicas"`
+}
+
+// AccountInventoryService collects the accounts, grants and password state of
+// every managed instance, reports risky accounts, compares replicas with their
+// primary and copies the primary's accounts to replicas that drifted.
+type AccountInventoryService struct {
+	repo      inventorydomain.Repository
+	instances MySQLInstanceRepository
+	machines  machinedomain.Repository
+	presets   MySQLAccountPresetRepository
+	tasks     accountInventoryTasks
+	collect   accountInventoryCollectFunc
+	define    accountDefinitionsFunc
+
+	mu         sync.Mutex
+	collecting map[string]bool
+	syncing    map[string]bool
+	started    bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewAccountInventoryService(repo inventorydomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository, tasks accountInventoryTasks) *AccountInventoryService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AccountInventoryService{
+		repo: repo, instances: instances, machines: machines, presets: presets, tasks: tasks,
+		collect: collectAccountInventory, define: readAccountDefinitions,
+		collecting: make(map[string]bool), syncing: make(map[string]bool),
+		ctx: ctx, cancel: cancel, done: make(chan struct{}),
+	}
+}
+
+// Start collects running instances whose inventory is older than a day.
+func (s *AccountInventoryService) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+	go s.loop(s.ctx)
+}
+
+func (s *AccountInventoryService) Close() {
+	if s == nil || s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+}
+
+// Collect reads the accounts of one instance and replaces its stored
+// inventory.
+func (s *AccountInventoryService) Collect(ctx context.Context, machineID string, port int) (inventorydomain.Snapshot, error) {
+	_, machine, err := s.target(ctx, machineID, port)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	credential, err := s.credential(ctx)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	key := schemaInstanceKey(machine.ID, port)
+	s.mu.Lock()
+	if s.collecting[key] {
+		s.mu.Unlock()
+		return inventorydomain.Snapshot{}, fmt.Errorf("实例 %s:%d 正在采集账号清单", machine.IP, port)
+	}
+	s.collecting[key] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.collecting, key)
+		s.mu.Unlock()
+	}()
+
+	snapshot, err := s.collect(ctx, machine, port, credential)
+	if err != nil {
+		return inventorydomain.Snapshot{}, fmt.Errorf("读取实例 %s:%d 账号清单失败: %s", machine.IP, port, safeBinlogError(err, credential.Password))
+	}
+	snapshot.Cluster, snapshot.MachineID, snapshot.MachineName, snapshot.MachineIP, snapshot.Port = machine.Cluster, machine.ID, machine.Name, machine.IP, port
+	snapshot.CollectedAt = time.Now().UTC()
+	presets := s.presetUsers(ctx)
+	for index := range snapshot.Accounts {
+		snapshot.Accounts[index].Preset = presets[snapshot.Accounts[index].User]
+	}
+	if err := s.repo.SaveSnapshot(ctx, snapshot); err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func (s *AccountInventoryService) Snapshot(ctx context.Context, machineID string, port int) (inventorydomain.Snapshot, error) {
+	snapshot, ok, err := s.repo.GetSnapshot(ctx, strings.TrimSpace(machineID), port)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	if !ok {
+		return inventorydomain.Snapshot{}, ErrAccountInventoryNotFound
+	}
+	return snapshot, nil
+}
+
+// List returns the latest inventory of every instance, or of one cluster.
+func (s *AccountInventoryService) List(ctx context.Context, cluster string) ([]inventorydomain.Snapshot, error) {
+	return s.repo.ListSnapshots(ctx, strings.TrimSpace(cluster))
+}
+
+// Findings flattens the risky accounts of the stored inventories, critical
+// ones first.
+func (s *AccountInventoryService) Findings(ctx context.Context, cluster, severity string) ([]AccountInventoryFinding, error) {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if severity != "" && severity != inventorydomain.SeverityCritical && severity != inventorydomain.SeverityWarning {
+		return nil, errors.New("severity 只能是 critical 或 warning")
+	}
+	snapshots, err := s.List(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AccountInventoryFinding, 0)
+	for _, wanted := range []string{inventorydomain.SeverityCritical, inventorydomain.SeverityWarning} {
+		if severity != "" && severity != wanted {
+			continue
+		}
+		for _, snapshot := range snapshots {
+			for _, finding := range snapshot.Findings {
+				if finding.Severity == wanted {
+					out = append(out, AccountInventoryFinding{Cluster: snapshot.Cluster, AccountInventoryNode: accountInventoryNode(snapshot), Finding: finding})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// Compare diffs every replica of the cluster against its primary. It uses the
+// stored inventories, so collect first when they are stale.
+func (s *AccountInventoryService) Compare(ctx context.Context, cluster string) (AccountInventoryComparison, error) {
+	cluster = strings.TrimSpace(cluster)
+	if cluster == "" {
+		return AccountInventoryComparison{}, errors.New("cluster is required")
+	}
+	snapshots, err := s.repo.ListSnapshots(ctx, cluster)
+	if err != nil {
+		return AccountInventoryComparison{}, err
+	}
+	primary, replicas, err := splitAccountInventories(cluster, snapshots)
+	if err != nil {
+		return AccountInventoryComparison{}, err
+	}
+	out := AccountInventoryComparison{Cluster: cluster, Primary: accountInventoryNode(primary), Replicas: make([]AccountInventoryReplicaDiff, 0, len(replicas))}
+	for _, replica := range replicas {
+		diffs := mysqlapp.DiffAccounts(primary.Accounts, replica.Accounts)
+		out.Replicas = append(out.Replicas, AccountInventoryReplicaDiff{Replica: accountInventoryNode(replica), InSync: len(diffs) == 0, Differences: diffs})
+	}
+	return out, nil
+}
+
+// Sync collects the primary and the selected replicas again, then recreates
+// the differing accounts on each replica from the primary's SHOW CREATE USER
+// and SHOW GRANTS output. Statements run with sql_log_bin=0 so replicas do
+// not gain errant transactions.
+func (s *AccountInventoryService) Sync(ctx context.Context, req AccountSyncRequest) (AccountSyncResult, error) {
+	cluster := strings.TrimSpace(req.Cluster)
+	if cluster == "" {
+		return AccountSyncResult{}, errors.New("cluster is required")
+	}
+	if !req.DryRun && strings.TrimSpace(req.Confirm) != cluster {
+		return AccountSyncResult{}, fmt.Errorf("同步账号会重建从库上不一致的账号，请在 confirm 中填写集群名 %s", cluster)
+	}
+	s.mu.Lock()
+	if s.syncing[cluster] {
+		s.mu.Unlock()
+		return AccountSyncResult{}, ErrAccountSyncRunning
+	}
+	s.syncing[cluster] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.syncing, cluster)
+		s.mu.Unlock()
+	}()
+
+	credential, err := s.credential(ctx)
+	if err != nil {
+		return AccountSyncResult{}, err
+	}
+	targets, err := s.clusterTargets(ctx, cluster)
+	if err != nil {
+		return AccountSyncResult{}, err
+	}
+	snapshots := make([]inventorydomain.Snapshot, 0, len(targets))
+	for _, target := range targets {
+		snapshot, err := s.Collect(ctx, target.MachineID, target.Port)
+		if err != nil {
+			return AccountSyncResult{}, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	primary, replicas, err := splitAccountInventories(cluster, snapshots)
+	if err != nil {
+		return AccountSyncResult{}, err
+	}
+	replicas, err = selectAccountSyncReplicas(replicas, req.Replicas)
+	if err != nil {
+		return AccountSyncResult{}, err
+	}
+
+	roles := make(map[string]bool)
+	for _, account := range primary.Accounts {
+		if account.IsRole {
+			roles[mysqlapp.InventoryAccountKey(account.User, account.Host)] = true
+		}
+	}
+	result := AccountSyncResult{Cluster: cluster, DryRun: req.DryRun, Primary: accountInventoryNode(primary), Replicas: make([]AccountSyncReplicaResult, 0, len(replicas))}
+	plans := make([][]string, len(replicas))
+	for index, replica := range replicas {
+		diffs := mysqlapp.DiffAccounts(primary.Accounts, replica.Accounts)
+		item := AccountSyncReplicaResult{Replica: accountInventoryNode(replica), Status: AccountSyncInSync, Differences: diffs}
+		if statements, err := s.syncStatements(ctx, primary, credential, diffs, roles, req.DropExtra); err != nil {
+			item.Status, item.Message = AccountSyncFailed, err.Error()
+			item.Remaining = len(diffs)
+		} else if len(statements) > 0 {
+			item.Status, item.Statements = AccountSyncPlanned, maskAccountStatements(statements)
+			item.Remaining = len(diffs)
+			plans[index] = statements
+		} else if len(diffs) > 0 {
+			item.Remaining = len(diffs)
+			item.Message = "只有从库多出的账号，未指定 drop_extra，不做修改"
+		}
+		result.Replicas = append(result.Replicas, item)
+	}
+	if req.DryRun {
+		return result, nil
+	}
+
+	pending := 0
+	for _, statements := range plans {
+		if len(statements) > 0 {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return result, nil
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "mysql_account_sync", "同步 MySQL 从库账号", cluster)
+	if err != nil {
+		return AccountSyncResult{}, err
+	}
+	result.ParentTaskID = parent.Task.ID
+	created, failed := 0, 0
+	for index, replica := range replicas {
+		if len(plans[index]) == 0 {
+			continue
+		}
+		item := &result.Replicas[index]
+		taskID, err := s.runSync(ctx, parent.Task.ID, replica, plans[index])
+		item.TaskID = taskID
+		if taskID != "" {
+			created++
+		}
+		if err != nil {
+			failed++
+			item.Status, item.Message = AccountSyncFailed, err.Error()
+			continue
+		}
+		after, err := s.Collect(ctx, replica.MachineID, replica.Port)
+		if err != nil {
+			item.Status, item.Message = AccountSyncSucceeded, "已执行，复核采集失败："+err.Error()
+			continue
+		}
+		item.Remaining = len(mysqlapp.DiffAccounts(primary.Accounts, after.Accounts))
+		item.Status, item.Message = AccountSyncSucceeded, "账号已与主库一致"
+		if item.Remaining > 0 {
+			item.Message = fmt.Sprintf("已执行，仍有 %d 个账号与主库不一致", item.Remaining)
+		}
+	}
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, parent.Task.ID, created, failed)
+	return result, nil
+}
+
+func (s *AccountInventoryService) syncStatements(ctx context.Context, primary inventorydomain.Snapshot, credential mysqlapp.DiagnosticCredential, diffs []inventorydomain.Difference, roles map[string]bool, dropExtra bool) ([]string, error) {
+	keys := make([][2]string, 0, len(diffs))
+	pending := 0
+	for _, diff := range diffs {
+		if diff.Change != inventorydomain.ChangeExtra {
+			keys = append(keys, [2]string{diff.User, diff.Host})
+			pending++
+		} else if dropExtra {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil, nil
+	}
+	definitions := map[string][]string{}
+	if len(keys) > 0 {
+		machine := machinedomain.Machine{ID: primary.MachineID, Name: primary.MachineName, IP: primary.MachineIP, Cluster: primary.Cluster}
+		var err error
+		definitions, err = s.define(ctx, machine, primary.Port, credential, primary.ServerVersion, keys)
+		if err != nil {
+			return nil, fmt.Errorf("读取主库 %s:%d 账号定义失败: %s", primary.MachineIP, primary.Port, safeBinlogError(err, credential.Password))
+		}
+	}
+	return mysqlapp.AccountSyncStatements(diffs, definitions, roles, dropExtra)
+}
+
+// runSync applies the statements through the replica's Agent. super_read_only
+// is lifted only for the duration of the script and restored even when a
+// statement fails.
+func (s *AccountInventoryService) runSync(ctx context.Context, parentID string, replica inventorydomain.Snapshot, statements []string) (string, error) {
+	instance, ok, err := s.instances.Get(ctx, replica.MachineID, replica.Port)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("实例 %s:%d 不存在", replica.MachineID, replica.Port)
+	}
+	taskID, _, err := s.tasks.RunExecTask(ctx, replica.MachineIP, "", ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "mysql_account_sync",
+		DisplayName: fmt.Sprintf("同步账号到从库 %s:%d", replica.MachineIP, replica.Port), Port: replica.Port,
+		Commands: []taskdomain.ExecCommandStep{{Name: fmt.Sprintf("按主库重建 %d 条账号语句", len(statements)), Command: accountSyncCommand(instance, replica.Port, statements)}},
+		TaskType: taskdomain.TypeExec,
+	}, accountSyncTimeout)
+	return taskID, err
+}
+
+func accountSyncCommand(instance mysqlapp.Instance, port int, statements []string) string {
+	mysql := "mysql"
+	if strings.TrimSpace(instance.BaseDir) != "" {
+		mysql = instance.BaseDir + "/bin/mysql"
+	}
+	client := shellQuote(mysql) + " --defaults-extra-file=" + mysqlDefaultsFilePlaceholder + fmt.Sprintf(" --protocol=tcp --host=127.0.0.1 --port=%d --connect-timeout=5 --batch --raw --skip-column-names", port)
+	sql := "SET SESSION sql_log_bin=0; " + strings.Join(statements, "; ") + ";"
+	return strings.Join([]string{
+		"sro=$(" + client + " --execute=" + shellQuote("SELECT @@global.super_read_only") + ") || exit 1",
+		`if [ "$sro" = "1" ]; then ` + client + " --execute=" + shellQuote("SET GLOBAL super_read_only=OFF") + " || exit 1; fi",
+		client + " --execute=" + shellQuote(sql) + "; rc=$?",
+		`if [ "$sro" = "1" ]; then ` + client + " --execute=" + shellQuote("SET GLOBAL super_read_only=ON") + " || rc=1; fi",
+		"exit $rc",
+	}, "\n")
+}
+
+func (s *AccountInventoryService) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(accountInventoryTick)
+	defer ticker.Stop()
+	for {
+		s.collectDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *AccountInventoryService) collectDue(ctx context.Context) {
+	if _, err := s.credential(ctx); err != nil {
+		return
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		log.Printf("account inventory: list instances: %v", err)
+		return
+	}
+	for _, instance := range instances {
+		if ctx.Err() != nil {
+			return
+		}
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		latest, ok, err := s.repo.GetSnapshot(ctx, instance.MachineID, instance.Port)
+		if err != nil {
+			log.Printf("account inventory: latest %s:%d: %v", instance.MachineID, instance.Port, err)
+			continue
+		}
+		if ok && time.Since(latest.CollectedAt) < accountInventoryInterval {
+			continue
+		}
+		if _, err := s.Collect(ctx, instance.MachineID, instance.Port); err != nil {
+			log.Printf("account inventory: collect %s:%d: %v", instance.MachineID, instance.Port, err)
+		}
+	}
+}
+
+// clusterTargets lists the running instances on machines of the cluster.
+func (s *AccountInventoryService) clusterTargets(ctx context.Context, cluster string) ([]mysqlapp.Instance, error) {
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]mysqlapp.Instance, 0)
+	for _, instance := range instances {
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		machine, ok, err := s.machines.GetByID(ctx, instance.MachineID)
+		if err != nil {
+			return nil, err
+		}
+		if ok && machine.Cluster == cluster {
+			out = append(out, instance)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("集群 %s 没有运行中的 MySQL 实例", cluster)
+	}
+	return out, nil
+}
+
+func (s *AccountInventoryService) target(ctx context.Context, machineID string, port int) (mysqlapp.Instance, machinedomain.Machine, error) {
+	machineID = strings.TrimSpace(machineID)
+	if machineID == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("machine_id is required")
+	}
+	if port < 1 || port > 65535 {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("port must be between 1 and 65535")
+	}
+	instance, ok, err := s.instances.Get(ctx, machineID, port)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("MySQL 实例 %s:%d 未登记", machineID, port)
+	}
+	machine, ok, err := s.machines.GetByID(ctx, machineID)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok || strings.TrimSpace(machine.IP) == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("实例 %s:%d 的机器地址不可用", machineID, port)
+	}
+	return instance, machine, nil
+}
+
+func (s *AccountInventoryService) credential(ctx context.Context) (mysqlapp.DiagnosticCredential, error) {
+	if s.presets == nil {
+		return mysqlapp.DiagnosticCredential{}, errors.New("账号清单需要已配置的 MHA 管理账号")
+	}
+	items, err := s.presets.List(ctx)
+	if err != nil {
+		return mysqlapp.DiagnosticCredential{}, err
+	}
+	for _, item := range normalizeMySQLAccountPresets(items) {
+		if !item.Enabled || !strings.EqualFold(strings.TrimSpace(item.Role), mysqlapp.AccountRoleMHA) {
+			continue
+		}
+		if strings.TrimSpace(item.Username) != "" && item.Password != "" {
+			return mysqlapp.DiagnosticCredential{Username: strings.TrimSpace(item.Username), Password: item.Password}, nil
+		}
+	}
+	return mysqlapp.DiagnosticCredential{}, errors.New("账号清单需要已启用且凭据完整的 MHA 管理账号")
+}
+
+// presetUsers maps the usernames of the account presets to their role so the
+// inventory shows which accounts GMHA itself manages.
+func (s *AccountInventoryService) presetUsers(ctx context.Context) map[string]string {
+	out := make(map[string]string)
+	if s.presets == nil {
+		return out
+	}
+	items, err := s.presets.List(ctx)
+	if err != nil {
+		return out
+	}
+	for _, item := range normalizeMySQLAccountPresets(items) {
+		if name := strings.TrimSpace(item.Username); name != "" {
+			out[name] = item.Role
+		}
+	}
+	return out
+}
+
+func splitAccountInventories(cluster string, snapshots []inventorydomain.Snapshot) (inventorydomain.Snapshot, []inventorydomain.Snapshot, error) {
+	var primaries, replicas []inventorydomain.Snapshot
+	for _, snapshot := range snapshots {
+		switch snapshot.Role {
+		case sqldomain.InstanceRolePrimary:
+			primaries = append(primaries, snapshot)
+		case sqldomain.InstanceRoleReplica:
+			replicas = append(replicas, snapshot)
+		}
+	}
+	// Without exactly one primary (failover in progress, dual primary) there
+	// is no reference to compare replicas with.
+	if len(primaries) != 1 {
+		return inventorydomain.Snapshot{}, nil, fmt.Errorf("集群 %s 的账号清单中有 %d 个主库，需要恰好一个", cluster, len(primaries))
+	}
+	return primaries[0], replicas, nil
+}
+
+func selectAccountSyncReplicas(replicas []inventorydomain.Snapshot, targets []AccountInventoryTarget) ([]inventorydomain.Snapshot, error) {
+	if len(targets) == 0 {
+		return replicas, nil
+	}
+	out := make([]inventorydomain.Snapshot, 0, len(targets))
+	for _, target := range targets {
+		found := false
+		for _, replica := range replicas {
+			if replica.MachineID == strings.TrimSpace(target.MachineID) && replica.Port == target.Port {
+				out = append(out, replica)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("实例 %s:%d 不是该集群的从库", target.MachineID, target.Port)
+		}
+	}
+	return out, nil
+}
+
+func accountInventoryNode(snapshot inventorydomain.Snapshot) AccountInventoryNode {
+	return AccountInventoryNode{
+		MachineID: snapshot.MachineID, MachineName: snapshot.MachineName, MachineIP: snapshot.MachineIP, Port: snapshot.Port,
+		Role: snapshot.Role, ServerVersion: snapshot.ServerVersion, CollectedAt: snapshot.CollectedAt,
+	}
+}
+
+func maskAccountStatements(statements []string) []string {
+	out := make([]string, len(statements))
+	for index, statement := range statements {
+		out[index] = accountAuthString.ReplaceAllString(statement, "${1}'<redacted>'")
+	}
+	return out
+}
+
+func collectAccountInventory(ctx context.Context, machine machinedomain.Machine, port int, credential mysqlapp.DiagnosticCredential) (inventorydomain.Snapshot, error) {
+	client := mysqlapp.DiagnosticClient{QueryTimeout: 30 * time.Second}
+	db, err := client.Open(sqldomain.Instance{MachineID: machine.ID, MachineIP: machine.IP, Port: port}, credential)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	defer db.Close()
+	role, err := client.InstanceRole(ctx, db)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	snapshot, err := client.AccountInventory(ctx, db)
+	if err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	snapshot.Role = role
+	return snapshot, nil
+}
+
+func readAccountDefinitions(ctx context.Context, machine machinedomain.Machine, port int, credential mysqlapp.DiagnosticCredential, version string, keys [][2]string) (map[string][]string, error) {
+	client := mysqlapp.DiagnosticClient{QueryTimeout: 30 * time.Second}
+	db, err := client.Open(sqldomain.Instance{MachineID: machine.ID, MachineIP: machine.IP, Port: port}, credential)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return client.AccountDefinitions(ctx, db, version, keys)
+}
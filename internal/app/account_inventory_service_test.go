@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+	machinedomain "gmha/internal/domain/machine"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type accountInventoryMemoryRepo struct {
+	mu    sync.Mutex
+	items map[string]inventorydomain.Snapshot
+}
+
+func (r *accountInventoryMemoryRepo) SaveSnapshot(_ context.Context, snapshot inventorydomain.Snapshot) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[schemaInstanceKey(snapshot.MachineID, snapshot.Port)] = snapshot
+	return nil
+}
+
+func (r *accountInventoryMemoryRepo) GetSnapshot(_ context.Context, machineID string, port int) (inventorydomain.Snapshot, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot, ok := r.items[schemaInstanceKey(machineID, port)]
+	return snapshot, ok, nil
+}
+
+func (r *accountInventoryMemoryRepo) ListSnapshots(_ context.Context, cluster string) ([]inventorydomain.Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]inventorydomain.Snapshot, 0)
+	for _, key := range []string{"m1:3306", "m2:3306"} {
+		if snapshot, ok := r.items[key]; ok && (cluster == "" || snapshot.Cluster == cluster) {
+			out = append(out, snapshot)
+		}
+	}
+	return out, nil
+}
+
+func (r *accountInventoryMemoryRepo) DeleteSnapshot(_ context.Context, machineID string, port int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, schemaInstanceKey(machineID, port))
+	return nil
+}
+
+func TestAccountInventoryServiceComparesAndSyncsReplicas(t *testing.T) {
+	primaryAccounts := []inventorydomain.Account{
+		{User: "app", Host: "%", Plugin: "caching_sha2_password", PasswordDigest: "new", Grants: []string{"GRANT SELECT ON `app`.* TO `app`@`%`"}},
+		{User: "mha", Host: "%", Plugin: "caching_sha2_password", PasswordDigest: "m", Grants: []string{"GRANT ALL PRIVILEGES ON *.* TO `mha`@`%`"}},
+	}
+	replicaAccounts := []inventorydomain.Account{
+		{User: "app", Host: "%", Plugin: "caching_sha2_password", PasswordDigest: "old", Grants: []string{"GRANT SELECT ON `app`.* TO `app`@`%`"}},
+		{User: "legacy", Host: "%", Plugin: "mysql_native_password", Grants: []string{"GRANT USAGE ON *.* TO `legacy`@`%`"}},
+	}
+	tasks := &credentialRotationTaskFake{}
+	repo := &accountInventoryMemoryRepo{items: map[string]inventorydomain.Snapshot{}}
+	machines := &schemaMachineRepo{items: map[string]machinedomain.Machine{
+		"m1": {ID: "m1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+		"m2": {ID: "m2", Name: "db-2", IP: "10.0.0.2", Cluster: "orders"},
+	}}
+	instances := credentialRotationInstanceRepo{fakeArchitectureInstanceRepo{items: []mysqlapp.Instance{
+		{MachineID: "m1", Port: 3306, Version: "8.4.3", BaseDir: "/usr/local/mysql", Status: mysqlapp.StatusRunning},
+		{MachineID: "m2", Port: 3306, Version: "8.4.3", BaseDir: "/usr/local/mysql", Status: mysqlapp.StatusRunning},
+	}}}
+	presets := &credentialRotationPresetRepo{items: []taskdomain.MySQLAccountSpec{{Role: mysqlapp.AccountRoleMHA, Username: "mha", Password: "secret", Enabled: true}}}
+	service := NewAccountInventoryService(repo, instances, machines, presets, tasks)
+	service.collect = func(_ context.Context, machine machinedomain.Machine, _ int, credential mysqlapp.DiagnosticCredential) (inventorydomain.Snapshot, error) {
+		if credential.Username != "mha" {
+			t.Fatalf("credential = %+v", credential)
+		}
+		snapshot := inventorydomain.Snapshot{Role: sqldomain.InstanceRolePrimary, ServerVersion: "8.4.3", Accounts: primaryAccounts}
+		if machine.ID == "m2" {
+			snapshot.Role = sqldomain.InstanceRoleReplica
+			tasks.mu.Lock()
+			synced := len(tasks.commands) > 0
+			tasks.mu.Unlock()
+			if !synced {
+				snapshot.Accounts = replicaAccounts
+			}
+		}
+		snapshot.Accounts = append([]inventorydomain.Account(nil), snapshot.Accounts...)
+		snapshot.Findings = mysqlapp.AccountFindings(snapshot.ServerVersion, snapshot.Accounts)
+		return snapshot, nil
+	}
+	service.define = func(_ context.Context, machine machinedomain.Machine, _ int, _ mysqlapp.DiagnosticCredential, _ string, keys [][2]string) (map[string][]string, error) {
+		if machine.ID != "m1" {
+			t.Fatalf("definitions read from %s", machine.ID)
+		}
+		out := map[string][]string{}
+		for _, key := range keys {
+			out[mysqlapp.InventoryAccountKey(key[0], key[1])] = []string{
+				"CREATE USER `" + key[0] + "`@`" + key[1] + "` IDENTIFIED WITH 'caching_sha2_password' AS 0x2441",
+				"GRANT SELECT ON `app`.* TO `" + key[0] + "`@`" + key[1] + "`",
+			}
+		}
+		return out, nil
+	}
+	ctx := context.Background()
+
+	for _, machineID := range []string{"m1", "m2"} {
+		if _, err := service.Collect(ctx, machineID, 3306); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, _ := service.Snapshot(ctx, "m1", 3306)
+	if stored.Cluster != "orders" || stored.MachineIP != "10.0.0.1" || stored.Accounts[1].Preset != mysqlapp.AccountRoleMHA {
+		t.Fatalf("stored = %+v", stored)
+	}
+	findings, err := service.Findings(ctx, "orders", "")
+	if err != nil || len(findings) == 0 || findings[0].Severity != inventorydomain.SeverityCritical || findings[0].User != "mha" {
+		t.Fatalf("findings = %+v, %v", findings, err)
+	}
+	comparison, err := service.Compare(ctx, "orders")
+	if err != nil || comparison.Primary.MachineID != "m1" || len(comparison.Replicas) != 1 || comparison.Replicas[0].InSync {
+		t.Fatalf("comparison = %+v, %v", comparison, err)
+	}
+	if diffs := comparison.Replicas[0].Differences; len(diffs) != 3 || diffs[0].User != "app" || diffs[1].Change != inventorydomain.ChangeExtra || diffs[2].Change != inventorydomain.ChangeMissing {
+		t.Fatalf("differences = %+v", diffs)
+	}
+
+	if _, err := service.Sync(ctx, AccountSyncRequest{Cluster: "orders"}); err == nil {
+		t.Fatal("sync without confirmation must be rejected")
+	}
+	preview, err := service.Sync(ctx, AccountSyncRequest{Cluster: "orders", DryRun: true})
+	if err != nil || preview.Replicas[0].Status != AccountSyncPlanned || len(tasks.commands) != 0 {
+		t.Fatalf("preview = %+v, %v", preview, err)
+	}
+	if plan := strings.Join(preview.Replicas[0].Statements, ";"); strings.Contains(plan, "0x2441") || strings.Contains(plan, "legacy") {
+		t.Fatalf("preview leaks hashes or drops extras: %s", plan)
+	}
+
+	result, err := service.Sync(ctx, AccountSyncRequest{Cluster: "orders", Confirm: "orders", DropExtra: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item := result.Replicas[0]; item.Status != AccountSyncSucceeded || item.Remaining != 0 || item.TaskID == "" || result.ParentTaskID == "" {
+		t.Fatalf("result = %+v", result)
+	}
+	command := tasks.commands[0]
+	for _, want := range []string{"10.0.0.2 mysql_account_sync", "SET GLOBAL super_read_only=OFF", "SET SESSION sql_log_bin=0; DROP USER 'app'@'%'; CREATE USER `app`@`%`", "CREATE USER `mha`@`%`", "DROP USER 'legacy'@'%';", "SET GLOBAL super_read_only=ON"} {
+		if !strings.Contains(command, want) {
+			t.Fatalf("command missing %q:\n%s", want, command)
+		}
+	}
+	if tasks.redacted != 1 {
+		t.Fatalf("redacted = %d", tasks.redacted)
+	}
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	agentdomain "gmha/internal/domain/agent"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+)
+
+// Agent upgrade channels recorded on upgrade targets.
+const (
+	AgentUpgradeChannelTask = "task"
+	AgentUpgradeChannelSSH  = "ssh"
+)
+
+// ErrAgentUpgradeUnconfirmed means the Agent reported the binary swap but never
+// came back on the expected version. The host may be running a broken binary,
+// so callers must treat it as upgraded and roll it back.
+var ErrAgentUpgradeUnconfirmed = errors.New("Agent 已替换二进制但未以新版本恢复")
+
+const (
+	agentSelfUpgradeTaskTimeout = 10 * time.Minute
+	agentSelfUpgradeRestartWait = 90 * time.Second
+)
+
+// SetUpgradeSigner enables Agent self-upgrade over the task channel.
+func (s *AgentService) SetUpgradeSigner(signer *AgentUpgradeSigner) {
+	s.signer = signer
+}
+
+// UpgradeByIPPackage upgrades one Agent to pkg. Agents that advertise the
+// self-upgrade capability download the package over the task channel, so
+// rotated or removed SSH credentials do not matter; the others (installed
+// before the signing key was pinned, or without a live task connection) are
+// upgraded over SSH with binary. It returns the channel that was used.
+func (s *AgentService) UpgradeByIPPackage(ctx context.Context, ip string, pkg PackageItem, binary []byte) (string, error) {
+	machine, ok, err := s.resolveMachineByIP(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("machine not found")
+	}
+	if !s.selfUpgradeReady(machine.ID) {
+		_, err := s.UpgradeByIPBinary(ctx, ip, pkg.Version, binary)
+		return AgentUpgradeChannelSSH, err
+	}
+	if !s.beginAgentUpgrade(machine.ID) {
+		return AgentUpgradeChannelTask, errors.New("该机器的 Agent 正在升级，请勿重复提交")
+	}
+	defer s.finishAgentUpgrade(machine.ID)
+	agent, found, err := s.repo.GetByMachineID(ctx, machine.ID)
+	if err != nil {
+		return AgentUpgradeChannelTask, err
+	}
+	if !found {
+		return AgentUpgradeChannelTask, errors.New("agent not found")
+	}
+	return AgentUpgradeChannelTask, s.runSelfUpgrade(ctx, machine, agent, taskdomain.AgentSelfUpgradeSpec{
+		Version: pkg.Version, Arch: pkg.Arch, PackageName: pkg.Name, SHA256: pkg.SHA256,
+		DownloadURL: "/api/v1/packages/gmha-agent/" + url.PathEscape(pkg.Name),
+	})
+}
+
+func (s *AgentService) selfUpgradeReady(machineID string) bool {
+	if s.signer == nil || s.taskService == nil || s.heartbeat == nil {
+		return false
+	}
+	ready, _ := s.taskService.MachineCapability(machineID, string(taskdomain.TypeAgentSelfUpgrade))
+	return ready
+}
+
+// runSelfUpgrade signs and dispatches the task, then waits until the restarted
+// Agent heartbeats with the expected version.
+func (s *AgentService) runSelfUpgrade(ctx context.Context, machine machinedomain.Machine, agent agentdomain.Agent, spec taskdomain.AgentSelfUpgradeSpec) error {
+	want := spec.Version
+	if spec.RestoreVersion != "" {
+		want = spec.RestoreVersion
+	}
+	spec.MachineID = machine.ID
+	created, err := s.taskService.CreateAgentSelfUpgradeTask(ctx, machine.ID, spec, func(spec *taskdomain.AgentSelfUpgradeSpec) {
+		s.signer.Sign(spec, time.Now())
+	})
+	if err != nil {
+		return fmt.Errorf("下发 Agent 自升级任务失败: %w", err)
+	}
+	detail, err := s.taskService.WaitForTask(ctx, created.Task.ID, agentSelfUpgradeTaskTimeout)
+	if err != nil {
+		return fmt.Errorf("Agent 自升级任务 %s: %w", created.Task.ID, err)
+	}
+	if detail.Task.Status != taskdomain.StatusSuccess {
+		return fmt.Errorf("Agent 自升级任务 %s 失败: %s", created.Task.ID, taskFailureSummary(detail))
+	}
+	if err := s.waitForAgentVersion(ctx, machine.ID, want, time.Now().UTC(), agentSelfUpgradeRestartWait); err != nil {
+		return fmt.Errorf("%w：%v", ErrAgentUpgradeUnconfirmed, err)
+	}
+	agent.Version, agent.State, agent.LastError = want, agentdomain.StateOnline, ""
+	_, err = s.repo.Save(ctx, agent)
+	return err
+}
+
+// waitForAgentVersion waits for a heartbeat newer than since that reports
+// version. A heartbeat alone is not enough: the old process can still send one
+// between reporting the task and exiting.
+func (s *AgentService) waitForAgentVersion(ctx context.Context, machineID, version string, since time.Time, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	reported := ""
+	for {
+		view, ok, err := s.heartbeat.GetByMachineID(waitCtx, machineID)
+		if err == nil && ok && view.LastHeartbeatAt.After(since) {
+			if sameComponentVersion(view.Version, version) {
+				return nil
+			}
+			reported = view.Version
+		}
+		select {
+		case <-waitCtx.Done():
+			if reported != "" {
+				return fmt.Errorf("Agent 重启后上报版本 %s，期望 %s", reported, version)
+			}
+			return fmt.Errorf("Agent 在 %s 内未以新版本恢复心跳", timeout)
+		case <-ticker.C:
+		}
+	}
+}
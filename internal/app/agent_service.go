@@ -20,6 +20,7 @@ import (
 	dynamicdomain "gmha/internal/domain/dynamic"
 	hbdomain "gmha/internal/domain/heartbeat"
 	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
 	agentusecase "gmha/internal/usecase/agent"
 )
 
@@ -42,6 +43,7 @@ type AgentService struct {
 	managerGRPCAddr string
 	upgradeMu       sync.Mutex
 	upgrading       map[string]struct{}
+	signer          *AgentUpgradeSigner
 }
 
 // SetCredentialRepository configures the SSH credential source used by Agent
@@ -509,6 +511,72 @@ func (s *AgentService) finishAgentUpgrade(machineID string) {
 	s.upgradeMu.Unlock()
 }
 
+// HeartbeatByIP 返回指定 IP 机器上 Agent 的最新心跳视图。
+func (s *AgentService) HeartbeatByIP(ctx context.Context, ip string) (HeartbeatView, bool, error) {
+	if s.heartbeat == nil {
+		return HeartbeatView{}, false, errors.New("heartbeat service not configured")
+	}
+	machine, ok, err := s.resolveMachineByIP(ctx, ip)
+	if err != nil || !ok {
+		return HeartbeatView{}, false, err
+	}
+	return s.heartbeat.GetByMachineID(ctx, machine.ID)
+}
+
+// RollbackByIP 将指定 IP 机器上的 Agent 恢复为升级时留下的 agentd.backup-<version>
+// 备份，重启服务并等待新鲜心跳，成功后把记录的版本改回 version。支持自升级的
+// Agent 通过任务通道在本机恢复备份，其余 Agent 走 SSH。
+func (s *AgentService) RollbackByIP(ctx context.Context, ip, version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return errors.New("缺少升级前版本，无法定位 Agent 备份")
+	}
+	machine, ok, err := s.resolveMachineByIP(ctx, ip)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("machine not found")
+	}
+	if !s.beginAgentUpgrade(machine.ID) {
+		return errors.New("该机器的 Agent 正在升级，请勿重复提交")
+	}
+	defer s.finishAgentUpgrade(machine.ID)
+	agent, found, err := s.repo.GetByMachineID(ctx, machine.ID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("agent not found")
+	}
+	if s.selfUpgradeReady(machine.ID) {
+		return s.runSelfUpgrade(ctx, machine, agent, taskdomain.AgentSelfUpgradeSpec{Version: version, RestoreVersion: version})
+	}
+	installDir := strings.TrimSuffix(agentdomain.ResolveInstallDir(machine.SSHUser, firstNonEmpty(agent.InstallDir, machine.AgentInstallDir)), "/")
+	backup := installDir + "/agentd.backup-" + strings.ReplaceAll(version, "/", "_")
+	auth, err := s.machineSSHAuth(ctx, machine)
+	if err != nil {
+		return err
+	}
+	if s.sshClient == nil {
+		return errors.New("ssh client not configured")
+	}
+	endpoint := machinedomain.Endpoint{IP: machine.IP, SSHPort: machine.SSHPort}
+	startedAt := time.Now().UTC()
+	command := fmt.Sprintf("test -f %s && cp -p %s %s && systemctl restart gmha-agent", shellQuote(backup), shellQuote(backup), shellQuote(installDir+"/agentd"))
+	if err := s.sshClient.Run(ctx, endpoint, auth, command); err != nil {
+		return fmt.Errorf("恢复备份 %s 失败: %w", backup, err)
+	}
+	if s.heartbeat != nil {
+		if err := s.heartbeat.WaitForFreshHeartbeat(ctx, machine.ID, startedAt, 30*time.Second); err != nil {
+			return fmt.Errorf("回滚后等待心跳失败: %w", err)
+		}
+	}
+	agent.Version, agent.InstallDir, agent.State, agent.LastError = version, installDir, agentdomain.StateOnline, ""
+	_, err = s.repo.Save(ctx, agent)
+	return err
+}
+
 // ListUninstallCandidates 列出可卸载 Agent 的候选机器。
 func (s *AgentService) ListUninstallCandidates(ctx context.Context) ([]AgentView, error) {
 	items, err := s.ListViews(ctx)
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	taskdomain "gmha/internal/domain/task"
+)
+
+// agentSelfUpgradeTTL bounds how long a signed self-upgrade task stays valid,
+// so an old task cannot be replayed later to downgrade an Agent.
+const agentSelfUpgradeTTL = time.Hour
+
+// AgentUpgradeSigner signs Agent self-upgrade tasks with the Manager's ed25519
+// key. Agents pin the public key in agent.yaml when installed or upgraded over
+// SSH and refuse self-upgrade tasks signed by anything else.
+type AgentUpgradeSigner struct {
+	key ed25519.PrivateKey
+}
+
+// LoadAgentUpgradeSigner reads the base64 ed25519 seed at path, creating it
+// with mode 0600 on first use.
+func LoadAgentUpgradeSigner(path string) (*AgentUpgradeSigner, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+		return &AgentUpgradeSigner{key: ed25519.NewKeyFromSeed(seed)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("Agent 升级签名密钥 %s 格式无效", path)
+	}
+	return &AgentUpgradeSigner{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// PublicKey returns the base64 public key rendered into agent.yaml.
+func (s *AgentUpgradeSigner) PublicKey() string {
+	if s == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// Sign sets the expiry and signature of spec.
+func (s *AgentUpgradeSigner) Sign(spec *taskdomain.AgentSelfUpgradeSpec, now time.Time) {
+	spec.ExpiresAt = now.UTC().Add(agentSelfUpgradeTTL).Truncate(time.Second)
+	spec.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, spec.SigningPayload()))
+}
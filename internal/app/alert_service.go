@@ -1146,7 +1146,7 @@ func alertIdentityLabels(labels map[string]string) map[string]string {
 
 func alertIdentityLabel(key string, hasMySQLPort bool) bool {
 	switch key {
-	case "display_name", "metric_scope", "machine_name", "machine_ip", "alert_category", "resolution_reason":
+	case "display_name", "metric_scope", "machine_name", "machine_ip", "alert_category", "resolution_reason", "message":
 		return false
 	case "mysql_host", "mysql_endpoint", "mysql_instance":
 		return !hasMySQLPort
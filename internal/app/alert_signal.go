@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	dynamicdomain "gmha/internal/domain/dynamic"
+	hbdomain "gmha/internal/domain/heartbeat"
+)
+
+// alertSignalRepeatInterval throttles repeated notifications for a signal
+// that stays active at the same severity. Manager-side checks run far less
+// often than heartbeats, so one reminder per day is enough.
+const alertSignalRepeatInterval = 24 * time.Hour
+
+// AlertSignal is a condition detected by a Manager workflow (certificate
+// expiry, drift checks, ...) rather than by a heartbeat threshold rule. It
+// shares the event table, filters and notification outbox with rule alerts.
+type AlertSignal struct {
+	RuleID      string
+	RuleName    string
+	Metric      string
+	Category    string
+	MachineID   string
+	MachineName string
+	MachineIP   string
+	ClusterID   string
+	Labels      map[string]string
+	Severity    alertdomain.Severity
+	Value       float64
+	Threshold   float64
+	Operator    string
+	Message     string
+}
+
+// RaiseSignal opens or refreshes the active event identified by rule, machine
+// and stable labels. Notifications are sent for new events, severity
+// escalation and once per repeat interval afterwards.
+func (s *AlertService) RaiseSignal(ctx context.Context, signal AlertSignal) error {
+	if strings.TrimSpace(signal.RuleID) == "" {
+		return alertdomain.Invalid("signal rule_id is required")
+	}
+	if signal.Severity == "" {
+		signal.Severity = alertdomain.SeverityWarning
+	}
+	labels := alertSignalLabels(signal)
+	fp := fingerprint(signal.RuleID, signal.MachineID, labels)
+	filters, _ := s.repo.ListFilters(ctx)
+	rule, payload, metric := alertSignalRuleView(signal, labels)
+	if alertFiltered(filters, rule, payload, metric) {
+		return nil
+	}
+	now := time.Now().UTC()
+	active, found, err := s.repo.GetActiveEvent(ctx, fp)
+	if err != nil {
+		return err
+	}
+	escalated := false
+	if !found {
+		active = alertdomain.Event{
+			ID: stableID(fp, fmt.Sprint(now.UnixNano())), Fingerprint: fp, RuleID: signal.RuleID, RuleName: signal.RuleName, Metric: signal.Metric,
+			MachineID: signal.MachineID, ClusterID: signal.ClusterID, Labels: labels, Severity: signal.Severity, Status: "firing",
+			Value: signal.Value, Threshold: signal.Threshold, Operator: signal.Operator, OccurrenceCount: 1, FirstSeenAt: now, LastSeenAt: now, AutomationState: "pending",
+		}
+	} else {
+		escalated = alertdomain.SeverityRank(signal.Severity) > alertdomain.SeverityRank(active.Severity)
+		active.Labels = labels
+		active.ClusterID = signal.ClusterID
+		active.Severity = signal.Severity
+		active.Value = signal.Value
+		active.Threshold = signal.Threshold
+		active.Operator = signal.Operator
+		active.LastSeenAt = now
+		active.OccurrenceCount++
+	}
+	notify := active.SilencedUntil == nil || active.SilencedUntil.Before(now)
+	notify = notify && (escalated || active.LastNotifiedAt == nil || now.Sub(*active.LastNotifiedAt) >= alertSignalRepeatInterval)
+	if err := s.repo.SaveEvent(ctx, active); err != nil {
+		return err
+	}
+	if notify && s.enqueue(active) {
+		active.NotificationCount++
+		active.LastNotifiedAt = &now
+		return s.repo.SaveEvent(ctx, active)
+	}
+	return nil
+}
+
+// ResolveSignal closes the active event raised for the same identity, if any.
+func (s *AlertService) ResolveSignal(ctx context.Context, signal AlertSignal) error {
+	fp := fingerprint(signal.RuleID, signal.MachineID, alertSignalLabels(signal))
+	active, found, err := s.repo.GetActiveEvent(ctx, fp)
+	if err != nil || !found {
+		return err
+	}
+	resolveAlertEvent(&active, signal.Value, time.Now().UTC(), "condition_cleared")
+	if err := s.repo.SaveEvent(ctx, active); err != nil {
+		return err
+	}
+	s.enqueue(active)
+	return nil
+}
+
+func alertSignalLabels(signal AlertSignal) map[string]string {
+	labels := cloneLabels(signal.Labels)
+	labels["machine_name"], labels["machine_ip"] = signal.MachineName, signal.MachineIP
+	if signal.Category != "" {
+		labels["alert_category"] = signal.Category
+	}
+	if signal.Message != "" {
+		labels["message"] = signal.Message
+	}
+	return labels
+}
+
+// alertSignalRuleView adapts a signal to the shapes used by alert filters so
+// operators can mute Manager-side signals with the same filter definitions.
+func alertSignalRuleView(signal AlertSignal, labels map[string]string) (alertdomain.Rule, hbdomain.HeartbeatPayload, dynamicdomain.MetricResult) {
+	rule := alertdomain.Rule{ID: signal.RuleID, Name: signal.RuleName, Description: signal.Message, Metric: signal.Metric}
+	payload := hbdomain.HeartbeatPayload{MachineID: signal.MachineID, MachineName: signal.MachineName, MachineIP: signal.MachineIP, ClusterID: signal.ClusterID}
+	metric := dynamicdomain.MetricResult{Name: signal.Metric, Category: signal.Category, Labels: labels}
+	return rule, payload, metric
+}
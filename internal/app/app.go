@@ -40,27 +40,40 @@ type Config struct {
 
 // App 是应用核心结构体，持有所有服务实例。
 type App struct {
-	db                    *sql.DB
-	MachineService        *MachineService
-	ClusterService        *ClusterService
-	AgentService          *AgentService
-	HeartbeatService      *HeartbeatService
-	RecoveryService       *RecoveryService
-	TaskService           *TaskService
-	ClusterUpgradeService *ClusterUpgradeService
-	MySQLService          *MySQLService
-	HistogramService      *HistogramService
-	BinlogAnalysisService *BinlogAnalysisService
-	HAService             *HAService
-	PackageService        *PackageService
-	BackupService         *BackupService
-	AlertService          *AlertService
-	ManagerRuntime        *ManagerRuntimeService
-	ManagerHA             *ManagerHAService
-	UpgradeService        *UpgradeService
-	SQLDiagnosticService  *SQLDiagnosticService
-	FlameGraphService     *FlameGraphService
-	AIService             *AIService
+	db                        *sql.DB
+	MachineService            *MachineService
+	ClusterService            *ClusterService
+	AgentService              *AgentService
+	HeartbeatService          *HeartbeatService
+	RecoveryService           *RecoveryService
+	TaskService               *TaskService
+	ClusterUpgradeService     *ClusterUpgradeService
+	MySQLService              *MySQLService
+	HistogramService          *HistogramService
+	BinlogAnalysisService     *BinlogAnalysisService
+	SchemaService             *SchemaService
+	SchemaChangeService       *SchemaChangeService
+	CapacityService           *CapacityService
+	BaselineService           *BaselineService
+	ConfigDriftService        *ConfigDriftService
+	ParameterTemplateService  *ParameterTemplateService
+	CredentialRotationService *CredentialRotationService
+	AccountInventoryService   *AccountInventoryService
+	HAService                 *HAService
+	PackageService            *PackageService
+	BackupService             *BackupService
+	AlertService              *AlertService
+	ManagerRuntime            *ManagerRuntimeService
+	ManagerHA                 *ManagerHAService
+	UpgradeService            *UpgradeService
+	SQLDiagnosticService      *SQLDiagnosticService
+	FlameGraphService         *FlameGraphService
+	ProxySQLService           *ProxySQLService
+	CertificateService        *CertificateService
+	DRService                 *DRService
+	ReplicaRebuildService     *ReplicaRebuildService
+	ClusterSpecService        *ClusterSpecService
+	AIService                 *AIService
 }
 
 // New 创建并初始化应用核心实例。
@@ -88,8 +101,20 @@ func New(cfg Config) (*App, error) {
 	credentialRepo := sqliteinfra.NewCredentialRepository(store)
 	sqlDiagnosticRepo := sqliteinfra.NewSQLDiagnosticRepository(store)
 	flameGraphRepo := sqliteinfra.NewFlameGraphRepository(store)
+	binlogAnalysisRepo := sqliteinfra.NewBinlogAnalysisRepository(store)
+	schemaSnapshotRepo := sqliteinfra.NewSchemaSnapshotRepository(store)
+	schemaChangeRepo := sqliteinfra.NewSchemaChangeRepository(store)
+	capacityRepo := sqliteinfra.NewCapacityRepository(store)
+	baselineRepo := sqliteinfra.NewBaselineRepository(store)
+	configDriftRepo := sqliteinfra.NewConfigDriftRepository(store)
+	parameterTemplateRepo := sqliteinfra.NewParameterTemplateRepository(store)
+	credentialRotationRepo := sqliteinfra.NewCredentialRotationRepository(store)
+	accountInventoryRepo := sqliteinfra.NewAccountInventoryRepository(store)
 	managerHARepo := sqliteinfra.NewManagerHARepository(store)
 	aiRepo := sqliteinfra.NewAIRepository(store)
+	proxySQLRepo := sqliteinfra.NewProxySQLRepository(store)
+	certificateRepo := sqliteinfra.NewCertificateRepository(store)
+	drRepo := sqliteinfra.NewDRRepository(store)
 	if err := machineRepo.Migrate(); err != nil {
 		_ = db.Close()
 		return nil, err
@@ -154,6 +179,42 @@ func New(cfg Config) (*App, error) {
 		_ = db.Close()
 		return nil, err
 	}
+	if err := binlogAnalysisRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := schemaSnapshotRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := schemaChangeRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := capacityRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := baselineRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := configDriftRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := parameterTemplateRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := credentialRotationRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := accountInventoryRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	if err := managerHARepo.Migrate(); err != nil {
 		_ = db.Close()
 		return nil, err
@@ -162,6 +223,18 @@ func New(cfg Config) (*App, error) {
 		_ = db.Close()
 		return nil, err
 	}
+	if err := proxySQLRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := certificateRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := drRepo.Migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
 	sshClient := sshinfra.NewClient(cfg.ManagerPublicKey)
 	trustService, err := sshinfra.NewTrustService(cfg.ManagerPublicKey, sshClient)
@@ -217,20 +290,28 @@ func New(cfg Config) (*App, error) {
 		}
 		heartbeatService.UpdateMySQLDynamicCollectConfig(saved)
 	}
+	home, _ := os.UserHomeDir()
+	upgradeSigner, err := LoadAgentUpgradeSigner(filepath.Join(home, ".gmha", "agent-upgrade-signing.key"))
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 	installAgent := agentusecase.NewInstallAgentUsecase(agentusecase.Dependencies{
-		MachineRepo: machinedomain.Repository(machineRepo),
-		AgentRepo:   agentdomain.Repository(agentRepo),
-		SSHClient:   sshClient,
-		Renderer:    renderer,
-		Waiter:      heartbeatService,
+		MachineRepo:      machinedomain.Repository(machineRepo),
+		AgentRepo:        agentdomain.Repository(agentRepo),
+		SSHClient:        sshClient,
+		Renderer:         renderer,
+		Waiter:           heartbeatService,
+		UpgradePublicKey: upgradeSigner.PublicKey(),
 	})
 	upgradeAgent := agentusecase.NewUpgradeAgentUsecase(agentusecase.UpgradeDependencies{
-		MachineRepo:    machinedomain.Repository(machineRepo),
-		AgentRepo:      agentdomain.Repository(agentRepo),
-		CredentialRepo: credentialRepo,
-		SSHClient:      sshClient,
-		Renderer:       renderer,
-		Heartbeat:      heartbeatService,
+		MachineRepo:      machinedomain.Repository(machineRepo),
+		AgentRepo:        agentdomain.Repository(agentRepo),
+		CredentialRepo:   credentialRepo,
+		SSHClient:        sshClient,
+		Renderer:         renderer,
+		Heartbeat:        heartbeatService,
+		UpgradePublicKey: upgradeSigner.PublicKey(),
 	})
 	uninstallAgent := agentusecase.NewUninstallAgentUsecase(agentusecase.UninstallDependencies{
 		MachineRepo: machinedomain.Repository(machineRepo),
@@ -243,7 +324,6 @@ func New(cfg Config) (*App, error) {
 	createCollectTask := taskusecase.NewCreateCollectMachineInfoUsecase(machineRepo, agentRepo)
 	createStaticTask := taskusecase.NewCreateCollectStaticInfoUsecase(machineRepo, agentRepo)
 	packageSelector := mysqlapp.NewPackageSelector(filepath.Join("software", "mysql"))
-	home, _ := os.UserHomeDir()
 	packageService, err := NewPackageService(filepath.Join(home, ".gmha", "package-store.json"), packageSelector)
 	if err != nil {
 		_ = db.Close()
@@ -268,12 +348,20 @@ func New(cfg Config) (*App, error) {
 	taskService := NewTaskService(taskdomain.Repository(taskRepo), createExecTask, createCollectTask, createStaticTask, createMySQLInstallTask, createMySQLUninstallTask, createMySQLTopologyTask, machineInfoRepo, staticInfoRepo, machineRepo, mysqlInstanceRepo)
 	mysqlService := NewMySQLService(mysqlInstanceRepo, machinedomain.Repository(machineRepo), heartbeatService, mysqlAccountPresetRepo)
 	histogramService := NewHistogramService(mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo)
-	binlogAnalysisService := NewBinlogAnalysisService(mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo)
+	binlogAnalysisService := NewBinlogAnalysisService(binlogAnalysisRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo)
+	binlogAnalysisService.SetAlertService(alertService)
+	binlogAnalysisService.Start()
+	schemaService := NewSchemaService(schemaSnapshotRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo)
+	schemaService.SetAlertService(alertService)
+	schemaService.Start()
+	schemaChangeService := NewSchemaChangeService(schemaChangeRepo, schemaSnapshotRepo, taskService)
+	schemaChangeService.Start()
 	sqlDiagnosticService, err := NewSQLDiagnosticService(sqlDiagnosticRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo)
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
+	sqlDiagnosticService.SetAlertService(alertService)
 	sqlDiagnosticService.Start()
 	haService := NewHAService(haRepo, machinedomain.Repository(machineRepo), mysqlInstanceRepo, mysqlAccountPresetRepo)
 	haService.ConfigureArchitectureExecutor(taskService)
@@ -285,6 +373,7 @@ func New(cfg Config) (*App, error) {
 	clusterService := NewClusterService(clusterRepo)
 	agentService := NewAgentService(agentRepo, machineRepo, sshClient, heartbeatService, recoveryService, installAgent, upgradeAgent, uninstallAgent, taskService, mysqlService, cfg.AgentBinaryPath, cfg.ManagerHTTPAddr, cfg.ManagerGRPCAddr)
 	agentService.SetCredentialRepository(credentialRepo)
+	agentService.SetUpgradeSigner(upgradeSigner)
 	machineService := NewMachineService(onboard, machineRepo, clusterRepo, credentialRepo, machineInfoRepo, staticInfoRepo, recoveryRepo, sshClient, agentService, taskService)
 	backupService := NewBackupService(backupRepo, taskService, machinedomain.Repository(machineRepo), mysqlInstanceRepo)
 	machineService.ConfigureClusterDependencies(haService, backupService)
@@ -293,6 +382,45 @@ func New(cfg Config) (*App, error) {
 	flameGraphService := NewFlameGraphService(flameGraphRepo, taskService, machinedomain.Repository(machineRepo))
 	taskService.SetFlameGraphTaskResultSaver(flameGraphService)
 	flameGraphService.Start()
+	capacityService := NewCapacityService(capacityRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo, machineService)
+	capacityService.SetAlertService(alertService)
+	capacityService.Start()
+	baselineService := NewBaselineService(baselineRepo, machinedomain.Repository(machineRepo), taskService)
+	baselineService.SetAlertService(alertService)
+	configDriftService := NewConfigDriftService(configDriftRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo))
+	configDriftService.SetAlertService(alertService)
+	parameterTemplateService := NewParameterTemplateService(parameterTemplateRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), machineInfoRepo, configDriftRepo)
+	if err := parameterTemplateService.RecoverInterrupted(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	proxySQLService := NewProxySQLService(proxySQLRepo, taskService, machinedomain.Repository(machineRepo), mysqlInstanceRepo, mysqlAccountPresetRepo)
+	proxySQLService.ConfigurePackageSource(packageService, machineInfoRepo, func(targetIP string) string {
+		return ResolveManagerHTTPAddrForTarget(cfg.ManagerHTTPAddr, targetIP)
+	})
+	haService.SetRouteSynchronizer(proxySQLService)
+	credentialRotationService := NewCredentialRotationService(credentialRotationRepo, taskService, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo, backupRepo)
+	credentialRotationService.SetProxySQLService(proxySQLService)
+	if err := credentialRotationService.RecoverInterrupted(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	credentialRotationService.Start()
+	accountInventoryService := NewAccountInventoryService(accountInventoryRepo, mysqlInstanceRepo, machinedomain.Repository(machineRepo), mysqlAccountPresetRepo, taskService)
+	accountInventoryService.Start()
+	certificateService := NewCertificateService(certificateRepo, taskService, machinedomain.Repository(machineRepo), mysqlInstanceRepo)
+	certificateService.SetAlertService(alertService)
+	createMySQLInstallTask.SetTLSIssuer(certificateService)
+	createMySQLTopologyTask.SetReplicationTLSResolver(certificateService)
+	haService.SetReplicationTLSResolver(certificateService)
+	certificateService.Start()
+	drService := NewDRService(drRepo, taskService, machinedomain.Repository(machineRepo), mysqlInstanceRepo, haService)
+	drService.SetAlertService(alertService)
+	drService.SetReplicationTLSResolver(certificateService)
+	drService.Start()
+	replicaRebuildService := NewReplicaRebuildService(taskService, machinedomain.Repository(machineRepo), mysqlInstanceRepo, haService)
+	replicaRebuildService.SetReplicationTLSResolver(certificateService)
+	clusterSpecService := NewClusterSpecService(machineService, clusterRepo, machinedomain.Repository(machineRepo), mysqlInstanceRepo, mysqlService, haService, backupService, alertService, taskService)
 
 	managerRuntime := NewManagerRuntimeService(cfg)
 	managerRuntime.SetPlatformUsageChecker(func(ctx context.Context) (bool, error) {
@@ -315,27 +443,40 @@ func New(cfg Config) (*App, error) {
 	aiService.ConfigurePlatformContext(haService, backupService)
 	aiService.ConfigureClusterOperations(clusterUpgradeService)
 	return &App{
-		db:                    db,
-		MachineService:        machineService,
-		ClusterService:        clusterService,
-		AgentService:          agentService,
-		HeartbeatService:      heartbeatService,
-		RecoveryService:       recoveryService,
-		TaskService:           taskService,
-		ClusterUpgradeService: clusterUpgradeService,
-		MySQLService:          mysqlService,
-		HistogramService:      histogramService,
-		BinlogAnalysisService: binlogAnalysisService,
-		HAService:             haService,
-		PackageService:        packageService,
-		BackupService:         backupService,
-		AlertService:          alertService,
-		ManagerRuntime:        managerRuntime,
-		ManagerHA:             managerHAService,
-		UpgradeService:        upgradeService,
-		SQLDiagnosticService:  sqlDiagnosticService,
-		FlameGraphService:     flameGraphService,
-		AIService:             aiService,
+		db:                        db,
+		MachineService:            machineService,
+		ClusterService:            clusterService,
+		AgentService:              agentService,
+		HeartbeatService:          heartbeatService,
+		RecoveryService:           recoveryService,
+		TaskService:               taskService,
+		ClusterUpgradeService:     clusterUpgradeService,
+		MySQLService:              mysqlService,
+		HistogramService:          histogramService,
+		BinlogAnalysisService:     binlogAnalysisService,
+		SchemaService:             schemaService,
+		SchemaChangeService:       schemaChangeService,
+		CapacityService:           capacityService,
+		BaselineService:           baselineService,
+		ConfigDriftService:        configDriftService,
+		ParameterTemplateService:  parameterTemplateService,
+		CredentialRotationService: credentialRotationService,
+		AccountInventoryService:   accountInventoryService,
+		HAService:                 haService,
+		PackageService:            packageService,
+		BackupService:             backupService,
+		AlertService:              alertService,
+		ManagerRuntime:            managerRuntime,
+		ManagerHA:                 managerHAService,
+		UpgradeService:            upgradeService,
+		SQLDiagnosticService:      sqlDiagnosticService,
+		FlameGraphService:         flameGraphService,
+		ProxySQLService:           proxySQLService,
+		CertificateService:        certificateService,
+		DRService:                 drService,
+		ReplicaRebuildService:     replicaRebuildService,
+		ClusterSpecService:        clusterSpecService,
+		AIService:                 aiService,
 	}, nil
 }
 
@@ -405,9 +546,30 @@ func (a *App) Close() error {
 	if a.FlameGraphService != nil {
 		a.FlameGraphService.Close()
 	}
+	if a.CertificateService != nil {
+		a.CertificateService.Close()
+	}
+	if a.DRService != nil {
+		a.DRService.Close()
+	}
 	if a.BinlogAnalysisService != nil {
 		a.BinlogAnalysisService.Close()
 	}
+	if a.SchemaService != nil {
+		a.SchemaService.Close()
+	}
+	if a.SchemaChangeService != nil {
+		a.SchemaChangeService.Close()
+	}
+	if a.CapacityService != nil {
+		a.CapacityService.Close()
+	}
+	if a.CredentialRotationService != nil {
+		a.CredentialRotationService.Close()
+	}
+	if a.AccountInventoryService != nil {
+		a.AccountInventoryService.Close()
+	}
 	if a.AIService != nil {
 		a.AIService.Close()
 	}
@@ -11,8 +11,8 @@ import (
 
 	hadomain "gmha/internal/domain/ha"
 	machinedomain "gmha/internal/domain/machine"
-	taskdomain "gmha/internal/domain/task"
 	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
 )
 
 type architectureRunRepository interface {
@@ -353,6 +353,9 @@ func (s *HAService) executeArchitectureAdjustment(ctx context.Context, runs arch
 				return
 			}
 		}
+		if err := s.syncArchitectureRoutes(ctx, runs, &run, req, req.PreferredNewMasterMachineID, machines); err != nil {
+			return
+		}
 		if err := s.runArchitectureStep(ctx, runs, &run, "resume_business_connections", func() ([]string, error) {
 			return s.resumeArchitectureBusinessConnections(ctx, req, machines)
 		}); err != nil {
@@ -544,6 +547,9 @@ func (s *HAService) executeArchitectureAdjustment(ctx context.Context, runs arch
 			return
 		}
 	}
+	if err := s.syncArchitectureRoutes(ctx, runs, &run, topologyReq, run.Plan.SelectedCandidate.MachineID, machines); err != nil {
+		return
+	}
 	if err := s.runArchitectureStep(ctx, runs, &run, "resume_business_connections", func() ([]string, error) {
 		return s.resumeArchitectureBusinessConnections(ctx, topologyReq, machines)
 	}); err != nil {
@@ -563,6 +569,38 @@ func (s *HAService) executeArchitectureAdjustment(ctx context.Context, runs arch
 	s.succeedArchitectureRun(ctx, runs, &run)
 }
 
+// syncArchitectureRoutes 仅在计划包含 sync_proxysql 时执行，向路由层下发
+// 新主与参与拓扑的全部节点。
+func (s *HAService) syncArchitectureRoutes(ctx context.Context, runs architectureRunRepository, run *hadomain.ArchitectureRun, req hadomain.ArchitectureAdjustmentRequest, primaryID string, machines map[string]machinedomain.Machine) error {
+	if s.routes == nil || !architecturePlanHasStep(run.Plan.Steps, "sync_proxysql") {
+		return nil
+	}
+	return s.runArchitectureStep(ctx, runs, run, "sync_proxysql", func() ([]string, error) {
+		topology := ClusterRouteTopology{RunID: run.RunID, PrimaryMachineID: primaryID}
+		for _, node := range req.Nodes {
+			machine, ok := machines[node.MachineID]
+			if !ok {
+				continue
+			}
+			port := node.Port
+			if port <= 0 {
+				port = 3306
+			}
+			topology.Backends = append(topology.Backends, ClusterRouteBackend{MachineID: node.MachineID, Host: machine.IP, Port: port})
+		}
+		return s.routes.SyncClusterRoutes(ctx, run.ClusterID, topology)
+	})
+}
+
+func architecturePlanHasStep(steps []hadomain.ArchitecturePlanStep, code string) bool {
+	for _, step := range steps {
+		if step.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
 func architectureParticipationRequest(req hadomain.ArchitectureAdjustmentRequest) hadomain.ArchitectureAdjustmentRequest {
 	if len(req.MaintenanceDetachedMachineIDs) == 0 {
 		return req
@@ -720,7 +758,7 @@ func (s *HAService) electLiveArchitectureCandidate(ctx context.Context, clusterI
 		}
 		startingFromIndependent := req.CurrentMasterMachineID == "" && !req.InitializeVIP
 		if !startingFromIndependent && !gtidSetSubset(nodeGTIDSets[node.MachineID], selected.ExecutedGTIDSet) {
-			return hadomain.CandidateScore{}, taskIDs, fmt.Errorf("target replica %s has divergent GTID history; clone or rebuild it before assigning replication", node.MachineID)
+			return hadomain.CandidateScore{}, taskIDs, fmt.Errorf("target replica %s has divergent GTID history; rebuild it via POST /api/v1/clusters/%s/replicas/rebuild before assigning replication", node.MachineID, clusterID)
 		}
 	}
 	selected.DataFreshnessScore = 100
@@ -759,7 +797,7 @@ func (s *HAService) alignIndependentReplicaGTID(ctx context.Context, req hadomai
 			return taskIDs, fmt.Errorf("independent target %s returned invalid business-object count %q", node.MachineID, strings.TrimSpace(output))
 		}
 		if businessObjects != 0 {
-			return taskIDs, fmt.Errorf("target replica %s has divergent GTID history and %d business table/view(s); clone or explicitly reconcile it before assigning replication", node.MachineID, businessObjects)
+			return taskIDs, fmt.Errorf("target replica %s has divergent GTID history and %d business table/view(s); rebuild it via POST /api/v1/clusters/%s/replicas/rebuild or explicitly reconcile it before assigning replication", node.MachineID, businessObjects, selected.ClusterID)
 		}
 		reset := replicationStopResetShell(client) +
 			"if ! " + client + " --execute='RESET BINARY LOGS AND GTIDS' >/dev/null 2>&1; then " + client + " --execute='RESET MASTER'; fi; "
@@ -1469,29 +1507,9 @@ func (s *HAService) runOneArchitectureCommand(ctx context.Context, machine machi
 }
 
 func (s *HAService) runOneArchitectureProbe(ctx context.Context, machine machinedomain.Machine, command string) (string, string, error) {
-	detail, err := s.tasks.CreateExecTaskWithOptions(ctx, machine.IP, command, ExecTaskOptions{
+	return s.tasks.RunExecTask(ctx, machine.IP, command, ExecTaskOptions{
 		Operation: "mysql_architecture_step", DisplayName: "MySQL 架构调整子任务", StepName: "执行数据库架构调整命令",
-	})
-	if err != nil {
-		return "", "", err
-	}
-	completed, err := s.tasks.WaitForTask(ctx, detail.Task.ID, 2*time.Minute)
-	if err != nil {
-		return detail.Task.ID, "", err
-	}
-	defer func() { _ = s.tasks.RedactExecTaskCommand(context.Background(), detail.Task.ID) }()
-	output := ""
-	if len(completed.Steps) > 0 {
-		output = completed.Steps[len(completed.Steps)-1].Message
-	}
-	if completed.Task.Status != taskdomain.StatusSuccess {
-		message := strings.TrimSpace(output)
-		if message == "" {
-			return detail.Task.ID, output, fmt.Errorf("agent task %s failed", detail.Task.ID)
-		}
-		return detail.Task.ID, output, fmt.Errorf("agent task %s failed: %s", detail.Task.ID, message)
-	}
-	return detail.Task.ID, output, nil
+	}, 2*time.Minute)
 }
 
 func (s *HAService) runOnArchitectureNodes(ctx context.Context, nodes []hadomain.ArchitectureNodeRequest, machines map[string]machinedomain.Machine, command func(hadomain.ArchitectureNodeRequest, machinedomain.Machine) string) ([]string, error) {
@@ -1635,8 +1653,8 @@ func (s *HAService) configureArchitectureTopology(ctx context.Context, req hadom
 		sourceMachine := machines[source.MachineID]
 		client := mysqlArchitectureClient(architectureRootPassword(req, node.MachineID), node.Port)
 		reset := replicationStopResetShell(client)
-		modernSQL := fmt.Sprintf("SET GLOBAL offline_mode=ON; CHANGE REPLICATION SOURCE TO SOURCE_HOST=%s,SOURCE_PORT=%d,SOURCE_USER=%s,SOURCE_PASSWORD=%s,SOURCE_AUTO_POSITION=1,SOURCE_DELAY=%d,GET_SOURCE_PUBLIC_KEY=1; START REPLICA;", sqlLiteral(sourceMachine.IP), source.Port, sqlLiteral(req.ReplicationUser), sqlLiteral(req.ReplicationPassword), node.DelaySeconds)
-		legacySQL := fmt.Sprintf("SET GLOBAL offline_mode=ON; CHANGE MASTER TO MASTER_HOST=%s,MASTER_PORT=%d,MASTER_USER=%s,MASTER_PASSWORD=%s,MASTER_AUTO_POSITION=1,MASTER_DELAY=%d; START SLAVE;", sqlLiteral(sourceMachine.IP), source.Port, sqlLiteral(req.ReplicationUser), sqlLiteral(req.ReplicationPassword), node.DelaySeconds)
+		modernSQL := fmt.Sprintf("SET GLOBAL offline_mode=ON; CHANGE REPLICATION SOURCE TO SOURCE_HOST=%s,SOURCE_PORT=%d,SOURCE_USER=%s,SOURCE_PASSWORD=%s,SOURCE_AUTO_POSITION=1,SOURCE_DELAY=%d,GET_SOURCE_PUBLIC_KEY=1%s; START REPLICA;", sqlLiteral(sourceMachine.IP), source.Port, sqlLiteral(req.ReplicationUser), sqlLiteral(req.ReplicationPassword), node.DelaySeconds, s.architectureReplicationTLS(ctx, node, "SOURCE"))
+		legacySQL := fmt.Sprintf("SET GLOBAL offline_mode=ON; CHANGE MASTER TO MASTER_HOST=%s,MASTER_PORT=%d,MASTER_USER=%s,MASTER_PASSWORD=%s,MASTER_AUTO_POSITION=1,MASTER_DELAY=%d%s; START SLAVE;", sqlLiteral(sourceMachine.IP), source.Port, sqlLiteral(req.ReplicationUser), sqlLiteral(req.ReplicationPassword), node.DelaySeconds, s.architectureReplicationTLS(ctx, node, "MASTER"))
 		command := reset + "(" + client + " --batch --raw --execute=" + shellQuote(modernSQL) + " >/dev/null 2>&1 || " + client + " --batch --raw --execute=" + shellQuote(legacySQL) + "); "
 		if isMaster {
 			offset := 1
@@ -1754,6 +1772,31 @@ func architectureNode(nodes []hadomain.ArchitectureNodeRequest, machineID string
 	return hadomain.ArchitectureNodeRequest{}, false
 }
 
+// architectureReplicationTLS returns the SSL options appended to CHANGE
+// REPLICATION SOURCE (prefix SOURCE) or CHANGE MASTER (prefix MASTER) for the
+// replica node, or "" when the cluster does not use replication TLS.
+func (s *HAService) architectureReplicationTLS(ctx context.Context, node hadomain.ArchitectureNodeRequest, prefix string) string {
+	if s.tls == nil {
+		return ""
+	}
+	tls, ok := s.tls.ReplicationSourceTLS(ctx, node.MachineID, node.Port)
+	if !ok {
+		return ""
+	}
+	return architectureReplicationTLSClause(tls, prefix)
+}
+
+func architectureReplicationTLSClause(tls taskusecase.ReplicationTLS, prefix string) string {
+	if strings.TrimSpace(tls.CAPath) == "" {
+		return ""
+	}
+	clause := fmt.Sprintf(",%s_SSL=1,%s_SSL_CA=%s", prefix, prefix, sqlLiteral(tls.CAPath))
+	if tls.VerifyServerCert {
+		clause += fmt.Sprintf(",%s_SSL_VERIFY_SERVER_CERT=1", prefix)
+	}
+	return clause
+}
+
 func architectureStepName(steps []hadomain.ArchitecturePlanStep, code string) string {
 	for _, step := range steps {
 		if step.Code == code {
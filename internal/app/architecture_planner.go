@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -126,7 +127,17 @@ func (s *HAService) PlanArchitectureAdjustment(ctx context.Context, clusterID st
 			plan.BlockingReasons = append(plan.BlockingReasons, fmt.Sprintf("VIP route mode %s cannot be executed automatically", plan.VIPRouteMode))
 		}
 	}
+	plan.RebuildSuggestions = architectureRebuildSuggestions(clusterID, req, scores)
+	for _, suggestion := range plan.RebuildSuggestions {
+		plan.BlockingReasons = append(plan.BlockingReasons, fmt.Sprintf("replica %s %s; rebuild it first via POST %s", suggestion.MachineID, suggestion.Reason, suggestion.Endpoint))
+	}
+	if len(plan.RebuildSuggestions) > 0 {
+		plan.Executable = false
+	}
 	plan.Steps = architecturePlanSteps(req)
+	if s.routes != nil && !req.VIPOnly && req.Architecture != hadomain.ArchitectureStandalone && s.routes.ClusterRoutesConfigured(ctx, clusterID) {
+		plan.Steps = addArchitectureRouteSyncStep(plan.Steps)
+	}
 	return plan, nil
 }
 
@@ -280,6 +291,32 @@ func architectureCandidateScores(clusterID string, req hadomain.ArchitectureAdju
 	return out
 }
 
+// architectureRebuildSuggestions 找出目标角色为从库但实例未运行的节点：这类节点无法
+// 被重新挂载复制，应先走副本重建流程。
+func architectureRebuildSuggestions(clusterID string, req hadomain.ArchitectureAdjustmentRequest, scores []hadomain.CandidateScore) []hadomain.RebuildSuggestion {
+	if req.VIPOnly || req.Architecture == hadomain.ArchitectureStandalone {
+		return nil
+	}
+	roles := make(map[string]string, len(req.Nodes))
+	for _, node := range req.Nodes {
+		roles[node.MachineID] = strings.ToUpper(strings.TrimSpace(node.Role))
+	}
+	var out []hadomain.RebuildSuggestion
+	for _, score := range scores {
+		if roles[score.MachineID] != "S" || score.MachineID == req.CurrentMasterMachineID {
+			continue
+		}
+		for _, reason := range score.RejectReasons {
+			if reason == "instance is not running" {
+				out = append(out, hadomain.RebuildSuggestion{MachineID: score.MachineID, Port: score.Port, Reason: reason,
+					Endpoint: "/api/v1/clusters/" + clusterID + "/replicas/rebuild"})
+				break
+			}
+		}
+	}
+	return out
+}
+
 func architectureInstanceForNode(node hadomain.ArchitectureNodeRequest, instances []mysqlapp.Instance) (mysqlapp.Instance, bool) {
 	if node.Port > 0 {
 		for _, instance := range instances {
@@ -487,6 +524,28 @@ func reqVIPStepName(req hadomain.ArchitectureAdjustmentRequest) string {
 	return "漂移 VIP"
 }
 
+// addArchitectureRouteSyncStep 在恢复业务连接前刷新 ProxySQL 后端，确保业务
+// 解除冻结时代理层已经指向新主。
+func addArchitectureRouteSyncStep(items []hadomain.ArchitecturePlanStep) []hadomain.ArchitecturePlanStep {
+	step := hadomain.ArchitecturePlanStep{
+		Code: "sync_proxysql", Name: "同步 ProxySQL 路由", Description: "按新拓扑原子替换 ProxySQL 写/读主机组，可与 VIP 迁移并用或替代 VIP",
+	}
+	insertAt := len(items)
+	for _, code := range []string{"resume_business_connections", "release_lock"} {
+		if index := slices.IndexFunc(items, func(item hadomain.ArchitecturePlanStep) bool { return item.Code == code }); index >= 0 {
+			insertAt = index
+			break
+		}
+	}
+	items = append(items, hadomain.ArchitecturePlanStep{})
+	copy(items[insertAt+1:], items[insertAt:])
+	items[insertAt] = step
+	for index := range items {
+		items[index].Order = index + 1
+	}
+	return items
+}
+
 func addArchitectureManagementRepairStep(items []hadomain.ArchitecturePlanStep, req hadomain.ArchitectureAdjustmentRequest) []hadomain.ArchitecturePlanStep {
 	if strings.TrimSpace(req.RootPassword) == "" || len(req.RootPasswords) > 0 {
 		return items
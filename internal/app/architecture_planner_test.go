@@ -142,6 +142,22 @@ func TestPlanStandaloneArchitectureIsExecutableWithoutMasterElection(t *testing.
 	}
 }
 
+func TestPlanSuggestsRebuildForStoppedReplica(t *testing.T) {
+	machines := []machinedomain.Machine{{ID: "db-1", Name: "DB-01", IP: "10.0.0.1", Cluster: "demo"}, {ID: "db-2", Name: "DB-02", IP: "10.0.0.2", Cluster: "demo"}}
+	instances := []mysqlapp.Instance{{MachineID: "db-1", Port: 3306, ServerID: 1, Status: mysqlapp.StatusRunning}, {MachineID: "db-2", Port: 3306, ServerID: 2, Status: mysqlapp.StatusStopped}}
+	service := NewHAService(fakeHARepo{}, vipScopeMachineRepo{items: machines}, fakeArchitectureInstanceRepo{items: instances})
+	plan, err := service.PlanArchitectureAdjustment(context.Background(), "demo", hadomain.ArchitectureAdjustmentRequest{
+		Architecture: hadomain.ArchitectureMasterSlave,
+		Nodes:        []hadomain.ArchitectureNodeRequest{{MachineID: "db-1", Port: 3306, Role: "M"}, {MachineID: "db-2", Port: 3306, Role: "S", SourceMachineID: "db-1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Executable || len(plan.RebuildSuggestions) != 1 || plan.RebuildSuggestions[0].MachineID != "db-2" || plan.RebuildSuggestions[0].Endpoint != "/api/v1/clusters/demo/replicas/rebuild" {
+		t.Fatalf("stopped replica must block the plan with a rebuild suggestion: %+v", plan)
+	}
+}
+
 func TestValidateArchitectureRequestRejectsMixedIndependentReplicationRoles(t *testing.T) {
 	req := hadomain.ArchitectureAdjustmentRequest{
 		Architecture: hadomain.ArchitectureMasterSlave,
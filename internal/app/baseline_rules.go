@@ -0,0 +1,469 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	baselinedomain "gmha/internal/domain/baseline"
+	renderinfra "gmha/internal/infrastructure/render"
+	mysqlapp "gmha/internal/mysql"
+)
+
+// baselineSysctlFile is loaded after the installer's 99-gmha-mysql-<port>.conf
+// so a remediated value survives reboots even when the installer wrote another.
+const baselineSysctlFile = "/etc/sysctl.d/99-zz-gmha-baseline.conf"
+
+var (
+	baselineSysctlNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.\-]*$`)
+	baselineDevicePattern     = regexp.MustCompile(`^[A-Za-z0-9._\-]+$`)
+	baselineTokenPattern      = regexp.MustCompile(`^[A-Za-z0-9_.=+\-]+$`)
+)
+
+var baselineFixedKeys = map[string]string{
+	baselinedomain.FactTHPEnabled:     "透明大页 enabled",
+	baselinedomain.FactTHPDefrag:      "透明大页 defrag",
+	baselinedomain.FactNUMAInterleave: "mysqld NUMA interleave",
+	baselinedomain.FactIOScheduler:    "磁盘 I/O 调度器",
+	baselinedomain.FactUlimitNoFile:   "mysqld 打开文件数上限",
+	baselinedomain.FactUlimitNProc:    "mysqld 进程数上限",
+	baselinedomain.FactTimeSync:       "时间同步",
+	baselinedomain.FactSELinux:        "SELinux",
+	baselinedomain.FactFirewall:       "主机防火墙",
+	baselinedomain.FactMountOptions:   "数据目录挂载选项",
+	baselinedomain.FactMountFSType:    "数据目录文件系统",
+}
+
+// BuiltinBaselineProfile derives the sysctl expectations from the template the
+// MySQL installer applies, so a freshly installed host is compliant, and adds
+// the host settings the installer does not manage.
+func BuiltinBaselineProfile() baselinedomain.Profile {
+	openFiles := 65535
+	if profile, err := mysqlapp.LoadProfile("configs", "default"); err == nil && profile.OpenFilesLimit > 0 {
+		openFiles = profile.OpenFilesLimit
+	}
+	rules := builtinBaselineSysctlRules()
+	rules = append(rules,
+		baselinedomain.Rule{Key: baselinedomain.FactTHPEnabled, Operator: baselinedomain.OperatorEq, Expected: "never", Severity: "warning", Enabled: true, Description: "透明大页会造成 InnoDB 内存分配延迟抖动"},
+		baselinedomain.Rule{Key: baselinedomain.FactTHPDefrag, Operator: baselinedomain.OperatorEq, Expected: "never", Severity: "warning", Enabled: true, Description: "透明大页整理会阻塞内存分配"},
+		baselinedomain.Rule{Key: baselinedomain.FactNUMAInterleave, Operator: baselinedomain.OperatorEq, Expected: "true", Severity: "notice", Enabled: true, Description: "多 NUMA 节点主机上 mysqld 应交错分配内存，避免单节点内存耗尽触发 swap"},
+		baselinedomain.Rule{Key: baselinedomain.FactIOScheduler, Operator: baselinedomain.OperatorIn, Expected: "none,mq-deadline,deadline,noop", Severity: "notice", Enabled: true, Description: "数据库磁盘不使用 cfq/bfq 等公平调度器"},
+		baselinedomain.Rule{Key: baselinedomain.FactUlimitNoFile, Operator: baselinedomain.OperatorGe, Expected: strconv.Itoa(openFiles), Severity: "warning", Enabled: true, Description: "运行中 mysqld 的 Max open files"},
+		baselinedomain.Rule{Key: baselinedomain.FactUlimitNProc, Operator: baselinedomain.OperatorGe, Expected: "65536", Severity: "warning", Enabled: true, Description: "运行中 mysqld 的 Max processes"},
+		baselinedomain.Rule{Key: baselinedomain.FactTimeSync, Operator: baselinedomain.OperatorEq, Expected: "true", Severity: "warning", Enabled: true, Description: "时钟未同步会影响复制延迟判断和日志排查"},
+		baselinedomain.Rule{Key: baselinedomain.FactSELinux, Operator: baselinedomain.OperatorIn, Expected: "permissive,disabled", Severity: "warning", Enabled: true, Description: "enforcing 会拦截非默认路径的数据目录"},
+		baselinedomain.Rule{Key: baselinedomain.FactFirewall, Operator: baselinedomain.OperatorEq, Expected: "inactive", Severity: "notice", Enabled: true, Description: "主机防火墙需放行 MySQL、Agent 与 VIP 流量，GMHA 不管理其规则"},
+		baselinedomain.Rule{Key: baselinedomain.FactMountOptions, Operator: baselinedomain.OperatorContains, Expected: "noatime", Severity: "notice", Enabled: true, Description: "数据目录所在文件系统不更新访问时间"},
+		baselinedomain.Rule{Key: baselinedomain.FactMountFSType, Operator: baselinedomain.OperatorIn, Expected: "xfs,ext4", Severity: "notice", Enabled: true, Description: "数据目录所在文件系统类型"},
+	)
+	return baselinedomain.Profile{Source: baselinedomain.ProfileSourceBuiltin, Rules: rules}
+}
+
+func builtinBaselineSysctlRules() []baselinedomain.Rule {
+	swappiness := 1
+	if profile, err := mysqlapp.LoadProfile("configs", "default"); err == nil {
+		swappiness = profile.SysctlSwappiness
+	}
+	source, err := renderinfra.NewLoader("configs").LoadTemplate("mysql", "sysctl.conf.tmpl")
+	if err != nil {
+		source = []byte("vm.swappiness = {{ .SysctlSwappiness }}\n")
+	}
+	var rendered bytes.Buffer
+	tpl, err := template.New("baseline-sysctl").Parse(string(source))
+	if err == nil {
+		err = tpl.Execute(&rendered, struct{ SysctlSwappiness int }{swappiness})
+	}
+	if err != nil {
+		rendered.Reset()
+		fmt.Fprintf(&rendered, "vm.swappiness = %d\n", swappiness)
+	}
+	rules := make([]baselinedomain.Rule, 0)
+	for _, line := range strings.Split(rendered.String(), "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), baselineNormalize(value)
+		if !ok || name == "" || strings.HasPrefix(name, "#") || value == "" {
+			continue
+		}
+		operator := baselinedomain.OperatorEq
+		if _, numeric := baselineNumber(value); numeric && (strings.Contains(name, "max") || strings.Contains(name, "backlog") || strings.Contains(name, "min_free")) {
+			operator = baselinedomain.OperatorGe
+		}
+		rules = append(rules, baselinedomain.Rule{Key: baselinedomain.FactSysctlPrefix + name, Operator: operator, Expected: value, Severity: "warning", Enabled: true, Description: "MySQL 安装时写入的内核参数"})
+	}
+	return rules
+}
+
+// normalizeBaselineRules validates a profile submitted by a user.
+func normalizeBaselineRules(rules []baselinedomain.Rule) ([]baselinedomain.Rule, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("基线至少需要一条规则")
+	}
+	seen := make(map[string]bool, len(rules))
+	out := make([]baselinedomain.Rule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Key = strings.TrimSpace(rule.Key)
+		rule.Operator = strings.ToLower(strings.TrimSpace(rule.Operator))
+		rule.Expected = baselineNormalize(rule.Expected)
+		rule.Severity = strings.ToLower(strings.TrimSpace(rule.Severity))
+		rule.Description = strings.TrimSpace(rule.Description)
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+		if name, ok := strings.CutPrefix(rule.Key, baselinedomain.FactSysctlPrefix); ok {
+			if !baselineSysctlNamePattern.MatchString(name) {
+				return nil, fmt.Errorf("内核参数名 %q 无效", name)
+			}
+		} else if _, ok := baselineFixedKeys[rule.Key]; !ok {
+			return nil, fmt.Errorf("不支持的检查项 %q", rule.Key)
+		}
+		if seen[rule.Key] {
+			return nil, fmt.Errorf("检查项 %s 重复", rule.Key)
+		}
+		seen[rule.Key] = true
+		switch rule.Operator {
+		case baselinedomain.OperatorEq, baselinedomain.OperatorNe, baselinedomain.OperatorIn, baselinedomain.OperatorContains:
+		case baselinedomain.OperatorGe, baselinedomain.OperatorLe:
+			if _, ok := baselineNumber(rule.Expected); !ok {
+				return nil, fmt.Errorf("检查项 %s 使用 %s 时期望值必须是数字", rule.Key, rule.Operator)
+			}
+		default:
+			return nil, fmt.Errorf("检查项 %s 的运算符 %q 无效，可选 eq、ne、ge、le、in、contains", rule.Key, rule.Operator)
+		}
+		if rule.Expected == "" {
+			return nil, fmt.Errorf("检查项 %s 缺少期望值", rule.Key)
+		}
+		if strings.ContainsAny(rule.Expected, "\n'\"`$\\;|&<>") {
+			return nil, fmt.Errorf("检查项 %s 的期望值包含不允许的字符", rule.Key)
+		}
+		switch rule.Severity {
+		case "notice", "warning", "critical":
+		default:
+			return nil, fmt.Errorf("检查项 %s 的级别 %q 无效，可选 notice、warning、critical", rule.Key, rule.Severity)
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// evaluateBaseline checks every enabled rule against the facts. A rule on a
+// per-device or per-mount key yields one result for each reported target.
+func evaluateBaseline(rules []baselinedomain.Rule, facts map[string]string) []baselinedomain.CheckResult {
+	results := make([]baselinedomain.CheckResult, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		targets := make([]string, 0, 1)
+		if _, ok := facts[rule.Key]; ok {
+			targets = append(targets, "")
+		}
+		for key := range facts {
+			if target, ok := strings.CutPrefix(key, rule.Key+":"); ok && target != "" {
+				targets = append(targets, target)
+			}
+		}
+		sort.Strings(targets)
+		if len(targets) == 0 {
+			results = append(results, baselinedomain.CheckResult{
+				Key: rule.Key, Operator: rule.Operator, Expected: rule.Expected, Status: baselinedomain.StatusUnknown,
+				Severity: rule.Severity, Message: "Agent 未上报该项",
+			})
+			continue
+		}
+		for _, target := range targets {
+			key := rule.Key
+			if target != "" {
+				key += ":" + target
+			}
+			result := baselinedomain.CheckResult{
+				Key: rule.Key, Target: target, Operator: rule.Operator, Expected: rule.Expected,
+				Actual: baselineNormalize(facts[key]), Severity: rule.Severity,
+			}
+			result.Status, result.Message = compareBaseline(rule.Operator, rule.Expected, result.Actual)
+			result.Remediable = result.Status == baselinedomain.StatusFail && baselineRemediable(result)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func compareBaseline(operator, expected, actual string) (string, string) {
+	if actual == baselinedomain.FactNotApplicable {
+		return baselinedomain.StatusSkipped, "该项不适用于本机"
+	}
+	if actual == "" {
+		return baselinedomain.StatusUnknown, "Agent 无法读取该项"
+	}
+	pass := false
+	switch operator {
+	case baselinedomain.OperatorEq, baselinedomain.OperatorNe:
+		pass = actual == expected
+		if a, ok := baselineNumber(actual); ok {
+			if e, ok := baselineNumber(expected); ok {
+				pass = a == e
+			}
+		}
+		if operator == baselinedomain.OperatorNe {
+			pass = !pass
+		}
+	case baselinedomain.OperatorGe, baselinedomain.OperatorLe:
+		a, ok := baselineNumber(actual)
+		e, _ := baselineNumber(expected)
+		if !ok {
+			return baselinedomain.StatusUnknown, fmt.Sprintf("实际值 %q 不是数字", actual)
+		}
+		pass = a >= e
+		if operator == baselinedomain.OperatorLe {
+			pass = a <= e
+		}
+	case baselinedomain.OperatorIn:
+		pass = baselineListContains(baselineList(expected), actual)
+	case baselinedomain.OperatorContains:
+		items := baselineList(actual)
+		pass = true
+		for _, item := range baselineList(expected) {
+			pass = pass && baselineListContains(items, item)
+		}
+	}
+	if pass {
+		return baselinedomain.StatusPass, ""
+	}
+	return baselinedomain.StatusFail, fmt.Sprintf("期望 %s %s，实际 %s", operator, expected, actual)
+}
+
+// baselineRemediable reports whether remediation knows how to move the
+// setting to the expected value and keep it across reboots.
+func baselineRemediable(result baselinedomain.CheckResult) bool {
+	_, err := baselineRemediationCommand(result)
+	return err == nil
+}
+
+// baselineRemediationCommand returns an idempotent shell command that applies
+// the expected value now and persists it.
+func baselineRemediationCommand(result baselinedomain.CheckResult) (string, error) {
+	desired := result.Expected
+	switch result.Operator {
+	case baselinedomain.OperatorEq, baselinedomain.OperatorGe, baselinedomain.OperatorLe, baselinedomain.OperatorContains:
+	case baselinedomain.OperatorIn:
+		items := baselineList(result.Expected)
+		if len(items) == 0 {
+			return "", fmt.Errorf("检查项 %s 缺少期望值", result.Key)
+		}
+		desired = items[0]
+	default:
+		return "", fmt.Errorf("检查项 %s 使用 %s 运算符，无法自动修复", result.Key, result.Operator)
+	}
+	if name, ok := strings.CutPrefix(result.Key, baselinedomain.FactSysctlPrefix); ok {
+		if !baselineSysctlNamePattern.MatchString(name) {
+			return "", fmt.Errorf("内核参数名 %q 无效", name)
+		}
+		return baselineSysctlCommand(name, desired), nil
+	}
+	switch result.Key {
+	case baselinedomain.FactTHPEnabled, baselinedomain.FactTHPDefrag:
+		if result.Operator != baselinedomain.OperatorEq && result.Operator != baselinedomain.OperatorIn {
+			return "", fmt.Errorf("透明大页只支持 eq 或 in")
+		}
+		if !baselineListContains([]string{"always", "madvise", "never", "defer", "defer+madvise"}, desired) {
+			return "", fmt.Errorf("透明大页取值 %q 无效", desired)
+		}
+		return baselineTHPCommand(strings.TrimPrefix(result.Key, "thp."), desired), nil
+	case baselinedomain.FactIOScheduler:
+		if result.Operator != baselinedomain.OperatorEq && result.Operator != baselinedomain.OperatorIn {
+			return "", fmt.Errorf("I/O 调度器只支持 eq 或 in")
+		}
+		if !baselineDevicePattern.MatchString(result.Target) {
+			return "", fmt.Errorf("设备名 %q 无效", result.Target)
+		}
+		return baselineIOSchedulerCommand(result.Target, baselineList(result.Expected)), nil
+	case baselinedomain.FactUlimitNoFile, baselinedomain.FactUlimitNProc:
+		if result.Operator != baselinedomain.OperatorGe && result.Operator != baselinedomain.OperatorEq {
+			return "", fmt.Errorf("资源限制只支持 ge 或 eq")
+		}
+		directive := "LimitNOFILE"
+		if result.Key == baselinedomain.FactUlimitNProc {
+			directive = "LimitNPROC"
+		}
+		return baselineUlimitCommand(directive, desired), nil
+	case baselinedomain.FactTimeSync:
+		if desired != "true" {
+			return "", fmt.Errorf("只支持开启时间同步")
+		}
+		return "set -e\ntimedatectl set-ntp true\nsleep 2\ntimedatectl show -p NTP -p NTPSynchronized 2>/dev/null || timedatectl status", nil
+	case baselinedomain.FactSELinux:
+		if !baselineListContains([]string{"enforcing", "permissive", "disabled"}, desired) {
+			return "", fmt.Errorf("SELinux 取值 %q 无效", desired)
+		}
+		return baselineSELinuxCommand(desired), nil
+	case baselinedomain.FactMountOptions:
+		if result.Operator != baselinedomain.OperatorContains {
+			return "", fmt.Errorf("挂载选项只支持 contains")
+		}
+		if !strings.HasPrefix(result.Target, "/") || strings.ContainsAny(result.Target, " \t\n'\"\\") {
+			return "", fmt.Errorf("挂载点 %q 无效", result.Target)
+		}
+		options := baselineList(result.Expected)
+		for _, option := range options {
+			if !baselineTokenPattern.MatchString(option) {
+				return "", fmt.Errorf("挂载选项 %q 无效", option)
+			}
+		}
+		return baselineMountCommand(result.Target, options), nil
+	}
+	return "", fmt.Errorf("检查项 %s 需要人工处理", result.Key)
+}
+
+func baselineSysctlCommand(name, value string) string {
+	return strings.Join([]string{
+		"set -e",
+		"f=" + baselineSysctlFile,
+		`touch "$f"`,
+		fmt.Sprintf(`awk -F= -v k=%s '{x=$1; gsub(/[[:space:]]/,"",x)} x!=k' "$f" > "$f.tmp"`, shellQuote(name)),
+		fmt.Sprintf(`printf '%%s = %%s\n' %s %s >> "$f.tmp"`, shellQuote(name), shellQuote(value)),
+		`mv "$f.tmp" "$f"`,
+		"sysctl -w " + shellQuote(name+"="+value),
+	}, "\n")
+}
+
+func baselineTHPCommand(setting, value string) string {
+	path := "/sys/kernel/mm/transparent_hugepage/" + setting
+	unit := "gmha-thp-" + setting + ".service"
+	return strings.Join([]string{
+		"set -e",
+		fmt.Sprintf("cat > /etc/systemd/system/%s <<'EOF'", unit),
+		"[Unit]",
+		fmt.Sprintf("Description=GMHA baseline: transparent_hugepage %s=%s", setting, value),
+		"DefaultDependencies=no",
+		"After=sysinit.target local-fs.target",
+		"Before=basic.target",
+		"",
+		"[Service]",
+		"Type=oneshot",
+		fmt.Sprintf("ExecStart=/bin/sh -c 'echo %s > %s'", value, path),
+		"",
+		"[Install]",
+		"WantedBy=basic.target",
+		"EOF",
+		"systemctl daemon-reload",
+		"systemctl enable " + unit,
+		fmt.Sprintf("echo %s > %s", value, path),
+		"cat " + path,
+	}, "\n")
+}
+
+func baselineIOSchedulerCommand(device string, candidates []string) string {
+	quoted := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		quoted = append(quoted, shellQuote(candidate))
+	}
+	file := "/sys/block/" + device + "/queue/scheduler"
+	return strings.Join([]string{
+		"set -e",
+		"file=" + shellQuote(file),
+		"choice=''",
+		fmt.Sprintf(`for s in %s; do if tr -d '[]' < "$file" | tr ' ' '\n' | grep -qx -- "$s"; then choice=$s; break; fi; done`, strings.Join(quoted, " ")),
+		fmt.Sprintf(`[ -n "$choice" ] || { echo %s; exit 1; }`, shellQuote("设备 "+device+" 不支持期望的调度器")),
+		"rules=/etc/udev/rules.d/60-gmha-io-scheduler.rules",
+		`touch "$rules"`,
+		fmt.Sprintf(`grep -v 'KERNEL=="%s"' "$rules" > "$rules.tmp" || true`, device),
+		fmt.Sprintf(`printf 'ACTION=="add|change", KERNEL=="%s", ATTR{queue/scheduler}="%%s"\n' "$choice" >> "$rules.tmp"`, device),
+		`mv "$rules.tmp" "$rules"`,
+		`echo "$choice" > "$file"`,
+		`echo "` + device + `: $choice"`,
+	}, "\n")
+}
+
+func baselineUlimitCommand(directive, value string) string {
+	return strings.Join([]string{
+		"set -e",
+		`units=$(systemctl list-unit-files --no-legend 'mysqld*.service' | awk '{print $1}')`,
+		fmt.Sprintf(`[ -n "$units" ] || { echo %s; exit 1; }`, shellQuote("未找到 mysqld systemd 单元")),
+		`for u in $units; do`,
+		`  d=/etc/systemd/system/$u.d; f=$d/gmha-baseline-limits.conf; mkdir -p "$d"; touch "$f"`,
+		fmt.Sprintf(`  grep -v -e '^%s=' -e '^\[Service\]' "$f" > "$f.tmp" || true`, directive),
+		fmt.Sprintf(`  { echo '[Service]'; cat "$f.tmp"; echo %s; } > "$f"; rm -f "$f.tmp"`, shellQuote(directive+"="+value)),
+		fmt.Sprintf(`  echo "$u: %s=%s"`, directive, value),
+		`done`,
+		"systemctl daemon-reload",
+		"echo " + shellQuote("重启对应 MySQL 实例后生效"),
+	}, "\n")
+}
+
+func baselineSELinuxCommand(mode string) string {
+	lines := []string{"set -e"}
+	if mode == "enforcing" {
+		lines = append(lines, "setenforce 1")
+	} else {
+		lines = append(lines, "setenforce 0 2>/dev/null || true")
+	}
+	lines = append(lines,
+		fmt.Sprintf(`if [ -f /etc/selinux/config ]; then sed -i 's/^SELINUX=.*/SELINUX=%s/' /etc/selinux/config; fi`, mode),
+		"getenforce 2>/dev/null || true",
+	)
+	if mode == "disabled" {
+		lines = append(lines, "echo "+shellQuote("当前为 permissive，重启主机后完全关闭"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func baselineMountCommand(mountPoint string, options []string) string {
+	joined := strings.Join(options, ",")
+	return strings.Join([]string{
+		"set -e",
+		`cp /etc/fstab "/etc/fstab.gmha-$(date +%Y%m%d%H%M%S).bak"`,
+		fmt.Sprintf(`awk -v mp=%s -v add=%s 'BEGIN{n=split(add,a,",")} $1 !~ /^#/ && $2==mp {found=1; for(i=1;i<=n;i++) if (("," $4 ",") !~ ("," a[i] ",")) $4=$4 "," a[i]} {print} END{if(!found) exit 3}' /etc/fstab > /etc/fstab.gmha.tmp || { rc=$?; rm -f /etc/fstab.gmha.tmp; if [ "$rc" -eq 3 ]; then echo %s; fi; exit 1; }`,
+			shellQuote(mountPoint), shellQuote(joined), shellQuote("/etc/fstab 中没有挂载点 "+mountPoint+"，修改无法持久化")),
+		"mv /etc/fstab.gmha.tmp /etc/fstab",
+		fmt.Sprintf("mount -o %s %s", shellQuote("remount,"+joined), shellQuote(mountPoint)),
+		"findmnt -no OPTIONS " + shellQuote(mountPoint) + " 2>/dev/null || true",
+	}, "\n")
+}
+
+func baselineSysctlKeys(rules []baselinedomain.Rule) []string {
+	keys := make([]string, 0)
+	for _, rule := range rules {
+		if name, ok := strings.CutPrefix(rule.Key, baselinedomain.FactSysctlPrefix); ok && rule.Enabled {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func baselineNormalize(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func baselineList(value string) []string {
+	out := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func baselineListContains(items []string, value string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// baselineNumber parses numeric facts; "unlimited" limits compare as +Inf.
+func baselineNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "unlimited") || strings.EqualFold(value, "infinity") {
+		return math.Inf(1), true
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return number, err == nil
+}
@@ -0,0 +1,451 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	baselinedomain "gmha/internal/domain/baseline"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+)
+
+const (
+	baselineAlertRuleID = "os_baseline"
+	// BaselineReportInterval is how often the Agent collects host facts; a
+	// host that has not reported for baselineStaleAfter is shown as stale and
+	// cannot be remediated until it reports again.
+	BaselineReportInterval     = 10 * time.Minute
+	baselineStaleAfter         = 3 * BaselineReportInterval
+	baselineHistoryRetention   = 90 * 24 * time.Hour
+	baselineHistoryMaxInterval = 24 * time.Hour
+	baselineMaxFacts           = 2000
+	baselineMaxFactBytes       = 1024
+)
+
+var (
+	ErrBaselineReportInvalid      = errors.New("基线报告无效")
+	ErrBaselineRemediationRunning = errors.New("该主机已有基线修复任务在执行")
+)
+
+type baselineTasks interface {
+	CreateExecTaskWithOptions(context.Context, string, string, ExecTaskOptions) (TaskDetail, error)
+	GetTaskDetail(context.Context, string) (TaskDetail, error)
+}
+
+// BaselineService evaluates the host facts reported by Agents against the OS
+// baseline of their cluster, keeps the latest result of every host with a
+// change history, raises an alert per failing check and remediates failures
+// through Agent exec tasks.
+type BaselineService struct {
+	repo     baselinedomain.Repository
+	machines machinedomain.Repository
+	tasks    baselineTasks
+	alerts   *AlertService
+	builtin  baselinedomain.Profile
+
+	mu          sync.Mutex
+	remediating map[string]string
+	purgedAt    time.Time
+}
+
+type BaselineRemediationRequest struct {
+	MachineID string   `json:"machine_id"`
+	Checks    []string `json:"checks"`
+	Confirm   string   `json:"confirm"`
+}
+
+type BaselineRemediationResult struct {
+	TaskID string                       `json:"task_id"`
+	Checks []baselinedomain.CheckResult `json:"checks"`
+}
+
+func NewBaselineService(repo baselinedomain.Repository, machines machinedomain.Repository, tasks baselineTasks) *BaselineService {
+	return &BaselineService{repo: repo, machines: machines, tasks: tasks, builtin: BuiltinBaselineProfile(), remediating: make(map[string]string)}
+}
+
+// SetAlertService enables alerts for failing baseline checks.
+func (s *BaselineService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+// Profile returns the baseline that applies to the cluster: its own profile,
+// else the stored default, else the built-in profile.
+func (s *BaselineService) Profile(ctx context.Context, cluster string) (baselinedomain.Profile, error) {
+	cluster = strings.TrimSpace(cluster)
+	if cluster != "" {
+		profile, ok, err := s.repo.GetProfile(ctx, cluster)
+		if err != nil || ok {
+			profile.Source = baselinedomain.ProfileSourceCluster
+			return profile, err
+		}
+	}
+	profile, ok, err := s.repo.GetProfile(ctx, "")
+	if err != nil {
+		return baselinedomain.Profile{}, err
+	}
+	if ok {
+		profile.Source = baselinedomain.ProfileSourceDefault
+	} else {
+		profile = s.builtin
+	}
+	profile.Cluster = cluster
+	return profile, nil
+}
+
+// Profiles lists the stored profiles; the built-in one comes first.
+func (s *BaselineService) Profiles(ctx context.Context) ([]baselinedomain.Profile, error) {
+	stored, err := s.repo.ListProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := []baselinedomain.Profile{s.builtin}
+	for _, profile := range stored {
+		profile.Source = baselinedomain.ProfileSourceCluster
+		if profile.Cluster == "" {
+			profile.Source = baselinedomain.ProfileSourceDefault
+		}
+		out = append(out, profile)
+	}
+	return out, nil
+}
+
+// SaveProfile stores the baseline of a cluster, or the default baseline when
+// cluster is empty, and re-evaluates the affected hosts immediately.
+func (s *BaselineService) SaveProfile(ctx context.Context, cluster string, rules []baselinedomain.Rule, actor string) (baselinedomain.Profile, error) {
+	normalized, err := normalizeBaselineRules(rules)
+	if err != nil {
+		return baselinedomain.Profile{}, err
+	}
+	profile := baselinedomain.Profile{Cluster: strings.TrimSpace(cluster), Rules: normalized, UpdatedBy: strings.TrimSpace(actor), UpdatedAt: time.Now().UTC()}
+	if err := s.repo.SaveProfile(ctx, profile); err != nil {
+		return baselinedomain.Profile{}, err
+	}
+	s.reevaluate(ctx, profile.Cluster)
+	return s.Profile(ctx, profile.Cluster)
+}
+
+// ResetProfile removes a stored profile so the cluster falls back to the
+// default baseline, or the default falls back to the built-in one.
+func (s *BaselineService) ResetProfile(ctx context.Context, cluster string) error {
+	cluster = strings.TrimSpace(cluster)
+	if err := s.repo.DeleteProfile(ctx, cluster); err != nil {
+		return err
+	}
+	s.reevaluate(ctx, cluster)
+	return nil
+}
+
+// Ingest evaluates a report from an Agent. Facts are stored with the latest
+// state so a profile change can be re-evaluated without waiting for Agents.
+func (s *BaselineService) Ingest(ctx context.Context, report baselinedomain.Report) (baselinedomain.ReportResponse, error) {
+	report.MachineID = strings.TrimSpace(report.MachineID)
+	if report.MachineID == "" {
+		return baselinedomain.ReportResponse{}, fmt.Errorf("%w：缺少 machine_id", ErrBaselineReportInvalid)
+	}
+	if len(report.Facts) > baselineMaxFacts {
+		return baselinedomain.ReportResponse{}, fmt.Errorf("%w：单次最多 %d 项", ErrBaselineReportInvalid, baselineMaxFacts)
+	}
+	facts := make(map[string]string, len(report.Facts))
+	for key, value := range report.Facts {
+		if key = strings.TrimSpace(key); key == "" || len(key) > 255 {
+			continue
+		}
+		if len(value) > baselineMaxFactBytes {
+			value = value[:baselineMaxFactBytes]
+		}
+		facts[key] = baselineNormalize(value)
+	}
+	machine, ok, err := s.machines.GetByID(ctx, report.MachineID)
+	if err != nil {
+		return baselinedomain.ReportResponse{}, err
+	}
+	if !ok {
+		return baselinedomain.ReportResponse{}, fmt.Errorf("%w：机器 %s 未纳管", ErrBaselineReportInvalid, report.MachineID)
+	}
+	profile, err := s.Profile(ctx, machine.Cluster)
+	if err != nil {
+		return baselinedomain.ReportResponse{}, err
+	}
+	errs := report.Errors
+	if len(errs) > 20 {
+		errs = errs[:20]
+	}
+	state, err := s.store(ctx, machine, profile, facts, errs, time.Now().UTC())
+	if err != nil {
+		return baselinedomain.ReportResponse{}, err
+	}
+	s.purge(ctx)
+	return baselinedomain.ReportResponse{Status: state.Status, Failed: state.Failed, SysctlKeys: baselineSysctlKeys(profile.Rules)}, nil
+}
+
+// Hosts lists the latest state of every host without the raw facts. States
+// of machines that were removed from the Manager are dropped on the way.
+func (s *BaselineService) Hosts(ctx context.Context, cluster string) ([]baselinedomain.HostState, error) {
+	states, err := s.repo.ListHostStates(ctx, strings.TrimSpace(cluster))
+	if err != nil {
+		return nil, err
+	}
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(machines))
+	for _, machine := range machines {
+		known[machine.ID] = true
+	}
+	now := time.Now().UTC()
+	out := make([]baselinedomain.HostState, 0, len(states))
+	for _, state := range states {
+		if !known[state.MachineID] {
+			_ = s.repo.DeleteHostState(ctx, state.MachineID)
+			continue
+		}
+		state.Facts = nil
+		state.Stale = now.Sub(state.CollectedAt) > baselineStaleAfter
+		out = append(out, state)
+	}
+	return out, nil
+}
+
+// Host returns the latest state of one host including the raw facts.
+func (s *BaselineService) Host(ctx context.Context, machineID string) (baselinedomain.HostState, error) {
+	state, ok, err := s.repo.GetHostState(ctx, strings.TrimSpace(machineID))
+	if err != nil {
+		return baselinedomain.HostState{}, err
+	}
+	if !ok {
+		return baselinedomain.HostState{}, fmt.Errorf("机器 %s 还没有基线报告", machineID)
+	}
+	state.Stale = time.Since(state.CollectedAt) > baselineStaleAfter
+	return state, nil
+}
+
+// History lists the evaluations in which a result of the host changed, plus
+// at least one a day, newest first.
+func (s *BaselineService) History(ctx context.Context, machineID string, limit int) ([]baselinedomain.HostState, error) {
+	return s.repo.ListHistory(ctx, strings.TrimSpace(machineID), limit)
+}
+
+// Remediate starts an Agent task that fixes the selected failing checks of a
+// host, one step per check. Only checks that failed in a fresh report and
+// that remediation knows how to persist are accepted, confirm must name the
+// host, and a host runs at most one remediation at a time.
+func (s *BaselineService) Remediate(ctx context.Context, req BaselineRemediationRequest) (BaselineRemediationResult, error) {
+	if s.tasks == nil {
+		return BaselineRemediationResult{}, errors.New("task service is not configured")
+	}
+	state, err := s.Host(ctx, req.MachineID)
+	if err != nil {
+		return BaselineRemediationResult{}, err
+	}
+	if state.Stale {
+		return BaselineRemediationResult{}, fmt.Errorf("机器 %s 的基线报告已超过 %s 未更新，请确认 Agent 在线后重试", state.MachineName, baselineStaleAfter)
+	}
+	confirm := strings.TrimSpace(req.Confirm)
+	if confirm == "" || (confirm != state.MachineName && confirm != state.MachineIP && confirm != state.MachineID) {
+		return BaselineRemediationResult{}, fmt.Errorf("confirm 必须填写机器名 %s 或 IP %s", state.MachineName, state.MachineIP)
+	}
+	available := make(map[string]baselinedomain.CheckResult)
+	for _, result := range state.Results {
+		if result.Status == baselinedomain.StatusFail && result.Remediable {
+			available[baselineCheckID(result)] = result
+		}
+	}
+	selected := make([]baselinedomain.CheckResult, 0)
+	if len(req.Checks) == 0 {
+		for _, result := range available {
+			selected = append(selected, result)
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, id := range req.Checks {
+			id = strings.TrimSpace(id)
+			result, ok := available[id]
+			if !ok {
+				return BaselineRemediationResult{}, fmt.Errorf("检查项 %s 当前未失败或不支持自动修复", id)
+			}
+			if !seen[id] {
+				seen[id] = true
+				selected = append(selected, result)
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return BaselineRemediationResult{}, errors.New("没有可自动修复的失败检查项")
+	}
+	sort.Slice(selected, func(i, j int) bool { return baselineCheckID(selected[i]) < baselineCheckID(selected[j]) })
+	commands := make([]taskdomain.ExecCommandStep, 0, len(selected))
+	for _, result := range selected {
+		command, err := baselineRemediationCommand(result)
+		if err != nil {
+			return BaselineRemediationResult{}, err
+		}
+		commands = append(commands, taskdomain.ExecCommandStep{Name: "修复 " + baselineCheckID(result), Command: command})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if taskID := s.remediating[state.MachineID]; taskID != "" {
+		detail, err := s.tasks.GetTaskDetail(ctx, taskID)
+		if err == nil && detail.Task.Status != taskdomain.StatusSuccess && detail.Task.Status != taskdomain.StatusFailed {
+			return BaselineRemediationResult{TaskID: taskID}, fmt.Errorf("%w：%s", ErrBaselineRemediationRunning, taskID)
+		}
+	}
+	detail, err := s.tasks.CreateExecTaskWithOptions(ctx, state.MachineIP, "", ExecTaskOptions{
+		Operation: "os_baseline_remediate", DisplayName: "修复主机基线 " + state.MachineName,
+		Commands: commands, TaskType: taskdomain.TypeExec,
+	})
+	if err != nil {
+		return BaselineRemediationResult{}, err
+	}
+	s.remediating[state.MachineID] = detail.Task.ID
+	return BaselineRemediationResult{TaskID: detail.Task.ID, Checks: selected}, nil
+}
+
+func (s *BaselineService) store(ctx context.Context, machine machinedomain.Machine, profile baselinedomain.Profile, facts map[string]string, errs []string, collectedAt time.Time) (baselinedomain.HostState, error) {
+	previous, hadPrevious, err := s.repo.GetHostState(ctx, machine.ID)
+	if err != nil {
+		return baselinedomain.HostState{}, err
+	}
+	state := baselinedomain.HostState{
+		ID: fmt.Sprintf("baseline-%s-%d", machine.ID, collectedAt.UnixNano()), Cluster: machine.Cluster,
+		MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP, ProfileSource: profile.Source,
+		Results: evaluateBaseline(profile.Rules, facts), Facts: facts, Errors: errs, CollectedAt: collectedAt,
+	}
+	summarizeBaselineState(&state)
+	appendHistory := !hadPrevious || previous.Fingerprint != state.Fingerprint
+	if !appendHistory {
+		last, ok, err := s.repo.LastHistoryAt(ctx, machine.ID)
+		if err != nil {
+			return baselinedomain.HostState{}, err
+		}
+		appendHistory = !ok || collectedAt.Sub(last) >= baselineHistoryMaxInterval
+	}
+	if err := s.repo.SaveHostState(ctx, state, appendHistory); err != nil {
+		return baselinedomain.HostState{}, err
+	}
+	s.signal(ctx, previous, state)
+	return state, nil
+}
+
+// reevaluate applies a changed profile to the stored facts of the hosts it
+// covers. A default profile change skips clusters that have their own.
+func (s *BaselineService) reevaluate(ctx context.Context, cluster string) {
+	states, err := s.repo.ListHostStates(ctx, cluster)
+	if err != nil {
+		log.Printf("baseline: list hosts: %v", err)
+		return
+	}
+	for _, state := range states {
+		profile, err := s.Profile(ctx, state.Cluster)
+		if err != nil {
+			log.Printf("baseline: profile %s: %v", state.Cluster, err)
+			return
+		}
+		if cluster == "" && profile.Source == baselinedomain.ProfileSourceCluster {
+			continue
+		}
+		machine := machinedomain.Machine{ID: state.MachineID, Name: state.MachineName, IP: state.MachineIP, Cluster: state.Cluster}
+		if _, err := s.store(ctx, machine, profile, state.Facts, state.Errors, state.CollectedAt); err != nil {
+			log.Printf("baseline: re-evaluate %s: %v", state.MachineID, err)
+		}
+	}
+}
+
+// signal raises one alert per failing check and resolves the alerts of checks
+// that pass now or are no longer part of the profile. Unknown results keep
+// the previous alert state, so a check that went from failing to unknown may
+// still have an open alert and is resolved like a failing one.
+func (s *BaselineService) signal(ctx context.Context, previous, current baselinedomain.HostState) {
+	if s.alerts == nil {
+		return
+	}
+	now := make(map[string]baselinedomain.CheckResult, len(current.Results))
+	for _, result := range current.Results {
+		now[baselineCheckID(result)] = result
+		if result.Status != baselinedomain.StatusFail {
+			continue
+		}
+		signal := baselineSignal(current, result)
+		signal.Severity = alertdomain.Severity(result.Severity)
+		signal.Value = 1
+		signal.Message = fmt.Sprintf("主机 %s（%s）基线检查 %s 不合规：%s", current.MachineName, current.MachineIP, baselineCheckID(result), result.Message)
+		_ = s.alerts.RaiseSignal(ctx, signal)
+	}
+	for _, result := range previous.Results {
+		if result.Status != baselinedomain.StatusFail && result.Status != baselinedomain.StatusUnknown {
+			continue
+		}
+		if latest, ok := now[baselineCheckID(result)]; ok && (latest.Status == baselinedomain.StatusFail || latest.Status == baselinedomain.StatusUnknown) {
+			continue
+		}
+		_ = s.alerts.ResolveSignal(ctx, baselineSignal(previous, result))
+	}
+}
+
+func baselineSignal(state baselinedomain.HostState, result baselinedomain.CheckResult) AlertSignal {
+	return AlertSignal{
+		RuleID: baselineAlertRuleID, RuleName: "主机基线不合规", Metric: "os_baseline_check", Category: "baseline",
+		MachineID: state.MachineID, MachineName: state.MachineName, MachineIP: state.MachineIP, ClusterID: state.Cluster,
+		Labels:    map[string]string{"cluster": state.Cluster, "check": result.Key, "target": result.Target},
+		Threshold: 0, Operator: ">",
+	}
+}
+
+func (s *BaselineService) purge(ctx context.Context) {
+	s.mu.Lock()
+	due := time.Since(s.purgedAt) >= 24*time.Hour
+	if due {
+		s.purgedAt = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	if _, err := s.repo.PurgeHistory(ctx, time.Now().UTC().Add(-baselineHistoryRetention)); err != nil {
+		log.Printf("baseline: purge history: %v", err)
+	}
+}
+
+func summarizeBaselineState(state *baselinedomain.HostState) {
+	parts := make([]string, 0, len(state.Results))
+	for _, result := range state.Results {
+		switch result.Status {
+		case baselinedomain.StatusPass:
+			state.Passed++
+		case baselinedomain.StatusFail:
+			state.Failed++
+		case baselinedomain.StatusUnknown:
+			state.Unknown++
+		case baselinedomain.StatusSkipped:
+			state.Skipped++
+		}
+		parts = append(parts, baselineCheckID(result)+"="+result.Status+"="+result.Actual)
+	}
+	sort.Strings(parts)
+	state.Fingerprint = stableID(parts...)
+	switch {
+	case state.Failed > 0:
+		state.Status = baselinedomain.StatusFail
+	case state.Passed == 0 && state.Unknown > 0:
+		state.Status = baselinedomain.StatusUnknown
+	default:
+		state.Status = baselinedomain.StatusPass
+	}
+}
+
+// baselineCheckID identifies a check on a host: the rule key plus the device
+// or mount point for per-target rules, e.g. "io.scheduler:sda".
+func baselineCheckID(result baselinedomain.CheckResult) string {
+	if result.Target == "" {
+		return result.Key
+	}
+	return result.Key + ":" + result.Target
+}
@@ -0,0 +1,351 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	baselinedomain "gmha/internal/domain/baseline"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+)
+
+type baselineMemoryRepo struct {
+	profiles map[string]baselinedomain.Profile
+	states   map[string]baselinedomain.HostState
+	history  []baselinedomain.HostState
+}
+
+func newBaselineMemoryRepo() *baselineMemoryRepo {
+	return &baselineMemoryRepo{profiles: map[string]baselinedomain.Profile{}, states: map[string]baselinedomain.HostState{}}
+}
+
+func (r *baselineMemoryRepo) GetProfile(_ context.Context, cluster string) (baselinedomain.Profile, bool, error) {
+	profile, ok := r.profiles[cluster]
+	return profile, ok, nil
+}
+
+func (r *baselineMemoryRepo) SaveProfile(_ context.Context, profile baselinedomain.Profile) error {
+	r.profiles[profile.Cluster] = profile
+	return nil
+}
+
+func (r *baselineMemoryRepo) DeleteProfile(_ context.Context, cluster string) error {
+	delete(r.profiles, cluster)
+	return nil
+}
+
+func (r *baselineMemoryRepo) ListProfiles(context.Context) ([]baselinedomain.Profile, error) {
+	out := make([]baselinedomain.Profile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		out = append(out, profile)
+	}
+	return out, nil
+}
+
+func (r *baselineMemoryRepo) GetHostState(_ context.Context, machineID string) (baselinedomain.HostState, bool, error) {
+	state, ok := r.states[machineID]
+	return state, ok, nil
+}
+
+func (r *baselineMemoryRepo) SaveHostState(_ context.Context, state baselinedomain.HostState, appendHistory bool) error {
+	r.states[state.MachineID] = state
+	if appendHistory {
+		state.Facts = nil
+		r.history = append(r.history, state)
+	}
+	return nil
+}
+
+func (r *baselineMemoryRepo) ListHostStates(_ context.Context, cluster string) ([]baselinedomain.HostState, error) {
+	out := make([]baselinedomain.HostState, 0)
+	for _, state := range r.states {
+		if cluster == "" || state.Cluster == cluster {
+			out = append(out, state)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MachineID < out[j].MachineID })
+	return out, nil
+}
+
+func (r *baselineMemoryRepo) DeleteHostState(_ context.Context, machineID string) error {
+	delete(r.states, machineID)
+	return nil
+}
+
+func (r *baselineMemoryRepo) ListHistory(_ context.Context, machineID string, _ int) ([]baselinedomain.HostState, error) {
+	out := make([]baselinedomain.HostState, 0)
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if r.history[i].MachineID == machineID {
+			out = append(out, r.history[i])
+		}
+	}
+	return out, nil
+}
+
+func (r *baselineMemoryRepo) LastHistoryAt(_ context.Context, machineID string) (time.Time, bool, error) {
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if r.history[i].MachineID == machineID {
+			return r.history[i].CollectedAt, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+func (r *baselineMemoryRepo) PurgeHistory(context.Context, time.Time) (int64, error) { return 0, nil }
+
+type baselineTaskFake struct {
+	tasks    map[string]taskdomain.Task
+	commands [][]taskdomain.ExecCommandStep
+}
+
+func (f *baselineTaskFake) CreateExecTaskWithOptions(_ context.Context, _, _ string, opts ExecTaskOptions) (TaskDetail, error) {
+	task := taskdomain.Task{ID: fmt.Sprintf("task-%d", len(f.commands)+1), Status: taskdomain.StatusRunning}
+	f.tasks[task.ID] = task
+	f.commands = append(f.commands, opts.Commands)
+	return TaskDetail{Task: task}, nil
+}
+
+func (f *baselineTaskFake) GetTaskDetail(_ context.Context, id string) (TaskDetail, error) {
+	return TaskDetail{Task: f.tasks[id]}, nil
+}
+
+func newBaselineTestService(t *testing.T) (*BaselineService, *baselineMemoryRepo, *alertMemoryRepo, *baselineTaskFake) {
+	t.Helper()
+	repo := newBaselineMemoryRepo()
+	alertRepo := newAlertMemoryRepo()
+	tasks := &baselineTaskFake{tasks: map[string]taskdomain.Task{}}
+	service := NewBaselineService(repo, &schemaMachineRepo{items: map[string]machinedomain.Machine{
+		"m1": {ID: "m1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+	}}, tasks)
+	service.SetAlertService(NewAlertService(alertRepo))
+	_, err := service.SaveProfile(context.Background(), "orders", []baselinedomain.Rule{
+		{Key: "sysctl.vm.swappiness", Operator: "eq", Expected: "1", Severity: "warning", Enabled: true},
+		{Key: "thp.enabled", Operator: "eq", Expected: "never", Enabled: true},
+		{Key: "io.scheduler", Operator: "in", Expected: "none, mq-deadline", Severity: "notice", Enabled: true},
+		{Key: "numa.interleave", Operator: "eq", Expected: "true", Enabled: true},
+		{Key: "firewall", Operator: "eq", Expected: "inactive", Enabled: true},
+		{Key: "time.sync", Operator: "eq", Expected: "true", Enabled: true},
+	}, "dba")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, repo, alertRepo, tasks
+}
+
+func baselineFiring(alertRepo *alertMemoryRepo) []string {
+	out := make([]string, 0)
+	for _, event := range alertRepo.events {
+		if event.Status == "firing" {
+			out = append(out, event.Labels["check"]+":"+event.Labels["target"])
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestBaselineServiceEvaluatesReportsAndAlertsPerCheck(t *testing.T) {
+	ctx := context.Background()
+	service, repo, alertRepo, _ := newBaselineTestService(t)
+
+	response, err := service.Ingest(ctx, baselinedomain.Report{MachineID: "m1", Facts: map[string]string{
+		"sysctl.vm.swappiness": "60", "thp.enabled": "never", "io.scheduler:sda": "bfq", "io.scheduler:sdb": "mq-deadline",
+		"numa.interleave": "n/a", "firewall": "active",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != baselinedomain.StatusFail || response.Failed != 3 || strings.Join(response.SysctlKeys, ",") != "vm.swappiness" {
+		t.Fatalf("response = %+v", response)
+	}
+	state := repo.states["m1"]
+	if state.Passed != 2 || state.Skipped != 1 || state.Unknown != 1 || state.Cluster != "orders" || state.ProfileSource != baselinedomain.ProfileSourceCluster {
+		t.Fatalf("state = %+v", state)
+	}
+	byID := map[string]baselinedomain.CheckResult{}
+	for _, result := range state.Results {
+		byID[baselineCheckID(result)] = result
+	}
+	if !byID["sysctl.vm.swappiness"].Remediable || !byID["io.scheduler:sda"].Remediable || byID["firewall"].Remediable {
+		t.Fatalf("remediable flags = %+v", byID)
+	}
+	if got := strings.Join(baselineFiring(alertRepo), ","); got != "firewall:,io.scheduler:sda,sysctl.vm.swappiness:" {
+		t.Fatalf("firing = %s", got)
+	}
+
+	// The same result does not grow the history; a change does, and fixed
+	// checks resolve their alerts while unknown ones keep them.
+	if _, err := service.Ingest(ctx, baselinedomain.Report{MachineID: "m1", Facts: repo.states["m1"].Facts}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.history) != 1 {
+		t.Fatalf("history = %d", len(repo.history))
+	}
+	if _, err := service.Ingest(ctx, baselinedomain.Report{MachineID: "m1", Facts: map[string]string{
+		"sysctl.vm.swappiness": "1", "thp.enabled": "never", "io.scheduler:sda": "none", "io.scheduler:sdb": "mq-deadline",
+		"numa.interleave": "n/a", "time.sync": "true",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.history) != 2 || repo.history[1].Facts != nil {
+		t.Fatalf("history = %+v", repo.history)
+	}
+	if got := strings.Join(baselineFiring(alertRepo), ","); got != "firewall:" {
+		t.Fatalf("firing after fix = %s", got)
+	}
+
+	// A profile change re-evaluates the stored facts without a new report.
+	if _, err := service.SaveProfile(ctx, "orders", []baselinedomain.Rule{
+		{Key: "sysctl.vm.swappiness", Operator: "le", Expected: "10", Enabled: true},
+	}, "dba"); err != nil {
+		t.Fatal(err)
+	}
+	if state := repo.states["m1"]; state.Status != baselinedomain.StatusPass || len(state.Results) != 1 {
+		t.Fatalf("re-evaluated state = %+v", state)
+	}
+	if got := baselineFiring(alertRepo); len(got) != 0 {
+		t.Fatalf("removed checks must resolve, firing = %v", got)
+	}
+
+	if _, err := service.Ingest(ctx, baselinedomain.Report{MachineID: "unknown", Facts: map[string]string{}}); !errors.Is(err, ErrBaselineReportInvalid) {
+		t.Fatalf("unknown machine err = %v", err)
+	}
+}
+
+func TestBaselineServiceProfileFallsBackToDefaultAndBuiltin(t *testing.T) {
+	ctx := context.Background()
+	service, _, _, _ := newBaselineTestService(t)
+	profile, err := service.Profile(ctx, "billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Source != baselinedomain.ProfileSourceBuiltin || profile.Cluster != "billing" {
+		t.Fatalf("profile = %+v", profile)
+	}
+	found := false
+	for _, rule := range profile.Rules {
+		found = found || (rule.Key == "sysctl.vm.swappiness" && rule.Operator == "eq")
+	}
+	if !found {
+		t.Fatalf("builtin profile must check the installer swappiness: %+v", profile.Rules)
+	}
+	if _, err := service.SaveProfile(ctx, "", []baselinedomain.Rule{{Key: "selinux", Operator: "eq", Expected: "disabled", Enabled: true}}, "dba"); err != nil {
+		t.Fatal(err)
+	}
+	if profile, _ := service.Profile(ctx, "billing"); profile.Source != baselinedomain.ProfileSourceDefault || len(profile.Rules) != 1 {
+		t.Fatalf("default profile = %+v", profile)
+	}
+	if profile, _ := service.Profile(ctx, "orders"); profile.Source != baselinedomain.ProfileSourceCluster {
+		t.Fatalf("cluster profile = %+v", profile)
+	}
+
+	for _, rules := range [][]baselinedomain.Rule{
+		nil,
+		{{Key: "kernel.foo", Operator: "eq", Expected: "1"}},
+		{{Key: "sysctl.vm.swappiness", Operator: "ge", Expected: "low"}},
+		{{Key: "sysctl.vm.swappiness", Operator: "eq", Expected: "1; reboot"}},
+		{{Key: "selinux", Operator: "eq", Expected: "disabled"}, {Key: "selinux", Operator: "eq", Expected: "permissive"}},
+	} {
+		if _, err := service.SaveProfile(ctx, "orders", rules, "dba"); err == nil {
+			t.Fatalf("rules %+v must be rejected", rules)
+		}
+	}
+}
+
+func TestBaselineServiceRemediationIsGuarded(t *testing.T) {
+	ctx := context.Background()
+	service, repo, _, tasks := newBaselineTestService(t)
+	if _, err := service.Ingest(ctx, baselinedomain.Report{MachineID: "m1", Facts: map[string]string{
+		"sysctl.vm.swappiness": "60", "thp.enabled": "always", "io.scheduler:sda": "bfq", "firewall": "active",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "db-2"}); err == nil {
+		t.Fatal("wrong confirm must be rejected")
+	}
+	if _, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "db-1", Checks: []string{"firewall"}}); err == nil {
+		t.Fatal("manual checks must be rejected")
+	}
+	if _, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "db-1", Checks: []string{"thp.defrag"}}); err == nil {
+		t.Fatal("checks that are not failing must be rejected")
+	}
+
+	result, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := tasks.commands[0]
+	if result.TaskID != "task-1" || len(result.Checks) != 3 || len(steps) != 3 {
+		t.Fatalf("result = %+v steps = %+v", result, steps)
+	}
+	if steps[0].Name != "修复 io.scheduler:sda" || !strings.Contains(steps[0].Command, "for s in 'none' 'mq-deadline'") ||
+		!strings.Contains(steps[0].Command, "/etc/udev/rules.d/60-gmha-io-scheduler.rules") {
+		t.Fatalf("io scheduler step = %+v", steps[0])
+	}
+	if !strings.Contains(steps[1].Command, "sysctl -w 'vm.swappiness=1'") || !strings.Contains(steps[1].Command, baselineSysctlFile) {
+		t.Fatalf("sysctl step = %+v", steps[1])
+	}
+	if !strings.Contains(steps[2].Command, "systemctl enable gmha-thp-enabled.service") {
+		t.Fatalf("thp step = %+v", steps[2])
+	}
+
+	if result, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "db-1"}); !errors.Is(err, ErrBaselineRemediationRunning) || result.TaskID != "task-1" {
+		t.Fatalf("second remediation = %+v, %v", result, err)
+	}
+	task := tasks.tasks["task-1"]
+	task.Status = taskdomain.StatusSuccess
+	tasks.tasks["task-1"] = task
+	if _, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "m1", Checks: []string{"sysctl.vm.swappiness"}}); err != nil {
+		t.Fatalf("remediation after the first task finished: %v", err)
+	}
+
+	state := repo.states["m1"]
+	state.CollectedAt = time.Now().Add(-time.Hour)
+	repo.states["m1"] = state
+	if _, err := service.Remediate(ctx, BaselineRemediationRequest{MachineID: "m1", Confirm: "db-1"}); err == nil || !strings.Contains(err.Error(), "未更新") {
+		t.Fatalf("stale report must block remediation, err = %v", err)
+	}
+}
+
+func TestBaselineCompareAndRemediationCommands(t *testing.T) {
+	for _, tc := range []struct {
+		operator, expected, actual, status string
+	}{
+		{"ge", "65535", "unlimited", baselinedomain.StatusPass},
+		{"ge", "65535", "1024", baselinedomain.StatusFail},
+		{"eq", "1", "1.0", baselinedomain.StatusPass},
+		{"contains", "noatime,nodiratime", "rw,noatime,nodiratime", baselinedomain.StatusPass},
+		{"contains", "noatime", "rw,relatime", baselinedomain.StatusFail},
+		{"in", "permissive,disabled", "Disabled", baselinedomain.StatusPass},
+		{"ge", "1", "n/a", baselinedomain.StatusSkipped},
+		{"le", "1", "abc", baselinedomain.StatusUnknown},
+	} {
+		if status, _ := compareBaseline(tc.operator, tc.expected, tc.actual); status != tc.status {
+			t.Fatalf("%s %s %s = %s, want %s", tc.actual, tc.operator, tc.expected, status, tc.status)
+		}
+	}
+
+	command, err := baselineRemediationCommand(baselinedomain.CheckResult{Key: "mount.options", Target: "/data", Operator: "contains", Expected: "noatime"})
+	if err != nil || !strings.Contains(command, "mount -o 'remount,noatime' '/data'") || !strings.Contains(command, "/etc/fstab") {
+		t.Fatalf("mount command = %q, %v", command, err)
+	}
+	command, err = baselineRemediationCommand(baselinedomain.CheckResult{Key: "ulimit.nofile", Operator: "ge", Expected: "65535"})
+	if err != nil || !strings.Contains(command, "'LimitNOFILE=65535'") || !strings.Contains(command, "daemon-reload") {
+		t.Fatalf("ulimit command = %q, %v", command, err)
+	}
+	for _, result := range []baselinedomain.CheckResult{
+		{Key: "mount.options", Target: "/data disk", Operator: "contains", Expected: "noatime"},
+		{Key: "firewall", Operator: "eq", Expected: "inactive"},
+		{Key: "mount.fstype", Target: "/data", Operator: "in", Expected: "xfs"},
+		{Key: "time.sync", Operator: "eq", Expected: "false"},
+	} {
+		if baselineRemediable(result) {
+			t.Fatalf("%+v must need manual handling", result)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gmha/internal/binloganalyzer"
+)
+
+const (
+	// binlogRowRetention bounds how long row-level search results stay on the
+	// Manager disk; row images may contain business data.
+	binlogRowRetention    = 7 * 24 * time.Hour
+	binlogRowPageLimit    = 200
+	binlogRowPageMaxLimit = 1000
+)
+
+type BinlogRowPage struct {
+	Items      []binloganalyzer.RowChange `json:"items"`
+	Offset     int                        `json:"offset"`
+	Limit      int                        `json:"limit"`
+	NextOffset int                        `json:"next_offset"`
+	HasMore    bool                       `json:"has_more"`
+	Total      int64                      `json:"total"`
+	Complete   bool                       `json:"complete"`
+}
+
+// searchRows streams the matching row changes of a rows-mode run into a JSON
+// Lines spool file. Only complete searches keep their file.
+func (s *BinlogAnalysisService) searchRows(ctx context.Context, id string, cfg binloganalyzer.Config, filter binloganalyzer.RowFilter, progress func(binloganalyzer.Progress)) (*binloganalyzer.RowSearchSummary, error) {
+	if err := os.MkdirAll(s.rowDir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建行级检索结果目录失败: %w", err)
+	}
+	path := s.rowFile(id)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("创建行级检索结果文件失败: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	summary, err := s.search(ctx, cfg, filter, func(change binloganalyzer.RowChange) error {
+		if err := encoder.Encode(change); err != nil {
+			return err
+		}
+		// Flush regularly so the rows API can page through a running search.
+		if change.Seq%100 == 0 {
+			return writer.Flush()
+		}
+		return nil
+	}, progress)
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// Rows pages through the changes of a rows-mode run. Pages of a running search
+// only contain the changes written so far and Total is only known once the
+// search is complete.
+func (s *BinlogAnalysisService) Rows(ctx context.Context, id string, offset, limit int) (BinlogRowPage, error) {
+	if offset < 0 {
+		return BinlogRowPage{}, errors.New("offset 不能为负数")
+	}
+	if limit <= 0 {
+		limit = binlogRowPageLimit
+	}
+	limit = min(limit, binlogRowPageMaxLimit)
+	task, file, err := s.openRows(ctx, id, false)
+	if err != nil {
+		return BinlogRowPage{}, err
+	}
+	defer file.Close()
+	page := BinlogRowPage{Items: []binloganalyzer.RowChange{}, Offset: offset, Limit: limit, Complete: task.Status == BinlogAnalysisCompleted}
+	if task.Rows != nil {
+		page.Total = task.Rows.RowsMatched
+	}
+	index := 0
+	err = readBinlogRows(file, func(change binloganalyzer.RowChange) (bool, error) {
+		defer func() { index++ }()
+		if index < offset {
+			return true, nil
+		}
+		if len(page.Items) == limit {
+			page.HasMore = true
+			return false, nil
+		}
+		page.Items = append(page.Items, change)
+		return true, nil
+	})
+	page.NextOffset = offset + len(page.Items)
+	return page, err
+}
+
+// ExportRows opens the JSON Lines result of a completed rows-mode run; the
+// caller closes it.
+func (s *BinlogAnalysisService) ExportRows(ctx context.Context, id string) (io.ReadCloser, error) {
+	_, file, err := s.openRows(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Flashback generates the statements reverting the selected changes of a
+// completed rows-mode run, newest first. An empty selection reverts every
+// change the search returned.
+func (s *BinlogAnalysisService) Flashback(ctx context.Context, id string, seqs []int64) (string, error) {
+	task, file, err := s.openRows(ctx, id, true)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	selected := make(map[int64]bool, len(seqs))
+	for _, seq := range seqs {
+		selected[seq] = true
+	}
+	var changes []binloganalyzer.RowChange
+	if err := readBinlogRows(file, func(change binloganalyzer.RowChange) (bool, error) {
+		if len(selected) == 0 || selected[change.Seq] {
+			changes = append(changes, change)
+		}
+		return true, nil
+	}); err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", errors.New("没有选中任何行变更")
+	}
+	if len(selected) > 0 && len(changes) != len(selected) {
+		return "", fmt.Errorf("选中的 %d 行中有 %d 行不存在", len(selected), len(selected)-len(changes))
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq > changes[j].Seq })
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "-- GMHA flashback for %s (%s:%d), %d row change(s), newest first.\n", task.ID, task.Request.MachineIP, task.Request.Port, len(changes))
+	out.WriteString("-- Review before executing; TIMESTAMP values were captured in UTC.\n")
+	out.WriteString("SET time_zone = '+00:00';\nBEGIN;\n")
+	for _, change := range changes {
+		statement, err := binloganalyzer.FlashbackSQL(change)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&out, "-- #%d %s %s.%s at %s, %s:%d", change.Seq, change.Type, change.Schema, change.Table,
+			change.Time.Format(time.RFC3339), change.BinlogFile, change.EndLogPos)
+		if change.GTID != "" {
+			fmt.Fprintf(&out, ", GTID %s", change.GTID)
+		}
+		if change.ThreadID != 0 {
+			fmt.Fprintf(&out, ", thread %d", change.ThreadID)
+		}
+		out.WriteString("\n")
+		out.WriteString(statement)
+		out.WriteString("\n")
+	}
+	out.WriteString("COMMIT;\n")
+	return out.String(), nil
+}
+
+func (s *BinlogAnalysisService) openRows(ctx context.Context, id string, completed bool) (BinlogAnalysisTask, *os.File, error) {
+	task, ok, err := s.Get(ctx, id)
+	if err != nil {
+		return task, nil, err
+	}
+	if !ok {
+		return task, nil, errors.New("Binlog 分析任务不存在")
+	}
+	if task.Request.RowFilter == nil {
+		return task, nil, errors.New("该任务不是行级检索任务")
+	}
+	if completed && task.Status != BinlogAnalysisCompleted {
+		return task, nil, fmt.Errorf("状态为 %s 的任务不能导出或生成回滚 SQL", task.Status)
+	}
+	if task.Status != BinlogAnalysisCompleted && task.Status != BinlogAnalysisRunning {
+		return task, nil, fmt.Errorf("状态为 %s 的任务没有行级结果", task.Status)
+	}
+	if task.RowsExpired {
+		return task, nil, errors.New("行级检索结果已过期，请重新检索")
+	}
+	file, err := os.Open(s.rowFile(task.ID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return task, nil, errors.New("行级检索结果尚未生成")
+		}
+		return task, nil, err
+	}
+	return task, file, nil
+}
+
+// rowsExpired reports completed rows-mode runs whose spool file is gone,
+// either after the retention or on another Manager.
+func (s *BinlogAnalysisService) rowsExpired(task BinlogAnalysisTask) bool {
+	if task.Request.RowFilter == nil || task.Status != BinlogAnalysisCompleted {
+		return false
+	}
+	_, err := os.Stat(s.rowFile(task.ID))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+func (s *BinlogAnalysisService) rowFile(id string) string {
+	return filepath.Join(s.rowDir, filepath.Base(id)+".jsonl")
+}
+
+func (s *BinlogAnalysisService) purgeRowFiles(before time.Time) {
+	entries, err := os.ReadDir(s.rowDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.rowDir, entry.Name())); err != nil {
+			log.Printf("binlog analysis: remove row results %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// readBinlogRows decodes complete lines only: the last line of a running
+// search may still be half written.
+func readBinlogRows(r io.Reader, visit func(binloganalyzer.RowChange) (bool, error)) error {
+	reader := bufio.NewReaderSize(r, 64<<10)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.UseNumber()
+		var change binloganalyzer.RowChange
+		if err := decoder.Decode(&change); err != nil {
+			return fmt.Errorf("读取行级检索结果失败: %w", err)
+		}
+		more, err := visit(change)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
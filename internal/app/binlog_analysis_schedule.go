@@ -0,0 +1,482 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gmha/internal/binloganalyzer"
+	alertdomain "gmha/internal/domain/alert"
+	binlogdomain "gmha/internal/domain/binloganalysis"
+	machinedomain "gmha/internal/domain/machine"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	binlogBigTransactionRuleID = "binlog_big_transaction"
+	binlogUnexpectedDDLRuleID  = "binlog_unexpected_ddl"
+
+	binlogDefaultWindowHours   = 24
+	binlogDefaultBigTxnRows    = 10000
+	binlogAnalysisRetention    = 180 * 24 * time.Hour
+	binlogTrendDefaultWeeks    = 12
+	binlogTrendMaxWeeks        = 26
+	binlogTrendDefaultTables   = 20
+	binlogTrendMaxTables       = 100
+	binlogAlertDDLSampleLength = 5
+)
+
+// BinlogTrendWeek summarizes one week of scheduled analyses. Analyses shows
+// how many windows contributed, so gaps are not mistaken for quiet weeks.
+type BinlogTrendWeek struct {
+	Start     time.Time `json:"start"`
+	Analyses  int       `json:"analyses"`
+	TotalRows int64     `json:"total_rows"`
+}
+
+type BinlogTrendPoint struct {
+	WeekStart  time.Time `json:"week_start"`
+	InsertRows int64     `json:"insert_rows"`
+	UpdateRows int64     `json:"update_rows"`
+	DeleteRows int64     `json:"delete_rows"`
+	TotalRows  int64     `json:"total_rows"`
+	DDLCount   int64     `json:"ddl_count"`
+}
+
+type BinlogTableTrend struct {
+	Schema    string             `json:"schema"`
+	Table     string             `json:"table"`
+	TotalRows int64              `json:"total_rows"`
+	Points    []BinlogTrendPoint `json:"points"`
+}
+
+// BinlogWriteTrend is the weekly write volume per table recorded by
+// scheduled analyses, limited to the busiest tables of the period.
+type BinlogWriteTrend struct {
+	Cluster    string             `json:"cluster,omitempty"`
+	ScheduleID string             `json:"schedule_id,omitempty"`
+	Weeks      []BinlogTrendWeek  `json:"weeks"`
+	Tables     []BinlogTableTrend `json:"tables"`
+}
+
+func (s *BinlogAnalysisService) SaveSchedule(ctx context.Context, schedule binlogdomain.Schedule) (binlogdomain.Schedule, error) {
+	schedule.ID = strings.TrimSpace(schedule.ID)
+	if schedule.ID == "" {
+		schedule.ID = newBinlogAnalysisID("binlog-schedule")
+	}
+	if existing, ok, err := s.repo.GetSchedule(ctx, schedule.ID); err != nil {
+		return schedule, err
+	} else if ok {
+		schedule.CreatedAt = existing.CreatedAt
+		schedule.LastRunAt = existing.LastRunAt
+		schedule.LastAnalysisID = existing.LastAnalysisID
+	}
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	if schedule.Name == "" {
+		return schedule, errors.New("任务名称不能为空")
+	}
+	schedule.Cluster = strings.TrimSpace(schedule.Cluster)
+	schedule.MachineID = strings.TrimSpace(schedule.MachineID)
+	if schedule.MachineID != "" {
+		_, machine, err := s.target(ctx, schedule.MachineID, schedule.Port)
+		if err != nil {
+			return schedule, err
+		}
+		schedule.Cluster = machine.Cluster
+	} else {
+		schedule.Port = 0
+	}
+	if schedule.Cluster == "" {
+		return schedule, errors.New("请指定集群或目标实例")
+	}
+	if schedule.WindowHours == 0 {
+		schedule.WindowHours = binlogDefaultWindowHours
+	}
+	if schedule.WindowHours < 1 || schedule.WindowHours > 7*24 {
+		return schedule, errors.New("分析窗口必须在 1–168 小时之间")
+	}
+	schedule.BigTxnMode = normalizeBinlogMode(schedule.BigTxnMode)
+	if schedule.BigTxnMode == binloganalyzer.BigTransactionRows {
+		if schedule.BigTxnRowsThreshold < 0 {
+			return schedule, errors.New("大事务行数阈值不能为负数")
+		}
+		if schedule.BigTxnRowsThreshold == 0 {
+			schedule.BigTxnRowsThreshold = binlogDefaultBigTxnRows
+		}
+	} else if schedule.BigTxnBytesThreshold == 0 {
+		return schedule, errors.New("按字节识别大事务时，字节阈值必须大于 0")
+	}
+	expected := make([]string, 0, len(schedule.ExpectedDDL))
+	for _, pattern := range schedule.ExpectedDDL {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return schedule, fmt.Errorf("预期 DDL 规则 %q 格式不正确", pattern)
+		}
+		expected = append(expected, pattern)
+	}
+	schedule.ExpectedDDL = expected
+	if schedule.StartAt.IsZero() {
+		return schedule, errors.New("首次执行时间不能为空")
+	}
+	switch schedule.ScheduleType {
+	case binlogdomain.ScheduleDaily:
+	case binlogdomain.ScheduleInterval:
+		if schedule.IntervalMinutes < 60 {
+			return schedule, errors.New("循环间隔不能小于 60 分钟")
+		}
+	default:
+		return schedule, errors.New("计划类型必须是 interval 或 daily")
+	}
+	now := time.Now().UTC()
+	if schedule.CreatedAt.IsZero() {
+		schedule.CreatedAt = now
+	}
+	schedule.UpdatedAt = now
+	schedule.NextRunAt = nextBinlogScheduleRun(schedule, now, false)
+	if err := s.repo.SaveSchedule(ctx, schedule); err != nil {
+		return schedule, err
+	}
+	return schedule, nil
+}
+
+func (s *BinlogAnalysisService) ListSchedules(ctx context.Context, cluster string) ([]binlogdomain.Schedule, error) {
+	return s.repo.ListSchedules(ctx, strings.TrimSpace(cluster))
+}
+
+func (s *BinlogAnalysisService) DeleteSchedule(ctx context.Context, id string) error {
+	return s.repo.DeleteSchedule(ctx, strings.TrimSpace(id))
+}
+
+// RunSchedule analyses the schedule window that ends now.
+func (s *BinlogAnalysisService) RunSchedule(ctx context.Context, id string) (BinlogAnalysisTask, error) {
+	schedule, ok, err := s.repo.GetSchedule(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return BinlogAnalysisTask{}, err
+	}
+	if !ok {
+		return BinlogAnalysisTask{}, errors.New("自动任务不存在")
+	}
+	machineID, port, err := s.scheduleTarget(ctx, schedule)
+	if err != nil {
+		return BinlogAnalysisTask{}, err
+	}
+	end := time.Now().UTC().Truncate(time.Minute)
+	return s.create(ctx, BinlogAnalysisRequest{
+		MachineID: machineID, Port: port,
+		StartTime: end.Add(-time.Duration(schedule.WindowHours) * time.Hour), EndTime: end,
+		BigTxnMode: schedule.BigTxnMode, BigTxnRowsThreshold: schedule.BigTxnRowsThreshold,
+		BigTxnBytesThreshold: schedule.BigTxnBytesThreshold,
+	}, schedule.ID)
+}
+
+// TableTrend aggregates the table volumes of scheduled analyses by week
+// (Monday, UTC). Overlapping schedules of one cluster are summed, so pass a
+// schedule ID when a cluster has more than one.
+func (s *BinlogAnalysisService) TableTrend(ctx context.Context, cluster, scheduleID string, weeks, tables int) (BinlogWriteTrend, error) {
+	cluster, scheduleID = strings.TrimSpace(cluster), strings.TrimSpace(scheduleID)
+	if cluster == "" && scheduleID == "" {
+		return BinlogWriteTrend{}, errors.New("请指定集群或自动任务")
+	}
+	if weeks <= 0 {
+		weeks = binlogTrendDefaultWeeks
+	}
+	weeks = min(weeks, binlogTrendMaxWeeks)
+	if tables <= 0 {
+		tables = binlogTrendDefaultTables
+	}
+	tables = min(tables, binlogTrendMaxTables)
+	first := binlogWeekStart(time.Now().UTC()).AddDate(0, 0, -7*(weeks-1))
+	items, err := s.repo.ListTableVolumes(ctx, cluster, scheduleID, first)
+	if err != nil {
+		return BinlogWriteTrend{}, err
+	}
+
+	trend := BinlogWriteTrend{Cluster: cluster, ScheduleID: scheduleID, Weeks: make([]BinlogTrendWeek, weeks)}
+	for index := range trend.Weeks {
+		trend.Weeks[index].Start = first.AddDate(0, 0, 7*index)
+	}
+	type tableKey struct{ schema, table string }
+	series := map[tableKey]*BinlogTableTrend{}
+	analyses := make([]map[string]bool, weeks)
+	for _, item := range items {
+		index := int(binlogWeekStart(item.WindowStart).Sub(first) / (7 * 24 * time.Hour))
+		if index < 0 || index >= weeks {
+			continue
+		}
+		if analyses[index] == nil {
+			analyses[index] = map[string]bool{}
+		}
+		analyses[index][item.AnalysisID] = true
+		trend.Weeks[index].TotalRows += item.TotalRows
+		key := tableKey{item.Schema, item.Table}
+		table := series[key]
+		if table == nil {
+			table = &BinlogTableTrend{Schema: item.Schema, Table: item.Table, Points: make([]BinlogTrendPoint, weeks)}
+			for i := range table.Points {
+				table.Points[i].WeekStart = trend.Weeks[i].Start
+			}
+			series[key] = table
+		}
+		point := &table.Points[index]
+		point.InsertRows += item.InsertRows
+		point.UpdateRows += item.UpdateRows
+		point.DeleteRows += item.DeleteRows
+		point.TotalRows += item.TotalRows
+		point.DDLCount += item.DDLCount
+		table.TotalRows += item.TotalRows
+	}
+	for index := range trend.Weeks {
+		trend.Weeks[index].Analyses = len(analyses[index])
+	}
+	trend.Tables = make([]BinlogTableTrend, 0, len(series))
+	for _, table := range series {
+		trend.Tables = append(trend.Tables, *table)
+	}
+	sort.Slice(trend.Tables, func(i, j int) bool {
+		if trend.Tables[i].TotalRows != trend.Tables[j].TotalRows {
+			return trend.Tables[i].TotalRows > trend.Tables[j].TotalRows
+		}
+		if trend.Tables[i].Schema != trend.Tables[j].Schema {
+			return trend.Tables[i].Schema < trend.Tables[j].Schema
+		}
+		return trend.Tables[i].Table < trend.Tables[j].Table
+	})
+	if len(trend.Tables) > tables {
+		trend.Tables = trend.Tables[:tables]
+	}
+	return trend, nil
+}
+
+func (s *BinlogAnalysisService) scheduleLoop(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	s.runDueSchedules(ctx)
+	lastPurge := time.Time{}
+	for {
+		if time.Since(lastPurge) >= time.Hour {
+			lastPurge = time.Now()
+			if n, err := s.repo.PurgeAnalyses(ctx, time.Now().UTC().Add(-binlogAnalysisRetention)); err != nil {
+				log.Printf("binlog analysis scheduler: purge analyses: %v", err)
+			} else if n > 0 {
+				log.Printf("binlog analysis scheduler: purged %d analyses", n)
+			}
+			s.purgeRowFiles(time.Now().Add(-binlogRowRetention))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDueSchedules(ctx)
+		}
+	}
+}
+
+func (s *BinlogAnalysisService) runDueSchedules(ctx context.Context) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	now := time.Now().UTC()
+	items, err := s.repo.ListDueSchedules(ctx, now)
+	if err != nil {
+		log.Printf("binlog analysis scheduler: list due schedules: %v", err)
+		return
+	}
+	for _, schedule := range items {
+		task, err := s.RunSchedule(ctx, schedule.ID)
+		if err != nil {
+			log.Printf("binlog analysis scheduler: run %s: %v", schedule.ID, err)
+		}
+		next := nextBinlogScheduleRun(schedule, now, true)
+		if err := s.repo.UpdateScheduleRun(ctx, schedule.ID, now, next, schedule.Enabled, task.ID); err != nil {
+			log.Printf("binlog analysis scheduler: advance %s: %v", schedule.ID, err)
+		}
+	}
+}
+
+// scheduleTarget returns the configured instance, or the writable instance of
+// the cluster when the schedule follows the primary.
+func (s *BinlogAnalysisService) scheduleTarget(ctx context.Context, schedule binlogdomain.Schedule) (string, int, error) {
+	if schedule.MachineID != "" {
+		return schedule.MachineID, schedule.Port, nil
+	}
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	members := map[string]machinedomain.Machine{}
+	for _, machine := range machines {
+		if machine.Cluster == schedule.Cluster && strings.TrimSpace(machine.IP) != "" {
+			members[machine.ID] = machine
+		}
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	var candidates []mysqlapp.Instance
+	for _, instance := range instances {
+		if _, ok := members[instance.MachineID]; ok {
+			candidates = append(candidates, instance)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].MachineID != candidates[j].MachineID {
+			return candidates[i].MachineID < candidates[j].MachineID
+		}
+		return candidates[i].Port < candidates[j].Port
+	})
+	switch len(candidates) {
+	case 0:
+		return "", 0, fmt.Errorf("集群 %s 没有已登记的 MySQL 实例", schedule.Cluster)
+	case 1:
+		return candidates[0].MachineID, candidates[0].Port, nil
+	}
+	credential, err := s.credential(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, instance := range candidates {
+		role, err := s.role(ctx, members[instance.MachineID], instance.Port, credential)
+		if err == nil && role == sqldomain.InstanceRolePrimary {
+			return instance.MachineID, instance.Port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("无法确认集群 %s 的主库", schedule.Cluster)
+}
+
+// raiseScheduleAlerts reports big transactions and DDL outside the expected
+// patterns of a scheduled run. Each schedule keeps one event per rule that is
+// resolved by the next run without findings.
+func (s *BinlogAnalysisService) raiseScheduleAlerts(ctx context.Context, task BinlogAnalysisTask) {
+	if s.alerts == nil || task.Result == nil {
+		return
+	}
+	schedule, ok, err := s.repo.GetSchedule(ctx, task.ScheduleID)
+	if err != nil || !ok {
+		return
+	}
+	window := task.Request.StartTime.Format("2006-01-02 15:04") + " ~ " + task.Request.EndTime.Format("2006-01-02 15:04") + " UTC"
+	signal := func(ruleID, ruleName, metric string) AlertSignal {
+		return AlertSignal{
+			RuleID: ruleID, RuleName: ruleName, Metric: metric, Category: "binlog_analysis",
+			MachineName: task.Request.MachineName, MachineIP: task.Request.MachineIP, ClusterID: schedule.Cluster,
+			Labels:   map[string]string{"schedule_id": schedule.ID, "cluster": schedule.Cluster},
+			Severity: alertdomain.SeverityWarning, Operator: ">=",
+		}
+	}
+
+	big := signal(binlogBigTransactionRuleID, "Binlog 大事务", "binlog_big_txn_size")
+	if count := task.Result.Summary.BigTxnCount; schedule.AlertBigTransactions && count > 0 {
+		largest, unit := binlogLargestTransaction(task.Result.BigTransactions, schedule.BigTxnMode)
+		big.Value = float64(largest)
+		big.Threshold = float64(schedule.BigTxnRowsThreshold)
+		if schedule.BigTxnMode == binloganalyzer.BigTransactionBytes {
+			big.Threshold = float64(schedule.BigTxnBytesThreshold)
+		}
+		big.Message = fmt.Sprintf("%s 在 %s 出现 %d 个大事务，最大 %d %s", schedule.Name, window, count, largest, unit)
+		_ = s.alerts.RaiseSignal(ctx, big)
+	} else {
+		_ = s.alerts.ResolveSignal(ctx, big)
+	}
+
+	ddl := signal(binlogUnexpectedDDLRuleID, "Binlog 非预期 DDL", "binlog_unexpected_ddl_count")
+	var unexpected []string
+	for _, event := range task.Result.DDLEvents {
+		if name := binlogDDLObject(event); !binlogDDLExpected(schedule.ExpectedDDL, name) {
+			unexpected = append(unexpected, name+"("+event.Type+")")
+		}
+	}
+	if schedule.AlertDDL && len(unexpected) > 0 {
+		ddl.Value, ddl.Threshold = float64(len(unexpected)), 1
+		sample := unexpected
+		if len(sample) > binlogAlertDDLSampleLength {
+			sample = sample[:binlogAlertDDLSampleLength]
+		}
+		ddl.Message = fmt.Sprintf("%s 在 %s 出现 %d 条非预期 DDL：%s", schedule.Name, window, len(unexpected), strings.Join(sample, ", "))
+		_ = s.alerts.RaiseSignal(ctx, ddl)
+	} else {
+		_ = s.alerts.ResolveSignal(ctx, ddl)
+	}
+}
+
+func binlogLargestTransaction(items []binloganalyzer.BigTransaction, mode string) (uint64, string) {
+	var largest uint64
+	for _, item := range items {
+		size := uint64(item.RowCount)
+		if mode == binloganalyzer.BigTransactionBytes {
+			size = item.TransactionLength
+		}
+		largest = max(largest, size)
+	}
+	if mode == binloganalyzer.BigTransactionBytes {
+		return largest, "字节"
+	}
+	return largest, "行"
+}
+
+func binlogDDLObject(event binloganalyzer.DDLEvent) string {
+	name := strings.ToLower(strings.TrimSpace(event.Schema))
+	if object := strings.ToLower(strings.TrimSpace(event.Object)); object != "" {
+		name += "." + object
+	}
+	return name
+}
+
+func binlogDDLExpected(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func binlogWeekStart(value time.Time) time.Time {
+	value = value.UTC()
+	day := time.Date(value.Year(), value.Month(), value.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+func nextBinlogScheduleRun(schedule binlogdomain.Schedule, now time.Time, afterRun bool) time.Time {
+	start := schedule.StartAt.UTC()
+	if !afterRun && start.After(now) {
+		return start
+	}
+	switch schedule.ScheduleType {
+	case binlogdomain.ScheduleInterval:
+		interval := time.Duration(schedule.IntervalMinutes) * time.Minute
+		if interval <= 0 {
+			return time.Time{}
+		}
+		if start.After(now) {
+			return start
+		}
+		return start.Add((now.Sub(start)/interval + 1) * interval)
+	case binlogdomain.ScheduleDaily:
+		next := time.Date(now.Year(), now.Month(), now.Day(), start.Hour(), start.Minute(), start.Second(), 0, time.UTC)
+		if !next.After(now) {
+			next = next.Add(24 * time.Hour)
+		}
+		return next
+	default:
+		return time.Time{}
+	}
+}
+
+func binlogInstanceRole(ctx context.Context, machine machinedomain.Machine, port int, credential mysqlapp.DiagnosticCredential) (string, error) {
+	client := mysqlapp.DiagnosticClient{}
+	db, err := client.Open(sqldomain.Instance{MachineID: machine.ID, MachineIP: machine.IP, Port: port}, credential)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	return client.InstanceRole(ctx, db)
+}
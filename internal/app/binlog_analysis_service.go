@@ -4,14 +4,19 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"gmha/internal/binloganalyzer"
+	binlogdomain "gmha/internal/domain/binloganalysis"
 	machinedomain "gmha/internal/domain/machine"
 	mysqlapp "gmha/internal/mysql"
 )
@@ -33,6 +38,10 @@ type BinlogAnalysisRequest struct {
 	BigTxnMode           string
 	BigTxnRowsThreshold  int
 	BigTxnBytesThreshold uint64
+	// Mode is binloganalyzer.ModeSummary (default) or ModeRows; RowFilter is
+	// only used by the rows mode.
+	Mode      string
+	RowFilter binloganalyzer.RowFilter
 }
 
 type BinlogAnalysisRequestView struct {
@@ -46,10 +55,15 @@ type BinlogAnalysisRequestView struct {
 	BigTxnMode           string    `json:"big_txn_mode"`
 	BigTxnRowsThreshold  int       `json:"big_txn_rows_threshold"`
 	BigTxnBytesThreshold uint64    `json:"big_txn_bytes_threshold"`
+	Mode                 string    `json:"mode,omitempty"`
+	// RowFilter is set for row-level searches only.
+	RowFilter *binloganalyzer.RowFilter `json:"row_filter,omitempty"`
 }
 
 type BinlogAnalysisTask struct {
 	ID         string                    `json:"id"`
+	ScheduleID string                    `json:"schedule_id,omitempty"`
+	Cluster    string                    `json:"cluster"`
 	Status     string                    `json:"status"`
 	Error      string                    `json:"error,omitempty"`
 	CreatedAt  time.Time                 `json:"created_at"`
@@ -59,6 +73,13 @@ type BinlogAnalysisTask struct {
 	Progress   binloganalyzer.Progress   `json:"progress"`
 	Summary    *binloganalyzer.Summary   `json:"summary,omitempty"`
 	Result     *binloganalyzer.Result    `json:"result,omitempty"`
+	// Rows summarizes a row-level search; the matching changes themselves are
+	// streamed to a spool file and read through the rows and export APIs.
+	Rows *binloganalyzer.RowSearchSummary `json:"rows,omitempty"`
+	// DMLDetailExpired is set on reports loaded from the metadata database:
+	// per-event DML detail is only kept in memory for recent runs.
+	DMLDetailExpired bool `json:"dml_detail_expired,omitempty"`
+	RowsExpired      bool `json:"rows_expired,omitempty"`
 }
 
 type binlogAnalysisRecord struct {
@@ -68,32 +89,76 @@ type binlogAnalysisRecord struct {
 
 type binlogAnalyzeFunc func(context.Context, binloganalyzer.Config, func(binloganalyzer.Progress)) (*binloganalyzer.Result, error)
 
+type binlogRowSearchFunc func(context.Context, binloganalyzer.Config, binloganalyzer.RowFilter, func(binloganalyzer.RowChange) error, func(binloganalyzer.Progress)) (binloganalyzer.RowSearchSummary, error)
+
+type binlogRoleFunc func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential) (string, error)
+
 // BinlogAnalysisService runs bounded, read-only analysis jobs from Manager.
 // The browser selects a registered instance; credentials are resolved from the
 // enabled MHA preset and are never accepted by or returned from the API.
+// Runs are persisted in the metadata database; only the DML event detail of
+// recent runs stays in memory.
 type BinlogAnalysisService struct {
+	repo      binlogdomain.Repository
 	instances MySQLInstanceRepository
 	machines  machinedomain.Repository
 	presets   MySQLAccountPresetRepository
+	alerts    *AlertService
 	analyze   binlogAnalyzeFunc
+	search    binlogRowSearchFunc
+	role      binlogRoleFunc
+	rowDir    string
 
-	mu      sync.RWMutex
-	records map[string]*binlogAnalysisRecord
-	slots   chan struct{}
-	ctx     context.Context
-	cancel  context.CancelFunc
+	mu        sync.RWMutex
+	persistMu sync.Mutex
+	runMu     sync.Mutex
+	records   map[string]*binlogAnalysisRecord
+	slots     chan struct{}
+	runs      sync.WaitGroup
+	started   bool
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
-func NewBinlogAnalysisService(instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository) *BinlogAnalysisService {
+func NewBinlogAnalysisService(repo binlogdomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository) *BinlogAnalysisService {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &BinlogAnalysisService{
-		instances: instances, machines: machines, presets: presets,
-		analyze: binloganalyzer.Analyze, records: make(map[string]*binlogAnalysisRecord),
+		repo: repo, instances: instances, machines: machines, presets: presets,
+		analyze: binloganalyzer.Analyze, search: binloganalyzer.SearchRows, role: binlogInstanceRole,
+		rowDir: filepath.Join(os.TempDir(), "gmha-binlog-rows"), records: make(map[string]*binlogAnalysisRecord),
 		slots: make(chan struct{}, 2), ctx: ctx, cancel: cancel,
 	}
 }
 
+// SetAlertService enables big transaction and unexpected DDL alerts for
+// scheduled analyses.
+func (s *BinlogAnalysisService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+// Start marks runs interrupted by a previous Manager process as failed and
+// starts the scheduler.
+func (s *BinlogAnalysisService) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+	if n, err := s.repo.FailInterruptedAnalyses(s.ctx, "Manager 重启，分析中断", time.Now().UTC()); err != nil {
+		log.Printf("binlog analysis: mark interrupted analyses: %v", err)
+	} else if n > 0 {
+		log.Printf("binlog analysis: marked %d interrupted analyses as failed", n)
+	}
+	go s.scheduleLoop(s.ctx)
+}
+
 func (s *BinlogAnalysisService) Create(ctx context.Context, req BinlogAnalysisRequest) (BinlogAnalysisTask, error) {
+	return s.create(ctx, req, "")
+}
+
+func (s *BinlogAnalysisService) create(ctx context.Context, req BinlogAnalysisRequest, scheduleID string) (BinlogAnalysisTask, error) {
 	instance, machine, err := s.target(ctx, req.MachineID, req.Port)
 	if err != nil {
 		return BinlogAnalysisTask{}, err
@@ -111,60 +176,112 @@ func (s *BinlogAnalysisService) Create(ctx context.Context, req BinlogAnalysisRe
 	if err := binloganalyzer.ValidateConfig(cfg); err != nil {
 		return BinlogAnalysisTask{}, err
 	}
+	mode, err := normalizeBinlogAnalysisMode(req.Mode)
+	if err != nil {
+		return BinlogAnalysisTask{}, err
+	}
+	var rowFilter *binloganalyzer.RowFilter
+	if mode == binloganalyzer.ModeRows {
+		filter, err := binloganalyzer.ValidateRowFilter(req.RowFilter)
+		if err != nil {
+			return BinlogAnalysisTask{}, err
+		}
+		rowFilter = &filter
+	}
 	if strings.TrimSpace(instance.Version) == "" {
 		return BinlogAnalysisTask{}, errors.New("实例版本尚未上报，暂时无法确认 Binlog 分析兼容性")
 	}
 
 	now := time.Now().UTC()
 	task := BinlogAnalysisTask{
-		ID: newBinlogAnalysisID(), Status: BinlogAnalysisQueued, CreatedAt: now,
+		ID: newBinlogAnalysisID("binlog"), ScheduleID: scheduleID, Cluster: machine.Cluster, Status: BinlogAnalysisQueued, CreatedAt: now,
 		Request: BinlogAnalysisRequestView{
 			MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP, Port: req.Port,
 			StartTime: req.StartTime, EndTime: req.EndTime, StartFile: cfg.StartFile,
 			BigTxnMode: normalizeBinlogMode(req.BigTxnMode), BigTxnRowsThreshold: req.BigTxnRowsThreshold,
-			BigTxnBytesThreshold: req.BigTxnBytesThreshold,
+			BigTxnBytesThreshold: req.BigTxnBytesThreshold, Mode: mode, RowFilter: rowFilter,
 		},
 		Progress: binloganalyzer.Progress{Phase: BinlogAnalysisQueued, Message: "任务已进入分析队列"},
 	}
+	analysis, err := binlogAnalysisFromTask(task)
+	if err != nil {
+		return BinlogAnalysisTask{}, err
+	}
+	if err := s.repo.SaveAnalysis(ctx, analysis); err != nil {
+		return BinlogAnalysisTask{}, err
+	}
 	taskCtx, cancel := context.WithCancel(s.ctx)
 	record := &binlogAnalysisRecord{task: task, cancel: cancel}
 	s.mu.Lock()
 	s.records[task.ID] = record
 	s.trimLocked()
 	s.mu.Unlock()
+	s.runs.Add(1)
 	go s.run(taskCtx, task.ID, cfg, credential.Password)
 	return task, nil
 }
 
-func (s *BinlogAnalysisService) List() []BinlogAnalysisTask {
+// List returns stored runs without their reports, newest first. Runs still in
+// memory carry their live progress.
+func (s *BinlogAnalysisService) List(ctx context.Context, cluster string, limit int) ([]BinlogAnalysisTask, error) {
+	stored, err := s.repo.ListAnalyses(ctx, strings.TrimSpace(cluster), limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]BinlogAnalysisTask, 0, len(stored))
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	items := make([]BinlogAnalysisTask, 0, len(s.records))
-	for _, record := range s.records {
-		item := record.task
-		item.Result = nil
+	for _, analysis := range stored {
+		if record, ok := s.records[analysis.ID]; ok {
+			item := record.task
+			item.Result = nil
+			items = append(items, item)
+			continue
+		}
+		item, err := binlogAnalysisTaskFromStored(analysis)
+		if err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
-	sort.Slice(items, func(i, j int) bool { return items[i].CreatedAt.After(items[j].CreatedAt) })
-	return items
+	return items, nil
 }
 
-func (s *BinlogAnalysisService) Get(id string) (BinlogAnalysisTask, bool) {
+func (s *BinlogAnalysisService) Get(ctx context.Context, id string) (BinlogAnalysisTask, bool, error) {
+	id = strings.TrimSpace(id)
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-	record, ok := s.records[strings.TrimSpace(id)]
-	if !ok {
-		return BinlogAnalysisTask{}, false
-	}
-	return record.task, true
+	record, ok := s.records[id]
+	var task BinlogAnalysisTask
+	if ok {
+		task = record.task
+	}
+	s.mu.RUnlock()
+	if ok {
+		task.RowsExpired = s.rowsExpired(task)
+		return task, true, nil
+	}
+	analysis, ok, err := s.repo.GetAnalysis(ctx, id)
+	if err != nil || !ok {
+		return BinlogAnalysisTask{}, false, err
+	}
+	task, err = binlogAnalysisTaskFromStored(analysis)
+	task.RowsExpired = s.rowsExpired(task)
+	return task, err == nil, err
 }
 
-func (s *BinlogAnalysisService) Cancel(id string) (BinlogAnalysisTask, error) {
+func (s *BinlogAnalysisService) Cancel(ctx context.Context, id string) (BinlogAnalysisTask, error) {
 	s.mu.Lock()
 	record, ok := s.records[strings.TrimSpace(id)]
 	if !ok {
 		s.mu.Unlock()
-		return BinlogAnalysisTask{}, errors.New("Binlog 分析任务不存在")
+		task, found, err := s.Get(ctx, id)
+		if err != nil {
+			return BinlogAnalysisTask{}, err
+		}
+		if !found {
+			return BinlogAnalysisTask{}, errors.New("Binlog 分析任务不存在")
+		}
+		return task, fmt.Errorf("状态为 %s 的任务不能取消", task.Status)
 	}
 	if record.task.Status != BinlogAnalysisQueued && record.task.Status != BinlogAnalysisRunning {
 		task := record.task
@@ -179,17 +296,22 @@ func (s *BinlogAnalysisService) Cancel(id string) (BinlogAnalysisTask, error) {
 	record.task.Progress.Message = "分析已取消"
 	task := record.task
 	s.mu.Unlock()
+	s.persist(ctx, task.ID)
 	return task, nil
 }
 
+// Close cancels running analyses and waits until their final state is
+// persisted, so the metadata database is not closed underneath them.
 func (s *BinlogAnalysisService) Close() {
 	if s == nil || s.cancel == nil {
 		return
 	}
 	s.cancel()
+	s.runs.Wait()
 }
 
 func (s *BinlogAnalysisService) run(ctx context.Context, id string, cfg binloganalyzer.Config, secret string) {
+	defer s.runs.Done()
 	select {
 	case s.slots <- struct{}{}:
 		defer func() { <-s.slots }()
@@ -207,21 +329,57 @@ func (s *BinlogAnalysisService) run(ctx context.Context, id string, cfg binlogan
 	record.task.Status = BinlogAnalysisRunning
 	record.task.StartedAt = &startedAt
 	record.task.Progress = binloganalyzer.Progress{Phase: BinlogAnalysisRunning, Message: "正在建立只读复制连接"}
+	rowFilter := record.task.Request.RowFilter
 	s.mu.Unlock()
+	s.persist(s.ctx, id)
 
-	result, err := s.analyze(ctx, cfg, func(progress binloganalyzer.Progress) {
+	onProgress := func(progress binloganalyzer.Progress) {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 		if current := s.records[id]; current != nil && current.task.Status == BinlogAnalysisRunning {
 			current.task.Progress = progress
 		}
-	})
+	}
+	var (
+		result *binloganalyzer.Result
+		rows   *binloganalyzer.RowSearchSummary
+		err    error
+	)
+	if rowFilter != nil {
+		rows, err = s.searchRows(ctx, id, cfg, *rowFilter, onProgress)
+	} else {
+		result, err = s.analyze(ctx, cfg, onProgress)
+	}
+	if !s.finish(id, result, rows, err, secret) {
+		return
+	}
+	s.persist(s.ctx, id)
+	s.mu.RLock()
+	record = s.records[id]
+	var task BinlogAnalysisTask
+	if record != nil {
+		task = record.task
+	}
+	s.mu.RUnlock()
+	if task.Status == BinlogAnalysisCompleted && task.Result != nil {
+		if err := s.repo.SaveTableVolumes(s.ctx, id, binlogTableVolumes(task)); err != nil {
+			log.Printf("binlog analysis: save table volumes of %s: %v", id, err)
+		}
+		if task.ScheduleID != "" {
+			s.raiseScheduleAlerts(s.ctx, task)
+		}
+	}
+}
+
+// finish records the analyzer outcome; it reports false when the task was
+// canceled or trimmed in the meantime.
+func (s *BinlogAnalysisService) finish(id string, result *binloganalyzer.Result, rows *binloganalyzer.RowSearchSummary, err error, secret string) bool {
 	finishedAt := time.Now().UTC()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	record = s.records[id]
+	record := s.records[id]
 	if record == nil || record.task.Status == BinlogAnalysisCanceled {
-		return
+		return false
 	}
 	record.task.FinishedAt = &finishedAt
 	if err != nil {
@@ -229,29 +387,56 @@ func (s *BinlogAnalysisService) run(ctx context.Context, id string, cfg binlogan
 			record.task.Status = BinlogAnalysisCanceled
 			record.task.Progress.Phase = BinlogAnalysisCanceled
 			record.task.Progress.Message = "分析已取消"
-			return
+			return true
 		}
 		record.task.Status = BinlogAnalysisFailed
 		record.task.Error = safeBinlogError(err, secret)
 		record.task.Progress.Phase = BinlogAnalysisFailed
 		record.task.Progress.Message = record.task.Error
-		return
+		return true
 	}
 	record.task.Status = BinlogAnalysisCompleted
 	record.task.Progress.Phase = BinlogAnalysisCompleted
 	record.task.Progress.Message = "分析完成"
 	record.task.Result = result
+	record.task.Rows = rows
 	if result != nil {
 		summary := result.Summary
 		record.task.Summary = &summary
 	}
+	return true
+}
+
+// persist writes the current in-memory state of a task. Writes are serialized
+// and always take the latest snapshot, so a late "running" update can never
+// overwrite a cancellation.
+func (s *BinlogAnalysisService) persist(ctx context.Context, id string) {
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	s.mu.RLock()
+	record, ok := s.records[id]
+	var task BinlogAnalysisTask
+	if ok {
+		task = record.task
+	}
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+	analysis, err := binlogAnalysisFromTask(task)
+	if err == nil {
+		err = s.repo.SaveAnalysis(context.WithoutCancel(ctx), analysis)
+	}
+	if err != nil {
+		log.Printf("binlog analysis: persist %s: %v", id, err)
+	}
 }
 
 func (s *BinlogAnalysisService) finishCanceled(id string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	record := s.records[id]
 	if record == nil || record.task.Status == BinlogAnalysisCanceled {
+		s.mu.Unlock()
 		return
 	}
 	now := time.Now().UTC()
@@ -259,6 +444,8 @@ func (s *BinlogAnalysisService) finishCanceled(id string) {
 	record.task.FinishedAt = &now
 	record.task.Progress.Phase = BinlogAnalysisCanceled
 	record.task.Progress.Message = "分析已取消"
+	s.mu.Unlock()
+	s.persist(s.ctx, id)
 }
 
 func (s *BinlogAnalysisService) target(ctx context.Context, machineID string, port int) (mysqlapp.Instance, machinedomain.Machine, error) {
@@ -327,12 +514,104 @@ func (s *BinlogAnalysisService) trimLocked() {
 	}
 }
 
-func newBinlogAnalysisID() string {
+// binlogAnalysisFromTask keeps everything but the DML event detail, which can
+// reach 20,000 rows per run and is not needed for reports or trends.
+func binlogAnalysisFromTask(task BinlogAnalysisTask) (binlogdomain.Analysis, error) {
+	analysis := binlogdomain.Analysis{
+		ID: task.ID, ScheduleID: task.ScheduleID, Cluster: task.Cluster, MachineID: task.Request.MachineID, Port: task.Request.Port,
+		Status: task.Status, Error: task.Error, WindowStart: task.Request.StartTime, WindowEnd: task.Request.EndTime,
+		CreatedAt: task.CreatedAt, StartedAt: task.StartedAt, FinishedAt: task.FinishedAt,
+	}
+	var err error
+	if analysis.Request, err = json.Marshal(task.Request); err != nil {
+		return analysis, err
+	}
+	if task.Summary != nil {
+		if analysis.Summary, err = json.Marshal(task.Summary); err != nil {
+			return analysis, err
+		}
+	} else if task.Rows != nil {
+		if analysis.Summary, err = json.Marshal(task.Rows); err != nil {
+			return analysis, err
+		}
+	}
+	if task.Result != nil {
+		report := *task.Result
+		report.DMLEvents = nil
+		if analysis.Report, err = json.Marshal(report); err != nil {
+			return analysis, err
+		}
+	}
+	return analysis, nil
+}
+
+func binlogAnalysisTaskFromStored(analysis binlogdomain.Analysis) (BinlogAnalysisTask, error) {
+	task := BinlogAnalysisTask{
+		ID: analysis.ID, ScheduleID: analysis.ScheduleID, Cluster: analysis.Cluster, Status: analysis.Status, Error: analysis.Error,
+		CreatedAt: analysis.CreatedAt, StartedAt: analysis.StartedAt, FinishedAt: analysis.FinishedAt,
+		Progress: binloganalyzer.Progress{Phase: analysis.Status, Message: binlogStoredMessage(analysis)},
+	}
+	if len(analysis.Request) > 0 {
+		if err := json.Unmarshal(analysis.Request, &task.Request); err != nil {
+			return task, err
+		}
+	}
+	if len(analysis.Summary) > 0 && task.Request.RowFilter != nil {
+		task.Rows = &binloganalyzer.RowSearchSummary{}
+		if err := json.Unmarshal(analysis.Summary, task.Rows); err != nil {
+			return task, err
+		}
+	} else if len(analysis.Summary) > 0 {
+		task.Summary = &binloganalyzer.Summary{}
+		if err := json.Unmarshal(analysis.Summary, task.Summary); err != nil {
+			return task, err
+		}
+	}
+	if len(analysis.Report) > 0 {
+		task.Result = &binloganalyzer.Result{}
+		if err := json.Unmarshal(analysis.Report, task.Result); err != nil {
+			return task, err
+		}
+		task.DMLDetailExpired = task.Result.Summary.DMLEventCount > 0
+	}
+	return task, nil
+}
+
+func binlogStoredMessage(analysis binlogdomain.Analysis) string {
+	switch analysis.Status {
+	case BinlogAnalysisCompleted:
+		return "分析完成"
+	case BinlogAnalysisCanceled:
+		return "分析已取消"
+	case BinlogAnalysisFailed:
+		return analysis.Error
+	default:
+		return ""
+	}
+}
+
+func binlogTableVolumes(task BinlogAnalysisTask) []binlogdomain.TableVolume {
+	if task.Result == nil {
+		return nil
+	}
+	items := make([]binlogdomain.TableVolume, 0, len(task.Result.Tables))
+	for _, table := range task.Result.Tables {
+		items = append(items, binlogdomain.TableVolume{
+			AnalysisID: task.ID, ScheduleID: task.ScheduleID, Cluster: task.Cluster, Schema: table.Schema, Table: table.Table,
+			WindowStart: task.Request.StartTime, WindowEnd: task.Request.EndTime,
+			InsertRows: int64(table.InsertRows), UpdateRows: int64(table.UpdateRows), DeleteRows: int64(table.DeleteRows),
+			TotalRows: int64(table.TotalRows), DDLCount: int64(table.DDLCount),
+		})
+	}
+	return items
+}
+
+func newBinlogAnalysisID(prefix string) string {
 	var suffix [4]byte
 	if _, err := rand.Read(suffix[:]); err != nil {
-		return fmt.Sprintf("binlog-%d", time.Now().UnixNano())
+		return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
 	}
-	return fmt.Sprintf("binlog-%d-%s", time.Now().Unix(), hex.EncodeToString(suffix[:]))
+	return fmt.Sprintf("%s-%d-%s", prefix, time.Now().Unix(), hex.EncodeToString(suffix[:]))
 }
 
 func normalizeBinlogMode(mode string) string {
@@ -342,6 +621,17 @@ func normalizeBinlogMode(mode string) string {
 	return binloganalyzer.BigTransactionRows
 }
 
+func normalizeBinlogAnalysisMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", binloganalyzer.ModeSummary:
+		return binloganalyzer.ModeSummary, nil
+	case binloganalyzer.ModeRows:
+		return binloganalyzer.ModeRows, nil
+	default:
+		return "", fmt.Errorf("不支持的分析模式 %q", mode)
+	}
+}
+
 func safeBinlogError(err error, secret string) string {
 	text := strings.TrimSpace(err.Error())
 	if secret != "" {
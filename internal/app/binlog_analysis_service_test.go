@@ -4,17 +4,130 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"gmha/internal/binloganalyzer"
+	binlogdomain "gmha/internal/domain/binloganalysis"
 	machinedomain "gmha/internal/domain/machine"
 	mysqlapp "gmha/internal/mysql"
 )
 
+type binlogMemoryRepo struct {
+	mu        sync.Mutex
+	analyses  map[string]binlogdomain.Analysis
+	volumes   map[string][]binlogdomain.TableVolume
+	schedules map[string]binlogdomain.Schedule
+}
+
+func newBinlogMemoryRepo() *binlogMemoryRepo {
+	return &binlogMemoryRepo{
+		analyses: map[string]binlogdomain.Analysis{}, volumes: map[string][]binlogdomain.TableVolume{},
+		schedules: map[string]binlogdomain.Schedule{},
+	}
+}
+
+func (r *binlogMemoryRepo) SaveAnalysis(_ context.Context, a binlogdomain.Analysis) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.analyses[a.ID] = a
+	return nil
+}
+
+func (r *binlogMemoryRepo) GetAnalysis(_ context.Context, id string) (binlogdomain.Analysis, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.analyses[id]
+	return a, ok, nil
+}
+
+func (r *binlogMemoryRepo) ListAnalyses(_ context.Context, cluster string, _ int) ([]binlogdomain.Analysis, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []binlogdomain.Analysis
+	for _, a := range r.analyses {
+		if cluster == "" || a.Cluster == cluster {
+			a.Report = nil
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (r *binlogMemoryRepo) FailInterruptedAnalyses(_ context.Context, message string, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, a := range r.analyses {
+		if a.Status == BinlogAnalysisQueued || a.Status == BinlogAnalysisRunning {
+			a.Status, a.Error, a.FinishedAt = BinlogAnalysisFailed, message, &now
+			r.analyses[id] = a
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *binlogMemoryRepo) PurgeAnalyses(context.Context, time.Time) (int64, error) { return 0, nil }
+
+func (r *binlogMemoryRepo) SaveTableVolumes(_ context.Context, id string, items []binlogdomain.TableVolume) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.volumes[id] = items
+	return nil
+}
+
+func (r *binlogMemoryRepo) ListTableVolumes(_ context.Context, cluster, scheduleID string, since time.Time) ([]binlogdomain.TableVolume, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []binlogdomain.TableVolume
+	for _, items := range r.volumes {
+		for _, v := range items {
+			if v.ScheduleID != "" && (cluster == "" || v.Cluster == cluster) && (scheduleID == "" || v.ScheduleID == scheduleID) && !v.WindowStart.Before(since) {
+				out = append(out, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *binlogMemoryRepo) SaveSchedule(_ context.Context, s binlogdomain.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedules[s.ID] = s
+	return nil
+}
+
+func (r *binlogMemoryRepo) GetSchedule(_ context.Context, id string) (binlogdomain.Schedule, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.schedules[id]
+	return s, ok, nil
+}
+
+func (r *binlogMemoryRepo) ListSchedules(context.Context, string) ([]binlogdomain.Schedule, error) {
+	return nil, nil
+}
+
+func (r *binlogMemoryRepo) ListDueSchedules(context.Context, time.Time) ([]binlogdomain.Schedule, error) {
+	return nil, nil
+}
+
+func (r *binlogMemoryRepo) UpdateScheduleRun(context.Context, string, time.Time, time.Time, bool, string) error {
+	return nil
+}
+
+func (r *binlogMemoryRepo) DeleteSchedule(context.Context, string) error { return nil }
+
 func newBinlogAnalysisTestService(t *testing.T) *BinlogAnalysisService {
 	t.Helper()
-	service := NewBinlogAnalysisService(
+	return newBinlogAnalysisTestServiceWithRepo(t, newBinlogMemoryRepo())
+}
+
+func newBinlogAnalysisTestServiceWithRepo(t *testing.T, repo binlogdomain.Repository) *BinlogAnalysisService {
+	t.Helper()
+	service := NewBinlogAnalysisService(repo,
 		&histogramInstanceRepo{item: mysqlapp.Instance{MachineID: "machine-1", Port: 3306, Version: "8.0.40"}},
 		&histogramMachineRepo{item: machinedomain.Machine{ID: "machine-1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"}},
 		histogramPresetRepo{},
@@ -45,7 +158,7 @@ func TestBinlogAnalysisUsesManagedCredentialWithoutExposingIt(t *testing.T) {
 	}
 	var completed BinlogAnalysisTask
 	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
-		completed, _ = service.Get(task.ID)
+		completed, _, _ = service.Get(context.Background(), task.ID)
 		if completed.Status == BinlogAnalysisCompleted {
 			break
 		}
@@ -77,8 +190,215 @@ func TestBinlogAnalysisCancelStopsRunningTask(t *testing.T) {
 		t.Fatal(err)
 	}
 	<-started
-	canceled, err := service.Cancel(task.ID)
+	canceled, err := service.Cancel(context.Background(), task.ID)
 	if err != nil || canceled.Status != BinlogAnalysisCanceled {
 		t.Fatalf("cancel failed: task=%+v err=%v", canceled, err)
 	}
 }
+
+// waitBinlogAnalysis waits for every run goroutine, including the persistence
+// and alert work that follows the analyzer.
+func waitBinlogAnalysis(t *testing.T, service *BinlogAnalysisService, id string) BinlogAnalysisTask {
+	t.Helper()
+	service.runs.Wait()
+	task, ok, err := service.Get(context.Background(), id)
+	if err != nil || !ok {
+		t.Fatalf("analysis %s not found: %v", id, err)
+	}
+	return task
+}
+
+func TestBinlogAnalysisReportSurvivesRestartWithoutDMLDetail(t *testing.T) {
+	repo := newBinlogMemoryRepo()
+	service := newBinlogAnalysisTestServiceWithRepo(t, repo)
+	service.analyze = func(context.Context, binloganalyzer.Config, func(binloganalyzer.Progress)) (*binloganalyzer.Result, error) {
+		return &binloganalyzer.Result{
+			Summary:   binloganalyzer.Summary{TotalRows: 5, DMLEventCount: 1, DDLCount: 1},
+			DMLEvents: []binloganalyzer.DMLEvent{{Schema: "orders", Table: "t1", Type: "insert", RowCount: 5}},
+			DDLEvents: []binloganalyzer.DDLEvent{{Schema: "orders", Object: "t1", Type: "ALTER TABLE"}},
+			Tables:    []binloganalyzer.TableSummary{{Schema: "orders", Table: "t1", InsertRows: 5, TotalRows: 5}},
+		}, nil
+	}
+	task, err := service.Create(context.Background(), BinlogAnalysisRequest{
+		MachineID: "machine-1", Port: 3306, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now(), BigTxnMode: "rows",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBinlogAnalysis(t, service, task.ID)
+	repo.analyses["binlog-stale"] = binlogdomain.Analysis{ID: "binlog-stale", Cluster: "orders", Status: BinlogAnalysisRunning}
+
+	restarted := newBinlogAnalysisTestServiceWithRepo(t, repo)
+	restarted.Start()
+	stored, ok, err := restarted.Get(context.Background(), task.ID)
+	if err != nil || !ok {
+		t.Fatalf("analysis should be loaded from the repository: ok=%v err=%v", ok, err)
+	}
+	if stored.Result == nil || len(stored.Result.Tables) != 1 || len(stored.Result.DDLEvents) != 1 || stored.Result.DMLEvents != nil {
+		t.Fatalf("stored report should keep tables and DDL but not DML detail: %+v", stored.Result)
+	}
+	if !stored.DMLDetailExpired || stored.Cluster != "orders" || stored.Request.MachineIP != "10.0.0.1" {
+		t.Fatalf("unexpected stored task: %+v", stored)
+	}
+	stale, _, _ := restarted.Get(context.Background(), "binlog-stale")
+	if stale.Status != BinlogAnalysisFailed || stale.Error == "" {
+		t.Fatalf("runs interrupted by a restart must be failed: %+v", stale)
+	}
+	items, err := restarted.List(context.Background(), "orders", 0)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("list should return stored analyses: %+v err=%v", items, err)
+	}
+}
+
+func TestBinlogAnalysisScheduleAlertsAndWeeklyTrend(t *testing.T) {
+	repo := newBinlogMemoryRepo()
+	service := newBinlogAnalysisTestServiceWithRepo(t, repo)
+	alertRepo := newAlertMemoryRepo()
+	service.SetAlertService(NewAlertService(alertRepo))
+	ddl := []binloganalyzer.DDLEvent{{Schema: "orders", Object: "tmp_20260701", Type: "CREATE TABLE"}}
+	service.analyze = func(context.Context, binloganalyzer.Config, func(binloganalyzer.Progress)) (*binloganalyzer.Result, error) {
+		return &binloganalyzer.Result{
+			Summary:         binloganalyzer.Summary{BigTxnCount: 1, DDLCount: len(ddl)},
+			BigTransactions: []binloganalyzer.BigTransaction{{RowCount: 50000, Tables: []string{"orders.items"}}},
+			DDLEvents:       ddl,
+			Tables:          []binloganalyzer.TableSummary{{Schema: "orders", Table: "items", UpdateRows: 50000, TotalRows: 50000}},
+		}, nil
+	}
+	schedule, err := service.SaveSchedule(context.Background(), binlogdomain.Schedule{
+		Name: "orders daily", MachineID: "machine-1", Port: 3306, ScheduleType: binlogdomain.ScheduleDaily,
+		StartAt: time.Now().Add(time.Hour), AlertBigTransactions: true, AlertDDL: true,
+		ExpectedDDL: []string{" Orders.TMP_* "}, Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Cluster != "orders" || schedule.WindowHours != 24 || schedule.BigTxnRowsThreshold != binlogDefaultBigTxnRows {
+		t.Fatalf("schedule defaults were not applied: %+v", schedule)
+	}
+
+	task, err := service.RunSchedule(context.Background(), schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := task.Request.EndTime.Sub(task.Request.StartTime); got != 24*time.Hour || task.ScheduleID != schedule.ID {
+		t.Fatalf("scheduled run should cover the previous window: %s %+v", got, task)
+	}
+	waitBinlogAnalysis(t, service, task.ID)
+	firing := map[string]string{}
+	for _, event := range alertRepo.events {
+		firing[event.RuleID] = event.Status
+	}
+	if firing[binlogBigTransactionRuleID] != "firing" || firing[binlogUnexpectedDDLRuleID] != "" {
+		t.Fatalf("expected only the big transaction alert, got %+v", firing)
+	}
+
+	ddl = []binloganalyzer.DDLEvent{{Schema: "orders", Object: "items", Type: "ALTER TABLE"}}
+	task, err = service.RunSchedule(context.Background(), schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitBinlogAnalysis(t, service, task.ID)
+	for _, event := range alertRepo.events {
+		if event.RuleID == binlogUnexpectedDDLRuleID && (event.Status != "firing" || !strings.Contains(event.Labels["message"], "orders.items")) {
+			t.Fatalf("unexpected DDL should fire with the object name: %+v", event)
+		}
+	}
+
+	trend, err := service.TableTrend(context.Background(), "orders", "", 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyses, updates := 0, int64(0)
+	for index, week := range trend.Weeks {
+		if week.Start.Weekday() != time.Monday {
+			t.Fatalf("weeks should start on Monday: %s", week.Start)
+		}
+		analyses += week.Analyses
+		if len(trend.Tables) == 1 {
+			updates += trend.Tables[0].Points[index].UpdateRows
+		}
+	}
+	if len(trend.Weeks) != 4 || analyses != 2 || len(trend.Tables) != 1 || updates != 100000 {
+		t.Fatalf("weekly volume should include both scheduled runs: %+v", trend)
+	}
+}
+
+func TestBinlogRowSearchStreamsToSpoolAndGeneratesFlashback(t *testing.T) {
+	repo := newBinlogMemoryRepo()
+	rowDir := t.TempDir()
+	service := newBinlogAnalysisTestServiceWithRepo(t, repo)
+	service.rowDir = rowDir
+	filters := make(chan binloganalyzer.RowFilter, 1)
+	base := binloganalyzer.RowChange{Schema: "shop", Table: "orders", Columns: []string{"id", "status"}, PrimaryKey: []string{"id"}, BinlogFile: "binlog.000007"}
+	service.search = func(_ context.Context, _ binloganalyzer.Config, filter binloganalyzer.RowFilter, emit func(binloganalyzer.RowChange) error, _ func(binloganalyzer.Progress)) (binloganalyzer.RowSearchSummary, error) {
+		filters <- filter
+		insert, update, del := base, base, base
+		insert.Seq, insert.Type, insert.After = 1, "INSERT", []any{uint64(18446744073709551615), "new"}
+		update.Seq, update.Type, update.Before, update.After = 2, "UPDATE", insert.After, []any{uint64(18446744073709551615), "paid"}
+		del.Seq, del.Type, del.Before = 3, "DELETE", update.After
+		for _, change := range []binloganalyzer.RowChange{insert, update, del} {
+			if err := emit(change); err != nil {
+				return binloganalyzer.RowSearchSummary{}, err
+			}
+		}
+		return binloganalyzer.RowSearchSummary{RowsMatched: 3, MaxRows: filter.MaxRows}, nil
+	}
+	if _, err := service.Create(context.Background(), BinlogAnalysisRequest{
+		MachineID: "machine-1", Port: 3306, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now(), Mode: "rows",
+	}); err == nil {
+		t.Fatal("rows mode without a schema must be rejected")
+	}
+	task, err := service.Create(context.Background(), BinlogAnalysisRequest{
+		MachineID: "machine-1", Port: 3306, StartTime: time.Now().Add(-time.Hour), EndTime: time.Now(), Mode: "rows",
+		RowFilter: binloganalyzer.RowFilter{Schema: "shop", Table: "orders", Match: map[string]string{"id": "18446744073709551615"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter := <-filters; filter.MaxRows != binloganalyzer.DefaultMaxRowChanges || filter.Match["id"] == "" {
+		t.Fatalf("unexpected row filter %+v", filter)
+	}
+	done := waitBinlogAnalysis(t, service, task.ID)
+	if done.Status != BinlogAnalysisCompleted || done.Rows == nil || done.Rows.RowsMatched != 3 || done.Result != nil {
+		t.Fatalf("unexpected rows task %+v", done)
+	}
+	if volumes, _ := repo.ListTableVolumes(context.Background(), "", "", time.Time{}); len(volumes) != 0 {
+		t.Fatalf("row searches must not feed write trends: %+v", volumes)
+	}
+
+	page, err := service.Rows(context.Background(), task.ID, 1, 1)
+	if err != nil || len(page.Items) != 1 || page.Items[0].Seq != 2 || !page.HasMore || page.NextOffset != 2 || page.Total != 3 {
+		t.Fatalf("unexpected page %+v err=%v", page, err)
+	}
+	script, err := service.Flashback(context.Background(), task.ID, []int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := strings.Index(script, "UPDATE `shop`.`orders` SET `id`=18446744073709551615, `status`='new' WHERE `id`=18446744073709551615 LIMIT 1;")
+	remove := strings.Index(script, "DELETE FROM `shop`.`orders` WHERE `id`=18446744073709551615 LIMIT 1;")
+	if update < 0 || remove < update || !strings.Contains(script, "SET time_zone = '+00:00';") {
+		t.Fatalf("flashback must revert newest first with exact values:\n%s", script)
+	}
+	if _, err := service.Flashback(context.Background(), task.ID, []int64{9}); err == nil {
+		t.Fatal("unknown seqs must be rejected")
+	}
+
+	restarted := newBinlogAnalysisTestServiceWithRepo(t, repo)
+	restarted.rowDir = rowDir
+	stored, _, _ := restarted.Get(context.Background(), task.ID)
+	if stored.Rows == nil || stored.Rows.RowsMatched != 3 || stored.Summary != nil || stored.RowsExpired {
+		t.Fatalf("stored row search should keep its summary: %+v", stored)
+	}
+	export, err := restarted.ExportRows(context.Background(), task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export.Close()
+	restarted.purgeRowFiles(time.Now().Add(time.Minute))
+	if stored, _, _ = restarted.Get(context.Background(), task.ID); !stored.RowsExpired {
+		t.Fatal("purged row results should be reported as expired")
+	}
+	if _, err := restarted.Rows(context.Background(), task.ID, 0, 0); err == nil {
+		t.Fatal("expired row results must not be readable")
+	}
+}
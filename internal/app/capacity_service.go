@@ -0,0 +1,531 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	capacitydomain "gmha/internal/domain/capacity"
+	machinedomain "gmha/internal/domain/machine"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	capacityForecastRuleID = "capacity_forecast"
+	// capacitySampleInterval refreshes today's sample a few times a day; the
+	// history keeps only the last sample of each day.
+	capacitySampleInterval = 6 * time.Hour
+	capacityRetentionDays  = 400
+	capacityTick           = 10 * time.Minute
+	// CapacityForecastWindowDays is the history a forecast fits its growth on.
+	CapacityForecastWindowDays = 30
+	// CapacityHorizonDays raises a warning when the datadir is forecast to be
+	// full within this many days; CapacityCriticalDays raises a critical one.
+	CapacityHorizonDays  = 30
+	CapacityCriticalDays = 7
+	capacityMinSamples   = 3
+)
+
+type capacityCaptureFunc func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential) ([]capacitydomain.TableSample, error)
+
+// capacityDiskMetrics reads the latest datadir filesystem usage the Agent
+// reports in the mysql_data_disk_usage metric.
+type capacityDiskMetrics interface {
+	GetMySQLDynamicMetrics(context.Context, string) (DynamicMetricsView, error)
+}
+
+// CapacityService samples table sizes of every running instance once a day
+// and forecasts when the datadir filesystem runs full.
+type CapacityService struct {
+	repo      capacitydomain.Repository
+	instances MySQLInstanceRepository
+	machines  machinedomain.Repository
+	presets   MySQLAccountPresetRepository
+	disks     capacityDiskMetrics
+	alerts    *AlertService
+	capture   capacityCaptureFunc
+
+	mu        sync.Mutex
+	capturing map[string]bool
+	started   bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewCapacityService(repo capacitydomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository, disks capacityDiskMetrics) *CapacityService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CapacityService{
+		repo: repo, instances: instances, machines: machines, presets: presets, disks: disks, capture: captureTableSizes,
+		capturing: make(map[string]bool), ctx: ctx, cancel: cancel, done: make(chan struct{}),
+	}
+}
+
+// SetAlertService enables days-to-full forecast alerts.
+func (s *CapacityService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+func (s *CapacityService) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+	go s.loop(s.ctx)
+}
+
+func (s *CapacityService) Close() {
+	if s == nil || s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+}
+
+// Collect samples the table sizes and datadir usage of one instance and
+// stores them as today's sample.
+func (s *CapacityService) Collect(ctx context.Context, machineID string, port int) (capacitydomain.InstanceSample, error) {
+	instance, machine, err := s.target(ctx, machineID, port)
+	if err != nil {
+		return capacitydomain.InstanceSample{}, err
+	}
+	credential, err := s.credential(ctx)
+	if err != nil {
+		return capacitydomain.InstanceSample{}, err
+	}
+	key := schemaInstanceKey(machine.ID, port)
+	s.mu.Lock()
+	if s.capturing[key] {
+		s.mu.Unlock()
+		return capacitydomain.InstanceSample{}, fmt.Errorf("实例 %s:%d 正在采集表容量", machine.IP, port)
+	}
+	s.capturing[key] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.capturing, key)
+		s.mu.Unlock()
+	}()
+
+	tables, err := s.capture(ctx, machine, port, credential)
+	if err != nil {
+		return capacitydomain.InstanceSample{}, fmt.Errorf("读取实例 %s:%d 表容量失败: %s", machine.IP, port, safeBinlogError(err, credential.Password))
+	}
+	now := time.Now().UTC()
+	sample := capacitydomain.InstanceSample{
+		Cluster: machine.Cluster, MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP,
+		Port: port, Day: now.Format(capacitydomain.DayLayout), TableCount: len(tables), DataDir: instance.DataDir, CollectedAt: now,
+	}
+	for _, table := range tables {
+		sample.Rows += table.Rows
+		sample.TableBytes += table.DataBytes + table.IndexBytes
+	}
+	s.diskUsage(ctx, machine, port, &sample)
+	if err := s.repo.SaveSamples(ctx, sample, tables); err != nil {
+		return capacitydomain.InstanceSample{}, err
+	}
+	return sample, nil
+}
+
+// History returns the daily samples of one instance over the last days.
+func (s *CapacityService) History(ctx context.Context, machineID string, port, days int) ([]capacitydomain.InstanceSample, error) {
+	if strings.TrimSpace(machineID) == "" || port < 1 || port > 65535 {
+		return nil, errors.New("machine_id 与 port 必填")
+	}
+	if days <= 0 || days > capacityRetentionDays {
+		days = 90
+	}
+	items, err := s.repo.ListInstanceSamples(ctx, strings.TrimSpace(machineID), port, capacitySinceDay(time.Now(), days))
+	if items == nil {
+		items = []capacitydomain.InstanceSample{}
+	}
+	return items, err
+}
+
+// Forecasts returns the days-to-full forecast of every running instance of a
+// cluster (or all clusters), the most urgent first.
+func (s *CapacityService) Forecasts(ctx context.Context, cluster string, horizonDays int) ([]capacitydomain.Forecast, error) {
+	if horizonDays <= 0 {
+		horizonDays = CapacityHorizonDays
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	since := capacitySinceDay(now, CapacityForecastWindowDays)
+	out := make([]capacitydomain.Forecast, 0)
+	for _, instance := range instances {
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		samples, err := s.repo.ListInstanceSamples(ctx, instance.MachineID, instance.Port, since)
+		if err != nil {
+			return nil, err
+		}
+		if len(samples) == 0 || (cluster != "" && samples[len(samples)-1].Cluster != cluster) {
+			continue
+		}
+		out = append(out, capacityForecast(samples, horizonDays, now))
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		left, right := out[i].DaysToFull, out[j].DaysToFull
+		switch {
+		case left != nil && right != nil:
+			return *left < *right
+		case left != nil || right != nil:
+			return left != nil
+		}
+		return out[i].MachineID+strconv.Itoa(out[i].Port) < out[j].MachineID+strconv.Itoa(out[j].Port)
+	})
+	return out, nil
+}
+
+// TopGrowingTables ranks tables of a cluster by bytes gained per day over the
+// last days.
+func (s *CapacityService) TopGrowingTables(ctx context.Context, cluster string, days, limit int) ([]capacitydomain.TableGrowth, error) {
+	if days <= 1 || days > capacityRetentionDays {
+		days = CapacityForecastWindowDays
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 20
+	}
+	samples, err := s.repo.ListTableSamples(ctx, strings.TrimSpace(cluster), capacitySinceDay(time.Now(), days))
+	if err != nil {
+		return nil, err
+	}
+	out := capacityTableGrowth(samples)
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *CapacityService) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(capacityTick)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		s.collectDue(ctx)
+		s.evaluate(ctx)
+		if time.Since(lastPurge) >= 24*time.Hour {
+			lastPurge = time.Now()
+			if n, err := s.repo.Purge(ctx, capacitySinceDay(time.Now(), capacityRetentionDays)); err != nil {
+				log.Printf("capacity: purge: %v", err)
+			} else if n > 0 {
+				log.Printf("capacity: purged %d samples", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *CapacityService) collectDue(ctx context.Context) {
+	if _, err := s.credential(ctx); err != nil {
+		return
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		log.Printf("capacity: list instances: %v", err)
+		return
+	}
+	today := time.Now().UTC().Format(capacitydomain.DayLayout)
+	for _, instance := range instances {
+		if ctx.Err() != nil {
+			return
+		}
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		samples, err := s.repo.ListInstanceSamples(ctx, instance.MachineID, instance.Port, today)
+		if err != nil {
+			log.Printf("capacity: latest %s:%d: %v", instance.MachineID, instance.Port, err)
+			continue
+		}
+		if len(samples) > 0 && time.Since(samples[len(samples)-1].CollectedAt) < capacitySampleInterval {
+			continue
+		}
+		if _, err := s.Collect(ctx, instance.MachineID, instance.Port); err != nil {
+			log.Printf("capacity: collect %s:%d: %v", instance.MachineID, instance.Port, err)
+		}
+	}
+}
+
+func (s *CapacityService) evaluate(ctx context.Context) {
+	if s.alerts == nil {
+		return
+	}
+	items, err := s.Forecasts(ctx, "", CapacityHorizonDays)
+	if err != nil {
+		log.Printf("capacity: forecasts: %v", err)
+		return
+	}
+	for _, item := range items {
+		signal := AlertSignal{
+			RuleID: capacityForecastRuleID, RuleName: "数据盘容量预计耗尽", Metric: "capacity_days_to_full", Category: "capacity",
+			MachineID: item.MachineID, MachineName: item.MachineName, MachineIP: item.MachineIP, ClusterID: item.Cluster,
+			Labels:    map[string]string{"cluster": item.Cluster, "mysql_port": strconv.Itoa(item.Port), "data_dir": item.DataDir},
+			Threshold: CapacityHorizonDays, Operator: "<=",
+		}
+		if item.Status != capacitydomain.ForecastWarning && item.Status != capacitydomain.ForecastCritical {
+			_ = s.alerts.ResolveSignal(ctx, signal)
+			continue
+		}
+		signal.Value = math.Round(*item.DaysToFull*10) / 10
+		signal.Severity = alertdomain.SeverityWarning
+		if item.Status == capacitydomain.ForecastCritical {
+			signal.Severity = alertdomain.SeverityCritical
+		}
+		signal.Message = fmt.Sprintf("实例 %s:%d 数据目录 %s 按近期增长 %s/天 预计 %.1f 天后写满（剩余 %s）",
+			item.MachineIP, item.Port, item.DataDir, capacityBytes(math.Max(item.TableGrowthBytesPerDay, item.DiskGrowthBytesPerDay)),
+			*item.DaysToFull, capacityBytes(float64(item.DiskAvailableBytes)))
+		_ = s.alerts.RaiseSignal(ctx, signal)
+	}
+}
+
+func (s *CapacityService) diskUsage(ctx context.Context, machine machinedomain.Machine, port int, sample *capacitydomain.InstanceSample) {
+	if s.disks == nil {
+		return
+	}
+	view, err := s.disks.GetMySQLDynamicMetrics(ctx, machine.IP+":"+strconv.Itoa(port))
+	if err != nil {
+		return
+	}
+	for _, metric := range view.Metrics {
+		if metric.Name != "mysql_data_disk_usage" || !metric.Success {
+			continue
+		}
+		value, ok := metric.Value.(map[string]any)
+		if !ok {
+			continue
+		}
+		total, _ := performanceNumber(value["total_bytes"])
+		used, _ := performanceNumber(value["used_bytes"])
+		available, _ := performanceNumber(value["available_bytes"])
+		if total <= 0 {
+			continue
+		}
+		sample.DiskTotalBytes, sample.DiskUsedBytes, sample.DiskAvailableBytes = int64(total), int64(used), int64(available)
+		if path, _ := value["path"].(string); path != "" {
+			sample.DataDir = path
+		}
+		return
+	}
+}
+
+func (s *CapacityService) target(ctx context.Context, machineID string, port int) (mysqlapp.Instance, machinedomain.Machine, error) {
+	machineID = strings.TrimSpace(machineID)
+	if machineID == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("machine_id is required")
+	}
+	if port < 1 || port > 65535 {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("port must be between 1 and 65535")
+	}
+	instance, ok, err := s.instances.Get(ctx, machineID, port)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("MySQL 实例 %s:%d 未登记", machineID, port)
+	}
+	machine, ok, err := s.machines.GetByID(ctx, machineID)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok || strings.TrimSpace(machine.IP) == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("实例 %s:%d 的机器地址不可用", machineID, port)
+	}
+	return instance, machine, nil
+}
+
+func (s *CapacityService) credential(ctx context.Context) (mysqlapp.DiagnosticCredential, error) {
+	if s.presets == nil {
+		return mysqlapp.DiagnosticCredential{}, errors.New("表容量采集需要已配置的 MHA 管理账号")
+	}
+	items, err := s.presets.List(ctx)
+	if err != nil {
+		return mysqlapp.DiagnosticCredential{}, err
+	}
+	for _, item := range normalizeMySQLAccountPresets(items) {
+		if !item.Enabled || !strings.EqualFold(strings.TrimSpace(item.Role), mysqlapp.AccountRoleMHA) {
+			continue
+		}
+		if strings.TrimSpace(item.Username) != "" && item.Password != "" {
+			return mysqlapp.DiagnosticCredential{Username: strings.TrimSpace(item.Username), Password: item.Password}, nil
+		}
+	}
+	return mysqlapp.DiagnosticCredential{}, errors.New("表容量采集需要已启用且凭据完整的 MHA 管理账号")
+}
+
+func captureTableSizes(ctx context.Context, machine machinedomain.Machine, port int, credential mysqlapp.DiagnosticCredential) ([]capacitydomain.TableSample, error) {
+	client := mysqlapp.DiagnosticClient{QueryTimeout: 60 * time.Second}
+	db, err := client.Open(sqldomain.Instance{MachineID: machine.ID, MachineIP: machine.IP, Port: port}, credential)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return client.TableSizes(ctx, db)
+}
+
+// capacityForecast fits a line through the daily samples of one instance. It
+// needs a few days of history; a single day says nothing about growth.
+func capacityForecast(samples []capacitydomain.InstanceSample, horizonDays int, now time.Time) capacitydomain.Forecast {
+	last := samples[len(samples)-1]
+	forecast := capacitydomain.Forecast{
+		Cluster: last.Cluster, MachineID: last.MachineID, MachineName: last.MachineName, MachineIP: last.MachineIP,
+		Port: last.Port, DataDir: last.DataDir, Samples: len(samples), FirstDay: samples[0].Day, LastDay: last.Day,
+		TableBytes: last.TableBytes, DiskTotalBytes: last.DiskTotalBytes, DiskAvailableBytes: last.DiskAvailableBytes,
+	}
+	var tablePoints, diskPoints []capacityPoint
+	for _, sample := range samples {
+		tablePoints = append(tablePoints, capacityPoint{day: sample.Day, value: float64(sample.TableBytes)})
+		if sample.DiskTotalBytes > 0 {
+			diskPoints = append(diskPoints, capacityPoint{day: sample.Day, value: float64(sample.DiskUsedBytes)})
+		}
+	}
+	if len(samples) < capacityMinSamples {
+		forecast.Status = capacitydomain.ForecastInsufficient
+		return forecast
+	}
+	forecast.TableGrowthBytesPerDay = capacityRound(capacitySlope(tablePoints))
+	if len(diskPoints) >= capacityMinSamples {
+		forecast.DiskGrowthBytesPerDay = capacityRound(capacitySlope(diskPoints))
+	}
+	rate := math.Max(forecast.TableGrowthBytesPerDay, forecast.DiskGrowthBytesPerDay)
+	switch {
+	case last.DiskTotalBytes <= 0:
+		forecast.Status = capacitydomain.ForecastNoDisk
+		return forecast
+	case rate <= 0:
+		forecast.Status = capacitydomain.ForecastStable
+		return forecast
+	}
+	days := math.Round(float64(last.DiskAvailableBytes)/rate*10) / 10
+	full := now.Add(time.Duration(days * float64(24*time.Hour))).UTC()
+	forecast.DaysToFull, forecast.FullAt = &days, &full
+	switch {
+	case days <= CapacityCriticalDays:
+		forecast.Status = capacitydomain.ForecastCritical
+	case days <= float64(horizonDays):
+		forecast.Status = capacitydomain.ForecastWarning
+	default:
+		forecast.Status = capacitydomain.ForecastOK
+	}
+	return forecast
+}
+
+// capacityTableGrowth expects samples ordered by table and day, as returned
+// by the repository.
+func capacityTableGrowth(samples []capacitydomain.TableSample) []capacitydomain.TableGrowth {
+	out := make([]capacitydomain.TableGrowth, 0)
+	var total float64
+	for start := 0; start < len(samples); {
+		end := start + 1
+		for end < len(samples) && capacityTableKey(samples[end]) == capacityTableKey(samples[start]) {
+			end++
+		}
+		group := samples[start:end]
+		start = end
+		if len(group) < 2 {
+			continue
+		}
+		first, last := group[0], group[len(group)-1]
+		bytes, rows := make([]capacityPoint, len(group)), make([]capacityPoint, len(group))
+		for index, sample := range group {
+			bytes[index] = capacityPoint{day: sample.Day, value: float64(sample.DataBytes + sample.IndexBytes)}
+			rows[index] = capacityPoint{day: sample.Day, value: float64(sample.Rows)}
+		}
+		growth := capacitydomain.TableGrowth{
+			Cluster: last.Cluster, MachineID: last.MachineID, Port: last.Port, Schema: last.Schema, Table: last.Table,
+			FirstDay: first.Day, LastDay: last.Day, Rows: last.Rows, TotalBytes: last.DataBytes + last.IndexBytes,
+			GrowthBytes:       last.DataBytes + last.IndexBytes - first.DataBytes - first.IndexBytes,
+			GrowthBytesPerDay: capacityRound(capacitySlope(bytes)), GrowthRowsPerDay: capacityRound(capacitySlope(rows)),
+		}
+		if growth.GrowthBytesPerDay <= 0 {
+			continue
+		}
+		total += growth.GrowthBytesPerDay
+		out = append(out, growth)
+	}
+	for index := range out {
+		out[index].ShareOfGrowthRatio = math.Round(out[index].GrowthBytesPerDay/total*1000) / 1000
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].GrowthBytesPerDay > out[j].GrowthBytesPerDay })
+	return out
+}
+
+type capacityPoint struct {
+	day   string
+	value float64
+}
+
+// capacitySlope is the least-squares growth per day. Missing days are fine:
+// x is the real day offset, not the sample index.
+func capacitySlope(points []capacityPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	origin, err := time.Parse(capacitydomain.DayLayout, points[0].day)
+	if err != nil {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range points {
+		day, err := time.Parse(capacitydomain.DayLayout, point.day)
+		if err != nil {
+			return 0
+		}
+		x := day.Sub(origin).Hours() / 24
+		sumX, sumY, sumXY, sumXX = sumX+x, sumY+point.value, sumXY+x*point.value, sumXX+x*x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func capacityTableKey(sample capacitydomain.TableSample) string {
+	return sample.MachineID + "\x00" + strconv.Itoa(sample.Port) + "\x00" + sample.Schema + "\x00" + sample.Table
+}
+
+func capacitySinceDay(now time.Time, days int) string {
+	return now.UTC().AddDate(0, 0, -days).Format(capacitydomain.DayLayout)
+}
+
+func capacityRound(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func capacityBytes(value float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	index := 0
+	for math.Abs(value) >= 1024 && index < len(units)-1 {
+		value /= 1024
+		index++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[index])
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	capacitydomain "gmha/internal/domain/capacity"
+	dynamicdomain "gmha/internal/domain/dynamic"
+	machinedomain "gmha/internal/domain/machine"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const capacityGB = int64(1) << 30
+
+type capacityMemoryRepo struct {
+	instances []capacitydomain.InstanceSample
+	tables    []capacitydomain.TableSample
+}
+
+func (r *capacityMemoryRepo) SaveSamples(_ context.Context, instance capacitydomain.InstanceSample, tables []capacitydomain.TableSample) error {
+	r.instances = append(r.instances, instance)
+	for _, table := range tables {
+		table.Cluster, table.MachineID, table.Port, table.Day = instance.Cluster, instance.MachineID, instance.Port, instance.Day
+		r.tables = append(r.tables, table)
+	}
+	return nil
+}
+
+func (r *capacityMemoryRepo) ListInstanceSamples(_ context.Context, machineID string, port int, sinceDay string) ([]capacitydomain.InstanceSample, error) {
+	var out []capacitydomain.InstanceSample
+	for _, item := range r.instances {
+		if item.MachineID == machineID && item.Port == port && item.Day >= sinceDay {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+func (r *capacityMemoryRepo) ListTableSamples(_ context.Context, cluster, sinceDay string) ([]capacitydomain.TableSample, error) {
+	var out []capacitydomain.TableSample
+	for _, item := range r.tables {
+		if (cluster == "" || item.Cluster == cluster) && item.Day >= sinceDay {
+			out = append(out, item)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return capacityTableKey(out[i]) < capacityTableKey(out[j]) })
+	return out, nil
+}
+
+func (r *capacityMemoryRepo) Purge(context.Context, string) (int64, error) { return 0, nil }
+
+type capacityDiskFake struct{ used, total int64 }
+
+func (f capacityDiskFake) GetMySQLDynamicMetrics(context.Context, string) (DynamicMetricsView, error) {
+	return DynamicMetricsView{Metrics: []dynamicdomain.MetricResult{{
+		Name: "mysql_data_disk_usage", Success: true,
+		Value: map[string]any{"path": "/data/3306/data", "total_bytes": float64(f.total), "used_bytes": float64(f.used), "available_bytes": float64(f.total - f.used)},
+	}}}, nil
+}
+
+func TestCapacityServiceForecastsDaysToFullAndAlerts(t *testing.T) {
+	ctx := context.Background()
+	repo := &capacityMemoryRepo{}
+	now := time.Now().UTC()
+	// Tables grow 2 GB a day, the filesystem 10 GB a day (binlogs): the
+	// forecast must follow the faster one. 40 GB remain, so four days.
+	for day := 9; day >= 1; day-- {
+		used := 500*capacityGB - int64(day)*10*capacityGB
+		repo.instances = append(repo.instances, capacitydomain.InstanceSample{
+			Cluster: "orders", MachineID: "m1", MachineIP: "10.0.0.1", Port: 3306, Day: now.AddDate(0, 0, -day).Format(capacitydomain.DayLayout),
+			TableBytes: 100*capacityGB - int64(day)*2*capacityGB, DataDir: "/data/3306/data",
+			DiskTotalBytes: 550 * capacityGB, DiskUsedBytes: used, DiskAvailableBytes: 550*capacityGB - used,
+		})
+	}
+	instances := &schemaInstanceRepo{items: []mysqlapp.Instance{{MachineID: "m1", Port: 3306, DataDir: "/data/3306/data", Status: mysqlapp.StatusRunning}}}
+	machines := &schemaMachineRepo{items: map[string]machinedomain.Machine{"m1": {ID: "m1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"}}}
+	service := NewCapacityService(repo, instances, machines, histogramPresetRepo{}, capacityDiskFake{used: 510 * capacityGB, total: 550 * capacityGB})
+	alertRepo := newAlertMemoryRepo()
+	service.SetAlertService(NewAlertService(alertRepo))
+	service.capture = func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential) ([]capacitydomain.TableSample, error) {
+		return []capacitydomain.TableSample{
+			{Schema: "shop", Table: "orders", Rows: 1000, DataBytes: 90 * capacityGB, IndexBytes: 10 * capacityGB},
+			{Schema: "shop", Table: "users", Rows: 10, DataBytes: capacityGB},
+		}, nil
+	}
+
+	sample, err := service.Collect(ctx, "m1", 3306)
+	if err != nil || sample.TableBytes != 101*capacityGB || sample.DiskAvailableBytes != 40*capacityGB || sample.Rows != 1010 {
+		t.Fatalf("unexpected sample %+v err=%v", sample, err)
+	}
+	forecasts, err := service.Forecasts(ctx, "orders", 0)
+	if err != nil || len(forecasts) != 1 {
+		t.Fatalf("forecasts=%+v err=%v", forecasts, err)
+	}
+	forecast := forecasts[0]
+	if forecast.Status != capacitydomain.ForecastCritical || forecast.DaysToFull == nil || *forecast.DaysToFull < 3.5 || *forecast.DaysToFull > 4.5 {
+		t.Fatalf("disk growth should drive a ~4 day forecast: %+v days=%v", forecast, forecast.DaysToFull)
+	}
+	if forecast.TableGrowthBytesPerDay >= forecast.DiskGrowthBytesPerDay {
+		t.Fatalf("table growth should be slower than disk growth: %+v", forecast)
+	}
+
+	service.evaluate(ctx)
+	if len(alertRepo.events) != 1 {
+		t.Fatalf("critical forecast must alert, got %v", alertRepo.events)
+	}
+	for _, event := range alertRepo.events {
+		if event.RuleID != capacityForecastRuleID || event.Severity != "critical" {
+			t.Fatalf("unexpected alert %+v", event)
+		}
+	}
+}
+
+func TestCapacityTableGrowthRanksByBytesPerDay(t *testing.T) {
+	var samples []capacitydomain.TableSample
+	for day := 1; day <= 5; day++ {
+		date := time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC).Format(capacitydomain.DayLayout)
+		samples = append(samples,
+			capacitydomain.TableSample{MachineID: "m1", Port: 3306, Schema: "shop", Table: "logs", Day: date, DataBytes: int64(day) * 3 * capacityGB, Rows: int64(day) * 300},
+			capacitydomain.TableSample{MachineID: "m1", Port: 3306, Schema: "shop", Table: "orders", Day: date, DataBytes: int64(day) * capacityGB, Rows: int64(day) * 100},
+			capacitydomain.TableSample{MachineID: "m1", Port: 3306, Schema: "shop", Table: "static", Day: date, DataBytes: capacityGB},
+		)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return capacityTableKey(samples[i]) < capacityTableKey(samples[j]) })
+	growth := capacityTableGrowth(samples)
+	if len(growth) != 2 || growth[0].Table != "logs" || growth[0].GrowthBytesPerDay != float64(3*capacityGB) ||
+		growth[0].GrowthRowsPerDay != 300 || growth[0].ShareOfGrowthRatio != 0.75 || growth[0].GrowthBytes != 12*capacityGB {
+		t.Fatalf("unexpected growth ranking %+v", growth)
+	}
+}
@@ -0,0 +1,701 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	certdomain "gmha/internal/domain/certificate"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const (
+	certificateNotAfterMarker = "__GMHA_TLS_NOT_AFTER__"
+	certificateExpiryRuleID   = "tls_certificate_expiry"
+	certificateCheckInterval  = time.Hour
+	certificateKeyBits        = 2048
+)
+
+var certificateHostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*$`)
+
+// CertificateDeployRequest selects the instances of a cluster to (re)issue.
+// MySQL older than 8.0.16 cannot reload TLS online; AllowRestart permits a
+// service restart there instead of failing the instance.
+type CertificateDeployRequest struct {
+	MachineIDs   []string `json:"machine_ids,omitempty"`
+	AllowRestart bool     `json:"allow_restart,omitempty"`
+}
+
+// CertificateOverview is the cluster TLS page: policy, CA and the newest
+// certificate of every instance.
+type CertificateOverview struct {
+	ClusterID    string                   `json:"cluster_id"`
+	Policy       certdomain.Policy        `json:"policy"`
+	Authority    *certdomain.Authority    `json:"authority,omitempty"`
+	Certificates []certdomain.Certificate `json:"certificates"`
+}
+
+type certificateTarget struct {
+	machine  machinedomain.Machine
+	instance mysqlapp.Instance
+}
+
+type CertificateService struct {
+	repo      certdomain.Repository
+	tasks     *TaskService
+	machines  machinedomain.Repository
+	instances MySQLInstanceRepository
+	alerts    *AlertService
+	issueMu   sync.Mutex
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+}
+
+func NewCertificateService(repo certdomain.Repository, tasks *TaskService, machines machinedomain.Repository, instances MySQLInstanceRepository) *CertificateService {
+	return &CertificateService{repo: repo, tasks: tasks, machines: machines, instances: instances}
+}
+
+// SetAlertService enables expiry alerts through the shared alert pipeline.
+func (s *CertificateService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+func (s *CertificateService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.expiryLoop(ctx)
+}
+
+func (s *CertificateService) Close() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *CertificateService) expiryLoop(ctx context.Context) {
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.CheckExpiry(ctx); err != nil {
+				log.Printf("certificate expiry check: %v", err)
+			}
+		}
+	}
+}
+
+// Authority returns the Manager CA, creating it on first use.
+func (s *CertificateService) Authority(ctx context.Context) (certdomain.Authority, error) {
+	authority, err := s.ensureAuthority(ctx)
+	return authority.Redacted(), err
+}
+
+func (s *CertificateService) ensureAuthority(ctx context.Context) (certdomain.Authority, error) {
+	s.issueMu.Lock()
+	defer s.issueMu.Unlock()
+	authority, ok, err := s.repo.GetAuthority(ctx, certdomain.DefaultAuthorityID)
+	if err != nil || ok {
+		return authority, err
+	}
+	authority, err = newCertificateAuthority(time.Now().UTC(), certdomain.DefaultCAValidityDays)
+	if err != nil {
+		return certdomain.Authority{}, err
+	}
+	return authority, s.repo.SaveAuthority(ctx, authority)
+}
+
+func (s *CertificateService) GetPolicy(ctx context.Context, clusterID string) (certdomain.Policy, error) {
+	clusterID = strings.TrimSpace(clusterID)
+	policy, _, err := s.repo.GetPolicy(ctx, clusterID)
+	if err != nil {
+		return certdomain.Policy{}, err
+	}
+	policy.ClusterID = clusterID
+	return normalizeCertificatePolicy(policy), nil
+}
+
+func (s *CertificateService) SavePolicy(ctx context.Context, policy certdomain.Policy) (certdomain.Policy, error) {
+	policy.ClusterID = strings.TrimSpace(policy.ClusterID)
+	policy = normalizeCertificatePolicy(policy)
+	if err := validateCertificatePolicy(policy); err != nil {
+		return certdomain.Policy{}, err
+	}
+	policy.UpdatedAt = time.Now().UTC()
+	return policy, s.repo.SavePolicy(ctx, policy)
+}
+
+func (s *CertificateService) Overview(ctx context.Context, clusterID string) (CertificateOverview, error) {
+	policy, err := s.GetPolicy(ctx, clusterID)
+	if err != nil {
+		return CertificateOverview{}, err
+	}
+	overview := CertificateOverview{ClusterID: policy.ClusterID, Policy: policy, Certificates: []certdomain.Certificate{}}
+	if authority, ok, err := s.repo.GetAuthority(ctx, certdomain.DefaultAuthorityID); err != nil {
+		return CertificateOverview{}, err
+	} else if ok {
+		redacted := authority.Redacted()
+		overview.Authority = &redacted
+	}
+	items, err := s.ListCertificates(ctx, clusterID)
+	if err != nil {
+		return CertificateOverview{}, err
+	}
+	seen := map[string]bool{}
+	for _, item := range items {
+		key := fmt.Sprintf("%s:%d", item.MachineID, item.Port)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		overview.Certificates = append(overview.Certificates, item)
+	}
+	return overview, nil
+}
+
+func (s *CertificateService) ListCertificates(ctx context.Context, clusterID string) ([]certdomain.Certificate, error) {
+	items, err := s.repo.ListCertificates(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	for index := range items {
+		items[index] = items[index].Redacted()
+	}
+	return items, nil
+}
+
+// IssueMySQLServerCertificate implements taskusecase.MySQLTLSIssuer. The
+// certificate becomes active immediately because the install task is the only
+// writer of the instance directory.
+func (s *CertificateService) IssueMySQLServerCertificate(ctx context.Context, machine machinedomain.Machine, port int, directory string) (taskdomain.MySQLTLSSpec, error) {
+	if compatible, _ := s.tasks.MachineCapability(machine.ID, taskdomain.CapabilityMySQLInstallTLS); !compatible {
+		return taskdomain.MySQLTLSSpec{}, errors.New("Agent 版本过旧，不支持安装时下发 TLS 证书，请先升级 Agent")
+	}
+	policy, err := s.GetPolicy(ctx, machine.Cluster)
+	if err != nil {
+		return taskdomain.MySQLTLSSpec{}, err
+	}
+	authority, err := s.ensureAuthority(ctx)
+	if err != nil {
+		return taskdomain.MySQLTLSSpec{}, err
+	}
+	certificate, err := issueServerCertificate(authority, machine, port, directory, policy.ValidityDays, time.Now().UTC())
+	if err != nil {
+		return taskdomain.MySQLTLSSpec{}, err
+	}
+	certificate.Reason = certdomain.ReasonInstall
+	if err := s.activate(ctx, certificate); err != nil {
+		return taskdomain.MySQLTLSSpec{}, err
+	}
+	return taskdomain.MySQLTLSSpec{Directory: certificate.Directory, CAPEM: authority.CertPEM, CertPEM: certificate.CertPEM, KeyPEM: certificate.KeyPEM}, nil
+}
+
+// activate stores certificate as the only active one for its instance.
+func (s *CertificateService) activate(ctx context.Context, certificate certdomain.Certificate) error {
+	previous, ok, err := s.repo.GetActiveCertificate(ctx, certificate.MachineID, certificate.Port)
+	if err != nil {
+		return err
+	}
+	certificate.Status = certdomain.StatusActive
+	certificate.UpdatedAt = time.Now().UTC()
+	if err := s.repo.SaveCertificate(ctx, certificate); err != nil {
+		return err
+	}
+	if ok && previous.ID != certificate.ID {
+		previous.Status = certdomain.StatusSuperseded
+		previous.UpdatedAt = certificate.UpdatedAt
+		return s.repo.SaveCertificate(ctx, previous)
+	}
+	return nil
+}
+
+// Deploy issues and installs certificates on every running instance of the
+// cluster (or the selected machines) and reloads TLS.
+func (s *CertificateService) Deploy(ctx context.Context, clusterID string, req CertificateDeployRequest) (TaskDetail, error) {
+	return s.startRollout(ctx, clusterID, certdomain.ReasonDeploy, req)
+}
+
+// Rotate replaces the active certificate of every instance that already has
+// one. Instances without a managed certificate are left to Deploy.
+func (s *CertificateService) Rotate(ctx context.Context, clusterID string, req CertificateDeployRequest) (TaskDetail, error) {
+	return s.startRollout(ctx, clusterID, certdomain.ReasonRotate, req)
+}
+
+func (s *CertificateService) startRollout(ctx context.Context, clusterID, reason string, req CertificateDeployRequest) (TaskDetail, error) {
+	clusterID = strings.TrimSpace(clusterID)
+	if clusterID == "" {
+		return TaskDetail{}, errors.New("cluster is required")
+	}
+	policy, err := s.GetPolicy(ctx, clusterID)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	targets, err := s.rolloutTargets(ctx, clusterID, reason, req)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	for _, target := range targets {
+		if compatible, reason := s.tasks.MachineCapability(target.machine.ID, taskdomain.CapabilityMySQLDefaultsFile); !compatible {
+			return TaskDetail{}, fmt.Errorf("%s: %s", target.machine.Name, reason)
+		}
+		if !mysqlapp.SupportsTLSReloadForVersion(target.instance.Version) && !req.AllowRestart {
+			return TaskDetail{}, fmt.Errorf("%s:%d 运行 MySQL %s，不支持 ALTER INSTANCE RELOAD TLS，需要设置 allow_restart 重启生效", target.machine.Name, target.instance.Port, target.instance.Version)
+		}
+	}
+	authority, err := s.ensureAuthority(ctx)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	display := "部署 TLS 证书 "
+	if reason == certdomain.ReasonRotate {
+		display = "轮换 TLS 证书 "
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "tls_certificate_"+reason, display+clusterID, clusterID)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	go s.runRollout(context.Background(), parent.Task.ID, authority, policy, reason, targets)
+	return parent, nil
+}
+
+func (s *CertificateService) rolloutTargets(ctx context.Context, clusterID, reason string, req CertificateDeployRequest) ([]certificateTarget, error) {
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]machinedomain.Machine)
+	for _, machine := range machines {
+		if machine.Cluster == clusterID && (len(req.MachineIDs) == 0 || slices.Contains(req.MachineIDs, machine.ID)) {
+			byID[machine.ID] = machine
+		}
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]certificateTarget, 0)
+	for _, instance := range instances {
+		machine, ok := byID[instance.MachineID]
+		if !ok || instance.Status == mysqlapp.StatusStopped {
+			continue
+		}
+		if reason == certdomain.ReasonRotate {
+			if _, active, err := s.repo.GetActiveCertificate(ctx, instance.MachineID, instance.Port); err != nil {
+				return nil, err
+			} else if !active {
+				continue
+			}
+		}
+		targets = append(targets, certificateTarget{machine: machine, instance: instance})
+	}
+	if len(targets) == 0 {
+		if reason == certdomain.ReasonRotate {
+			return nil, errors.New("集群中没有已签发证书的 MySQL 实例，请先部署证书")
+		}
+		return nil, errors.New("集群中没有可部署证书的运行中 MySQL 实例")
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].machine.ID == targets[j].machine.ID {
+			return targets[i].instance.Port < targets[j].instance.Port
+		}
+		return targets[i].machine.ID < targets[j].machine.ID
+	})
+	return targets, nil
+}
+
+func (s *CertificateService) runRollout(ctx context.Context, parentID string, authority certdomain.Authority, policy certdomain.Policy, reason string, targets []certificateTarget) {
+	created, failed := 0, 0
+	for _, target := range targets {
+		taskID, err := s.rolloutOne(ctx, parentID, authority, policy, reason, target)
+		if taskID != "" {
+			created++
+		}
+		if err != nil {
+			failed++
+			log.Printf("certificate %s %s:%d: %v", reason, target.machine.Name, target.instance.Port, err)
+		}
+	}
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, parentID, created, failed)
+	_ = s.CheckExpiry(ctx)
+}
+
+// rolloutOne keeps the previous certificate active until the new one has been
+// written, reloaded and observed on a verified TLS connection.
+func (s *CertificateService) rolloutOne(ctx context.Context, parentID string, authority certdomain.Authority, policy certdomain.Policy, reason string, target certificateTarget) (string, error) {
+	now := time.Now().UTC()
+	directory := certificateDirectory(target.instance)
+	certificate, err := issueServerCertificate(authority, target.machine, target.instance.Port, directory, policy.ValidityDays, now)
+	if err != nil {
+		return "", err
+	}
+	certificate.Reason = reason
+	command := certificateDeployCommand(target.instance, certificate, authority.CertPEM, policy, mysqlapp.SupportsTLSReloadForVersion(target.instance.Version))
+	// The command embeds the private key; RunExecTask redacts it from task history.
+	taskID, output, err := s.tasks.RunExecTask(ctx, target.machine.IP, command, ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "tls_certificate_" + reason, DisplayName: "下发 TLS 证书 " + target.machine.Name,
+		StepName: "写入证书并重新加载 TLS", Port: target.instance.Port,
+	}, 5*time.Minute)
+	certificate.TaskID = taskID
+	if err == nil {
+		err = verifyCertificateNotAfter(output, certificate.NotAfter)
+	}
+	if err != nil {
+		certificate.Status = certdomain.StatusFailed
+		certificate.LastError = err.Error()
+		certificate.UpdatedAt = time.Now().UTC()
+		_ = s.repo.SaveCertificate(ctx, certificate)
+		return taskID, err
+	}
+	deployedAt := time.Now().UTC()
+	certificate.DeployedAt, certificate.ReloadedAt = &deployedAt, &deployedAt
+	return taskID, s.activate(ctx, certificate)
+}
+
+// ReplicationSourceTLS implements taskusecase.ReplicationTLSResolver. A
+// replica only uses SOURCE_SSL when its cluster policy asks for it and the
+// Manager CA has been deployed next to the replica's own certificate.
+func (s *CertificateService) ReplicationSourceTLS(ctx context.Context, machineID string, port int) (taskusecase.ReplicationTLS, bool) {
+	machine, ok, err := s.machines.GetByID(ctx, strings.TrimSpace(machineID))
+	if err != nil || !ok {
+		return taskusecase.ReplicationTLS{}, false
+	}
+	policy, err := s.GetPolicy(ctx, machine.Cluster)
+	if err != nil || !policy.ReplicationSSL {
+		return taskusecase.ReplicationTLS{}, false
+	}
+	if port <= 0 {
+		port = 3306
+	}
+	certificate, ok, err := s.repo.GetActiveCertificate(ctx, machine.ID, port)
+	if err != nil || !ok || strings.TrimSpace(certificate.Directory) == "" {
+		return taskusecase.ReplicationTLS{}, false
+	}
+	return taskusecase.ReplicationTLS{CAPath: certificate.Directory + "/" + certdomain.CAFileName, VerifyServerCert: policy.VerifyServerCert}, true
+}
+
+// CheckExpiry raises or resolves an alert for every active certificate and
+// for the CA according to the owning cluster's thresholds.
+func (s *CertificateService) CheckExpiry(ctx context.Context) error {
+	if s.alerts == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	items, err := s.repo.ListCertificates(ctx, "")
+	if err != nil {
+		return err
+	}
+	policies := map[string]certdomain.Policy{}
+	active := map[string]bool{}
+	for _, item := range items {
+		key := fmt.Sprintf("%s:%d", item.MachineID, item.Port)
+		if item.Status != certdomain.StatusActive || active[key] {
+			continue
+		}
+		active[key] = true
+		policy, ok := policies[item.ClusterID]
+		if !ok {
+			if policy, err = s.GetPolicy(ctx, item.ClusterID); err != nil {
+				return err
+			}
+			policies[item.ClusterID] = policy
+		}
+		daysLeft := item.DaysLeft(now)
+		signal := AlertSignal{
+			RuleID: certificateExpiryRuleID, RuleName: "TLS 证书即将过期", Metric: "tls_certificate_days_left", Category: "tls",
+			MachineID: item.MachineID, MachineName: item.MachineName, MachineIP: item.Host, ClusterID: item.ClusterID,
+			Labels: map[string]string{"certificate": "mysql_server", "mysql_port": fmt.Sprint(item.Port)},
+			Value:  float64(daysLeft), Threshold: float64(policy.WarnDays), Operator: "<=",
+			Message: fmt.Sprintf("%s:%d 的 MySQL 服务端证书将于 %s 过期（剩余 %d 天），请执行证书轮换", item.Host, item.Port, item.NotAfter.Format("2006-01-02"), daysLeft),
+		}
+		if err := s.signalExpiry(ctx, signal, daysLeft, policy); err != nil {
+			return err
+		}
+	}
+	authority, ok, err := s.repo.GetAuthority(ctx, certdomain.DefaultAuthorityID)
+	if err != nil || !ok {
+		return err
+	}
+	daysLeft := int(authority.NotAfter.Sub(now).Hours() / 24)
+	defaults := normalizeCertificatePolicy(certdomain.Policy{})
+	return s.signalExpiry(ctx, AlertSignal{
+		RuleID: certificateExpiryRuleID, RuleName: "TLS 证书即将过期", Metric: "tls_certificate_days_left", Category: "tls",
+		MachineID: "manager", MachineName: "GMHA Manager", Labels: map[string]string{"certificate": "ca"},
+		Value: float64(daysLeft), Threshold: float64(defaults.WarnDays), Operator: "<=",
+		Message: fmt.Sprintf("GMHA 根证书将于 %s 过期（剩余 %d 天）", authority.NotAfter.Format("2006-01-02"), daysLeft),
+	}, daysLeft, defaults)
+}
+
+func (s *CertificateService) signalExpiry(ctx context.Context, signal AlertSignal, daysLeft int, policy certdomain.Policy) error {
+	severity, firing := certificateExpirySeverity(daysLeft, policy)
+	if !firing {
+		return s.alerts.ResolveSignal(ctx, signal)
+	}
+	signal.Severity = severity
+	return s.alerts.RaiseSignal(ctx, signal)
+}
+
+func certificateExpirySeverity(daysLeft int, policy certdomain.Policy) (alertdomain.Severity, bool) {
+	switch {
+	case daysLeft <= policy.CriticalDays:
+		return alertdomain.SeverityCritical, true
+	case daysLeft <= policy.WarnDays:
+		return alertdomain.SeverityWarning, true
+	default:
+		return "", false
+	}
+}
+
+func normalizeCertificatePolicy(policy certdomain.Policy) certdomain.Policy {
+	if policy.ValidityDays <= 0 {
+		policy.ValidityDays = certdomain.DefaultValidityDays
+	}
+	if policy.WarnDays <= 0 {
+		policy.WarnDays = certdomain.DefaultWarnDays
+	}
+	if policy.CriticalDays <= 0 {
+		policy.CriticalDays = certdomain.DefaultCriticalDays
+	}
+	return policy
+}
+
+func validateCertificatePolicy(policy certdomain.Policy) error {
+	if policy.ClusterID == "" {
+		return errors.New("cluster is required")
+	}
+	if policy.ValidityDays > 3650 {
+		return errors.New("validity_days must not exceed 3650")
+	}
+	if policy.CriticalDays > policy.WarnDays || policy.WarnDays >= policy.ValidityDays {
+		return errors.New("critical_days <= warn_days < validity_days is required")
+	}
+	if policy.VerifyServerCert && !policy.ReplicationSSL {
+		return errors.New("verify_server_cert requires replication_ssl")
+	}
+	// Replicas authenticate over TCP: once the source rejects plaintext,
+	// a channel without SOURCE_SSL can no longer connect.
+	if policy.RequireSecureTransport && !policy.ReplicationSSL {
+		return errors.New("require_secure_transport requires replication_ssl, otherwise replication channels are rejected")
+	}
+	return nil
+}
+
+func certificateDirectory(instance mysqlapp.Instance) string {
+	base := strings.TrimRight(strings.TrimSpace(instance.InstanceDir), "/")
+	if base == "" {
+		base = fmt.Sprintf("/data/mysql/%d", instance.Port)
+	}
+	return base + "/" + certdomain.DefaultDirectoryName
+}
+
+func newCertificateSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+}
+
+func newCertificateAuthority(now time.Time, validityDays int) (certdomain.Authority, error) {
+	key, err := rsa.GenerateKey(rand.Reader, certificateKeyBits)
+	if err != nil {
+		return certdomain.Authority{}, err
+	}
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return certdomain.Authority{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: certdomain.DefaultAuthorityName, Organization: []string{certdomain.DefaultCertificateOrgName}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(0, 0, validityDays),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return certdomain.Authority{}, err
+	}
+	return certdomain.Authority{
+		ID: certdomain.DefaultAuthorityID, CommonName: template.Subject.CommonName, Serial: serial.Text(16),
+		CertPEM:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		NotBefore: template.NotBefore, NotAfter: template.NotAfter, CreatedAt: now,
+	}, nil
+}
+
+// issueServerCertificate signs a server certificate whose CN is the machine
+// IP (MySQL 5.7 verifies SOURCE_HOST against the CN only) with the IP and
+// hostname also present as SANs. The key is PKCS#1 for 5.7 compatibility.
+func issueServerCertificate(authority certdomain.Authority, machine machinedomain.Machine, port int, directory string, validityDays int, now time.Time) (certdomain.Certificate, error) {
+	caBlock, _ := pem.Decode([]byte(authority.CertPEM))
+	keyBlock, _ := pem.Decode([]byte(authority.KeyPEM))
+	if caBlock == nil || keyBlock == nil {
+		return certdomain.Certificate{}, errors.New("certificate authority is incomplete")
+	}
+	caCert, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		return certdomain.Certificate{}, err
+	}
+	caKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return certdomain.Certificate{}, err
+	}
+	host := strings.TrimSpace(machine.IP)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return certdomain.Certificate{}, fmt.Errorf("machine %s has no valid IP address", machine.ID)
+	}
+	if validityDays <= 0 {
+		validityDays = certdomain.DefaultValidityDays
+	}
+	notAfter := now.AddDate(0, 0, validityDays)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+	key, err := rsa.GenerateKey(rand.Reader, certificateKeyBits)
+	if err != nil {
+		return certdomain.Certificate{}, err
+	}
+	serial, err := newCertificateSerial()
+	if err != nil {
+		return certdomain.Certificate{}, err
+	}
+	ips := []net.IP{ip, net.ParseIP("127.0.0.1")}
+	dnsNames := []string{"localhost"}
+	if name := strings.TrimSpace(machine.Name); name != "" && certificateHostnamePattern.MatchString(name) && net.ParseIP(name) == nil {
+		dnsNames = append([]string{name}, dnsNames...)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host, Organization: []string{certdomain.DefaultCertificateOrgName}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  ips,
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return certdomain.Certificate{}, err
+	}
+	ipTexts := make([]string, 0, len(ips))
+	for _, item := range ips {
+		ipTexts = append(ipTexts, item.String())
+	}
+	return certdomain.Certificate{
+		ID: newEntityID("tls"), ClusterID: machine.Cluster, MachineID: machine.ID, MachineName: machine.Name, Host: host, Port: port,
+		Serial: serial.Text(16), CommonName: host, DNSNames: dnsNames, IPAddresses: ipTexts,
+		CertPEM:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:    string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		Directory: strings.TrimRight(directory, "/"), NotBefore: template.NotBefore, NotAfter: notAfter, CreatedAt: now, UpdatedAt: now,
+	}, nil
+}
+
+// certificateDeployCommand swaps the files in place, pins the ssl_* options in
+// my.cnf for restarts, activates them (online reload on 8.0.16+, restart on
+// older servers) and prints the served certificate's expiry over a
+// CA-verified connection.
+func certificateDeployCommand(instance mysqlapp.Instance, certificate certdomain.Certificate, caPEM string, policy certdomain.Policy, onlineReload bool) string {
+	dir := certificate.Directory
+	owner := strings.TrimSpace(instance.MySQLUser)
+	if owner == "" {
+		owner = "mysql"
+	}
+	caPath, certPath, keyPath := dir+"/"+certdomain.CAFileName, dir+"/"+certdomain.CertFileName, dir+"/"+certdomain.KeyFileName
+	secure := boolToInt(policy.RequireSecureTransport)
+	var b strings.Builder
+	b.WriteString("set -e; umask 077; ")
+	b.WriteString("mkdir -p " + shellQuote(dir) + "; chmod 0750 " + shellQuote(dir) + "; ")
+	for _, file := range []struct{ path, content, mode string }{
+		{caPath, caPEM, "0644"}, {certPath, certificate.CertPEM, "0644"}, {keyPath, certificate.KeyPEM, "0600"},
+	} {
+		temp := shellQuote(file.path + ".gmha-tmp")
+		b.WriteString("printf '%s' " + shellQuote(base64.StdEncoding.EncodeToString([]byte(file.content))) + " | base64 -d > " + temp + "; ")
+		b.WriteString("chmod " + file.mode + " " + temp + "; chown " + shellQuote(owner+":"+owner) + " " + temp + "; mv -f " + temp + " " + shellQuote(file.path) + "; ")
+	}
+	b.WriteString("chown " + shellQuote(owner+":"+owner) + " " + shellQuote(dir) + "; ")
+	if cnf := strings.TrimSpace(instance.MyCnfPath); cnf != "" {
+		block := fmt.Sprintf(`ssl_ca = %s\nssl_cert = %s\nssl_key = %s\nrequire_secure_transport = %d`, caPath, certPath, keyPath, secure)
+		b.WriteString(certificateMyCnfCommand(cnf, block) + "; ")
+	}
+	if onlineReload {
+		sql := fmt.Sprintf("SET GLOBAL ssl_ca=%s, ssl_cert=%s, ssl_key=%s; ALTER INSTANCE RELOAD TLS; SET GLOBAL require_secure_transport=%d;", sqlLiteral(caPath), sqlLiteral(certPath), sqlLiteral(keyPath), secure)
+		b.WriteString(mysqlArchitectureCommand("", instance.Port, sql) + "; ")
+	} else {
+		unit := strings.TrimSpace(instance.SystemdUnit)
+		if unit == "" {
+			unit = fmt.Sprintf("mysqld-%d", instance.Port)
+		}
+		b.WriteString("systemctl restart " + shellQuote(unit) + "; ")
+		b.WriteString("for i in $(seq 1 60); do " + mysqlArchitectureClient("", instance.Port) + " --execute='SELECT 1' >/dev/null 2>&1 && break; sleep 2; done; ")
+	}
+	verify := fmt.Sprintf("SELECT '%s', VARIABLE_VALUE FROM performance_schema.global_status WHERE VARIABLE_NAME='Ssl_server_not_after';", certificateNotAfterMarker)
+	b.WriteString(mysqlArchitectureClient("", instance.Port) + " --ssl-mode=VERIFY_CA --ssl-ca=" + shellQuote(caPath) + " --batch --raw --skip-column-names --execute=" + shellQuote(verify))
+	return b.String()
+}
+
+// certificateMyCnfCommand rewrites the TLS options of cnf in one awk pass: it
+// tracks the current section, drops existing ssl_ca/ssl_cert/ssl_key and
+// require_secure_transport lines only inside [mysqld] and inserts block right
+// after the first [mysqld] header. Same-named keys under [client] or [mysql]
+// configure the command-line clients and are left alone.
+func certificateMyCnfCommand(cnf, block string) string {
+	program := `/^[[:space:]]*\[/ {section=$0; sub(/^[[:space:]]*\[[[:space:]]*/, "", section); sub(/[[:space:]]*\].*$/, "", section); section=tolower(section)} ` +
+		`section == "mysqld" && /^[[:space:]]*(ssl[_-]ca|ssl[_-]cert|ssl[_-]key|require[_-]secure[_-]transport)[[:space:]]*=/ {next} ` +
+		`{print} ` +
+		`section == "mysqld" && /^[[:space:]]*\[/ && !done {print block; done=1}`
+	return "cnf=" + shellQuote(cnf) + "; " +
+		`awk -v block=` + shellQuote(block) + ` ` + shellQuote(program) + ` "$cnf" > "$cnf.gmha-tmp"; cat "$cnf.gmha-tmp" > "$cnf"; rm -f "$cnf.gmha-tmp"`
+}
+
+// verifyCertificateNotAfter confirms the server now presents the certificate
+// just issued. OpenSSL prints the expiry as "Jan  2 15:04:05 2006 GMT".
+func verifyCertificateNotAfter(output string, expected time.Time) error {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(fields) != 2 || fields[0] != certificateNotAfterMarker {
+			continue
+		}
+		served, err := time.Parse("Jan _2 15:04:05 2006 MST", strings.Join(strings.Fields(fields[1]), " "))
+		if err != nil {
+			served, err = time.Parse("Jan 2 15:04:05 2006 MST", strings.Join(strings.Fields(fields[1]), " "))
+		}
+		if err != nil {
+			return fmt.Errorf("无法解析 MySQL 返回的证书过期时间 %q", fields[1])
+		}
+		if !served.UTC().Equal(expected.UTC().Truncate(time.Second)) {
+			return fmt.Errorf("MySQL 仍在使用旧证书（过期时间 %s）", served.UTC().Format(time.RFC3339))
+		}
+		return nil
+	}
+	return errors.New("未能通过 CA 校验的 TLS 连接读取服务端证书")
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	certdomain "gmha/internal/domain/certificate"
+	machinedomain "gmha/internal/domain/machine"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+func TestIssueServerCertificateVerifiesAgainstManagerCA(t *testing.T) {
+	now := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	authority, err := newCertificateAuthority(now, certdomain.DefaultCAValidityDays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := machinedomain.Machine{ID: "m1", Name: "db-01", IP: "10.0.0.11", Cluster: "orders"}
+	issued, err := issueServerCertificate(authority, machine, 3306, "/data/mysql/3306/tls/", 365, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.Directory != "/data/mysql/3306/tls" || issued.ClusterID != "orders" || issued.KeyPEM == "" {
+		t.Fatalf("unexpected certificate record: %+v", issued.Redacted())
+	}
+	caBlock, _ := pem.Decode([]byte(authority.CertPEM))
+	ca, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(issued.CertPEM))
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	for _, name := range []string{"10.0.0.11", "db-01", "127.0.0.1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: pool, CurrentTime: now.Add(time.Hour)}); err != nil {
+			t.Fatalf("certificate must verify for %s: %v", name, err)
+		}
+	}
+	if leaf.Subject.CommonName != "10.0.0.11" || !leaf.IPAddresses[0].Equal(net.ParseIP("10.0.0.11")) {
+		t.Fatalf("MySQL 5.7 verifies the CN, which must be the source IP: %+v", leaf.Subject)
+	}
+	if keyBlock, _ := pem.Decode([]byte(issued.KeyPEM)); keyBlock == nil || keyBlock.Type != "RSA PRIVATE KEY" {
+		t.Fatalf("server key must be PKCS#1 for MySQL 5.7")
+	}
+}
+
+func TestCertificateDeployCommandReloadsOnlineOrRestarts(t *testing.T) {
+	certificate := certdomain.Certificate{Directory: "/data/mysql/3306/tls", CertPEM: "cert", KeyPEM: "key"}
+	policy := certdomain.Policy{ReplicationSSL: true, RequireSecureTransport: true}
+	instance := mysqlapp.Instance{Port: 3306, MySQLUser: "mysql", MyCnfPath: "/data/mysql/3306/my.cnf", SystemdUnit: "mysqld-3306", Version: "8.0.36"}
+	online := certificateDeployCommand(instance, certificate, "ca", policy, true)
+	for _, expected := range []string{"ALTER INSTANCE RELOAD TLS", "require_secure_transport=1", "chmod 0600 '/data/mysql/3306/tls/server-key.pem.gmha-tmp'", "--ssl-mode=VERIFY_CA", certificateNotAfterMarker, "require_secure_transport = 1"} {
+		if !strings.Contains(online, expected) {
+			t.Fatalf("online deploy missing %q: %s", expected, online)
+		}
+	}
+	if strings.Contains(online, "systemctl restart") || !strings.Contains(online, "printf '%s' 'a2V5' | base64 -d") {
+		t.Fatalf("online deploy must not restart MySQL and must ship PEM base64-encoded: %s", online)
+	}
+	instance.Version = "5.7.44"
+	legacy := certificateDeployCommand(instance, certificate, "ca", policy, false)
+	if strings.Contains(legacy, "RELOAD TLS") || !strings.Contains(legacy, "systemctl restart 'mysqld-3306'") {
+		t.Fatalf("MySQL 5.7 deploy must restart instead of RELOAD TLS: %s", legacy)
+	}
+}
+
+func TestCertificateMyCnfCommandOnlyRewritesMysqldSection(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk not available")
+	}
+	cnf := filepath.Join(t.TempDir(), "my.cnf")
+	original := "[client]\nssl-ca = /etc/client-ca.pem\nssl_cert=/etc/client-cert.pem\n\n" +
+		"[mysqld]\nport = 3306\nssl_ca = /old/ca.pem\n  ssl-key=/old/key.pem\nrequire_secure_transport = OFF\n\n" +
+		"[mysql]\nssl_key = /etc/client-key.pem\n"
+	if err := os.WriteFile(cnf, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output, err := exec.Command("sh", "-c", certificateMyCnfCommand(cnf, `ssl_ca = /tls/ca.pem\nrequire_secure_transport = 1`)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	got, _ := os.ReadFile(cnf)
+	want := "[client]\nssl-ca = /etc/client-ca.pem\nssl_cert=/etc/client-cert.pem\n\n" +
+		"[mysqld]\nssl_ca = /tls/ca.pem\nrequire_secure_transport = 1\nport = 3306\n\n" +
+		"[mysql]\nssl_key = /etc/client-key.pem\n"
+	if string(got) != want {
+		t.Fatalf("my.cnf rewritten to:\n%s", got)
+	}
+}
+
+func TestVerifyCertificateNotAfterMatchesServedCertificate(t *testing.T) {
+	expected := time.Date(2027, 8, 1, 3, 4, 5, 0, time.UTC)
+	output := "noise\n" + certificateNotAfterMarker + "\tAug  1 03:04:05 2027 GMT\n"
+	if err := verifyCertificateNotAfter(output, expected); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCertificateNotAfter(output, expected.AddDate(1, 0, 0)); err == nil {
+		t.Fatal("an old certificate still being served must fail the rollout")
+	}
+	if err := verifyCertificateNotAfter("ERROR 2026 (HY000): SSL connection error", expected); err == nil {
+		t.Fatal("missing verification output must fail the rollout")
+	}
+}
+
+func TestCertificatePolicyAndExpiryThresholds(t *testing.T) {
+	policy := normalizeCertificatePolicy(certdomain.Policy{ClusterID: "orders", RequireSecureTransport: true})
+	if err := validateCertificatePolicy(policy); err == nil {
+		t.Fatal("require_secure_transport without replication TLS must be rejected")
+	}
+	policy.ReplicationSSL = true
+	if err := validateCertificatePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		days     int
+		severity alertdomain.Severity
+		firing   bool
+	}{{90, "", false}, {30, alertdomain.SeverityWarning, true}, {7, alertdomain.SeverityCritical, true}, {-1, alertdomain.SeverityCritical, true}} {
+		severity, firing := certificateExpirySeverity(tt.days, policy)
+		if severity != tt.severity || firing != tt.firing {
+			t.Fatalf("days=%d: got %q/%v", tt.days, severity, firing)
+		}
+	}
+	clause := architectureReplicationTLSClause(taskusecase.ReplicationTLS{CAPath: "/data/tls/ca.pem", VerifyServerCert: true}, "SOURCE")
+	if clause != ",SOURCE_SSL=1,SOURCE_SSL_CA='/data/tls/ca.pem',SOURCE_SSL_VERIFY_SERVER_CERT=1" {
+		t.Fatalf("unexpected replication clause: %s", clause)
+	}
+}
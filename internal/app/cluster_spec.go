@@ -0,0 +1,1180 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	backupdomain "gmha/internal/domain/backup"
+	clusterdomain "gmha/internal/domain/cluster"
+	hadomain "gmha/internal/domain/ha"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const (
+	ClusterSpecRolePrimary         = "primary"
+	ClusterSpecRoleSecondaryMaster = "secondary_master"
+	ClusterSpecRoleReplica         = "replica"
+
+	clusterSpecNodeMarker       = "__GMHA_CLUSTER_SPEC_NODE__"
+	clusterSpecProbeTimeout     = 45 * time.Second
+	clusterSpecSemiSyncTimeout  = 2 * time.Minute
+	clusterSpecInstallTimeout   = 2 * time.Hour
+	clusterSpecBootstrapTimeout = 4 * time.Hour
+)
+
+// ClusterSpec 是单个集群的声明式规格：成员与角色、MySQL 版本、复制架构、
+// VIP、半同步、备份策略和集群级告警规则。plan 把它与线上状态比对，apply 按
+// 计划顺序调用现有服务收敛。
+type ClusterSpec struct {
+	Cluster      string               `json:"cluster"`
+	Description  string               `json:"description,omitempty"`
+	Architecture string               `json:"architecture,omitempty"`
+	MySQL        ClusterSpecMySQL     `json:"mysql"`
+	Members      []ClusterSpecMember  `json:"members"`
+	SemiSync     *ClusterSpecSemiSync `json:"semi_sync,omitempty"`
+	VIP          *ClusterSpecVIP      `json:"vip,omitempty"`
+	Backups      []ClusterSpecBackup  `json:"backups,omitempty"`
+	Alerts       []ClusterSpecAlert   `json:"alerts,omitempty"`
+}
+
+// ClusterSpecMySQL 描述新装实例使用的版本与配置模板。RootPassword 只在安装和
+// 架构调整时使用，计划输出中不会回显。
+type ClusterSpecMySQL struct {
+	Version           string `json:"version"`
+	Profile           string `json:"profile,omitempty"`
+	Port              int    `json:"port,omitempty"`
+	MySQLUser         string `json:"mysql_user,omitempty"`
+	RootPassword      string `json:"root_password,omitempty"`
+	MemoryAllocator   string `json:"memory_allocator,omitempty"`
+	InstallPTTools    bool   `json:"install_pt_tools,omitempty"`
+	InstallXtraBackup bool   `json:"install_xtrabackup,omitempty"`
+}
+
+// ClusterSpecMember 以机器名、IP 或 ID 引用已纳管机器。
+type ClusterSpecMember struct {
+	Machine  string `json:"machine"`
+	Role     string `json:"role"`
+	Port     int    `json:"port,omitempty"`
+	ServerID int    `json:"server_id,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+type ClusterSpecSemiSync struct {
+	Enabled             bool `json:"enabled"`
+	TimeoutMS           int  `json:"timeout_ms,omitempty"`
+	WaitForReplicaCount int  `json:"wait_for_replica_count,omitempty"`
+}
+
+type ClusterSpecVIP struct {
+	Address   string `json:"address"`
+	Prefix    int    `json:"prefix,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// ClusterSpecBackup 以 name 为键对应一条备份策略。StartAt 接受 RFC3339 或
+// "2006-01-02 15:04"（Manager 本地时区）。
+type ClusterSpecBackup struct {
+	Name               string `json:"name"`
+	Machine            string `json:"machine,omitempty"`
+	Port               int    `json:"port,omitempty"`
+	Type               string `json:"type,omitempty"`
+	Schedule           string `json:"schedule"`
+	Weekdays           []int  `json:"weekdays,omitempty"`
+	IntervalMinutes    int    `json:"interval_minutes,omitempty"`
+	StartAt            string `json:"start_at"`
+	RetryCount         int    `json:"retry_count,omitempty"`
+	IncludeBinlog      bool   `json:"include_binlog,omitempty"`
+	Location           string `json:"location,omitempty"`
+	DiskUsageThreshold int    `json:"disk_usage_threshold,omitempty"`
+	Enabled            *bool  `json:"enabled,omitempty"`
+}
+
+// ClusterSpecAlert 以 name 为键对应一条只作用于本集群的告警规则。
+type ClusterSpecAlert struct {
+	Name                  string            `json:"name"`
+	Metric                string            `json:"metric"`
+	Operator              string            `json:"operator"`
+	Threshold             float64           `json:"threshold"`
+	Severity              string            `json:"severity,omitempty"`
+	Labels                map[string]string `json:"labels,omitempty"`
+	ConsecutiveCount      int               `json:"consecutive_count,omitempty"`
+	RepeatIntervalSeconds int               `json:"repeat_interval_seconds,omitempty"`
+	Enabled               *bool             `json:"enabled,omitempty"`
+}
+
+// ClusterSpecRequest 是 plan/apply 接口的请求体；Spec 为 YAML 或 JSON 原文。
+// Prune 为 true 时删除规格中未声明的备份策略、集群告警规则和 VIP。
+type ClusterSpecRequest struct {
+	Spec  string `json:"spec"`
+	Prune bool   `json:"prune,omitempty"`
+}
+
+// ClusterSpecAction 是计划中的一步，apply 严格按顺序执行。
+type ClusterSpecAction struct {
+	Step    string   `json:"step"`
+	Kind    string   `json:"kind"`
+	Target  string   `json:"target"`
+	Summary string   `json:"summary"`
+	Changes []string `json:"changes,omitempty"`
+	run     func(ctx context.Context, parentID string) ([]string, error)
+}
+
+type ClusterSpecPlan struct {
+	Cluster         string              `json:"cluster"`
+	Actions         []ClusterSpecAction `json:"actions"`
+	Warnings        []string            `json:"warnings,omitempty"`
+	BlockingReasons []string            `json:"blocking_reasons,omitempty"`
+	ProbeTaskIDs    []string            `json:"probe_task_ids,omitempty"`
+	InSync          bool                `json:"in_sync"`
+	Executable      bool                `json:"executable"`
+}
+
+type ClusterSpecApplyResult struct {
+	Plan ClusterSpecPlan `json:"plan"`
+	Task TaskDetail      `json:"task"`
+}
+
+type clusterSpecMemberState struct {
+	spec     ClusterSpecMember
+	machine  machinedomain.Machine
+	instance *mysqlapp.Instance
+	node     clusterSpecNode
+}
+
+type clusterSpecNode struct {
+	reachable   bool
+	readOnly    bool
+	channels    int
+	sourceHost  string
+	sourcePort  int
+	semiSource  bool
+	semiReplica bool
+	semiTimeout int
+	semiWait    int
+}
+
+// ClusterSpecService 实现集群规格的 plan/apply，所有变更都委托给机器、安装、
+// 架构、VIP、备份与告警的既有服务完成。
+type ClusterSpecService struct {
+	machines   *MachineService
+	clusters   clusterdomain.Repository
+	machineDB  machinedomain.Repository
+	instances  MySQLInstanceRepository
+	mysql      *MySQLService
+	ha         *HAService
+	backups    *BackupService
+	alerts     *AlertService
+	tasks      *TaskService
+	mu         sync.Mutex
+	running    map[string]bool
+	probeNodes func(ctx context.Context, members []*clusterSpecMemberState) ([]string, error)
+}
+
+func NewClusterSpecService(machines *MachineService, clusters clusterdomain.Repository, machineDB machinedomain.Repository, instances MySQLInstanceRepository, mysql *MySQLService, ha *HAService, backups *BackupService, alerts *AlertService, tasks *TaskService) *ClusterSpecService {
+	s := &ClusterSpecService{machines: machines, clusters: clusters, machineDB: machineDB, instances: instances, mysql: mysql, ha: ha, backups: backups, alerts: alerts, tasks: tasks, running: map[string]bool{}}
+	s.probeNodes = s.probe
+	return s
+}
+
+// Plan 对比规格与线上状态并返回有序计划，不做任何变更。
+func (s *ClusterSpecService) Plan(ctx context.Context, spec ClusterSpec, prune bool) (ClusterSpecPlan, error) {
+	return s.plan(ctx, spec, prune)
+}
+
+// Apply 基于实时状态重新生成计划，计划可执行时创建任务中心父任务并在后台
+// 逐步执行；任一步失败即停止，后续步骤保持未执行。
+func (s *ClusterSpecService) Apply(ctx context.Context, spec ClusterSpec, prune bool) (ClusterSpecApplyResult, error) {
+	plan, err := s.plan(ctx, spec, prune)
+	if err != nil {
+		return ClusterSpecApplyResult{Plan: plan}, err
+	}
+	if !plan.Executable {
+		return ClusterSpecApplyResult{Plan: plan}, fmt.Errorf("集群规格无法应用：%s", strings.Join(plan.BlockingReasons, "；"))
+	}
+	if plan.InSync {
+		return ClusterSpecApplyResult{Plan: plan}, nil
+	}
+	s.mu.Lock()
+	if s.running[plan.Cluster] {
+		s.mu.Unlock()
+		return ClusterSpecApplyResult{Plan: plan}, fmt.Errorf("集群 %s 正在应用规格", plan.Cluster)
+	}
+	s.running[plan.Cluster] = true
+	s.mu.Unlock()
+	taskID := fmt.Sprintf("cluster-spec-%d", time.Now().UTC().UnixNano())
+	detail, err := s.tasks.CreateClusterSpecTrackingTask(ctx, taskID, plan.Cluster, plan.Actions)
+	if err != nil {
+		s.release(plan.Cluster)
+		return ClusterSpecApplyResult{Plan: plan}, err
+	}
+	go s.execute(context.Background(), taskID, plan)
+	return ClusterSpecApplyResult{Plan: plan, Task: detail}, nil
+}
+
+func (s *ClusterSpecService) release(cluster string) {
+	s.mu.Lock()
+	delete(s.running, cluster)
+	s.mu.Unlock()
+}
+
+func (s *ClusterSpecService) execute(ctx context.Context, parentID string, plan ClusterSpecPlan) {
+	defer s.release(plan.Cluster)
+	for _, action := range plan.Actions {
+		_ = s.tasks.UpdateClusterBootstrapStep(ctx, parentID, action.Step, taskdomain.StepRunning, "正在执行："+action.Summary, nil)
+		related, err := action.run(ctx, parentID)
+		if err != nil {
+			_ = s.tasks.UpdateClusterBootstrapStep(ctx, parentID, action.Step, taskdomain.StepFailed, fmt.Sprintf("%s 失败：%v", action.Summary, err), related)
+			return
+		}
+		_ = s.tasks.UpdateClusterBootstrapStep(ctx, parentID, action.Step, taskdomain.StepSuccess, "已完成："+action.Summary, related)
+	}
+}
+
+func normalizeClusterSpec(spec *ClusterSpec) error {
+	spec.Cluster = strings.TrimSpace(spec.Cluster)
+	if spec.Cluster == "" {
+		return errors.New("cluster 不能为空")
+	}
+	spec.Architecture = strings.TrimSpace(spec.Architecture)
+	if spec.Architecture == "" {
+		spec.Architecture = hadomain.ArchitectureMasterSlave
+	}
+	if spec.Architecture != hadomain.ArchitectureMasterSlave && spec.Architecture != hadomain.ArchitectureDualMaster {
+		return errors.New("architecture 只能是 master_slave 或 dual_master")
+	}
+	if strings.TrimSpace(spec.MySQL.Version) == "" {
+		return errors.New("mysql.version 不能为空")
+	}
+	if strings.Contains(spec.MySQL.RootPassword, "${") {
+		return errors.New("mysql.root_password 中的 ${NAME} 引用未展开，请通过 CLI 从环境变量注入")
+	}
+	if spec.MySQL.Port == 0 {
+		spec.MySQL.Port = 3306
+	}
+	if len(spec.Members) < 2 {
+		return errors.New("members 至少需要两台机器")
+	}
+	seen := map[string]bool{}
+	roles := map[string]int{}
+	for i := range spec.Members {
+		member := &spec.Members[i]
+		member.Machine = strings.TrimSpace(member.Machine)
+		member.Role = strings.ToLower(strings.TrimSpace(member.Role))
+		if member.Machine == "" {
+			return fmt.Errorf("members[%d].machine 不能为空", i)
+		}
+		if seen[member.Machine] {
+			return fmt.Errorf("机器 %s 重复出现在 members 中", member.Machine)
+		}
+		seen[member.Machine] = true
+		switch member.Role {
+		case ClusterSpecRolePrimary, ClusterSpecRoleSecondaryMaster, ClusterSpecRoleReplica:
+		default:
+			return fmt.Errorf("members[%d].role 只能是 primary、secondary_master 或 replica", i)
+		}
+		roles[member.Role]++
+		if member.Port == 0 {
+			member.Port = spec.MySQL.Port
+		}
+		if member.Port < 0 || member.Port > 65535 || member.ServerID < 0 || member.ServerID > math.MaxUint32 {
+			return fmt.Errorf("members[%d] 的 port 或 server_id 无效", i)
+		}
+		if member.Priority == 0 {
+			member.Priority = 50
+		}
+	}
+	if roles[ClusterSpecRolePrimary] != 1 {
+		return errors.New("members 中必须恰好有一个 primary")
+	}
+	if spec.Architecture == hadomain.ArchitectureDualMaster && roles[ClusterSpecRoleSecondaryMaster] != 1 {
+		return errors.New("dual_master 架构必须恰好有一个 secondary_master")
+	}
+	if spec.Architecture == hadomain.ArchitectureMasterSlave && roles[ClusterSpecRoleSecondaryMaster] > 0 {
+		return errors.New("master_slave 架构不能声明 secondary_master")
+	}
+	if spec.SemiSync != nil {
+		if spec.SemiSync.TimeoutMS == 0 {
+			spec.SemiSync.TimeoutMS = 10000
+		}
+		if spec.SemiSync.WaitForReplicaCount == 0 {
+			spec.SemiSync.WaitForReplicaCount = 1
+		}
+		if spec.SemiSync.TimeoutMS < 0 || spec.SemiSync.WaitForReplicaCount < 0 {
+			return errors.New("semi_sync 的 timeout_ms 与 wait_for_replica_count 不能为负数")
+		}
+	}
+	if spec.VIP != nil {
+		spec.VIP.Address = strings.TrimSpace(spec.VIP.Address)
+		if ip := net.ParseIP(spec.VIP.Address); ip == nil || ip.To4() == nil {
+			return errors.New("vip.address 必须是 IPv4 地址")
+		}
+		if spec.VIP.Prefix == 0 {
+			spec.VIP.Prefix = 24
+		}
+		if spec.VIP.Prefix < 1 || spec.VIP.Prefix > 32 {
+			return errors.New("vip.prefix 必须在 1 到 32 之间")
+		}
+	}
+	names := map[string]bool{}
+	for i := range spec.Backups {
+		backup := &spec.Backups[i]
+		backup.Name = strings.TrimSpace(backup.Name)
+		if backup.Name == "" || names[backup.Name] {
+			return fmt.Errorf("backups[%d].name 为空或重复", i)
+		}
+		names[backup.Name] = true
+		if _, err := parseClusterSpecTime(backup.StartAt); err != nil {
+			return fmt.Errorf("备份策略 %s 的 start_at 无效: %w", backup.Name, err)
+		}
+		switch backup.Schedule {
+		case backupdomain.ScheduleWeekly, backupdomain.ScheduleCustom, backupdomain.ScheduleOnce:
+		default:
+			return fmt.Errorf("备份策略 %s 的 schedule 只能是 weekly、custom 或 once", backup.Name)
+		}
+		if backup.Type == "" {
+			backup.Type = backupdomain.TypeFull
+		}
+		if backup.Location == "" {
+			backup.Location = "/data/gmha/backups"
+		}
+		if backup.DiskUsageThreshold == 0 {
+			backup.DiskUsageThreshold = 95
+		}
+	}
+	names = map[string]bool{}
+	for i := range spec.Alerts {
+		alert := &spec.Alerts[i]
+		alert.Name = strings.TrimSpace(alert.Name)
+		if alert.Name == "" || names[alert.Name] {
+			return fmt.Errorf("alerts[%d].name 为空或重复", i)
+		}
+		names[alert.Name] = true
+		if strings.TrimSpace(alert.Metric) == "" || !validOperator(alert.Operator) {
+			return fmt.Errorf("告警规则 %s 需要 metric 与有效的 operator", alert.Name)
+		}
+		if alert.Severity == "" {
+			alert.Severity = string(alertdomain.SeverityWarning)
+		}
+		if alertdomain.SeverityRank(alertdomain.Severity(alert.Severity)) == 0 {
+			return fmt.Errorf("告警规则 %s 的 severity 无效", alert.Name)
+		}
+		if alert.ConsecutiveCount == 0 {
+			alert.ConsecutiveCount = 1
+		}
+		if alert.RepeatIntervalSeconds == 0 {
+			alert.RepeatIntervalSeconds = 300
+		}
+	}
+	return nil
+}
+
+func parseClusterSpecTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed.UTC(), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q", value)
+}
+
+func (s *ClusterSpecService) plan(ctx context.Context, spec ClusterSpec, prune bool) (ClusterSpecPlan, error) {
+	if err := normalizeClusterSpec(&spec); err != nil {
+		return ClusterSpecPlan{}, err
+	}
+	plan := ClusterSpecPlan{Cluster: spec.Cluster, Actions: []ClusterSpecAction{}}
+	block := func(format string, args ...any) {
+		plan.BlockingReasons = append(plan.BlockingReasons, fmt.Sprintf(format, args...))
+	}
+	add := func(action ClusterSpecAction) {
+		plan.Actions = append(plan.Actions, action)
+	}
+	cluster := spec.Cluster
+
+	exists, err := s.clusters.Exists(ctx, cluster)
+	if err != nil {
+		return plan, err
+	}
+	if !exists {
+		add(ClusterSpecAction{Kind: "create_cluster", Target: cluster, Summary: "创建集群 " + cluster, run: func(ctx context.Context, _ string) ([]string, error) {
+			return nil, s.machines.CreateCluster(ctx, cluster, spec.Description)
+		}})
+	}
+
+	machines, err := s.machineDB.List(ctx)
+	if err != nil {
+		return plan, err
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return plan, err
+	}
+	members := make([]*clusterSpecMemberState, 0, len(spec.Members))
+	declared := map[string]bool{}
+	for _, member := range spec.Members {
+		machine, ok := matchClusterSpecMachine(machines, member.Machine)
+		if !ok {
+			block("机器 %s 尚未纳管", member.Machine)
+			continue
+		}
+		if declared[machine.ID] {
+			block("members 中有多个条目指向同一台机器 %s", machine.Name)
+			continue
+		}
+		declared[machine.ID] = true
+		if machine.Cluster != "" && machine.Cluster != cluster {
+			block("机器 %s 已属于集群 %s，请先移出", machine.Name, machine.Cluster)
+			continue
+		}
+		state := &clusterSpecMemberState{spec: member, machine: machine}
+		for i := range instances {
+			if instances[i].MachineID == machine.ID && instances[i].Port == member.Port {
+				instance := instances[i]
+				state.instance = &instance
+			}
+		}
+		members = append(members, state)
+		if machine.Cluster != cluster {
+			machineID := machine.ID
+			add(ClusterSpecAction{Kind: "assign_member", Target: machine.Name, Summary: fmt.Sprintf("把机器 %s 加入集群 %s", machine.Name, cluster), run: func(ctx context.Context, _ string) ([]string, error) {
+				return nil, s.machines.AssignMachineCluster(ctx, machineID, cluster)
+			}})
+		}
+	}
+	for _, machine := range machines {
+		if machine.Cluster == cluster && !declared[machine.ID] {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("机器 %s 属于集群但未在规格中声明，apply 不会移出或卸载", machine.Name))
+		}
+	}
+	if len(plan.BlockingReasons) > 0 {
+		return finishClusterSpecPlan(plan), nil
+	}
+
+	byRole := map[string]*clusterSpecMemberState{}
+	var missing []*clusterSpecMemberState
+	for _, member := range members {
+		byRole[member.spec.Role] = member
+		if member.instance == nil {
+			missing = append(missing, member)
+			continue
+		}
+		if version := strings.TrimSpace(member.instance.Version); version != "" && version != strings.TrimSpace(spec.MySQL.Version) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s 当前版本 %s 与规格 %s 不一致，版本变更请使用集群滚动升级", member.machine.Name, version, spec.MySQL.Version))
+		}
+		if spec.MySQL.Profile != "" && member.instance.Profile != "" && member.instance.Profile != spec.MySQL.Profile {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s 当前配置模板为 %s，规格为 %s；已安装实例不会重装", member.machine.Name, member.instance.Profile, spec.MySQL.Profile))
+		}
+	}
+	primary := byRole[ClusterSpecRolePrimary]
+	bootstrap := len(missing) == len(members)
+	serverIDs := map[int]*clusterSpecMemberState{}
+	for _, member := range members {
+		serverID := clusterSpecServerID(member)
+		if member.instance != nil {
+			serverID = member.instance.ServerID
+		}
+		if serverID <= 0 {
+			continue
+		}
+		if other, ok := serverIDs[serverID]; ok {
+			block("%s:%d 与 %s:%d 的 server_id 同为 %d，复制会失败；请在 members 中显式指定不同的 server_id",
+				other.machine.Name, other.spec.Port, member.machine.Name, member.spec.Port, serverID)
+			continue
+		}
+		serverIDs[serverID] = member
+	}
+	if len(missing) > 0 && spec.MySQL.RootPassword == "" {
+		block("需要安装 MySQL 的成员存在时，mysql.root_password 不能为空")
+	}
+	accounts := []taskdomain.MySQLAccountSpec(nil)
+	if len(missing) > 0 && s.mysql != nil {
+		if accounts, err = s.mysql.AccountPresets(ctx); err != nil {
+			return plan, err
+		}
+	}
+
+	vipConfigs := []hadomain.ClusterVIPConfig(nil)
+	if exists {
+		if vipConfigs, err = s.ha.ListVIPConfigs(ctx, cluster); err != nil {
+			return plan, err
+		}
+	}
+	var currentVIP *hadomain.ClusterVIPConfig
+	if spec.VIP != nil {
+		for i := range vipConfigs {
+			if vipConfigs[i].VIPAddress == spec.VIP.Address {
+				currentVIP = &vipConfigs[i]
+			}
+		}
+	}
+
+	if bootstrap {
+		req := clusterSpecBootstrapRequest(spec, members, accounts)
+		add(ClusterSpecAction{Kind: "bootstrap_cluster", Target: cluster, Summary: fmt.Sprintf("安装 %d 个 MySQL %s 实例并初始化 %s 架构", len(members), spec.MySQL.Version, spec.Architecture), Changes: clusterSpecMemberChanges(members), run: func(ctx context.Context, parentID string) ([]string, error) {
+			return s.runBootstrap(ctx, parentID, cluster, req)
+		}})
+	} else {
+		for _, member := range missing {
+			req := clusterSpecInstallRequest(spec, member, accounts)
+			add(ClusterSpecAction{Kind: "install_mysql", Target: member.machine.Name, Summary: fmt.Sprintf("在 %s 安装 MySQL %s（端口 %d）", member.machine.Name, spec.MySQL.Version, member.spec.Port), run: func(ctx context.Context, parentID string) ([]string, error) {
+				req.ParentTaskID = parentID
+				detail, err := s.tasks.CreateMySQLInstallTask(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+				return []string{detail.Task.ID}, s.ha.waitTasks(ctx, []string{detail.Task.ID}, clusterSpecInstallTimeout)
+			}})
+		}
+		probeTaskIDs, err := s.probeNodes(ctx, members)
+		plan.ProbeTaskIDs = probeTaskIDs
+		if err != nil {
+			return plan, err
+		}
+		changes := clusterSpecTopologyDrift(spec, members)
+		for _, member := range members {
+			if member.instance != nil && !member.node.reachable {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("无法探测 %s:%d 的复制状态，未比较其角色与半同步配置", member.machine.IP, member.spec.Port))
+			}
+		}
+		if len(missing) > 0 {
+			changes = append(changes, fmt.Sprintf("新装的 %d 个实例需要加入复制拓扑", len(missing)))
+		}
+		if len(changes) > 0 {
+			req := clusterSpecArchitectureRequest(spec, members)
+			req.ReplicationUser, req.ReplicationPassword = s.ha.architectureManagementAccount(ctx)
+			if currentVIP != nil {
+				req.MoveVIP = true
+			}
+			add(ClusterSpecAction{Kind: "apply_architecture", Target: cluster, Summary: fmt.Sprintf("按规格调整为 %s 架构，主库 %s", spec.Architecture, primary.machine.Name), Changes: changes, run: func(ctx context.Context, parentID string) ([]string, error) {
+				run, err := s.ha.StartArchitectureAdjustment(ctx, cluster, req)
+				if err != nil {
+					return nil, err
+				}
+				if err := s.tasks.AttachChildTasks(ctx, parentID, []string{run.RunID}); err != nil {
+					return []string{run.RunID}, err
+				}
+				return []string{run.RunID}, s.ha.waitArchitectureRun(ctx, cluster, run.RunID, clusterSpecBootstrapTimeout)
+			}})
+		}
+	}
+
+	if spec.VIP != nil && !bootstrap {
+		if changes := clusterSpecVIPDrift(*spec.VIP, currentVIP); len(changes) > 0 {
+			cfg := hadomain.ClusterVIPConfig{VIPName: spec.VIP.Name, VIPAddress: spec.VIP.Address, VIPPrefix: spec.VIP.Prefix, DefaultInterface: spec.VIP.Interface}
+			primaryID, architecture := primary.machine.ID, spec.Architecture
+			add(ClusterSpecAction{Kind: "save_vip", Target: spec.VIP.Address, Summary: fmt.Sprintf("配置 VIP %s/%d 并绑定到主库 %s", spec.VIP.Address, spec.VIP.Prefix, primary.machine.Name), Changes: changes, run: func(ctx context.Context, _ string) ([]string, error) {
+				saved, err := s.ha.SaveVIPConfig(ctx, cluster, s.ha.resolveBootstrapVIPConfig(ctx, cluster, architecture, cfg))
+				if err != nil {
+					return nil, err
+				}
+				_, err = s.ha.ApplyVIPConfig(ctx, cluster, primaryID, saved)
+				return nil, err
+			}})
+		}
+	}
+	if prune {
+		for _, cfg := range vipConfigs {
+			if spec.VIP != nil && cfg.VIPAddress == spec.VIP.Address {
+				continue
+			}
+			address := cfg.VIPAddress
+			add(ClusterSpecAction{Kind: "remove_vip", Target: address, Summary: "解绑并删除规格外的 VIP " + address, run: func(ctx context.Context, _ string) ([]string, error) {
+				return nil, s.ha.RemoveVIPConfig(ctx, cluster, address)
+			}})
+		}
+	}
+
+	if spec.SemiSync != nil {
+		semiSync := *spec.SemiSync
+		for _, member := range members {
+			var changes []string
+			switch {
+			case member.instance == nil && semiSync.Enabled:
+				changes = []string{"新装实例"}
+			case member.instance != nil && member.node.reachable:
+				changes = clusterSpecSemiSyncDrift(semiSync, member.node)
+			}
+			if len(changes) == 0 {
+				continue
+			}
+			machine, port := member.machine, member.spec.Port
+			add(ClusterSpecAction{Kind: "configure_semi_sync", Target: fmt.Sprintf("%s:%d", machine.IP, port), Summary: fmt.Sprintf("%s %s:%d 的半同步复制", map[bool]string{true: "启用", false: "关闭"}[semiSync.Enabled], machine.Name, port), Changes: changes, run: func(ctx context.Context, parentID string) ([]string, error) {
+				taskID, _, err := s.tasks.RunExecTask(ctx, machine.IP, clusterSpecSemiSyncCommand(semiSync, port), ExecTaskOptions{
+					ParentTaskID: parentID, Operation: "cluster_spec_semi_sync", DisplayName: "配置半同步复制 " + machine.Name, StepName: "安装插件并持久化半同步参数", Port: port,
+				}, clusterSpecSemiSyncTimeout)
+				if taskID == "" {
+					return nil, err
+				}
+				return []string{taskID}, err
+			}})
+		}
+	}
+
+	if err := s.planBackups(ctx, spec, members, exists, prune, add, block); err != nil {
+		return plan, err
+	}
+	if err := s.planAlerts(ctx, spec, prune, add); err != nil {
+		return plan, err
+	}
+	return finishClusterSpecPlan(plan), nil
+}
+
+func finishClusterSpecPlan(plan ClusterSpecPlan) ClusterSpecPlan {
+	for i := range plan.Actions {
+		plan.Actions[i].Step = fmt.Sprintf("%02d-%s", i+1, plan.Actions[i].Kind)
+	}
+	plan.Executable = len(plan.BlockingReasons) == 0
+	plan.InSync = plan.Executable && len(plan.Actions) == 0
+	return plan
+}
+
+func matchClusterSpecMachine(machines []machinedomain.Machine, ref string) (machinedomain.Machine, bool) {
+	for _, field := range []func(machinedomain.Machine) string{
+		func(m machinedomain.Machine) string { return m.ID },
+		func(m machinedomain.Machine) string { return m.Name },
+		func(m machinedomain.Machine) string { return m.IP },
+	} {
+		for _, machine := range machines {
+			if field(machine) == ref {
+				return machine, true
+			}
+		}
+	}
+	return machinedomain.Machine{}, false
+}
+
+func clusterSpecMemberChanges(members []*clusterSpecMemberState) []string {
+	changes := make([]string, 0, len(members))
+	for _, member := range members {
+		changes = append(changes, fmt.Sprintf("%s（%s:%d）：%s", member.machine.Name, member.machine.IP, member.spec.Port, member.spec.Role))
+	}
+	return changes
+}
+
+// clusterSpecServerID 在未显式指定时由 IP 末两个字节与完整端口推导 server_id
+// （高 16 位为 IP、低 16 位为端口），同一 /16 网段内的实例互不冲突；跨网段的
+// 重复由 plan 检查并阻止。
+func clusterSpecServerID(member *clusterSpecMemberState) int {
+	if member.spec.ServerID > 0 {
+		return member.spec.ServerID
+	}
+	if ip := net.ParseIP(member.machine.IP); ip != nil {
+		ip = ip.To16()
+		return int(ip[14])<<24 | int(ip[15])<<16 | member.spec.Port
+	}
+	return member.spec.Port
+}
+
+func clusterSpecInstallRequest(spec ClusterSpec, member *clusterSpecMemberState, accounts []taskdomain.MySQLAccountSpec) taskusecase.CreateMySQLInstallTaskRequest {
+	readOnly := "1"
+	if member.spec.Role != ClusterSpecRoleReplica {
+		readOnly = "0"
+	}
+	return taskusecase.CreateMySQLInstallTaskRequest{
+		Machine: member.machine.IP, Version: spec.MySQL.Version, Architecture: spec.Architecture, Port: member.spec.Port,
+		ServerID: clusterSpecServerID(member), MySQLUser: spec.MySQL.MySQLUser, RootPassword: spec.MySQL.RootPassword,
+		Profile: spec.MySQL.Profile, MemoryAllocator: spec.MySQL.MemoryAllocator, InstallPTTools: spec.MySQL.InstallPTTools,
+		InstallXtraBackup: spec.MySQL.InstallXtraBackup, Accounts: accounts,
+		RuntimeParameters: map[string]string{"read_only": readOnly, "super_read_only": readOnly},
+	}
+}
+
+func clusterSpecBootstrapRequest(spec ClusterSpec, members []*clusterSpecMemberState, accounts []taskdomain.MySQLAccountSpec) ClusterBootstrapRequest {
+	req := ClusterBootstrapRequest{Architecture: spec.Architecture}
+	for _, member := range members {
+		switch member.spec.Role {
+		case ClusterSpecRolePrimary:
+			req.PrimaryMachineID = member.machine.ID
+		case ClusterSpecRoleSecondaryMaster:
+			req.SecondaryMasterMachineID = member.machine.ID
+		}
+		req.Installs = append(req.Installs, ClusterBootstrapInstall{
+			Machine: member.machine.IP, MachineID: member.machine.ID, Version: spec.MySQL.Version, Architecture: spec.Architecture,
+			Port: member.spec.Port, ServerID: clusterSpecServerID(member), MySQLUser: spec.MySQL.MySQLUser,
+			RootPassword: spec.MySQL.RootPassword, Profile: spec.MySQL.Profile, MemoryAllocator: spec.MySQL.MemoryAllocator,
+			InstallPTTools: spec.MySQL.InstallPTTools, InstallXtraBackup: spec.MySQL.InstallXtraBackup, Accounts: accounts,
+		})
+	}
+	if spec.VIP != nil {
+		req.EnableVIP = true
+		req.VIP = hadomain.ClusterVIPConfig{VIPName: spec.VIP.Name, VIPAddress: spec.VIP.Address, VIPPrefix: spec.VIP.Prefix, DefaultInterface: spec.VIP.Interface}
+	}
+	return req
+}
+
+func (s *ClusterSpecService) runBootstrap(ctx context.Context, parentID, cluster string, req ClusterBootstrapRequest) ([]string, error) {
+	detail, err := s.ha.StartClusterBootstrap(ctx, cluster, req)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{detail.Task.ID}
+	if err := s.tasks.AttachChildTasks(ctx, parentID, ids); err != nil {
+		return ids, err
+	}
+	deadline := time.Now().Add(clusterSpecBootstrapTimeout)
+	for time.Now().Before(deadline) {
+		current, err := s.tasks.GetTaskDetail(ctx, detail.Task.ID)
+		if err != nil {
+			return ids, err
+		}
+		switch current.Task.Status {
+		case taskdomain.StatusSuccess:
+			return ids, nil
+		case taskdomain.StatusFailed:
+			return ids, errors.New(taskFailureSummary(current))
+		}
+		select {
+		case <-ctx.Done():
+			return ids, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	return ids, errors.New("等待集群初始化超时")
+}
+
+func clusterSpecDesiredSource(spec ClusterSpec, member *clusterSpecMemberState, members []*clusterSpecMemberState) *clusterSpecMemberState {
+	find := func(role string) *clusterSpecMemberState {
+		for _, item := range members {
+			if item.spec.Role == role {
+				return item
+			}
+		}
+		return nil
+	}
+	switch member.spec.Role {
+	case ClusterSpecRolePrimary:
+		if spec.Architecture == hadomain.ArchitectureDualMaster {
+			return find(ClusterSpecRoleSecondaryMaster)
+		}
+		return nil
+	default:
+		return find(ClusterSpecRolePrimary)
+	}
+}
+
+func clusterSpecArchitectureRequest(spec ClusterSpec, members []*clusterSpecMemberState) hadomain.ArchitectureAdjustmentRequest {
+	req := hadomain.ArchitectureAdjustmentRequest{
+		Architecture: spec.Architecture, RootPassword: spec.MySQL.RootPassword,
+		ManagementUsers: []string{"root", "monitor", "mha", "backup", "repl"},
+	}
+	for _, member := range members {
+		node := hadomain.ArchitectureNodeRequest{MachineID: member.machine.ID, Port: member.spec.Port, Role: "M", ElectionPriority: member.spec.Priority}
+		if member.spec.Role == ClusterSpecRolePrimary {
+			req.PreferredNewMasterMachineID = member.machine.ID
+		}
+		if member.spec.Role == ClusterSpecRoleReplica {
+			node.Role = "S"
+		}
+		if source := clusterSpecDesiredSource(spec, member, members); source != nil {
+			node.SourceMachineID = source.machine.ID
+		}
+		req.Nodes = append(req.Nodes, node)
+	}
+	return req
+}
+
+// clusterSpecTopologyDrift 比较每个可探测实例的读写状态与复制来源。
+func clusterSpecTopologyDrift(spec ClusterSpec, members []*clusterSpecMemberState) []string {
+	var changes []string
+	for _, member := range members {
+		if member.instance == nil || !member.node.reachable {
+			continue
+		}
+		name := fmt.Sprintf("%s:%d", member.machine.IP, member.spec.Port)
+		writable := member.spec.Role != ClusterSpecRoleReplica
+		if writable && member.node.readOnly {
+			changes = append(changes, name+" 应可写，当前为只读")
+		}
+		if !writable && !member.node.readOnly {
+			changes = append(changes, name+" 应只读，当前可写")
+		}
+		current := ""
+		if member.node.channels > 0 {
+			current = fmt.Sprintf("%s:%d", member.node.sourceHost, member.node.sourcePort)
+		}
+		desired := ""
+		if source := clusterSpecDesiredSource(spec, member, members); source != nil {
+			desired = fmt.Sprintf("%s:%d", source.machine.IP, source.spec.Port)
+		}
+		switch {
+		case desired == current:
+		case desired == "":
+			changes = append(changes, fmt.Sprintf("%s 不应有复制来源，当前复制自 %s", name, current))
+		case current == "":
+			changes = append(changes, fmt.Sprintf("%s 应复制自 %s，当前没有复制通道", name, desired))
+		default:
+			changes = append(changes, fmt.Sprintf("%s 应复制自 %s，当前复制自 %s", name, desired, current))
+		}
+	}
+	return changes
+}
+
+func clusterSpecVIPDrift(want ClusterSpecVIP, current *hadomain.ClusterVIPConfig) []string {
+	if current == nil {
+		return []string{"VIP 尚未配置"}
+	}
+	var changes []string
+	if current.VIPPrefix != want.Prefix {
+		changes = append(changes, fmt.Sprintf("prefix %d → %d", current.VIPPrefix, want.Prefix))
+	}
+	if want.Interface != "" && current.DefaultInterface != want.Interface {
+		changes = append(changes, fmt.Sprintf("interface %s → %s", current.DefaultInterface, want.Interface))
+	}
+	if want.Name != "" && current.VIPName != want.Name {
+		changes = append(changes, fmt.Sprintf("name %s → %s", current.VIPName, want.Name))
+	}
+	if !current.Enabled {
+		changes = append(changes, "VIP 配置已停用")
+	}
+	return changes
+}
+
+func clusterSpecSemiSyncDrift(want ClusterSpecSemiSync, node clusterSpecNode) []string {
+	var changes []string
+	if node.semiSource != want.Enabled {
+		changes = append(changes, fmt.Sprintf("source_enabled %t → %t", node.semiSource, want.Enabled))
+	}
+	if node.semiReplica != want.Enabled {
+		changes = append(changes, fmt.Sprintf("replica_enabled %t → %t", node.semiReplica, want.Enabled))
+	}
+	if want.Enabled && node.semiTimeout != want.TimeoutMS {
+		changes = append(changes, fmt.Sprintf("timeout %d → %d", node.semiTimeout, want.TimeoutMS))
+	}
+	if want.Enabled && node.semiWait != want.WaitForReplicaCount {
+		changes = append(changes, fmt.Sprintf("wait_for_replica_count %d → %d", node.semiWait, want.WaitForReplicaCount))
+	}
+	return changes
+}
+
+// clusterSpecSemiSyncCommand 在每个成员上同时启用 source 与 replica 侧插件，
+// 切主后新主库无需再次配置。8.0.26 以前的版本回退到 master/slave 命名，
+// 不支持 SET PERSIST 时再回退到 SET GLOBAL。
+func clusterSpecSemiSyncCommand(cfg ClusterSpecSemiSync, port int) string {
+	client := mysqlArchitectureClient("", port)
+	execute := func(sql string) string {
+		return client + " --batch --raw --execute=" + shellQuote(sql)
+	}
+	quiet := func(sql string) string {
+		return "(" + execute(sql) + " >/dev/null 2>&1 || true); "
+	}
+	if !cfg.Enabled {
+		return "(" + execute("SET PERSIST rpl_semi_sync_source_enabled=OFF; SET PERSIST rpl_semi_sync_replica_enabled=OFF;") + " 2>/dev/null || " +
+			execute("SET PERSIST rpl_semi_sync_master_enabled=OFF; SET PERSIST rpl_semi_sync_slave_enabled=OFF;") + " 2>/dev/null || " +
+			execute("SET GLOBAL rpl_semi_sync_master_enabled=OFF; SET GLOBAL rpl_semi_sync_slave_enabled=OFF;") + ")"
+	}
+	modern := fmt.Sprintf("SET PERSIST rpl_semi_sync_source_enabled=ON; SET PERSIST rpl_semi_sync_source_timeout=%d; SET PERSIST rpl_semi_sync_source_wait_for_replica_count=%d; SET PERSIST rpl_semi_sync_replica_enabled=ON;", cfg.TimeoutMS, cfg.WaitForReplicaCount)
+	legacy := fmt.Sprintf("SET %%s rpl_semi_sync_master_enabled=ON; SET %%s rpl_semi_sync_master_timeout=%d; SET %%s rpl_semi_sync_master_wait_for_slave_count=%d; SET %%s rpl_semi_sync_slave_enabled=ON;", cfg.TimeoutMS, cfg.WaitForReplicaCount)
+	legacyPersist := strings.ReplaceAll(legacy, "%s", "PERSIST")
+	legacyGlobal := strings.ReplaceAll(legacy, "%s", "GLOBAL")
+	return "( " + quiet("INSTALL PLUGIN rpl_semi_sync_source SONAME 'semisync_source.so'") + quiet("INSTALL PLUGIN rpl_semi_sync_replica SONAME 'semisync_replica.so'") +
+		execute(modern) + " 2>/dev/null ) || ( " +
+		quiet("INSTALL PLUGIN rpl_semi_sync_master SONAME 'semisync_master.so'") + quiet("INSTALL PLUGIN rpl_semi_sync_slave SONAME 'semisync_slave.so'") +
+		"(" + execute(legacyPersist) + " 2>/dev/null || " + execute(legacyGlobal) + ") ) || exit 1; " +
+		"(" + execute("STOP REPLICA IO_THREAD; START REPLICA IO_THREAD") + " >/dev/null 2>&1 || " + execute("STOP SLAVE IO_THREAD; START SLAVE IO_THREAD") + " >/dev/null 2>&1 || true)"
+}
+
+func (s *ClusterSpecService) planBackups(ctx context.Context, spec ClusterSpec, members []*clusterSpecMemberState, exists, prune bool, add func(ClusterSpecAction), block func(string, ...any)) error {
+	if s.backups == nil || (len(spec.Backups) == 0 && !prune) {
+		return nil
+	}
+	var existing []backupdomain.Policy
+	if exists {
+		var err error
+		if existing, err = s.backups.ListPolicies(ctx, spec.Cluster); err != nil {
+			return err
+		}
+	}
+	byName := map[string]backupdomain.Policy{}
+	for _, policy := range existing {
+		byName[policy.Name] = policy
+	}
+	user, password := "", ""
+	if s.mysql != nil {
+		presets, err := s.mysql.AccountPresets(ctx)
+		if err != nil {
+			return err
+		}
+		for _, preset := range presets {
+			if preset.Role == "backup" && preset.Enabled {
+				user, password = preset.Username, preset.Password
+			}
+		}
+	}
+	for _, item := range spec.Backups {
+		startAt, _ := parseClusterSpecTime(item.StartAt)
+		want := backupdomain.Policy{
+			Name: item.Name, Cluster: spec.Cluster, Port: item.Port, BackupType: item.Type, DiskUsageThreshold: item.DiskUsageThreshold,
+			ScheduleType: item.Schedule, Weekdays: normalizeWeekdays(item.Weekdays), IntervalMinutes: item.IntervalMinutes, StartAt: startAt,
+			RetryCount: item.RetryCount, IncludeBinlog: item.IncludeBinlog, BackupLocation: item.Location, Enabled: item.Enabled == nil || *item.Enabled,
+		}
+		if item.Machine != "" {
+			var target *clusterSpecMemberState
+			for _, member := range members {
+				if member.spec.Machine == item.Machine || member.machine.ID == item.Machine || member.machine.Name == item.Machine || member.machine.IP == item.Machine {
+					target = member
+				}
+			}
+			if target == nil {
+				block("备份策略 %s 的 machine %s 不是集群成员", item.Name, item.Machine)
+				continue
+			}
+			want.MachineID = target.machine.ID
+			if want.Port == 0 {
+				want.Port = target.spec.Port
+			}
+		}
+		current, found := byName[item.Name]
+		var changes []string
+		if found {
+			want.ID, want.CreatedAt = current.ID, current.CreatedAt
+			if want.MachineID == "" {
+				want.MachineID, want.Port = current.MachineID, current.Port
+			}
+			want.MySQLUser, want.WeekdayBackupTypes = current.MySQLUser, current.WeekdayBackupTypes
+			if changes = clusterSpecBackupDrift(current, want); len(changes) == 0 {
+				continue
+			}
+		} else {
+			want.MySQLUser, want.MySQLPassword = user, password
+			changes = []string{"新建策略"}
+		}
+		policy := want
+		verb := map[bool]string{true: "更新", false: "创建"}[found]
+		add(ClusterSpecAction{Kind: "save_backup_policy", Target: item.Name, Summary: fmt.Sprintf("%s备份策略 %s", verb, item.Name), Changes: changes, run: func(ctx context.Context, _ string) ([]string, error) {
+			_, err := s.backups.SavePolicy(ctx, policy)
+			return nil, err
+		}})
+	}
+	if prune {
+		declared := map[string]bool{}
+		for _, item := range spec.Backups {
+			declared[item.Name] = true
+		}
+		for _, policy := range existing {
+			if declared[policy.Name] {
+				continue
+			}
+			id := policy.ID
+			add(ClusterSpecAction{Kind: "delete_backup_policy", Target: policy.Name, Summary: "删除规格外的备份策略 " + policy.Name, run: func(ctx context.Context, _ string) ([]string, error) {
+				return nil, s.backups.DeletePolicy(ctx, id)
+			}})
+		}
+	}
+	return nil
+}
+
+func clusterSpecBackupDrift(current, want backupdomain.Policy) []string {
+	var changes []string
+	compare := func(field string, before, after any) {
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, fmt.Sprintf("%s %v → %v", field, before, after))
+		}
+	}
+	compare("machine_id", current.MachineID, want.MachineID)
+	compare("port", current.Port, want.Port)
+	compare("backup_type", current.BackupType, want.BackupType)
+	compare("schedule_type", current.ScheduleType, want.ScheduleType)
+	if want.ScheduleType == backupdomain.ScheduleWeekly {
+		compare("weekdays", normalizeWeekdays(current.Weekdays), want.Weekdays)
+	}
+	if want.ScheduleType == backupdomain.ScheduleCustom {
+		compare("interval_minutes", current.IntervalMinutes, want.IntervalMinutes)
+	}
+	if !current.StartAt.Equal(want.StartAt) {
+		changes = append(changes, fmt.Sprintf("start_at %s → %s", current.StartAt.Format(time.RFC3339), want.StartAt.Format(time.RFC3339)))
+	}
+	compare("retry_count", current.RetryCount, want.RetryCount)
+	compare("include_binlog", current.IncludeBinlog, want.IncludeBinlog)
+	compare("backup_location", current.BackupLocation, want.BackupLocation)
+	compare("disk_usage_threshold", current.DiskUsageThreshold, want.DiskUsageThreshold)
+	compare("enabled", current.Enabled, want.Enabled)
+	return changes
+}
+
+func (s *ClusterSpecService) planAlerts(ctx context.Context, spec ClusterSpec, prune bool, add func(ClusterSpecAction)) error {
+	if s.alerts == nil || (len(spec.Alerts) == 0 && !prune) {
+		return nil
+	}
+	rules, err := s.alerts.ListRules(ctx)
+	if err != nil {
+		return err
+	}
+	byName := map[string]alertdomain.Rule{}
+	for _, rule := range rules {
+		if rule.ClusterID == spec.Cluster {
+			byName[rule.Name] = rule
+		}
+	}
+	for _, item := range spec.Alerts {
+		severity := alertdomain.Severity(item.Severity)
+		want := alertdomain.Rule{
+			Name: item.Name, Metric: item.Metric, Scope: "all", ClusterID: spec.Cluster, Labels: item.Labels,
+			Enabled: item.Enabled == nil || *item.Enabled, Operator: item.Operator, Threshold: item.Threshold, Severity: severity,
+			Thresholds:       []alertdomain.ThresholdLevel{{Severity: severity, Threshold: item.Threshold, Enabled: true}},
+			ConsecutiveCount: item.ConsecutiveCount, RepeatIntervalSeconds: item.RepeatIntervalSeconds,
+		}
+		current, found := byName[item.Name]
+		changes := []string{"新建集群级规则"}
+		if found {
+			want.ID, want.CreatedAt, want.Description, want.MaxNotifications = current.ID, current.CreatedAt, current.Description, current.MaxNotifications
+			if changes = clusterSpecAlertDrift(current, want); len(changes) == 0 {
+				continue
+			}
+		}
+		rule := want
+		verb := map[bool]string{true: "更新", false: "创建"}[found]
+		add(ClusterSpecAction{Kind: "save_alert_rule", Target: item.Name, Summary: fmt.Sprintf("%s集群告警规则 %s", verb, item.Name), Changes: changes, run: func(ctx context.Context, _ string) ([]string, error) {
+			_, err := s.alerts.SaveRule(ctx, rule)
+			return nil, err
+		}})
+	}
+	if prune {
+		declared := map[string]bool{}
+		for _, item := range spec.Alerts {
+			declared[item.Name] = true
+		}
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if declared[name] {
+				continue
+			}
+			id := byName[name].ID
+			add(ClusterSpecAction{Kind: "delete_alert_rule", Target: name, Summary: "删除规格外的集群告警规则 " + name, run: func(ctx context.Context, _ string) ([]string, error) {
+				return nil, s.alerts.DeleteRule(ctx, id)
+			}})
+		}
+	}
+	return nil
+}
+
+func clusterSpecAlertDrift(current, want alertdomain.Rule) []string {
+	var changes []string
+	compare := func(field string, before, after any) {
+		if !reflect.DeepEqual(before, after) {
+			changes = append(changes, fmt.Sprintf("%s %v → %v", field, before, after))
+		}
+	}
+	compare("metric", current.Metric, want.Metric)
+	compare("operator", current.Operator, want.Operator)
+	compare("threshold", current.Threshold, want.Threshold)
+	compare("severity", current.Severity, want.Severity)
+	if len(current.Labels) > 0 || len(want.Labels) > 0 {
+		compare("labels", current.Labels, want.Labels)
+	}
+	compare("consecutive_count", current.ConsecutiveCount, want.ConsecutiveCount)
+	compare("repeat_interval_seconds", current.RepeatIntervalSeconds, want.RepeatIntervalSeconds)
+	compare("enabled", current.Enabled, want.Enabled)
+	if len(current.Thresholds) > 1 {
+		changes = append(changes, "多级阈值收敛为单级")
+	}
+	return changes
+}
+
+// probe 读取每个已安装成员的读写状态、复制来源与半同步变量；停止或无法
+// 连接的实例保留 reachable=false，由调用方降级为警告。
+func (s *ClusterSpecService) probe(ctx context.Context, members []*clusterSpecMemberState) ([]string, error) {
+	var taskIDs []string
+	for _, member := range members {
+		if member.instance == nil || member.instance.Status == mysqlapp.StatusStopped {
+			continue
+		}
+		if compatible, _ := s.tasks.MachineCapability(member.machine.ID, taskdomain.CapabilityMySQLDefaultsFile); !compatible {
+			continue
+		}
+		taskID, output, err := s.tasks.RunExecTask(ctx, member.machine.IP, mysqlArchitectureCommand("", member.spec.Port, clusterSpecNodeSQL()), ExecTaskOptions{
+			Operation: "cluster_spec_probe", DisplayName: "探测集群规格状态 " + member.machine.Name, StepName: "读取读写状态、复制来源与半同步参数", Port: member.spec.Port,
+		}, clusterSpecProbeTimeout)
+		if taskID != "" {
+			taskIDs = append(taskIDs, taskID)
+		}
+		if err != nil {
+			continue
+		}
+		if node, ok := parseClusterSpecNode(output); ok {
+			member.node = node
+		}
+	}
+	return taskIDs, nil
+}
+
+func clusterSpecNodeSQL() string {
+	variable := func(names ...string) string {
+		return fmt.Sprintf("IFNULL((SELECT MAX(VARIABLE_VALUE) FROM performance_schema.global_variables WHERE VARIABLE_NAME IN ('%s')), '')", strings.Join(names, "','"))
+	}
+	return fmt.Sprintf("SELECT '%s', @@global.read_only, "+
+		"(SELECT COUNT(*) FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), "+
+		"CONCAT('host:', IFNULL((SELECT HOST FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), '')), "+
+		"IFNULL((SELECT PORT FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), 0), "+
+		"CONCAT('v:', %s), CONCAT('v:', %s), CONCAT('v:', %s), CONCAT('v:', %s);", clusterSpecNodeMarker,
+		variable("rpl_semi_sync_source_enabled", "rpl_semi_sync_master_enabled"),
+		variable("rpl_semi_sync_replica_enabled", "rpl_semi_sync_slave_enabled"),
+		variable("rpl_semi_sync_source_timeout", "rpl_semi_sync_master_timeout"),
+		variable("rpl_semi_sync_source_wait_for_replica_count", "rpl_semi_sync_master_wait_for_slave_count"))
+}
+
+func parseClusterSpecNode(output string) (clusterSpecNode, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 9 || fields[0] != clusterSpecNodeMarker {
+			continue
+		}
+		value := func(index int) string { return strings.TrimPrefix(fields[index], "v:") }
+		channels, _ := strconv.Atoi(fields[2])
+		port, _ := strconv.Atoi(fields[4])
+		timeout, _ := strconv.Atoi(value(7))
+		wait, _ := strconv.Atoi(value(8))
+		return clusterSpecNode{
+			reachable: true, readOnly: fields[1] == "1", channels: channels, sourceHost: strings.TrimPrefix(fields[3], "host:"), sourcePort: port,
+			semiSource: strings.EqualFold(value(5), "ON"), semiReplica: strings.EqualFold(value(6), "ON"), semiTimeout: timeout, semiWait: wait,
+		}, true
+	}
+	return clusterSpecNode{}, false
+}
+
+// CreateClusterSpecTrackingTask 为一次规格应用创建 Manager 父任务，计划中的
+// 每个动作对应一个步骤。
+func (s *TaskService) CreateClusterSpecTrackingTask(ctx context.Context, taskID, cluster string, actions []ClusterSpecAction) (TaskDetail, error) {
+	if len(actions) == 0 {
+		return TaskDetail{}, errors.New("计划为空")
+	}
+	now := time.Now().UTC()
+	spec, err := json.Marshal(map[string]any{
+		"operation": "cluster_spec_apply", "display_name": "应用集群规格 " + cluster,
+		"cluster": cluster, "targets": len(actions),
+	})
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	task := taskdomain.Task{ID: taskID, Type: taskdomain.TypeClusterSpecApply, MachineID: cluster, AgentID: "manager", Status: taskdomain.StatusPending, CurrentStep: actions[0].Step, SpecJSON: spec, CreatedAt: now}
+	steps := make([]taskdomain.Step, 0, len(actions))
+	for index, action := range actions {
+		steps = append(steps, taskdomain.Step{ID: taskID + "-" + action.Step, TaskID: taskID, StepNo: index + 1, StepName: action.Step, Status: taskdomain.StepPending, Message: action.Summary})
+	}
+	events := []taskdomain.Event{{ID: fmt.Sprintf("%s-created-%d", taskID, now.UnixNano()), TaskID: taskID, StepID: steps[0].ID, EventType: taskdomain.EventInfo, Content: fmt.Sprintf("已按规格为集群 %s 生成 %d 步计划。", cluster, len(actions)), CreatedAt: now}}
+	if err := s.repo.CreateTask(ctx, task, steps, events); err != nil {
+		return TaskDetail{}, err
+	}
+	return s.GetTaskDetail(ctx, taskID)
+}
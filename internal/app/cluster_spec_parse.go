@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var clusterSpecSecretPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ParseClusterSpec 解析 YAML 或 JSON 格式的集群声明，YAML 支持的写法见
+// parseYAMLTree；出现未知字段时直接报错，避免拼写错误被静默忽略。
+func ParseClusterSpec(content string) (ClusterSpec, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	var spec ClusterSpec
+	if strings.HasPrefix(strings.TrimSpace(content), "{") {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&spec); err != nil {
+			return ClusterSpec{}, fmt.Errorf("解析集群规格失败: %w", err)
+		}
+		return spec, nil
+	}
+	tree, err := parseYAMLTree(content, "规格")
+	if err != nil {
+		return ClusterSpec{}, err
+	}
+	if tree == nil {
+		return ClusterSpec{}, errors.New("集群规格为空")
+	}
+	if err := decodeSpecValue(tree, reflect.ValueOf(&spec).Elem(), ""); err != nil {
+		return ClusterSpec{}, err
+	}
+	return spec, nil
+}
+
+// ExpandClusterSpecSecrets 用 lookup 替换规格中的 ${NAME} 引用，供 CLI 从环境
+// 变量注入 root 密码等敏感值，规格文件本身因此可以直接纳入版本管理。
+func ExpandClusterSpecSecrets(content string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+	expanded := clusterSpecSecretPattern.ReplaceAllStringFunc(content, func(match string) string {
+		name := clusterSpecSecretPattern.FindStringSubmatch(match)[1]
+		value, ok := lookup(name)
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("未设置规格引用的环境变量: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// decodeSpecValue 按目标字段类型把解析树写入结构体；标量在 YAML 中一律保留为
+// 字符串，由字段类型决定转换方式，因此纯数字密码或 8.0 这样的版本号不会丢失。
+func decodeSpecValue(node any, target reflect.Value, path string) error {
+	name := path
+	if name == "" {
+		name = "规格"
+	}
+	switch target.Kind() {
+	case reflect.Pointer:
+		if text, ok := node.(string); ok && text == "" {
+			return nil
+		}
+		value := reflect.New(target.Type().Elem())
+		if err := decodeSpecValue(node, value.Elem(), path); err != nil {
+			return err
+		}
+		target.Set(value)
+		return nil
+	case reflect.Struct:
+		fields, ok := node.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s 应为对象", name)
+		}
+		index := map[string]int{}
+		for i := 0; i < target.NumField(); i++ {
+			tag, _, _ := strings.Cut(target.Type().Field(i).Tag.Get("json"), ",")
+			if tag != "" && tag != "-" {
+				index[tag] = i
+			}
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			i, ok := index[key]
+			if !ok {
+				return fmt.Errorf("%s 包含未知字段 %q", name, key)
+			}
+			if err := decodeSpecValue(fields[key], target.Field(i), joinSpecPath(path, key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		items, ok := node.([]any)
+		if !ok {
+			if text, isText := node.(string); isText && text == "" {
+				return nil
+			}
+			return fmt.Errorf("%s 应为列表", name)
+		}
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeSpecValue(item, slice.Index(i), fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+		return nil
+	case reflect.Map:
+		fields, ok := node.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s 应为对象", name)
+		}
+		out := reflect.MakeMapWithSize(target.Type(), len(fields))
+		for key, value := range fields {
+			item := reflect.New(target.Type().Elem()).Elem()
+			if err := decodeSpecValue(value, item, joinSpecPath(path, key)); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(key), item)
+		}
+		target.Set(out)
+		return nil
+	}
+	text, ok := node.(string)
+	if !ok {
+		return fmt.Errorf("%s 应为标量值", name)
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(text)
+	case reflect.Bool:
+		value, err := parseInventoryBool(text)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		target.SetBool(value)
+	case reflect.Int:
+		if text == "" {
+			return nil
+		}
+		value, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("%s 应为整数，实际为 %q", name, text)
+		}
+		target.SetInt(int64(value))
+	case reflect.Float64:
+		if text == "" {
+			return nil
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%s 应为数字，实际为 %q", name, text)
+		}
+		target.SetFloat(value)
+	default:
+		return fmt.Errorf("%s 的类型不受支持", name)
+	}
+	return nil
+}
+
+func joinSpecPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
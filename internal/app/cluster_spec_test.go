@@ -0,0 +1,326 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	backupdomain "gmha/internal/domain/backup"
+	clusterdomain "gmha/internal/domain/cluster"
+	machinedomain "gmha/internal/domain/machine"
+	persistencesqlite "gmha/internal/infrastructure/persistence/sqlite"
+	mysqlapp "gmha/internal/mysql"
+	_ "modernc.org/sqlite"
+)
+
+const clusterSpecTestYAML = `# 生产集群
+cluster: prod-a
+architecture: master_slave
+mysql:
+  version: 8.0.36
+  profile: prod
+  root_password: "${ROOT_PW}"
+members:
+  - machine: db-01
+    role: primary
+    priority: 100
+  - machine: 10.0.0.2
+    role: replica
+  - machine: db-03
+    role: replica
+semi_sync:
+  enabled: yes
+  timeout_ms: 5000
+backups:
+  - name: nightly
+    machine: db-02
+    schedule: weekly
+    weekdays: [1, 3, 5]
+    start_at: "2026-01-01T02:00:00Z"
+    include_binlog: true
+alerts:
+  - name: replica-lag
+    metric: mysql_replication_delay_seconds
+    operator: ">"
+    threshold: 30
+    labels: {}
+`
+
+func TestParseClusterSpecAcceptsYAMLAndJSON(t *testing.T) {
+	expanded, err := ExpandClusterSpecSecrets(clusterSpecTestYAML, func(name string) (string, bool) {
+		return map[string]string{"ROOT_PW": "123456"}[name], name == "ROOT_PW"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ParseClusterSpec(expanded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.MySQL.RootPassword != "123456" || spec.MySQL.Version != "8.0.36" || spec.SemiSync == nil || !spec.SemiSync.Enabled || spec.SemiSync.TimeoutMS != 5000 {
+		t.Fatalf("numeric-looking scalars must keep their text: %+v", spec)
+	}
+	if len(spec.Members) != 3 || spec.Members[1] != (ClusterSpecMember{Machine: "10.0.0.2", Role: ClusterSpecRoleReplica}) || spec.Members[0].Priority != 100 {
+		t.Fatalf("unexpected members %+v", spec.Members)
+	}
+	if len(spec.Alerts) != 1 || spec.Alerts[0].Operator != ">" || spec.Alerts[0].Threshold != 30 || len(spec.Backups) != 1 || !spec.Backups[0].IncludeBinlog {
+		t.Fatalf("unexpected policies %+v %+v", spec.Backups, spec.Alerts)
+	}
+
+	fromJSON, err := ParseClusterSpec(`{"cluster":"prod-a","mysql":{"version":"8.0.36"},"members":[{"machine":"db-01","role":"primary"}]}`)
+	if err != nil || fromJSON.Cluster != "prod-a" || fromJSON.Members[0].Machine != "db-01" {
+		t.Fatalf("json spec: %+v %v", fromJSON, err)
+	}
+	if _, err := ParseClusterSpec("cluster: prod-a\nmembrs: []\n"); err == nil || !strings.Contains(err.Error(), "membrs") {
+		t.Fatalf("unknown fields must be rejected, got %v", err)
+	}
+	if _, err := ParseClusterSpec(`{"cluster":"prod-a","vips":[]}`); err == nil {
+		t.Fatal("unknown json fields must be rejected")
+	}
+	if _, err := ExpandClusterSpecSecrets(clusterSpecTestYAML, func(string) (string, bool) { return "", false }); err == nil || !strings.Contains(err.Error(), "ROOT_PW") {
+		t.Fatalf("missing secrets must be reported, got %v", err)
+	}
+}
+
+func TestNormalizeClusterSpecValidatesRoles(t *testing.T) {
+	base := func() ClusterSpec {
+		return ClusterSpec{Cluster: "prod-a", MySQL: ClusterSpecMySQL{Version: "8.0.36"}, Members: []ClusterSpecMember{
+			{Machine: "db-01", Role: ClusterSpecRolePrimary}, {Machine: "db-02", Role: ClusterSpecRoleReplica},
+		}}
+	}
+	spec := base()
+	if err := normalizeClusterSpec(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Architecture != "master_slave" || spec.Members[1].Port != 3306 || spec.Members[1].Priority != 50 {
+		t.Fatalf("defaults not applied: %+v", spec)
+	}
+	spec = base()
+	spec.Architecture = "dual_master"
+	if err := normalizeClusterSpec(&spec); err == nil {
+		t.Fatal("dual_master without a secondary_master must be rejected")
+	}
+	spec = base()
+	spec.Members[1].Role = ClusterSpecRolePrimary
+	if err := normalizeClusterSpec(&spec); err == nil {
+		t.Fatal("two primaries must be rejected")
+	}
+	spec = base()
+	spec.MySQL.RootPassword = "${ROOT_PW}"
+	if err := normalizeClusterSpec(&spec); err == nil {
+		t.Fatal("unexpanded secrets must be rejected")
+	}
+}
+
+func newClusterSpecTestService(t *testing.T) (*ClusterSpecService, *persistencesqlite.MachineRepository, *persistencesqlite.MySQLInstanceRepository, *persistencesqlite.ClusterRepository) {
+	t.Helper()
+	db, err := sql.Open("sqlite", t.TempDir()+"/cluster-spec.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	store := persistencesqlite.NewDB(db, persistencesqlite.DialectSQLite)
+	clusterRepo := persistencesqlite.NewClusterRepository(store)
+	machineRepo := persistencesqlite.NewMachineRepository(store)
+	instanceRepo := persistencesqlite.NewMySQLInstanceRepository(store)
+	haRepo := persistencesqlite.NewHARepository(store)
+	backupRepo := persistencesqlite.NewBackupRepository(store)
+	alertRepo := persistencesqlite.NewAlertRepository(store)
+	for name, migrate := range map[string]func() error{
+		"cluster": clusterRepo.Migrate, "machine": machineRepo.Migrate, "instance": instanceRepo.Migrate,
+		"ha": haRepo.Migrate, "backup": backupRepo.Migrate, "alert": alertRepo.Migrate,
+	} {
+		if err := migrate(); err != nil {
+			t.Fatalf("migrate %s: %v", name, err)
+		}
+	}
+	now := time.Now().UTC()
+	for i, name := range []string{"db-01", "db-02", "db-03"} {
+		ip := fmt.Sprintf("10.0.0.%d", i+1)
+		if _, err := machineRepo.Save(context.Background(), machinedomain.Machine{ID: "m-" + name, Name: name, IP: ip, SSHPort: 22, SSHUser: "root", Status: machinedomain.StatusAgentOnline, CreatedAt: now, UpdatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := NewClusterSpecService(nil, clusterRepo, machineRepo, instanceRepo, nil, NewHAService(haRepo, machineRepo, instanceRepo),
+		NewBackupService(backupRepo, nil, machineRepo, instanceRepo), NewAlertService(alertRepo), nil)
+	return service, machineRepo, instanceRepo, clusterRepo
+}
+
+func clusterSpecActionKinds(plan ClusterSpecPlan) []string {
+	kinds := make([]string, 0, len(plan.Actions))
+	for _, action := range plan.Actions {
+		kinds = append(kinds, action.Kind)
+	}
+	return kinds
+}
+
+func TestClusterSpecPlanBootstrapsNewCluster(t *testing.T) {
+	service, _, _, _ := newClusterSpecTestService(t)
+	service.probeNodes = func(context.Context, []*clusterSpecMemberState) ([]string, error) {
+		t.Fatal("a cluster without instances is bootstrapped, not probed")
+		return nil, nil
+	}
+	spec, err := ParseClusterSpec(strings.ReplaceAll(clusterSpecTestYAML, "${ROOT_PW}", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := service.Plan(context.Background(), spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"create_cluster", "assign_member", "assign_member", "assign_member", "bootstrap_cluster",
+		"configure_semi_sync", "configure_semi_sync", "configure_semi_sync", "save_backup_policy", "save_alert_rule"}
+	if !reflect.DeepEqual(clusterSpecActionKinds(plan), want) || !plan.Executable || plan.InSync {
+		t.Fatalf("unexpected plan %v %+v", clusterSpecActionKinds(plan), plan)
+	}
+	if plan.Actions[4].Step != "05-bootstrap_cluster" {
+		t.Fatalf("steps must be numbered in execution order, got %s", plan.Actions[4].Step)
+	}
+
+	spec.MySQL.RootPassword = ""
+	plan, _ = service.Plan(context.Background(), spec, false)
+	if plan.Executable || len(plan.BlockingReasons) == 0 {
+		t.Fatal("installing without a root password must be blocked")
+	}
+	spec.Members[2].Machine = "db-09"
+	plan, _ = service.Plan(context.Background(), spec, false)
+	if plan.Executable || !strings.Contains(strings.Join(plan.BlockingReasons, ";"), "db-09") {
+		t.Fatalf("unknown machines must block the plan: %+v", plan.BlockingReasons)
+	}
+}
+
+func TestClusterSpecServerIDsDoNotCollide(t *testing.T) {
+	host := machinedomain.Machine{ID: "m-db-01", Name: "db-01", IP: "10.0.0.1"}
+	first := clusterSpecServerID(&clusterSpecMemberState{spec: ClusterSpecMember{Port: 3306}, machine: host})
+	second := clusterSpecServerID(&clusterSpecMemberState{spec: ClusterSpecMember{Port: 3406}, machine: host})
+	if first == second || first <= 0 || second <= 0 {
+		t.Fatalf("instances on one host must get distinct server_ids, got %d and %d", first, second)
+	}
+
+	service, machineRepo, _, _ := newClusterSpecTestService(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if _, err := machineRepo.Save(ctx, machinedomain.Machine{ID: "m-db-04", Name: "db-04", IP: "10.1.0.1", SSHPort: 22, SSHUser: "root", Status: machinedomain.StatusAgentOnline, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ParseClusterSpec(strings.ReplaceAll(clusterSpecTestYAML, "${ROOT_PW}", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Members[2].Machine = "db-04"
+	plan, err := service.Plan(ctx, spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Executable || !strings.Contains(strings.Join(plan.BlockingReasons, ";"), "server_id") {
+		t.Fatalf("members sharing a derived server_id must block the plan: %+v", plan.BlockingReasons)
+	}
+	spec.Members[2].ServerID = 9
+	if plan, _ = service.Plan(ctx, spec, false); !plan.Executable {
+		t.Fatalf("an explicit server_id resolves the collision: %+v", plan.BlockingReasons)
+	}
+}
+
+func TestClusterSpecPlanReconcilesLiveCluster(t *testing.T) {
+	service, machineRepo, instanceRepo, clusterRepo := newClusterSpecTestService(t)
+	ctx := context.Background()
+	if err := clusterRepo.Create(ctx, clusterdomain.Cluster{Name: "prod-a"}); err != nil {
+		t.Fatal(err)
+	}
+	machines, _ := machineRepo.List(ctx)
+	for _, machine := range machines {
+		machine.Cluster = "prod-a"
+		if _, err := machineRepo.Save(ctx, machine); err != nil {
+			t.Fatal(err)
+		}
+		if err := instanceRepo.Save(ctx, mysqlapp.Instance{MachineID: machine.ID, Port: 3306, Version: "8.0.36", Profile: "prod", Status: mysqlapp.StatusRunning, UpdatedAt: time.Now().UTC()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// db-03 仍可写且关闭了半同步，其余成员与规格一致。
+	nodes := map[string]clusterSpecNode{
+		"db-01": {reachable: true, semiSource: true, semiReplica: true, semiTimeout: 5000, semiWait: 1},
+		"db-02": {reachable: true, readOnly: true, channels: 1, sourceHost: "10.0.0.1", sourcePort: 3306, semiSource: true, semiReplica: true, semiTimeout: 5000, semiWait: 1},
+		"db-03": {reachable: true, channels: 1, sourceHost: "10.0.0.1", sourcePort: 3306},
+	}
+	service.probeNodes = func(_ context.Context, members []*clusterSpecMemberState) ([]string, error) {
+		for _, member := range members {
+			member.node = nodes[member.machine.Name]
+		}
+		return []string{"probe-1"}, nil
+	}
+	if _, err := service.backups.SavePolicy(ctx, clusterSpecTestPolicy("legacy")); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := ParseClusterSpec(strings.ReplaceAll(clusterSpecTestYAML, "${ROOT_PW}", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := service.Plan(ctx, spec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"apply_architecture", "configure_semi_sync", "save_backup_policy", "delete_backup_policy", "save_alert_rule"}
+	if !reflect.DeepEqual(clusterSpecActionKinds(plan), want) {
+		t.Fatalf("unexpected plan %v", clusterSpecActionKinds(plan))
+	}
+	if got := strings.Join(plan.Actions[0].Changes, ";"); got != "10.0.0.3:3306 应只读，当前可写" {
+		t.Fatalf("topology drift should only flag db-03, got %q", got)
+	}
+	if plan.Actions[1].Target != "10.0.0.3:3306" || len(plan.ProbeTaskIDs) != 1 {
+		t.Fatalf("semi-sync should only be reconfigured on db-03: %+v", plan.Actions[1])
+	}
+
+	// 执行备份与告警步骤后再次 plan，这两类资源应当已收敛。
+	for _, action := range plan.Actions[2:] {
+		if _, err := action.run(ctx, ""); err != nil {
+			t.Fatalf("%s: %v", action.Kind, err)
+		}
+	}
+	nodes["db-03"] = nodes["db-02"]
+	plan, err = service.Plan(ctx, spec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 0 || !plan.InSync {
+		t.Fatalf("converged cluster should be in sync, got %v", clusterSpecActionKinds(plan))
+	}
+
+	spec.Alerts[0].Threshold = 60
+	plan, _ = service.Plan(ctx, spec, false)
+	if !reflect.DeepEqual(clusterSpecActionKinds(plan), []string{"save_alert_rule"}) || plan.Actions[0].Changes[0] != "threshold 30 → 60" {
+		t.Fatalf("threshold drift should update the rule: %+v", plan.Actions)
+	}
+}
+
+func TestClusterSpecTopologyDriftFollowsDualMasterSources(t *testing.T) {
+	spec := ClusterSpec{Architecture: "dual_master"}
+	member := func(name, ip, role string, node clusterSpecNode) *clusterSpecMemberState {
+		return &clusterSpecMemberState{spec: ClusterSpecMember{Machine: name, Role: role, Port: 3306}, machine: machinedomain.Machine{ID: name, IP: ip}, instance: &mysqlapp.Instance{}, node: node}
+	}
+	members := []*clusterSpecMemberState{
+		member("db-01", "10.0.0.1", ClusterSpecRolePrimary, clusterSpecNode{reachable: true}),
+		member("db-02", "10.0.0.2", ClusterSpecRoleSecondaryMaster, clusterSpecNode{reachable: true, channels: 1, sourceHost: "10.0.0.1", sourcePort: 3306}),
+	}
+	changes := clusterSpecTopologyDrift(spec, members)
+	if !reflect.DeepEqual(changes, []string{"10.0.0.1:3306 应复制自 10.0.0.2:3306，当前没有复制通道"}) {
+		t.Fatalf("unexpected drift %v", changes)
+	}
+	members[0].node = clusterSpecNode{reachable: true, channels: 1, sourceHost: "10.0.0.2", sourcePort: 3306}
+	if changes := clusterSpecTopologyDrift(spec, members); len(changes) != 0 {
+		t.Fatalf("converged dual master should have no drift, got %v", changes)
+	}
+}
+
+func clusterSpecTestPolicy(name string) backupdomain.Policy {
+	return backupdomain.Policy{
+		Name: name, Cluster: "prod-a", MachineID: "m-db-01", Port: 3306, ScheduleType: backupdomain.ScheduleWeekly,
+		Weekdays: []int{0}, StartAt: time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC), Enabled: true,
+	}
+}
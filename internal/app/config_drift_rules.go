@@ -0,0 +1,438 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	driftdomain "gmha/internal/domain/configdrift"
+)
+
+var configDriftNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// configDriftNodeVariables differ between nodes by design: identity, role,
+// paths, replication state and the server version during a rolling upgrade. They are never compared across nodes and
+// cannot be part of a cluster's desired set.
+var configDriftNodeVariables = map[string]bool{
+	"server_id": true, "server_uuid": true, "hostname": true, "report_host": true, "report_port": true,
+	"port": true, "mysqlx_port": true, "admin_port": true, "bind_address": true, "admin_address": true, "mysqlx_bind_address": true,
+	"read_only": true, "super_read_only": true,
+	"rpl_semi_sync_master_enabled": true, "rpl_semi_sync_source_enabled": true,
+	"rpl_semi_sync_slave_enabled": true, "rpl_semi_sync_replica_enabled": true,
+	"datadir": true, "basedir": true, "tmpdir": true, "relay_log": true, "log_error": true, "innodb_tmpdir": true,
+	"innodb_data_home_dir": true, "innodb_log_group_home_dir": true, "innodb_undo_directory": true, "innodb_temp_tablespaces_dir": true,
+	"timestamp": true, "pseudo_thread_id": true, "warning_count": true, "error_count": true,
+	"version": true, "innodb_version": true,
+}
+
+// configDriftAliases maps renamed variables so a desired or configured name
+// still finds the runtime value on releases that use the other spelling.
+var configDriftAliases = map[string]string{
+	"log_replica_updates": "log_slave_updates", "log_slave_updates": "log_replica_updates",
+	"log_slow_replica_statements": "log_slow_slave_statements", "log_slow_slave_statements": "log_slow_replica_statements",
+	"transaction_isolation": "tx_isolation", "tx_isolation": "transaction_isolation",
+}
+
+func configDriftPerNode(name string) bool {
+	if configDriftNodeVariables[name] || strings.HasPrefix(name, "gtid_") {
+		return true
+	}
+	for _, suffix := range []string{"_file", "_dir", "_path", "_basename", "_index", "_socket"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return name == "socket"
+}
+
+// normalizeConfigDriftName turns an option name as written in my.cnf into the
+// variable name: lower case, underscores, no loose- prefix.
+func normalizeConfigDriftName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.ReplaceAll(name, "-", "_")
+	return strings.TrimPrefix(name, "loose_")
+}
+
+func configDriftLookup(values map[string]string, name string) (string, bool) {
+	if value, ok := values[name]; ok {
+		return value, true
+	}
+	if alias := configDriftAliases[name]; alias != "" {
+		value, ok := values[alias]
+		return value, ok
+	}
+	return "", false
+}
+
+// configDriftStartup returns the value the variable gets at the next start
+// and its source: mysqld-auto.cnf wins over my.cnf. Boolean options written
+// as skip-X, disable-X or enable-X map onto X.
+func configDriftStartup(snapshot driftdomain.Snapshot, name string) (string, string, bool) {
+	if value, ok := configDriftLookup(snapshot.Persisted, name); ok {
+		return value, "mysqld-auto.cnf", true
+	}
+	value, ok := configDriftConfigValue(snapshot.Config, name)
+	return value, "my.cnf", ok
+}
+
+func configDriftConfigValue(config map[string]string, name string) (string, bool) {
+	if value, ok := configDriftLookup(config, name); ok {
+		if name == "log_bin" && strings.Contains(value, "/") {
+			return "ON", true
+		}
+		return value, true
+	}
+	for prefix, flag := range map[string]string{"skip_": "OFF", "disable_": "OFF", "enable_": "ON"} {
+		if value, ok := config[prefix+name]; ok {
+			if enabled, isBool := configDriftBool(configDriftValue(value)); isBool && !enabled {
+				return map[string]string{"OFF": "ON", "ON": "OFF"}[flag], true
+			}
+			return flag, true
+		}
+	}
+	return "", false
+}
+
+// configDriftConfigNames lists the variables the startup configuration sets,
+// translating skip-X style flags when the runtime only knows X.
+func configDriftConfigNames(snapshot driftdomain.Snapshot) []string {
+	seen := make(map[string]bool)
+	for name := range snapshot.Config {
+		if _, ok := snapshot.Runtime[name]; !ok {
+			for _, prefix := range []string{"skip_", "disable_", "enable_"} {
+				if base, cut := strings.CutPrefix(name, prefix); cut {
+					if _, known := snapshot.Runtime[base]; known {
+						name = base
+						break
+					}
+				}
+			}
+		}
+		seen[name] = true
+	}
+	for name := range snapshot.Persisted {
+		seen[name] = true
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configDriftEqual compares an expected value (desired or configured) with an
+// actual one the way MySQL interprets them: ON/1, size suffixes, numeric
+// formatting, list order and partial optimizer_switch style flag lists. The
+// buffer pool is rounded up by the server to a multiple of chunk size times
+// instances, so a value inside that step matches when runtime is given.
+func configDriftEqual(name, expected, actual string, runtime map[string]string) bool {
+	e, a := configDriftValue(expected), configDriftValue(actual)
+	if strings.EqualFold(e, a) {
+		return true
+	}
+	if eb, ok := configDriftBool(e); ok {
+		if ab, ok := configDriftBool(a); ok {
+			return eb == ab
+		}
+	}
+	en, eok := configDriftNumber(e)
+	an, aok := configDriftNumber(a)
+	if eok && aok {
+		if name == "innodb_buffer_pool_size" && runtime != nil {
+			step := 128.0 * 1024 * 1024
+			if chunk, ok := configDriftNumber(runtime["innodb_buffer_pool_chunk_size"]); ok && chunk > 0 {
+				step = chunk
+			}
+			if instances, ok := configDriftNumber(runtime["innodb_buffer_pool_instances"]); ok && instances > 0 {
+				step *= instances
+			}
+			return an >= en && an-en < step
+		}
+		return math.Abs(en-an) <= 1e-9*math.Max(1, math.Abs(en))
+	}
+	if strings.Contains(e, ",") || strings.Contains(a, ",") {
+		expectedItems, actualItems := configDriftList(e), configDriftList(a)
+		flags := true
+		for item := range expectedItems {
+			flags = flags && strings.Contains(item, "=")
+		}
+		if !flags && len(expectedItems) != len(actualItems) {
+			return false
+		}
+		for item := range expectedItems {
+			if !actualItems[item] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func configDriftValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	if len(value) > 1 && strings.HasPrefix(value, "/") {
+		value = strings.TrimRight(value, "/")
+	}
+	return value
+}
+
+func configDriftBool(value string) (bool, bool) {
+	switch strings.ToUpper(value) {
+	case "ON", "TRUE", "YES", "1":
+		return true, true
+	case "OFF", "FALSE", "NO", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// configDriftNumber parses numbers with MySQL size suffixes (K, M, G, T, P).
+func configDriftNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	multiplier := 1.0
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	case 't', 'T':
+		multiplier = 1 << 40
+	case 'p', 'P':
+		multiplier = 1 << 50
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number * multiplier, true
+}
+
+func configDriftList(value string) map[string]bool {
+	items := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items[item] = true
+		}
+	}
+	return items
+}
+
+// configDriftRole derives the replication role from read_only; the Manager
+// keeps the writable node of a cluster read_only=OFF.
+func configDriftRole(runtime map[string]string) string {
+	value, ok := runtime["read_only"]
+	if !ok {
+		return ""
+	}
+	if enabled, _ := configDriftBool(configDriftValue(value)); enabled {
+		return driftdomain.RoleReplica
+	}
+	return driftdomain.RolePrimary
+}
+
+// evaluateConfigDrift compares one instance with the desired set, its own
+// startup configuration and the cluster reference values. reference maps a
+// variable to the value nodes should agree on and referenceNode describes
+// where it came from.
+func evaluateConfigDrift(desired driftdomain.Desired, snapshot driftdomain.Snapshot, reference map[string]string, referenceNode map[string]string) []driftdomain.Finding {
+	ignored := make(map[string]bool, len(desired.Ignore))
+	for _, name := range desired.Ignore {
+		ignored[name] = true
+	}
+	findings := make([]driftdomain.Finding, 0)
+	covered := make(map[string]bool)
+
+	names := make([]string, 0, len(desired.Parameters))
+	for name := range desired.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ignored[name] {
+			continue
+		}
+		want := desired.Parameters[name]
+		runtime, hasRuntime := configDriftLookup(snapshot.Runtime, name)
+		startup, source, hasStartup := configDriftStartup(snapshot, name)
+		persisted, _ := configDriftLookup(snapshot.Persisted, name)
+		config, _ := configDriftConfigValue(snapshot.Config, name)
+		base := driftdomain.Finding{Variable: name, Severity: "warning", Desired: want, Config: config, Persisted: persisted, Runtime: runtime}
+		if !hasRuntime {
+			finding := base
+			finding.Kind, finding.Message = driftdomain.KindDesiredRuntime, fmt.Sprintf("实例没有变量 %s，期望 %s", name, want)
+			findings = append(findings, finding)
+			covered[name] = true
+			continue
+		}
+		if !configDriftEqual(name, want, runtime, snapshot.Runtime) {
+			finding := base
+			finding.Kind, finding.Message = driftdomain.KindDesiredRuntime, fmt.Sprintf("运行值 %s 与期望 %s 不一致", runtime, want)
+			findings = append(findings, finding)
+			covered[name] = true
+		}
+		if hasStartup && !configDriftEqual(name, want, startup, nil) {
+			finding := base
+			finding.Kind, finding.Message = driftdomain.KindDesiredConfig, fmt.Sprintf("%s 中为 %s，与期望 %s 不一致，重启后会恢复为该值", source, startup, want)
+			findings = append(findings, finding)
+			covered[name] = true
+		}
+	}
+
+	if snapshot.Config != nil {
+		for _, name := range configDriftConfigNames(snapshot) {
+			if ignored[name] || covered[name] {
+				continue
+			}
+			runtime, hasRuntime := configDriftLookup(snapshot.Runtime, name)
+			if !hasRuntime {
+				continue
+			}
+			config, hasConfig := configDriftConfigValue(snapshot.Config, name)
+			persisted, hasPersisted := configDriftLookup(snapshot.Persisted, name)
+			base := driftdomain.Finding{Variable: name, Severity: "notice", Config: config, Persisted: persisted, Runtime: runtime}
+			if hasConfig && hasPersisted && !configDriftEqual(name, config, persisted, nil) {
+				finding := base
+				finding.Kind, finding.Message = driftdomain.KindPersistedOverride, fmt.Sprintf("mysqld-auto.cnf 中的持久化值 %s 覆盖 my.cnf 的 %s", persisted, config)
+				findings = append(findings, finding)
+			}
+			startup, source, _ := configDriftStartup(snapshot, name)
+			if !configDriftEqual(name, startup, runtime, snapshot.Runtime) {
+				finding := base
+				finding.Kind, finding.Message = driftdomain.KindConfigRuntime, fmt.Sprintf("运行值 %s 与 %s 中的 %s 不一致，重启后会变化", runtime, source, startup)
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	refNames := make([]string, 0, len(reference))
+	for name := range reference {
+		refNames = append(refNames, name)
+	}
+	sort.Strings(refNames)
+	for _, name := range refNames {
+		if ignored[name] || covered[name] || configDriftPerNode(name) {
+			continue
+		}
+		runtime, ok := snapshot.Runtime[name]
+		if !ok || configDriftEqual(name, reference[name], runtime, nil) {
+			continue
+		}
+		findings = append(findings, driftdomain.Finding{
+			Variable: name, Kind: driftdomain.KindClusterDivergence, Severity: "warning", Runtime: runtime, Reference: reference[name],
+			Message: fmt.Sprintf("运行值 %s 与%s的 %s 不一致", runtime, referenceNode[name], reference[name]),
+		})
+	}
+	return findings
+}
+
+// configDriftReference picks the values every node of a cluster should share:
+// the primary's when exactly one fresh node is writable, otherwise the value
+// most nodes run with. Variables without a clear majority are left out.
+func configDriftReference(snapshots []driftdomain.Snapshot) (map[string]string, map[string]string) {
+	reference, origin := make(map[string]string), make(map[string]string)
+	if len(snapshots) < 2 {
+		return reference, origin
+	}
+	primary := -1
+	for i, snapshot := range snapshots {
+		if configDriftRole(snapshot.Runtime) == driftdomain.RolePrimary {
+			if primary >= 0 {
+				primary = -1
+				break
+			}
+			primary = i
+		}
+	}
+	if primary >= 0 {
+		node := fmt.Sprintf("主库 %s:%d", snapshots[primary].MachineName, snapshots[primary].Port)
+		for name, value := range snapshots[primary].Runtime {
+			if !configDriftPerNode(name) {
+				reference[name], origin[name] = value, node
+			}
+		}
+		return reference, origin
+	}
+	counts := make(map[string]map[string]int)
+	for _, snapshot := range snapshots {
+		for name, value := range snapshot.Runtime {
+			if configDriftPerNode(name) {
+				continue
+			}
+			if counts[name] == nil {
+				counts[name] = make(map[string]int)
+			}
+			counts[name][configDriftValue(value)]++
+		}
+	}
+	for name, values := range counts {
+		best, bestCount, tie := "", 0, false
+		for value, count := range values {
+			switch {
+			case count > bestCount:
+				best, bestCount, tie = value, count, false
+			case count == bestCount:
+				tie = true
+			}
+		}
+		if !tie && bestCount*2 > len(snapshots) {
+			reference[name], origin[name] = best, "多数节点"
+		}
+	}
+	return reference, origin
+}
+
+// normalizeConfigDriftDesired validates a desired parameter set submitted by
+// a user.
+func normalizeConfigDriftDesired(parameters map[string]string, ignore []string) (map[string]string, []string, error) {
+	out := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		name = normalizeConfigDriftName(name)
+		value = strings.TrimSpace(value)
+		if !configDriftNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("参数名 %q 无效", name)
+		}
+		if configDriftPerNode(name) {
+			return nil, nil, fmt.Errorf("参数 %s 因节点而异，不能作为集群期望值", name)
+		}
+		if value == "" || strings.ContainsAny(value, "\r\n\x00") {
+			return nil, nil, fmt.Errorf("参数 %s 的值不能为空且必须为单行", name)
+		}
+		if _, exists := out[name]; exists {
+			return nil, nil, fmt.Errorf("参数 %s 重复", name)
+		}
+		out[name] = value
+	}
+	seen := make(map[string]bool, len(ignore))
+	ignored := make([]string, 0, len(ignore))
+	for _, name := range ignore {
+		name = normalizeConfigDriftName(name)
+		if !configDriftNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("忽略的参数名 %q 无效", name)
+		}
+		if _, desired := out[name]; desired {
+			return nil, nil, fmt.Errorf("参数 %s 不能同时期望和忽略", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			ignored = append(ignored, name)
+		}
+	}
+	sort.Strings(ignored)
+	return out, ignored, nil
+}
@@ -0,0 +1,527 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	driftdomain "gmha/internal/domain/configdrift"
+	machinedomain "gmha/internal/domain/machine"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	configDriftAlertRuleID = "mysql_config_drift"
+	// ConfigDriftReportInterval is how often the Agent reports my.cnf and the
+	// live variables. Instances silent for configDriftStaleAfter keep their
+	// last findings but no longer serve as cluster reference.
+	ConfigDriftReportInterval = 10 * time.Minute
+	configDriftStaleAfter     = 3 * ConfigDriftReportInterval
+	configDriftMaxVariables   = 4000
+	configDriftMaxValueBytes  = 4096
+)
+
+var ErrConfigDriftReportInvalid = errors.New("配置漂移报告无效")
+
+// ConfigDriftService compares, per MySQL instance, the cluster's desired
+// parameter set, the on-disk my.cnf and persisted variables reported by the
+// Agent and the live global variables, and compares live values across the
+// nodes of a cluster. Every finding is an alert; desired values can be
+// reconciled through the parameter task.
+type ConfigDriftService struct {
+	repo      driftdomain.Repository
+	instances MySQLInstanceRepository
+	machines  machinedomain.Repository
+	alerts    *AlertService
+
+	mu sync.Mutex
+}
+
+// ConfigDriftReconcileRequest selects what to align with the desired set.
+// Without machine_id the whole cluster is reconciled; Variables narrows the
+// parameters. Confirm must repeat the cluster name unless DryRun only asks
+// for the plan.
+type ConfigDriftReconcileRequest struct {
+	Cluster          string   `json:"cluster"`
+	MachineID        string   `json:"machine_id"`
+	Port             int      `json:"port"`
+	Variables        []string `json:"variables"`
+	Restart          bool     `json:"restart"`
+	RestartConfirmed bool     `json:"restart_confirmed"`
+	Confirm          string   `json:"confirm"`
+	DryRun           bool     `json:"dry_run"`
+}
+
+type ConfigDriftChange struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Runtime string `json:"runtime,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ConfigDriftReconcileTarget is one instance of a reconcile plan. Skipped
+// changes carry the reason they cannot go through the parameter task.
+type ConfigDriftReconcileTarget struct {
+	MachineID   string              `json:"machine_id"`
+	MachineName string              `json:"machine_name,omitempty"`
+	MachineIP   string              `json:"machine_ip,omitempty"`
+	Port        int                 `json:"port"`
+	Role        string              `json:"role,omitempty"`
+	ConfigPath  string              `json:"config_path,omitempty"`
+	Changes     []ConfigDriftChange `json:"changes"`
+	Skipped     []ConfigDriftChange `json:"skipped,omitempty"`
+}
+
+func NewConfigDriftService(repo driftdomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository) *ConfigDriftService {
+	return &ConfigDriftService{repo: repo, instances: instances, machines: machines}
+}
+
+// SetAlertService enables an alert per drift finding.
+func (s *ConfigDriftService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+// Desired returns the desired parameter set of a cluster; clusters without
+// one get an empty set and are only checked for config and node drift.
+func (s *ConfigDriftService) Desired(ctx context.Context, cluster string) (driftdomain.Desired, error) {
+	cluster = strings.TrimSpace(cluster)
+	desired, ok, err := s.repo.GetDesired(ctx, cluster)
+	if err != nil {
+		return driftdomain.Desired{}, err
+	}
+	if !ok {
+		desired = driftdomain.Desired{Cluster: cluster}
+	}
+	if desired.Parameters == nil {
+		desired.Parameters = map[string]string{}
+	}
+	return desired, nil
+}
+
+func (s *ConfigDriftService) ListDesired(ctx context.Context) ([]driftdomain.Desired, error) {
+	return s.repo.ListDesired(ctx)
+}
+
+// SaveDesired replaces the desired parameter set of a cluster and re-evaluates
+// its instances immediately.
+func (s *ConfigDriftService) SaveDesired(ctx context.Context, cluster string, parameters map[string]string, ignore []string, actor string) (driftdomain.Desired, error) {
+	cluster = strings.TrimSpace(cluster)
+	if cluster == "" {
+		return driftdomain.Desired{}, errors.New("cluster 不能为空")
+	}
+	normalized, ignored, err := normalizeConfigDriftDesired(parameters, ignore)
+	if err != nil {
+		return driftdomain.Desired{}, err
+	}
+	desired := driftdomain.Desired{Cluster: cluster, Parameters: normalized, Ignore: ignored, UpdatedBy: strings.TrimSpace(actor), UpdatedAt: time.Now().UTC()}
+	if err := s.repo.SaveDesired(ctx, desired); err != nil {
+		return driftdomain.Desired{}, err
+	}
+	s.evaluate(ctx, cluster)
+	return desired, nil
+}
+
+func (s *ConfigDriftService) DeleteDesired(ctx context.Context, cluster string) error {
+	cluster = strings.TrimSpace(cluster)
+	if err := s.repo.DeleteDesired(ctx, cluster); err != nil {
+		return err
+	}
+	s.evaluate(ctx, cluster)
+	return nil
+}
+
+// Ingest stores the Agent's report of every registered instance on the
+// machine and re-evaluates the cluster, since a change on one node can create
+// or clear divergence on the others.
+func (s *ConfigDriftService) Ingest(ctx context.Context, report driftdomain.Report) (driftdomain.ReportResponse, error) {
+	report.MachineID = strings.TrimSpace(report.MachineID)
+	if report.MachineID == "" {
+		return driftdomain.ReportResponse{}, fmt.Errorf("%w：缺少 machine_id", ErrConfigDriftReportInvalid)
+	}
+	machine, ok, err := s.machines.GetByID(ctx, report.MachineID)
+	if err != nil {
+		return driftdomain.ReportResponse{}, err
+	}
+	if !ok {
+		return driftdomain.ReportResponse{}, fmt.Errorf("%w：机器 %s 未纳管", ErrConfigDriftReportInvalid, report.MachineID)
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return driftdomain.ReportResponse{}, err
+	}
+	registered := make(map[int]mysqlapp.Instance)
+	response := driftdomain.ReportResponse{ConfigPaths: map[int]string{}}
+	for _, instance := range instances {
+		if instance.MachineID == machine.ID {
+			registered[instance.Port] = instance
+			if path := strings.TrimSpace(instance.MyCnfPath); path != "" {
+				response.ConfigPaths[instance.Port] = path
+			}
+		}
+	}
+	now := time.Now().UTC()
+	clusters := map[string]bool{machine.Cluster: true}
+	for _, item := range report.Instances {
+		if _, ok := registered[item.Port]; !ok {
+			continue
+		}
+		previous, _, err := s.repo.GetSnapshot(ctx, machine.ID, item.Port)
+		if err != nil {
+			return driftdomain.ReportResponse{}, err
+		}
+		if previous.Cluster != machine.Cluster && previous.MachineID != "" {
+			s.resolveAll(ctx, previous)
+			previous.Findings = nil
+			clusters[previous.Cluster] = true
+		}
+		snapshot := driftdomain.Snapshot{
+			Cluster: machine.Cluster, MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP, Port: item.Port,
+			ConfigPath: strings.TrimSpace(item.ConfigPath), CollectedAt: now, Findings: previous.Findings, EvaluatedAt: previous.EvaluatedAt,
+			Runtime:   sanitizeConfigDriftValues(item.Runtime, false),
+			Persisted: sanitizeConfigDriftValues(item.Persisted, false),
+		}
+		if item.ConfigError == "" {
+			snapshot.Config = sanitizeConfigDriftValues(item.Config, true)
+		} else {
+			snapshot.Errors = append(snapshot.Errors, "my.cnf: "+configDriftTruncate(item.ConfigError))
+		}
+		if item.Error != "" {
+			snapshot.Errors = append(snapshot.Errors, "variables: "+configDriftTruncate(item.Error))
+		}
+		if err := s.repo.SaveSnapshot(ctx, snapshot); err != nil {
+			return driftdomain.ReportResponse{}, err
+		}
+	}
+	for cluster := range clusters {
+		s.evaluate(ctx, cluster)
+	}
+	for port := range registered {
+		if snapshot, ok, _ := s.repo.GetSnapshot(ctx, machine.ID, port); ok {
+			response.Drifted += len(snapshot.Findings)
+		}
+	}
+	return response, nil
+}
+
+// Report returns the drift report of a cluster. Runtime values of variables
+// that differ between nodes are listed side by side.
+func (s *ConfigDriftService) Report(ctx context.Context, cluster string) (driftdomain.ClusterReport, error) {
+	cluster = strings.TrimSpace(cluster)
+	desired, err := s.Desired(ctx, cluster)
+	if err != nil {
+		return driftdomain.ClusterReport{}, err
+	}
+	snapshots, err := s.clusterSnapshots(ctx, cluster)
+	if err != nil {
+		return driftdomain.ClusterReport{}, err
+	}
+	report := driftdomain.ClusterReport{Cluster: cluster, Desired: desired, Status: driftdomain.StatusInSync, Instances: []driftdomain.InstanceView{}, Divergences: []driftdomain.Divergence{}}
+	divergent := make(map[string]bool)
+	unknown := false
+	now := time.Now().UTC()
+	for _, snapshot := range snapshots {
+		view := driftdomain.InstanceView{
+			MachineID: snapshot.MachineID, MachineName: snapshot.MachineName, MachineIP: snapshot.MachineIP, Port: snapshot.Port,
+			Role: configDriftRole(snapshot.Runtime), ConfigPath: snapshot.ConfigPath, Errors: snapshot.Errors,
+			CollectedAt: snapshot.CollectedAt, Findings: snapshot.Findings, Stale: now.Sub(snapshot.CollectedAt) > configDriftStaleAfter,
+		}
+		if view.Findings == nil {
+			view.Findings = []driftdomain.Finding{}
+		}
+		switch {
+		case len(view.Findings) > 0:
+			view.Status = driftdomain.StatusDrifted
+			report.Drifted++
+		case len(snapshot.Runtime) == 0 || view.Stale:
+			view.Status = driftdomain.StatusUnknown
+			unknown = true
+		default:
+			view.Status = driftdomain.StatusInSync
+		}
+		for _, finding := range view.Findings {
+			if finding.Kind == driftdomain.KindClusterDivergence {
+				divergent[finding.Variable] = true
+			}
+		}
+		report.Instances = append(report.Instances, view)
+	}
+	switch {
+	case report.Drifted > 0:
+		report.Status = driftdomain.StatusDrifted
+	case unknown || len(snapshots) == 0:
+		report.Status = driftdomain.StatusUnknown
+	}
+	names := make([]string, 0, len(divergent))
+	for name := range divergent {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		item := driftdomain.Divergence{Variable: name}
+		for _, snapshot := range snapshots {
+			if value, ok := snapshot.Runtime[name]; ok {
+				item.Values = append(item.Values, driftdomain.DivergenceValue{
+					MachineID: snapshot.MachineID, MachineName: snapshot.MachineName, Port: snapshot.Port, Role: configDriftRole(snapshot.Runtime), Value: value,
+				})
+			}
+		}
+		report.Divergences = append(report.Divergences, item)
+	}
+	return report, nil
+}
+
+// Instance returns the latest snapshot of one instance with all three
+// sources.
+func (s *ConfigDriftService) Instance(ctx context.Context, machineID string, port int) (driftdomain.Snapshot, error) {
+	snapshot, ok, err := s.repo.GetSnapshot(ctx, strings.TrimSpace(machineID), port)
+	if err != nil {
+		return driftdomain.Snapshot{}, err
+	}
+	if !ok {
+		return driftdomain.Snapshot{}, fmt.Errorf("实例 %s:%d 还没有配置报告", machineID, port)
+	}
+	return snapshot, nil
+}
+
+// ReconcilePlan lists, per instance, the desired values that differ from the
+// runtime or the startup configuration. Replicas come first and the primary
+// last so a rollout never starts on the writable node. Values persisted in
+// mysqld-auto.cnf would override my.cnf at the next start and are skipped.
+func (s *ConfigDriftService) ReconcilePlan(ctx context.Context, req ConfigDriftReconcileRequest) ([]ConfigDriftReconcileTarget, error) {
+	req.Cluster = strings.TrimSpace(req.Cluster)
+	if req.Cluster == "" {
+		return nil, errors.New("cluster 不能为空")
+	}
+	if !req.DryRun && strings.TrimSpace(req.Confirm) != req.Cluster {
+		return nil, fmt.Errorf("confirm 必须填写集群名 %s", req.Cluster)
+	}
+	desired, err := s.Desired(ctx, req.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(desired.Parameters) == 0 {
+		return nil, fmt.Errorf("集群 %s 没有期望参数，无法对齐", req.Cluster)
+	}
+	selected := make(map[string]bool, len(req.Variables))
+	for _, name := range req.Variables {
+		name = normalizeConfigDriftName(name)
+		if _, ok := desired.Parameters[name]; !ok {
+			return nil, fmt.Errorf("参数 %s 不在集群期望参数中", name)
+		}
+		selected[name] = true
+	}
+	snapshots, err := s.clusterSnapshots(ctx, req.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	targets := make([]ConfigDriftReconcileTarget, 0)
+	for _, snapshot := range snapshots {
+		if req.MachineID != "" && (snapshot.MachineID != strings.TrimSpace(req.MachineID) || (req.Port > 0 && snapshot.Port != req.Port)) {
+			continue
+		}
+		if now.Sub(snapshot.CollectedAt) > configDriftStaleAfter {
+			return nil, fmt.Errorf("实例 %s:%d 的配置报告已超过 %s 未更新，请确认 Agent 在线后重试", snapshot.MachineName, snapshot.Port, configDriftStaleAfter)
+		}
+		target := ConfigDriftReconcileTarget{
+			MachineID: snapshot.MachineID, MachineName: snapshot.MachineName, MachineIP: snapshot.MachineIP, Port: snapshot.Port,
+			Role: configDriftRole(snapshot.Runtime), ConfigPath: snapshot.ConfigPath, Changes: []ConfigDriftChange{},
+		}
+		seen := make(map[string]bool)
+		for _, finding := range snapshot.Findings {
+			if finding.Kind != driftdomain.KindDesiredRuntime && finding.Kind != driftdomain.KindDesiredConfig {
+				continue
+			}
+			if seen[finding.Variable] || (len(selected) > 0 && !selected[finding.Variable]) {
+				continue
+			}
+			seen[finding.Variable] = true
+			change := ConfigDriftChange{Name: finding.Variable, Value: desired.Parameters[finding.Variable], Runtime: finding.Runtime}
+			_, hasRuntime := configDriftLookup(snapshot.Runtime, finding.Variable)
+			persisted, hasPersisted := configDriftLookup(snapshot.Persisted, finding.Variable)
+			switch {
+			case !hasRuntime:
+				change.Reason = "实例没有该变量，请确认参数名与 MySQL 版本"
+			case hasPersisted && !configDriftEqual(finding.Variable, change.Value, persisted, nil):
+				change.Reason = fmt.Sprintf("mysqld-auto.cnf 持久化了 %s，请先执行 RESET PERSIST %s", persisted, finding.Variable)
+			}
+			if change.Reason != "" {
+				target.Skipped = append(target.Skipped, change)
+				continue
+			}
+			target.Changes = append(target.Changes, change)
+		}
+		if len(target.Changes) > 0 || len(target.Skipped) > 0 {
+			targets = append(targets, target)
+		}
+	}
+	if req.MachineID != "" && len(targets) == 0 {
+		found := false
+		for _, snapshot := range snapshots {
+			found = found || (snapshot.MachineID == strings.TrimSpace(req.MachineID) && (req.Port <= 0 || snapshot.Port == req.Port))
+		}
+		if !found {
+			return nil, fmt.Errorf("集群 %s 中没有实例 %s:%d 的配置报告", req.Cluster, req.MachineID, req.Port)
+		}
+	}
+	rank := map[string]int{driftdomain.RoleReplica: 0, "": 1, driftdomain.RolePrimary: 2}
+	sort.SliceStable(targets, func(i, j int) bool {
+		if rank[targets[i].Role] != rank[targets[j].Role] {
+			return rank[targets[i].Role] < rank[targets[j].Role]
+		}
+		if targets[i].MachineName != targets[j].MachineName {
+			return targets[i].MachineName < targets[j].MachineName
+		}
+		return targets[i].Port < targets[j].Port
+	})
+	return targets, nil
+}
+
+func (s *ConfigDriftService) clusterSnapshots(ctx context.Context, cluster string) ([]driftdomain.Snapshot, error) {
+	snapshots, err := s.repo.ListSnapshots(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	out := snapshots[:0]
+	for _, snapshot := range snapshots {
+		if snapshot.Cluster == cluster {
+			out = append(out, snapshot)
+		}
+	}
+	return out, nil
+}
+
+// evaluate recomputes the findings of every instance of a cluster. Snapshots
+// of instances that are no longer registered are dropped with their alerts;
+// stale instances keep their last findings.
+func (s *ConfigDriftService) evaluate(ctx context.Context, cluster string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	desired, err := s.Desired(ctx, cluster)
+	if err != nil {
+		log.Printf("config drift: desired %s: %v", cluster, err)
+		return
+	}
+	snapshots, err := s.clusterSnapshots(ctx, cluster)
+	if err != nil {
+		log.Printf("config drift: list %s: %v", cluster, err)
+		return
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		log.Printf("config drift: list instances: %v", err)
+		return
+	}
+	registered := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		registered[instance.MachineID+":"+strconv.Itoa(instance.Port)] = true
+	}
+	now := time.Now().UTC()
+	live := make([]driftdomain.Snapshot, 0, len(snapshots))
+	fresh := make([]driftdomain.Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if !registered[snapshot.MachineID+":"+strconv.Itoa(snapshot.Port)] {
+			s.resolveAll(ctx, snapshot)
+			_ = s.repo.DeleteSnapshot(ctx, snapshot.MachineID, snapshot.Port)
+			continue
+		}
+		live = append(live, snapshot)
+		if now.Sub(snapshot.CollectedAt) <= configDriftStaleAfter && len(snapshot.Runtime) > 0 {
+			fresh = append(fresh, snapshot)
+		}
+	}
+	reference, origin := map[string]string{}, map[string]string{}
+	if cluster != "" {
+		reference, origin = configDriftReference(fresh)
+	}
+	for _, snapshot := range live {
+		if now.Sub(snapshot.CollectedAt) > configDriftStaleAfter || len(snapshot.Runtime) == 0 {
+			continue
+		}
+		previous := snapshot.Findings
+		snapshot.Findings = evaluateConfigDrift(desired, snapshot, reference, origin)
+		snapshot.EvaluatedAt = now
+		if err := s.repo.SaveSnapshot(ctx, snapshot); err != nil {
+			log.Printf("config drift: save %s:%d: %v", snapshot.MachineID, snapshot.Port, err)
+			continue
+		}
+		s.signal(ctx, snapshot, previous)
+	}
+}
+
+// signal raises one alert per finding so drift on a new variable notifies on
+// its own, and resolves the findings that disappeared.
+func (s *ConfigDriftService) signal(ctx context.Context, snapshot driftdomain.Snapshot, previous []driftdomain.Finding) {
+	if s.alerts == nil {
+		return
+	}
+	current := make(map[string]bool, len(snapshot.Findings))
+	for _, finding := range snapshot.Findings {
+		current[finding.Kind+":"+finding.Variable] = true
+		signal := configDriftSignal(snapshot, finding)
+		signal.Severity = alertdomain.Severity(finding.Severity)
+		signal.Value = 1
+		signal.Message = fmt.Sprintf("实例 %s:%d 参数 %s 漂移：%s", snapshot.MachineName, snapshot.Port, finding.Variable, finding.Message)
+		_ = s.alerts.RaiseSignal(ctx, signal)
+	}
+	for _, finding := range previous {
+		if !current[finding.Kind+":"+finding.Variable] {
+			_ = s.alerts.ResolveSignal(ctx, configDriftSignal(snapshot, finding))
+		}
+	}
+}
+
+func (s *ConfigDriftService) resolveAll(ctx context.Context, snapshot driftdomain.Snapshot) {
+	if s.alerts == nil {
+		return
+	}
+	for _, finding := range snapshot.Findings {
+		_ = s.alerts.ResolveSignal(ctx, configDriftSignal(snapshot, finding))
+	}
+}
+
+func configDriftSignal(snapshot driftdomain.Snapshot, finding driftdomain.Finding) AlertSignal {
+	return AlertSignal{
+		RuleID: configDriftAlertRuleID, RuleName: "MySQL 配置漂移", Metric: "mysql_config_drift", Category: "config",
+		MachineID: snapshot.MachineID, MachineName: snapshot.MachineName, MachineIP: snapshot.MachineIP, ClusterID: snapshot.Cluster,
+		Labels: map[string]string{
+			"cluster": snapshot.Cluster, "mysql_port": strconv.Itoa(snapshot.Port), "variable": finding.Variable, "drift_kind": finding.Kind,
+		},
+		Threshold: 0, Operator: ">",
+	}
+}
+
+// sanitizeConfigDriftValues lower-cases variable names, turns my.cnf option
+// spellings into variable names and bounds what one report can store.
+func sanitizeConfigDriftValues(values map[string]string, config bool) map[string]string {
+	if values == nil {
+		return nil
+	}
+	out := make(map[string]string, len(values))
+	for name, value := range values {
+		if config {
+			name = normalizeConfigDriftName(name)
+		} else {
+			name = strings.ToLower(strings.TrimSpace(name))
+		}
+		if !configDriftNamePattern.MatchString(name) || len(out) >= configDriftMaxVariables {
+			continue
+		}
+		out[name] = configDriftTruncate(value)
+	}
+	return out
+}
+
+func configDriftTruncate(value string) string {
+	if len(value) > configDriftMaxValueBytes {
+		return value[:configDriftMaxValueBytes]
+	}
+	return value
+}
@@ -0,0 +1,205 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	driftdomain "gmha/internal/domain/configdrift"
+	machinedomain "gmha/internal/domain/machine"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type configDriftMemoryRepo struct {
+	desired   map[string]driftdomain.Desired
+	snapshots map[string]driftdomain.Snapshot
+}
+
+func (r *configDriftMemoryRepo) GetDesired(_ context.Context, cluster string) (driftdomain.Desired, bool, error) {
+	desired, ok := r.desired[cluster]
+	return desired, ok, nil
+}
+
+func (r *configDriftMemoryRepo) SaveDesired(_ context.Context, desired driftdomain.Desired) error {
+	r.desired[desired.Cluster] = desired
+	return nil
+}
+
+func (r *configDriftMemoryRepo) DeleteDesired(_ context.Context, cluster string) error {
+	delete(r.desired, cluster)
+	return nil
+}
+
+func (r *configDriftMemoryRepo) ListDesired(context.Context) ([]driftdomain.Desired, error) {
+	out := make([]driftdomain.Desired, 0, len(r.desired))
+	for _, desired := range r.desired {
+		out = append(out, desired)
+	}
+	return out, nil
+}
+
+func (r *configDriftMemoryRepo) GetSnapshot(_ context.Context, machineID string, port int) (driftdomain.Snapshot, bool, error) {
+	snapshot, ok := r.snapshots[configDriftTestKey(machineID, port)]
+	return snapshot, ok, nil
+}
+
+func (r *configDriftMemoryRepo) SaveSnapshot(_ context.Context, snapshot driftdomain.Snapshot) error {
+	r.snapshots[configDriftTestKey(snapshot.MachineID, snapshot.Port)] = snapshot
+	return nil
+}
+
+func (r *configDriftMemoryRepo) ListSnapshots(_ context.Context, cluster string) ([]driftdomain.Snapshot, error) {
+	out := make([]driftdomain.Snapshot, 0)
+	for _, snapshot := range r.snapshots {
+		if cluster == "" || snapshot.Cluster == cluster {
+			out = append(out, snapshot)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MachineID < out[j].MachineID })
+	return out, nil
+}
+
+func (r *configDriftMemoryRepo) DeleteSnapshot(_ context.Context, machineID string, port int) error {
+	delete(r.snapshots, configDriftTestKey(machineID, port))
+	return nil
+}
+
+func configDriftTestKey(machineID string, port int) string {
+	return machineID + ":" + strconv.Itoa(port)
+}
+
+func configDriftFiring(alertRepo *alertMemoryRepo) []string {
+	out := make([]string, 0)
+	for _, event := range alertRepo.events {
+		if event.Status == "firing" {
+			out = append(out, event.MachineID+"/"+event.Labels["variable"]+"/"+event.Labels["drift_kind"])
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestConfigDriftEqualFollowsMySQLValueRules(t *testing.T) {
+	runtime := map[string]string{"innodb_buffer_pool_chunk_size": "134217728", "innodb_buffer_pool_instances": "8"}
+	for _, item := range []struct {
+		name, expected, actual string
+		runtime                map[string]string
+		want                   bool
+	}{
+		{"innodb_buffer_pool_size", "8G", "8589934592", nil, true},
+		{"innodb_buffer_pool_size", "7800M", "8589934592", runtime, true},
+		{"innodb_buffer_pool_size", "7800M", "8589934592", nil, false},
+		{"slow_query_log", "1", "ON", nil, true},
+		{"sync_binlog", "1", "1000", nil, false},
+		{"sql_mode", "NO_ENGINE_SUBSTITUTION,STRICT_TRANS_TABLES", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", nil, true},
+		{"sql_mode", "STRICT_TRANS_TABLES", "STRICT_TRANS_TABLES,ONLY_FULL_GROUP_BY", nil, false},
+		{"optimizer_switch", "index_merge=off", "index_merge=off,mrr=on", nil, true},
+		{"long_query_time", "1", "1.000000", nil, true},
+		{"character_set_server", "utf8mb4", "'UTF8MB4'", nil, true},
+	} {
+		if got := configDriftEqual(item.name, item.expected, item.actual, item.runtime); got != item.want {
+			t.Fatalf("configDriftEqual(%s, %q, %q) = %v", item.name, item.expected, item.actual, got)
+		}
+	}
+	if value, ok := configDriftConfigValue(map[string]string{"skip_log_bin": "ON"}, "log_bin"); !ok || value != "OFF" {
+		t.Fatalf("skip-log-bin = %q %v", value, ok)
+	}
+	if _, _, err := normalizeConfigDriftDesired(map[string]string{"server-id": "1"}, nil); err == nil {
+		t.Fatal("per-node variables must be rejected")
+	}
+}
+
+func TestConfigDriftServiceDetectsDriftAlertsAndPlansReconcile(t *testing.T) {
+	ctx := context.Background()
+	repo := &configDriftMemoryRepo{desired: map[string]driftdomain.Desired{}, snapshots: map[string]driftdomain.Snapshot{}}
+	alertRepo := newAlertMemoryRepo()
+	instances := []mysqlapp.Instance{
+		{MachineID: "m1", Port: 3306, MyCnfPath: "/etc/my3306.cnf"},
+		{MachineID: "m2", Port: 3306, MyCnfPath: "/etc/my3306.cnf"},
+		{MachineID: "m3", Port: 3306, MyCnfPath: "/etc/my3306.cnf"},
+	}
+	service := NewConfigDriftService(repo, fakeArchitectureInstanceRepo{items: instances}, &schemaMachineRepo{items: map[string]machinedomain.Machine{
+		"m1": {ID: "m1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+		"m2": {ID: "m2", Name: "db-2", IP: "10.0.0.2", Cluster: "orders"},
+		"m3": {ID: "m3", Name: "db-3", IP: "10.0.0.3", Cluster: "orders"},
+	}})
+	service.SetAlertService(NewAlertService(alertRepo))
+	if _, err := service.SaveDesired(ctx, "orders", map[string]string{"Max-Connections": "2000"}, []string{"innodb_buffer_pool_size"}, "dba"); err != nil {
+		t.Fatal(err)
+	}
+
+	report := func(machineID string, item driftdomain.InstanceReport) driftdomain.ReportResponse {
+		t.Helper()
+		item.Port = 3306
+		response, err := service.Ingest(ctx, driftdomain.Report{MachineID: machineID, Instances: []driftdomain.InstanceReport{item, {Port: 3307, Runtime: map[string]string{"max_connections": "1"}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	response := report("m1", driftdomain.InstanceReport{
+		Config:  map[string]string{"max-connections": "2000", "innodb_buffer_pool_size": "8G"},
+		Runtime: map[string]string{"read_only": "OFF", "max_connections": "2000", "sync_binlog": "1", "innodb_buffer_pool_size": "8589934592", "server_id": "1"},
+	})
+	if response.ConfigPaths[3306] != "/etc/my3306.cnf" || len(response.ConfigPaths) != 1 || response.Drifted != 0 {
+		t.Fatalf("response = %+v", response)
+	}
+	if _, ok := repo.snapshots[configDriftTestKey("m1", 3307)]; ok {
+		t.Fatal("unregistered instances must not be stored")
+	}
+	report("m2", driftdomain.InstanceReport{
+		Config:  map[string]string{"max_connections": "2000"},
+		Runtime: map[string]string{"read_only": "ON", "max_connections": "1000", "sync_binlog": "1", "innodb_buffer_pool_size": "4294967296", "server_id": "2"},
+	})
+	report("m3", driftdomain.InstanceReport{
+		Config:    map[string]string{"max_connections": "2000", "innodb_flush_log_at_trx_commit": "1"},
+		Runtime:   map[string]string{"read_only": "ON", "max_connections": "2000", "sync_binlog": "0", "innodb_flush_log_at_trx_commit": "2", "server_id": "3"},
+		Persisted: map[string]string{"max_connections": "500"},
+	})
+
+	want := "m2/max_connections/desired_runtime,m3/innodb_flush_log_at_trx_commit/config_runtime,m3/max_connections/desired_config,m3/sync_binlog/cluster_divergence"
+	if got := strings.Join(configDriftFiring(alertRepo), ","); got != want {
+		t.Fatalf("firing = %s", got)
+	}
+	cluster, err := service.Report(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Status != driftdomain.StatusDrifted || cluster.Drifted != 2 || len(cluster.Instances) != 3 || cluster.Instances[0].Role != driftdomain.RolePrimary {
+		t.Fatalf("cluster = %+v", cluster)
+	}
+	if len(cluster.Divergences) != 1 || cluster.Divergences[0].Variable != "sync_binlog" || len(cluster.Divergences[0].Values) != 3 {
+		t.Fatalf("divergences = %+v", cluster.Divergences)
+	}
+
+	if _, err := service.ReconcilePlan(ctx, ConfigDriftReconcileRequest{Cluster: "orders"}); err == nil {
+		t.Fatal("reconcile without confirmation must fail")
+	}
+	plan, err := service.ReconcilePlan(ctx, ConfigDriftReconcileRequest{Cluster: "orders", Confirm: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 || plan[0].MachineID != "m2" || len(plan[0].Changes) != 1 || plan[0].Changes[0].Value != "2000" {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if plan[1].MachineID != "m3" || len(plan[1].Changes) != 0 || len(plan[1].Skipped) != 1 || !strings.Contains(plan[1].Skipped[0].Reason, "RESET PERSIST") {
+		t.Fatalf("plan[1] = %+v", plan[1])
+	}
+
+	// Fixing the replica resolves its alert; removing an instance drops its
+	// snapshot and resolves everything it raised.
+	report("m2", driftdomain.InstanceReport{
+		Config:  map[string]string{"max_connections": "2000"},
+		Runtime: map[string]string{"read_only": "ON", "max_connections": "2000", "sync_binlog": "1", "server_id": "2"},
+	})
+	service.instances = fakeArchitectureInstanceRepo{items: instances[:2]}
+	report("m1", driftdomain.InstanceReport{Runtime: map[string]string{"read_only": "OFF", "max_connections": "2000", "sync_binlog": "1"}})
+	if got := configDriftFiring(alertRepo); len(got) != 0 {
+		t.Fatalf("firing after fix = %v", got)
+	}
+	if _, ok := repo.snapshots[configDriftTestKey("m3", 3306)]; ok {
+		t.Fatal("snapshot of removed instance must be pruned")
+	}
+}
@@ -0,0 +1,1082 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/big"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	backupdomain "gmha/internal/domain/backup"
+	rotationdomain "gmha/internal/domain/credrotation"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	credentialRotationConfirm        = "rotate"
+	credentialRotationPasswordLength = 24
+	credentialRotationMaxIntervalDay = 365
+	credentialRotationStepTimeout    = 5 * time.Minute
+	// credentialRotationVerifyAttempts bounds how long verification waits
+	// for ALTER USER to replicate to a lagging replica (two seconds apart).
+	credentialRotationVerifyAttempts = 30
+)
+
+var (
+	ErrCredentialRotationNotFound       = errors.New("密码轮换记录不存在")
+	ErrCredentialRotationActive         = errors.New("存在未完成的密码轮换，请先重试或回滚")
+	ErrCredentialRotationSinglePassword = errors.New("部分实例不支持双密码，轮换期间旧密码会立即失效")
+)
+
+var credentialRotationRoles = []string{mysqlapp.AccountRoleMHA, mysqlapp.AccountRoleMonitor, mysqlapp.AccountRoleBackup}
+
+type credentialRotationTasks interface {
+	CreateBatchTrackingTask(context.Context, string, string, string) (TaskDetail, error)
+	FinalizeBatchTrackingTask(context.Context, string, int, int) error
+	RunExecTask(context.Context, string, string, ExecTaskOptions, time.Duration) (string, string, error)
+	GetTaskDetail(context.Context, string) (TaskDetail, error)
+}
+
+type credentialRotationProxySQL interface {
+	MonitorTargets(context.Context) ([]ProxySQLMonitorTarget, error)
+	UpdateMonitorCredential(context.Context, ProxySQLMonitorTarget, string, string, string) (string, error)
+}
+
+// CredentialRotationService rotates the passwords of the preset MySQL
+// accounts (mha, monitor, backup) on every managed instance. New passwords
+// are set with RETAIN CURRENT PASSWORD where every server supports it, then
+// replication channels, Agent credentials, ProxySQL monitor settings, backup
+// policies and the stored presets follow; the old password is discarded only
+// after every consumer has been verified with the new one.
+type CredentialRotationService struct {
+	repo      rotationdomain.Repository
+	tasks     credentialRotationTasks
+	instances MySQLInstanceRepository
+	machines  machinedomain.Repository
+	presets   MySQLAccountPresetRepository
+	backups   backupdomain.Repository
+	proxysql  credentialRotationProxySQL
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+type CredentialRotationRequest struct {
+	Roles               []string `json:"roles"`
+	AllowSinglePassword bool     `json:"allow_single_password"`
+	Confirm             string   `json:"confirm"`
+	Actor               string   `json:"actor"`
+}
+
+type CredentialRotationScheduleRequest struct {
+	Enabled      bool      `json:"enabled"`
+	Roles        []string  `json:"roles"`
+	IntervalDays int       `json:"interval_days"`
+	NextRunAt    time.Time `json:"next_run_at"`
+	Actor        string    `json:"actor"`
+}
+
+// credentialRotationFacts is what discovery reads from one instance.
+type credentialRotationFacts struct {
+	Version  string
+	ReadOnly bool
+	Channels map[string]string
+	Accounts map[string][]string
+}
+
+func NewCredentialRotationService(repo rotationdomain.Repository, tasks credentialRotationTasks, instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository, backups backupdomain.Repository) *CredentialRotationService {
+	return &CredentialRotationService{repo: repo, tasks: tasks, instances: instances, machines: machines, presets: presets, backups: backups}
+}
+
+// SetProxySQLService makes monitor rotations update the ProxySQL nodes.
+func (s *CredentialRotationService) SetProxySQLService(proxysql credentialRotationProxySQL) {
+	s.proxysql = proxysql
+}
+
+// Start runs the rotation schedule in the background.
+func (s *CredentialRotationService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.scheduleLoop(ctx)
+}
+
+func (s *CredentialRotationService) Close() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+}
+
+// Plan previews a rotation from the Manager's records: the instances that
+// will be discovered, whether dual passwords can be used and which consumers
+// will change. Roles and hosts are confirmed on the servers when it runs.
+func (s *CredentialRotationService) Plan(ctx context.Context, roles []string) (rotationdomain.Rotation, error) {
+	roles, err := normalizeCredentialRotationRoles(roles)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	presets, err := s.presetsByRole(ctx)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	now := time.Now().UTC()
+	rotation := rotationdomain.Rotation{
+		Roles: roles, Accounts: []rotationdomain.Account{}, DualPassword: true, Trigger: rotationdomain.TriggerManual,
+		Status: rotationdomain.StatusPlanned, Steps: []rotationdomain.Step{}, CreatedAt: now, UpdatedAt: now,
+	}
+	usernames := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		preset := presets[role]
+		if !preset.Enabled || strings.TrimSpace(preset.Username) == "" {
+			return rotationdomain.Rotation{}, fmt.Errorf("预设账号 %s 未启用，不能轮换", role)
+		}
+		if usernames[preset.Username] {
+			return rotationdomain.Rotation{}, fmt.Errorf("预设账号 %s 与其他角色使用同一用户名 %s，请分别轮换", role, preset.Username)
+		}
+		usernames[preset.Username] = true
+		rotation.Accounts = append(rotation.Accounts, rotationdomain.Account{Role: role, Username: preset.Username})
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].MachineID != instances[j].MachineID {
+			return instances[i].MachineID < instances[j].MachineID
+		}
+		return instances[i].Port < instances[j].Port
+	})
+	for _, instance := range instances {
+		machine, ok, err := s.machines.GetByID(ctx, instance.MachineID)
+		if err != nil {
+			return rotationdomain.Rotation{}, err
+		}
+		if !ok {
+			return rotationdomain.Rotation{}, fmt.Errorf("实例 %s:%d 所在机器不存在", instance.MachineID, instance.Port)
+		}
+		if instance.Status == mysqlapp.StatusStopped {
+			rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("实例 %s:%d 已停止，轮换前需要启动或移除", machine.Name, instance.Port))
+		}
+		if !mysqlapp.SupportsDualPasswordForVersion(instance.Version) {
+			rotation.DualPassword = false
+			rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("实例 %s:%d 版本 %s 不支持双密码，旧密码会在修改后立即失效", machine.Name, instance.Port, instance.Version))
+		}
+		rotation.Steps = append(rotation.Steps, rotationdomain.Step{
+			Phase: rotationdomain.PhaseDiscover, Cluster: machine.Cluster, MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP,
+			Port: instance.Port, Status: rotationdomain.StepPending,
+		})
+	}
+	if len(rotation.Steps) == 0 {
+		return rotationdomain.Rotation{}, errors.New("没有已登记的 MySQL 实例")
+	}
+	if s.backups != nil {
+		policies, err := s.backups.ListPolicies(ctx, "")
+		if err != nil {
+			return rotationdomain.Rotation{}, err
+		}
+		count := 0
+		for _, policy := range policies {
+			if usernames[strings.TrimSpace(policy.MySQLUser)] {
+				count++
+			}
+		}
+		if count > 0 {
+			rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("将同时更新 %d 个备份策略保存的密码", count))
+		}
+	}
+	if s.proxysql != nil && slices.Contains(roles, mysqlapp.AccountRoleMonitor) {
+		targets, err := s.proxysql.MonitorTargets(ctx)
+		if err != nil {
+			return rotationdomain.Rotation{}, err
+		}
+		if len(targets) > 0 {
+			rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("将同时更新 %d 个 ProxySQL 节点的监控账号密码", len(targets)))
+		}
+	}
+	return rotation, nil
+}
+
+// Rotate starts a manual rotation in the background.
+func (s *CredentialRotationService) Rotate(ctx context.Context, req CredentialRotationRequest) (rotationdomain.Rotation, error) {
+	if strings.TrimSpace(req.Confirm) != credentialRotationConfirm {
+		return rotationdomain.Rotation{}, fmt.Errorf("confirm 必须为 %s", credentialRotationConfirm)
+	}
+	return s.start(ctx, req.Roles, req.AllowSinglePassword, rotationdomain.TriggerManual, strings.TrimSpace(req.Actor))
+}
+
+func (s *CredentialRotationService) start(ctx context.Context, roles []string, allowSingle bool, trigger, actor string) (rotationdomain.Rotation, error) {
+	rotation, err := s.Plan(ctx, roles)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	for _, step := range rotation.Steps {
+		if instance, ok, err := s.instances.Get(ctx, step.MachineID, step.Port); err == nil && ok && instance.Status == mysqlapp.StatusStopped {
+			return rotation, fmt.Errorf("实例 %s:%d 已停止，请先启动或移除该实例", step.MachineName, step.Port)
+		}
+	}
+	if !rotation.DualPassword && !allowSingle {
+		return rotation, ErrCredentialRotationSinglePassword
+	}
+	presets, err := s.presetsByRole(ctx)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	rotation.Secrets = make(map[string]rotationdomain.Secret, len(rotation.Accounts))
+	for _, account := range rotation.Accounts {
+		password, err := generateCredentialRotationPassword()
+		if err != nil {
+			return rotationdomain.Rotation{}, err
+		}
+		rotation.Secrets[account.Role] = rotationdomain.Secret{Username: account.Username, Password: password, Previous: presets[account.Role].Password}
+	}
+	rotation.Trigger, rotation.CreatedBy = trigger, actor
+	return s.launch(ctx, rotation)
+}
+
+// Retry resumes a failed rotation from its first unfinished step with the
+// passwords generated when it started.
+func (s *CredentialRotationService) Retry(ctx context.Context, id, actor string) (rotationdomain.Rotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotation, err := s.openRotation(ctx, id)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	if running, err := s.repo.ListRotations(ctx, rotationdomain.StatusRunning, 1); err != nil {
+		return rotationdomain.Rotation{}, err
+	} else if len(running) > 0 {
+		return running[0], fmt.Errorf("%w：%s", ErrCredentialRotationActive, running[0].ID)
+	}
+	for index := range rotation.Steps {
+		if rotation.Steps[index].Status == rotationdomain.StepFailed || rotation.Steps[index].Status == rotationdomain.StepSkipped {
+			rotation.Steps[index].Status = rotationdomain.StepPending
+		}
+	}
+	rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("%s 由 %s 重试", time.Now().UTC().Format(time.RFC3339), credentialRotationActor(actor)))
+	return s.dispatch(ctx, rotation)
+}
+
+// Rollback restores the passwords that were in use before a failed
+// rotation. It runs the same workflow with the previous passwords, so the
+// failed new passwords are discarded at the end.
+func (s *CredentialRotationService) Rollback(ctx context.Context, id, actor string) (rotationdomain.Rotation, error) {
+	original, err := s.openRotation(ctx, id)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	if original.Rollback {
+		return rotationdomain.Rotation{}, errors.New("回滚轮换失败后只能重试，不能再次回滚")
+	}
+	roles := append([]string(nil), original.Roles...)
+	rotation, err := s.Plan(ctx, roles)
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	rotation.DualPassword = rotation.DualPassword && original.DualPassword
+	rotation.Rollback, rotation.RollbackOf = true, original.ID
+	rotation.Trigger, rotation.CreatedBy = rotationdomain.TriggerManual, strings.TrimSpace(actor)
+	rotation.Secrets = make(map[string]rotationdomain.Secret, len(original.Secrets))
+	for role, secret := range original.Secrets {
+		rotation.Secrets[role] = rotationdomain.Secret{Username: secret.Username, Password: secret.Previous, Previous: secret.Password}
+	}
+	for index, account := range rotation.Accounts {
+		if secret, ok := rotation.Secrets[account.Role]; ok {
+			rotation.Accounts[index].Username = secret.Username
+		}
+	}
+	return s.launch(ctx, rotation)
+}
+
+func (s *CredentialRotationService) openRotation(ctx context.Context, id string) (rotationdomain.Rotation, error) {
+	rotation, ok, err := s.repo.GetRotation(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	if !ok {
+		return rotationdomain.Rotation{}, ErrCredentialRotationNotFound
+	}
+	if rotation.Status != rotationdomain.StatusFailed || len(rotation.Secrets) == 0 {
+		return rotationdomain.Rotation{}, fmt.Errorf("密码轮换 %s 状态为 %s，只有失败的轮换可以重试或回滚", rotation.ID, rotation.Status)
+	}
+	return rotation, nil
+}
+
+func (s *CredentialRotationService) launch(ctx context.Context, rotation rotationdomain.Rotation) (rotationdomain.Rotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, status := range []string{rotationdomain.StatusRunning, rotationdomain.StatusFailed} {
+		items, err := s.repo.ListRotations(ctx, status, 500)
+		if err != nil {
+			return rotationdomain.Rotation{}, err
+		}
+		for _, item := range items {
+			if rotation.Rollback && item.ID == rotation.RollbackOf {
+				continue
+			}
+			return item, fmt.Errorf("%w：%s", ErrCredentialRotationActive, item.ID)
+		}
+	}
+	now := time.Now().UTC()
+	rotation.ID = fmt.Sprintf("cred-rotation-%d", now.UnixNano())
+	rotation.CreatedAt = now
+	return s.dispatch(ctx, rotation)
+}
+
+// dispatch opens a task center entry for the run and executes it in the
+// background. Callers hold s.mu.
+func (s *CredentialRotationService) dispatch(ctx context.Context, rotation rotationdomain.Rotation) (rotationdomain.Rotation, error) {
+	display := "MySQL 账号密码轮换 " + strings.Join(rotation.Roles, ",")
+	if rotation.Rollback {
+		display = "MySQL 账号密码回滚 " + strings.Join(rotation.Roles, ",")
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "mysql_credential_rotation", display, strings.Join(rotation.Roles, ","))
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	rotation.ParentTaskID = parent.Task.ID
+	rotation.Status, rotation.Error, rotation.FinishedAt = rotationdomain.StatusRunning, "", nil
+	rotation.UpdatedAt = time.Now().UTC()
+	if err := s.repo.SaveRotation(ctx, rotation); err != nil {
+		_ = s.tasks.FinalizeBatchTrackingTask(ctx, parent.Task.ID, 0, 1)
+		return rotationdomain.Rotation{}, err
+	}
+	go s.run(context.Background(), rotation)
+	return credentialRotationView(rotation), nil
+}
+
+func (s *CredentialRotationService) run(ctx context.Context, rotation rotationdomain.Rotation) {
+	err := s.runPhases(ctx, &rotation)
+	now := time.Now().UTC()
+	rotation.FinishedAt, rotation.UpdatedAt = &now, now
+	created, failed := 0, 0
+	for index := range rotation.Steps {
+		step := &rotation.Steps[index]
+		if step.TaskID != "" {
+			created++
+		}
+		switch step.Status {
+		case rotationdomain.StepFailed:
+			failed++
+		case rotationdomain.StepPending:
+			if err != nil {
+				step.Status = rotationdomain.StepSkipped
+			}
+		}
+	}
+	if err != nil {
+		rotation.Status, rotation.Error = rotationdomain.StatusFailed, err.Error()
+		if failed == 0 {
+			failed = 1
+		}
+	} else {
+		rotation.Status, rotation.Phase, rotation.Secrets = rotationdomain.StatusSucceeded, "", nil
+	}
+	if saveErr := s.repo.SaveRotation(ctx, rotation); saveErr != nil {
+		log.Printf("credential rotation %s: save result: %v", rotation.ID, saveErr)
+	}
+	if err == nil && rotation.Rollback {
+		if original, ok, getErr := s.repo.GetRotation(ctx, rotation.RollbackOf); getErr == nil && ok {
+			original.Status, original.Secrets, original.UpdatedAt = rotationdomain.StatusRolledBack, nil, now
+			original.Warnings = append(original.Warnings, "已由 "+rotation.ID+" 回滚到轮换前的密码")
+			if saveErr := s.repo.SaveRotation(ctx, original); saveErr != nil {
+				log.Printf("credential rotation %s: mark rolled back: %v", original.ID, saveErr)
+			}
+		}
+	}
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, rotation.ParentTaskID, created, failed)
+}
+
+func (s *CredentialRotationService) runPhases(ctx context.Context, rotation *rotationdomain.Rotation) error {
+	if err := s.runPhase(ctx, rotation, rotationdomain.PhaseDiscover); err != nil {
+		return err
+	}
+	built := false
+	for _, step := range rotation.Steps {
+		if step.Phase != rotationdomain.PhaseDiscover {
+			built = true
+			break
+		}
+	}
+	if !built {
+		if err := s.buildSteps(ctx, rotation); err != nil {
+			return err
+		}
+		s.save(ctx, rotation)
+	}
+	for _, phase := range []string{
+		rotationdomain.PhaseAlter, rotationdomain.PhaseAgent, rotationdomain.PhaseReplication, rotationdomain.PhaseProxySQL,
+		rotationdomain.PhaseManager, rotationdomain.PhaseVerify, rotationdomain.PhaseDiscard,
+	} {
+		if err := s.runPhase(ctx, rotation, phase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CredentialRotationService) runPhase(ctx context.Context, rotation *rotationdomain.Rotation, phase string) error {
+	for index := range rotation.Steps {
+		step := &rotation.Steps[index]
+		if step.Phase != phase || step.Status == rotationdomain.StepSucceeded || step.Status == rotationdomain.StepSkipped {
+			continue
+		}
+		rotation.Phase = phase
+		startedAt := time.Now().UTC()
+		step.Status, step.Message, step.StartedAt, step.FinishedAt = rotationdomain.StepRunning, "", &startedAt, nil
+		s.save(ctx, rotation)
+		message, err := s.runStep(ctx, *rotation, step)
+		finishedAt := time.Now().UTC()
+		step.FinishedAt = &finishedAt
+		if err != nil {
+			step.Status, step.Message = rotationdomain.StepFailed, err.Error()
+			s.save(ctx, rotation)
+			return fmt.Errorf("%s：%s", credentialRotationStepLabel(*step), err.Error())
+		}
+		step.Status, step.Message = rotationdomain.StepSucceeded, message
+		s.save(ctx, rotation)
+	}
+	return nil
+}
+
+func (s *CredentialRotationService) runStep(ctx context.Context, rotation rotationdomain.Rotation, step *rotationdomain.Step) (string, error) {
+	if step.Phase == rotationdomain.PhaseManager {
+		return s.updateManager(ctx, rotation)
+	}
+	// A Manager restart can interrupt the wait after the Agent finished; a
+	// successful task is reused instead of running ALTER USER ... RETAIN
+	// twice, which would discard the password the consumers still use.
+	if step.TaskID != "" {
+		if detail, err := s.tasks.GetTaskDetail(ctx, step.TaskID); err == nil && detail.Task.Status == taskdomain.StatusSuccess {
+			return "沿用已成功的任务 " + step.TaskID, nil
+		}
+	}
+	if step.Phase == rotationdomain.PhaseProxySQL {
+		secret := rotation.Secrets[mysqlapp.AccountRoleMonitor]
+		target := ProxySQLMonitorTarget{Cluster: step.Cluster, MachineID: step.MachineID, MachineName: step.MachineName, MachineIP: step.MachineIP}
+		taskID, err := s.proxysql.UpdateMonitorCredential(ctx, target, rotation.ParentTaskID, secret.Username, secret.Password)
+		step.TaskID = taskID
+		if err != nil {
+			return "", err
+		}
+		return "ProxySQL 监控账号密码已更新并校验", nil
+	}
+	commands, err := s.stepCommands(ctx, rotation, *step)
+	if err != nil {
+		return "", err
+	}
+	taskID, output, err := s.tasks.RunExecTask(ctx, step.MachineIP, "", ExecTaskOptions{
+		ParentTaskID: rotation.ParentTaskID, Operation: "mysql_credential_rotation_" + step.Phase,
+		DisplayName: credentialRotationStepLabel(*step), Port: step.Port, Commands: commands, TaskType: taskdomain.TypeExec,
+	}, credentialRotationStepTimeout)
+	step.TaskID = taskID
+	if err != nil {
+		return "", err
+	}
+	switch step.Phase {
+	case rotationdomain.PhaseDiscover:
+		facts, err := parseCredentialRotationFacts(output)
+		if err != nil {
+			return "", err
+		}
+		role := "replica"
+		if !facts.ReadOnly {
+			role = "writable"
+		}
+		return fmt.Sprintf("version=%s role=%s", facts.Version, role), nil
+	case rotationdomain.PhaseAlter:
+		return fmt.Sprintf("已修改 %d 个账号的密码", len(step.Accounts)), nil
+	case rotationdomain.PhaseDiscard:
+		return fmt.Sprintf("已丢弃 %d 个账号的旧密码", len(step.Accounts)), nil
+	}
+	return "执行成功", nil
+}
+
+// buildSteps turns the discovery results into the steps of every later
+// phase. ALTER USER runs only on the writable node of each cluster (or on a
+// standalone instance) and reaches the replicas through replication.
+func (s *CredentialRotationService) buildSteps(ctx context.Context, rotation *rotationdomain.Rotation) error {
+	usernames := make(map[string]string, len(rotation.Secrets))
+	for role, secret := range rotation.Secrets {
+		usernames[secret.Username] = role
+	}
+	discovered := make([]rotationdomain.Step, 0)
+	facts := make([]credentialRotationFacts, 0)
+	for _, step := range rotation.Steps {
+		if step.Phase != rotationdomain.PhaseDiscover {
+			continue
+		}
+		detail, err := s.tasks.GetTaskDetail(ctx, step.TaskID)
+		if err != nil {
+			return err
+		}
+		output := ""
+		if len(detail.Steps) > 0 {
+			output = detail.Steps[len(detail.Steps)-1].Message
+		}
+		item, err := parseCredentialRotationFacts(output)
+		if err != nil {
+			return fmt.Errorf("%s：%w", credentialRotationStepLabel(step), err)
+		}
+		if rotation.DualPassword && !mysqlapp.SupportsDualPasswordForVersion(item.Version) {
+			return fmt.Errorf("实例 %s:%d 运行版本 %s 不支持双密码，与轮换计划不一致", step.MachineName, step.Port, item.Version)
+		}
+		discovered = append(discovered, step)
+		facts = append(facts, item)
+	}
+
+	writers := make(map[string][]int)
+	groups := make([]string, 0)
+	for index, step := range discovered {
+		group := step.Cluster
+		if group == "" {
+			group = fmt.Sprintf("%s:%d", step.MachineID, step.Port)
+		}
+		if _, ok := writers[group]; !ok {
+			writers[group] = nil
+			groups = append(groups, group)
+		}
+		if !facts[index].ReadOnly {
+			writers[group] = append(writers[group], index)
+		}
+	}
+	for _, group := range groups {
+		switch len(writers[group]) {
+		case 0:
+			return fmt.Errorf("集群 %s 没有可写节点，无法修改账号密码", group)
+		case 1:
+		default:
+			return fmt.Errorf("集群 %s 有 %d 个可写节点，双主架构需要先切换为单一可写节点后再轮换", group, len(writers[group]))
+		}
+	}
+
+	hosts := make(map[string]map[string]bool)
+	alter := make([]rotationdomain.Step, 0)
+	for _, group := range groups {
+		index := writers[group][0]
+		step := discovered[index]
+		accounts := make([]rotationdomain.StepAccount, 0)
+		for _, account := range rotation.Accounts {
+			found := facts[index].Accounts[account.Username]
+			if len(found) == 0 {
+				return fmt.Errorf("实例 %s:%d 上不存在账号 %s", step.MachineName, step.Port, account.Username)
+			}
+			for _, host := range found {
+				accounts = append(accounts, rotationdomain.StepAccount{Role: account.Role, Username: account.Username, Host: host})
+				if hosts[account.Role] == nil {
+					hosts[account.Role] = make(map[string]bool)
+				}
+				hosts[account.Role][host] = true
+			}
+		}
+		alter = append(alter, credentialRotationStep(rotationdomain.PhaseAlter, step, "writable", accounts, nil))
+	}
+	for index := range rotation.Accounts {
+		rotation.Accounts[index].Hosts = slices.Sorted(maps.Keys(hosts[rotation.Accounts[index].Role]))
+	}
+
+	agent := make([]rotationdomain.Step, 0)
+	replication := make([]rotationdomain.Step, 0)
+	verify := make([]rotationdomain.Step, 0, len(discovered))
+	rotatedMHA := slices.Contains(rotation.Roles, mysqlapp.AccountRoleMHA)
+	for index, step := range discovered {
+		role := "replica"
+		if !facts[index].ReadOnly {
+			role = "writable"
+		}
+		accounts := make([]rotationdomain.StepAccount, 0, len(rotation.Accounts))
+		for _, account := range rotation.Accounts {
+			accounts = append(accounts, rotationdomain.StepAccount{Role: account.Role, Username: account.Username})
+		}
+		if rotatedMHA {
+			secret := rotation.Secrets[mysqlapp.AccountRoleMHA]
+			agent = append(agent, credentialRotationStep(rotationdomain.PhaseAgent, step, role, []rotationdomain.StepAccount{{Role: mysqlapp.AccountRoleMHA, Username: secret.Username}}, nil))
+		}
+		channels := make([]string, 0)
+		for _, name := range slices.Sorted(maps.Keys(facts[index].Channels)) {
+			user := facts[index].Channels[name]
+			accountRole, rotated := usernames[user]
+			if !rotated {
+				rotation.Warnings = append(rotation.Warnings, fmt.Sprintf("实例 %s:%d 复制通道 %q 使用账号 %s，不在本次轮换范围内", step.MachineName, step.Port, name, user))
+				continue
+			}
+			channels = append(channels, name)
+			replication = append(replication, credentialRotationStep(rotationdomain.PhaseReplication, step, role, []rotationdomain.StepAccount{{Role: accountRole, Username: user}}, []string{name}))
+		}
+		verify = append(verify, credentialRotationStep(rotationdomain.PhaseVerify, step, role, accounts, channels))
+	}
+
+	proxies := make([]rotationdomain.Step, 0)
+	if s.proxysql != nil && slices.Contains(rotation.Roles, mysqlapp.AccountRoleMonitor) {
+		targets, err := s.proxysql.MonitorTargets(ctx)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			proxies = append(proxies, rotationdomain.Step{
+				Phase: rotationdomain.PhaseProxySQL, Cluster: target.Cluster, MachineID: target.MachineID, MachineName: target.MachineName,
+				MachineIP: target.MachineIP, Role: "proxysql", Status: rotationdomain.StepPending,
+			})
+		}
+	}
+
+	steps := append([]rotationdomain.Step(nil), rotation.Steps...)
+	steps = append(steps, alter...)
+	steps = append(steps, agent...)
+	steps = append(steps, replication...)
+	steps = append(steps, proxies...)
+	steps = append(steps, rotationdomain.Step{Phase: rotationdomain.PhaseManager, Role: "manager", Status: rotationdomain.StepPending})
+	steps = append(steps, verify...)
+	if rotation.DualPassword {
+		for _, step := range alter {
+			step.Phase = rotationdomain.PhaseDiscard
+			steps = append(steps, step)
+		}
+	}
+	rotation.Steps = steps
+	return nil
+}
+
+func credentialRotationStep(phase string, source rotationdomain.Step, role string, accounts []rotationdomain.StepAccount, channels []string) rotationdomain.Step {
+	return rotationdomain.Step{
+		Phase: phase, Cluster: source.Cluster, MachineID: source.MachineID, MachineName: source.MachineName, MachineIP: source.MachineIP,
+		Port: source.Port, Role: role, Accounts: accounts, Channels: channels, Status: rotationdomain.StepPending,
+	}
+}
+
+func (s *CredentialRotationService) stepCommands(ctx context.Context, rotation rotationdomain.Rotation, step rotationdomain.Step) ([]taskdomain.ExecCommandStep, error) {
+	instance, ok, err := s.instances.Get(ctx, step.MachineID, step.Port)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("实例 %s:%d 不存在", step.MachineID, step.Port)
+	}
+	mysql := "mysql"
+	if strings.TrimSpace(instance.BaseDir) != "" {
+		mysql = instance.BaseDir + "/bin/mysql"
+	}
+	client := shellQuote(mysql) + " --defaults-extra-file=" + mysqlDefaultsFilePlaceholder + fmt.Sprintf(" --protocol=tcp --host=127.0.0.1 --port=%d --connect-timeout=5 --batch --raw --skip-column-names", step.Port)
+	password := func(role string) string { return rotation.Secrets[role].Password }
+
+	switch step.Phase {
+	case rotationdomain.PhaseDiscover:
+		names := make([]string, 0, len(rotation.Secrets))
+		for _, role := range rotation.Roles {
+			names = append(names, sqlLiteral(rotation.Secrets[role].Username))
+		}
+		sql := strings.Join([]string{
+			"SELECT CONCAT('gmha_version=', @@version)",
+			"SELECT CONCAT('gmha_read_only=', @@global.read_only)",
+			"SELECT CONCAT('gmha_channel=', CHANNEL_NAME, CHAR(9), USER) FROM performance_schema.replication_connection_configuration",
+			"SELECT CONCAT('gmha_account=', user, CHAR(9), host) FROM mysql.user WHERE user IN (" + strings.Join(names, ",") + ")",
+		}, "; ") + ";"
+		return []taskdomain.ExecCommandStep{{Name: "读取版本、角色、复制通道与账号", Command: client + " --execute=" + shellQuote(sql)}}, nil
+	case rotationdomain.PhaseAlter, rotationdomain.PhaseDiscard:
+		parts := make([]string, 0, len(step.Accounts))
+		for _, account := range step.Accounts {
+			item := sqlLiteral(account.Username) + "@" + sqlLiteral(account.Host)
+			switch {
+			case step.Phase == rotationdomain.PhaseDiscard:
+				item += " DISCARD OLD PASSWORD"
+			case rotation.DualPassword:
+				item += " IDENTIFIED BY " + sqlLiteral(password(account.Role)) + " RETAIN CURRENT PASSWORD"
+			default:
+				item += " IDENTIFIED BY " + sqlLiteral(password(account.Role))
+			}
+			parts = append(parts, item)
+		}
+		name := "修改账号密码并保留旧密码"
+		if step.Phase == rotationdomain.PhaseDiscard {
+			name = "丢弃账号旧密码"
+		} else if !rotation.DualPassword {
+			name = "修改账号密码"
+		}
+		return []taskdomain.ExecCommandStep{{Name: name, Command: client + " --execute=" + shellQuote("ALTER USER "+strings.Join(parts, ", ")+";")}}, nil
+	case rotationdomain.PhaseAgent:
+		account := step.Accounts[0]
+		return []taskdomain.ExecCommandStep{{Name: "更新 Agent 本地 MySQL 凭据", Command: credentialRotationAgentCommand(step.Port, account.Username, password(account.Role), false)}}, nil
+	case rotationdomain.PhaseReplication:
+		channel, account := step.Channels[0], step.Accounts[0]
+		sql := fmt.Sprintf("STOP REPLICA IO_THREAD FOR CHANNEL %[1]s; CHANGE REPLICATION SOURCE TO SOURCE_PASSWORD=%[2]s FOR CHANNEL %[1]s; START REPLICA IO_THREAD FOR CHANNEL %[1]s;", sqlLiteral(channel), sqlLiteral(password(account.Role)))
+		if capabilities, err := mysqlapp.CapabilitiesForVersion(instance.Version); err == nil && capabilities.LegacyReplicationNames {
+			sql = fmt.Sprintf("STOP SLAVE IO_THREAD FOR CHANNEL %[1]s; CHANGE MASTER TO MASTER_PASSWORD=%[2]s FOR CHANNEL %[1]s; START SLAVE IO_THREAD FOR CHANNEL %[1]s;", sqlLiteral(channel), sqlLiteral(password(account.Role)))
+		}
+		return []taskdomain.ExecCommandStep{
+			{Name: "更新复制通道密码", Command: client + " --execute=" + shellQuote(sql)},
+			{Name: "确认复制 IO 线程重新连接", Command: credentialRotationChannelCheck(client, channel)},
+		}, nil
+	case rotationdomain.PhaseVerify:
+		commands := make([]taskdomain.ExecCommandStep, 0, len(step.Accounts)+len(step.Channels)+1)
+		for _, account := range step.Accounts {
+			commands = append(commands, taskdomain.ExecCommandStep{Name: "使用新密码登录 " + account.Username, Command: credentialRotationLoginCheck(mysql, step.MachineIP, step.Port, account.Username, password(account.Role))})
+		}
+		for _, channel := range step.Channels {
+			commands = append(commands, taskdomain.ExecCommandStep{Name: "确认复制通道连接 " + channel, Command: credentialRotationChannelCheck(client, channel)})
+		}
+		if slices.Contains(rotation.Roles, mysqlapp.AccountRoleMHA) {
+			secret := rotation.Secrets[mysqlapp.AccountRoleMHA]
+			commands = append(commands, taskdomain.ExecCommandStep{Name: "校验 Agent 本地 MySQL 凭据", Command: credentialRotationAgentCommand(step.Port, secret.Username, secret.Password, true) + " && " + client + " --execute=" + shellQuote("SELECT CURRENT_USER()")})
+		}
+		return commands, nil
+	}
+	return nil, fmt.Errorf("未知的轮换阶段 %s", step.Phase)
+}
+
+// updateManager stores the new passwords in the account presets and in the
+// backup policies that log in with a rotated account.
+func (s *CredentialRotationService) updateManager(ctx context.Context, rotation rotationdomain.Rotation) (string, error) {
+	if s.presets == nil {
+		return "", errors.New("mysql account preset repository is not configured")
+	}
+	items, err := s.presets.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	items = normalizeMySQLAccountPresets(items)
+	byUser := make(map[string]string, len(rotation.Secrets))
+	for index := range items {
+		if secret, ok := rotation.Secrets[items[index].Role]; ok {
+			items[index].Password = secret.Password
+			byUser[secret.Username] = secret.Password
+		}
+	}
+	if err := s.presets.Save(ctx, items); err != nil {
+		return "", err
+	}
+	updated := 0
+	if s.backups != nil {
+		policies, err := s.backups.ListPolicies(ctx, "")
+		if err != nil {
+			return "", err
+		}
+		for _, policy := range policies {
+			password, ok := byUser[strings.TrimSpace(policy.MySQLUser)]
+			if !ok || policy.MySQLPassword == password {
+				continue
+			}
+			policy.MySQLPassword, policy.UpdatedAt = password, time.Now().UTC()
+			if err := s.backups.SavePolicy(ctx, policy); err != nil {
+				return "", err
+			}
+			updated++
+		}
+	}
+	return fmt.Sprintf("已更新预设账号 %s 与 %d 个备份策略", strings.Join(rotation.Roles, ","), updated), nil
+}
+
+func (s *CredentialRotationService) Rotation(ctx context.Context, id string) (rotationdomain.Rotation, error) {
+	rotation, ok, err := s.repo.GetRotation(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return rotationdomain.Rotation{}, err
+	}
+	if !ok {
+		return rotationdomain.Rotation{}, ErrCredentialRotationNotFound
+	}
+	return credentialRotationView(rotation), nil
+}
+
+func (s *CredentialRotationService) ListRotations(ctx context.Context, status string, limit int) ([]rotationdomain.Rotation, error) {
+	return s.repo.ListRotations(ctx, status, limit)
+}
+
+func (s *CredentialRotationService) Schedule(ctx context.Context) (rotationdomain.Schedule, error) {
+	schedule, ok, err := s.repo.GetSchedule(ctx)
+	if err != nil {
+		return rotationdomain.Schedule{}, err
+	}
+	if !ok {
+		return rotationdomain.Schedule{Roles: []string{}}, nil
+	}
+	return schedule, nil
+}
+
+func (s *CredentialRotationService) SaveSchedule(ctx context.Context, req CredentialRotationScheduleRequest) (rotationdomain.Schedule, error) {
+	current, err := s.Schedule(ctx)
+	if err != nil {
+		return rotationdomain.Schedule{}, err
+	}
+	now := time.Now().UTC()
+	schedule := current
+	schedule.Enabled, schedule.UpdatedBy, schedule.UpdatedAt = req.Enabled, strings.TrimSpace(req.Actor), now
+	if req.Enabled {
+		roles, err := normalizeCredentialRotationRoles(req.Roles)
+		if err != nil {
+			return rotationdomain.Schedule{}, err
+		}
+		if req.IntervalDays < 1 || req.IntervalDays > credentialRotationMaxIntervalDay {
+			return rotationdomain.Schedule{}, fmt.Errorf("interval_days 必须在 1 到 %d 之间", credentialRotationMaxIntervalDay)
+		}
+		schedule.Roles, schedule.IntervalDays, schedule.LastError = roles, req.IntervalDays, ""
+		schedule.NextRunAt = req.NextRunAt.UTC()
+		if req.NextRunAt.IsZero() {
+			schedule.NextRunAt = now.AddDate(0, 0, req.IntervalDays)
+		}
+	} else {
+		schedule.NextRunAt = time.Time{}
+	}
+	if schedule.Roles == nil {
+		schedule.Roles = []string{}
+	}
+	if err := s.repo.SaveSchedule(ctx, schedule); err != nil {
+		return rotationdomain.Schedule{}, err
+	}
+	return schedule, nil
+}
+
+// RecoverInterrupted fails rotations left running by a Manager restart.
+// Their passwords stay in the record so they can be retried or rolled back.
+func (s *CredentialRotationService) RecoverInterrupted(ctx context.Context) error {
+	items, err := s.repo.ListRotations(ctx, rotationdomain.StatusRunning, 500)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		rotation, ok, err := s.repo.GetRotation(ctx, item.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		for index := range rotation.Steps {
+			if rotation.Steps[index].Status == rotationdomain.StepRunning {
+				rotation.Steps[index].Status = rotationdomain.StepFailed
+				rotation.Steps[index].Message = "Manager 重启时该步骤仍在执行，结果未知"
+			}
+		}
+		now := time.Now().UTC()
+		rotation.Status, rotation.FinishedAt, rotation.UpdatedAt = rotationdomain.StatusFailed, &now, now
+		rotation.Error = "Manager 在轮换期间重启，轮换已停止；请重试或回滚"
+		if err := s.repo.SaveRotation(ctx, rotation); err != nil {
+			return err
+		}
+		if rotation.ParentTaskID != "" {
+			_ = s.tasks.FinalizeBatchTrackingTask(ctx, rotation.ParentTaskID, 0, 1)
+		}
+	}
+	return nil
+}
+
+func (s *CredentialRotationService) scheduleLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	s.runDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runDue(ctx)
+		}
+	}
+}
+
+// runDue starts the scheduled rotation. Scheduled runs never fall back to
+// single passwords; when a rotation cannot start the schedule records the
+// reason and tries again a day later.
+func (s *CredentialRotationService) runDue(ctx context.Context) {
+	schedule, ok, err := s.repo.GetSchedule(ctx)
+	if err != nil {
+		log.Printf("credential rotation scheduler: %v", err)
+		return
+	}
+	now := time.Now().UTC()
+	if !ok || !schedule.Enabled || schedule.NextRunAt.IsZero() || schedule.NextRunAt.After(now) {
+		return
+	}
+	rotation, err := s.start(ctx, schedule.Roles, false, rotationdomain.TriggerSchedule, "scheduler")
+	schedule.LastRunAt = now
+	if err != nil {
+		schedule.LastError = err.Error()
+		schedule.NextRunAt = now.Add(24 * time.Hour)
+	} else {
+		schedule.LastError, schedule.LastRotationID = "", rotation.ID
+		schedule.NextRunAt = now.AddDate(0, 0, schedule.IntervalDays)
+	}
+	if err := s.repo.SaveSchedule(ctx, schedule); err != nil {
+		log.Printf("credential rotation scheduler: %v", err)
+	}
+}
+
+func (s *CredentialRotationService) presetsByRole(ctx context.Context) (map[string]taskdomain.MySQLAccountSpec, error) {
+	items := defaultMySQLAccountPresets()
+	if s.presets != nil {
+		saved, err := s.presets.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = normalizeMySQLAccountPresets(saved)
+	}
+	out := make(map[string]taskdomain.MySQLAccountSpec, len(items))
+	for _, item := range items {
+		item.Username = strings.TrimSpace(item.Username)
+		out[item.Role] = item
+	}
+	return out, nil
+}
+
+func (s *CredentialRotationService) save(ctx context.Context, rotation *rotationdomain.Rotation) {
+	rotation.UpdatedAt = time.Now().UTC()
+	if err := s.repo.SaveRotation(ctx, *rotation); err != nil {
+		log.Printf("credential rotation %s: save progress: %v", rotation.ID, err)
+	}
+}
+
+func normalizeCredentialRotationRoles(roles []string) ([]string, error) {
+	selected := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role == "" {
+			continue
+		}
+		if !slices.Contains(credentialRotationRoles, role) {
+			return nil, fmt.Errorf("不支持轮换账号角色 %s，可选 %s", role, strings.Join(credentialRotationRoles, "、"))
+		}
+		selected[role] = true
+	}
+	out := make([]string, 0, len(selected))
+	for _, role := range credentialRotationRoles {
+		if selected[role] {
+			out = append(out, role)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("roles 不能为空")
+	}
+	return out, nil
+}
+
+func parseCredentialRotationFacts(output string) (credentialRotationFacts, error) {
+	facts := credentialRotationFacts{Channels: map[string]string{}, Accounts: map[string][]string{}}
+	readOnly := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "gmha_version="):
+			facts.Version = strings.TrimSpace(strings.TrimPrefix(line, "gmha_version="))
+		case strings.HasPrefix(line, "gmha_read_only="):
+			readOnly = strings.TrimSpace(strings.TrimPrefix(line, "gmha_read_only="))
+		case strings.HasPrefix(line, "gmha_channel="):
+			name, user, ok := strings.Cut(strings.TrimPrefix(line, "gmha_channel="), "\t")
+			if ok && strings.TrimSpace(user) != "" {
+				facts.Channels[name] = strings.TrimSpace(user)
+			}
+		case strings.HasPrefix(line, "gmha_account="):
+			user, host, ok := strings.Cut(strings.TrimPrefix(line, "gmha_account="), "\t")
+			if ok {
+				facts.Accounts[user] = append(facts.Accounts[user], host)
+			}
+		}
+	}
+	if facts.Version == "" || readOnly == "" {
+		return facts, errors.New("未能读取实例版本和 read_only 状态")
+	}
+	facts.ReadOnly = readOnly != "0"
+	return facts, nil
+}
+
+// credentialRotationAgentCommand locates the Agent binary from its systemd
+// unit and updates (or, with check, verifies) the credentials it keeps for
+// the instance in mysql-heartbeat.json.
+func credentialRotationAgentCommand(port int, username, password string, check bool) string {
+	args := fmt.Sprintf(" mysql-credential --file \"$(dirname \"$agentd\")/mysql-heartbeat.json\" --port %d --username %s --password-base64 %s", port, shellQuote(username), shellQuote(base64.StdEncoding.EncodeToString([]byte(password))))
+	if check {
+		args += " --check"
+	}
+	return "agentd=$(systemctl show -p ExecStart --value gmha-agent 2>/dev/null | grep -oE '/[^ ;]+/agentd' | head -1); " +
+		"[ -n \"$agentd\" ] || agentd=/home/gmha/agent/agentd; \"$agentd\"" + args
+}
+
+func credentialRotationLoginCheck(mysql, machineIP string, port int, username, password string) string {
+	login := func(host string) string {
+		return "MYSQL_PWD=" + shellQuote(password) + " " + shellQuote(mysql) + fmt.Sprintf(" --protocol=tcp --host=%s --port=%d --user=%s --connect-timeout=5 --batch --raw --skip-column-names --execute='SELECT CURRENT_USER()' >/dev/null 2>&1", shellQuote(host), port, shellQuote(username))
+	}
+	return "ok=''; for i in $(seq 1 " + strconv.Itoa(credentialRotationVerifyAttempts) + "); do if " + login(machineIP) + " || " + login("127.0.0.1") + "; then ok=1; break; fi; sleep 2; done; " +
+		"[ -n \"$ok\" ] || { echo " + shellQuote("账号 "+username+" 无法使用新密码登录") + " >&2; exit 1; }; echo " + shellQuote("login_ok="+username)
+}
+
+func credentialRotationChannelCheck(client, channel string) string {
+	query := client + " --execute=" + shellQuote("SELECT SERVICE_STATE FROM performance_schema.replication_connection_status WHERE CHANNEL_NAME="+sqlLiteral(channel))
+	return "state=''; for i in $(seq 1 " + strconv.Itoa(credentialRotationVerifyAttempts) + "); do state=$(" + query + "); [ \"$state\" = ON ] && break; sleep 2; done; " +
+		"[ \"$state\" = ON ] || { echo \"replication channel state: $state\" >&2; exit 1; }; echo " + shellQuote("channel_ok="+channel)
+}
+
+func generateCredentialRotationPassword() (string, error) {
+	classes := []string{"ABCDEFGHJKLMNPQRSTUVWXYZ", "abcdefghijkmnopqrstuvwxyz", "23456789", "-_.+=^"}
+	all := strings.Join(classes, "")
+	out := make([]byte, credentialRotationPasswordLength)
+	pick := func(set string) (byte, error) {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+		if err != nil {
+			return 0, err
+		}
+		return set[n.Int64()], nil
+	}
+	for index := range out {
+		set := all
+		if index < len(classes) {
+			set = classes[index]
+		}
+		value, err := pick(set)
+		if err != nil {
+			return "", err
+		}
+		out[index] = value
+	}
+	// Shuffle so the guaranteed character classes are not always in front.
+	for index := len(out) - 1; index > 0; index-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(index+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		out[index], out[j] = out[j], out[index]
+	}
+	return string(out), nil
+}
+
+func credentialRotationStepLabel(step rotationdomain.Step) string {
+	labels := map[string]string{
+		rotationdomain.PhaseDiscover: "发现", rotationdomain.PhaseAlter: "修改密码", rotationdomain.PhaseAgent: "更新 Agent 凭据",
+		rotationdomain.PhaseReplication: "更新复制通道", rotationdomain.PhaseProxySQL: "更新 ProxySQL", rotationdomain.PhaseManager: "更新 Manager 保存的密码",
+		rotationdomain.PhaseVerify: "校验", rotationdomain.PhaseDiscard: "丢弃旧密码",
+	}
+	label := labels[step.Phase]
+	if step.MachineID == "" {
+		return label
+	}
+	if step.Port > 0 {
+		return fmt.Sprintf("%s %s:%d", label, step.MachineName, step.Port)
+	}
+	return label + " " + step.MachineName
+}
+
+func credentialRotationView(rotation rotationdomain.Rotation) rotationdomain.Rotation {
+	rotation.Secrets = nil
+	return rotation
+}
+
+func credentialRotationActor(actor string) string {
+	if actor = strings.TrimSpace(actor); actor != "" {
+		return actor
+	}
+	return "unknown"
+}
@@ -0,0 +1,385 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	backupdomain "gmha/internal/domain/backup"
+	rotationdomain "gmha/internal/domain/credrotation"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type credentialRotationMemoryRepo struct {
+	mu        sync.Mutex
+	rotations []rotationdomain.Rotation
+	schedule  *rotationdomain.Schedule
+}
+
+func (r *credentialRotationMemoryRepo) GetRotation(_ context.Context, id string) (rotationdomain.Rotation, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rotation := range r.rotations {
+		if rotation.ID == id {
+			rotation.Steps = append([]rotationdomain.Step(nil), rotation.Steps...)
+			return rotation, true, nil
+		}
+	}
+	return rotationdomain.Rotation{}, false, nil
+}
+
+func (r *credentialRotationMemoryRepo) SaveRotation(_ context.Context, rotation rotationdomain.Rotation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rotation.Steps = append([]rotationdomain.Step(nil), rotation.Steps...)
+	for index := range r.rotations {
+		if r.rotations[index].ID == rotation.ID {
+			r.rotations[index] = rotation
+			return nil
+		}
+	}
+	r.rotations = append(r.rotations, rotation)
+	return nil
+}
+
+func (r *credentialRotationMemoryRepo) ListRotations(_ context.Context, status string, limit int) ([]rotationdomain.Rotation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]rotationdomain.Rotation, 0)
+	for index := len(r.rotations) - 1; index >= 0 && (limit <= 0 || len(out) < limit); index-- {
+		if status == "" || r.rotations[index].Status == status {
+			out = append(out, r.rotations[index])
+		}
+	}
+	return out, nil
+}
+
+func (r *credentialRotationMemoryRepo) GetSchedule(context.Context) (rotationdomain.Schedule, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.schedule == nil {
+		return rotationdomain.Schedule{}, false, nil
+	}
+	return *r.schedule, true, nil
+}
+
+func (r *credentialRotationMemoryRepo) SaveSchedule(_ context.Context, schedule rotationdomain.Schedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedule = &schedule
+	return nil
+}
+
+type credentialRotationInstanceRepo struct{ fakeArchitectureInstanceRepo }
+
+func (r credentialRotationInstanceRepo) Get(_ context.Context, machineID string, port int) (mysqlapp.Instance, bool, error) {
+	for _, instance := range r.items {
+		if instance.MachineID == machineID && instance.Port == port {
+			return instance, true, nil
+		}
+	}
+	return mysqlapp.Instance{}, false, nil
+}
+
+type credentialRotationPresetRepo struct {
+	mu    sync.Mutex
+	items []taskdomain.MySQLAccountSpec
+}
+
+func (r *credentialRotationPresetRepo) List(context.Context) ([]taskdomain.MySQLAccountSpec, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]taskdomain.MySQLAccountSpec(nil), r.items...), nil
+}
+
+func (r *credentialRotationPresetRepo) Save(_ context.Context, items []taskdomain.MySQLAccountSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = append([]taskdomain.MySQLAccountSpec(nil), items...)
+	return nil
+}
+
+func (r *credentialRotationPresetRepo) password(role string) string {
+	items, _ := r.List(context.Background())
+	for _, item := range items {
+		if item.Role == role {
+			return item.Password
+		}
+	}
+	return ""
+}
+
+type credentialRotationPolicyRepo struct {
+	backupdomain.Repository
+	mu       sync.Mutex
+	policies []backupdomain.Policy
+}
+
+func (r *credentialRotationPolicyRepo) ListPolicies(context.Context, string) ([]backupdomain.Policy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]backupdomain.Policy(nil), r.policies...), nil
+}
+
+func (r *credentialRotationPolicyRepo) SavePolicy(_ context.Context, policy backupdomain.Policy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for index := range r.policies {
+		if r.policies[index].ID == policy.ID {
+			r.policies[index] = policy
+		}
+	}
+	return nil
+}
+
+// credentialRotationTaskFake answers discovery from a per-IP script and
+// records every command it was asked to run.
+type credentialRotationTaskFake struct {
+	mu        sync.Mutex
+	discovery map[string]string
+	failOn    string
+	tasks     map[string]TaskDetail
+	commands  []string
+	redacted  int
+}
+
+func (f *credentialRotationTaskFake) CreateBatchTrackingTask(_ context.Context, operation, _, _ string) (TaskDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return TaskDetail{Task: taskdomain.Task{ID: fmt.Sprintf("%s-%d", operation, len(f.tasks))}}, nil
+}
+
+func (f *credentialRotationTaskFake) FinalizeBatchTrackingTask(context.Context, string, int, int) error {
+	return nil
+}
+
+func (f *credentialRotationTaskFake) CreateExecTaskWithOptions(_ context.Context, ip, _ string, options ExecTaskOptions) (TaskDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := make([]string, 0, len(options.Commands))
+	for _, command := range options.Commands {
+		commands = append(commands, command.Command)
+	}
+	// Undo shell quoting so assertions can look for the SQL text.
+	command := strings.ReplaceAll(ip+" "+options.Operation+" "+strings.Join(commands, " && "), `'\''`, "'")
+	f.commands = append(f.commands, command)
+	status, output := taskdomain.StatusSuccess, "ok"
+	if options.Operation == "mysql_credential_rotation_discover" {
+		output = f.discovery[ip]
+	}
+	if f.failOn != "" && strings.Contains(command, f.failOn) {
+		status, output = taskdomain.StatusFailed, "Access denied"
+	}
+	detail := TaskDetail{Task: taskdomain.Task{ID: fmt.Sprintf("task-%d", len(f.commands)), Status: status}, Steps: []taskdomain.Step{{Message: output}}}
+	if f.tasks == nil {
+		f.tasks = map[string]TaskDetail{}
+	}
+	f.tasks[detail.Task.ID] = detail
+	return TaskDetail{Task: taskdomain.Task{ID: detail.Task.ID}}, nil
+}
+
+func (f *credentialRotationTaskFake) RunExecTask(ctx context.Context, ip, command string, options ExecTaskOptions, _ time.Duration) (string, string, error) {
+	created, _ := f.CreateExecTaskWithOptions(ctx, ip, command, options)
+	_ = f.RedactExecTaskCommand(ctx, created.Task.ID)
+	detail, err := f.GetTaskDetail(ctx, created.Task.ID)
+	if err != nil {
+		return created.Task.ID, "", err
+	}
+	output := detail.Steps[0].Message
+	if detail.Task.Status != taskdomain.StatusSuccess {
+		return detail.Task.ID, output, fmt.Errorf("agent task %s failed: %s", detail.Task.ID, output)
+	}
+	return detail.Task.ID, output, nil
+}
+
+func (f *credentialRotationTaskFake) GetTaskDetail(_ context.Context, id string) (TaskDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	detail, ok := f.tasks[id]
+	if !ok {
+		return TaskDetail{}, errors.New("task not found")
+	}
+	return detail, nil
+}
+
+func (f *credentialRotationTaskFake) RedactExecTaskCommand(context.Context, string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.redacted++
+	return nil
+}
+
+func (f *credentialRotationTaskFake) reset(failOn string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := f.commands
+	f.commands, f.failOn = nil, failOn
+	return commands
+}
+
+func waitCredentialRotation(t *testing.T, service *CredentialRotationService, id string) rotationdomain.Rotation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rotation, err := service.Rotation(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rotation.Status != rotationdomain.StatusRunning {
+			return rotation
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("rotation %s did not finish", id)
+	return rotationdomain.Rotation{}
+}
+
+func newCredentialRotationTestService(version string) (*CredentialRotationService, *credentialRotationMemoryRepo, *credentialRotationTaskFake, *credentialRotationPresetRepo, *credentialRotationPolicyRepo) {
+	repo := &credentialRotationMemoryRepo{}
+	tasks := &credentialRotationTaskFake{discovery: map[string]string{
+		"10.0.0.1": "gmha_version=" + version + "\ngmha_read_only=0\ngmha_account=mha\t%\ngmha_account=backup\tlocalhost\n",
+		"10.0.0.2": "gmha_version=" + version + "\ngmha_read_only=1\ngmha_channel=\tmha\ngmha_channel=etl\tetl_repl\ngmha_account=mha\t%\ngmha_account=backup\tlocalhost\n",
+	}}
+	presets := &credentialRotationPresetRepo{items: []taskdomain.MySQLAccountSpec{
+		{Role: mysqlapp.AccountRoleMonitor, Username: "monitor", Password: "monitor-old", Enabled: true},
+		{Role: mysqlapp.AccountRoleMHA, Username: "mha", Password: "mha-old", Enabled: true},
+		{Role: mysqlapp.AccountRoleBackup, Username: "backup", Password: "backup-old", Enabled: true},
+	}}
+	policies := &credentialRotationPolicyRepo{policies: []backupdomain.Policy{
+		{ID: "p1", MySQLUser: "backup", MySQLPassword: "backup-old"},
+		{ID: "p2", MySQLUser: "custom", MySQLPassword: "custom"},
+	}}
+	machines := &schemaMachineRepo{items: map[string]machinedomain.Machine{
+		"m1": {ID: "m1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+		"m2": {ID: "m2", Name: "db-2", IP: "10.0.0.2", Cluster: "orders"},
+	}}
+	instances := credentialRotationInstanceRepo{fakeArchitectureInstanceRepo{items: []mysqlapp.Instance{
+		{MachineID: "m2", Port: 3306, Version: version, BaseDir: "/usr/local/mysql"},
+		{MachineID: "m1", Port: 3306, Version: version, BaseDir: "/usr/local/mysql"},
+	}}}
+	service := NewCredentialRotationService(repo, tasks, instances, machines, presets, policies)
+	return service, repo, tasks, presets, policies
+}
+
+func TestCredentialRotationServiceRotatesWithDualPasswords(t *testing.T) {
+	ctx := context.Background()
+	service, _, tasks, presets, policies := newCredentialRotationTestService("8.0.36")
+
+	plan, err := service.Plan(ctx, []string{"backup", "MHA", "backup"})
+	if err != nil || !plan.DualPassword || strings.Join(plan.Roles, ",") != "mha,backup" || len(plan.Steps) != 2 || plan.Steps[0].MachineID != "m1" {
+		t.Fatalf("plan = %+v, %v", plan, err)
+	}
+	if _, err := service.Rotate(ctx, CredentialRotationRequest{Roles: []string{"mha"}}); err == nil {
+		t.Fatal("rotation without confirmation must fail")
+	}
+	if _, err := service.Plan(ctx, []string{"root"}); err == nil {
+		t.Fatal("only preset roles can be rotated")
+	}
+
+	started, err := service.Rotate(ctx, CredentialRotationRequest{Roles: []string{"mha", "backup"}, Confirm: "rotate", Actor: "dba"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.Secrets != nil {
+		t.Fatal("secrets must not leave the service")
+	}
+	rotation := waitCredentialRotation(t, service, started.ID)
+	if rotation.Status != rotationdomain.StatusSucceeded {
+		t.Fatalf("rotation = %+v", rotation)
+	}
+	phases := make([]string, 0, len(rotation.Steps))
+	for _, step := range rotation.Steps {
+		phases = append(phases, step.Phase+"@"+step.MachineID)
+	}
+	if got := strings.Join(phases, " "); got != "discover@m1 discover@m2 alter@m1 agent@m1 agent@m2 replication@m2 manager@ verify@m1 verify@m2 discard@m1" {
+		t.Fatalf("steps = %s", got)
+	}
+	if len(rotation.Warnings) != 2 || !strings.Contains(rotation.Warnings[1], "etl_repl") {
+		t.Fatalf("warnings = %v", rotation.Warnings)
+	}
+
+	mhaPassword, backupPassword := presets.password(mysqlapp.AccountRoleMHA), presets.password(mysqlapp.AccountRoleBackup)
+	if len(mhaPassword) != credentialRotationPasswordLength || mhaPassword == "mha-old" || presets.password(mysqlapp.AccountRoleMonitor) != "monitor-old" {
+		t.Fatalf("presets = %+v", presets.items)
+	}
+	if policies.policies[0].MySQLPassword != backupPassword || policies.policies[1].MySQLPassword != "custom" {
+		t.Fatalf("policies = %+v", policies.policies)
+	}
+	commands := tasks.reset("")
+	alter, replication, discard := commands[2], commands[5], commands[len(commands)-1]
+	for _, expected := range []string{"'mha'@'%' IDENTIFIED BY '" + mhaPassword + "' RETAIN CURRENT PASSWORD", "'backup'@'localhost' IDENTIFIED BY '" + backupPassword + "' RETAIN CURRENT PASSWORD"} {
+		if !strings.Contains(alter, expected) {
+			t.Fatalf("alter %q missing %q", alter, expected)
+		}
+	}
+	if !strings.HasPrefix(replication, "10.0.0.2") || !strings.Contains(replication, "SOURCE_PASSWORD='"+mhaPassword+"' FOR CHANNEL ''") {
+		t.Fatalf("replication = %s", replication)
+	}
+	if !strings.Contains(discard, "'mha'@'%' DISCARD OLD PASSWORD, 'backup'@'localhost' DISCARD OLD PASSWORD") {
+		t.Fatalf("discard = %s", discard)
+	}
+	if tasks.redacted != len(commands) {
+		t.Fatalf("redacted %d of %d tasks", tasks.redacted, len(commands))
+	}
+}
+
+func TestCredentialRotationServiceFailureBlocksUntilRollback(t *testing.T) {
+	ctx := context.Background()
+	service, repo, tasks, presets, _ := newCredentialRotationTestService("5.7.44")
+
+	if _, err := service.Rotate(ctx, CredentialRotationRequest{Roles: []string{"mha"}, Confirm: "rotate"}); !errors.Is(err, ErrCredentialRotationSinglePassword) {
+		t.Fatalf("single password err = %v", err)
+	}
+	tasks.reset("login_ok=mha")
+	started, err := service.Rotate(ctx, CredentialRotationRequest{Roles: []string{"mha"}, AllowSinglePassword: true, Confirm: "rotate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := waitCredentialRotation(t, service, started.ID)
+	if failed.Status != rotationdomain.StatusFailed || failed.Phase != rotationdomain.PhaseVerify || failed.Steps[len(failed.Steps)-1].Status != rotationdomain.StepSkipped {
+		t.Fatalf("failed = %+v", failed)
+	}
+	newPassword := presets.password(mysqlapp.AccountRoleMHA)
+	if newPassword == "mha-old" {
+		t.Fatal("manager step runs before verification")
+	}
+	if commands := tasks.reset(""); strings.Contains(strings.Join(commands, "\n"), "RETAIN CURRENT PASSWORD") || strings.Contains(strings.Join(commands, "\n"), "DISCARD") {
+		t.Fatalf("single password commands = %v", commands)
+	}
+	if _, err := service.Rotate(ctx, CredentialRotationRequest{Roles: []string{"backup"}, AllowSinglePassword: true, Confirm: "rotate"}); !errors.Is(err, ErrCredentialRotationActive) {
+		t.Fatalf("second rotation err = %v", err)
+	}
+
+	rollback, err := service.Rollback(ctx, failed.ID, "dba")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rollback = waitCredentialRotation(t, service, rollback.ID)
+	if rollback.Status != rotationdomain.StatusSucceeded || rollback.RollbackOf != failed.ID {
+		t.Fatalf("rollback = %+v", rollback)
+	}
+	commands := tasks.reset("")
+	if !strings.Contains(commands[2], "'mha'@'%' IDENTIFIED BY 'mha-old'") {
+		t.Fatalf("rollback alter = %s", commands[2])
+	}
+	original, _, _ := repo.GetRotation(ctx, failed.ID)
+	if original.Status != rotationdomain.StatusRolledBack || len(original.Secrets) != 0 || presets.password(mysqlapp.AccountRoleMHA) != "mha-old" {
+		t.Fatalf("original = %+v, preset = %s", original, presets.password(mysqlapp.AccountRoleMHA))
+	}
+
+	_ = repo.SaveRotation(ctx, rotationdomain.Rotation{ID: "r-running", Status: rotationdomain.StatusRunning, Secrets: map[string]rotationdomain.Secret{"mha": {Password: "x"}},
+		Steps: []rotationdomain.Step{{Phase: rotationdomain.PhaseAlter, Status: rotationdomain.StepRunning}}})
+	if err := service.RecoverInterrupted(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recovered, _, _ := repo.GetRotation(ctx, "r-running")
+	if recovered.Status != rotationdomain.StatusFailed || recovered.Steps[0].Status != rotationdomain.StepFailed || len(recovered.Secrets) == 0 {
+		t.Fatalf("recovered = %+v", recovered)
+	}
+}
@@ -0,0 +1,1065 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	drdomain "gmha/internal/domain/dr"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const (
+	drNodeMarker        = "__GMHA_DR_NODE__"
+	drStateMarker       = "__GMHA_DR_STATE__"
+	drAppliedMarker     = "__GMHA_DR_APPLIED__"
+	drSourceMarker      = "__GMHA_DR_SOURCE__"
+	drSourceDownMarker  = "__GMHA_DR_SOURCE_DOWN__"
+	drWaitMarker        = "__GMHA_DR_WAIT__"
+	drHealthRuleID      = "dr_link_health"
+	drCheckInterval     = 5 * time.Minute
+	drProbeTimeout      = 45 * time.Second
+	drConfigureTimeout  = 2 * time.Minute
+	drSetupSettleDelay  = 5 * time.Second
+	drDefaultSourcePort = 3306
+)
+
+// DRLinkRequest creates a link that makes the primary of TargetCluster a
+// replica of SourceCluster. SourceMode "vip" follows the source cluster's
+// enabled VIP; "primary" follows whichever node is currently writable.
+type DRLinkRequest struct {
+	Name          string `json:"name"`
+	SourceCluster string `json:"source_cluster"`
+	TargetCluster string `json:"target_cluster"`
+	SourceMode    string `json:"source_mode"`
+	SourcePort    int    `json:"source_port,omitempty"`
+	TargetPort    int    `json:"target_port,omitempty"`
+	MaxLagSeconds int    `json:"max_lag_seconds,omitempty"`
+}
+
+// DRPromoteRequest guards the promotion: Confirm must repeat the DR cluster
+// name, and Force is required whenever the source cannot be fenced and fully
+// drained, i.e. whenever the promotion may lose transactions.
+type DRPromoteRequest struct {
+	Confirm               string `json:"confirm"`
+	Force                 bool   `json:"force,omitempty"`
+	Reverse               bool   `json:"reverse,omitempty"`
+	CatchUpTimeoutSeconds int    `json:"catch_up_timeout_seconds,omitempty"`
+}
+
+type drNode struct {
+	machine       machinedomain.Machine
+	instance      mysqlapp.Instance
+	readOnly      bool
+	superReadOnly bool
+	channels      int
+	executed      string
+	purged        string
+}
+
+// drTargetState is what the DR primary reports about the DR channel and, via
+// the replication account, about the source endpoint it replicates from.
+type drTargetState struct {
+	executed        string
+	received        string
+	channelFound    bool
+	ioRunning       bool
+	sqlRunning      bool
+	lagSeconds      int64
+	sourceHost      string
+	lastError       string
+	lastApplied     string
+	lastAppliedAt   *time.Time
+	sourceReachable bool
+	sourceReadOnly  bool
+	sourceExecuted  string
+}
+
+type DRService struct {
+	repo      drdomain.Repository
+	tasks     *TaskService
+	machines  machinedomain.Repository
+	instances MySQLInstanceRepository
+	ha        *HAService
+	alerts    *AlertService
+	tls       taskusecase.ReplicationTLSResolver
+	mu        sync.Mutex
+	busy      map[string]bool
+	cancel    context.CancelFunc
+}
+
+func NewDRService(repo drdomain.Repository, tasks *TaskService, machines machinedomain.Repository, instances MySQLInstanceRepository, ha *HAService) *DRService {
+	return &DRService{repo: repo, tasks: tasks, machines: machines, instances: instances, ha: ha, busy: map[string]bool{}}
+}
+
+// SetAlertService enables lag and broken-link alerts.
+func (s *DRService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+// SetReplicationTLSResolver lets the DR channel use SOURCE_SSL like in-cluster replication.
+func (s *DRService) SetReplicationTLSResolver(resolver taskusecase.ReplicationTLSResolver) {
+	s.tls = resolver
+}
+
+func (s *DRService) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.monitorLoop(ctx)
+}
+
+func (s *DRService) Close() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	s.mu.Unlock()
+}
+
+func (s *DRService) monitorLoop(ctx context.Context) {
+	ticker := time.NewTicker(drCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			links, err := s.repo.ListLinks(ctx)
+			if err != nil {
+				log.Printf("dr monitor: %v", err)
+				continue
+			}
+			for _, link := range links {
+				if link.Status != drdomain.StatusRunning {
+					continue
+				}
+				if _, err := s.CheckLink(ctx, link.ID); err != nil {
+					log.Printf("dr monitor %s: %v", link.ID, err)
+				}
+			}
+		}
+	}
+}
+
+func (s *DRService) acquire(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return false
+	}
+	s.busy[id] = true
+	return true
+}
+
+func (s *DRService) release(id string) {
+	s.mu.Lock()
+	delete(s.busy, id)
+	s.mu.Unlock()
+}
+
+func (s *DRService) ListLinks(ctx context.Context) ([]drdomain.Link, error) {
+	return s.repo.ListLinks(ctx)
+}
+
+func (s *DRService) GetLink(ctx context.Context, id string) (drdomain.Link, bool, error) {
+	return s.repo.GetLink(ctx, id)
+}
+
+func (s *DRService) ListPromotions(ctx context.Context, linkID string, limit int) ([]drdomain.Promotion, error) {
+	return s.repo.ListPromotions(ctx, linkID, limit)
+}
+
+// CreateLink validates the request and configures the DR channel in the
+// background; the returned link stays "configuring" until the DR primary
+// has been attached and checked.
+func (s *DRService) CreateLink(ctx context.Context, req DRLinkRequest) (drdomain.Link, error) {
+	req.SourceCluster, req.TargetCluster = strings.TrimSpace(req.SourceCluster), strings.TrimSpace(req.TargetCluster)
+	req.SourceMode = strings.ToLower(strings.TrimSpace(req.SourceMode))
+	if req.SourceMode == "" {
+		req.SourceMode = drdomain.SourceModeVIP
+	}
+	if req.SourceCluster == "" || req.TargetCluster == "" {
+		return drdomain.Link{}, errors.New("source_cluster and target_cluster are required")
+	}
+	if req.SourceCluster == req.TargetCluster {
+		return drdomain.Link{}, errors.New("源集群与容灾集群不能相同")
+	}
+	if req.SourceMode != drdomain.SourceModeVIP && req.SourceMode != drdomain.SourceModePrimary {
+		return drdomain.Link{}, errors.New("source_mode 只能是 vip 或 primary")
+	}
+	if req.MaxLagSeconds < 0 || req.SourcePort < 0 || req.SourcePort > 65535 || req.TargetPort < 0 || req.TargetPort > 65535 {
+		return drdomain.Link{}, errors.New("端口或延迟阈值无效")
+	}
+	links, err := s.repo.ListLinks(ctx)
+	if err != nil {
+		return drdomain.Link{}, err
+	}
+	for _, existing := range links {
+		if !drLinkActive(existing) {
+			continue
+		}
+		if existing.TargetClusterID == req.TargetCluster {
+			return drdomain.Link{}, fmt.Errorf("集群 %s 已是容灾链路 %s 的目标", req.TargetCluster, existing.ID)
+		}
+		if existing.TargetClusterID == req.SourceCluster && existing.SourceClusterID == req.TargetCluster {
+			return drdomain.Link{}, fmt.Errorf("容灾链路 %s 已在反方向复制，不能形成环", existing.ID)
+		}
+	}
+	for _, cluster := range []string{req.SourceCluster, req.TargetCluster} {
+		machines, err := s.clusterMachines(ctx, cluster)
+		if err != nil {
+			return drdomain.Link{}, err
+		}
+		if len(machines) == 0 {
+			return drdomain.Link{}, fmt.Errorf("集群 %s 没有纳管机器", cluster)
+		}
+		for _, machine := range machines {
+			if compatible, reason := s.tasks.MachineCapability(machine.ID, taskdomain.CapabilityMySQLDefaultsFile); !compatible {
+				return drdomain.Link{}, fmt.Errorf("%s: %s", machine.Name, reason)
+			}
+		}
+	}
+	if req.SourceMode == drdomain.SourceModeVIP {
+		if _, err := s.sourceVIP(ctx, req.SourceCluster); err != nil {
+			return drdomain.Link{}, err
+		}
+	}
+	now := time.Now().UTC()
+	link := drdomain.Link{
+		ID: newEntityID("dr"), Name: strings.TrimSpace(req.Name), SourceClusterID: req.SourceCluster, TargetClusterID: req.TargetCluster,
+		SourceMode: req.SourceMode, SourcePort: req.SourcePort, TargetPort: req.TargetPort, MaxLagSeconds: req.MaxLagSeconds,
+		Status: drdomain.StatusConfiguring, Health: drdomain.LinkHealth{GTIDGap: -1, LagSeconds: -1}, CreatedAt: now, UpdatedAt: now,
+	}
+	if link.Name == "" {
+		link.Name = req.SourceCluster + " -> " + req.TargetCluster
+	}
+	if link.MaxLagSeconds == 0 {
+		link.MaxLagSeconds = drdomain.DefaultMaxLagSeconds
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "dr_link_setup", "建立容灾链路 "+link.Name, req.TargetCluster)
+	if err != nil {
+		return drdomain.Link{}, err
+	}
+	link.LastTaskID = parent.Task.ID
+	if err := s.repo.SaveLink(ctx, link); err != nil {
+		return drdomain.Link{}, err
+	}
+	s.acquire(link.ID)
+	go s.runSetup(context.Background(), link)
+	return link, nil
+}
+
+func (s *DRService) runSetup(ctx context.Context, link drdomain.Link) {
+	defer s.release(link.ID)
+	parentID := link.LastTaskID
+	created, failed := 0, 0
+	taskIDs, err := s.setupLink(ctx, &link, parentID)
+	created += len(taskIDs)
+	if err != nil {
+		failed++
+		link.Status = drdomain.StatusFailed
+		link.LastError = err.Error()
+	} else {
+		link.Status = drdomain.StatusRunning
+		link.LastError = ""
+	}
+	link.UpdatedAt = time.Now().UTC()
+	_ = s.repo.SaveLink(ctx, link)
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, parentID, created, failed)
+	if err == nil {
+		time.Sleep(drSetupSettleDelay)
+		if _, err := s.checkLink(ctx, link.ID, parentID); err != nil {
+			log.Printf("dr link %s initial check: %v", link.ID, err)
+		}
+	}
+}
+
+// setupLink attaches the DR primary only when it holds no transactions the
+// source lacks and the source still has every binlog it needs.
+func (s *DRService) setupLink(ctx context.Context, link *drdomain.Link, parentID string) ([]string, error) {
+	targetNodes, taskIDs, err := s.probeCluster(ctx, link.TargetClusterID, link.TargetPort, parentID)
+	if err != nil {
+		return taskIDs, err
+	}
+	target, err := drTargetPrimary(targetNodes)
+	if err != nil {
+		return taskIDs, fmt.Errorf("容灾集群 %s: %w", link.TargetClusterID, err)
+	}
+	sourceNodes, sourceTasks, err := s.probeCluster(ctx, link.SourceClusterID, link.SourcePort, parentID)
+	taskIDs = append(taskIDs, sourceTasks...)
+	if err != nil {
+		return taskIDs, err
+	}
+	source, err := drSourcePrimary(sourceNodes)
+	if err != nil {
+		return taskIDs, fmt.Errorf("源集群 %s: %w", link.SourceClusterID, err)
+	}
+	if err := drValidateSeed(source, target); err != nil {
+		return taskIDs, err
+	}
+	link.TargetMachineID, link.TargetHost, link.TargetPort = target.machine.ID, target.machine.IP, target.instance.Port
+	link.SourceMachineID = source.machine.ID
+	if link.SourcePort == 0 {
+		link.SourcePort = source.instance.Port
+	}
+	if link.SourceMode == drdomain.SourceModeVIP {
+		vip, err := s.sourceVIP(ctx, link.SourceClusterID)
+		if err != nil {
+			return taskIDs, err
+		}
+		link.SourceHost = vip
+	} else {
+		link.SourceHost = source.machine.IP
+	}
+	taskID, err := s.attachChannel(ctx, *link, target.machine, parentID)
+	if taskID != "" {
+		taskIDs = append(taskIDs, taskID)
+	}
+	return taskIDs, err
+}
+
+func (s *DRService) attachChannel(ctx context.Context, link drdomain.Link, target machinedomain.Machine, parentID string) (string, error) {
+	user, password := s.ha.architectureManagementAccount(ctx)
+	command := drAttachCommand(link, user, password, s.replicationTLS(ctx, link.TargetMachineID, link.TargetPort))
+	// The command carries the replication password; RunExecTask redacts it.
+	taskID, _, err := s.tasks.RunExecTask(ctx, target.IP, command, ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "dr_link_attach", DisplayName: "配置容灾复制通道 " + target.Name,
+		StepName: "CHANGE REPLICATION SOURCE FOR CHANNEL " + drdomain.ChannelName, Port: link.TargetPort,
+	}, drConfigureTimeout)
+	return taskID, err
+}
+
+func (s *DRService) replicationTLS(ctx context.Context, machineID string, port int) taskusecase.ReplicationTLS {
+	if s.tls == nil {
+		return taskusecase.ReplicationTLS{}
+	}
+	tls, _ := s.tls.ReplicationSourceTLS(ctx, machineID, port)
+	return tls
+}
+
+// CheckLink refreshes the link health now.
+func (s *DRService) CheckLink(ctx context.Context, id string) (drdomain.Link, error) {
+	return s.checkLink(ctx, id, "")
+}
+
+func (s *DRService) checkLink(ctx context.Context, id, parentID string) (drdomain.Link, error) {
+	if !s.acquire(id) {
+		link, _, err := s.repo.GetLink(ctx, id)
+		if err != nil {
+			return drdomain.Link{}, err
+		}
+		return link, errors.New("容灾链路正在执行其他操作")
+	}
+	defer s.release(id)
+	link, ok, err := s.repo.GetLink(ctx, id)
+	if err != nil {
+		return drdomain.Link{}, err
+	}
+	if !ok {
+		return drdomain.Link{}, errors.New("容灾链路不存在")
+	}
+	if link.Status != drdomain.StatusRunning {
+		return link, fmt.Errorf("容灾链路状态为 %s，无需检查", link.Status)
+	}
+	state, err := s.targetState(ctx, link, parentID)
+	if err != nil {
+		link.Health.Healthy = false
+		link.Health.LastError = err.Error()
+		now := time.Now().UTC()
+		link.Health.CheckedAt = &now
+		link.UpdatedAt = now
+		_ = s.repo.SaveLink(ctx, link)
+		s.signalHealth(ctx, link)
+		return link, err
+	}
+	link.Health = drHealthFromState(state, link.MaxLagSeconds, time.Now().UTC())
+	if link.SourceMode == drdomain.SourceModePrimary && (!state.sourceReachable || state.sourceReadOnly) {
+		if err := s.followSourcePrimary(ctx, &link, parentID); err != nil {
+			link.Health.LastError = strings.TrimSpace(link.Health.LastError + "; " + err.Error())
+		}
+	}
+	link.UpdatedAt = time.Now().UTC()
+	if err := s.repo.SaveLink(ctx, link); err != nil {
+		return link, err
+	}
+	s.signalHealth(ctx, link)
+	return link, nil
+}
+
+// followSourcePrimary re-points the DR channel after a switchover or
+// failover in the source cluster. GTID auto-positioning makes this safe.
+func (s *DRService) followSourcePrimary(ctx context.Context, link *drdomain.Link, parentID string) error {
+	nodes, _, err := s.probeCluster(ctx, link.SourceClusterID, link.SourcePort, parentID)
+	if err != nil {
+		return err
+	}
+	source, err := drSourcePrimary(nodes)
+	if err != nil {
+		return err
+	}
+	if source.machine.ID == link.SourceMachineID && source.machine.IP == link.SourceHost {
+		return nil
+	}
+	target, ok, err := s.machines.GetByID(ctx, link.TargetMachineID)
+	if err != nil || !ok {
+		return fmt.Errorf("容灾主库 %s 不存在", link.TargetMachineID)
+	}
+	previous := link.SourceHost
+	next := *link
+	next.SourceMachineID, next.SourceHost, next.SourcePort = source.machine.ID, source.machine.IP, source.instance.Port
+	taskID, err := s.attachChannel(ctx, next, target, parentID)
+	if err != nil {
+		return err
+	}
+	*link = next
+	link.LastTaskID = taskID
+	log.Printf("dr link %s now follows %s (was %s)", link.ID, link.SourceHost, previous)
+	return nil
+}
+
+func (s *DRService) signalHealth(ctx context.Context, link drdomain.Link) {
+	if s.alerts == nil {
+		return
+	}
+	target, _, _ := s.machines.GetByID(ctx, link.TargetMachineID)
+	signal := AlertSignal{
+		RuleID: drHealthRuleID, RuleName: "容灾链路异常", Metric: "dr_link_lag_seconds", Category: "dr",
+		MachineID: link.TargetMachineID, MachineName: target.Name, MachineIP: link.TargetHost, ClusterID: link.TargetClusterID,
+		Labels: map[string]string{"dr_link": link.ID, "mysql_port": strconv.Itoa(link.TargetPort)},
+		Value:  float64(link.Health.LagSeconds), Threshold: float64(link.MaxLagSeconds), Operator: ">",
+	}
+	if link.Status != drdomain.StatusRunning || link.Health.Healthy {
+		_ = s.alerts.ResolveSignal(ctx, signal)
+		return
+	}
+	signal.Severity = alertdomain.SeverityWarning
+	signal.Message = fmt.Sprintf("容灾链路 %s 延迟 %d 秒，GTID 差距 %d 个事务", link.Name, link.Health.LagSeconds, link.Health.GTIDGap)
+	if !link.Health.IORunning || !link.Health.SQLRunning {
+		signal.Severity = alertdomain.SeverityCritical
+		signal.Message = fmt.Sprintf("容灾链路 %s 复制中断：%s", link.Name, link.Health.LastError)
+	}
+	_ = s.alerts.RaiseSignal(ctx, signal)
+}
+
+func (s *DRService) targetState(ctx context.Context, link drdomain.Link, parentID string) (drTargetState, error) {
+	target, ok, err := s.machines.GetByID(ctx, link.TargetMachineID)
+	if err != nil {
+		return drTargetState{}, err
+	}
+	if !ok {
+		return drTargetState{}, fmt.Errorf("容灾主库 %s 不存在", link.TargetMachineID)
+	}
+	user, password := s.ha.architectureManagementAccount(ctx)
+	_, output, err := s.tasks.RunExecTask(ctx, target.IP, drStateCommand(link, user, password), ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "dr_link_check", DisplayName: "检查容灾链路 " + link.Name,
+		StepName: "读取容灾通道状态与源端 GTID", Port: link.TargetPort,
+	}, drProbeTimeout)
+	if err != nil {
+		return drTargetState{}, err
+	}
+	return parseDRTargetState(output)
+}
+
+// Promote turns the DR cluster into the writer. It returns the promotion
+// record immediately; progress is tracked on the parent task.
+func (s *DRService) Promote(ctx context.Context, id string, req DRPromoteRequest) (drdomain.Promotion, error) {
+	link, ok, err := s.repo.GetLink(ctx, id)
+	if err != nil {
+		return drdomain.Promotion{}, err
+	}
+	if !ok {
+		return drdomain.Promotion{}, errors.New("容灾链路不存在")
+	}
+	if strings.TrimSpace(req.Confirm) != link.TargetClusterID {
+		return drdomain.Promotion{}, fmt.Errorf("请在 confirm 中填写容灾集群名 %s 以确认提升", link.TargetClusterID)
+	}
+	if link.Status != drdomain.StatusRunning {
+		return drdomain.Promotion{}, fmt.Errorf("容灾链路状态为 %s，不能提升", link.Status)
+	}
+	if req.CatchUpTimeoutSeconds <= 0 {
+		req.CatchUpTimeoutSeconds = drdomain.DefaultCatchUpTimeoutSeconds
+	}
+	if !s.acquire(link.ID) {
+		return drdomain.Promotion{}, errors.New("容灾链路正在执行其他操作")
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "dr_promote", "提升容灾集群 "+link.TargetClusterID, link.TargetClusterID)
+	if err != nil {
+		s.release(link.ID)
+		return drdomain.Promotion{}, err
+	}
+	promotion := drdomain.Promotion{
+		ID: newEntityID("drp"), LinkID: link.ID, SourceClusterID: link.SourceClusterID, TargetClusterID: link.TargetClusterID,
+		Status: drdomain.PromotionRunning, Force: req.Force, Reverse: req.Reverse, MissingTransactions: -1, RPOSeconds: -1,
+		TaskID: parent.Task.ID, StartedAt: time.Now().UTC(),
+	}
+	if err := s.repo.SavePromotion(ctx, promotion); err != nil {
+		s.release(link.ID)
+		return drdomain.Promotion{}, err
+	}
+	link.Status = drdomain.StatusPromoting
+	link.UpdatedAt = time.Now().UTC()
+	if err := s.repo.SaveLink(ctx, link); err != nil {
+		s.release(link.ID)
+		return drdomain.Promotion{}, err
+	}
+	go s.runPromotion(context.Background(), link, promotion, req)
+	return promotion, nil
+}
+
+func (s *DRService) runPromotion(ctx context.Context, link drdomain.Link, promotion drdomain.Promotion, req DRPromoteRequest) {
+	defer s.release(link.ID)
+	created := 0
+	step := func(message string) {
+		promotion.Steps = append(promotion.Steps, time.Now().UTC().Format(time.RFC3339)+" "+message)
+		_ = s.repo.SavePromotion(ctx, promotion)
+	}
+	fail := func(err error, restoreLink bool) {
+		finished := time.Now().UTC()
+		promotion.Status, promotion.Error, promotion.FinishedAt = drdomain.PromotionFailed, err.Error(), &finished
+		_ = s.repo.SavePromotion(ctx, promotion)
+		if restoreLink {
+			link.Status = drdomain.StatusRunning
+		} else {
+			link.Status = drdomain.StatusFailed
+		}
+		link.LastError, link.UpdatedAt = err.Error(), finished
+		_ = s.repo.SaveLink(ctx, link)
+		_ = s.tasks.FinalizeBatchTrackingTask(ctx, promotion.TaskID, created, 1)
+	}
+	target, ok, err := s.machines.GetByID(ctx, link.TargetMachineID)
+	if err != nil || !ok {
+		fail(fmt.Errorf("容灾主库 %s 不存在", link.TargetMachineID), true)
+		return
+	}
+	state, err := s.targetState(ctx, link, promotion.TaskID)
+	created++
+	if err != nil {
+		fail(fmt.Errorf("读取容灾主库状态失败: %w", err), true)
+		return
+	}
+	promotion.SourceReachable = state.sourceReachable
+	var source *drNode
+	if state.sourceReachable {
+		step("源端可达，先将源集群主库设为只读，阻止新写入")
+		nodes, taskIDs, err := s.probeCluster(ctx, link.SourceClusterID, link.SourcePort, promotion.TaskID)
+		created += len(taskIDs)
+		if err == nil {
+			var primary drNode
+			if primary, err = drSourcePrimary(nodes); err == nil {
+				source = &primary
+			}
+		}
+		if err != nil {
+			fail(fmt.Errorf("源集群主库识别失败，无法安全隔离: %w", err), true)
+			return
+		}
+		_, output, err := s.tasks.RunExecTask(ctx, source.machine.IP, drFenceCommand(source.instance.Port, true), ExecTaskOptions{
+			ParentTaskID: promotion.TaskID, Operation: "dr_fence_source", DisplayName: "隔离源集群主库 " + source.machine.Name,
+			StepName: "SET GLOBAL super_read_only=ON", Port: source.instance.Port,
+		}, drProbeTimeout)
+		created++
+		if err != nil {
+			fail(fmt.Errorf("源集群主库设为只读失败: %w", err), true)
+			return
+		}
+		state.sourceExecuted = drParseFencedGTID(output)
+		step("等待容灾主库追平源端最终 GTID")
+		caughtUp, err := s.waitForGTID(ctx, link, target, state.sourceExecuted, req.CatchUpTimeoutSeconds, promotion.TaskID)
+		created++
+		if (err != nil || !caughtUp) && !req.Force {
+			_, _, _ = s.tasks.RunExecTask(ctx, source.machine.IP, drFenceCommand(source.instance.Port, false), ExecTaskOptions{
+				ParentTaskID: promotion.TaskID, Operation: "dr_unfence_source", DisplayName: "恢复源集群主库写入 " + source.machine.Name,
+				StepName: "SET GLOBAL read_only=OFF", Port: source.instance.Port,
+			}, drProbeTimeout)
+			created++
+			if err == nil {
+				err = fmt.Errorf("%d 秒内未追平源端", req.CatchUpTimeoutSeconds)
+			}
+			fail(fmt.Errorf("容灾主库追赶失败，已恢复源端写入：%w；确认可接受数据丢失时使用 force", err), true)
+			return
+		}
+	} else {
+		if !req.Force {
+			fail(errors.New("源端不可达，无法确认数据完整性；确认接受数据丢失后使用 force=true 提升"), true)
+			return
+		}
+		step("源端不可达，强制提升：等待已接收的中继日志应用完成")
+		if state.received != "" {
+			_, _ = s.waitForGTID(ctx, link, target, state.received, req.CatchUpTimeoutSeconds, promotion.TaskID)
+			created++
+		}
+		state.sourceExecuted = link.Health.SourceGTIDSet
+	}
+	if final, err := s.targetState(ctx, link, promotion.TaskID); err == nil {
+		created++
+		state.executed, state.lastApplied, state.lastAppliedAt = final.executed, final.lastApplied, final.lastAppliedAt
+	}
+	step("断开容灾复制通道并开放容灾主库写入")
+	_, _, err = s.tasks.RunExecTask(ctx, target.IP, drDetachCommand(link.TargetPort, true), ExecTaskOptions{
+		ParentTaskID: promotion.TaskID, Operation: "dr_promote_target", DisplayName: "提升容灾主库 " + target.Name,
+		StepName: "RESET REPLICA ALL FOR CHANNEL " + drdomain.ChannelName, Port: link.TargetPort,
+	}, drConfigureTimeout)
+	created++
+	if err != nil {
+		fail(fmt.Errorf("提升容灾主库失败: %w", err), false)
+		return
+	}
+	drApplyRPO(&promotion, state, time.Now().UTC())
+	link.Status = drdomain.StatusPromoted
+	link.LastError = ""
+	if req.Reverse {
+		if source == nil {
+			step("源端不可达，跳过反向复制；源集群恢复后请新建反向链路")
+		} else if reverse, taskID, err := s.reverseLink(ctx, link, *source, promotion.TaskID); err != nil {
+			step("反向复制配置失败: " + err.Error())
+			created++
+		} else {
+			created++
+			promotion.ReverseLinkID = reverse.ID
+			step("已将原源集群主库配置为新容灾副本，任务 " + taskID)
+		}
+	}
+	finished := time.Now().UTC()
+	promotion.Status, promotion.FinishedAt = drdomain.PromotionSucceeded, &finished
+	_ = s.repo.SavePromotion(ctx, promotion)
+	link.UpdatedAt = finished
+	_ = s.repo.SaveLink(ctx, link)
+	s.signalHealth(ctx, link)
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, promotion.TaskID, created, 0)
+}
+
+func (s *DRService) waitForGTID(ctx context.Context, link drdomain.Link, target machinedomain.Machine, gtidSet string, timeoutSeconds int, parentID string) (bool, error) {
+	if strings.TrimSpace(gtidSet) == "" {
+		return true, nil
+	}
+	sql := fmt.Sprintf("SELECT '%s', WAIT_FOR_EXECUTED_GTID_SET(%s, %d);", drWaitMarker, sqlLiteral(gtidSet), timeoutSeconds)
+	_, output, err := s.tasks.RunExecTask(ctx, target.IP, mysqlArchitectureCommand("", link.TargetPort, sql), ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "dr_wait_gtid", DisplayName: "等待容灾主库追平 " + target.Name,
+		StepName: "WAIT_FOR_EXECUTED_GTID_SET", Port: link.TargetPort,
+	}, time.Duration(timeoutSeconds)*time.Second+drProbeTimeout)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) == 2 && fields[0] == drWaitMarker {
+			return fields[1] == "0", nil
+		}
+	}
+	return false, errors.New("未读取到 WAIT_FOR_EXECUTED_GTID_SET 结果")
+}
+
+// reverseLink makes the fenced former source primary replicate from the new
+// writer so the original cluster can later be promoted back.
+func (s *DRService) reverseLink(ctx context.Context, link drdomain.Link, source drNode, parentID string) (drdomain.Link, string, error) {
+	now := time.Now().UTC()
+	reverse := drdomain.Link{
+		ID: newEntityID("dr"), Name: link.TargetClusterID + " -> " + link.SourceClusterID,
+		SourceClusterID: link.TargetClusterID, TargetClusterID: link.SourceClusterID, SourceMode: drdomain.SourceModePrimary,
+		SourceHost: link.TargetHost, SourcePort: link.TargetPort, SourceMachineID: link.TargetMachineID,
+		TargetMachineID: source.machine.ID, TargetHost: source.machine.IP, TargetPort: source.instance.Port,
+		MaxLagSeconds: link.MaxLagSeconds, ReversedFrom: link.ID, Status: drdomain.StatusRunning,
+		Health: drdomain.LinkHealth{GTIDGap: -1, LagSeconds: -1}, CreatedAt: now, UpdatedAt: now,
+	}
+	taskID, err := s.attachChannel(ctx, reverse, source.machine, parentID)
+	if err != nil {
+		return drdomain.Link{}, taskID, err
+	}
+	reverse.LastTaskID = taskID
+	return reverse, taskID, s.repo.SaveLink(ctx, reverse)
+}
+
+// DeleteLink detaches the DR channel (the DR primary stays read-only) and
+// forgets the link.
+func (s *DRService) DeleteLink(ctx context.Context, id string) error {
+	if !s.acquire(id) {
+		return errors.New("容灾链路正在执行其他操作")
+	}
+	defer s.release(id)
+	link, ok, err := s.repo.GetLink(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("容灾链路不存在")
+	}
+	if link.Status == drdomain.StatusRunning && link.TargetMachineID != "" {
+		target, found, err := s.machines.GetByID(ctx, link.TargetMachineID)
+		if err != nil {
+			return err
+		}
+		if found {
+			if _, _, err := s.tasks.RunExecTask(ctx, target.IP, drDetachCommand(link.TargetPort, false), ExecTaskOptions{
+				Operation: "dr_link_detach", DisplayName: "删除容灾复制通道 " + target.Name,
+				StepName: "RESET REPLICA ALL FOR CHANNEL " + drdomain.ChannelName, Port: link.TargetPort,
+			}, drConfigureTimeout); err != nil {
+				return fmt.Errorf("删除容灾复制通道失败: %w", err)
+			}
+		}
+	}
+	link.Status = drdomain.StatusPromoted
+	s.signalHealth(ctx, link)
+	return s.repo.DeleteLink(ctx, id)
+}
+
+func (s *DRService) sourceVIP(ctx context.Context, clusterID string) (string, error) {
+	vips, err := s.ha.ListVIPConfigs(ctx, clusterID)
+	if err != nil {
+		return "", err
+	}
+	for _, vip := range vips {
+		if vip.Enabled && strings.TrimSpace(vip.VIPAddress) != "" {
+			return strings.TrimSpace(vip.VIPAddress), nil
+		}
+	}
+	return "", fmt.Errorf("源集群 %s 没有启用的 VIP，请改用 source_mode=primary", clusterID)
+}
+
+func (s *DRService) clusterMachines(ctx context.Context, clusterID string) ([]machinedomain.Machine, error) {
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]machinedomain.Machine, 0)
+	for _, machine := range machines {
+		if machine.Cluster == clusterID {
+			out = append(out, machine)
+		}
+	}
+	return out, nil
+}
+
+// probeCluster reads role and GTID state of every running instance in the
+// cluster. Unreachable instances are skipped.
+func (s *DRService) probeCluster(ctx context.Context, clusterID string, port int, parentID string) ([]drNode, []string, error) {
+	machines, err := s.clusterMachines(ctx, clusterID)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]machinedomain.Machine, len(machines))
+	for _, machine := range machines {
+		byID[machine.ID] = machine
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].MachineID == instances[j].MachineID {
+			return instances[i].Port < instances[j].Port
+		}
+		return instances[i].MachineID < instances[j].MachineID
+	})
+	nodes := make([]drNode, 0)
+	var taskIDs []string
+	for _, instance := range instances {
+		machine, ok := byID[instance.MachineID]
+		if !ok || (port > 0 && instance.Port != port) || instance.Status == mysqlapp.StatusStopped {
+			continue
+		}
+		taskID, output, err := s.tasks.RunExecTask(ctx, machine.IP, mysqlArchitectureCommand("", instance.Port, drNodeSQL()), ExecTaskOptions{
+			ParentTaskID: parentID, Operation: "dr_topology_probe", DisplayName: "探测容灾角色 " + machine.Name,
+			StepName: "读取 read_only、复制通道与 GTID", Port: instance.Port,
+		}, drProbeTimeout)
+		if taskID != "" {
+			taskIDs = append(taskIDs, taskID)
+		}
+		if err != nil {
+			continue
+		}
+		if node, ok := parseDRNode(output); ok {
+			node.machine, node.instance = machine, instance
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, taskIDs, fmt.Errorf("集群 %s 没有可探测的 MySQL 实例", clusterID)
+	}
+	return nodes, taskIDs, nil
+}
+
+func drLinkActive(link drdomain.Link) bool {
+	switch link.Status {
+	case drdomain.StatusConfiguring, drdomain.StatusRunning, drdomain.StatusPromoting:
+		return true
+	}
+	return false
+}
+
+func drNodeSQL() string {
+	return fmt.Sprintf("SELECT '%s', @@global.read_only, @@global.super_read_only, "+
+		"(SELECT COUNT(*) FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME<>'%s'), "+
+		"CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', '')), CONCAT('purged:', REPLACE(@@global.gtid_purged, '\\n', ''));",
+		drNodeMarker, drdomain.ChannelName)
+}
+
+func parseDRNode(output string) (drNode, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 6 || fields[0] != drNodeMarker {
+			continue
+		}
+		channels, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return drNode{}, false
+		}
+		return drNode{
+			readOnly: fields[1] == "1", superReadOnly: fields[2] == "1", channels: channels,
+			executed: strings.TrimPrefix(fields[4], "gtid:"), purged: strings.TrimPrefix(fields[5], "purged:"),
+		}, true
+	}
+	return drNode{}, false
+}
+
+// drTargetPrimary is the DR cluster node that does not replicate from any
+// in-cluster source; it may already be read-only.
+func drTargetPrimary(nodes []drNode) (drNode, error) {
+	candidates := make([]drNode, 0, 1)
+	for _, node := range nodes {
+		if node.channels == 0 {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) != 1 {
+		return drNode{}, fmt.Errorf("需要恰好一个不从集群内复制的主库，当前识别到 %d 个", len(candidates))
+	}
+	return candidates[0], nil
+}
+
+func drSourcePrimary(nodes []drNode) (drNode, error) {
+	candidates := make([]drNode, 0, 1)
+	for _, node := range nodes {
+		if node.channels == 0 && !node.readOnly && !node.superReadOnly {
+			candidates = append(candidates, node)
+		}
+	}
+	if len(candidates) != 1 {
+		return drNode{}, fmt.Errorf("需要恰好一个可写主库，当前识别到 %d 个", len(candidates))
+	}
+	return candidates[0], nil
+}
+
+// drValidateSeed rejects errant transactions on the DR primary and sources
+// that already purged binlogs the DR primary still needs.
+func drValidateSeed(source, target drNode) error {
+	sourceSet, err := mysqlapp.ParseGTIDSet(source.executed)
+	if err != nil {
+		return err
+	}
+	targetSet, err := mysqlapp.ParseGTIDSet(target.executed)
+	if err != nil {
+		return err
+	}
+	purged, err := mysqlapp.ParseGTIDSet(source.purged)
+	if err != nil {
+		return err
+	}
+	if errant := targetSet.Subtract(sourceSet); errant.Count() > 0 {
+		return fmt.Errorf("容灾主库存在源端没有的事务 %s，请先用源端备份重建容灾集群", errant)
+	}
+	if missing := purged.Subtract(targetSet); missing.Count() > 0 {
+		return fmt.Errorf("源端已清理容灾主库缺少的 binlog（%s），请先用源端备份重建容灾集群", missing)
+	}
+	return nil
+}
+
+func drAttachCommand(link drdomain.Link, user, password string, tls taskusecase.ReplicationTLS) string {
+	client := mysqlArchitectureClient("", link.TargetPort)
+	channel := sqlLiteral(drdomain.ChannelName)
+	modernTLS, legacyTLS := architectureReplicationTLSClause(tls, "SOURCE"), architectureReplicationTLSClause(tls, "MASTER")
+	modern := fmt.Sprintf("CHANGE REPLICATION SOURCE TO SOURCE_HOST=%s,SOURCE_PORT=%d,SOURCE_USER=%s,SOURCE_PASSWORD=%s,SOURCE_AUTO_POSITION=1,SOURCE_CONNECT_RETRY=10,SOURCE_RETRY_COUNT=86400,GET_SOURCE_PUBLIC_KEY=1%s FOR CHANNEL %s; START REPLICA FOR CHANNEL %s; SET GLOBAL super_read_only=ON;",
+		sqlLiteral(link.SourceHost), link.SourcePort, sqlLiteral(user), sqlLiteral(password), modernTLS, channel, channel)
+	legacy := fmt.Sprintf("CHANGE MASTER TO MASTER_HOST=%s,MASTER_PORT=%d,MASTER_USER=%s,MASTER_PASSWORD=%s,MASTER_AUTO_POSITION=1,MASTER_CONNECT_RETRY=10,MASTER_RETRY_COUNT=86400%s FOR CHANNEL %s; START SLAVE FOR CHANNEL %s; SET GLOBAL super_read_only=ON;",
+		sqlLiteral(link.SourceHost), link.SourcePort, sqlLiteral(user), sqlLiteral(password), legacyTLS, channel, channel)
+	stop := "(" + client + " --execute=" + shellQuote("STOP REPLICA FOR CHANNEL "+channel) + " >/dev/null 2>&1 || " +
+		client + " --execute=" + shellQuote("STOP SLAVE FOR CHANNEL "+channel) + " >/dev/null 2>&1 || true); "
+	return "set -e; " + stop + "(" + client + " --execute=" + shellQuote(modern) + " 2>/dev/null || " + client + " --execute=" + shellQuote(legacy) + ")"
+}
+
+// drDetachCommand removes the DR channel. When promote is set the DR primary
+// also becomes writable.
+func drDetachCommand(port int, promote bool) string {
+	client := mysqlArchitectureClient("", port)
+	channel := sqlLiteral(drdomain.ChannelName)
+	modern := fmt.Sprintf("STOP REPLICA FOR CHANNEL %s; RESET REPLICA ALL FOR CHANNEL %s;", channel, channel)
+	legacy := fmt.Sprintf("STOP SLAVE FOR CHANNEL %s; RESET SLAVE ALL FOR CHANNEL %s;", channel, channel)
+	command := "set -e; (" + client + " --execute=" + shellQuote(modern) + " 2>/dev/null || " + client + " --execute=" + shellQuote(legacy) + ")"
+	if promote {
+		command += "; " + client + " --execute=" + shellQuote("SET GLOBAL super_read_only=OFF; SET GLOBAL read_only=OFF;")
+	}
+	return command
+}
+
+// drFenceCommand toggles writes on the source primary and prints its final
+// gtid_executed once fenced.
+func drFenceCommand(port int, fence bool) string {
+	if !fence {
+		return mysqlArchitectureCommand("", port, "SET GLOBAL super_read_only=OFF; SET GLOBAL read_only=OFF;")
+	}
+	return mysqlArchitectureCommand("", port, fmt.Sprintf("SET GLOBAL super_read_only=ON; SELECT '%s', CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', ''));", drSourceMarker))
+}
+
+func drParseFencedGTID(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) == 2 && fields[0] == drSourceMarker {
+			return strings.TrimPrefix(fields[1], "gtid:")
+		}
+	}
+	return ""
+}
+
+// drStateCommand runs on the DR primary. Besides the local channel state it
+// reads the source endpoint through the replication account, so the check
+// measures the same network path the channel uses.
+func drStateCommand(link drdomain.Link, user, password string) string {
+	client := mysqlArchitectureClient("", link.TargetPort)
+	channel := sqlLiteral(drdomain.ChannelName)
+	state := fmt.Sprintf("SELECT '%s', CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', '')), "+
+		"CONCAT('received:', IFNULL((SELECT REPLACE(RECEIVED_TRANSACTION_SET, '\\n', '') FROM performance_schema.replication_connection_status WHERE CHANNEL_NAME=%s), ''));",
+		drStateMarker, channel)
+	applied := fmt.Sprintf("SELECT '%s', CONCAT('trx:', LAST_APPLIED_TRANSACTION), UNIX_TIMESTAMP(LAST_APPLIED_TRANSACTION_ORIGINAL_COMMIT_TIMESTAMP) "+
+		"FROM performance_schema.replication_applier_status_by_worker WHERE CHANNEL_NAME=%s ORDER BY LAST_APPLIED_TRANSACTION_END_APPLY_TIMESTAMP DESC LIMIT 1;",
+		drAppliedMarker, channel)
+	source := fmt.Sprintf("MYSQL_PWD=%s mysql --protocol=tcp --host=%s --port=%d --user=%s --connect-timeout=5 --batch --raw --skip-column-names --execute=%s",
+		shellQuote(password), shellQuote(link.SourceHost), link.SourcePort, shellQuote(user),
+		shellQuote(fmt.Sprintf("SELECT '%s', @@global.read_only, CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', ''));", drSourceMarker)))
+	return client + " --batch --raw --skip-column-names --execute=" + shellQuote(state) + "; " +
+		"(" + client + " --execute=" + shellQuote("SHOW REPLICA STATUS FOR CHANNEL "+channel+"\\G") + " 2>/dev/null || " +
+		client + " --execute=" + shellQuote("SHOW SLAVE STATUS FOR CHANNEL "+channel+"\\G") + " 2>/dev/null || true); " +
+		"(" + client + " --batch --raw --skip-column-names --execute=" + shellQuote(applied) + " 2>/dev/null || true); " +
+		"(" + source + " 2>/dev/null || echo " + drSourceDownMarker + ")"
+}
+
+func parseDRTargetState(output string) (drTargetState, error) {
+	state := drTargetState{lagSeconds: -1}
+	status := map[string]string{}
+	found := false
+	for _, raw := range strings.Split(output, "\n") {
+		line := strings.TrimSpace(raw)
+		fields := strings.Split(line, "\t")
+		switch {
+		case len(fields) == 3 && fields[0] == drStateMarker:
+			found = true
+			state.executed = strings.TrimPrefix(fields[1], "gtid:")
+			state.received = strings.TrimPrefix(fields[2], "received:")
+		case len(fields) == 3 && fields[0] == drAppliedMarker:
+			state.lastApplied = strings.TrimPrefix(fields[1], "trx:")
+			if seconds, err := strconv.ParseFloat(fields[2], 64); err == nil && seconds > 0 {
+				at := time.Unix(int64(seconds), int64((seconds-float64(int64(seconds)))*1e9)).UTC()
+				state.lastAppliedAt = &at
+			}
+		case len(fields) == 3 && fields[0] == drSourceMarker:
+			state.sourceReachable = true
+			state.sourceReadOnly = fields[1] == "1"
+			state.sourceExecuted = strings.TrimPrefix(fields[2], "gtid:")
+		case line == drSourceDownMarker:
+			state.sourceReachable = false
+		default:
+			if key, value, ok := strings.Cut(line, ": "); ok && !strings.Contains(key, " ") {
+				status[key] = strings.TrimSpace(value)
+			} else if key, ok := strings.CutSuffix(line, ":"); ok && !strings.Contains(key, " ") {
+				status[key] = ""
+			}
+		}
+	}
+	if !found {
+		return state, errors.New("未读取到容灾主库状态")
+	}
+	pick := func(keys ...string) (string, bool) {
+		for _, key := range keys {
+			if value, ok := status[key]; ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	io, ok := pick("Replica_IO_Running", "Slave_IO_Running")
+	state.channelFound = ok
+	state.ioRunning = strings.EqualFold(io, "Yes")
+	sqlRunning, _ := pick("Replica_SQL_Running", "Slave_SQL_Running")
+	state.sqlRunning = strings.EqualFold(sqlRunning, "Yes")
+	if lag, _ := pick("Seconds_Behind_Source", "Seconds_Behind_Master"); lag != "" && lag != "NULL" {
+		state.lagSeconds, _ = strconv.ParseInt(lag, 10, 64)
+	}
+	state.sourceHost, _ = pick("Source_Host", "Master_Host")
+	errorsSeen := make([]string, 0, 2)
+	for _, key := range []string{"Last_IO_Error", "Last_SQL_Error"} {
+		if value := status[key]; value != "" {
+			errorsSeen = append(errorsSeen, value)
+		}
+	}
+	if !state.channelFound {
+		errorsSeen = append(errorsSeen, "容灾复制通道 "+drdomain.ChannelName+" 不存在")
+	}
+	state.lastError = strings.Join(errorsSeen, "; ")
+	return state, nil
+}
+
+func drHealthFromState(state drTargetState, maxLagSeconds int, now time.Time) drdomain.LinkHealth {
+	health := drdomain.LinkHealth{
+		CheckedAt: &now, IORunning: state.ioRunning, SQLRunning: state.sqlRunning, LagSeconds: state.lagSeconds,
+		ExecutedGTIDSet: state.executed, ReceivedGTIDSet: state.received, SourceGTIDSet: state.sourceExecuted,
+		GTIDGap: -1, LastError: state.lastError,
+	}
+	if state.sourceReachable {
+		if gap, ok := drGTIDGap(state.sourceExecuted, state.executed); ok {
+			health.GTIDGap = gap.Count()
+		}
+	} else {
+		health.LastError = strings.TrimPrefix(health.LastError+"; 无法通过复制账号连接源端", "; ")
+	}
+	health.Healthy = state.ioRunning && state.sqlRunning && state.lagSeconds >= 0 && state.lagSeconds <= int64(maxLagSeconds)
+	return health
+}
+
+func drGTIDGap(source, executed string) (mysqlapp.GTIDSet, bool) {
+	sourceSet, err := mysqlapp.ParseGTIDSet(source)
+	if err != nil {
+		return nil, false
+	}
+	executedSet, err := mysqlapp.ParseGTIDSet(executed)
+	if err != nil {
+		return nil, false
+	}
+	return sourceSet.Subtract(executedSet), true
+}
+
+// drApplyRPO fills the recovery point. With the final source GTID set known
+// the missing transactions are exact; otherwise the last set observed by the
+// monitor is a lower bound and the time since the last applied commit is the
+// exposure window.
+func drApplyRPO(promotion *drdomain.Promotion, state drTargetState, now time.Time) {
+	promotion.LastAppliedGTIDSet = state.executed
+	promotion.LastAppliedTransaction = state.lastApplied
+	promotion.LastAppliedCommitAt = state.lastAppliedAt
+	if gap, ok := drGTIDGap(state.sourceExecuted, state.executed); ok && state.sourceExecuted != "" {
+		promotion.MissingGTIDSet = gap.String()
+		promotion.MissingTransactions = gap.Count()
+	}
+	promotion.RPOExact = promotion.SourceReachable && promotion.MissingTransactions == 0
+	switch {
+	case promotion.RPOExact:
+		promotion.RPOSeconds = 0
+	case state.lastAppliedAt != nil:
+		promotion.RPOSeconds = int64(now.Sub(*state.lastAppliedAt).Seconds())
+	case state.lagSeconds >= 0:
+		promotion.RPOSeconds = state.lagSeconds
+	}
+}
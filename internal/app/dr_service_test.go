@@ -0,0 +1,104 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	drdomain "gmha/internal/domain/dr"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const drTestUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func TestParseDRTargetStateReadsChannelAndSource(t *testing.T) {
+	output := strings.Join([]string{
+		drStateMarker + "\tgtid:" + drTestUUID + ":1-90\treceived:" + drTestUUID + ":1-95",
+		"*************************** 1. row ***************************",
+		"             Replica_IO_Running: Yes",
+		"            Replica_SQL_Running: Yes",
+		"          Seconds_Behind_Source: 12",
+		"                    Source_Host: 10.0.0.100",
+		"                  Last_IO_Error: ",
+		drAppliedMarker + "\ttrx:" + drTestUUID + ":90\t1785549600.250000",
+		drSourceMarker + "\t0\tgtid:" + drTestUUID + ":1-100",
+	}, "\n")
+	state, err := parseDRTargetState(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.channelFound || !state.ioRunning || !state.sqlRunning || state.lagSeconds != 12 || state.sourceHost != "10.0.0.100" {
+		t.Fatalf("unexpected channel state: %+v", state)
+	}
+	if !state.sourceReachable || state.sourceReadOnly || state.lastAppliedAt == nil || state.lastApplied != drTestUUID+":90" {
+		t.Fatalf("unexpected source/applied state: %+v", state)
+	}
+	health := drHealthFromState(state, 300, time.Now().UTC())
+	if !health.Healthy || health.GTIDGap != 10 {
+		t.Fatalf("expected a healthy link 10 transactions behind: %+v", health)
+	}
+
+	broken, err := parseDRTargetState(drStateMarker + "\tgtid:\treceived:\n" +
+		"Slave_IO_Running: Connecting\nSlave_SQL_Running: Yes\nSeconds_Behind_Master: NULL\nLast_IO_Error: error connecting to master\n" + drSourceDownMarker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	health = drHealthFromState(broken, 300, time.Now().UTC())
+	if health.Healthy || health.IORunning || health.GTIDGap != -1 || !strings.Contains(health.LastError, "error connecting") {
+		t.Fatalf("a connecting IO thread with an unreachable source must be unhealthy: %+v", health)
+	}
+	if _, err := parseDRTargetState("ERROR 2002 (HY000): Can't connect"); err == nil {
+		t.Fatal("missing state marker must be an error")
+	}
+}
+
+func TestDRAttachCommandUsesDedicatedChannel(t *testing.T) {
+	link := drdomain.Link{SourceHost: "10.0.0.100", SourcePort: 3306, TargetPort: 3307}
+	command := drAttachCommand(link, "mha", "secret", taskusecase.ReplicationTLS{CAPath: "/data/tls/ca.pem"})
+	for _, expected := range []string{
+		"SOURCE_HOST='\\''10.0.0.100'\\''", "SOURCE_AUTO_POSITION=1", "SOURCE_SSL_CA='\\''/data/tls/ca.pem'\\''", "FOR CHANNEL '\\''gmha_dr'\\''",
+		"START REPLICA FOR CHANNEL", "CHANGE MASTER TO MASTER_HOST", "MASTER_SSL=1", "super_read_only=ON", "--port=3307",
+	} {
+		if !strings.Contains(command, expected) {
+			t.Fatalf("attach command missing %q: %s", expected, command)
+		}
+	}
+	if strings.Contains(command, "RESET REPLICA ALL;") || strings.Contains(command, "FOR CHANNEL ''") {
+		t.Fatalf("attach must never touch the default channel: %s", command)
+	}
+	detach := drDetachCommand(3307, true)
+	if !strings.Contains(detach, "RESET REPLICA ALL FOR CHANNEL") || !strings.Contains(detach, "super_read_only=OFF") {
+		t.Fatalf("promotion must drop the channel and open writes: %s", detach)
+	}
+	if strings.Contains(drDetachCommand(3307, false), "read_only=OFF") {
+		t.Fatal("deleting a link must keep the DR primary read-only")
+	}
+}
+
+func TestDRValidateSeedRejectsErrantAndPurgedTransactions(t *testing.T) {
+	source := drNode{executed: drTestUUID + ":1-100", purged: drTestUUID + ":1-20"}
+	if err := drValidateSeed(source, drNode{executed: drTestUUID + ":1-50"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := drValidateSeed(source, drNode{executed: drTestUUID + ":1-50,aaaaaaaa-71ca-11e1-9e33-c80aa9429562:1"}); err == nil {
+		t.Fatal("errant transactions on the DR primary must be rejected")
+	}
+	if err := drValidateSeed(source, drNode{executed: ""}); err == nil || !strings.Contains(err.Error(), "binlog") {
+		t.Fatalf("an empty DR primary cannot replicate purged binlogs: %v", err)
+	}
+}
+
+func TestDRApplyRPO(t *testing.T) {
+	now := time.Date(2026, 8, 1, 10, 0, 0, 0, time.UTC)
+	appliedAt := now.Add(-42 * time.Second)
+	exact := drdomain.Promotion{SourceReachable: true}
+	drApplyRPO(&exact, drTargetState{executed: drTestUUID + ":1-100", sourceExecuted: drTestUUID + ":1-100", lastAppliedAt: &appliedAt, lagSeconds: 3}, now)
+	if !exact.RPOExact || exact.RPOSeconds != 0 || exact.MissingTransactions != 0 {
+		t.Fatalf("a drained source must report zero RPO: %+v", exact)
+	}
+	forced := drdomain.Promotion{MissingTransactions: -1, RPOSeconds: -1}
+	drApplyRPO(&forced, drTargetState{executed: drTestUUID + ":1-90", sourceExecuted: drTestUUID + ":1-95", lastAppliedAt: &appliedAt}, now)
+	if forced.RPOExact || forced.MissingTransactions != 5 || forced.MissingGTIDSet != drTestUUID+":91-95" || forced.RPOSeconds != 42 {
+		t.Fatalf("unexpected forced RPO: %+v", forced)
+	}
+}
@@ -0,0 +1,18 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// newEntityID 生成形如 prefix-<16 位十六进制> 的实体 ID，供没有专用 ID 规则的
+// 实体使用；随机源不可用时退回纳秒时间戳。
+func newEntityID(prefix string) string {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err == nil {
+		return prefix + "-" + hex.EncodeToString(suffix[:])
+	}
+	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+}
@@ -17,6 +17,7 @@ import (
 	machinedomain "gmha/internal/domain/machine"
 	taskdomain "gmha/internal/domain/task"
 	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
 )
 
 // HARepository 定义了高可用领域的仓储接口。
@@ -44,6 +45,8 @@ type HAService struct {
 	presets   MySQLAccountPresetRepository
 	vip       *VIPService
 	tasks     *TaskService
+	routes    ClusterRouteSynchronizer
+	tls       taskusecase.ReplicationTLSResolver
 }
 
 func NewHAService(repo HARepository, machines machinedomain.Repository, instances MySQLInstanceRepository, presets ...MySQLAccountPresetRepository) *HAService {
@@ -198,6 +201,19 @@ func (s *HAService) ConfigureArchitectureExecutor(tasks *TaskService) {
 	if recovery, ok := s.repo.(architectureRunRecoveryRepository); ok {
 		_ = recovery.MarkInterruptedArchitectureRuns(context.Background())
 	}
+	if recovery, ok := s.repo.(switchoverRecoveryRepository); ok {
+		_ = recovery.MarkInterruptedSwitchovers(context.Background())
+	}
+}
+
+// SetRouteSynchronizer 注册切换后需要同步的外部路由层（如 ProxySQL）。
+func (s *HAService) SetRouteSynchronizer(routes ClusterRouteSynchronizer) {
+	s.routes = routes
+}
+
+// SetReplicationTLSResolver 让架构部署按集群 TLS 策略为复制通道启用 SOURCE_SSL。
+func (s *HAService) SetReplicationTLSResolver(resolver taskusecase.ReplicationTLSResolver) {
+	s.tls = resolver
 }
 
 func (s *HAService) PlanFailover(ctx context.Context, clusterID string) (hadomain.FailoverEvent, error) {
@@ -0,0 +1,748 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	credentialdomain "gmha/internal/domain/credential"
+	agentusecase "gmha/internal/usecase/agent"
+	machineusecase "gmha/internal/usecase/machine"
+)
+
+const (
+	maxBulkOnboardTargets     = 1000
+	maxBulkOnboardConcurrency = 10
+	maxDiscoveryHosts         = 1024
+	discoveryConcurrency      = 64
+	defaultDiscoveryTimeout   = 800 * time.Millisecond
+)
+
+// 批量纳管目标的来源。
+const (
+	BulkOnboardSourceInventory = "inventory"
+	BulkOnboardSourceDiscovery = "discovery"
+)
+
+// BulkOnboardEntry 是纳管清单中的一台机器。
+type BulkOnboardEntry struct {
+	Name           string `json:"name"`
+	IP             string `json:"ip"`
+	SSHPort        int    `json:"ssh_port"`
+	CredentialName string `json:"credential_name"`
+	Cluster        string `json:"cluster,omitempty"`
+	PreserveAgent  bool   `json:"preserve_agent"`
+	PreserveMySQL  bool   `json:"preserve_mysql"`
+}
+
+// OnboardDiscoveryRequest 描述一次网段扫描：只做 TCP 建连与握手读取，不登录目标机。
+type OnboardDiscoveryRequest struct {
+	CIDR       string `json:"cidr"`
+	SSHPort    int    `json:"ssh_port"`
+	MySQLPorts []int  `json:"mysql_ports"`
+	TimeoutMS  int    `json:"timeout_ms"`
+}
+
+// DiscoveredMySQLListener 是扫描到的 mysqld 监听端口，Version 取自服务端握手包。
+type DiscoveredMySQLListener struct {
+	Port    int    `json:"port"`
+	Version string `json:"version,omitempty"`
+}
+
+// DiscoveredHost 是网段扫描发现的一台主机。
+type DiscoveredHost struct {
+	IP                  string                    `json:"ip"`
+	SSHReachable        bool                      `json:"ssh_reachable"`
+	SSHBanner           string                    `json:"ssh_banner,omitempty"`
+	MySQLListeners      []DiscoveredMySQLListener `json:"mysql_listeners,omitempty"`
+	RegisteredMachineID string                    `json:"registered_machine_id,omitempty"`
+}
+
+// BulkOnboardRequest 是批量纳管的输入：清单条目，加上可选的网段扫描结果。
+type BulkOnboardRequest struct {
+	Entries        []BulkOnboardEntry       `json:"machines"`
+	CredentialName string                   `json:"credential_name"`
+	Discovery      *OnboardDiscoveryRequest `json:"discovery,omitempty"`
+	Concurrency    int                      `json:"concurrency"`
+}
+
+// BulkOnboardItem 是单台机器的预检查与执行结果。
+type BulkOnboardItem struct {
+	BulkOnboardEntry
+	Source         string                    `json:"source"`
+	MySQLListeners []DiscoveredMySQLListener `json:"mysql_listeners,omitempty"`
+	Precheck       *OnboardPrecheckReport    `json:"precheck,omitempty"`
+	Ready          bool                      `json:"ready"`
+	Problem        string                    `json:"problem,omitempty"`
+	TaskID         string                    `json:"task_id,omitempty"`
+	MachineID      string                    `json:"machine_id,omitempty"`
+	Status         string                    `json:"status,omitempty"`
+	Stage          string                    `json:"stage,omitempty"`
+	Error          string                    `json:"error,omitempty"`
+}
+
+// BulkOnboardPrecheck 是批量纳管前的合并预检查报告。
+type BulkOnboardPrecheck struct {
+	Total      int               `json:"total"`
+	Ready      int               `json:"ready"`
+	Blocked    int               `json:"blocked"`
+	Discovered []DiscoveredHost  `json:"discovered,omitempty"`
+	Items      []BulkOnboardItem `json:"items"`
+}
+
+// BulkOnboardResult 是批量纳管的受理结果，TaskID 是任务中心里的父任务，
+// 每台机器的 TaskID 是对应的子任务。
+type BulkOnboardResult struct {
+	TaskID     string            `json:"task_id"`
+	Requested  int               `json:"requested"`
+	Discovered []DiscoveredHost  `json:"discovered,omitempty"`
+	Items      []BulkOnboardItem `json:"items"`
+}
+
+// ParseOnboardInventory 解析 CSV 或 YAML 纳管清单。format 为空时按内容自动识别。
+//
+// CSV 第一行是表头，YAML 是 machines 下的条目列表；两者支持相同的字段：
+// name、ip、ssh_port、credential（或 credential_name）、cluster、preserve_agent、preserve_mysql。
+func ParseOnboardInventory(format, content string) ([]BulkOnboardEntry, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = detectInventoryFormat(content)
+	}
+	var (
+		entries []BulkOnboardEntry
+		err     error
+	)
+	switch format {
+	case "csv":
+		entries, err = parseCSVInventory(content)
+	case "yaml", "yml":
+		entries, err = parseYAMLInventory(content)
+	default:
+		return nil, fmt.Errorf("不支持的清单格式 %q，仅支持 csv 或 yaml", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("纳管清单为空")
+	}
+	return entries, nil
+}
+
+func detectInventoryFormat(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "machines:") || (strings.Contains(line, ":") && !strings.Contains(line, ",")) {
+			return "yaml"
+		}
+		return "csv"
+	}
+	return "csv"
+}
+
+func parseCSVInventory(content string) ([]BulkOnboardEntry, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取清单表头失败: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	var entries []BulkOnboardEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取清单失败: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) > len(header) {
+			return nil, fmt.Errorf("清单第 %d 行的列数多于表头", line)
+		}
+		var entry BulkOnboardEntry
+		empty := true
+		for i, value := range record {
+			if strings.TrimSpace(value) != "" {
+				empty = false
+			}
+			if err := setInventoryField(&entry, header[i], value); err != nil {
+				return nil, fmt.Errorf("清单第 %d 行: %w", line, err)
+			}
+		}
+		if !empty {
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// parseYAMLInventory 解析由扁平键值对组成的机器条目列表，列表可以放在顶层，
+// 也可以放在 machines 键下。
+func parseYAMLInventory(content string) ([]BulkOnboardEntry, error) {
+	tree, err := parseYAMLTree(content, "清单")
+	if err != nil || tree == nil {
+		return nil, err
+	}
+	if fields, ok := tree.(map[string]any); ok {
+		machines, found := fields["machines"]
+		if !found || len(fields) != 1 {
+			return nil, errors.New("YAML 清单应为 machines 下的条目列表")
+		}
+		tree = machines
+	}
+	if text, ok := tree.(string); ok && text == "" {
+		return nil, nil
+	}
+	items, ok := tree.([]any)
+	if !ok {
+		return nil, errors.New("YAML 清单应为 machines 下的条目列表")
+	}
+	entries := make([]BulkOnboardEntry, 0, len(items))
+	for index, item := range items {
+		var entry BulkOnboardEntry
+		fields, ok := item.(map[string]any)
+		if !ok {
+			if text, isText := item.(string); !isText || text != "" {
+				return nil, fmt.Errorf("清单第 %d 个条目不是 key: value 格式", index+1)
+			}
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := fields[key].(string)
+			if !ok {
+				return nil, fmt.Errorf("清单第 %d 个条目的 %s 应为标量值", index+1, key)
+			}
+			if err := setInventoryField(&entry, strings.ToLower(key), value); err != nil {
+				return nil, fmt.Errorf("清单第 %d 个条目: %w", index+1, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func setInventoryField(entry *BulkOnboardEntry, key, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch key {
+	case "name":
+		entry.Name = value
+	case "ip", "host":
+		entry.IP = value
+	case "ssh_port", "port":
+		if value != "" {
+			entry.SSHPort, err = strconv.Atoi(value)
+			if err != nil || entry.SSHPort <= 0 || entry.SSHPort > 65535 {
+				return fmt.Errorf("ssh_port %q 无效", value)
+			}
+		}
+	case "credential", "credential_name":
+		entry.CredentialName = value
+	case "cluster":
+		entry.Cluster = value
+	case "preserve_agent":
+		entry.PreserveAgent, err = parseInventoryBool(value)
+	case "preserve_mysql":
+		entry.PreserveMySQL, err = parseInventoryBool(value)
+	default:
+		return fmt.Errorf("未知字段 %q", key)
+	}
+	return err
+}
+
+func parseInventoryBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "n", "0":
+		return false, nil
+	case "true", "yes", "y", "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("布尔值 %q 无效", value)
+	}
+}
+
+// DiscoverOnboardTargets 扫描 CIDR 内开放 SSH 端口或 mysqld 端口的主机。
+// SSH 以服务端 banner 确认，mysqld 以握手包确认，已纳管的 IP 会带上机器 ID。
+func (s *MachineService) DiscoverOnboardTargets(ctx context.Context, req OnboardDiscoveryRequest) ([]DiscoveredHost, error) {
+	hosts, err := discoveryHosts(req.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	if req.SSHPort <= 0 {
+		req.SSHPort = 22
+	}
+	if len(req.MySQLPorts) == 0 {
+		req.MySQLPorts = []int{3306}
+	}
+	for _, port := range append([]int{req.SSHPort}, req.MySQLPorts...) {
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("端口 %d 无效", port)
+		}
+	}
+	timeout := defaultDiscoveryTimeout
+	if req.TimeoutMS > 0 {
+		timeout = time.Duration(req.TimeoutMS) * time.Millisecond
+	}
+	found := make([]*DiscoveredHost, len(hosts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := discoveryConcurrency
+	if workers > len(hosts) {
+		workers = len(hosts)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				found[index] = probeDiscoveryHost(ctx, hosts[index], req.SSHPort, req.MySQLPorts, timeout)
+			}
+		}()
+	}
+	for i := range hosts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	result := make([]DiscoveredHost, 0)
+	for _, host := range found {
+		if host == nil {
+			continue
+		}
+		if machine, ok, err := s.machineRepo.GetByIP(ctx, host.IP); err == nil && ok {
+			host.RegisteredMachineID = machine.ID
+		}
+		result = append(result, *host)
+	}
+	return result, ctx.Err()
+}
+
+func discoveryHosts(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return nil, fmt.Errorf("CIDR %q 无效: %w", cidr, err)
+	}
+	if !prefix.Addr().Is4() {
+		return nil, errors.New("网段扫描仅支持 IPv4")
+	}
+	prefix = prefix.Masked()
+	size := 1 << (32 - prefix.Bits())
+	if size > maxDiscoveryHosts {
+		return nil, fmt.Errorf("网段 %s 超过单次扫描上限 %d 个地址，请拆分后扫描", prefix, maxDiscoveryHosts)
+	}
+	hosts := make([]string, 0, size)
+	addr := prefix.Addr()
+	for i := 0; i < size; i++ {
+		// /31 与 /32 没有网络地址和广播地址。
+		if size > 2 && (i == 0 || i == size-1) {
+			addr = addr.Next()
+			continue
+		}
+		hosts = append(hosts, addr.String())
+		addr = addr.Next()
+	}
+	return hosts, nil
+}
+
+func probeDiscoveryHost(ctx context.Context, ip string, sshPort int, mysqlPorts []int, timeout time.Duration) *DiscoveredHost {
+	host := DiscoveredHost{IP: ip}
+	if banner, ok := readDiscoveryGreeting(ctx, ip, sshPort, timeout); ok && bytes.HasPrefix(banner, []byte("SSH-")) {
+		host.SSHReachable = true
+		host.SSHBanner = strings.TrimSpace(string(bytes.SplitN(banner, []byte("\n"), 2)[0]))
+	}
+	for _, port := range mysqlPorts {
+		if greeting, ok := readDiscoveryGreeting(ctx, ip, port, timeout); ok {
+			if version, isMySQL := parseMySQLGreeting(greeting); isMySQL {
+				host.MySQLListeners = append(host.MySQLListeners, DiscoveredMySQLListener{Port: port, Version: version})
+			}
+		}
+	}
+	if !host.SSHReachable && len(host.MySQLListeners) == 0 {
+		return nil
+	}
+	return &host
+}
+
+// readDiscoveryGreeting 读取服务端主动发送的首个数据包。SSH 与 MySQL 都由服务端先发言。
+func readDiscoveryGreeting(ctx context.Context, ip string, port int, timeout time.Duration) ([]byte, bool) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return nil, false
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if n == 0 && err != nil {
+		return nil, false
+	}
+	return buf[:n], true
+}
+
+// parseMySQLGreeting 识别 MySQL 握手包（协议版本 10）或拒绝连接的错误包。
+func parseMySQLGreeting(packet []byte) (string, bool) {
+	if len(packet) < 5 {
+		return "", false
+	}
+	length := int(packet[0]) | int(packet[1])<<8 | int(packet[2])<<16
+	if length == 0 || packet[3] != 0 {
+		return "", false
+	}
+	payload := packet[4:]
+	switch payload[0] {
+	case 10:
+		end := bytes.IndexByte(payload[1:], 0)
+		if end < 0 {
+			return "", false
+		}
+		return string(payload[1 : 1+end]), true
+	case 0xff:
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// PrecheckBulkOnboard 合并清单与扫描结果，逐台复用 PrecheckOnboard，不写入机器记录。
+func (s *MachineService) PrecheckBulkOnboard(ctx context.Context, req BulkOnboardRequest) (BulkOnboardPrecheck, error) {
+	items, discovered, err := s.expandBulkOnboard(ctx, req)
+	if err != nil {
+		return BulkOnboardPrecheck{}, err
+	}
+	credentials := newBulkCredentialCache(s)
+	runBulkOnboardWorkers(len(items), req.Concurrency, func(index int) {
+		s.precheckBulkItem(ctx, &items[index], credentials)
+	})
+	report := BulkOnboardPrecheck{Total: len(items), Discovered: discovered, Items: items}
+	for _, item := range items {
+		if item.Ready {
+			report.Ready++
+		} else {
+			report.Blocked++
+		}
+	}
+	return report, nil
+}
+
+// BulkOnboard 把一次批量纳管建模为任务中心的一个父任务，每台机器是一个子任务。
+// 父任务与子任务创建后立即返回，纳管在后台执行且不随请求取消，避免客户端断开
+// 让机器停在半纳管状态；进度与每台的结果在任务中心查看。每台机器依次执行
+// 预检查、登记与互信、部署或接管 Agent、加入集群；任一步失败只影响该机器。
+func (s *MachineService) BulkOnboard(ctx context.Context, req BulkOnboardRequest) (BulkOnboardResult, error) {
+	if s.taskSvc == nil {
+		return BulkOnboardResult{}, errors.New("task service not configured")
+	}
+	items, discovered, err := s.expandBulkOnboard(ctx, req)
+	if err != nil {
+		return BulkOnboardResult{}, err
+	}
+	parent, err := s.taskSvc.CreateBatchTrackingTask(ctx, "machine_batch_onboard", "批量纳管机器", fmt.Sprintf("%d 台机器", len(items)))
+	if err != nil {
+		return BulkOnboardResult{}, err
+	}
+	result := BulkOnboardResult{TaskID: parent.Task.ID, Requested: len(items), Discovered: discovered}
+	childIDs := make([]string, len(items))
+	for i := range items {
+		child, createErr := s.taskSvc.CreateBatchTrackingTask(ctx, "machine_onboard", "纳管机器 "+items[i].Name, items[i].IP)
+		if createErr != nil {
+			_ = s.taskSvc.FinalizeBatchTrackingTask(context.WithoutCancel(ctx), parent.Task.ID, i, 1)
+			result.Items = items
+			return result, createErr
+		}
+		childIDs[i] = child.Task.ID
+		items[i].TaskID = child.Task.ID
+	}
+	if err := s.taskSvc.AttachChildTasks(ctx, parent.Task.ID, childIDs); err != nil {
+		_ = s.taskSvc.FinalizeBatchTrackingTask(context.WithoutCancel(ctx), parent.Task.ID, 0, len(items))
+		result.Items = items
+		return result, err
+	}
+	if err := s.taskSvc.FinalizeBatchTrackingTask(ctx, parent.Task.ID, len(childIDs), 0); err != nil {
+		return result, err
+	}
+	result.Items = items
+	go s.runBulkOnboard(context.WithoutCancel(ctx), append([]BulkOnboardItem(nil), items...), req.Concurrency)
+	return result, nil
+}
+
+// runBulkOnboard 在后台逐台纳管，每台结束时收尾对应的子任务，父任务随之聚合。
+func (s *MachineService) runBulkOnboard(ctx context.Context, items []BulkOnboardItem, concurrency int) {
+	credentials := newBulkCredentialCache(s)
+	runBulkOnboardWorkers(len(items), concurrency, func(index int) {
+		item := &items[index]
+		s.onboardBulkItem(ctx, item, credentials)
+		failed := 0
+		if item.Status != "success" {
+			failed = 1
+		}
+		_ = s.taskSvc.FinalizeBatchTrackingTask(ctx, item.TaskID, 0, failed)
+	})
+}
+
+// expandBulkOnboard 补齐默认值、校验重复 IP，并把扫描到的未纳管 SSH 主机追加为待纳管条目。
+func (s *MachineService) expandBulkOnboard(ctx context.Context, req BulkOnboardRequest) ([]BulkOnboardItem, []DiscoveredHost, error) {
+	defaultPort := 22
+	if req.Discovery != nil && req.Discovery.SSHPort > 0 {
+		defaultPort = req.Discovery.SSHPort
+	}
+	defaultCredential := strings.TrimSpace(req.CredentialName)
+	items := make([]BulkOnboardItem, 0, len(req.Entries))
+	seen := make(map[string]int)
+	for i, entry := range req.Entries {
+		entry.Name, entry.IP = strings.TrimSpace(entry.Name), strings.TrimSpace(entry.IP)
+		entry.CredentialName, entry.Cluster = strings.TrimSpace(entry.CredentialName), strings.TrimSpace(entry.Cluster)
+		if entry.Name == "" || entry.IP == "" {
+			return nil, nil, fmt.Errorf("第 %d 台机器缺少 name 或 ip", i+1)
+		}
+		if net.ParseIP(entry.IP) == nil {
+			return nil, nil, fmt.Errorf("第 %d 台机器的 IP %q 无效", i+1, entry.IP)
+		}
+		if previous, ok := seen[entry.IP]; ok {
+			return nil, nil, fmt.Errorf("第 %d 台与第 %d 台机器的 IP %s 重复", i+1, previous, entry.IP)
+		}
+		seen[entry.IP] = i + 1
+		if entry.SSHPort <= 0 {
+			entry.SSHPort = defaultPort
+		}
+		if entry.CredentialName == "" {
+			entry.CredentialName = defaultCredential
+		}
+		if entry.CredentialName == "" {
+			return nil, nil, fmt.Errorf("第 %d 台机器 %s 未指定 SSH 凭证，请在清单中填写 credential 或提供默认凭证", i+1, entry.Name)
+		}
+		items = append(items, BulkOnboardItem{BulkOnboardEntry: entry, Source: BulkOnboardSourceInventory})
+	}
+	var discovered []DiscoveredHost
+	if req.Discovery != nil && strings.TrimSpace(req.Discovery.CIDR) != "" {
+		hosts, err := s.DiscoverOnboardTargets(ctx, *req.Discovery)
+		if err != nil {
+			return nil, nil, err
+		}
+		discovered = hosts
+		for _, host := range hosts {
+			if index, ok := seen[host.IP]; ok {
+				items[index-1].MySQLListeners = host.MySQLListeners
+				continue
+			}
+			if !host.SSHReachable || host.RegisteredMachineID != "" {
+				continue
+			}
+			if defaultCredential == "" {
+				return nil, nil, errors.New("网段扫描发现的主机需要默认 SSH 凭证 credential_name")
+			}
+			seen[host.IP] = len(items) + 1
+			// 批量纳管从不清理远端，已有 mysqld 的主机默认保留 MySQL 并重新登记。
+			items = append(items, BulkOnboardItem{
+				BulkOnboardEntry: BulkOnboardEntry{
+					Name: "host-" + strings.ReplaceAll(host.IP, ".", "-"), IP: host.IP, SSHPort: defaultPort,
+					CredentialName: defaultCredential, PreserveMySQL: len(host.MySQLListeners) > 0,
+				},
+				Source: BulkOnboardSourceDiscovery, MySQLListeners: host.MySQLListeners,
+			})
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil, errors.New("没有待纳管的机器")
+	}
+	if len(items) > maxBulkOnboardTargets {
+		return nil, nil, fmt.Errorf("单次最多纳管 %d 台机器", maxBulkOnboardTargets)
+	}
+	return items, discovered, nil
+}
+
+// precheckBulkItem 检查登记冲突、集群与凭证，再执行单机预检查；结果写回 item。
+func (s *MachineService) precheckBulkItem(ctx context.Context, item *BulkOnboardItem, credentials *bulkCredentialCache) (credentialdomain.SSHCredential, bool) {
+	item.Ready, item.Problem, item.Precheck = false, "", nil
+	if machine, ok, err := s.machineRepo.GetByIP(ctx, item.IP); err != nil {
+		item.Problem = err.Error()
+		return credentialdomain.SSHCredential{}, false
+	} else if ok {
+		item.Problem = fmt.Sprintf("IP 已纳管为机器 %s（%s）", machine.Name, machine.ID)
+		return credentialdomain.SSHCredential{}, false
+	}
+	if item.Cluster != "" {
+		if s.clusterRepo == nil {
+			item.Problem = "cluster repository not configured"
+			return credentialdomain.SSHCredential{}, false
+		}
+		if ok, err := s.clusterRepo.Exists(ctx, item.Cluster); err != nil || !ok {
+			item.Problem = fmt.Sprintf("集群 %s 不存在", item.Cluster)
+			if err != nil {
+				item.Problem = err.Error()
+			}
+			return credentialdomain.SSHCredential{}, false
+		}
+	}
+	cred, err := credentials.get(ctx, item.CredentialName)
+	if err != nil {
+		item.Problem = err.Error()
+		return credentialdomain.SSHCredential{}, false
+	}
+	report, err := s.PrecheckOnboard(ctx, machineusecase.OnboardMachineRequest{
+		Name: item.Name, IP: item.IP, SSHPort: item.SSHPort, SSHUser: cred.SSHUser, CredentialID: cred.ID,
+	})
+	if err != nil {
+		item.Problem = err.Error()
+		return cred, false
+	}
+	item.Precheck = &report
+	item.Problem = onboardPrecheckProblem(report, item.PreserveAgent, item.PreserveMySQL)
+	item.Ready = item.Problem == ""
+	return cred, item.Ready
+}
+
+// onboardPrecheckProblem 与页面单机纳管的判定一致：预检查警告会阻止纳管；
+// 检测到已有 Agent 或 MySQL 时必须显式选择保留，批量流程不会自动清理。
+func onboardPrecheckProblem(report OnboardPrecheckReport, preserveAgent, preserveMySQL bool) string {
+	if report.Warning != "" {
+		return report.Warning
+	}
+	var kept []string
+	if report.AgentDetected && !preserveAgent {
+		kept = append(kept, "Agent（preserve_agent）")
+	}
+	if report.MySQLDetected && !preserveMySQL {
+		kept = append(kept, "MySQL（preserve_mysql）")
+	}
+	if len(kept) > 0 {
+		return "检测到已有 " + strings.Join(kept, "、") + "；请在清单中选择保留，或先执行清理"
+	}
+	return ""
+}
+
+func (s *MachineService) onboardBulkItem(ctx context.Context, item *BulkOnboardItem, credentials *bulkCredentialCache) {
+	record := func(content string, failed bool) {
+		_ = s.taskSvc.AppendBatchTrackingEvent(context.WithoutCancel(ctx), item.TaskID, content, failed)
+	}
+	fail := func(label string, err error) {
+		item.Status, item.Error = "failed", err.Error()
+		record(fmt.Sprintf("%s %s失败：%v", item.Name, label, err), true)
+	}
+	item.Stage = "precheck"
+	cred, ready := s.precheckBulkItem(ctx, item, credentials)
+	if !ready {
+		fail("预检查", errors.New(item.Problem))
+		return
+	}
+	record(fmt.Sprintf("%s（%s）预检查通过", item.Name, item.IP), false)
+
+	item.Stage = "register"
+	resp, err := s.Onboard(ctx, machineusecase.OnboardMachineRequest{
+		Name: item.Name, IP: item.IP, SSHPort: item.SSHPort, CredentialID: cred.ID,
+		PreserveAgent: item.Precheck.AgentDetected && item.PreserveAgent,
+		PreserveMySQL: item.Precheck.MySQLDetected && item.PreserveMySQL,
+	})
+	if resp.ID != "" {
+		item.MachineID = resp.ID
+	}
+	if err != nil {
+		fail("登记与互信", err)
+		return
+	}
+	record(fmt.Sprintf("%s 已登记，SSH 管理通道已建立", item.Name), false)
+
+	item.Stage = "agent"
+	if item.Precheck.AgentDetected {
+		record(fmt.Sprintf("%s 已有 Agent 已保留并重新登记", item.Name), false)
+	} else if s.agentSvc != nil {
+		if _, err := s.agentSvc.RetryInstallByIP(ctx, agentusecase.InstallAgentRequest{
+			IP: item.IP, SSHUser: cred.SSHUser, SSHPassword: cred.SSHPassword, SSHPrivateKey: cred.PrivateKey, SSHPassphrase: cred.Passphrase,
+		}); err != nil {
+			fail("部署 Agent", err)
+			return
+		}
+		record(fmt.Sprintf("%s Agent 已安装并启动", item.Name), false)
+	}
+
+	if item.Cluster != "" {
+		item.Stage = "cluster"
+		if err := s.AssignMachineCluster(ctx, item.MachineID, item.Cluster); err != nil {
+			fail("加入集群", err)
+			return
+		}
+		record(fmt.Sprintf("%s 已加入集群 %s", item.Name, item.Cluster), false)
+	}
+	item.Status, item.Stage = "success", "completed"
+}
+
+// bulkCredentialCache 让同一批次的机器共享凭证查询结果。
+type bulkCredentialCache struct {
+	service *MachineService
+	mu      sync.Mutex
+	items   map[string]credentialdomain.SSHCredential
+}
+
+func newBulkCredentialCache(service *MachineService) *bulkCredentialCache {
+	return &bulkCredentialCache{service: service, items: map[string]credentialdomain.SSHCredential{}}
+}
+
+func (c *bulkCredentialCache) get(ctx context.Context, selector string) (credentialdomain.SSHCredential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cred, ok := c.items[selector]; ok {
+		return cred, nil
+	}
+	cred, ok, err := c.service.resolveCredential(ctx, selector)
+	if err != nil {
+		return credentialdomain.SSHCredential{}, err
+	}
+	if !ok {
+		return credentialdomain.SSHCredential{}, fmt.Errorf("SSH 凭证 %s 不存在", selector)
+	}
+	c.items[selector] = cred
+	return cred, nil
+}
+
+func runBulkOnboardWorkers(count, concurrency int, work func(index int)) {
+	if concurrency <= 0 {
+		concurrency = 3
+	}
+	if concurrency > maxBulkOnboardConcurrency {
+		concurrency = maxBulkOnboardConcurrency
+	}
+	if concurrency > count {
+		concurrency = count
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				work(index)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
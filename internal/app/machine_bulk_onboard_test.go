@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	credentialdomain "gmha/internal/domain/credential"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	persistencesqlite "gmha/internal/infrastructure/persistence/sqlite"
+	machineusecase "gmha/internal/usecase/machine"
+	_ "modernc.org/sqlite"
+)
+
+func TestParseOnboardInventoryAcceptsCSVAndYAML(t *testing.T) {
+	csvEntries, err := ParseOnboardInventory("", "name,ip,ssh_port,credential,cluster,preserve_agent,preserve_mysql\n"+
+		"# comment\n"+
+		"db-01,10.0.1.11,22,root-cred,prod-a,no,yes\n"+
+		"db-02,10.0.1.12,,,,,\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlEntries, err := ParseOnboardInventory("", `machines:
+  - name: db-01
+    ip: 10.0.1.11
+    ssh_port: 22
+    credential: "root-cred"   # per-host credential
+    cluster: prod-a
+    preserve_mysql: true
+  - name: db-02
+    ip: 10.0.1.12
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BulkOnboardEntry{
+		{Name: "db-01", IP: "10.0.1.11", SSHPort: 22, CredentialName: "root-cred", Cluster: "prod-a", PreserveMySQL: true},
+		{Name: "db-02", IP: "10.0.1.12"},
+	}
+	if !reflect.DeepEqual(csvEntries, want) || !reflect.DeepEqual(yamlEntries, want) {
+		t.Fatalf("csv=%+v yaml=%+v", csvEntries, yamlEntries)
+	}
+	topLevel, err := ParseOnboardInventory("yaml", "- name: db-02\n  ip: 10.0.1.12\n")
+	if err != nil || !reflect.DeepEqual(topLevel, want[1:]) {
+		t.Fatalf("top-level yaml = %+v, %v", topLevel, err)
+	}
+	if _, err := ParseOnboardInventory("yaml", "machines:\n  - name: db-01\n     ip: 10.0.1.11\n"); err == nil || !strings.Contains(err.Error(), "清单第 3 行") {
+		t.Fatalf("misaligned yaml must report the line, got %v", err)
+	}
+	if _, err := ParseOnboardInventory("csv", "name,ip,password\ndb-01,10.0.1.11,x\n"); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Fatalf("unknown columns must be rejected, got %v", err)
+	}
+}
+
+func TestDiscoverOnboardTargetsReadsSSHBannerAndMySQLGreeting(t *testing.T) {
+	sshPort := serveGreeting(t, []byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	greeting := append([]byte{0, 0, 0, 0, 10}, []byte("8.0.36\x00rest")...)
+	greeting[0] = byte(len(greeting) - 4)
+	mysqlPort := serveGreeting(t, greeting)
+	service := &MachineService{machineRepo: &detachMachineRepo{machine: machinedomain.Machine{ID: "m-1", IP: "127.0.0.1"}}}
+
+	hosts, err := service.DiscoverOnboardTargets(context.Background(), OnboardDiscoveryRequest{CIDR: "127.0.0.1/32", SSHPort: sshPort, MySQLPorts: []int{mysqlPort, sshPort}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || !hosts[0].SSHReachable || hosts[0].SSHBanner != "SSH-2.0-OpenSSH_9.6" || hosts[0].RegisteredMachineID != "m-1" {
+		t.Fatalf("unexpected discovery result %+v", hosts)
+	}
+	if !reflect.DeepEqual(hosts[0].MySQLListeners, []DiscoveredMySQLListener{{Port: mysqlPort, Version: "8.0.36"}}) {
+		t.Fatalf("only the real mysqld greeting should count, got %+v", hosts[0].MySQLListeners)
+	}
+	if _, err := discoveryHosts("10.0.0.0/16"); err == nil {
+		t.Fatal("oversized CIDR should be rejected")
+	}
+	if hosts, _ := discoveryHosts("10.0.0.0/30"); !reflect.DeepEqual(hosts, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Fatalf("network and broadcast addresses must be skipped, got %v", hosts)
+	}
+}
+
+func serveGreeting(t *testing.T, greeting []byte) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(greeting)
+			_ = conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	value, _ := strconv.Atoi(port)
+	return value
+}
+
+func TestBulkOnboardRunsEachHostUnderOneParentTask(t *testing.T) {
+	db, err := sql.Open("sqlite", t.TempDir()+"/bulk-onboard.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	store := persistencesqlite.NewDB(db, persistencesqlite.DialectSQLite)
+	machineRepo := persistencesqlite.NewMachineRepository(store)
+	clusterRepo := persistencesqlite.NewClusterRepository(store)
+	credentialRepo := persistencesqlite.NewCredentialRepository(store)
+	taskRepo := persistencesqlite.NewTaskRepository(store)
+	for _, migrate := range []func() error{machineRepo.Migrate, clusterRepo.Migrate, credentialRepo.Migrate, taskRepo.Migrate} {
+		if err := migrate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	if _, err := credentialRepo.Save(ctx, credentialdomain.SSHCredential{Name: "root-cred", SSHUser: "root", SSHPassword: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := machineRepo.Save(ctx, machinedomain.Machine{ID: "existing", Name: "db-00", IP: "10.0.1.10", SSHPort: 22, SSHUser: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	ssh := &cleanupSSHClient{output: "uid=0(root)\nLinux 5.14 x86_64\nSYSTEMD_READY\n/dev/sda1 50G 10G 40G 20% /\nGMHA_AGENT_ABSENT\nMYSQL_ABSENT"}
+	onboard := machineusecase.NewOnboardUsecase(machineusecase.Dependencies{MachineRepo: machineRepo, SSHClient: ssh})
+	taskService := NewTaskService(taskRepo, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	service := NewMachineService(onboard, machineRepo, clusterRepo, credentialRepo, nil, nil, nil, ssh, nil, taskService)
+
+	req := BulkOnboardRequest{CredentialName: "root-cred", Concurrency: 2, Entries: []BulkOnboardEntry{
+		{Name: "db-01", IP: "10.0.1.11"},
+		{Name: "db-02", IP: "10.0.1.12"},
+		{Name: "db-03", IP: "10.0.1.13", Cluster: "missing"},
+		{Name: "db-00", IP: "10.0.1.10"},
+	}}
+	report, err := service.PrecheckBulkOnboard(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.Ready != 2 || report.Blocked != 2 || report.Items[0].Precheck == nil || !report.Items[0].Precheck.SystemdReady {
+		t.Fatalf("unexpected precheck report %+v", report)
+	}
+	if machines, _ := machineRepo.List(ctx); len(machines) != 1 {
+		t.Fatalf("precheck must not register machines, got %d", len(machines))
+	}
+
+	result, err := service.BulkOnboard(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TaskID == "" || result.Requested != 4 || result.Items[3].TaskID == "" {
+		t.Fatalf("unexpected bulk result %+v", result)
+	}
+	parent, err := taskService.WaitForTask(ctx, result.TaskID, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent.Task.Status != taskdomain.StatusFailed || len(parent.ChildDetails) != 4 {
+		t.Fatalf("two blocked hosts should fail the batch: %+v", parent.Task)
+	}
+	for index, wantStatus := range []taskdomain.Status{taskdomain.StatusSuccess, taskdomain.StatusSuccess, taskdomain.StatusFailed, taskdomain.StatusFailed} {
+		child, err := taskService.GetTaskDetail(ctx, result.Items[index].TaskID)
+		if err != nil || child.Task.Status != wantStatus {
+			t.Fatalf("child %d = %+v, %v", index, child.Task, err)
+		}
+		if index == 2 && !strings.Contains(child.Events[len(child.Events)-1].Content, "预检查失败") {
+			t.Fatalf("blocked hosts should fail at precheck: %+v", child.Events)
+		}
+	}
+	if machine, ok, _ := machineRepo.GetByIP(ctx, "10.0.1.12"); !ok || machine.CredentialID == "" {
+		t.Fatalf("ready hosts should be registered with their credential: %+v", machine)
+	}
+	page, err := taskService.ListTaskPage(ctx, TaskListQuery{Limit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Items[0].ID != result.TaskID || len(page.Items[0].Children) != 4 {
+		t.Fatalf("the batch should expose one parent task with four children: %+v", page)
+	}
+}
+
+func TestBulkOnboardRejectsDuplicateIPsAndMissingCredential(t *testing.T) {
+	service := &MachineService{}
+	if _, _, err := service.expandBulkOnboard(context.Background(), BulkOnboardRequest{CredentialName: "c", Entries: []BulkOnboardEntry{{Name: "a", IP: "10.0.0.1"}, {Name: "b", IP: "10.0.0.1"}}}); err == nil {
+		t.Fatal("duplicate IPs should be rejected")
+	}
+	if _, _, err := service.expandBulkOnboard(context.Background(), BulkOnboardRequest{Entries: []BulkOnboardEntry{{Name: "a", IP: "10.0.0.1"}}}); err == nil {
+		t.Fatal("hosts without a credential should be rejected")
+	}
+	if problem := onboardPrecheckProblem(OnboardPrecheckReport{MySQLDetected: true}, false, true); problem != "" {
+		t.Fatalf("preserved MySQL should not block: %s", problem)
+	}
+	if problem := onboardPrecheckProblem(OnboardPrecheckReport{AgentDetected: true}, false, true); !strings.Contains(problem, "preserve_agent") {
+		t.Fatalf("an unpreserved Agent should block: %q", problem)
+	}
+}
@@ -0,0 +1,769 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	driftdomain "gmha/internal/domain/configdrift"
+	machinedomain "gmha/internal/domain/machine"
+	templatedomain "gmha/internal/domain/paramtemplate"
+	mysqlapp "gmha/internal/mysql"
+)
+
+var (
+	ErrParameterTemplateNotFound        = errors.New("参数模板不存在")
+	ErrParameterTemplateRolloutActive   = errors.New("集群已有正在执行的参数模板发布")
+	ErrParameterTemplateRestartRequired = errors.New("包含需要重启才能生效的参数，请设置 restart_confirmed")
+)
+
+var (
+	parameterTemplateNamePattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	parameterTemplateProfilePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+)
+
+// ParameterTemplateRunner executes the per-instance work of a rollout. The
+// HTTP layer implements it with the MySQL parameter task so rollouts use the
+// same my.cnf editing, validation and restart commands as manual changes.
+type ParameterTemplateRunner interface {
+	// Collect reads the live global variables of the instance.
+	Collect(ctx context.Context, step templatedomain.RolloutStep) (string, map[string]string, error)
+	// Apply writes the changes to my.cnf, sets dynamic ones with SET GLOBAL,
+	// restarts when asked and waits for the task to finish.
+	Apply(ctx context.Context, step templatedomain.RolloutStep, changes []templatedomain.Change, restart bool) (string, error)
+}
+
+// ParameterTemplateService manages named, versioned MySQL parameter templates
+// built on the YAML configuration profiles, attaches them to clusters and
+// rolls a version out instance by instance, replicas first and the primary
+// last, verifying each node before moving on. Every applied step is kept in
+// the history of its instance and a rollout can be reverted to the previous
+// version.
+type ParameterTemplateService struct {
+	repo       templatedomain.Repository
+	instances  MySQLInstanceRepository
+	machines   machinedomain.Repository
+	infos      MachineInfoRepository
+	drift      driftdomain.Repository
+	configRoot string
+
+	mu sync.Mutex
+}
+
+// ParameterTemplateVersionRequest creates the next version of a template, and
+// the template itself when it does not exist yet.
+type ParameterTemplateVersionRequest struct {
+	Template    string            `json:"template"`
+	Description string            `json:"description"`
+	BaseProfile string            `json:"base_profile"`
+	Parameters  map[string]string `json:"parameters"`
+	Comment     string            `json:"comment"`
+	Actor       string            `json:"actor"`
+}
+
+// ParameterTemplateRolloutRequest starts a rollout. Version 0 means the latest
+// version; Rollback ignores Version and returns to the previous one. Confirm
+// must repeat the cluster name.
+type ParameterTemplateRolloutRequest struct {
+	Cluster          string `json:"cluster"`
+	Version          int    `json:"version"`
+	Rollback         bool   `json:"rollback"`
+	RestartConfirmed bool   `json:"restart_confirmed"`
+	Confirm          string `json:"confirm"`
+	Actor            string `json:"actor"`
+}
+
+type ParameterTemplateDetail struct {
+	Template    templatedomain.Template     `json:"template"`
+	Versions    []templatedomain.Version    `json:"versions"`
+	Attachments []templatedomain.Attachment `json:"attachments"`
+}
+
+func NewParameterTemplateService(repo templatedomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository, infos MachineInfoRepository, drift driftdomain.Repository) *ParameterTemplateService {
+	return &ParameterTemplateService{repo: repo, instances: instances, machines: machines, infos: infos, drift: drift, configRoot: "configs"}
+}
+
+func (s *ParameterTemplateService) ListTemplates(ctx context.Context) ([]templatedomain.Template, error) {
+	return s.repo.ListTemplates(ctx)
+}
+
+// Template returns a template with its versions, newest first, and the
+// clusters it is attached to.
+func (s *ParameterTemplateService) Template(ctx context.Context, name string) (ParameterTemplateDetail, error) {
+	template, ok, err := s.repo.GetTemplate(ctx, name)
+	if err != nil {
+		return ParameterTemplateDetail{}, err
+	}
+	if !ok {
+		return ParameterTemplateDetail{}, fmt.Errorf("%w：%s", ErrParameterTemplateNotFound, strings.TrimSpace(name))
+	}
+	versions, err := s.repo.ListVersions(ctx, template.Name)
+	if err != nil {
+		return ParameterTemplateDetail{}, err
+	}
+	attachments, err := s.repo.ListAttachments(ctx)
+	if err != nil {
+		return ParameterTemplateDetail{}, err
+	}
+	detail := ParameterTemplateDetail{Template: template, Versions: versions, Attachments: []templatedomain.Attachment{}}
+	for _, attachment := range attachments {
+		if attachment.Template == template.Name {
+			detail.Attachments = append(detail.Attachments, attachment)
+		}
+	}
+	return detail, nil
+}
+
+// CreateVersion validates the base profile and parameters and stores them as
+// a new immutable version.
+func (s *ParameterTemplateService) CreateVersion(ctx context.Context, req ParameterTemplateVersionRequest) (templatedomain.Version, error) {
+	req.Template = strings.TrimSpace(req.Template)
+	req.BaseProfile = strings.TrimSpace(req.BaseProfile)
+	if !parameterTemplateNamePattern.MatchString(req.Template) {
+		return templatedomain.Version{}, errors.New("模板名只能包含字母、数字、点、下划线和连字符，且不超过 64 个字符")
+	}
+	if req.BaseProfile != "" {
+		if !parameterTemplateProfilePattern.MatchString(req.BaseProfile) {
+			return templatedomain.Version{}, fmt.Errorf("配置档案名 %q 无效", req.BaseProfile)
+		}
+		if _, err := mysqlapp.LoadProfile(s.configRoot, req.BaseProfile); err != nil {
+			return templatedomain.Version{}, fmt.Errorf("加载配置档案 %s 失败：%w", req.BaseProfile, err)
+		}
+	}
+	parameters, _, err := normalizeConfigDriftDesired(req.Parameters, nil)
+	if err != nil {
+		return templatedomain.Version{}, err
+	}
+	if req.BaseProfile == "" && len(parameters) == 0 {
+		return templatedomain.Version{}, errors.New("base_profile 与 parameters 至少填写一项")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	template, ok, err := s.repo.GetTemplate(ctx, req.Template)
+	if err != nil {
+		return templatedomain.Version{}, err
+	}
+	if !ok {
+		template = templatedomain.Template{Name: req.Template, CreatedAt: now}
+	}
+	if description := strings.TrimSpace(req.Description); description != "" {
+		template.Description = description
+	}
+	version := templatedomain.Version{
+		Template: template.Name, Version: template.LatestVersion + 1, BaseProfile: req.BaseProfile, Parameters: parameters,
+		Comment: strings.TrimSpace(req.Comment), CreatedBy: strings.TrimSpace(req.Actor), CreatedAt: now,
+	}
+	if err := s.repo.SaveVersion(ctx, version); err != nil {
+		return templatedomain.Version{}, err
+	}
+	template.LatestVersion = version.Version
+	template.UpdatedAt = now
+	if err := s.repo.SaveTemplate(ctx, template); err != nil {
+		return templatedomain.Version{}, err
+	}
+	return version, nil
+}
+
+// DeleteTemplate removes a template and its versions; attached templates must
+// be detached first.
+func (s *ParameterTemplateService) DeleteTemplate(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = strings.TrimSpace(name)
+	if _, ok, err := s.repo.GetTemplate(ctx, name); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w：%s", ErrParameterTemplateNotFound, name)
+	}
+	attachments, err := s.repo.ListAttachments(ctx)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if attachment.Template == name {
+			return fmt.Errorf("模板 %s 仍关联集群 %s，请先解除关联", name, attachment.Cluster)
+		}
+	}
+	return s.repo.DeleteTemplate(ctx, name)
+}
+
+func (s *ParameterTemplateService) ListAttachments(ctx context.Context) ([]templatedomain.Attachment, error) {
+	return s.repo.ListAttachments(ctx)
+}
+
+// Attach binds a cluster to a template. Switching to another template resets
+// the rolled-out version; nothing changes on the instances until a rollout.
+func (s *ParameterTemplateService) Attach(ctx context.Context, cluster, template, actor string) (templatedomain.Attachment, error) {
+	cluster, template = strings.TrimSpace(cluster), strings.TrimSpace(template)
+	if cluster == "" {
+		return templatedomain.Attachment{}, errors.New("cluster 不能为空")
+	}
+	if _, ok, err := s.repo.GetTemplate(ctx, template); err != nil {
+		return templatedomain.Attachment{}, err
+	} else if !ok {
+		return templatedomain.Attachment{}, fmt.Errorf("%w：%s", ErrParameterTemplateNotFound, template)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureIdle(ctx, cluster); err != nil {
+		return templatedomain.Attachment{}, err
+	}
+	attachment, ok, err := s.repo.GetAttachment(ctx, cluster)
+	if err != nil {
+		return templatedomain.Attachment{}, err
+	}
+	if ok && attachment.Template == template {
+		return attachment, nil
+	}
+	attachment = templatedomain.Attachment{Cluster: cluster, Template: template, UpdatedBy: strings.TrimSpace(actor), UpdatedAt: time.Now().UTC()}
+	if err := s.repo.SaveAttachment(ctx, attachment); err != nil {
+		return templatedomain.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+// Detach removes the binding; the instances keep their current parameters.
+func (s *ParameterTemplateService) Detach(ctx context.Context, cluster string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cluster = strings.TrimSpace(cluster)
+	if err := s.ensureIdle(ctx, cluster); err != nil {
+		return err
+	}
+	return s.repo.DeleteAttachment(ctx, cluster)
+}
+
+// Plan previews a rollout. Values per instance are resolved from the base
+// profile and the machine's collected resources; the changes are estimated
+// from the latest config drift report and recomputed from live values when
+// the step runs.
+func (s *ParameterTemplateService) Plan(ctx context.Context, cluster string, version int, rollback bool) (templatedomain.Rollout, error) {
+	cluster = strings.TrimSpace(cluster)
+	if cluster == "" {
+		return templatedomain.Rollout{}, errors.New("cluster 不能为空")
+	}
+	attachment, ok, err := s.repo.GetAttachment(ctx, cluster)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if !ok {
+		return templatedomain.Rollout{}, fmt.Errorf("集群 %s 未关联参数模板", cluster)
+	}
+	target := version
+	if rollback {
+		target = attachment.PreviousVersion
+		// A failed rollout leaves some nodes on the new version; rolling back
+		// then restores the version the cluster was on.
+		if last, found, err := s.lastRollout(ctx, cluster); err != nil {
+			return templatedomain.Rollout{}, err
+		} else if found && last.Status == templatedomain.RolloutFailed && attachment.Version > 0 {
+			target = attachment.Version
+		}
+		if target == 0 {
+			return templatedomain.Rollout{}, fmt.Errorf("集群 %s 没有可回滚的上一版本", cluster)
+		}
+	}
+	if target == 0 {
+		template, ok, err := s.repo.GetTemplate(ctx, attachment.Template)
+		if err != nil {
+			return templatedomain.Rollout{}, err
+		}
+		if !ok {
+			return templatedomain.Rollout{}, fmt.Errorf("%w：%s", ErrParameterTemplateNotFound, attachment.Template)
+		}
+		target = template.LatestVersion
+	}
+	selected, ok, err := s.repo.GetVersion(ctx, attachment.Template, target)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if !ok {
+		return templatedomain.Rollout{}, fmt.Errorf("模板 %s 没有版本 %d", attachment.Template, target)
+	}
+
+	now := time.Now().UTC()
+	rollout := templatedomain.Rollout{
+		Cluster: cluster, Template: attachment.Template, FromVersion: attachment.Version, ToVersion: selected.Version,
+		Rollback: rollback, Status: templatedomain.RolloutPlanned, Steps: []templatedomain.RolloutStep{}, CreatedAt: now, UpdatedAt: now,
+	}
+	instances, err := s.clusterInstances(ctx, cluster)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if len(instances) == 0 {
+		return templatedomain.Rollout{}, fmt.Errorf("集群 %s 没有已登记的 MySQL 实例", cluster)
+	}
+	for _, item := range instances {
+		parameters, err := s.resolve(ctx, selected, item.instance)
+		if err != nil {
+			return templatedomain.Rollout{}, err
+		}
+		if rollback {
+			if err := s.restoreDropped(ctx, rollout, item.machine.ID, item.instance.Port, parameters); err != nil {
+				return templatedomain.Rollout{}, err
+			}
+		}
+		step := templatedomain.RolloutStep{
+			MachineID: item.machine.ID, MachineName: item.machine.Name, MachineIP: item.machine.IP, Port: item.instance.Port,
+			Parameters: parameters, Changes: []templatedomain.Change{}, Status: templatedomain.StepPending,
+		}
+		snapshot, found, err := s.snapshot(ctx, item.machine.ID, item.instance.Port)
+		if err != nil {
+			return templatedomain.Rollout{}, err
+		}
+		if found {
+			step.Role = configDriftRole(snapshot.Runtime)
+			changes, problems := parameterTemplateChanges(parameters, snapshot.Runtime, &snapshot)
+			step.Changes = changes
+			for _, change := range changes {
+				step.Restart = step.Restart || change.Restart
+			}
+			for _, problem := range problems {
+				rollout.Warnings = append(rollout.Warnings, fmt.Sprintf("%s:%d %s", item.machine.Name, item.instance.Port, problem))
+			}
+			if now.Sub(snapshot.CollectedAt) > configDriftStaleAfter {
+				step.Message = "配置报告已过期，执行时以实时采集结果为准"
+			}
+		} else {
+			step.Message = "尚无配置报告，执行时以实时采集结果为准"
+		}
+		rollout.Steps = append(rollout.Steps, step)
+	}
+	rank := map[string]int{driftdomain.RoleReplica: 0, "": 1, driftdomain.RolePrimary: 2}
+	sort.SliceStable(rollout.Steps, func(i, j int) bool {
+		left, right := rollout.Steps[i], rollout.Steps[j]
+		if rank[left.Role] != rank[right.Role] {
+			return rank[left.Role] < rank[right.Role]
+		}
+		if left.MachineName != right.MachineName {
+			return left.MachineName < right.MachineName
+		}
+		return left.Port < right.Port
+	})
+	return rollout, nil
+}
+
+// StartRollout stores a running rollout for the caller to execute with
+// RunRollout. Only one rollout per cluster may run at a time.
+func (s *ParameterTemplateService) StartRollout(ctx context.Context, req ParameterTemplateRolloutRequest) (templatedomain.Rollout, error) {
+	req.Cluster = strings.TrimSpace(req.Cluster)
+	if req.Cluster == "" {
+		return templatedomain.Rollout{}, errors.New("cluster 不能为空")
+	}
+	if strings.TrimSpace(req.Confirm) != req.Cluster {
+		return templatedomain.Rollout{}, fmt.Errorf("confirm 必须填写集群名 %s", req.Cluster)
+	}
+	rollout, err := s.Plan(ctx, req.Cluster, req.Version, req.Rollback)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if !req.RestartConfirmed {
+		for _, step := range rollout.Steps {
+			if step.Restart {
+				return rollout, ErrParameterTemplateRestartRequired
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureIdle(ctx, req.Cluster); err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	now := time.Now().UTC()
+	rollout.ID = fmt.Sprintf("param-rollout-%d", now.UnixNano())
+	rollout.Status = templatedomain.RolloutRunning
+	rollout.RestartConfirmed = req.RestartConfirmed
+	rollout.CreatedBy = strings.TrimSpace(req.Actor)
+	rollout.CreatedAt, rollout.UpdatedAt = now, now
+	if err := s.repo.SaveRollout(ctx, rollout); err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	return rollout, nil
+}
+
+// SetParentTask records the task center entry that tracks a rollout.
+func (s *ParameterTemplateService) SetParentTask(ctx context.Context, id, taskID string) error {
+	rollout, ok, err := s.repo.GetRollout(ctx, id)
+	if err != nil || !ok {
+		return err
+	}
+	rollout.ParentTaskID = taskID
+	return s.repo.SaveRollout(ctx, rollout)
+}
+
+// RunRollout executes a started rollout step by step and stops at the first
+// failed instance. Each step collects the live values, applies what differs,
+// collects again and compares every changed runtime value before the next
+// instance starts.
+func (s *ParameterTemplateService) RunRollout(ctx context.Context, id string, runner ParameterTemplateRunner) (templatedomain.Rollout, error) {
+	rollout, ok, err := s.repo.GetRollout(ctx, id)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if !ok {
+		return templatedomain.Rollout{}, fmt.Errorf("发布 %s 不存在", id)
+	}
+	if rollout.Status != templatedomain.RolloutRunning {
+		return rollout, fmt.Errorf("发布 %s 当前状态为 %s", id, rollout.Status)
+	}
+	for index := range rollout.Steps {
+		step := &rollout.Steps[index]
+		if step.Status != templatedomain.StepPending {
+			continue
+		}
+		started := time.Now().UTC()
+		step.Status, step.StartedAt = templatedomain.StepRunning, &started
+		s.saveRollout(ctx, &rollout)
+
+		stepErr := s.runStep(ctx, &rollout, index, runner)
+		finished := time.Now().UTC()
+		step.FinishedAt = &finished
+		if stepErr != nil {
+			step.Status, step.Message = templatedomain.StepFailed, stepErr.Error()
+			rollout.Status = templatedomain.RolloutFailed
+			rollout.Error = fmt.Sprintf("%s:%d %s", step.MachineName, step.Port, stepErr.Error())
+			for rest := index + 1; rest < len(rollout.Steps); rest++ {
+				rollout.Steps[rest].Status, rollout.Steps[rest].Message = templatedomain.StepSkipped, "前序实例失败，未执行"
+			}
+			break
+		}
+		s.saveRollout(ctx, &rollout)
+	}
+	if rollout.Status == templatedomain.RolloutRunning {
+		rollout.Status = templatedomain.RolloutSucceeded
+	}
+	finished := time.Now().UTC()
+	rollout.FinishedAt = &finished
+	s.saveRollout(ctx, &rollout)
+	if err := s.settleAttachment(ctx, rollout); err != nil {
+		return rollout, err
+	}
+	if rollout.Status == templatedomain.RolloutFailed {
+		return rollout, errors.New(rollout.Error)
+	}
+	return rollout, nil
+}
+
+func (s *ParameterTemplateService) runStep(ctx context.Context, rollout *templatedomain.Rollout, index int, runner ParameterTemplateRunner) error {
+	step := &rollout.Steps[index]
+	taskID, runtime, err := runner.Collect(ctx, *step)
+	step.VerifyTaskID = taskID
+	if err != nil {
+		return fmt.Errorf("采集运行参数失败：%w", err)
+	}
+	if role := configDriftRole(runtime); role != "" {
+		step.Role = role
+	}
+	var snapshot *driftdomain.Snapshot
+	if current, found, err := s.snapshot(ctx, step.MachineID, step.Port); err != nil {
+		return err
+	} else if found {
+		snapshot = &current
+	}
+	changes, problems := parameterTemplateChanges(step.Parameters, runtime, snapshot)
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "；"))
+	}
+	step.Changes, step.Restart = changes, false
+	for _, change := range changes {
+		step.Restart = step.Restart || change.Restart
+	}
+	if len(changes) == 0 {
+		step.Status, step.Message = templatedomain.StepSkipped, "参数已与模板一致"
+		return nil
+	}
+	if step.Restart && !rollout.RestartConfirmed {
+		return errors.New("实例需要重启才能使参数生效，但发布未确认重启")
+	}
+
+	record := templatedomain.InstanceChange{
+		ID: fmt.Sprintf("%s-%d", rollout.ID, index+1), MachineID: step.MachineID, Port: step.Port, Cluster: rollout.Cluster,
+		Template: rollout.Template, FromVersion: rollout.FromVersion, ToVersion: rollout.ToVersion, Rollback: rollout.Rollback,
+		RolloutID: rollout.ID, Changes: changes, Restarted: step.Restart,
+	}
+	verifyErr := func() error {
+		step.ApplyTaskID, err = runner.Apply(ctx, *step, changes, step.Restart)
+		record.ApplyTaskID = step.ApplyTaskID
+		if err != nil {
+			return fmt.Errorf("应用参数失败：%w", err)
+		}
+		step.VerifyTaskID, runtime, err = runner.Collect(ctx, *step)
+		record.VerifyTaskID = step.VerifyTaskID
+		if err != nil {
+			return fmt.Errorf("校验采集失败：%w", err)
+		}
+		mismatched := make([]string, 0)
+		for _, change := range changes {
+			if !change.Dynamic && !change.Restart {
+				continue
+			}
+			actual, found := configDriftLookup(runtime, change.Name)
+			if !found || !configDriftEqual(change.Name, change.To, actual, runtime) {
+				mismatched = append(mismatched, fmt.Sprintf("%s 期望 %s，实际 %s", change.Name, change.To, actual))
+			}
+		}
+		if len(mismatched) > 0 {
+			return fmt.Errorf("校验未通过：%s", strings.Join(mismatched, "；"))
+		}
+		return nil
+	}()
+	record.CreatedAt = time.Now().UTC()
+	record.Status = templatedomain.StepSucceeded
+	if verifyErr != nil {
+		record.Status, record.Message = templatedomain.StepFailed, verifyErr.Error()
+	} else {
+		step.Status, step.Message = templatedomain.StepSucceeded, fmt.Sprintf("已变更 %d 项参数", len(changes))
+	}
+	if err := s.repo.AppendInstanceChange(ctx, record); err != nil && verifyErr == nil {
+		return err
+	}
+	return verifyErr
+}
+
+// settleAttachment moves the attachment to the rolled-out version. After a
+// rollback the previous version becomes the one the target version was
+// originally rolled out from, so repeated rollbacks walk back through history.
+func (s *ParameterTemplateService) settleAttachment(ctx context.Context, rollout templatedomain.Rollout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attachment, ok, err := s.repo.GetAttachment(ctx, rollout.Cluster)
+	if err != nil || !ok || attachment.Template != rollout.Template {
+		return err
+	}
+	attachment.RolloutID = rollout.ID
+	attachment.UpdatedBy = rollout.CreatedBy
+	attachment.UpdatedAt = time.Now().UTC()
+	if rollout.Status == templatedomain.RolloutSucceeded {
+		previous := rollout.FromVersion
+		if rollout.Rollback {
+			previous = 0
+			history, err := s.repo.ListRollouts(ctx, rollout.Cluster, templatedomain.RolloutSucceeded, 500)
+			if err != nil {
+				return err
+			}
+			for _, item := range history {
+				if item.ID != rollout.ID && !item.Rollback && item.Template == rollout.Template && item.ToVersion == rollout.ToVersion && item.FromVersion != rollout.ToVersion {
+					previous = item.FromVersion
+					break
+				}
+			}
+		}
+		if previous == rollout.ToVersion {
+			previous = attachment.PreviousVersion
+		}
+		attachment.Version, attachment.PreviousVersion = rollout.ToVersion, previous
+	}
+	return s.repo.SaveAttachment(ctx, attachment)
+}
+
+// restoreDropped adds, for a rollback, the parameters the newer versions set
+// on an instance but the target version does not manage, with the value the
+// instance had before they were first changed.
+func (s *ParameterTemplateService) restoreDropped(ctx context.Context, rollout templatedomain.Rollout, machineID string, port int, parameters map[string]string) error {
+	history, err := s.repo.ListInstanceChanges(ctx, machineID, port, 500)
+	if err != nil {
+		return err
+	}
+	restore := make(map[string]string)
+	for _, entry := range history {
+		if entry.Template != rollout.Template {
+			continue
+		}
+		if entry.ToVersion == rollout.ToVersion && entry.Status == templatedomain.StepSucceeded {
+			break
+		}
+		for _, change := range entry.Changes {
+			if _, managed := parameters[change.Name]; !managed && change.From != "" {
+				restore[change.Name] = change.From
+			}
+		}
+	}
+	for name, value := range restore {
+		parameters[name] = value
+	}
+	return nil
+}
+
+func (s *ParameterTemplateService) Rollout(ctx context.Context, id string) (templatedomain.Rollout, error) {
+	rollout, ok, err := s.repo.GetRollout(ctx, id)
+	if err != nil {
+		return templatedomain.Rollout{}, err
+	}
+	if !ok {
+		return templatedomain.Rollout{}, fmt.Errorf("发布 %s 不存在", strings.TrimSpace(id))
+	}
+	return rollout, nil
+}
+
+func (s *ParameterTemplateService) ListRollouts(ctx context.Context, cluster string, limit int) ([]templatedomain.Rollout, error) {
+	return s.repo.ListRollouts(ctx, cluster, "", limit)
+}
+
+// InstanceHistory returns the template changes applied to one instance.
+func (s *ParameterTemplateService) InstanceHistory(ctx context.Context, machineID string, port int, limit int) ([]templatedomain.InstanceChange, error) {
+	return s.repo.ListInstanceChanges(ctx, machineID, port, limit)
+}
+
+// RecoverInterrupted fails rollouts left running by a Manager restart; the
+// state of the interrupted node is unknown, so they are never resumed.
+func (s *ParameterTemplateService) RecoverInterrupted(ctx context.Context) error {
+	items, err := s.repo.ListRollouts(ctx, "", templatedomain.RolloutRunning, 500)
+	if err != nil {
+		return err
+	}
+	for _, rollout := range items {
+		for index := range rollout.Steps {
+			switch rollout.Steps[index].Status {
+			case templatedomain.StepRunning:
+				rollout.Steps[index].Status = templatedomain.StepFailed
+				rollout.Steps[index].Message = "Manager 重启时该实例仍在执行，结果未知"
+			case templatedomain.StepPending:
+				rollout.Steps[index].Status = templatedomain.StepSkipped
+			}
+		}
+		now := time.Now().UTC()
+		rollout.Status, rollout.FinishedAt = templatedomain.RolloutFailed, &now
+		rollout.Error = "Manager 在发布期间重启，发布已停止；请确认各实例参数后重新发布或回滚"
+		rollout.UpdatedAt = now
+		if err := s.repo.SaveRollout(ctx, rollout); err != nil {
+			return err
+		}
+		if err := s.settleAttachment(ctx, rollout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ParameterTemplateService) saveRollout(ctx context.Context, rollout *templatedomain.Rollout) {
+	rollout.UpdatedAt = time.Now().UTC()
+	_ = s.repo.SaveRollout(ctx, *rollout)
+}
+
+func (s *ParameterTemplateService) ensureIdle(ctx context.Context, cluster string) error {
+	running, err := s.repo.ListRollouts(ctx, cluster, templatedomain.RolloutRunning, 1)
+	if err != nil {
+		return err
+	}
+	if len(running) > 0 {
+		return fmt.Errorf("%w：%s", ErrParameterTemplateRolloutActive, running[0].ID)
+	}
+	return nil
+}
+
+func (s *ParameterTemplateService) lastRollout(ctx context.Context, cluster string) (templatedomain.Rollout, bool, error) {
+	items, err := s.repo.ListRollouts(ctx, cluster, "", 1)
+	if err != nil || len(items) == 0 {
+		return templatedomain.Rollout{}, false, err
+	}
+	return items[0], true, nil
+}
+
+func (s *ParameterTemplateService) snapshot(ctx context.Context, machineID string, port int) (driftdomain.Snapshot, bool, error) {
+	if s.drift == nil {
+		return driftdomain.Snapshot{}, false, nil
+	}
+	return s.drift.GetSnapshot(ctx, machineID, port)
+}
+
+type parameterTemplateInstance struct {
+	machine  machinedomain.Machine
+	instance mysqlapp.Instance
+}
+
+func (s *ParameterTemplateService) clusterInstances(ctx context.Context, cluster string) ([]parameterTemplateInstance, error) {
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]parameterTemplateInstance, 0)
+	for _, instance := range instances {
+		machine, ok, err := s.machines.GetByID(ctx, instance.MachineID)
+		if err != nil {
+			return nil, err
+		}
+		if ok && machine.Cluster == cluster {
+			out = append(out, parameterTemplateInstance{machine: machine, instance: instance})
+		}
+	}
+	return out, nil
+}
+
+// resolve computes the values of a version for one instance: the memory and
+// connection settings the base profile yields on this machine, overridden by
+// the version's explicit parameters.
+func (s *ParameterTemplateService) resolve(ctx context.Context, version templatedomain.Version, instance mysqlapp.Instance) (map[string]string, error) {
+	out := make(map[string]string, len(version.Parameters)+9)
+	if version.BaseProfile != "" {
+		profile, err := mysqlapp.LoadProfile(s.configRoot, version.BaseProfile)
+		if err != nil {
+			return nil, fmt.Errorf("加载配置档案 %s 失败：%w", version.BaseProfile, err)
+		}
+		info, ok, err := s.infos.Get(ctx, instance.MachineID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || info.MemoryGB <= 0 {
+			return nil, fmt.Errorf("机器 %s 尚无内存采集信息，无法按配置档案 %s 计算参数", instance.MachineID, version.BaseProfile)
+		}
+		vars, err := mysqlapp.NewCalculator().Calculate(info, profile, mysqlapp.ConfigInput{
+			Port: instance.Port, InstanceDir: instance.InstanceDir, DataDir: instance.DataDir, BaseDir: instance.BaseDir, MyCnfPath: instance.MyCnfPath,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("实例 %s:%d 计算配置档案参数失败：%w", instance.MachineID, instance.Port, err)
+		}
+		for name, value := range mysqlapp.ProfileParameters(vars) {
+			out[name] = value
+		}
+	}
+	for name, value := range version.Parameters {
+		out[name] = value
+	}
+	return out, nil
+}
+
+// parameterTemplateChanges compares resolved values with an instance. A value
+// differs when the runtime value differs or, with a drift snapshot, when the
+// value the next start would use differs; without a snapshot the my.cnf
+// content is unknown and every parameter is written. problems lists what the
+// parameter task cannot fix.
+func parameterTemplateChanges(parameters, runtime map[string]string, snapshot *driftdomain.Snapshot) ([]templatedomain.Change, []string) {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changes := make([]templatedomain.Change, 0)
+	problems := make([]string, 0)
+	for _, name := range names {
+		want := parameters[name]
+		current, found := configDriftLookup(runtime, name)
+		if !found {
+			problems = append(problems, fmt.Sprintf("实例没有变量 %s，请确认参数名与 MySQL 版本", name))
+			continue
+		}
+		runtimeDiffers := !configDriftEqual(name, want, current, runtime)
+		configDiffers := true
+		if snapshot != nil {
+			if persisted, ok := configDriftLookup(snapshot.Persisted, name); ok && !configDriftEqual(name, want, persisted, runtime) {
+				problems = append(problems, fmt.Sprintf("mysqld-auto.cnf 持久化了 %s=%s，请先执行 RESET PERSIST %s", name, persisted, name))
+				continue
+			}
+			startup, _, ok := configDriftStartup(*snapshot, name)
+			configDiffers = !ok || !configDriftEqual(name, want, startup, runtime)
+		}
+		if !runtimeDiffers && !configDiffers {
+			continue
+		}
+		dynamic := mysqlapp.ParameterIsDynamic(name)
+		changes = append(changes, templatedomain.Change{Name: name, From: current, To: want, Dynamic: dynamic, Restart: runtimeDiffers && !dynamic})
+	}
+	return changes, problems
+}
@@ -0,0 +1,334 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	collectdomain "gmha/internal/collect"
+	driftdomain "gmha/internal/domain/configdrift"
+	machinedomain "gmha/internal/domain/machine"
+	templatedomain "gmha/internal/domain/paramtemplate"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type parameterTemplateMemoryRepo struct {
+	templates   map[string]templatedomain.Template
+	versions    map[string]templatedomain.Version
+	attachments map[string]templatedomain.Attachment
+	rollouts    []templatedomain.Rollout
+	changes     []templatedomain.InstanceChange
+}
+
+func newParameterTemplateMemoryRepo() *parameterTemplateMemoryRepo {
+	return &parameterTemplateMemoryRepo{templates: map[string]templatedomain.Template{}, versions: map[string]templatedomain.Version{}, attachments: map[string]templatedomain.Attachment{}}
+}
+
+func (r *parameterTemplateMemoryRepo) GetTemplate(_ context.Context, name string) (templatedomain.Template, bool, error) {
+	template, ok := r.templates[name]
+	return template, ok, nil
+}
+
+func (r *parameterTemplateMemoryRepo) SaveTemplate(_ context.Context, template templatedomain.Template) error {
+	r.templates[template.Name] = template
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) ListTemplates(context.Context) ([]templatedomain.Template, error) {
+	out := make([]templatedomain.Template, 0, len(r.templates))
+	for _, template := range r.templates {
+		out = append(out, template)
+	}
+	return out, nil
+}
+
+func (r *parameterTemplateMemoryRepo) DeleteTemplate(_ context.Context, name string) error {
+	delete(r.templates, name)
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) GetVersion(_ context.Context, template string, version int) (templatedomain.Version, bool, error) {
+	item, ok := r.versions[fmt.Sprintf("%s/%d", template, version)]
+	return item, ok, nil
+}
+
+func (r *parameterTemplateMemoryRepo) SaveVersion(_ context.Context, version templatedomain.Version) error {
+	r.versions[fmt.Sprintf("%s/%d", version.Template, version.Version)] = version
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) ListVersions(_ context.Context, template string) ([]templatedomain.Version, error) {
+	out := make([]templatedomain.Version, 0)
+	for _, version := range r.versions {
+		if version.Template == template {
+			out = append(out, version)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version > out[j].Version })
+	return out, nil
+}
+
+func (r *parameterTemplateMemoryRepo) GetAttachment(_ context.Context, cluster string) (templatedomain.Attachment, bool, error) {
+	attachment, ok := r.attachments[cluster]
+	return attachment, ok, nil
+}
+
+func (r *parameterTemplateMemoryRepo) SaveAttachment(_ context.Context, attachment templatedomain.Attachment) error {
+	r.attachments[attachment.Cluster] = attachment
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) DeleteAttachment(_ context.Context, cluster string) error {
+	delete(r.attachments, cluster)
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) ListAttachments(context.Context) ([]templatedomain.Attachment, error) {
+	out := make([]templatedomain.Attachment, 0, len(r.attachments))
+	for _, attachment := range r.attachments {
+		out = append(out, attachment)
+	}
+	return out, nil
+}
+
+func (r *parameterTemplateMemoryRepo) GetRollout(_ context.Context, id string) (templatedomain.Rollout, bool, error) {
+	for _, rollout := range r.rollouts {
+		if rollout.ID == id {
+			return rollout, true, nil
+		}
+	}
+	return templatedomain.Rollout{}, false, nil
+}
+
+func (r *parameterTemplateMemoryRepo) SaveRollout(_ context.Context, rollout templatedomain.Rollout) error {
+	rollout.Steps = append([]templatedomain.RolloutStep(nil), rollout.Steps...)
+	for index := range r.rollouts {
+		if r.rollouts[index].ID == rollout.ID {
+			r.rollouts[index] = rollout
+			return nil
+		}
+	}
+	r.rollouts = append(r.rollouts, rollout)
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) ListRollouts(_ context.Context, cluster, status string, limit int) ([]templatedomain.Rollout, error) {
+	out := make([]templatedomain.Rollout, 0)
+	for index := len(r.rollouts) - 1; index >= 0 && (limit <= 0 || len(out) < limit); index-- {
+		rollout := r.rollouts[index]
+		if (cluster == "" || rollout.Cluster == cluster) && (status == "" || rollout.Status == status) {
+			out = append(out, rollout)
+		}
+	}
+	return out, nil
+}
+
+func (r *parameterTemplateMemoryRepo) AppendInstanceChange(_ context.Context, change templatedomain.InstanceChange) error {
+	r.changes = append(r.changes, change)
+	return nil
+}
+
+func (r *parameterTemplateMemoryRepo) ListInstanceChanges(_ context.Context, machineID string, port int, _ int) ([]templatedomain.InstanceChange, error) {
+	out := make([]templatedomain.InstanceChange, 0)
+	for index := len(r.changes) - 1; index >= 0; index-- {
+		if r.changes[index].MachineID == machineID && r.changes[index].Port == port {
+			out = append(out, r.changes[index])
+		}
+	}
+	return out, nil
+}
+
+type parameterTemplateMachineInfos map[string]collectdomain.MachineInfo
+
+func (m parameterTemplateMachineInfos) Save(context.Context, collectdomain.MachineInfo) error {
+	return nil
+}
+
+func (m parameterTemplateMachineInfos) Get(_ context.Context, machineID string) (collectdomain.MachineInfo, bool, error) {
+	info, ok := m[machineID]
+	return info, ok, nil
+}
+
+// parameterTemplateRunnerFake keeps the live variables of every instance and
+// mirrors applied values into the drift snapshot the way the next Agent
+// report would.
+type parameterTemplateRunnerFake struct {
+	runtime map[string]map[string]string
+	drift   *configDriftMemoryRepo
+	failOn  string
+	applied []string
+}
+
+func (f *parameterTemplateRunnerFake) Collect(_ context.Context, step templatedomain.RolloutStep) (string, map[string]string, error) {
+	values := make(map[string]string)
+	for name, value := range f.runtime[step.MachineID] {
+		values[name] = value
+	}
+	return "collect-" + step.MachineID, values, nil
+}
+
+func (f *parameterTemplateRunnerFake) Apply(_ context.Context, step templatedomain.RolloutStep, changes []templatedomain.Change, restart bool) (string, error) {
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		names = append(names, change.Name)
+	}
+	f.applied = append(f.applied, step.MachineID+":"+strings.Join(names, ","))
+	if step.MachineID == f.failOn {
+		return "apply-" + step.MachineID, errors.New("my.cnf 校验失败")
+	}
+	snapshot := f.drift.snapshots[configDriftTestKey(step.MachineID, step.Port)]
+	for _, change := range changes {
+		if change.Dynamic || restart {
+			f.runtime[step.MachineID][change.Name] = change.To
+		}
+		snapshot.Config[change.Name] = change.To
+	}
+	return "apply-" + step.MachineID, nil
+}
+
+func TestParameterTemplateServiceRollsOutReplicasFirstAndRollsBack(t *testing.T) {
+	ctx := context.Background()
+	repo := newParameterTemplateMemoryRepo()
+	drift := &configDriftMemoryRepo{desired: map[string]driftdomain.Desired{}, snapshots: map[string]driftdomain.Snapshot{}}
+	runner := &parameterTemplateRunnerFake{runtime: map[string]map[string]string{}, drift: drift}
+	machines := map[string]machinedomain.Machine{}
+	instances := make([]mysqlapp.Instance, 0)
+	for index, id := range []string{"m1", "m2", "m3"} {
+		readOnly := "ON"
+		if id == "m1" {
+			readOnly = "OFF"
+		}
+		machines[id] = machinedomain.Machine{ID: id, Name: fmt.Sprintf("db-%d", index+1), IP: fmt.Sprintf("10.0.0.%d", index+1), Cluster: "orders"}
+		instances = append(instances, mysqlapp.Instance{MachineID: id, Port: 3306})
+		runner.runtime[id] = map[string]string{"read_only": readOnly, "max_connections": "500", "sync_binlog": "1", "performance_schema": "ON"}
+		drift.snapshots[configDriftTestKey(id, 3306)] = driftdomain.Snapshot{
+			Cluster: "orders", MachineID: id, Port: 3306, Runtime: runner.runtime[id],
+			Config: map[string]string{"max_connections": "500", "sync_binlog": "1"},
+		}
+	}
+	service := NewParameterTemplateService(repo, fakeArchitectureInstanceRepo{items: instances}, &schemaMachineRepo{items: machines},
+		parameterTemplateMachineInfos{"m1": {MemoryGB: 16}}, drift)
+
+	if _, err := service.CreateVersion(ctx, ParameterTemplateVersionRequest{Template: "oltp", BaseProfile: "../secrets"}); err == nil {
+		t.Fatal("profile names must not escape the profile directory")
+	}
+	v1, err := service.CreateVersion(ctx, ParameterTemplateVersionRequest{Template: "oltp", Parameters: map[string]string{"Max-Connections": "1000", "sync_binlog": "1"}, Actor: "dba"})
+	if err != nil || v1.Version != 1 || v1.Parameters["max_connections"] != "1000" {
+		t.Fatalf("v1 = %+v, %v", v1, err)
+	}
+	if _, err := service.Attach(ctx, "orders", "oltp", "dba"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteTemplate(ctx, "oltp"); err == nil {
+		t.Fatal("attached templates must not be deleted")
+	}
+
+	if _, err := service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders"}); err == nil {
+		t.Fatal("rollout without confirmation must fail")
+	}
+	rollout, err := service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders", Confirm: "orders", Actor: "dba"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollout.Steps[2].MachineID != "m1" || rollout.Steps[0].Role != driftdomain.RoleReplica || len(rollout.Steps[0].Changes) != 1 {
+		t.Fatalf("plan = %+v", rollout.Steps)
+	}
+	if _, err := service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders", Confirm: "orders"}); !errors.Is(err, ErrParameterTemplateRolloutActive) {
+		t.Fatalf("second rollout err = %v", err)
+	}
+	if rollout, err = service.RunRollout(ctx, rollout.ID, runner); err != nil || rollout.Status != templatedomain.RolloutSucceeded {
+		t.Fatalf("rollout = %+v, %v", rollout, err)
+	}
+	if got := strings.Join(runner.applied, " "); got != "m2:max_connections m3:max_connections m1:max_connections" {
+		t.Fatalf("applied = %s", got)
+	}
+	if attachment := repo.attachments["orders"]; attachment.Version != 1 || attachment.PreviousVersion != 0 {
+		t.Fatalf("attachment after v1 = %+v", attachment)
+	}
+
+	// v2 needs a restart for performance_schema; the second replica fails and
+	// the rollback restores what v2 touched, including the parameter v1 does
+	// not manage, while the untouched primary is skipped.
+	if _, err := service.CreateVersion(ctx, ParameterTemplateVersionRequest{Template: "oltp", Parameters: map[string]string{"max_connections": "2000", "sync_binlog": "1", "performance_schema": "OFF"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders", Confirm: "orders"}); !errors.Is(err, ErrParameterTemplateRestartRequired) {
+		t.Fatalf("restart guard err = %v", err)
+	}
+	rollout, err = service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders", Confirm: "orders", RestartConfirmed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.applied, runner.failOn = nil, "m3"
+	rollout, err = service.RunRollout(ctx, rollout.ID, runner)
+	if err == nil || rollout.Status != templatedomain.RolloutFailed || rollout.Steps[2].Status != templatedomain.StepSkipped || len(runner.applied) != 2 {
+		t.Fatalf("failed rollout = %+v, %v, applied %v", rollout, err, runner.applied)
+	}
+	if runner.runtime["m2"]["performance_schema"] != "OFF" || repo.attachments["orders"].Version != 1 {
+		t.Fatalf("m2 = %v, attachment = %+v", runner.runtime["m2"], repo.attachments["orders"])
+	}
+
+	plan, err := service.Plan(ctx, "orders", 0, true)
+	if err != nil || plan.ToVersion != 1 {
+		t.Fatalf("rollback plan = %+v, %v", plan, err)
+	}
+	rollout, err = service.StartRollout(ctx, ParameterTemplateRolloutRequest{Cluster: "orders", Rollback: true, Confirm: "orders", RestartConfirmed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.applied, runner.failOn = nil, ""
+	if rollout, err = service.RunRollout(ctx, rollout.ID, runner); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(runner.applied, " "); got != "m2:max_connections,performance_schema m3:performance_schema" {
+		t.Fatalf("rollback applied = %s", got)
+	}
+	if rollout.Steps[2].Status != templatedomain.StepSkipped || runner.runtime["m2"]["performance_schema"] != "ON" {
+		t.Fatalf("rollback = %+v", rollout.Steps)
+	}
+	history, _ := service.InstanceHistory(ctx, "m2", 3306, 10)
+	if len(history) != 3 || !history[0].Rollback || !history[0].Restarted || history[1].ToVersion != 2 {
+		t.Fatalf("history = %+v", history)
+	}
+	if _, err := service.Plan(ctx, "orders", 0, true); err == nil {
+		t.Fatal("v1 has no earlier version to roll back to")
+	}
+}
+
+func TestParameterTemplateServiceResolvesBaseProfileAndRecoversInterruptedRollouts(t *testing.T) {
+	ctx := context.Background()
+	repo := newParameterTemplateMemoryRepo()
+	service := NewParameterTemplateService(repo, fakeArchitectureInstanceRepo{items: []mysqlapp.Instance{{MachineID: "m1", Port: 3306}}},
+		&schemaMachineRepo{items: map[string]machinedomain.Machine{"m1": {ID: "m1", Name: "db-1", Cluster: "orders"}}},
+		parameterTemplateMachineInfos{"m1": {MemoryGB: 16}}, nil)
+	if _, err := service.CreateVersion(ctx, ParameterTemplateVersionRequest{Template: "base", BaseProfile: "default", Parameters: map[string]string{"max_connections": "321"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Attach(ctx, "orders", "base", ""); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := service.Plan(ctx, "orders", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := plan.Steps[0].Parameters
+	if parameters["max_connections"] != "321" || parameters["innodb_buffer_pool_size"] == "" || parameters["innodb_buffer_pool_instances"] == "" {
+		t.Fatalf("resolved = %+v", parameters)
+	}
+	if !strings.Contains(plan.Steps[0].Message, "尚无配置报告") {
+		t.Fatalf("step = %+v", plan.Steps[0])
+	}
+
+	_ = repo.SaveRollout(ctx, templatedomain.Rollout{ID: "r1", Cluster: "orders", Template: "base", Status: templatedomain.RolloutRunning,
+		Steps: []templatedomain.RolloutStep{{MachineID: "m1", Status: templatedomain.StepRunning}}})
+	if err := service.RecoverInterrupted(ctx); err != nil {
+		t.Fatal(err)
+	}
+	recovered, _ := service.Rollout(ctx, "r1")
+	if recovered.Status != templatedomain.RolloutFailed || recovered.Steps[0].Status != templatedomain.StepFailed {
+		t.Fatalf("recovered = %+v", recovered)
+	}
+}
@@ -0,0 +1,836 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	machinedomain "gmha/internal/domain/machine"
+	proxysqldomain "gmha/internal/domain/proxysql"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	proxySQLServerMarker = "__GMHA_PROXYSQL_SERVER__"
+	proxySQLRoleMarker   = "__GMHA_PROXYSQL_ROLE__"
+)
+
+// ClusterRouteSynchronizer refreshes an external routing layer after the
+// architecture executor has changed the primary. Implementations must apply
+// the complete backend set in one step so clients never see a mixed topology.
+type ClusterRouteSynchronizer interface {
+	ClusterRoutesConfigured(ctx context.Context, clusterID string) bool
+	SyncClusterRoutes(ctx context.Context, clusterID string, topology ClusterRouteTopology) ([]string, error)
+}
+
+// ClusterRouteTopology is the post-switchover view handed to route
+// synchronizers. Backends include the primary.
+type ClusterRouteTopology struct {
+	RunID            string
+	PrimaryMachineID string
+	Backends         []ClusterRouteBackend
+}
+
+type ClusterRouteBackend struct {
+	MachineID string
+	Host      string
+	Port      int
+}
+
+type ProxySQLDeployRequest struct {
+	PackageName string   `json:"package_name,omitempty"`
+	MachineIDs  []string `json:"machine_ids,omitempty"`
+}
+
+type ProxySQLService struct {
+	repo        proxysqldomain.Repository
+	tasks       *TaskService
+	machines    machinedomain.Repository
+	instances   MySQLInstanceRepository
+	presets     MySQLAccountPresetRepository
+	packages    *PackageService
+	machineInfo MachineInfoSaver
+	managerAddr func(targetIP string) string
+	mu          sync.Mutex
+}
+
+func NewProxySQLService(repo proxysqldomain.Repository, tasks *TaskService, machines machinedomain.Repository, instances MySQLInstanceRepository, presets MySQLAccountPresetRepository) *ProxySQLService {
+	return &ProxySQLService{repo: repo, tasks: tasks, machines: machines, instances: instances, presets: presets}
+}
+
+// ConfigurePackageSource lets Deploy download ProxySQL from the Manager
+// package store through the same address resolution used by MySQL installs.
+func (s *ProxySQLService) ConfigurePackageSource(packages *PackageService, machineInfo MachineInfoSaver, managerAddr func(targetIP string) string) {
+	s.packages, s.machineInfo, s.managerAddr = packages, machineInfo, managerAddr
+}
+
+func (s *ProxySQLService) GetConfig(ctx context.Context, clusterID string) (proxysqldomain.Config, bool, error) {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	if err != nil || !ok {
+		return proxysqldomain.Config{}, ok, err
+	}
+	return config.Redacted(), true, nil
+}
+
+// SaveConfig validates and stores the routing configuration. Passwords left
+// empty keep their stored value so the redacted view can be edited and saved.
+func (s *ProxySQLService) SaveConfig(ctx context.Context, config proxysqldomain.Config) (proxysqldomain.Config, error) {
+	config.ClusterID = strings.TrimSpace(config.ClusterID)
+	if config.ClusterID == "" {
+		return proxysqldomain.Config{}, errors.New("cluster_id is required")
+	}
+	existing, exists, err := s.repo.GetConfig(ctx, config.ClusterID)
+	if err != nil {
+		return proxysqldomain.Config{}, err
+	}
+	if config.AdminPassword == "" && exists {
+		config.AdminPassword = existing.AdminPassword
+	}
+	if exists {
+		stored := make(map[string]string, len(existing.Users))
+		for _, user := range existing.Users {
+			stored[user.Username] = user.Password
+		}
+		for index := range config.Users {
+			if config.Users[index].Password == "" {
+				config.Users[index].Password = stored[strings.TrimSpace(config.Users[index].Username)]
+			}
+		}
+	}
+	config = normalizeProxySQLConfig(config)
+	if err := validateProxySQLConfig(config); err != nil {
+		return proxysqldomain.Config{}, err
+	}
+	for _, machineID := range config.ProxyMachineIDs {
+		machine, ok, err := s.machines.GetByID(ctx, machineID)
+		if err != nil {
+			return proxysqldomain.Config{}, err
+		}
+		if !ok {
+			return proxysqldomain.Config{}, fmt.Errorf("ProxySQL 节点 %s 不存在", machineID)
+		}
+		if machine.Status != machinedomain.StatusAgentOnline {
+			return proxysqldomain.Config{}, fmt.Errorf("ProxySQL 节点 %s 的 Agent 不在线", machine.Name)
+		}
+	}
+	now := time.Now().UTC()
+	config.CreatedAt, config.UpdatedAt = now, now
+	if exists {
+		config.CreatedAt = existing.CreatedAt
+	}
+	if err := s.repo.SaveConfig(ctx, config); err != nil {
+		return proxysqldomain.Config{}, err
+	}
+	return config.Redacted(), nil
+}
+
+func (s *ProxySQLService) DeleteConfig(ctx context.Context, clusterID string) error {
+	return s.repo.DeleteConfig(ctx, clusterID)
+}
+
+func (s *ProxySQLService) ListSyncEvents(ctx context.Context, clusterID string, limit int) ([]proxysqldomain.SyncEvent, error) {
+	return s.repo.ListSyncEvents(ctx, clusterID, limit)
+}
+
+// Deploy installs ProxySQL from the Manager package store on every configured
+// proxy node, sets admin and monitor credentials, then pushes the full
+// backend/user/rule configuration derived from the live topology.
+func (s *ProxySQLService) Deploy(ctx context.Context, clusterID string, req ProxySQLDeployRequest) (TaskDetail, error) {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	if !ok {
+		return TaskDetail{}, errors.New("集群尚未配置 ProxySQL")
+	}
+	if s.packages == nil {
+		return TaskDetail{}, errors.New("安装包仓库未配置")
+	}
+	targets := config.ProxyMachineIDs
+	if len(req.MachineIDs) > 0 {
+		targets = req.MachineIDs
+	}
+	machines := make([]machinedomain.Machine, 0, len(targets))
+	for _, machineID := range targets {
+		machine, ok, err := s.machines.GetByID(ctx, strings.TrimSpace(machineID))
+		if err != nil {
+			return TaskDetail{}, err
+		}
+		if !ok || !slices.Contains(config.ProxyMachineIDs, machine.ID) {
+			return TaskDetail{}, fmt.Errorf("节点 %s 不是该集群的 ProxySQL 节点", machineID)
+		}
+		machines = append(machines, machine)
+	}
+	packageNames := make(map[string]string, len(machines))
+	for _, machine := range machines {
+		name, err := s.resolveProxySQLPackage(ctx, machine.ID, req.PackageName)
+		if err != nil {
+			return TaskDetail{}, err
+		}
+		packageNames[machine.ID] = name
+	}
+	monitorUser, monitorPassword, err := s.monitorAccount(ctx)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "proxysql_deploy", "部署 ProxySQL "+config.ClusterID, config.ClusterID)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	go s.runDeploy(context.Background(), parent.Task.ID, config, machines, packageNames, monitorUser, monitorPassword)
+	return parent, nil
+}
+
+func (s *ProxySQLService) runDeploy(ctx context.Context, parentID string, config proxysqldomain.Config, machines []machinedomain.Machine, packageNames map[string]string, monitorUser, monitorPassword string) {
+	created, failed := 0, 0
+	for _, machine := range machines {
+		downloadURL := s.packageURL(machine.IP, packageNames[machine.ID])
+		command := proxySQLInstallCommand(config, packageNames[machine.ID], downloadURL, monitorUser, monitorPassword)
+		taskID, _, err := s.tasks.RunExecTask(ctx, machine.IP, command, ExecTaskOptions{
+			ParentTaskID: parentID, Operation: "proxysql_install", DisplayName: "安装 ProxySQL " + machine.Name, StepName: "安装并初始化 ProxySQL",
+		}, 10*time.Minute)
+		if taskID != "" {
+			created++
+		}
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		event, err := s.sync(ctx, config, proxysqldomain.SyncReasonDeploy, ClusterRouteTopology{}, parentID, true)
+		created += len(event.TaskIDs)
+		if err != nil && len(event.TaskIDs) == 0 {
+			failed++
+		}
+	}
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, parentID, created, failed)
+}
+
+// SyncNow reapplies backends, users and query rules from the live topology.
+func (s *ProxySQLService) SyncNow(ctx context.Context, clusterID string) (proxysqldomain.SyncEvent, error) {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	if err != nil {
+		return proxysqldomain.SyncEvent{}, err
+	}
+	if !ok {
+		return proxysqldomain.SyncEvent{}, errors.New("集群尚未配置 ProxySQL")
+	}
+	return s.sync(ctx, config, proxysqldomain.SyncReasonManual, ClusterRouteTopology{}, "", true)
+}
+
+func (s *ProxySQLService) ClusterRoutesConfigured(ctx context.Context, clusterID string) bool {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	return err == nil && ok && config.Enabled && len(config.ProxyMachineIDs) > 0
+}
+
+// SyncClusterRoutes is invoked by architecture runs (switchovers, cluster
+// upgrades and failovers) after the new primary is verified. Only backends are
+// rewritten there; users and rules do not depend on the topology.
+func (s *ProxySQLService) SyncClusterRoutes(ctx context.Context, clusterID string, topology ClusterRouteTopology) ([]string, error) {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !config.Enabled {
+		return nil, nil
+	}
+	event, err := s.sync(ctx, config, proxysqldomain.SyncReasonArchitecture, topology, "", false)
+	return event.TaskIDs, err
+}
+
+func (s *ProxySQLService) sync(ctx context.Context, config proxysqldomain.Config, reason string, topology ClusterRouteTopology, parentID string, full bool) (proxysqldomain.SyncEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event := proxysqldomain.SyncEvent{
+		ID: newEntityID("proxysql-sync"), ClusterID: config.ClusterID, Reason: reason, RunID: topology.RunID,
+		Status: proxysqldomain.SyncStatusSuccess, CreatedAt: time.Now().UTC(),
+	}
+	finish := func(err error) (proxysqldomain.SyncEvent, error) {
+		if err != nil {
+			event.Status, event.Error = proxysqldomain.SyncStatusFailed, err.Error()
+		}
+		_ = s.repo.SaveSyncEvent(context.Background(), event)
+		return event, err
+	}
+	if topology.PrimaryMachineID == "" {
+		live, taskIDs, err := s.liveTopology(ctx, config, parentID)
+		event.TaskIDs = append(event.TaskIDs, taskIDs...)
+		if err != nil {
+			return finish(err)
+		}
+		topology = live
+	}
+	event.PrimaryMachineID = topology.PrimaryMachineID
+	event.Backends = proxySQLExpectedBackends(config, topology)
+	script := proxySQLBackendSQL(config, event.Backends)
+	if full {
+		script += proxySQLUsersSQL(config) + proxySQLQueryRulesSQL(config)
+	}
+	var failures []string
+	for _, machineID := range config.ProxyMachineIDs {
+		machine, ok, err := s.machines.GetByID(ctx, machineID)
+		if err != nil || !ok {
+			failures = append(failures, fmt.Sprintf("%s: machine not found", machineID))
+			continue
+		}
+		taskID, _, err := s.tasks.RunExecTask(ctx, machine.IP, proxySQLAdminCommand(config, script), ExecTaskOptions{
+			ParentTaskID: parentID, Operation: "proxysql_sync", DisplayName: "同步 ProxySQL 路由 " + machine.Name, StepName: "刷新 ProxySQL 主机组",
+		}, 2*time.Minute)
+		if taskID != "" {
+			event.TaskIDs = append(event.TaskIDs, taskID)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", machine.Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return finish(errors.New("ProxySQL 路由同步失败：" + strings.Join(failures, "; ")))
+	}
+	return finish(nil)
+}
+
+// Health compares runtime_mysql_servers on every proxy node with the backend
+// set GMHA expects for the current live primary.
+func (s *ProxySQLService) Health(ctx context.Context, clusterID string) (proxysqldomain.HealthReport, error) {
+	config, ok, err := s.repo.GetConfig(ctx, strings.TrimSpace(clusterID))
+	if err != nil {
+		return proxysqldomain.HealthReport{}, err
+	}
+	if !ok {
+		return proxysqldomain.HealthReport{}, errors.New("集群尚未配置 ProxySQL")
+	}
+	report := proxysqldomain.HealthReport{ClusterID: config.ClusterID, Healthy: true, CheckedAt: time.Now().UTC(), Nodes: make([]proxysqldomain.NodeHealth, 0)}
+	topology, _, err := s.liveTopology(ctx, config, "")
+	if err != nil {
+		return report, err
+	}
+	report.PrimaryMachineID = topology.PrimaryMachineID
+	report.Expected = proxySQLExpectedBackends(config, topology)
+	query := fmt.Sprintf("SELECT '%s', hostgroup_id, hostname, port, status FROM runtime_mysql_servers WHERE hostgroup_id IN (%d,%d) ORDER BY hostgroup_id, hostname, port;",
+		proxySQLServerMarker, config.WriterHostgroup, config.ReaderHostgroup)
+	for _, machineID := range config.ProxyMachineIDs {
+		node := proxysqldomain.NodeHealth{MachineID: machineID, Runtime: make([]proxysqldomain.Backend, 0), Drift: make([]proxysqldomain.Drift, 0)}
+		machine, ok, err := s.machines.GetByID(ctx, machineID)
+		if err != nil || !ok {
+			node.Error = "machine not found"
+			report.Healthy = false
+			report.Nodes = append(report.Nodes, node)
+			continue
+		}
+		node.MachineName, node.MachineIP = machine.Name, machine.IP
+		taskID, output, err := s.tasks.RunExecTask(ctx, machine.IP, proxySQLAdminCommand(config, query), ExecTaskOptions{
+			Operation: "proxysql_health", DisplayName: "检查 ProxySQL 路由 " + machine.Name, StepName: "读取 runtime_mysql_servers",
+		}, time.Minute)
+		node.TaskID = taskID
+		if err != nil {
+			node.Error = err.Error()
+			report.Healthy = false
+			report.Nodes = append(report.Nodes, node)
+			continue
+		}
+		node.Reachable = true
+		node.Runtime = parseProxySQLRuntimeServers(output)
+		node.Drift = compareProxySQLBackends(report.Expected, node.Runtime)
+		if len(node.Drift) > 0 {
+			report.Healthy = false
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+	return report, nil
+}
+
+// liveTopology probes every cluster MySQL instance and picks the writable node
+// without a replication channel as the primary.
+func (s *ProxySQLService) liveTopology(ctx context.Context, config proxysqldomain.Config, parentID string) (ClusterRouteTopology, []string, error) {
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return ClusterRouteTopology{}, nil, err
+	}
+	byID := make(map[string]machinedomain.Machine)
+	for _, machine := range machines {
+		if machine.Cluster == config.ClusterID {
+			byID[machine.ID] = machine
+		}
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return ClusterRouteTopology{}, nil, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].MachineID == instances[j].MachineID {
+			return instances[i].Port < instances[j].Port
+		}
+		return instances[i].MachineID < instances[j].MachineID
+	})
+	topology := ClusterRouteTopology{}
+	var taskIDs []string
+	var primaries []string
+	for _, instance := range instances {
+		machine, ok := byID[instance.MachineID]
+		if !ok || (config.BackendPort > 0 && instance.Port != config.BackendPort) || instance.Status == mysqlapp.StatusStopped {
+			continue
+		}
+		sql := fmt.Sprintf("SELECT '%s', @@global.read_only, (SELECT COUNT(*) FROM performance_schema.replication_connection_configuration);", proxySQLRoleMarker)
+		taskID, output, err := s.tasks.RunExecTask(ctx, machine.IP, mysqlArchitectureCommand("", instance.Port, sql), ExecTaskOptions{
+			ParentTaskID: parentID, Operation: "proxysql_topology_probe", DisplayName: "探测 ProxySQL 后端角色 " + machine.Name, StepName: "读取 read_only 与复制通道", Port: instance.Port,
+		}, 45*time.Second)
+		if taskID != "" {
+			taskIDs = append(taskIDs, taskID)
+		}
+		if err != nil {
+			continue
+		}
+		topology.Backends = append(topology.Backends, ClusterRouteBackend{MachineID: machine.ID, Host: machine.IP, Port: instance.Port})
+		if readOnly, channels, ok := parseProxySQLRole(output); ok && readOnly == 0 && channels == 0 {
+			primaries = append(primaries, machine.ID)
+		}
+	}
+	switch len(primaries) {
+	case 0:
+		return topology, taskIDs, errors.New("未探测到可写主库，拒绝刷新 ProxySQL 路由")
+	case 1:
+		topology.PrimaryMachineID = primaries[0]
+		return topology, taskIDs, nil
+	default:
+		return topology, taskIDs, fmt.Errorf("探测到多个可写主库 %s，拒绝刷新 ProxySQL 路由", strings.Join(primaries, ","))
+	}
+}
+
+func (s *ProxySQLService) resolveProxySQLPackage(ctx context.Context, machineID, requested string) (string, error) {
+	items, err := s.packages.List("proxysql", "")
+	if err != nil {
+		return "", err
+	}
+	requested = strings.TrimSpace(requested)
+	arch := ""
+	if s.machineInfo != nil {
+		if info, ok, err := s.machineInfo.Get(ctx, machineID); err == nil && ok {
+			arch = normalizePackageArch(info.Arch)
+		}
+	}
+	for _, item := range items {
+		if requested != "" {
+			if item.Name == requested {
+				return item.Name, nil
+			}
+			continue
+		}
+		if arch == "" || normalizePackageArch(item.Arch) == arch {
+			return item.Name, nil
+		}
+	}
+	if requested != "" {
+		return "", fmt.Errorf("安装包仓库中不存在 ProxySQL 安装包 %s", requested)
+	}
+	return "", fmt.Errorf("安装包仓库中没有匹配架构 %s 的 ProxySQL 安装包", arch)
+}
+
+func (s *ProxySQLService) packageURL(targetIP, name string) string {
+	path := "/api/v1/packages/proxysql/" + url.PathEscape(name)
+	if s.managerAddr == nil {
+		return path
+	}
+	base := strings.TrimRight(strings.TrimSpace(strings.Split(s.managerAddr(targetIP), ",")[0]), "/")
+	return base + path
+}
+
+// ProxySQLMonitorTarget is one ProxySQL node of an enabled cluster. Its
+// mysql-monitor credentials follow the monitor account preset.
+type ProxySQLMonitorTarget struct {
+	Cluster     string
+	MachineID   string
+	MachineName string
+	MachineIP   string
+}
+
+// MonitorTargets lists the ProxySQL nodes whose monitor credentials must
+// change together with the monitor account password.
+func (s *ProxySQLService) MonitorTargets(ctx context.Context) ([]ProxySQLMonitorTarget, error) {
+	configs, err := s.repo.ListConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ProxySQLMonitorTarget, 0)
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+		for _, machineID := range config.ProxyMachineIDs {
+			machine, ok, err := s.machines.GetByID(ctx, machineID)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("ProxySQL 节点 %s 不存在", machineID)
+			}
+			out = append(out, ProxySQLMonitorTarget{Cluster: config.ClusterID, MachineID: machine.ID, MachineName: machine.Name, MachineIP: machine.IP})
+		}
+	}
+	return out, nil
+}
+
+// UpdateMonitorCredential rewrites mysql-monitor_username/password on one
+// ProxySQL node, persists them and reads the runtime value back.
+func (s *ProxySQLService) UpdateMonitorCredential(ctx context.Context, target ProxySQLMonitorTarget, parentTaskID, user, password string) (string, error) {
+	config, ok, err := s.repo.GetConfig(ctx, target.Cluster)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("集群 %s 尚未配置 ProxySQL", target.Cluster)
+	}
+	config = normalizeProxySQLConfig(config)
+	setup := strings.Join([]string{
+		"UPDATE global_variables SET variable_value=" + sqlLiteral(user) + " WHERE variable_name='mysql-monitor_username'",
+		"UPDATE global_variables SET variable_value=" + sqlLiteral(password) + " WHERE variable_name='mysql-monitor_password'",
+		"LOAD MYSQL VARIABLES TO RUNTIME", "SAVE MYSQL VARIABLES TO DISK",
+	}, ";") + ";"
+	check := "SELECT COUNT(*) FROM runtime_global_variables WHERE (variable_name='mysql-monitor_username' AND variable_value=" + sqlLiteral(user) + ") OR (variable_name='mysql-monitor_password' AND variable_value=" + sqlLiteral(password) + ")"
+	command := strings.Join([]string{
+		"set -e",
+		proxySQLAdminCommand(config, setup),
+		"test \"$(" + proxySQLAdminCommand(config, check) + ")\" = 2 || { echo 'ProxySQL runtime monitor credentials do not match' >&2; exit 1; }",
+		"echo proxysql_monitor_credentials_updated",
+	}, "\n")
+	machine := machinedomain.Machine{ID: target.MachineID, Name: target.MachineName, IP: target.MachineIP}
+	taskID, _, err := s.tasks.RunExecTask(ctx, machine.IP, command, ExecTaskOptions{
+		ParentTaskID: parentTaskID, Operation: "proxysql_monitor_credential", DisplayName: "更新 ProxySQL 监控账号 " + target.MachineName, StepName: "更新 mysql-monitor 密码",
+	}, 2*time.Minute)
+	return taskID, err
+}
+
+// monitorAccount 返回写入 ProxySQL mysql-monitor_username/password 的账号，
+// 只取操作员保存并启用的 monitor 账号预设（不与内置默认值合并）；没有可用预设时
+// 报错，而不是退回内置默认密码。
+func (s *ProxySQLService) monitorAccount(ctx context.Context) (string, string, error) {
+	if s.presets == nil {
+		return "", "", errors.New("MySQL 账号预设未配置，无法确定 ProxySQL 监控账号")
+	}
+	saved, err := s.presets.List(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("读取 MySQL 账号预设失败: %w", err)
+	}
+	for _, item := range saved {
+		if strings.EqualFold(strings.TrimSpace(item.Role), mysqlapp.AccountRoleMonitor) && item.Enabled && strings.TrimSpace(item.Username) != "" && item.Password != "" {
+			return strings.TrimSpace(item.Username), item.Password, nil
+		}
+	}
+	return "", "", errors.New("没有启用的 monitor 账号预设，请先在 MySQL 账号预设中配置并启用 monitor 账号")
+}
+
+func normalizeProxySQLConfig(config proxysqldomain.Config) proxysqldomain.Config {
+	if config.AdminPort <= 0 {
+		config.AdminPort = proxysqldomain.DefaultAdminPort
+	}
+	if config.ListenPort <= 0 {
+		config.ListenPort = proxysqldomain.DefaultListenPort
+	}
+	if config.WriterHostgroup <= 0 {
+		config.WriterHostgroup = proxysqldomain.DefaultWriterHostgroup
+	}
+	if config.ReaderHostgroup <= 0 {
+		config.ReaderHostgroup = proxysqldomain.DefaultReaderHostgroup
+	}
+	if config.MaxReplicationLagSeconds <= 0 {
+		config.MaxReplicationLagSeconds = proxysqldomain.DefaultMaxReplicationLagSeconds
+	}
+	config.AdminUser = strings.TrimSpace(config.AdminUser)
+	if config.AdminUser == "" {
+		config.AdminUser = "admin"
+	}
+	ids := make([]string, 0, len(config.ProxyMachineIDs))
+	for _, id := range config.ProxyMachineIDs {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	config.ProxyMachineIDs = ids
+	for index := range config.Users {
+		config.Users[index].Username = strings.TrimSpace(config.Users[index].Username)
+		if config.Users[index].DefaultHostgroup <= 0 {
+			config.Users[index].DefaultHostgroup = config.WriterHostgroup
+		}
+		if config.Users[index].MaxConnections <= 0 {
+			config.Users[index].MaxConnections = 10000
+		}
+	}
+	if config.QueryRules == nil {
+		config.QueryRules = defaultProxySQLQueryRules()
+	}
+	for index := range config.QueryRules {
+		config.QueryRules[index].Destination = strings.ToLower(strings.TrimSpace(config.QueryRules[index].Destination))
+	}
+	return config
+}
+
+// defaultProxySQLQueryRules implements classic read/write splitting: locking
+// reads stay on the writer and plain SELECTs go to the reader hostgroup.
+func defaultProxySQLQueryRules() []proxysqldomain.QueryRule {
+	return []proxysqldomain.QueryRule{
+		{RuleID: 100, Active: true, MatchDigest: `^SELECT.*FOR UPDATE`, Destination: proxysqldomain.DestinationWriter, Apply: true, Comment: "locking reads"},
+		{RuleID: 200, Active: true, MatchDigest: `^SELECT`, Destination: proxysqldomain.DestinationReader, Apply: true, Comment: "read split"},
+	}
+}
+
+func validateProxySQLConfig(config proxysqldomain.Config) error {
+	if config.Enabled && len(config.ProxyMachineIDs) == 0 {
+		return errors.New("启用 ProxySQL 时至少需要一个代理节点")
+	}
+	if config.WriterHostgroup == config.ReaderHostgroup {
+		return errors.New("写主机组与读主机组不能相同")
+	}
+	if config.AdminPort > 65535 || config.ListenPort > 65535 || config.BackendPort < 0 || config.BackendPort > 65535 {
+		return errors.New("端口必须在 1-65535 之间")
+	}
+	if config.AdminPort == config.ListenPort {
+		return errors.New("管理端口与业务端口不能相同")
+	}
+	if config.Enabled && config.AdminPassword == "" {
+		return errors.New("ProxySQL 管理密码不能为空")
+	}
+	if strings.ContainsAny(config.AdminUser+config.AdminPassword, ":;") {
+		return errors.New("ProxySQL 管理账号和密码不能包含 ':' 或 ';'")
+	}
+	seenUsers := map[string]bool{}
+	for _, user := range config.Users {
+		if user.Username == "" {
+			return errors.New("ProxySQL 账号用户名不能为空")
+		}
+		if seenUsers[user.Username] {
+			return fmt.Errorf("ProxySQL 账号 %s 重复", user.Username)
+		}
+		seenUsers[user.Username] = true
+		if user.Password == "" {
+			return fmt.Errorf("ProxySQL 账号 %s 缺少密码", user.Username)
+		}
+	}
+	seenRules := map[int]bool{}
+	for _, rule := range config.QueryRules {
+		if rule.RuleID <= 0 {
+			return errors.New("查询规则 rule_id 必须为正整数")
+		}
+		if seenRules[rule.RuleID] {
+			return fmt.Errorf("查询规则 %d 重复", rule.RuleID)
+		}
+		seenRules[rule.RuleID] = true
+		if rule.Destination != proxysqldomain.DestinationWriter && rule.Destination != proxysqldomain.DestinationReader {
+			return fmt.Errorf("查询规则 %d 的 destination 只能是 writer 或 reader", rule.RuleID)
+		}
+		if strings.TrimSpace(rule.MatchDigest) == "" && strings.TrimSpace(rule.MatchPattern) == "" {
+			return fmt.Errorf("查询规则 %d 缺少 match_digest 或 match_pattern", rule.RuleID)
+		}
+	}
+	return nil
+}
+
+// proxySQLExpectedBackends maps the topology onto writer/reader hostgroups.
+// The primary also serves reads when requested or when no replica exists, so
+// the reader hostgroup never becomes empty.
+func proxySQLExpectedBackends(config proxysqldomain.Config, topology ClusterRouteTopology) []proxysqldomain.Backend {
+	var primary *ClusterRouteBackend
+	replicas := make([]ClusterRouteBackend, 0, len(topology.Backends))
+	for index := range topology.Backends {
+		backend := topology.Backends[index]
+		if backend.MachineID == topology.PrimaryMachineID && primary == nil {
+			primary = &topology.Backends[index]
+			continue
+		}
+		replicas = append(replicas, backend)
+	}
+	out := make([]proxysqldomain.Backend, 0, len(topology.Backends)+2)
+	if primary == nil {
+		return out
+	}
+	online := "ONLINE"
+	out = append(out, proxysqldomain.Backend{Hostgroup: config.WriterHostgroup, Hostname: primary.Host, Port: primary.Port, Status: online, MachineID: primary.MachineID})
+	if config.ReadersIncludePrimary || len(replicas) == 0 {
+		out = append(out, proxysqldomain.Backend{Hostgroup: config.ReaderHostgroup, Hostname: primary.Host, Port: primary.Port, Status: online, MachineID: primary.MachineID})
+	}
+	for _, replica := range replicas {
+		out = append(out, proxysqldomain.Backend{Hostgroup: config.ReaderHostgroup, Hostname: replica.Host, Port: replica.Port, Status: online, MachineID: replica.MachineID})
+	}
+	return out
+}
+
+// proxySQLBackendSQL rewrites both managed hostgroups in the admin memory
+// layer and promotes them with a single LOAD ... TO RUNTIME, which ProxySQL
+// applies atomically.
+func proxySQLBackendSQL(config proxysqldomain.Config, backends []proxysqldomain.Backend) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "DELETE FROM mysql_servers WHERE hostgroup_id IN (%d,%d);", config.WriterHostgroup, config.ReaderHostgroup)
+	for _, backend := range backends {
+		lag := 0
+		if backend.Hostgroup == config.ReaderHostgroup {
+			lag = config.MaxReplicationLagSeconds
+		}
+		fmt.Fprintf(&builder, "INSERT INTO mysql_servers(hostgroup_id,hostname,port,status,max_replication_lag,comment) VALUES (%d,%s,%d,'ONLINE',%d,%s);",
+			backend.Hostgroup, sqlLiteral(backend.Hostname), backend.Port, lag, sqlLiteral("gmha:"+backend.MachineID))
+	}
+	builder.WriteString("LOAD MYSQL SERVERS TO RUNTIME;SAVE MYSQL SERVERS TO DISK;")
+	return builder.String()
+}
+
+func proxySQLUsersSQL(config proxysqldomain.Config) string {
+	var builder strings.Builder
+	builder.WriteString("DELETE FROM mysql_users WHERE comment='gmha';")
+	for _, user := range config.Users {
+		fmt.Fprintf(&builder, "INSERT INTO mysql_users(username,password,active,default_hostgroup,max_connections,comment) VALUES (%s,%s,%d,%d,%d,'gmha');",
+			sqlLiteral(user.Username), sqlLiteral(user.Password), boolToInt(user.Active), user.DefaultHostgroup, user.MaxConnections)
+	}
+	builder.WriteString("LOAD MYSQL USERS TO RUNTIME;SAVE MYSQL USERS TO DISK;")
+	return builder.String()
+}
+
+func proxySQLQueryRulesSQL(config proxysqldomain.Config) string {
+	var builder strings.Builder
+	builder.WriteString("DELETE FROM mysql_query_rules WHERE comment LIKE 'gmha:%';")
+	for _, rule := range config.QueryRules {
+		hostgroup := config.WriterHostgroup
+		if rule.Destination == proxysqldomain.DestinationReader {
+			hostgroup = config.ReaderHostgroup
+		}
+		fmt.Fprintf(&builder, "INSERT INTO mysql_query_rules(rule_id,active,username,match_digest,match_pattern,destination_hostgroup,apply,comment) VALUES (%d,%d,%s,%s,%s,%d,%d,%s);",
+			rule.RuleID, boolToInt(rule.Active), proxySQLNullable(rule.Username), proxySQLNullable(rule.MatchDigest), proxySQLNullable(rule.MatchPattern),
+			hostgroup, boolToInt(rule.Apply), sqlLiteral("gmha:"+rule.Comment))
+	}
+	builder.WriteString("LOAD MYSQL QUERY RULES TO RUNTIME;SAVE MYSQL QUERY RULES TO DISK;")
+	return builder.String()
+}
+
+func proxySQLNullable(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "NULL"
+	}
+	return sqlLiteral(value)
+}
+
+func proxySQLAdminClient(config proxysqldomain.Config, user, password string) string {
+	return fmt.Sprintf("MYSQL_PWD=%s mysql --protocol=tcp --host=127.0.0.1 --port=%d --user=%s --connect-timeout=5 --batch --raw --skip-column-names",
+		shellQuote(password), config.AdminPort, shellQuote(user))
+}
+
+func proxySQLAdminCommand(config proxysqldomain.Config, sql string) string {
+	return proxySQLAdminClient(config, config.AdminUser, config.AdminPassword) + " --execute=" + shellQuote(sql)
+}
+
+// proxySQLInstallCommand installs the package, starts the service and moves
+// admin/monitor credentials away from the factory defaults. Re-running it on
+// an initialized node keeps the configured admin password working.
+func proxySQLInstallCommand(config proxysqldomain.Config, packageName, downloadURL, monitorUser, monitorPassword string) string {
+	file := "/tmp/gmha-proxysql/" + packageName
+	credentials := config.AdminUser + ":" + config.AdminPassword
+	if config.AdminUser != "admin" {
+		credentials = "admin:" + config.AdminPassword + ";" + credentials
+	}
+	setup := strings.Join([]string{
+		"UPDATE global_variables SET variable_value=" + sqlLiteral(credentials) + " WHERE variable_name='admin-admin_credentials'",
+		"UPDATE global_variables SET variable_value=" + sqlLiteral(monitorUser) + " WHERE variable_name='mysql-monitor_username'",
+		"UPDATE global_variables SET variable_value=" + sqlLiteral(monitorPassword) + " WHERE variable_name='mysql-monitor_password'",
+		"UPDATE global_variables SET variable_value=" + sqlLiteral("0.0.0.0:"+strconv.Itoa(config.ListenPort)) + " WHERE variable_name='mysql-interfaces'",
+		"LOAD ADMIN VARIABLES TO RUNTIME", "SAVE ADMIN VARIABLES TO DISK",
+		"LOAD MYSQL VARIABLES TO RUNTIME", "SAVE MYSQL VARIABLES TO DISK",
+	}, ";") + ";"
+	configured := proxySQLAdminClient(config, config.AdminUser, config.AdminPassword)
+	factory := proxySQLAdminClient(config, "admin", "admin")
+	return strings.Join([]string{
+		"set -e",
+		"command -v mysql >/dev/null 2>&1 || { echo 'mysql client is required on the ProxySQL node' >&2; exit 1; }",
+		"mkdir -p /tmp/gmha-proxysql",
+		"curl -fsSL -o " + shellQuote(file) + " " + shellQuote(downloadURL) + " || wget -q -O " + shellQuote(file) + " " + shellQuote(downloadURL),
+		"case " + shellQuote(file) + " in *.deb) dpkg -i " + shellQuote(file) + " ;; *.rpm) rpm -Uvh --replacepkgs " + shellQuote(file) + " ;; *) echo 'unsupported ProxySQL package format' >&2; exit 1 ;; esac",
+		"systemctl enable proxysql >/dev/null 2>&1 || true",
+		"systemctl start proxysql",
+		"client=''; for i in $(seq 1 30); do if " + configured + " --execute='SELECT 1' >/dev/null 2>&1; then client=configured; break; fi; if " + factory + " --execute='SELECT 1' >/dev/null 2>&1; then client=factory; break; fi; sleep 1; done",
+		"if [ \"$client\" = configured ]; then " + configured + " --execute=" + shellQuote(setup) + "; elif [ \"$client\" = factory ]; then " + factory + " --execute=" + shellQuote(setup) + "; else echo 'ProxySQL admin interface is not reachable' >&2; exit 1; fi",
+		"current=$(" + configured + " --execute=\"SELECT variable_value FROM runtime_global_variables WHERE variable_name='mysql-interfaces'\" 2>/dev/null || true)",
+		"case \"$current\" in *:" + strconv.Itoa(config.ListenPort) + "*) ;; *) systemctl restart proxysql ;; esac",
+		"rm -f " + shellQuote(file),
+		"echo proxysql_ready",
+	}, "\n")
+}
+
+func parseProxySQLRuntimeServers(output string) []proxysqldomain.Backend {
+	out := make([]proxysqldomain.Backend, 0)
+	for _, line := range strings.Split(output, "\n") {
+		index := strings.Index(line, proxySQLServerMarker+"\t")
+		if index < 0 {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(line[index:]), "\t")
+		if len(parts) < 5 {
+			continue
+		}
+		hostgroup, err := strconv.Atoi(parts[1])
+		if err != nil {
+			continue
+		}
+		port, _ := strconv.Atoi(parts[3])
+		out = append(out, proxysqldomain.Backend{Hostgroup: hostgroup, Hostname: parts[2], Port: port, Status: strings.ToUpper(parts[4])})
+	}
+	return out
+}
+
+func parseProxySQLRole(output string) (int, int, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		index := strings.Index(line, proxySQLRoleMarker+"\t")
+		if index < 0 {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(line[index:]), "\t")
+		if len(parts) < 3 {
+			return 0, 0, false
+		}
+		readOnly, err1 := strconv.Atoi(parts[1])
+		channels, err2 := strconv.Atoi(parts[2])
+		return readOnly, channels, err1 == nil && err2 == nil
+	}
+	return 0, 0, false
+}
+
+// compareProxySQLBackends reports backends missing from runtime, runtime
+// backends GMHA does not expect (for example a demoted primary still in the
+// writer hostgroup) and expected backends that are not ONLINE.
+func compareProxySQLBackends(expected, runtime []proxysqldomain.Backend) []proxysqldomain.Drift {
+	key := func(backend proxysqldomain.Backend) string {
+		return fmt.Sprintf("%d|%s|%d", backend.Hostgroup, backend.Hostname, backend.Port)
+	}
+	actual := make(map[string]proxysqldomain.Backend, len(runtime))
+	for _, backend := range runtime {
+		actual[key(backend)] = backend
+	}
+	wanted := make(map[string]bool, len(expected))
+	drift := make([]proxysqldomain.Drift, 0)
+	for _, backend := range expected {
+		wanted[key(backend)] = true
+		found, ok := actual[key(backend)]
+		switch {
+		case !ok:
+			drift = append(drift, proxysqldomain.Drift{Kind: proxysqldomain.DriftMissing, Expected: backend,
+				Message: fmt.Sprintf("%s:%d 不在运行时主机组 %d 中", backend.Hostname, backend.Port, backend.Hostgroup)})
+		case found.Status != "ONLINE":
+			drift = append(drift, proxysqldomain.Drift{Kind: proxysqldomain.DriftStatus, Expected: backend, Actual: found,
+				Message: fmt.Sprintf("%s:%d 在主机组 %d 中状态为 %s", backend.Hostname, backend.Port, backend.Hostgroup, found.Status)})
+		}
+	}
+	for _, backend := range runtime {
+		if !wanted[key(backend)] {
+			drift = append(drift, proxysqldomain.Drift{Kind: proxysqldomain.DriftUnexpected, Actual: backend,
+				Message: fmt.Sprintf("%s:%d 不应出现在主机组 %d 中", backend.Hostname, backend.Port, backend.Hostgroup)})
+		}
+	}
+	return drift
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	hadomain "gmha/internal/domain/ha"
+	proxysqldomain "gmha/internal/domain/proxysql"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type proxySQLPresetRepo struct {
+	MySQLAccountPresetRepository
+	items []taskdomain.MySQLAccountSpec
+}
+
+func (r proxySQLPresetRepo) List(context.Context) ([]taskdomain.MySQLAccountSpec, error) {
+	return r.items, nil
+}
+
+func TestProxySQLMonitorAccountRequiresEnabledPreset(t *testing.T) {
+	ctx := context.Background()
+	for _, items := range [][]taskdomain.MySQLAccountSpec{
+		nil,
+		{{Role: mysqlapp.AccountRoleMonitor, Username: "monitor", Password: "secret"}},
+		{{Role: mysqlapp.AccountRoleMonitor, Username: "monitor", Enabled: true}},
+	} {
+		service := &ProxySQLService{presets: proxySQLPresetRepo{items: items}}
+		if _, _, err := service.monitorAccount(ctx); err == nil || !strings.Contains(err.Error(), "monitor 账号预设") {
+			t.Fatalf("presets %+v must not fall back to a built-in password, got %v", items, err)
+		}
+	}
+	service := &ProxySQLService{presets: proxySQLPresetRepo{items: []taskdomain.MySQLAccountSpec{
+		{Role: mysqlapp.AccountRoleMonitor, Username: " mon ", Password: "secret", Enabled: true},
+	}}}
+	if user, password, err := service.monitorAccount(ctx); err != nil || user != "mon" || password != "secret" {
+		t.Fatalf("monitorAccount() = %q, %q, %v", user, password, err)
+	}
+}
+
+func TestProxySQLExpectedBackendsKeepsReaderGroupPopulated(t *testing.T) {
+	config := normalizeProxySQLConfig(proxysqldomain.Config{ClusterID: "orders"})
+	topology := ClusterRouteTopology{PrimaryMachineID: "m2", Backends: []ClusterRouteBackend{
+		{MachineID: "m1", Host: "10.0.0.1", Port: 3306},
+		{MachineID: "m2", Host: "10.0.0.2", Port: 3306},
+	}}
+	backends := proxySQLExpectedBackends(config, topology)
+	if len(backends) != 2 || backends[0].Hostgroup != 10 || backends[0].Hostname != "10.0.0.2" || backends[1].Hostgroup != 20 || backends[1].Hostname != "10.0.0.1" {
+		t.Fatalf("unexpected backends after switchover: %+v", backends)
+	}
+	single := proxySQLExpectedBackends(config, ClusterRouteTopology{PrimaryMachineID: "m1", Backends: topology.Backends[:1]})
+	if len(single) != 2 || single[1].Hostgroup != 20 || single[1].MachineID != "m1" {
+		t.Fatalf("primary must serve reads when no replica exists: %+v", single)
+	}
+}
+
+func TestProxySQLBackendSQLSwapsBothHostgroupsInOneRuntimeLoad(t *testing.T) {
+	config := normalizeProxySQLConfig(proxysqldomain.Config{ClusterID: "orders"})
+	sql := proxySQLBackendSQL(config, []proxysqldomain.Backend{
+		{Hostgroup: 10, Hostname: "10.0.0.2", Port: 3306, MachineID: "m2"},
+		{Hostgroup: 20, Hostname: "10.0.0.1", Port: 3306, MachineID: "m1"},
+	})
+	if !strings.HasPrefix(sql, "DELETE FROM mysql_servers WHERE hostgroup_id IN (10,20);") {
+		t.Fatalf("backend sync must clear managed hostgroups first: %s", sql)
+	}
+	if strings.Count(sql, "LOAD MYSQL SERVERS TO RUNTIME") != 1 || !strings.HasSuffix(sql, "SAVE MYSQL SERVERS TO DISK;") {
+		t.Fatalf("backend sync must promote a single runtime snapshot: %s", sql)
+	}
+	if !strings.Contains(sql, "VALUES (20,'10.0.0.1',3306,'ONLINE',30,'gmha:m1')") {
+		t.Fatalf("reader backend must carry max replication lag: %s", sql)
+	}
+}
+
+func TestProxySQLRulesResolveDestinationsAndValidate(t *testing.T) {
+	config := normalizeProxySQLConfig(proxysqldomain.Config{ClusterID: "orders", Enabled: true, ProxyMachineIDs: []string{"p1"}, AdminPassword: "secret"})
+	if err := validateProxySQLConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	sql := proxySQLQueryRulesSQL(config)
+	if !strings.Contains(sql, "(100,1,NULL,'^SELECT.*FOR UPDATE',NULL,10,1,'gmha:locking reads')") || !strings.Contains(sql, "(200,1,NULL,'^SELECT',NULL,20,1,'gmha:read split')") {
+		t.Fatalf("default rules must split reads and writes: %s", sql)
+	}
+	config.QueryRules = append(config.QueryRules, proxysqldomain.QueryRule{RuleID: 300, MatchDigest: "^UPDATE", Destination: "primary"})
+	if err := validateProxySQLConfig(config); err == nil {
+		t.Fatal("unknown destinations must be rejected")
+	}
+}
+
+func TestCompareProxySQLBackendsFlagsStaleWriter(t *testing.T) {
+	expected := []proxysqldomain.Backend{
+		{Hostgroup: 10, Hostname: "10.0.0.2", Port: 3306, Status: "ONLINE"},
+		{Hostgroup: 20, Hostname: "10.0.0.1", Port: 3306, Status: "ONLINE"},
+	}
+	output := "noise\n" + proxySQLServerMarker + "\t10\t10.0.0.1\t3306\tONLINE\n" + proxySQLServerMarker + "\t20\t10.0.0.1\t3306\tSHUNNED\n"
+	drift := compareProxySQLBackends(expected, parseProxySQLRuntimeServers(output))
+	kinds := map[string]int{}
+	for _, item := range drift {
+		kinds[item.Kind]++
+	}
+	if kinds[proxysqldomain.DriftMissing] != 1 || kinds[proxysqldomain.DriftUnexpected] != 1 || kinds[proxysqldomain.DriftStatus] != 1 {
+		t.Fatalf("unexpected drift report: %+v", drift)
+	}
+	if len(compareProxySQLBackends(expected, []proxysqldomain.Backend{
+		{Hostgroup: 10, Hostname: "10.0.0.2", Port: 3306, Status: "ONLINE"},
+		{Hostgroup: 20, Hostname: "10.0.0.1", Port: 3306, Status: "ONLINE"},
+	})) != 0 {
+		t.Fatal("matching runtime must not report drift")
+	}
+}
+
+func TestArchitectureRouteSyncStepRunsBeforeBusinessResume(t *testing.T) {
+	steps := addArchitectureRouteSyncStep(architecturePlanSteps(hadomain.ArchitectureAdjustmentRequest{
+		Architecture: hadomain.ArchitectureMasterSlave, CurrentMasterMachineID: "m1", MoveVIP: true,
+	}))
+	syncAt, resumeAt, vipAt := -1, -1, -1
+	for index, step := range steps {
+		if step.Order != index+1 {
+			t.Fatalf("steps must be renumbered: %+v", steps)
+		}
+		switch step.Code {
+		case "sync_proxysql":
+			syncAt = index
+		case "resume_business_connections":
+			resumeAt = index
+		case "verify_single_vip":
+			vipAt = index
+		}
+	}
+	if syncAt < 0 || syncAt != resumeAt-1 || vipAt > syncAt {
+		t.Fatalf("ProxySQL sync must follow VIP verification and precede resume: %+v", steps)
+	}
+}
@@ -0,0 +1,763 @@
+package app
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+//go:embed templates/xtrabackup_stream.sh
+var xtrabackupStreamScript string
+
+//go:embed templates/replica_rebuild_verify.sh
+var replicaRebuildVerifyScript string
+
+const (
+	RebuildMethodAuto       = "auto"
+	RebuildMethodClone      = "clone"
+	RebuildMethodXtraBackup = "xtrabackup"
+
+	replicationNodeMarker   = "__GMHA_REPLICATION_NODE__"
+	rebuildReplicaMarker    = "__GMHA_REBUILD_REPLICA__"
+	rebuildChecksumMarker   = "__GMHA_REBUILD_CHECKSUM__"
+	rebuildDefaultStream    = 4444
+	rebuildDefaultSample    = 5
+	rebuildProbeTimeout     = 45 * time.Second
+	rebuildCloneTimeout     = 6 * time.Hour
+	rebuildStreamTimeout    = 6 * time.Hour
+	rebuildRestoreTimeout   = 6 * time.Hour
+	rebuildAttachTimeout    = 3 * time.Minute
+	rebuildVerifyTimeout    = 30 * time.Minute
+	rebuildListenerDeadline = 2 * time.Minute
+)
+
+// ReplicaRebuildRequest identifies the replica to rebuild. Confirm must be the
+// target endpoint "ip:port" because the replica's data directory is replaced.
+type ReplicaRebuildRequest struct {
+	MachineID      string `json:"machine_id"`
+	Port           int    `json:"port,omitempty"`
+	DonorMachineID string `json:"donor_machine_id,omitempty"`
+	DonorPort      int    `json:"donor_port,omitempty"`
+	Method         string `json:"method,omitempty"`
+	StreamPort     int    `json:"stream_port,omitempty"`
+	ChecksumSample *int   `json:"checksum_sample,omitempty"`
+	Confirm        string `json:"confirm,omitempty"`
+}
+
+// ReplicaRebuildPlan is the live, read-only result of donor and method
+// selection. Rebuild only starts when Executable is true.
+type ReplicaRebuildPlan struct {
+	ClusterID       string   `json:"cluster_id"`
+	TargetMachineID string   `json:"target_machine_id"`
+	TargetName      string   `json:"target_name"`
+	TargetEndpoint  string   `json:"target_endpoint"`
+	DonorMachineID  string   `json:"donor_machine_id,omitempty"`
+	DonorName       string   `json:"donor_name,omitempty"`
+	DonorEndpoint   string   `json:"donor_endpoint,omitempty"`
+	DonorRole       string   `json:"donor_role,omitempty"`
+	SourceEndpoint  string   `json:"source_endpoint,omitempty"`
+	Method          string   `json:"method,omitempty"`
+	DelaySeconds    int      `json:"delay_seconds"`
+	ChecksumSample  int      `json:"checksum_sample"`
+	Steps           []string `json:"steps"`
+	Warnings        []string `json:"warnings,omitempty"`
+	BlockingReasons []string `json:"blocking_reasons,omitempty"`
+	Executable      bool     `json:"executable"`
+}
+
+type ReplicaRebuildResult struct {
+	Plan ReplicaRebuildPlan `json:"plan"`
+	Task TaskDetail         `json:"task"`
+}
+
+type replicationNode struct {
+	machine       machinedomain.Machine
+	instance      mysqlapp.Instance
+	reachable     bool
+	readOnly      bool
+	superReadOnly bool
+	version       string
+	executed      string
+	channels      int
+	sourceHost    string
+	sourcePort    int
+	ioRunning     bool
+	sqlRunning    bool
+	delay         int
+	lagSeconds    int
+	cloneActive   bool
+}
+
+func (n replicationNode) endpoint() string {
+	return fmt.Sprintf("%s:%d", n.machine.IP, n.instance.Port)
+}
+
+type rebuildSelection struct {
+	plan   ReplicaRebuildPlan
+	target replicationNode
+	donor  replicationNode
+	source replicationNode
+}
+
+// ReplicaRebuildService replaces the data of a diverged or broken replica
+// with a fresh copy from a healthy member and re-attaches it with GTID
+// auto-positioning.
+type ReplicaRebuildService struct {
+	tasks     *TaskService
+	machines  machinedomain.Repository
+	instances MySQLInstanceRepository
+	ha        *HAService
+	tls       taskusecase.ReplicationTLSResolver
+	mu        sync.Mutex
+	running   map[string]bool
+}
+
+func NewReplicaRebuildService(tasks *TaskService, machines machinedomain.Repository, instances MySQLInstanceRepository, ha *HAService) *ReplicaRebuildService {
+	return &ReplicaRebuildService{tasks: tasks, machines: machines, instances: instances, ha: ha, running: map[string]bool{}}
+}
+
+// SetReplicationTLSResolver keeps SOURCE_SSL on the re-attached channel when
+// the cluster TLS policy requires it.
+func (s *ReplicaRebuildService) SetReplicationTLSResolver(resolver taskusecase.ReplicationTLSResolver) {
+	s.tls = resolver
+}
+
+// Plan probes the cluster and reports which donor and method a rebuild would
+// use, without changing anything.
+func (s *ReplicaRebuildService) Plan(ctx context.Context, clusterID string, req ReplicaRebuildRequest) (ReplicaRebuildPlan, error) {
+	selection, _, err := s.plan(ctx, clusterID, req, "")
+	return selection.plan, err
+}
+
+// Rebuild re-plans against live state and runs the rebuild in the background.
+func (s *ReplicaRebuildService) Rebuild(ctx context.Context, clusterID string, req ReplicaRebuildRequest) (ReplicaRebuildResult, error) {
+	selection, _, err := s.plan(ctx, clusterID, req, "")
+	if err != nil {
+		return ReplicaRebuildResult{Plan: selection.plan}, err
+	}
+	if !selection.plan.Executable {
+		return ReplicaRebuildResult{Plan: selection.plan}, fmt.Errorf("副本重建被阻止：%s", strings.Join(selection.plan.BlockingReasons, "；"))
+	}
+	if strings.TrimSpace(req.Confirm) != selection.plan.TargetEndpoint {
+		return ReplicaRebuildResult{Plan: selection.plan}, fmt.Errorf("重建会替换目标实例全部数据，请在 confirm 中填写 %s", selection.plan.TargetEndpoint)
+	}
+	key := selection.plan.TargetEndpoint
+	s.mu.Lock()
+	if s.running[key] {
+		s.mu.Unlock()
+		return ReplicaRebuildResult{Plan: selection.plan}, fmt.Errorf("%s 正在重建", key)
+	}
+	s.running[key] = true
+	s.mu.Unlock()
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "mysql_replica_rebuild", "重建 MySQL 副本 "+selection.target.machine.Name, selection.plan.TargetEndpoint)
+	if err != nil {
+		s.release(key)
+		return ReplicaRebuildResult{Plan: selection.plan}, err
+	}
+	streamPort := req.StreamPort
+	if streamPort <= 0 {
+		streamPort = rebuildDefaultStream
+	}
+	go s.run(context.Background(), selection, parent.Task.ID, streamPort)
+	return ReplicaRebuildResult{Plan: selection.plan, Task: parent}, nil
+}
+
+func (s *ReplicaRebuildService) release(key string) {
+	s.mu.Lock()
+	delete(s.running, key)
+	s.mu.Unlock()
+}
+
+func (s *ReplicaRebuildService) plan(ctx context.Context, clusterID string, req ReplicaRebuildRequest, parentID string) (rebuildSelection, []string, error) {
+	clusterID = strings.TrimSpace(clusterID)
+	req.MachineID = strings.TrimSpace(req.MachineID)
+	if clusterID == "" || req.MachineID == "" {
+		return rebuildSelection{}, nil, errors.New("cluster and machine_id are required")
+	}
+	method := strings.ToLower(strings.TrimSpace(req.Method))
+	if method != "" && method != RebuildMethodAuto && method != RebuildMethodClone && method != RebuildMethodXtraBackup {
+		return rebuildSelection{}, nil, errors.New("method 只能是 auto、clone 或 xtrabackup")
+	}
+	if req.StreamPort < 0 || req.StreamPort > 65535 {
+		return rebuildSelection{}, nil, errors.New("stream_port 无效")
+	}
+	nodes, taskIDs, err := s.probe(ctx, clusterID, parentID)
+	if err != nil {
+		return rebuildSelection{}, taskIDs, err
+	}
+	selection, err := selectReplicaRebuild(clusterID, nodes, req)
+	if err != nil {
+		return selection, taskIDs, err
+	}
+	for _, node := range []replicationNode{selection.target, selection.donor} {
+		if node.machine.ID == "" {
+			continue
+		}
+		if compatible, reason := s.tasks.MachineCapability(node.machine.ID, taskdomain.CapabilityMySQLDefaultsFile); !compatible {
+			selection.plan.Executable = false
+			selection.plan.BlockingReasons = append(selection.plan.BlockingReasons, fmt.Sprintf("节点 %s 无法执行副本重建：%s，请先升级该节点 Agent", node.machine.Name, reason))
+		}
+	}
+	return selection, taskIDs, nil
+}
+
+// probe reads the replication role of every instance in the cluster. A node
+// that cannot be queried is kept with reachable=false so a stopped replica
+// can still be rebuilt with XtraBackup.
+func (s *ReplicaRebuildService) probe(ctx context.Context, clusterID, parentID string) ([]replicationNode, []string, error) {
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[string]machinedomain.Machine{}
+	for _, machine := range machines {
+		if machine.Cluster == clusterID {
+			byID[machine.ID] = machine
+		}
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].MachineID == instances[j].MachineID {
+			return instances[i].Port < instances[j].Port
+		}
+		return instances[i].MachineID < instances[j].MachineID
+	})
+	var nodes []replicationNode
+	var taskIDs []string
+	for _, instance := range instances {
+		machine, ok := byID[instance.MachineID]
+		if !ok {
+			continue
+		}
+		node := replicationNode{machine: machine, instance: instance, version: rebuildVersion(instance.Version)}
+		if instance.Status != mysqlapp.StatusStopped {
+			taskID, output, err := s.tasks.RunExecTask(ctx, machine.IP, mysqlArchitectureCommand("", instance.Port, replicationNodeSQL()), ExecTaskOptions{
+				ParentTaskID: parentID, Operation: "mysql_replica_rebuild_probe", DisplayName: "探测副本重建拓扑 " + machine.Name,
+				StepName: "读取复制状态、GTID 与 Clone 插件", Port: instance.Port,
+			}, rebuildProbeTimeout)
+			if taskID != "" {
+				taskIDs = append(taskIDs, taskID)
+			}
+			if err == nil {
+				if probed, ok := parseReplicationNode(output); ok {
+					probed.machine, probed.instance = machine, instance
+					if probed.version == "" {
+						probed.version = node.version
+					}
+					node = probed
+				}
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, taskIDs, fmt.Errorf("集群 %s 没有 MySQL 实例", clusterID)
+	}
+	return nodes, taskIDs, nil
+}
+
+// selectReplicaRebuild picks the donor (a healthy, non-delayed replica before
+// the primary), the source the rebuilt replica will follow, and the copy
+// method. It never fails for topology problems; those become blocking reasons.
+func selectReplicaRebuild(clusterID string, nodes []replicationNode, req ReplicaRebuildRequest) (rebuildSelection, error) {
+	find := func(machineID string, port int) (replicationNode, bool) {
+		var found []replicationNode
+		for _, node := range nodes {
+			if node.machine.ID == machineID && (port <= 0 || node.instance.Port == port) {
+				found = append(found, node)
+			}
+		}
+		if len(found) != 1 {
+			return replicationNode{}, false
+		}
+		return found[0], true
+	}
+	target, ok := find(req.MachineID, req.Port)
+	if !ok {
+		return rebuildSelection{}, fmt.Errorf("集群 %s 中找不到唯一的目标实例 %s（多实例机器请指定 port）", clusterID, req.MachineID)
+	}
+	selection := rebuildSelection{target: target, plan: ReplicaRebuildPlan{
+		ClusterID: clusterID, TargetMachineID: target.machine.ID, TargetName: target.machine.Name, TargetEndpoint: target.endpoint(),
+		DelaySeconds: target.delay, ChecksumSample: rebuildDefaultSample, Executable: true,
+	}}
+	plan := &selection.plan
+	block := func(format string, args ...any) {
+		plan.Executable = false
+		plan.BlockingReasons = append(plan.BlockingReasons, fmt.Sprintf(format, args...))
+	}
+	if req.ChecksumSample != nil {
+		plan.ChecksumSample = max(*req.ChecksumSample, 0)
+	}
+	var writable []replicationNode
+	for _, node := range nodes {
+		if node.reachable && !node.readOnly && !node.superReadOnly {
+			writable = append(writable, node)
+		}
+	}
+	if len(writable) > 1 {
+		var roots []replicationNode
+		for _, node := range writable {
+			if node.channels == 0 {
+				roots = append(roots, node)
+			}
+		}
+		writable = roots
+	}
+	var primary replicationNode
+	if len(writable) == 1 {
+		primary = writable[0]
+	} else {
+		block("无法确定唯一的可写主库（识别到 %d 个）", len(writable))
+	}
+	if primary.machine.ID != "" && primary.endpoint() == target.endpoint() {
+		block("%s 是当前主库，不能作为副本重建；请先切换主库", target.endpoint())
+	}
+	byEndpoint := map[string]replicationNode{}
+	for _, node := range nodes {
+		byEndpoint[node.endpoint()] = node
+	}
+	source := primary
+	if target.sourceHost != "" {
+		if configured, ok := byEndpoint[fmt.Sprintf("%s:%d", target.sourceHost, target.sourcePort)]; ok && configured.endpoint() != target.endpoint() {
+			source = configured
+		}
+	}
+	if source.machine.ID == "" || !source.reachable {
+		block("目标实例的复制源不可用")
+	} else {
+		selection.source = source
+		plan.SourceEndpoint = source.endpoint()
+	}
+	downstream := map[string]bool{}
+	for _, node := range nodes {
+		if node.sourceHost == target.machine.IP && node.sourcePort == target.instance.Port {
+			downstream[node.endpoint()] = true
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s 从目标实例复制，重建期间将中断", node.endpoint()))
+		}
+	}
+	primarySet, _ := mysqlapp.ParseGTIDSet(primary.executed)
+	healthy := func(node replicationNode) bool {
+		if !node.reachable || node.channels == 0 || !node.ioRunning || !node.sqlRunning || node.delay > 0 {
+			return false
+		}
+		set, err := mysqlapp.ParseGTIDSet(node.executed)
+		return err == nil && primary.machine.ID != "" && primarySet.Contains(set)
+	}
+	var donor replicationNode
+	if strings.TrimSpace(req.DonorMachineID) != "" {
+		chosen, ok := find(strings.TrimSpace(req.DonorMachineID), req.DonorPort)
+		switch {
+		case !ok:
+			block("找不到指定的 donor %s", req.DonorMachineID)
+		case chosen.endpoint() == target.endpoint():
+			block("donor 不能是目标实例本身")
+		case !chosen.reachable:
+			block("指定的 donor %s 不可连接", chosen.endpoint())
+		default:
+			donor = chosen
+			if chosen.endpoint() != primary.endpoint() && !healthy(chosen) {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("指定的 donor %s 不是健康的副本（线程未运行、延迟复制或存在主库没有的事务）", chosen.endpoint()))
+			}
+		}
+	} else {
+		var candidates []replicationNode
+		for _, node := range nodes {
+			if node.endpoint() != target.endpoint() && !downstream[node.endpoint()] && healthy(node) {
+				candidates = append(candidates, node)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			ci := mysqlapp.CloneCompatibleVersions(candidates[i].version, target.version)
+			cj := mysqlapp.CloneCompatibleVersions(candidates[j].version, target.version)
+			if ci != cj {
+				return ci
+			}
+			si, _ := mysqlapp.ParseGTIDSet(candidates[i].executed)
+			sj, _ := mysqlapp.ParseGTIDSet(candidates[j].executed)
+			if si.Count() != sj.Count() {
+				return si.Count() > sj.Count()
+			}
+			return candidates[i].endpoint() < candidates[j].endpoint()
+		})
+		switch {
+		case len(candidates) > 0:
+			donor = candidates[0]
+		case primary.machine.ID != "" && primary.endpoint() != target.endpoint():
+			donor = primary
+			plan.Warnings = append(plan.Warnings, "没有健康的副本可作为 donor，将从主库复制数据，复制期间主库 IO 负载升高")
+		default:
+			block("没有可用的 donor")
+		}
+	}
+	if donor.machine.ID != "" {
+		selection.donor = donor
+		plan.DonorMachineID, plan.DonorName, plan.DonorEndpoint = donor.machine.ID, donor.machine.Name, donor.endpoint()
+		plan.DonorRole = "replica"
+		if donor.endpoint() == primary.endpoint() {
+			plan.DonorRole = "primary"
+		}
+		cloneOK := target.reachable && mysqlapp.CloneCompatibleVersions(donor.version, target.version)
+		method := strings.ToLower(strings.TrimSpace(req.Method))
+		switch {
+		case method == RebuildMethodClone && !cloneOK:
+			if !target.reachable {
+				block("Clone 需要目标实例处于运行状态，目标不可连接时请使用 xtrabackup")
+			} else {
+				block("Clone 要求 donor 与目标版本一致且不低于 8.0.17（donor %s，目标 %s）", donor.version, target.version)
+			}
+		case method == RebuildMethodClone || (method != RebuildMethodXtraBackup && cloneOK):
+			plan.Method = RebuildMethodClone
+		default:
+			plan.Method = RebuildMethodXtraBackup
+			if donor.version != target.version {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("donor 版本 %s 与目标版本 %s 不一致，XtraBackup 恢复后以目标二进制启动", donor.version, target.version))
+			}
+		}
+	}
+	plan.Steps = rebuildPlanSteps(*plan)
+	return selection, nil
+}
+
+func rebuildPlanSteps(plan ReplicaRebuildPlan) []string {
+	steps := []string{"实时探测集群角色、复制线程与 GTID"}
+	switch plan.Method {
+	case RebuildMethodClone:
+		steps = append(steps,
+			"确认 donor 与目标已加载 Clone 插件",
+			"停止并清除目标默认复制通道，从 donor "+plan.DonorEndpoint+" 执行 CLONE INSTANCE（目标数据被替换并自动重启）",
+		)
+	case RebuildMethodXtraBackup:
+		steps = append(steps,
+			"目标启动 xbstream 接收端",
+			"donor "+plan.DonorEndpoint+" 以 xtrabackup --stream 直接传输到目标",
+			"目标停止实例、prepare 并替换数据目录（原目录保留 .before_restore 后缀），以 skip_slave_start 启动",
+			"按 xtrabackup_binlog_info 校正 gtid_purged",
+		)
+	}
+	steps = append(steps, "以 GTID 自动定位重新指向复制源 "+plan.SourceEndpoint+" 并确认复制线程运行")
+	if plan.ChecksumSample > 0 {
+		steps = append(steps, fmt.Sprintf("抽样 %d 张表在相同 GTID 位点执行 CHECKSUM TABLE 校验", plan.ChecksumSample))
+	}
+	return steps
+}
+
+func (s *ReplicaRebuildService) run(ctx context.Context, selection rebuildSelection, parentID string, streamPort int) {
+	defer s.release(selection.plan.TargetEndpoint)
+	created, failed := 0, 0
+	step := func(taskID string, err error) error {
+		if taskID != "" {
+			created++
+		}
+		if err != nil {
+			failed++
+		}
+		return err
+	}
+	err := func() error {
+		switch selection.plan.Method {
+		case RebuildMethodClone:
+			if !selection.donor.cloneActive {
+				if err := step(s.runRebuildStep(ctx, selection.donor, rebuildInstallClonePluginCommand(selection.donor.instance.Port), parentID, "mysql_replica_rebuild_donor", "准备 Clone donor "+selection.donor.machine.Name, "INSTALL PLUGIN clone", rebuildProbeTimeout)); err != nil {
+					return err
+				}
+			}
+			user, password := s.ha.architectureManagementAccount(ctx)
+			if err := step(s.runRebuildStep(ctx, selection.target, rebuildCloneCommand(selection.target, selection.donor, user, password), parentID, "mysql_replica_rebuild_clone", "Clone 重建 "+selection.target.machine.Name, "CLONE INSTANCE FROM "+selection.donor.endpoint(), rebuildCloneTimeout)); err != nil {
+				return err
+			}
+		case RebuildMethodXtraBackup:
+			if err := s.streamXtraBackup(ctx, selection, parentID, streamPort, step); err != nil {
+				return err
+			}
+		default:
+			return errors.New("未选择重建方式")
+		}
+		user, password := s.ha.architectureManagementAccount(ctx)
+		tls := taskusecase.ReplicationTLS{}
+		if s.tls != nil {
+			tls, _ = s.tls.ReplicationSourceTLS(ctx, selection.target.machine.ID, selection.target.instance.Port)
+		}
+		receiveDir := ""
+		if selection.plan.Method == RebuildMethodXtraBackup {
+			receiveDir = rebuildReceiveDir(selection.target.instance, parentID)
+		}
+		_, output, err := s.tasks.RunExecTask(ctx, selection.target.machine.IP, rebuildAttachCommand(selection.target.instance.Port, selection.source, user, password, selection.target.delay, tls, receiveDir), ExecTaskOptions{
+			ParentTaskID: parentID, Operation: "mysql_replica_rebuild_attach", DisplayName: "重新配置复制 " + selection.target.machine.Name,
+			StepName: "CHANGE REPLICATION SOURCE TO " + selection.source.endpoint() + " SOURCE_AUTO_POSITION=1", Port: selection.target.instance.Port,
+		}, rebuildAttachTimeout)
+		if err := step("attach", err); err != nil {
+			return err
+		}
+		if err := step("", verifyRebuildReplicaThreads(output)); err != nil {
+			return err
+		}
+		if selection.plan.ChecksumSample > 0 {
+			args := []string{"--local-defaults-file", mysqlDefaultsFilePlaceholder, "--port", strconv.Itoa(selection.target.instance.Port),
+				"--source-host", selection.source.machine.IP, "--source-port", strconv.Itoa(selection.source.instance.Port),
+				"--source-user", user, "--source-password-base64", base64.StdEncoding.EncodeToString([]byte(password)),
+				"--sample", strconv.Itoa(selection.plan.ChecksumSample)}
+			_, output, err := s.tasks.RunExecTask(ctx, selection.target.machine.IP, renderRemoteScript(replicaRebuildVerifyScript, "gmha-rebuild-verify", args), ExecTaskOptions{
+				ParentTaskID: parentID, Operation: "mysql_replica_rebuild_verify", DisplayName: "抽样校验 " + selection.target.machine.Name,
+				StepName: "CHECKSUM TABLE 抽样比对", Port: selection.target.instance.Port,
+			}, rebuildVerifyTimeout)
+			if err := step("verify", err); err != nil {
+				if results := parseRebuildChecksums(output); len(results) > 0 {
+					return fmt.Errorf("%w: %s", err, strings.Join(results, "; "))
+				}
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil && failed == 0 {
+		failed++
+	}
+	_ = s.tasks.FinalizeBatchTrackingTask(ctx, parentID, max(created, 1), failed)
+}
+
+// runRebuildStep runs one rebuild step on node. Like the attach and verify
+// commands, clone commands carry the replication password, which RunExecTask
+// redacts from task history once the step finishes.
+func (s *ReplicaRebuildService) runRebuildStep(ctx context.Context, node replicationNode, command, parentID, operation, displayName, stepName string, timeout time.Duration) (string, error) {
+	taskID, _, err := s.tasks.RunExecTask(ctx, node.machine.IP, command, ExecTaskOptions{
+		ParentTaskID: parentID, Operation: operation, DisplayName: displayName, StepName: stepName, Port: node.instance.Port,
+	}, timeout)
+	return taskID, err
+}
+
+// streamXtraBackup starts the receiver first, waits until the Agent is
+// running it, then streams from the donor and installs the copy.
+func (s *ReplicaRebuildService) streamXtraBackup(ctx context.Context, selection rebuildSelection, parentID string, streamPort int, step func(string, error) error) error {
+	target, donor := selection.target, selection.donor
+	receiveDir := rebuildReceiveDir(target.instance, parentID)
+	receiveArgs := []string{"--mode", "receive", "--listen-port", strconv.Itoa(streamPort), "--target-dir", receiveDir,
+		"--timeout", strconv.Itoa(int(rebuildStreamTimeout.Seconds())), "--mysql-version", donor.version}
+	receiver, err := s.tasks.CreateExecTaskWithOptions(ctx, target.machine.IP, renderRemoteScript(xtrabackupStreamScript, "gmha-stream-receive", receiveArgs), ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "mysql_replica_rebuild_receive", DisplayName: "接收 XtraBackup 流 " + target.machine.Name,
+		StepName: fmt.Sprintf("xbstream 监听 %d 端口", streamPort), Port: target.instance.Port,
+	})
+	if err := step(receiver.Task.ID, err); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(rebuildListenerDeadline)
+	for {
+		detail, err := s.tasks.GetTaskDetail(ctx, receiver.Task.ID)
+		if err != nil {
+			return step("", err)
+		}
+		if detail.Task.Status == taskdomain.StatusRunning {
+			break
+		}
+		if detail.Task.Status != taskdomain.StatusPending && detail.Task.Status != taskdomain.StatusSent {
+			return step("", fmt.Errorf("接收端任务 %s 未能启动（%s）", receiver.Task.ID, detail.Task.Status))
+		}
+		if time.Now().After(deadline) {
+			return step("", fmt.Errorf("接收端任务 %s 在 %s 内未开始执行", receiver.Task.ID, rebuildListenerDeadline))
+		}
+		time.Sleep(2 * time.Second)
+	}
+	// The Agent reports running before the listener binds.
+	time.Sleep(5 * time.Second)
+	sendArgs := []string{"--mode", "send", "--target-host", target.machine.IP, "--target-port", strconv.Itoa(streamPort),
+		"--port", strconv.Itoa(donor.instance.Port), "--socket", donor.instance.SocketPath, "--defaults-file", donor.instance.MyCnfPath,
+		"--credentials-file", mysqlDefaultsFilePlaceholder}
+	if err := step(s.runRebuildStep(ctx, donor, renderRemoteScript(xtrabackupStreamScript, "gmha-stream-send", sendArgs), parentID, "mysql_replica_rebuild_send", "发送 XtraBackup 流 "+donor.machine.Name, "xtrabackup --backup --stream=xbstream", rebuildStreamTimeout)); err != nil {
+		return err
+	}
+	received, err := s.tasks.WaitForTask(ctx, receiver.Task.ID, rebuildStreamTimeout)
+	if err == nil && received.Task.Status != taskdomain.StatusSuccess {
+		err = fmt.Errorf("接收端任务 %s 失败", receiver.Task.ID)
+	}
+	if err != nil {
+		return step("", err)
+	}
+	user, password := s.ha.architectureManagementAccount(ctx)
+	instance := target.instance
+	restoreArgs := []string{"--full-dir", receiveDir, "--recovery-mode", "physical", "--port", strconv.Itoa(instance.Port), "--socket", instance.SocketPath,
+		"--db-user", user, "--db-password-base64", base64.StdEncoding.EncodeToString([]byte(password)), "--repair-replication", "false",
+		"--data-dir", instance.DataDir, "--instance-binlog-dir", instance.BinlogDir, "--redo-dir", instance.RedoDir, "--undo-dir", instance.UndoDir,
+		"--defaults-file", instance.MyCnfPath, "--mysql-os-user", instance.MySQLUser, "--systemd-unit", instance.SystemdUnit, "--skip-replica-start", "true"}
+	return step(s.runRebuildStep(ctx, target, renderRemoteScript(xtrabackupRestoreScript, "gmha-rebuild-restore", restoreArgs), parentID, "mysql_replica_rebuild_restore", "安装重建数据 "+target.machine.Name, "xtrabackup --prepare 并替换数据目录", rebuildRestoreTimeout))
+}
+
+func rebuildReceiveDir(instance mysqlapp.Instance, parentID string) string {
+	return filepath.Join(filepath.Dir(strings.TrimRight(instance.DataDir, "/")), "gmha_rebuild_"+safePathPart(parentID))
+}
+
+var rebuildVersionPattern = regexp.MustCompile(`^\s*(\d+\.\d+\.\d+)`)
+
+func rebuildVersion(raw string) string {
+	if match := rebuildVersionPattern.FindStringSubmatch(raw); len(match) == 2 {
+		return match[1]
+	}
+	return strings.TrimSpace(raw)
+}
+
+func replicationNodeSQL() string {
+	return fmt.Sprintf("SELECT '%s', @@global.read_only, @@global.super_read_only, VERSION(), "+
+		"CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', '')), "+
+		"(SELECT COUNT(*) FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), "+
+		"CONCAT('host:', IFNULL((SELECT HOST FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), '')), "+
+		"IFNULL((SELECT PORT FROM performance_schema.replication_connection_configuration WHERE CHANNEL_NAME=''), 0), "+
+		"IFNULL((SELECT SERVICE_STATE FROM performance_schema.replication_connection_status WHERE CHANNEL_NAME=''), 'OFF'), "+
+		"IFNULL((SELECT SERVICE_STATE FROM performance_schema.replication_applier_status WHERE CHANNEL_NAME=''), 'OFF'), "+
+		"IFNULL((SELECT DESIRED_DELAY FROM performance_schema.replication_applier_configuration WHERE CHANNEL_NAME=''), 0), "+
+		"(SELECT COUNT(*) FROM information_schema.plugins WHERE PLUGIN_NAME='clone' AND PLUGIN_STATUS='ACTIVE');", replicationNodeMarker)
+}
+
+// parseReplicationNode reads the probe row and, when the command also ran
+// SHOW REPLICA STATUS\G, Seconds_Behind_Source (-1 when NULL or absent on a
+// replica).
+func parseReplicationNode(output string) (replicationNode, bool) {
+	var node replicationNode
+	found, lagSeen := false, false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if key, value, ok := strings.Cut(line, ":"); ok && (key == "Seconds_Behind_Source" || key == "Seconds_Behind_Master") {
+			if lag, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				node.lagSeconds, lagSeen = lag, true
+			}
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if found || len(fields) != 12 || fields[0] != replicationNodeMarker {
+			continue
+		}
+		channels, _ := strconv.Atoi(fields[5])
+		port, _ := strconv.Atoi(fields[7])
+		delay, _ := strconv.Atoi(fields[10])
+		lag := node.lagSeconds
+		node = replicationNode{
+			reachable: true, readOnly: fields[1] == "1", superReadOnly: fields[2] == "1", version: rebuildVersion(fields[3]),
+			executed: strings.TrimPrefix(fields[4], "gtid:"), channels: channels, sourceHost: strings.TrimPrefix(fields[6], "host:"), sourcePort: port,
+			ioRunning: strings.EqualFold(fields[8], "ON"), sqlRunning: strings.EqualFold(fields[9], "ON"), delay: delay, lagSeconds: lag, cloneActive: fields[11] != "0",
+		}
+		found = true
+	}
+	if found && node.channels > 0 && !lagSeen {
+		node.lagSeconds = -1
+	}
+	return node, found
+}
+
+// rebuildInstallClonePluginCommand loads the plugin on a read-only member.
+// INSTALL PLUGIN writes mysql.plugin, so super_read_only is lifted for that
+// statement only; read_only keeps application writes out meanwhile.
+func rebuildInstallClonePluginCommand(port int) string {
+	return mysqlArchitectureCommand("", port, "SET @gmha_sro=@@global.super_read_only; SET GLOBAL super_read_only=OFF; "+
+		"INSTALL PLUGIN clone SONAME 'mysql_clone.so'; SET GLOBAL super_read_only=@gmha_sro;")
+}
+
+func rebuildCloneCommand(target, donor replicationNode, user, password string) string {
+	port := target.instance.Port
+	client := mysqlArchitectureClient("", port)
+	mysqladmin := "mysqladmin --defaults-extra-file=__GMHA_MYSQL_DEFAULTS_FILE__ --protocol=tcp --host=127.0.0.1 --port=" + strconv.Itoa(port) + " --connect-timeout=2"
+	if target.instance.BaseDir != "" {
+		mysqladmin = shellQuote(filepath.Join(target.instance.BaseDir, "bin", "mysqladmin")) + strings.TrimPrefix(mysqladmin, "mysqladmin")
+	}
+	unit := target.instance.SystemdUnit
+	if unit == "" {
+		unit = "mysqld"
+	}
+	parts := []string{}
+	if !target.cloneActive {
+		parts = append(parts, rebuildInstallClonePluginCommand(port)+" || true")
+	}
+	reset := "STOP REPLICA FOR CHANNEL ''; RESET REPLICA ALL FOR CHANNEL '';"
+	resetLegacy := "STOP SLAVE FOR CHANNEL ''; RESET SLAVE ALL FOR CHANNEL '';"
+	clone := fmt.Sprintf("SET GLOBAL clone_valid_donor_list=%s; CLONE INSTANCE FROM %s@%s:%d IDENTIFIED BY %s;",
+		sqlLiteral(donor.endpoint()), sqlLiteral(user), sqlLiteral(donor.machine.IP), donor.instance.Port, sqlLiteral(password))
+	parts = append(parts,
+		"("+client+" --execute="+shellQuote(reset)+" 2>/dev/null || "+client+" --execute="+shellQuote(resetLegacy)+" 2>/dev/null || true)",
+		// ERROR 3707 means the clone finished but mysqld has no supervisor to
+		// restart it; systemd takes over below.
+		"clone_out=$("+client+" --execute="+shellQuote(clone)+" 2>&1); clone_rc=$?; printf '%s\\n' \"$clone_out\"; "+
+			"if [ \"$clone_rc\" -ne 0 ] && ! printf '%s\\n' \"$clone_out\" | grep -q 'ERROR 3707'; then exit \"$clone_rc\"; fi",
+		"sleep 5; systemctl start "+shellQuote(unit)+" || systemctl restart "+shellQuote(unit),
+		"for i in $(seq 1 180); do "+mysqladmin+" ping >/dev/null 2>&1 && echo 'clone completed, MySQL is ready' && exit 0; sleep 2; done; echo 'MySQL did not come back after clone' >&2; exit 1",
+	)
+	return strings.Join(parts, "; ")
+}
+
+// rebuildAttachCommand points the default channel at the source with GTID
+// auto-positioning and restores the replica's delay and read-only state.
+// For XtraBackup copies it first aligns gtid_purged with the copied data.
+func rebuildAttachCommand(port int, source replicationNode, user, password string, delay int, tls taskusecase.ReplicationTLS, receiveDir string) string {
+	client := mysqlArchitectureClient("", port)
+	parts := []string{"set -e"}
+	if receiveDir != "" {
+		info := shellQuote(filepath.Join(receiveDir, "xtrabackup_binlog_info"))
+		parts = append(parts,
+			"gtid=''; if [ -f "+info+" ]; then gtid=$(cut -f3- "+info+" | tr -d '[:space:]'); fi",
+			"if [ -n \"$gtid\" ] && [ \"$("+client+" --batch --raw --skip-column-names --execute=\"SELECT GTID_SUBSET('$gtid', @@global.gtid_executed)\")\" != \"1\" ]; then "+
+				client+" --execute=\"SET GLOBAL super_read_only=OFF; RESET MASTER; SET GLOBAL gtid_purged='$gtid';\" 2>/dev/null || "+
+				client+" --execute=\"SET GLOBAL super_read_only=OFF; RESET BINARY LOGS AND GTIDS; SET GLOBAL gtid_purged='$gtid';\"; echo \"gtid_purged aligned to $gtid\"; fi",
+			"rm -rf "+shellQuote(receiveDir),
+		)
+	}
+	modern, legacy := replicaSourceSQL(source, user, password, delay, tls)
+	modern += " SET GLOBAL read_only=ON; SET GLOBAL super_read_only=ON;"
+	legacy += " SET GLOBAL read_only=ON; SET GLOBAL super_read_only=ON;"
+	status := fmt.Sprintf("SELECT '%s', IFNULL((SELECT SERVICE_STATE FROM performance_schema.replication_connection_status WHERE CHANNEL_NAME=''), 'OFF'), "+
+		"IFNULL((SELECT SERVICE_STATE FROM performance_schema.replication_applier_status WHERE CHANNEL_NAME=''), 'OFF'), "+
+		"CONCAT('error:', IFNULL((SELECT LAST_ERROR_MESSAGE FROM performance_schema.replication_connection_status WHERE CHANNEL_NAME=''), ''));", rebuildReplicaMarker)
+	parts = append(parts,
+		"("+client+" --execute="+shellQuote(modern)+" 2>/dev/null || "+client+" --execute="+shellQuote(legacy)+")",
+		"sleep 10",
+		client+" --batch --raw --skip-column-names --execute="+shellQuote(status),
+	)
+	return strings.Join(parts, "; ")
+}
+
+// replicaSourceSQL resets the default channel and points it at source with
+// GTID auto-positioning, returning the 8.0.23+ statement list and the
+// CHANGE MASTER fallback for older servers.
+func replicaSourceSQL(source replicationNode, user, password string, delay int, tls taskusecase.ReplicationTLS) (string, string) {
+	modern := fmt.Sprintf("STOP REPLICA FOR CHANNEL ''; RESET REPLICA ALL FOR CHANNEL ''; CHANGE REPLICATION SOURCE TO SOURCE_HOST=%s,SOURCE_PORT=%d,SOURCE_USER=%s,SOURCE_PASSWORD=%s,SOURCE_AUTO_POSITION=1,SOURCE_CONNECT_RETRY=10,SOURCE_RETRY_COUNT=8640,SOURCE_DELAY=%d,GET_SOURCE_PUBLIC_KEY=1%s FOR CHANNEL ''; START REPLICA FOR CHANNEL '';",
+		sqlLiteral(source.machine.IP), source.instance.Port, sqlLiteral(user), sqlLiteral(password), delay, architectureReplicationTLSClause(tls, "SOURCE"))
+	legacy := fmt.Sprintf("STOP SLAVE FOR CHANNEL ''; RESET SLAVE ALL FOR CHANNEL ''; CHANGE MASTER TO MASTER_HOST=%s,MASTER_PORT=%d,MASTER_USER=%s,MASTER_PASSWORD=%s,MASTER_AUTO_POSITION=1,MASTER_CONNECT_RETRY=10,MASTER_RETRY_COUNT=8640,MASTER_DELAY=%d%s FOR CHANNEL ''; START SLAVE FOR CHANNEL '';",
+		sqlLiteral(source.machine.IP), source.instance.Port, sqlLiteral(user), sqlLiteral(password), delay, architectureReplicationTLSClause(tls, "MASTER"))
+	return modern, legacy
+}
+
+func verifyRebuildReplicaThreads(output string) error {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 4 || fields[0] != rebuildReplicaMarker {
+			continue
+		}
+		if strings.EqualFold(fields[1], "ON") && strings.EqualFold(fields[2], "ON") {
+			return nil
+		}
+		return fmt.Errorf("重建后复制线程未运行（IO=%s SQL=%s）%s", fields[1], fields[2], strings.TrimPrefix(fields[3], "error:"))
+	}
+	return errors.New("未读取到重建后的复制状态")
+}
+
+func parseRebuildChecksums(output string) []string {
+	var out []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) >= 3 && fields[0] == rebuildChecksumMarker && fields[2] != "match" {
+			out = append(out, fields[1]+"="+fields[2])
+		}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	machinedomain "gmha/internal/domain/machine"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const rebuildTestUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func rebuildTestNode(id, ip, version, executed string, readOnly bool, source string) replicationNode {
+	node := replicationNode{
+		machine:   machinedomain.Machine{ID: id, Name: strings.ToUpper(id), IP: ip},
+		instance:  mysqlapp.Instance{MachineID: id, Port: 3306, Version: version, DataDir: "/data/mysql/3306/data"},
+		reachable: true, readOnly: readOnly, superReadOnly: readOnly, version: version,
+		executed: rebuildTestUUID + ":" + executed, cloneActive: true,
+	}
+	if source != "" {
+		node.channels, node.sourceHost, node.sourcePort = 1, source, 3306
+		node.ioRunning, node.sqlRunning = true, true
+	}
+	return node
+}
+
+func TestSelectReplicaRebuildPrefersHealthyReplicaDonor(t *testing.T) {
+	primary := rebuildTestNode("db-1", "10.0.0.1", "8.0.36", "1-100", false, "")
+	healthy := rebuildTestNode("db-2", "10.0.0.2", "8.0.36", "1-98", true, "10.0.0.1")
+	delayed := rebuildTestNode("db-3", "10.0.0.3", "8.0.36", "1-100", true, "10.0.0.1")
+	delayed.delay = 3600
+	broken := rebuildTestNode("db-4", "10.0.0.4", "8.0.36", "1-60", true, "10.0.0.1")
+	broken.sqlRunning = false
+	broken.delay = 600
+	nodes := []replicationNode{primary, healthy, delayed, broken}
+
+	selection, err := selectReplicaRebuild("demo", nodes, ReplicaRebuildRequest{MachineID: "db-4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := selection.plan
+	if !plan.Executable || plan.DonorMachineID != "db-2" || plan.DonorRole != "replica" || plan.Method != RebuildMethodClone {
+		t.Fatalf("expected clone from the healthy replica, got %+v", plan)
+	}
+	if plan.SourceEndpoint != "10.0.0.1:3306" || plan.DelaySeconds != 600 || plan.TargetEndpoint != "10.0.0.4:3306" {
+		t.Fatalf("rebuilt replica must keep its source and delay: %+v", plan)
+	}
+
+	// A version mismatch rules out clone; with no healthy replica left the
+	// primary becomes the donor.
+	broken.version = "8.0.35"
+	selection, err = selectReplicaRebuild("demo", []replicationNode{primary, delayed, broken}, ReplicaRebuildRequest{MachineID: "db-4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection.plan.DonorRole != "primary" || selection.plan.Method != RebuildMethodXtraBackup || len(selection.plan.Warnings) == 0 {
+		t.Fatalf("expected xtrabackup from the primary, got %+v", selection.plan)
+	}
+	selection, _ = selectReplicaRebuild("demo", []replicationNode{primary, healthy, broken}, ReplicaRebuildRequest{MachineID: "db-4", Method: RebuildMethodClone})
+	if selection.plan.Executable {
+		t.Fatal("clone across different versions must be blocked")
+	}
+
+	// A stopped target cannot receive a clone but can be restored.
+	stopped := rebuildTestNode("db-4", "10.0.0.4", "8.0.36", "", true, "")
+	stopped.reachable, stopped.executed = false, ""
+	selection, _ = selectReplicaRebuild("demo", []replicationNode{primary, healthy, stopped}, ReplicaRebuildRequest{MachineID: "db-4"})
+	if !selection.plan.Executable || selection.plan.Method != RebuildMethodXtraBackup || selection.plan.SourceEndpoint != "10.0.0.1:3306" {
+		t.Fatalf("stopped target must fall back to xtrabackup and follow the primary: %+v", selection.plan)
+	}
+
+	selection, _ = selectReplicaRebuild("demo", nodes, ReplicaRebuildRequest{MachineID: "db-1"})
+	if selection.plan.Executable {
+		t.Fatal("the primary must not be rebuilt")
+	}
+}
+
+func TestSelectReplicaRebuildSkipsErrantAndDownstreamDonors(t *testing.T) {
+	primary := rebuildTestNode("db-1", "10.0.0.1", "8.0.36", "1-100", false, "")
+	target := rebuildTestNode("db-2", "10.0.0.2", "8.0.36", "1-50", true, "10.0.0.1")
+	cascaded := rebuildTestNode("db-3", "10.0.0.3", "8.0.36", "1-50", true, "10.0.0.2")
+	errant := rebuildTestNode("db-4", "10.0.0.4", "8.0.36", "1-100", true, "10.0.0.1")
+	errant.executed += ",aaaaaaaa-71ca-11e1-9e33-c80aa9429562:1"
+	selection, err := selectReplicaRebuild("demo", []replicationNode{primary, target, cascaded, errant}, ReplicaRebuildRequest{MachineID: "db-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection.plan.DonorMachineID != "db-1" {
+		t.Fatalf("errant and downstream replicas must not be donors: %+v", selection.plan)
+	}
+	if len(selection.plan.Warnings) < 2 || !strings.Contains(strings.Join(selection.plan.Warnings, "\n"), "10.0.0.3:3306") {
+		t.Fatalf("downstream replication interruption must be warned: %+v", selection.plan.Warnings)
+	}
+}
+
+func TestParseReplicationNodeAndReplicaState(t *testing.T) {
+	line := strings.Join([]string{replicationNodeMarker, "1", "1", "8.0.36-log", "gtid:" + rebuildTestUUID + ":1-10", "1", "host:10.0.0.1", "3306", "ON", "OFF", "0", "1"}, "\t")
+	node, ok := parseReplicationNode("mysql: [Warning] Using a password\n" + line)
+	if !ok || !node.reachable || !node.readOnly || node.version != "8.0.36" || node.sourceHost != "10.0.0.1" || !node.ioRunning || node.sqlRunning || !node.cloneActive {
+		t.Fatalf("unexpected node: %+v", node)
+	}
+	if err := verifyRebuildReplicaThreads(rebuildReplicaMarker + "\tON\tON\terror:"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyRebuildReplicaThreads(rebuildReplicaMarker + "\tCONNECTING\tON\terror:Access denied"); err == nil || !strings.Contains(err.Error(), "Access denied") {
+		t.Fatalf("expected IO thread failure, got %v", err)
+	}
+	checksums := parseRebuildChecksums(fmt.Sprintf("%s\tshop.orders\tmatch\t1\t1\n%s\tshop.items\tmismatch\t2\t3\n", rebuildChecksumMarker, rebuildChecksumMarker))
+	if len(checksums) != 1 || checksums[0] != "shop.items=mismatch" {
+		t.Fatalf("unexpected checksum summary: %v", checksums)
+	}
+}
+
+func TestRebuildCommandsUseAutoPositionAndTolerateCloneRestart(t *testing.T) {
+	donor := rebuildTestNode("db-2", "10.0.0.2", "8.0.36", "1-10", true, "10.0.0.1")
+	target := rebuildTestNode("db-3", "10.0.0.3", "8.0.36", "1-5", true, "10.0.0.1")
+	target.instance.SystemdUnit = "mysqld3306"
+	target.cloneActive = false
+	clone := rebuildCloneCommand(target, donor, "mha", "secret")
+	for _, expected := range []string{"INSTALL PLUGIN clone", "clone_valid_donor_list='\\''10.0.0.2:3306'\\''", "CLONE INSTANCE FROM '\\''mha'\\''@'\\''10.0.0.2'\\'':3306", "ERROR 3707", "systemctl start 'mysqld3306'", "RESET REPLICA ALL FOR CHANNEL"} {
+		if !strings.Contains(clone, expected) {
+			t.Fatalf("clone command missing %q:\n%s", expected, clone)
+		}
+	}
+	source := rebuildTestNode("db-1", "10.0.0.1", "8.0.36", "1-10", false, "")
+	attach := rebuildAttachCommand(3306, source, "mha", "secret", 300, taskusecase.ReplicationTLS{CAPath: "/data/tls/ca.pem"}, "/data/mysql/3306/gmha_rebuild_t1")
+	for _, expected := range []string{"SOURCE_AUTO_POSITION=1", "SOURCE_DELAY=300", "SOURCE_SSL_CA=", "MASTER_AUTO_POSITION=1", "xtrabackup_binlog_info", "gtid_purged", "rm -rf '/data/mysql/3306/gmha_rebuild_t1'", rebuildReplicaMarker} {
+		if !strings.Contains(attach, expected) {
+			t.Fatalf("attach command missing %q:\n%s", expected, attach)
+		}
+	}
+	if strings.Contains(rebuildAttachCommand(3306, source, "mha", "secret", 0, taskusecase.ReplicationTLS{}, ""), "gtid_purged") {
+		t.Fatal("clone rebuilds must not touch gtid_purged")
+	}
+}
@@ -0,0 +1,450 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	machinedomain "gmha/internal/domain/machine"
+	changedomain "gmha/internal/domain/schemachange"
+	schemadomain "gmha/internal/domain/schemasnapshot"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	schemaChangeTick         = 30 * time.Second
+	schemaChangeMaxWindow    = 24 * time.Hour
+	schemaChangeActorMaxSize = 128
+)
+
+var ErrSchemaChangeNotFound = errors.New("变更单不存在")
+
+// SchemaChangeDraft is the editable part of a change request. The handler
+// builds the online DDL dry-run and execute commands from it, so change
+// requests run exactly the commands of /api/v1/tasks/mysql-online-ddl.
+type SchemaChangeDraft struct {
+	Title           string
+	MachineID       string
+	Port            int
+	Schema          string
+	Table           string
+	Alter           string
+	Purpose         string
+	Impact          string
+	Options         changedomain.Options
+	Actor           string
+	DryRunCommands  []taskdomain.ExecCommandStep
+	ExecuteCommands []taskdomain.ExecCommandStep
+}
+
+type SchemaChangeReview struct {
+	Actor       string
+	Comment     string
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+type schemaChangeTasks interface {
+	ResolveMySQLInstance(context.Context, string, int) (machinedomain.Machine, mysqlapp.Instance, error)
+	CreateExecTaskWithOptions(context.Context, string, string, ExecTaskOptions) (TaskDetail, error)
+	GetTaskDetail(context.Context, string) (TaskDetail, error)
+}
+
+// SchemaChangeService runs the review workflow of schema changes: a submitter
+// drafts an ALTER, submitting lints it and starts the PT dry-run, a different
+// user approves it, and the change runs as an online DDL task inside the
+// agreed window.
+type SchemaChangeService struct {
+	repo      changedomain.Repository
+	snapshots schemadomain.Repository
+	tasks     schemaChangeTasks
+
+	mu      sync.Mutex
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func NewSchemaChangeService(repo changedomain.Repository, snapshots schemadomain.Repository, tasks schemaChangeTasks) *SchemaChangeService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SchemaChangeService{repo: repo, snapshots: snapshots, tasks: tasks, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// Start follows dry-run and execution tasks and starts scheduled changes when
+// their window opens.
+func (s *SchemaChangeService) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+	go s.loop(s.ctx)
+}
+
+func (s *SchemaChangeService) Close() {
+	if s == nil || s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+}
+
+func (s *SchemaChangeService) Create(ctx context.Context, draft SchemaChangeDraft) (changedomain.Request, error) {
+	actor, err := schemaChangeActor(draft.Actor)
+	if err != nil {
+		return changedomain.Request{}, err
+	}
+	now := time.Now().UTC()
+	item := changedomain.Request{
+		ID: newEntityID("change"), SubmittedBy: actor, Status: changedomain.StatusDraft,
+		Findings: []changedomain.Finding{}, CreatedAt: now,
+	}
+	if err := s.applyDraft(ctx, &item, draft); err != nil {
+		return changedomain.Request{}, err
+	}
+	schemaChangeTransition(&item, actor, "create", changedomain.StatusDraft, "", now)
+	return item, s.repo.Save(ctx, item)
+}
+
+// Update replaces the ALTER or its gates. Only the submitter can edit, and any
+// edit sends the request back to draft: lint, dry-run and approval no longer
+// apply to the new text.
+func (s *SchemaChangeService) Update(ctx context.Context, id string, draft SchemaChangeDraft) (changedomain.Request, error) {
+	return s.mutate(ctx, id, func(item *changedomain.Request, now time.Time) error {
+		actor, err := schemaChangeActor(draft.Actor)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(actor, item.SubmittedBy) {
+			return errors.New("只有提交人可以修改变更单")
+		}
+		if !schemaChangeIn(item.Status, changedomain.StatusDraft, changedomain.StatusLinted, changedomain.StatusRejected) {
+			return fmt.Errorf("状态为 %s 的变更单不能修改", item.Status)
+		}
+		if err := s.applyDraft(ctx, item, draft); err != nil {
+			return err
+		}
+		item.Findings, item.LintedAt, item.DryRunTaskID, item.DryRunStatus = []changedomain.Finding{}, nil, "", ""
+		schemaChangeTransition(item, actor, "update", changedomain.StatusDraft, "", now)
+		return nil
+	})
+}
+
+// Submit lints the ALTER against the latest schema snapshot and starts the PT
+// dry-run. Submitting a linted request again repeats both.
+func (s *SchemaChangeService) Submit(ctx context.Context, id, actor string) (changedomain.Request, error) {
+	return s.mutate(ctx, id, func(item *changedomain.Request, now time.Time) error {
+		actor, err := schemaChangeActor(actor)
+		if err != nil {
+			return err
+		}
+		if !schemaChangeIn(item.Status, changedomain.StatusDraft, changedomain.StatusLinted) {
+			return fmt.Errorf("状态为 %s 的变更单不能提交审核", item.Status)
+		}
+		var table *schemadomain.Table
+		snapshot, ok, err := s.snapshots.LatestSnapshot(ctx, item.MachineID, item.Port)
+		if err != nil {
+			return err
+		}
+		if ok {
+			table = schemaSnapshotTable(snapshot, item.Schema, item.Table)
+			if table == nil {
+				return fmt.Errorf("最新结构快照中没有表 %s.%s，请先重新采集结构快照", item.Schema, item.Table)
+			}
+		}
+		detail, err := s.tasks.CreateExecTaskWithOptions(ctx, item.MachineIP, "", ExecTaskOptions{
+			Operation: "mysql_online_ddl_dry_run", DisplayName: fmt.Sprintf("变更单 %s PT 预演 %s.%s", item.ID, item.Schema, item.Table),
+			Port: item.Port, Commands: item.DryRunCommands,
+		})
+		if err != nil {
+			return fmt.Errorf("创建 PT 预演任务失败: %w", err)
+		}
+		item.Findings = mysqlapp.LintAlter(table, item.Alter)
+		item.LintedAt, item.DryRunTaskID, item.DryRunStatus = &now, detail.Task.ID, string(detail.Task.Status)
+		schemaChangeTransition(item, actor, "submit", changedomain.StatusLinted, "", now)
+		return nil
+	})
+}
+
+// Approve requires a reviewer other than the submitter, no lint errors and a
+// successful dry-run. A window in the review schedules the change directly.
+func (s *SchemaChangeService) Approve(ctx context.Context, id string, review SchemaChangeReview) (changedomain.Request, error) {
+	return s.mutate(ctx, id, func(item *changedomain.Request, now time.Time) error {
+		actor, err := schemaChangeActor(review.Actor)
+		if err != nil {
+			return err
+		}
+		if item.Status != changedomain.StatusLinted {
+			return fmt.Errorf("状态为 %s 的变更单不能审批", item.Status)
+		}
+		if strings.EqualFold(actor, item.SubmittedBy) {
+			return errors.New("审批人不能是变更单提交人")
+		}
+		for _, finding := range item.Findings {
+			if finding.Level == changedomain.LevelError {
+				return fmt.Errorf("变更单存在未解决的检查错误: %s", finding.Message)
+			}
+		}
+		s.refreshDryRun(ctx, item)
+		if item.DryRunStatus != string(taskdomain.StatusSuccess) {
+			return fmt.Errorf("PT 预演状态为 %s，预演成功后才能审批", item.DryRunStatus)
+		}
+		item.ApprovedBy, item.ApprovedAt = actor, &now
+		schemaChangeTransition(item, actor, "approve", changedomain.StatusApproved, review.Comment, now)
+		if !review.WindowStart.IsZero() || !review.WindowEnd.IsZero() {
+			return schemaChangeSchedule(item, actor, review, now)
+		}
+		return nil
+	})
+}
+
+// Schedule sets or moves the execution window of an approved change.
+func (s *SchemaChangeService) Schedule(ctx context.Context, id string, review SchemaChangeReview) (changedomain.Request, error) {
+	return s.mutate(ctx, id, func(item *changedomain.Request, now time.Time) error {
+		actor, err := schemaChangeActor(review.Actor)
+		if err != nil {
+			return err
+		}
+		if !schemaChangeIn(item.Status, changedomain.StatusApproved, changedomain.StatusScheduled) {
+			return fmt.Errorf("状态为 %s 的变更单不能排期", item.Status)
+		}
+		return schemaChangeSchedule(item, actor, review, now)
+	})
+}
+
+func (s *SchemaChangeService) Reject(ctx context.Context, id string, review SchemaChangeReview) (changedomain.Request, error) {
+	return s.mutate(ctx, id, func(item *changedomain.Request, now time.Time) error {
+		actor, err := schemaChangeActor(review.Actor)
+		if err != nil {
+			return err
+		}
+		if !schemaChangeIn(item.Status, changedomain.StatusDraft, changedomain.StatusLinted, changedomain.StatusApproved, changedomain.StatusScheduled) {
+			return fmt.Errorf("状态为 %s 的变更单不能驳回", item.Status)
+		}
+		if strings.TrimSpace(review.Comment) == "" {
+			return errors.New("驳回需要填写原因")
+		}
+		item.WindowStart, item.WindowEnd = nil, nil
+		schemaChangeTransition(item, actor, "reject", changedomain.StatusRejected, review.Comment, now)
+		return nil
+	})
+}
+
+func (s *SchemaChangeService) Get(ctx context.Context, id string) (changedomain.Request, bool, error) {
+	item, ok, err := s.repo.Get(ctx, strings.TrimSpace(id))
+	if err != nil || !ok {
+		return item, ok, err
+	}
+	if item.Status == changedomain.StatusLinted {
+		s.refreshDryRun(ctx, &item)
+	}
+	return item, true, nil
+}
+
+func (s *SchemaChangeService) List(ctx context.Context, cluster, status string, limit int) ([]changedomain.Request, error) {
+	return s.repo.List(ctx, strings.TrimSpace(cluster), strings.TrimSpace(status), limit)
+}
+
+func (s *SchemaChangeService) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(schemaChangeTick)
+	defer ticker.Stop()
+	for {
+		s.advance(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// advance starts scheduled changes whose window is open, expires missed
+// windows and records the result of running changes.
+func (s *SchemaChangeService) advance(ctx context.Context, now time.Time) {
+	items, err := s.repo.ListByStatus(ctx, changedomain.StatusLinted, changedomain.StatusScheduled, changedomain.StatusRunning)
+	if err != nil {
+		log.Printf("schema changes: list active requests: %v", err)
+		return
+	}
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if item.Status == changedomain.StatusLinted && (item.DryRunTaskID == "" || schemaChangeTaskDone(item.DryRunStatus)) {
+			continue
+		}
+		if item.Status == changedomain.StatusScheduled && item.WindowStart != nil && now.Before(*item.WindowStart) {
+			continue
+		}
+		if _, err := s.mutate(ctx, item.ID, func(item *changedomain.Request, _ time.Time) error {
+			s.step(ctx, item, now)
+			return nil
+		}); err != nil {
+			log.Printf("schema changes: advance %s: %v", item.ID, err)
+		}
+	}
+}
+
+func (s *SchemaChangeService) step(ctx context.Context, item *changedomain.Request, now time.Time) {
+	switch item.Status {
+	case changedomain.StatusLinted:
+		s.refreshDryRun(ctx, item)
+	case changedomain.StatusScheduled:
+		if item.WindowStart == nil || item.WindowEnd == nil || now.Before(*item.WindowStart) {
+			return
+		}
+		if !now.Before(*item.WindowEnd) {
+			item.WindowStart, item.WindowEnd = nil, nil
+			schemaChangeTransition(item, "system", "window_missed", changedomain.StatusApproved, "执行窗口已结束仍未开始，请重新排期", now)
+			return
+		}
+		detail, err := s.tasks.CreateExecTaskWithOptions(ctx, item.MachineIP, "", ExecTaskOptions{
+			Operation: "mysql_online_ddl_execute", DisplayName: fmt.Sprintf("变更单 %s PT 在线 DDL %s.%s", item.ID, item.Schema, item.Table),
+			Port: item.Port, Commands: item.ExecuteCommands,
+		})
+		if err != nil {
+			item.Message = "创建执行任务失败，将在窗口内重试: " + err.Error()
+			return
+		}
+		item.ExecuteTaskID, item.StartedAt, item.Message = detail.Task.ID, &now, ""
+		schemaChangeTransition(item, "system", "execute", changedomain.StatusRunning, "", now)
+	case changedomain.StatusRunning:
+		detail, err := s.tasks.GetTaskDetail(ctx, item.ExecuteTaskID)
+		if err != nil || !schemaChangeTaskDone(string(detail.Task.Status)) {
+			return
+		}
+		item.FinishedAt = &now
+		if detail.Task.Status == taskdomain.StatusSuccess {
+			schemaChangeTransition(item, "system", "finish", changedomain.StatusDone, "", now)
+			return
+		}
+		item.Message = "在线 DDL 任务失败，详情见任务 " + item.ExecuteTaskID
+		schemaChangeTransition(item, "system", "finish", changedomain.StatusFailed, item.Message, now)
+	}
+}
+
+func (s *SchemaChangeService) refreshDryRun(ctx context.Context, item *changedomain.Request) {
+	if item.DryRunTaskID == "" || schemaChangeTaskDone(item.DryRunStatus) {
+		return
+	}
+	if detail, err := s.tasks.GetTaskDetail(ctx, item.DryRunTaskID); err == nil {
+		item.DryRunStatus = string(detail.Task.Status)
+	}
+}
+
+// mutate serializes the read-modify-write of one request.
+func (s *SchemaChangeService) mutate(ctx context.Context, id string, change func(*changedomain.Request, time.Time) error) (changedomain.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok, err := s.repo.Get(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return changedomain.Request{}, err
+	}
+	if !ok {
+		return changedomain.Request{}, ErrSchemaChangeNotFound
+	}
+	now := time.Now().UTC()
+	if err := change(&item, now); err != nil {
+		return changedomain.Request{}, err
+	}
+	item.UpdatedAt = now
+	return item, s.repo.Save(ctx, item)
+}
+
+func (s *SchemaChangeService) applyDraft(ctx context.Context, item *changedomain.Request, draft SchemaChangeDraft) error {
+	if len(draft.DryRunCommands) == 0 || len(draft.ExecuteCommands) == 0 {
+		return errors.New("变更单缺少在线 DDL 命令")
+	}
+	machine, _, err := s.tasks.ResolveMySQLInstance(ctx, draft.MachineID, draft.Port)
+	if err != nil {
+		return err
+	}
+	title := strings.TrimSpace(draft.Title)
+	if title == "" {
+		title = fmt.Sprintf("%s.%s 结构变更", draft.Schema, draft.Table)
+	}
+	item.Title, item.Cluster, item.MachineID, item.MachineName, item.MachineIP = title, machine.Cluster, machine.ID, machine.Name, machine.IP
+	item.Port, item.Schema, item.Table, item.Alter = draft.Port, draft.Schema, draft.Table, draft.Alter
+	item.Purpose, item.Impact, item.Options = draft.Purpose, draft.Impact, draft.Options
+	item.DryRunCommands, item.ExecuteCommands = draft.DryRunCommands, draft.ExecuteCommands
+	return nil
+}
+
+func schemaChangeSchedule(item *changedomain.Request, actor string, review SchemaChangeReview, now time.Time) error {
+	start, end := review.WindowStart.UTC(), review.WindowEnd.UTC()
+	if start.IsZero() || end.IsZero() || !end.After(start) {
+		return errors.New("执行窗口需要开始和结束时间，且结束晚于开始")
+	}
+	if !end.After(now) {
+		return errors.New("执行窗口已经结束")
+	}
+	if end.Sub(start) > schemaChangeMaxWindow {
+		return errors.New("执行窗口不能超过 24 小时")
+	}
+	item.WindowStart, item.WindowEnd = &start, &end
+	comment := fmt.Sprintf("%s ~ %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	if strings.TrimSpace(review.Comment) != "" {
+		comment = strings.TrimSpace(review.Comment) + "；" + comment
+	}
+	schemaChangeTransition(item, actor, "schedule", changedomain.StatusScheduled, comment, now)
+	return nil
+}
+
+func schemaChangeTransition(item *changedomain.Request, actor, action, to, comment string, now time.Time) {
+	item.History = append(item.History, changedomain.Event{
+		At: now, Actor: actor, Action: action, From: item.Status, To: to, Comment: strings.TrimSpace(comment),
+	})
+	item.Status = to
+}
+
+func schemaSnapshotTable(snapshot schemadomain.Snapshot, schema, table string) *schemadomain.Table {
+	for _, candidate := range snapshot.Definition.Schemas {
+		if candidate.Name != schema {
+			continue
+		}
+		for index := range candidate.Tables {
+			if candidate.Tables[index].Name == table {
+				return &candidate.Tables[index]
+			}
+		}
+	}
+	return nil
+}
+
+func schemaChangeActor(actor string) (string, error) {
+	actor = strings.TrimSpace(actor)
+	if actor == "" {
+		return "", errors.New("actor is required")
+	}
+	if len(actor) > schemaChangeActorMaxSize {
+		return "", errors.New("actor must be at most 128 characters")
+	}
+	return actor, nil
+}
+
+func schemaChangeTaskDone(status string) bool {
+	return status == string(taskdomain.StatusSuccess) || status == string(taskdomain.StatusFailed)
+}
+
+func schemaChangeIn(status string, states ...string) bool {
+	for _, state := range states {
+		if status == state {
+			return true
+		}
+	}
+	return false
+}
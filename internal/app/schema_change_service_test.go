@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	machinedomain "gmha/internal/domain/machine"
+	changedomain "gmha/internal/domain/schemachange"
+	schemadomain "gmha/internal/domain/schemasnapshot"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type schemaChangeMemoryRepo struct {
+	items map[string]changedomain.Request
+}
+
+func (r *schemaChangeMemoryRepo) Save(_ context.Context, item changedomain.Request) error {
+	r.items[item.ID] = item
+	return nil
+}
+
+func (r *schemaChangeMemoryRepo) Get(_ context.Context, id string) (changedomain.Request, bool, error) {
+	item, ok := r.items[id]
+	return item, ok, nil
+}
+
+func (r *schemaChangeMemoryRepo) List(context.Context, string, string, int) ([]changedomain.Request, error) {
+	return nil, nil
+}
+
+func (r *schemaChangeMemoryRepo) ListByStatus(_ context.Context, statuses ...string) ([]changedomain.Request, error) {
+	var items []changedomain.Request
+	for _, item := range r.items {
+		if schemaChangeIn(item.Status, statuses...) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+type schemaChangeTaskFake struct {
+	tasks map[string]taskdomain.Task
+	ops   []string
+}
+
+func (f *schemaChangeTaskFake) ResolveMySQLInstance(_ context.Context, selector string, port int) (machinedomain.Machine, mysqlapp.Instance, error) {
+	return machinedomain.Machine{ID: selector, Name: "db-1", IP: "10.0.0.1", Cluster: "orders"}, mysqlapp.Instance{MachineID: selector, Port: port}, nil
+}
+
+func (f *schemaChangeTaskFake) CreateExecTaskWithOptions(_ context.Context, _, _ string, opts ExecTaskOptions) (TaskDetail, error) {
+	task := taskdomain.Task{ID: fmt.Sprintf("task-%d", len(f.ops)+1), Status: taskdomain.StatusPending}
+	f.tasks[task.ID] = task
+	f.ops = append(f.ops, opts.Operation)
+	return TaskDetail{Task: task}, nil
+}
+
+func (f *schemaChangeTaskFake) GetTaskDetail(_ context.Context, id string) (TaskDetail, error) {
+	return TaskDetail{Task: f.tasks[id]}, nil
+}
+
+func (f *schemaChangeTaskFake) finish(id string, status taskdomain.Status) {
+	task := f.tasks[id]
+	task.Status = status
+	f.tasks[id] = task
+}
+
+func TestSchemaChangeServiceRequiresReviewAndRunsInWindow(t *testing.T) {
+	ctx := context.Background()
+	repo := &schemaChangeMemoryRepo{items: map[string]changedomain.Request{}}
+	snapshots := &schemaMemoryRepo{items: []schemadomain.Snapshot{{ID: "snap-1", MachineID: "m1", Port: 3306, Definition: schemadomain.Definition{Schemas: []schemadomain.Schema{{
+		Name: "shop", Tables: []schemadomain.Table{mysqlapp.ParseCreateTable("orders", "CREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  `note` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")},
+	}}}}}}
+	tasks := &schemaChangeTaskFake{tasks: map[string]taskdomain.Task{}}
+	service := NewSchemaChangeService(repo, snapshots, tasks)
+	commands := []taskdomain.ExecCommandStep{{Name: "pt", Command: "pt-online-schema-change"}}
+	draft := SchemaChangeDraft{MachineID: "m1", Port: 3306, Schema: "shop", Table: "orders", Alter: "DROP PRIMARY KEY", Actor: "dev",
+		DryRunCommands: commands, ExecuteCommands: commands}
+
+	item, err := service.Create(ctx, draft)
+	if err != nil || item.Status != changedomain.StatusDraft || item.Cluster != "orders" {
+		t.Fatalf("create: %+v err=%v", item, err)
+	}
+	if item, err = service.Submit(ctx, item.ID, "dev"); err != nil || item.Status != changedomain.StatusLinted {
+		t.Fatalf("submit: %+v err=%v", item, err)
+	}
+	tasks.finish(item.DryRunTaskID, taskdomain.StatusSuccess)
+	if _, err := service.Approve(ctx, item.ID, SchemaChangeReview{Actor: "dba"}); err == nil {
+		t.Fatal("lint errors must block approval")
+	}
+
+	draft.Alter = "ADD COLUMN `status` tinyint NOT NULL DEFAULT 0"
+	foreign := draft
+	foreign.Actor = "dba"
+	if _, err := service.Update(ctx, item.ID, foreign); err == nil {
+		t.Fatal("only the submitter may edit the request")
+	}
+	if item, err = service.Update(ctx, item.ID, draft); err != nil || item.Status != changedomain.StatusDraft || item.DryRunTaskID != "" {
+		t.Fatalf("update must reset the review: %+v err=%v", item, err)
+	}
+	if item, err = service.Submit(ctx, item.ID, "dev"); err != nil || len(item.Findings) != 0 {
+		t.Fatalf("clean ALTER should lint without findings: %+v err=%v", item.Findings, err)
+	}
+	if _, err := service.Approve(ctx, item.ID, SchemaChangeReview{Actor: "dba"}); err == nil {
+		t.Fatal("a pending dry-run must block approval")
+	}
+	tasks.finish(item.DryRunTaskID, taskdomain.StatusSuccess)
+	if _, err := service.Approve(ctx, item.ID, SchemaChangeReview{Actor: "DEV"}); err == nil {
+		t.Fatal("the submitter must not approve their own change")
+	}
+	start := time.Now().UTC().Add(time.Hour)
+	item, err = service.Approve(ctx, item.ID, SchemaChangeReview{Actor: "dba", Comment: "ok", WindowStart: start, WindowEnd: start.Add(time.Hour)})
+	if err != nil || item.Status != changedomain.StatusScheduled || item.ApprovedBy != "dba" {
+		t.Fatalf("approve: %+v err=%v", item, err)
+	}
+
+	service.advance(ctx, start.Add(-time.Minute))
+	if item, _, _ = service.Get(ctx, item.ID); item.Status != changedomain.StatusScheduled {
+		t.Fatalf("change must wait for its window: %s", item.Status)
+	}
+	service.advance(ctx, start.Add(time.Minute))
+	if item, _, _ = service.Get(ctx, item.ID); item.Status != changedomain.StatusRunning || tasks.ops[len(tasks.ops)-1] != "mysql_online_ddl_execute" {
+		t.Fatalf("window open must start the online DDL: %+v ops=%v", item, tasks.ops)
+	}
+	tasks.finish(item.ExecuteTaskID, taskdomain.StatusSuccess)
+	service.advance(ctx, start.Add(2*time.Minute))
+	if item, _, _ = service.Get(ctx, item.ID); item.Status != changedomain.StatusDone || item.FinishedAt == nil {
+		t.Fatalf("finished task must close the request: %+v", item)
+	}
+	if len(item.History) != 8 {
+		t.Fatalf("every transition must be recorded, got %d events", len(item.History))
+	}
+}
+
+func TestSchemaChangeServiceReturnsMissedWindowToApproved(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	start, end := now.Add(-2*time.Hour), now.Add(-time.Hour)
+	repo := &schemaChangeMemoryRepo{items: map[string]changedomain.Request{
+		"change-1": {ID: "change-1", Status: changedomain.StatusScheduled, WindowStart: &start, WindowEnd: &end},
+	}}
+	tasks := &schemaChangeTaskFake{tasks: map[string]taskdomain.Task{}}
+	service := NewSchemaChangeService(repo, &schemaMemoryRepo{}, tasks)
+
+	service.advance(ctx, now)
+	item := repo.items["change-1"]
+	if item.Status != changedomain.StatusApproved || item.WindowStart != nil || len(tasks.ops) != 0 {
+		t.Fatalf("missed window must not execute: %+v ops=%v", item, tasks.ops)
+	}
+}
@@ -0,0 +1,488 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	machinedomain "gmha/internal/domain/machine"
+	schemadomain "gmha/internal/domain/schemasnapshot"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	schemaDriftRuleID = "schema_replica_drift"
+	// schemaSnapshotInterval is how often every running instance is captured;
+	// a new version is only stored when its checksum changes.
+	schemaSnapshotInterval  = 6 * time.Hour
+	schemaSnapshotRetention = 180 * 24 * time.Hour
+	schemaSnapshotTick      = 10 * time.Minute
+)
+
+// SchemaDiffEndpoint selects one side of a diff: a stored snapshot, or a
+// registered instance that is captured on the spot.
+type SchemaDiffEndpoint struct {
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	MachineID  string `json:"machine_id,omitempty"`
+	Port       int    `json:"port,omitempty"`
+}
+
+type SchemaDiffRequest struct {
+	Source  SchemaDiffEndpoint `json:"source"`
+	Target  SchemaDiffEndpoint `json:"target"`
+	Schemas []string           `json:"schemas,omitempty"`
+}
+
+// SchemaDiffResult lists what target lacks or has in addition to source. The
+// script reconciles target to source and is meant for review, not execution
+// as is: destructive statements are commented out.
+type SchemaDiffResult struct {
+	Source schemadomain.Snapshot `json:"source"`
+	Target schemadomain.Snapshot `json:"target"`
+	Diff   schemadomain.Diff     `json:"diff"`
+	Script string                `json:"script"`
+}
+
+// SchemaDriftStatus compares the latest snapshot of a replica with the latest
+// snapshot of its cluster primary.
+type SchemaDriftStatus struct {
+	Cluster   string                `json:"cluster"`
+	Primary   schemadomain.Snapshot `json:"primary"`
+	Replica   schemadomain.Snapshot `json:"replica"`
+	Drifted   bool                  `json:"drifted"`
+	Confirmed bool                  `json:"confirmed"`
+	Diff      schemadomain.Diff     `json:"diff"`
+}
+
+type schemaCapture struct {
+	Definition schemadomain.Definition
+	Warnings   []string
+	Role       string
+}
+
+type schemaCaptureFunc func(context.Context, machinedomain.Machine, int, mysqlapp.DiagnosticCredential) (schemaCapture, error)
+
+// SchemaService keeps versioned schema snapshots of every registered instance
+// and watches replicas for schema drift from their primary.
+type SchemaService struct {
+	repo      schemadomain.Repository
+	instances MySQLInstanceRepository
+	machines  machinedomain.Repository
+	presets   MySQLAccountPresetRepository
+	alerts    *AlertService
+	capture   schemaCaptureFunc
+
+	mu        sync.Mutex
+	capturing map[string]bool
+	// drift remembers when a replica was first seen drifting. The alert is only
+	// raised after a later capture still differs, so DDL that has not been
+	// replayed yet does not page anyone.
+	drift     map[string]time.Time
+	recapture map[string]bool
+	started   bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewSchemaService(repo schemadomain.Repository, instances MySQLInstanceRepository, machines machinedomain.Repository, presets MySQLAccountPresetRepository) *SchemaService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SchemaService{
+		repo: repo, instances: instances, machines: machines, presets: presets, capture: captureInstanceSchema,
+		capturing: make(map[string]bool), drift: make(map[string]time.Time), recapture: make(map[string]bool),
+		ctx: ctx, cancel: cancel, done: make(chan struct{}),
+	}
+}
+
+// SetAlertService enables replica schema drift alerts.
+func (s *SchemaService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+// Start captures running instances periodically and evaluates replica drift
+// after each pass.
+func (s *SchemaService) Start() {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return
+	}
+	s.started = true
+	s.mu.Unlock()
+	go s.loop(s.ctx)
+}
+
+func (s *SchemaService) Close() {
+	if s == nil || s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+}
+
+// Snapshot captures the schema of one instance. Capturing an unchanged schema
+// only refreshes the checked time of the current version.
+func (s *SchemaService) Snapshot(ctx context.Context, machineID string, port int) (schemadomain.Snapshot, error) {
+	instance, machine, err := s.target(ctx, machineID, port)
+	if err != nil {
+		return schemadomain.Snapshot{}, err
+	}
+	credential, err := s.credential(ctx)
+	if err != nil {
+		return schemadomain.Snapshot{}, err
+	}
+	key := schemaInstanceKey(machine.ID, port)
+	s.mu.Lock()
+	if s.capturing[key] {
+		s.mu.Unlock()
+		return schemadomain.Snapshot{}, fmt.Errorf("实例 %s:%d 正在生成结构快照", machine.IP, port)
+	}
+	s.capturing[key] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.capturing, key)
+		delete(s.recapture, key)
+		s.mu.Unlock()
+	}()
+
+	captured, err := s.capture(ctx, machine, port, credential)
+	if err != nil {
+		return schemadomain.Snapshot{}, fmt.Errorf("读取实例 %s:%d 表结构失败: %s", machine.IP, port, safeBinlogError(err, credential.Password))
+	}
+	now := time.Now().UTC()
+	checksum := mysqlapp.SchemaChecksum(captured.Definition)
+	latest, ok, err := s.repo.LatestSnapshot(ctx, machine.ID, port)
+	if err != nil {
+		return schemadomain.Snapshot{}, err
+	}
+	if ok && latest.Checksum == checksum {
+		if err := s.repo.TouchSnapshot(ctx, latest.ID, captured.Role, now); err != nil {
+			return schemadomain.Snapshot{}, err
+		}
+		latest.Role, latest.CheckedAt = captured.Role, now
+		return latest, nil
+	}
+	schemas, tables, objects := mysqlapp.SchemaCounts(captured.Definition)
+	snapshot := schemadomain.Snapshot{
+		ID: newEntityID("schema"), Cluster: machine.Cluster, MachineID: machine.ID, MachineName: machine.Name,
+		MachineIP: machine.IP, Port: port, Role: captured.Role, ServerVersion: instance.Version, Checksum: checksum,
+		SchemaCount: schemas, TableCount: tables, ObjectCount: objects, Warnings: captured.Warnings,
+		TakenAt: now, CheckedAt: now, Definition: captured.Definition,
+	}
+	if err := s.repo.SaveSnapshot(ctx, snapshot); err != nil {
+		return schemadomain.Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns schema versions newest first without definitions.
+func (s *SchemaService) ListSnapshots(ctx context.Context, cluster, machineID string, port, limit int) ([]schemadomain.Snapshot, error) {
+	return s.repo.ListSnapshots(ctx, strings.TrimSpace(cluster), strings.TrimSpace(machineID), port, limit)
+}
+
+func (s *SchemaService) GetSnapshot(ctx context.Context, id string) (schemadomain.Snapshot, bool, error) {
+	return s.repo.GetSnapshot(ctx, strings.TrimSpace(id))
+}
+
+// Diff compares two snapshots or instances and generates the DDL turning the
+// target into the source.
+func (s *SchemaService) Diff(ctx context.Context, req SchemaDiffRequest) (SchemaDiffResult, error) {
+	source, err := s.endpoint(ctx, "source", req.Source)
+	if err != nil {
+		return SchemaDiffResult{}, err
+	}
+	target, err := s.endpoint(ctx, "target", req.Target)
+	if err != nil {
+		return SchemaDiffResult{}, err
+	}
+	if source.ID == target.ID {
+		return SchemaDiffResult{}, errors.New("source 与 target 是同一个结构快照")
+	}
+	diff := mysqlapp.DiffSchemas(source.Definition, target.Definition, req.Schemas)
+	script := mysqlapp.ReconcileScript(schemaScriptHeader(source, target, req.Schemas), diff)
+	source.Definition, target.Definition = schemadomain.Definition{}, schemadomain.Definition{}
+	return SchemaDiffResult{Source: source, Target: target, Diff: diff, Script: script}, nil
+}
+
+// Drift compares every replica with the primary of its cluster using their
+// latest snapshots. An empty cluster returns every cluster.
+func (s *SchemaService) Drift(ctx context.Context, cluster string) ([]SchemaDriftStatus, error) {
+	groups, err := s.latestByCluster(ctx, strings.TrimSpace(cluster))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SchemaDriftStatus, 0)
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, s.compareCluster(name, groups[name])...)
+	}
+	return out, nil
+}
+
+func (s *SchemaService) loop(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(schemaSnapshotTick)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		s.snapshotDue(ctx)
+		s.evaluateDrift(ctx)
+		if time.Since(lastPurge) >= 24*time.Hour {
+			lastPurge = time.Now()
+			if n, err := s.repo.PurgeSnapshots(ctx, time.Now().UTC().Add(-schemaSnapshotRetention)); err != nil {
+				log.Printf("schema snapshots: purge: %v", err)
+			} else if n > 0 {
+				log.Printf("schema snapshots: purged %d versions", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshotDue captures running instances whose latest snapshot is older than
+// the interval, plus replicas and primaries whose drift needs confirmation.
+func (s *SchemaService) snapshotDue(ctx context.Context) {
+	if _, err := s.credential(ctx); err != nil {
+		return
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		log.Printf("schema snapshots: list instances: %v", err)
+		return
+	}
+	for _, instance := range instances {
+		if ctx.Err() != nil {
+			return
+		}
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		latest, ok, err := s.repo.LatestSnapshot(ctx, instance.MachineID, instance.Port)
+		if err != nil {
+			log.Printf("schema snapshots: latest %s:%d: %v", instance.MachineID, instance.Port, err)
+			continue
+		}
+		s.mu.Lock()
+		recapture := s.recapture[schemaInstanceKey(instance.MachineID, instance.Port)]
+		s.mu.Unlock()
+		if ok && !recapture && time.Since(latest.CheckedAt) < schemaSnapshotInterval {
+			continue
+		}
+		if _, err := s.Snapshot(ctx, instance.MachineID, instance.Port); err != nil {
+			log.Printf("schema snapshots: capture %s:%d: %v", instance.MachineID, instance.Port, err)
+		}
+	}
+}
+
+func (s *SchemaService) evaluateDrift(ctx context.Context) {
+	items, err := s.Drift(ctx, "")
+	if err != nil {
+		log.Printf("schema snapshots: evaluate drift: %v", err)
+		return
+	}
+	for _, item := range items {
+		s.signalDrift(ctx, item)
+	}
+}
+
+func (s *SchemaService) compareCluster(cluster string, snapshots []schemadomain.Snapshot) []SchemaDriftStatus {
+	var primaries []schemadomain.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Role == sqldomain.InstanceRolePrimary {
+			primaries = append(primaries, snapshot)
+		}
+	}
+	// Without exactly one primary (failover in progress, dual primary) there
+	// is no reference to compare replicas with.
+	if len(primaries) != 1 {
+		return nil
+	}
+	primary := primaries[0]
+	var out []SchemaDriftStatus
+	for _, replica := range snapshots {
+		if replica.Role != sqldomain.InstanceRoleReplica {
+			continue
+		}
+		diff := mysqlapp.DiffSchemas(primary.Definition, replica.Definition, nil)
+		key := schemaInstanceKey(replica.MachineID, replica.Port)
+		status := SchemaDriftStatus{Cluster: cluster, Primary: primary, Replica: replica, Drifted: !diff.Equal(), Diff: diff}
+		s.mu.Lock()
+		if diff.Equal() {
+			delete(s.drift, key)
+		} else if seen, ok := s.drift[key]; !ok {
+			s.drift[key] = replica.CheckedAt
+			s.recapture[key] = true
+			s.recapture[schemaInstanceKey(primary.MachineID, primary.Port)] = true
+		} else {
+			status.Confirmed = replica.CheckedAt.After(seen)
+		}
+		s.mu.Unlock()
+		status.Primary.Definition, status.Replica.Definition = schemadomain.Definition{}, schemadomain.Definition{}
+		out = append(out, status)
+	}
+	return out
+}
+
+func (s *SchemaService) signalDrift(ctx context.Context, item SchemaDriftStatus) {
+	if s.alerts == nil {
+		return
+	}
+	signal := AlertSignal{
+		RuleID: schemaDriftRuleID, RuleName: "从库表结构与主库不一致", Metric: "schema_drift_objects", Category: "schema",
+		MachineID: item.Replica.MachineID, MachineName: item.Replica.MachineName, MachineIP: item.Replica.MachineIP, ClusterID: item.Cluster,
+		Labels: map[string]string{"cluster": item.Cluster, "mysql_port": strconv.Itoa(item.Replica.Port)},
+		Value:  float64(len(item.Diff.Items)), Threshold: 0, Operator: ">",
+	}
+	if !item.Drifted {
+		_ = s.alerts.ResolveSignal(ctx, signal)
+		return
+	}
+	if !item.Confirmed {
+		return
+	}
+	signal.Severity = alertdomain.SeverityWarning
+	signal.Message = fmt.Sprintf("从库 %s:%d 与主库 %s:%d 表结构不一致：缺少 %d 项，多出 %d 项，定义不同 %d 项",
+		item.Replica.MachineIP, item.Replica.Port, item.Primary.MachineIP, item.Primary.Port,
+		item.Diff.Missing, item.Diff.Extra, item.Diff.Changed)
+	_ = s.alerts.RaiseSignal(ctx, signal)
+}
+
+func (s *SchemaService) latestByCluster(ctx context.Context, cluster string) (map[string][]schemadomain.Snapshot, error) {
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]schemadomain.Snapshot)
+	for _, instance := range instances {
+		if instance.Status != mysqlapp.StatusRunning {
+			continue
+		}
+		snapshot, ok, err := s.repo.LatestSnapshot(ctx, instance.MachineID, instance.Port)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || snapshot.Cluster == "" || (cluster != "" && snapshot.Cluster != cluster) {
+			continue
+		}
+		groups[snapshot.Cluster] = append(groups[snapshot.Cluster], snapshot)
+	}
+	return groups, nil
+}
+
+func (s *SchemaService) endpoint(ctx context.Context, side string, endpoint SchemaDiffEndpoint) (schemadomain.Snapshot, error) {
+	if id := strings.TrimSpace(endpoint.SnapshotID); id != "" {
+		snapshot, ok, err := s.repo.GetSnapshot(ctx, id)
+		if err != nil {
+			return schemadomain.Snapshot{}, err
+		}
+		if !ok {
+			return schemadomain.Snapshot{}, fmt.Errorf("%s 结构快照 %s 不存在", side, id)
+		}
+		return snapshot, nil
+	}
+	if strings.TrimSpace(endpoint.MachineID) == "" {
+		return schemadomain.Snapshot{}, fmt.Errorf("%s 需要 snapshot_id 或 machine_id 与 port", side)
+	}
+	return s.Snapshot(ctx, endpoint.MachineID, endpoint.Port)
+}
+
+func (s *SchemaService) target(ctx context.Context, machineID string, port int) (mysqlapp.Instance, machinedomain.Machine, error) {
+	machineID = strings.TrimSpace(machineID)
+	if machineID == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("machine_id is required")
+	}
+	if port < 1 || port > 65535 {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, errors.New("port must be between 1 and 65535")
+	}
+	instance, ok, err := s.instances.Get(ctx, machineID, port)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("MySQL 实例 %s:%d 未登记", machineID, port)
+	}
+	machine, ok, err := s.machines.GetByID(ctx, machineID)
+	if err != nil {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, err
+	}
+	if !ok || strings.TrimSpace(machine.IP) == "" {
+		return mysqlapp.Instance{}, machinedomain.Machine{}, fmt.Errorf("实例 %s:%d 的机器地址不可用", machineID, port)
+	}
+	return instance, machine, nil
+}
+
+func (s *SchemaService) credential(ctx context.Context) (mysqlapp.DiagnosticCredential, error) {
+	if s.presets == nil {
+		return mysqlapp.DiagnosticCredential{}, errors.New("结构快照需要已配置的 MHA 管理账号")
+	}
+	items, err := s.presets.List(ctx)
+	if err != nil {
+		return mysqlapp.DiagnosticCredential{}, err
+	}
+	for _, item := range normalizeMySQLAccountPresets(items) {
+		if !item.Enabled || !strings.EqualFold(strings.TrimSpace(item.Role), mysqlapp.AccountRoleMHA) {
+			continue
+		}
+		if strings.TrimSpace(item.Username) != "" && item.Password != "" {
+			return mysqlapp.DiagnosticCredential{Username: strings.TrimSpace(item.Username), Password: item.Password}, nil
+		}
+	}
+	return mysqlapp.DiagnosticCredential{}, errors.New("结构快照需要已启用且凭据完整的 MHA 管理账号")
+}
+
+func captureInstanceSchema(ctx context.Context, machine machinedomain.Machine, port int, credential mysqlapp.DiagnosticCredential) (schemaCapture, error) {
+	client := mysqlapp.DiagnosticClient{QueryTimeout: 30 * time.Second}
+	db, err := client.Open(sqldomain.Instance{MachineID: machine.ID, MachineIP: machine.IP, Port: port}, credential)
+	if err != nil {
+		return schemaCapture{}, err
+	}
+	defer db.Close()
+	role, err := client.InstanceRole(ctx, db)
+	if err != nil {
+		return schemaCapture{}, err
+	}
+	definition, warnings, err := client.SchemaSnapshot(ctx, db)
+	if err != nil {
+		return schemaCapture{}, err
+	}
+	return schemaCapture{Definition: definition, Warnings: warnings, Role: role}, nil
+}
+
+func schemaScriptHeader(source, target schemadomain.Snapshot, schemas []string) string {
+	lines := []string{
+		fmt.Sprintf("GMHA schema reconcile: make %s:%d look like %s:%d.", target.MachineIP, target.Port, source.MachineIP, source.Port),
+		fmt.Sprintf("source snapshot %s taken %s", source.ID, source.TakenAt.Format(time.RFC3339)),
+		fmt.Sprintf("target snapshot %s taken %s", target.ID, target.TakenAt.Format(time.RFC3339)),
+	}
+	if len(schemas) > 0 {
+		lines = append(lines, "schemas: "+strings.Join(schemas, ", "))
+	}
+	lines = append(lines, "Review before executing; destructive statements are commented out.")
+	return strings.Join(lines, "\n")
+}
+
+func schemaInstanceKey(machineID string, port int) string {
+	return machineID + ":" + strconv.Itoa(port)
+}
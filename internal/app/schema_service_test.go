@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	machinedomain "gmha/internal/domain/machine"
+	schemadomain "gmha/internal/domain/schemasnapshot"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+type schemaMemoryRepo struct {
+	schemadomain.Repository
+	items []schemadomain.Snapshot
+}
+
+func (r *schemaMemoryRepo) SaveSnapshot(_ context.Context, s schemadomain.Snapshot) error {
+	r.items = append(r.items, s)
+	return nil
+}
+
+func (r *schemaMemoryRepo) TouchSnapshot(_ context.Context, id, role string, checkedAt time.Time) error {
+	for i := range r.items {
+		if r.items[i].ID == id {
+			r.items[i].Role, r.items[i].CheckedAt = role, checkedAt
+		}
+	}
+	return nil
+}
+
+func (r *schemaMemoryRepo) GetSnapshot(_ context.Context, id string) (schemadomain.Snapshot, bool, error) {
+	for _, item := range r.items {
+		if item.ID == id {
+			return item, true, nil
+		}
+	}
+	return schemadomain.Snapshot{}, false, nil
+}
+
+func (r *schemaMemoryRepo) LatestSnapshot(_ context.Context, machineID string, port int) (schemadomain.Snapshot, bool, error) {
+	for i := len(r.items) - 1; i >= 0; i-- {
+		if r.items[i].MachineID == machineID && r.items[i].Port == port {
+			return r.items[i], true, nil
+		}
+	}
+	return schemadomain.Snapshot{}, false, nil
+}
+
+type schemaInstanceRepo struct {
+	MySQLInstanceRepository
+	items []mysqlapp.Instance
+}
+
+func (r *schemaInstanceRepo) List(context.Context) ([]mysqlapp.Instance, error) { return r.items, nil }
+
+func (r *schemaInstanceRepo) Get(_ context.Context, machineID string, port int) (mysqlapp.Instance, bool, error) {
+	for _, item := range r.items {
+		if item.MachineID == machineID && item.Port == port {
+			return item, true, nil
+		}
+	}
+	return mysqlapp.Instance{}, false, nil
+}
+
+type schemaMachineRepo struct {
+	machinedomain.Repository
+	items map[string]machinedomain.Machine
+}
+
+func (r *schemaMachineRepo) GetByID(_ context.Context, id string) (machinedomain.Machine, bool, error) {
+	item, ok := r.items[id]
+	return item, ok, nil
+}
+
+func TestSchemaServiceVersionsDiffsAndConfirmsReplicaDrift(t *testing.T) {
+	ordersV1 := "CREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+	ordersV2 := "CREATE TABLE `orders` (\n  `id` bigint NOT NULL,\n  `note` varchar(64) DEFAULT NULL,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB"
+	definitions := map[string]string{"primary": ordersV2, "replica": ordersV1}
+	roles := map[string]string{"primary": sqldomain.InstanceRolePrimary, "replica": sqldomain.InstanceRoleReplica}
+	repo := &schemaMemoryRepo{}
+	alertRepo := newAlertMemoryRepo()
+	service := NewSchemaService(repo,
+		&schemaInstanceRepo{items: []mysqlapp.Instance{
+			{MachineID: "primary", Port: 3306, Version: "8.0.40", Status: mysqlapp.StatusRunning},
+			{MachineID: "replica", Port: 3306, Version: "8.0.40", Status: mysqlapp.StatusRunning},
+		}},
+		&schemaMachineRepo{items: map[string]machinedomain.Machine{
+			"primary": {ID: "primary", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+			"replica": {ID: "replica", Name: "db-2", IP: "10.0.0.2", Cluster: "orders"},
+		}},
+		histogramPresetRepo{})
+	service.SetAlertService(NewAlertService(alertRepo))
+	captures := 0
+	service.capture = func(_ context.Context, machine machinedomain.Machine, _ int, credential mysqlapp.DiagnosticCredential) (schemaCapture, error) {
+		captures++
+		if credential.Username != "mha" {
+			t.Fatalf("unexpected credential %+v", credential)
+		}
+		return schemaCapture{Role: roles[machine.ID], Definition: schemadomain.Definition{Schemas: []schemadomain.Schema{{
+			Name: "shop", Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci",
+			Tables: []schemadomain.Table{mysqlapp.ParseCreateTable("orders", definitions[machine.ID])},
+		}}}}, nil
+	}
+	ctx := context.Background()
+
+	first, err := service.Snapshot(ctx, "primary", 3306)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := service.Snapshot(ctx, "primary", 3306)
+	if err != nil || again.ID != first.ID || len(repo.items) != 1 || again.CheckedAt.Before(first.TakenAt) {
+		t.Fatalf("unchanged schema must only touch the current version: %+v err=%v versions=%d", again, err, len(repo.items))
+	}
+
+	result, err := service.Diff(ctx, SchemaDiffRequest{
+		Source: SchemaDiffEndpoint{SnapshotID: first.ID},
+		Target: SchemaDiffEndpoint{MachineID: "replica", Port: 3306},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Diff.Missing != 1 || len(result.Source.Definition.Schemas) != 0 ||
+		!strings.Contains(result.Script, "ALTER TABLE `shop`.`orders` ADD COLUMN `note` varchar(64) DEFAULT NULL AFTER `id`;") {
+		t.Fatalf("unexpected diff %+v\n%s", result.Diff, result.Script)
+	}
+
+	// The first drift sighting asks for fresh captures of both sides instead of
+	// alerting: the replica may simply not have applied the DDL yet.
+	service.evaluateDrift(ctx)
+	if len(alertRepo.events) != 0 || !service.recapture["replica:3306"] || !service.recapture["primary:3306"] {
+		t.Fatalf("first sighting must not alert: events=%v recapture=%v", alertRepo.events, service.recapture)
+	}
+	before := captures
+	service.snapshotDue(ctx)
+	if captures != before+2 || len(service.recapture) != 0 {
+		t.Fatalf("drifting instances were not recaptured: captures=%d recapture=%v", captures-before, service.recapture)
+	}
+	service.evaluateDrift(ctx)
+	if len(alertRepo.events) != 1 {
+		t.Fatalf("confirmed drift must alert, got %v", alertRepo.events)
+	}
+	for _, event := range alertRepo.events {
+		if event.RuleID != schemaDriftRuleID || event.MachineID != "replica" || event.Status != "firing" {
+			t.Fatalf("unexpected alert %+v", event)
+		}
+	}
+
+	definitions["replica"] = ordersV2
+	if _, err := service.Snapshot(ctx, "replica", 3306); err != nil {
+		t.Fatal(err)
+	}
+	drift, err := service.Drift(ctx, "orders")
+	if err != nil || len(drift) != 1 || drift[0].Drifted {
+		t.Fatalf("replica should match the primary again: %+v err=%v", drift, err)
+	}
+	service.evaluateDrift(ctx)
+	for _, event := range alertRepo.events {
+		if event.Status != "resolved" {
+			t.Fatalf("drift alert should resolve: %+v", event)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+var ErrSQLIndexAdviceInvalid = errors.New("索引建议请求无效")
+
+const (
+	sqlIndexAdviceMaxDigests   = 50
+	sqlIndexAdvicePTDataLength = 5 << 30
+)
+
+// SQLIndexAdviceQuery selects heavy digests from the TOP-SQL window. A digest
+// is heavy when it ran without an index at least once, or when it examines
+// many rows per call compared with the rows it returns or changes.
+type SQLIndexAdviceQuery struct {
+	Start                  time.Time
+	End                    time.Time
+	Cluster                string
+	Machine                string
+	Port                   int
+	Database               string
+	Limit                  int
+	MinExecutions          uint64
+	MinRowsExaminedPerCall float64
+	MinExaminedRatio       float64
+	MinTableRows           int64
+}
+
+type SQLIndexAdviceResult struct {
+	Start       time.Time            `json:"start"`
+	End         time.Time            `json:"end"`
+	Analyzed    int                  `json:"analyzed"`
+	Suggestions []SQLIndexSuggestion `json:"suggestions"`
+	Skipped     []SQLIndexSkip       `json:"skipped"`
+	Coverage    SQLCoverage          `json:"coverage"`
+}
+
+type SQLIndexSuggestion struct {
+	Instance           sqldomain.Instance     `json:"instance"`
+	Schema             string                 `json:"schema"`
+	Table              string                 `json:"table"`
+	Columns            []mysqlapp.IndexColumn `json:"columns"`
+	TableRows          int64                  `json:"table_rows"`
+	TableDataBytes     int64                  `json:"table_data_bytes"`
+	EstimatedSizeBytes int64                  `json:"estimated_size_bytes"`
+	RedundantIndexes   []string               `json:"redundant_indexes,omitempty"`
+	Evidence           []SQLIndexEvidence     `json:"evidence"`
+	TotalLatencyMS     float64                `json:"total_latency_ms"`
+	TaskRequest        SQLIndexTaskDraft      `json:"task_request"`
+}
+
+// SQLIndexEvidence is the digest that motivated a suggestion.
+type SQLIndexEvidence struct {
+	Digest              string  `json:"digest"`
+	DigestText          string  `json:"digest_text"`
+	Database            string  `json:"database"`
+	ExecutionCount      uint64  `json:"execution_count"`
+	TotalLatencyMS      float64 `json:"total_latency_ms"`
+	RowsExaminedPerCall float64 `json:"rows_examined_per_call"`
+	RowsReturnedPerCall float64 `json:"rows_returned_per_call"`
+	NoIndexUsedCount    int     `json:"no_index_used_count"`
+}
+
+type SQLIndexSkip struct {
+	Digest string `json:"digest"`
+	Schema string `json:"schema,omitempty"`
+	Table  string `json:"table,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// SQLIndexTaskDraft is the body of POST /api/v1/tasks/mysql-indexes for an
+// accepted suggestion. The operator still has to set lock_acknowledged.
+type SQLIndexTaskDraft struct {
+	Machine          string                 `json:"machine"`
+	Port             int                    `json:"port"`
+	Action           string                 `json:"action"`
+	Schema           string                 `json:"schema"`
+	Table            string                 `json:"table"`
+	Name             string                 `json:"name"`
+	Kind             string                 `json:"kind"`
+	Columns          []mysqlapp.IndexColumn `json:"columns"`
+	LockMode         string                 `json:"lock_mode"`
+	Purpose          string                 `json:"purpose"`
+	Impact           string                 `json:"impact"`
+	LockAcknowledged bool                   `json:"lock_acknowledged"`
+	OnlineWithPT     bool                   `json:"online_with_pt"`
+}
+
+type sqlIndexTarget struct {
+	db       *sql.DB
+	instance sqldomain.Instance
+	primary  bool
+	err      error
+}
+
+func (s *SQLDiagnosticService) IndexAdvice(ctx context.Context, req SQLIndexAdviceQuery) (SQLIndexAdviceResult, error) {
+	req = normalizeSQLIndexAdviceQuery(req)
+	query, err := s.normalizeHistoryQuery(SQLDiagnosticHistoryQuery{
+		Start: req.Start, End: req.End, Cluster: req.Cluster, Machine: req.Machine, Port: req.Port, Database: req.Database,
+	})
+	if err != nil {
+		return SQLIndexAdviceResult{}, fmt.Errorf("%w：%v", ErrSQLIndexAdviceInvalid, err)
+	}
+	window, err := s.aggregateTopSQL(ctx, query)
+	if err != nil {
+		return SQLIndexAdviceResult{}, err
+	}
+	events, err := s.repo.ListStatementEvents(ctx, statementEventQuery(query, 0))
+	if err != nil {
+		return SQLIndexAdviceResult{}, err
+	}
+	noIndex := map[string]int{}
+	for _, event := range events {
+		if event.NoIndexUsed && matchesInstance(event.Instance, query.Cluster, query.Machine, query.Port) {
+			noIndex[event.Digest+"\x00"+event.Database]++
+		}
+	}
+	heavy := heavyIndexDigests(window.items, noIndex, req)
+	result := SQLIndexAdviceResult{Start: query.Start, End: query.End, Analyzed: len(heavy)}
+
+	read, _, credErr := s.credentials(ctx)
+	targets := map[string]*sqlIndexTarget{}
+	defer func() {
+		for _, target := range targets {
+			if target.db != nil {
+				_ = target.db.Close()
+			}
+		}
+	}()
+	statsCache := map[string]mysqlapp.TableIndexStats{}
+	merged := map[string]*SQLIndexSuggestion{}
+	var order []string
+	for _, candidate := range heavy {
+		item := candidate.item
+		accesses, err := mysqlapp.ParseDigestAccess(item.DigestText, item.Database)
+		if err != nil {
+			result.Skipped = append(result.Skipped, SQLIndexSkip{Digest: item.Digest, Reason: "无法解析 SQL：" + err.Error()})
+			continue
+		}
+		if credErr != nil {
+			result.Skipped = append(result.Skipped, SQLIndexSkip{Digest: item.Digest, Reason: credErr.Error()})
+			continue
+		}
+		target := s.indexAdviceTarget(ctx, targets, item.Instances, read)
+		if target.err != nil {
+			result.Skipped = append(result.Skipped, SQLIndexSkip{Digest: item.Digest, Reason: target.err.Error()})
+			continue
+		}
+		suggested := false
+		for _, access := range accesses {
+			skip := func(reason string) {
+				result.Skipped = append(result.Skipped, SQLIndexSkip{Digest: item.Digest, Schema: access.Schema, Table: access.Table, Reason: reason})
+			}
+			statsKey := target.instance.Key() + "/" + strings.ToLower(access.Schema+"."+access.Table)
+			stats, cached := statsCache[statsKey]
+			if !cached {
+				var found bool
+				stats, found, err = s.client.LoadTableIndexStats(ctx, target.db, access.Schema, access.Table)
+				if err != nil {
+					skip("读取表结构失败：" + err.Error())
+					continue
+				}
+				if !found {
+					skip("表不存在或不是基础表")
+					continue
+				}
+				statsCache[statsKey] = stats
+			}
+			columns := mysqlapp.CandidateIndexColumns(access, stats.Cardinality)
+			if len(columns) == 0 {
+				continue
+			}
+			if stats.Rows < req.MinTableRows {
+				skip(fmt.Sprintf("表约 %d 行，低于 min_table_rows", stats.Rows))
+				continue
+			}
+			if name, ok := stats.CoveringIndex(columns); ok {
+				skip("已有索引 " + name + " 覆盖相同前缀")
+				continue
+			}
+			size, err := stats.EstimateIndexBytes(columns)
+			if err != nil {
+				skip(err.Error())
+				continue
+			}
+			suggested = true
+			key := target.instance.Key() + "/" + strings.ToLower(access.Schema+"."+access.Table+"("+indexColumnKey(columns)+")")
+			suggestion, ok := merged[key]
+			if !ok {
+				suggestion = &SQLIndexSuggestion{
+					Instance: target.instance, Schema: stats.Schema, Table: stats.Table, Columns: columns,
+					TableRows: stats.Rows, TableDataBytes: stats.DataLength, EstimatedSizeBytes: size,
+					RedundantIndexes: stats.RedundantIndexes(columns),
+				}
+				suggestion.TaskRequest = indexTaskDraft(stats, target.instance, columns)
+				merged[key] = suggestion
+				order = append(order, key)
+			}
+			suggestion.TotalLatencyMS += item.TotalLatencyMS
+			suggestion.Evidence = append(suggestion.Evidence, candidate.evidence)
+		}
+		if !suggested && len(accesses) > 0 && !hasSkip(result.Skipped, item.Digest) {
+			result.Skipped = append(result.Skipped, SQLIndexSkip{Digest: item.Digest, Reason: "没有可用索引提速的等值、范围或排序条件"})
+		}
+	}
+	for _, key := range order {
+		suggestion := merged[key]
+		suggestion.TaskRequest.Purpose, suggestion.TaskRequest.Impact = indexTaskJustification(*suggestion, query)
+		result.Suggestions = append(result.Suggestions, *suggestion)
+	}
+	sort.SliceStable(result.Suggestions, func(i, j int) bool {
+		return result.Suggestions[i].TotalLatencyMS > result.Suggestions[j].TotalLatencyMS
+	})
+	if len(result.Suggestions) > req.Limit {
+		result.Suggestions = result.Suggestions[:req.Limit]
+	}
+	result.Coverage = s.topCoverage(ctx, query, window)
+	return result, nil
+}
+
+func normalizeSQLIndexAdviceQuery(req SQLIndexAdviceQuery) SQLIndexAdviceQuery {
+	if req.Limit <= 0 || req.Limit > 100 {
+		req.Limit = 20
+	}
+	if req.MinExecutions == 0 {
+		req.MinExecutions = 10
+	}
+	if req.MinRowsExaminedPerCall <= 0 {
+		req.MinRowsExaminedPerCall = 1000
+	}
+	if req.MinExaminedRatio <= 0 {
+		req.MinExaminedRatio = 100
+	}
+	if req.MinTableRows <= 0 {
+		req.MinTableRows = 1000
+	}
+	return req
+}
+
+type heavyIndexDigest struct {
+	item     SQLTopItem
+	evidence SQLIndexEvidence
+}
+
+// heavyIndexDigests keeps the digests worth an index, heaviest first.
+func heavyIndexDigests(items []SQLTopItem, noIndex map[string]int, req SQLIndexAdviceQuery) []heavyIndexDigest {
+	var heavy []heavyIndexDigest
+	for _, item := range items {
+		if item.ExecutionCount < req.MinExecutions || strings.TrimSpace(item.DigestText) == "" {
+			continue
+		}
+		calls := float64(item.ExecutionCount)
+		evidence := SQLIndexEvidence{
+			Digest: item.Digest, DigestText: item.DigestText, Database: item.Database,
+			ExecutionCount: item.ExecutionCount, TotalLatencyMS: item.TotalLatencyMS,
+			RowsExaminedPerCall: float64(item.RowsExamined) / calls,
+			RowsReturnedPerCall: float64(item.RowsSent+item.RowsAffected) / calls,
+			NoIndexUsedCount:    noIndex[item.Digest+"\x00"+item.Database],
+		}
+		ratio := evidence.RowsExaminedPerCall / maxFloat(evidence.RowsReturnedPerCall, 1)
+		if evidence.NoIndexUsedCount == 0 && (evidence.RowsExaminedPerCall < req.MinRowsExaminedPerCall || ratio < req.MinExaminedRatio) {
+			continue
+		}
+		heavy = append(heavy, heavyIndexDigest{item: item, evidence: evidence})
+	}
+	sort.SliceStable(heavy, func(i, j int) bool { return heavy[i].item.TotalLatencyMS > heavy[j].item.TotalLatencyMS })
+	if len(heavy) > sqlIndexAdviceMaxDigests {
+		heavy = heavy[:sqlIndexAdviceMaxDigests]
+	}
+	return heavy
+}
+
+// indexAdviceTarget connects to the primary among the instances that ran the
+// digest, because index DDL is created there and replicated.
+func (s *SQLDiagnosticService) indexAdviceTarget(ctx context.Context, targets map[string]*sqlIndexTarget, instances []sqldomain.Instance, credential mysqlapp.DiagnosticCredential) *sqlIndexTarget {
+	var fallback *sqlIndexTarget
+	for _, instance := range instances {
+		target, ok := targets[instance.Key()]
+		if !ok {
+			target = &sqlIndexTarget{instance: instance}
+			targets[instance.Key()] = target
+			if target.db, target.err = s.client.Open(instance, credential); target.err == nil {
+				role, err := s.client.InstanceRole(ctx, target.db)
+				if err != nil {
+					target.err = err
+				} else {
+					target.primary = role == sqldomain.InstanceRolePrimary
+				}
+			}
+		}
+		if target.err != nil {
+			continue
+		}
+		if target.primary {
+			return target
+		}
+		if fallback == nil {
+			fallback = target
+		}
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return &sqlIndexTarget{err: errors.New("执行该 Digest 的实例均无法连接")}
+}
+
+func indexTaskDraft(stats mysqlapp.TableIndexStats, instance sqldomain.Instance, columns []mysqlapp.IndexColumn) SQLIndexTaskDraft {
+	existing := map[string]bool{}
+	for _, index := range stats.Indexes {
+		existing[strings.ToLower(index.Name)] = true
+	}
+	base := "idx"
+	for _, column := range columns {
+		base += "_" + column.Name
+	}
+	if len(base) > 60 {
+		base = base[:60]
+	}
+	name := base
+	for suffix := 2; existing[strings.ToLower(name)]; suffix++ {
+		name = fmt.Sprintf("%s_%d", base, suffix)
+	}
+	return SQLIndexTaskDraft{
+		Machine: instance.MachineID, Port: instance.Port, Action: "create", Schema: stats.Schema, Table: stats.Table,
+		Name: name, Kind: "btree", Columns: columns, LockMode: "none", OnlineWithPT: stats.DataLength >= sqlIndexAdvicePTDataLength,
+	}
+}
+
+// indexTaskJustification fills the purpose and impact fields the index task
+// requires; both are capped at the task's 500-byte limit.
+func indexTaskJustification(suggestion SQLIndexSuggestion, query SQLDiagnosticHistoryQuery) (string, string) {
+	top := suggestion.Evidence[0]
+	for _, evidence := range suggestion.Evidence[1:] {
+		if evidence.TotalLatencyMS > top.TotalLatencyMS {
+			top = evidence
+		}
+	}
+	purpose := fmt.Sprintf("SQL 诊断索引建议：%s 至 %s 有 %d 个 Digest 命中该表，最重的 %s 执行 %d 次，平均每次扫描 %.0f 行、返回 %.0f 行",
+		query.Start.Format(time.RFC3339), query.End.Format(time.RFC3339), len(suggestion.Evidence), shortDigest(top.Digest),
+		top.ExecutionCount, top.RowsExaminedPerCall, top.RowsReturnedPerCall)
+	if top.NoIndexUsedCount > 0 {
+		purpose += fmt.Sprintf("，%d 次未使用索引", top.NoIndexUsedCount)
+	}
+	impact := fmt.Sprintf("预计索引约 %.1f MiB（表约 %d 行、数据 %.1f MiB）；写入需同步维护新索引，执行前确认磁盘余量与复制延迟",
+		float64(suggestion.EstimatedSizeBytes)/(1<<20), suggestion.TableRows, float64(suggestion.TableDataBytes)/(1<<20))
+	if len(suggestion.RedundantIndexes) > 0 {
+		impact += "；创建后可评估删除冗余索引 " + strings.Join(suggestion.RedundantIndexes, ", ")
+	}
+	return truncateUTF8(purpose, 500), truncateUTF8(impact, 500)
+}
+
+func indexColumnKey(columns []mysqlapp.IndexColumn) string {
+	parts := make([]string, len(columns))
+	for index, column := range columns {
+		parts[index] = column.Name + " " + column.Direction
+	}
+	return strings.Join(parts, ",")
+}
+
+func hasSkip(items []SQLIndexSkip, digest string) bool {
+	for _, item := range items {
+		if item.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateUTF8(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	value = value[:limit]
+	for !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,427 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+var (
+	ErrSQLKillPolicyInvalid  = errors.New("自动查杀策略无效")
+	ErrSQLKillPolicyNotFound = errors.New("自动查杀策略不存在")
+)
+
+const (
+	killPolicyDefaultRate = 10
+	killPolicyMaxElapsed  = 7 * 24 * 60 * 60
+	killPolicySource      = "kill_policy"
+)
+
+func (s *SQLDiagnosticService) KillPolicies(ctx context.Context) ([]sqldomain.KillPolicy, error) {
+	return s.repo.ListKillPolicies(ctx)
+}
+
+func (s *SQLDiagnosticService) SaveKillPolicy(ctx context.Context, policy sqldomain.KillPolicy) (sqldomain.KillPolicy, error) {
+	policy, err := normalizeKillPolicy(policy)
+	if err != nil {
+		return sqldomain.KillPolicy{}, err
+	}
+	now := time.Now().UTC()
+	if policy.ID == "" {
+		policy.ID, policy.CreatedAt = stableID(policy.Name, fmt.Sprint(now.UnixNano())), now
+	} else {
+		existing, err := s.repo.ListKillPolicies(ctx)
+		if err != nil {
+			return sqldomain.KillPolicy{}, err
+		}
+		found := false
+		for _, item := range existing {
+			if item.ID == policy.ID {
+				found, policy.CreatedAt = true, item.CreatedAt
+				break
+			}
+		}
+		if !found {
+			return sqldomain.KillPolicy{}, fmt.Errorf("%w：%s", ErrSQLKillPolicyNotFound, policy.ID)
+		}
+	}
+	policy.UpdatedAt = now
+	if err := s.repo.SaveKillPolicy(ctx, policy); err != nil {
+		return sqldomain.KillPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (s *SQLDiagnosticService) DeleteKillPolicy(ctx context.Context, id string) error {
+	deleted, err := s.repo.DeleteKillPolicy(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w：%s", ErrSQLKillPolicyNotFound, id)
+	}
+	return nil
+}
+
+func normalizeKillPolicy(policy sqldomain.KillPolicy) (sqldomain.KillPolicy, error) {
+	policy.ID, policy.Name = strings.TrimSpace(policy.ID), strings.TrimSpace(policy.Name)
+	if policy.Name == "" || len(policy.Name) > 128 {
+		return policy, fmt.Errorf("%w：名称不能为空且不超过 128 个字符", ErrSQLKillPolicyInvalid)
+	}
+	policy.Target = strings.ToLower(strings.TrimSpace(policy.Target))
+	switch policy.Target {
+	case "":
+		policy.Target = sqldomain.KillTargetQuery
+	case sqldomain.KillTargetQuery, sqldomain.KillTargetIdleTransaction:
+	default:
+		return policy, fmt.Errorf("%w：target 只能是 query 或 idle_transaction", ErrSQLKillPolicyInvalid)
+	}
+	policy.InstanceRole = strings.ToLower(strings.TrimSpace(policy.InstanceRole))
+	switch policy.InstanceRole {
+	case "":
+		policy.InstanceRole = sqldomain.InstanceRoleAny
+	case sqldomain.InstanceRoleAny, sqldomain.InstanceRolePrimary, sqldomain.InstanceRoleReplica:
+	default:
+		return policy, fmt.Errorf("%w：instance_role 只能是 any、primary 或 replica", ErrSQLKillPolicyInvalid)
+	}
+	if policy.MinElapsedSeconds < 1 || policy.MinElapsedSeconds > killPolicyMaxElapsed {
+		return policy, fmt.Errorf("%w：min_elapsed_seconds 必须在 1–%d 之间", ErrSQLKillPolicyInvalid, killPolicyMaxElapsed)
+	}
+	if policy.MaxKillsPerMinute == 0 {
+		policy.MaxKillsPerMinute = killPolicyDefaultRate
+	}
+	if policy.MaxKillsPerMinute < 1 || policy.MaxKillsPerMinute > 1000 {
+		return policy, fmt.Errorf("%w：max_kills_per_minute 必须在 1–1000 之间", ErrSQLKillPolicyInvalid)
+	}
+	policy.Clusters = normalizeKillPatterns(policy.Clusters, false)
+	policy.Users = normalizeKillPatterns(policy.Users, false)
+	policy.Hosts = normalizeKillPatterns(policy.Hosts, false)
+	policy.Databases = normalizeKillPatterns(policy.Databases, false)
+	policy.Digests = normalizeKillPatterns(policy.Digests, true)
+	policy.Commands = normalizeKillPatterns(policy.Commands, false)
+	policy.States = normalizeKillPatterns(policy.States, false)
+	if _, err := compileKillPolicy(policy); err != nil {
+		return policy, fmt.Errorf("%w：%v", ErrSQLKillPolicyInvalid, err)
+	}
+	return policy, nil
+}
+
+// compiledKillPolicy carries a policy together with its LIKE patterns compiled
+// once when the policy is validated or loaded, so matching a session never
+// recompiles them.
+type compiledKillPolicy struct {
+	sqldomain.KillPolicy
+	clusters, users, hosts, databases, commands, states []*regexp.Regexp
+}
+
+func compileKillPolicy(policy sqldomain.KillPolicy) (compiledKillPolicy, error) {
+	compiled := compiledKillPolicy{KillPolicy: policy}
+	for _, field := range []struct {
+		name     string
+		patterns []string
+		target   *[]*regexp.Regexp
+	}{
+		{"clusters", policy.Clusters, &compiled.clusters},
+		{"users", policy.Users, &compiled.users},
+		{"hosts", policy.Hosts, &compiled.hosts},
+		{"databases", policy.Databases, &compiled.databases},
+		{"commands", policy.Commands, &compiled.commands},
+		{"states", policy.States, &compiled.states},
+	} {
+		for _, pattern := range field.patterns {
+			expr, err := compileLikePattern(pattern)
+			if err != nil {
+				return compiledKillPolicy{}, fmt.Errorf("%s 中的模式 %q 无效: %v", field.name, pattern, err)
+			}
+			*field.target = append(*field.target, expr)
+		}
+	}
+	return compiled, nil
+}
+
+func normalizeKillPatterns(values []string, lower bool) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(value)
+		}
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		out = append(out, value)
+	}
+	return out
+}
+
+// enforceKillPolicies runs after each collection cycle. The cycle's sessions
+// only decide whether an instance needs a look; candidates are re-sampled on
+// the kill connection so the kill never acts on a stale snapshot.
+func (s *SQLDiagnosticService) enforceKillPolicies(ctx context.Context, sessions []sqldomain.Session) {
+	policies, err := s.repo.ListKillPolicies(ctx)
+	if err != nil {
+		return
+	}
+	active := make([]compiledKillPolicy, 0, len(policies))
+	for _, policy := range policies {
+		if !policy.Enabled {
+			continue
+		}
+		// Saved policies were validated already; a row that no longer
+		// compiles is skipped rather than allowed to match everything.
+		if compiled, err := compileKillPolicy(policy); err == nil {
+			active = append(active, compiled)
+		}
+	}
+	if len(active) == 0 {
+		s.forgetKillerMatches("", nil)
+		return
+	}
+	targets, err := s.targets(ctx)
+	if err != nil {
+		return
+	}
+	readCredential, killCredential, err := s.credentials(ctx)
+	if err != nil {
+		return
+	}
+	exempt := map[string]bool{
+		strings.ToLower(readCredential.Username): true,
+		strings.ToLower(killCredential.Username): true,
+	}
+	byInstance := map[string][]sqldomain.Session{}
+	for _, session := range sessions {
+		byInstance[session.Instance.Key()] = append(byInstance[session.Instance.Key()], session)
+	}
+	for _, instance := range targets {
+		var applicable []compiledKillPolicy
+		needsLive, needsIdle := false, false
+		for _, policy := range active {
+			if !killPolicyCoversCluster(policy, instance) {
+				continue
+			}
+			applicable = append(applicable, policy)
+			if policy.Target == sqldomain.KillTargetIdleTransaction {
+				needsIdle = true
+				continue
+			}
+			for _, session := range byInstance[instance.Key()] {
+				if matchKillPolicy(policy, "", session, exempt) {
+					needsLive = true
+					break
+				}
+			}
+		}
+		if !needsLive && !needsIdle {
+			s.forgetKillerMatches(instance.Key(), nil)
+			continue
+		}
+		s.enforceInstanceKillPolicies(ctx, instance, killCredential, applicable, needsLive, needsIdle, exempt)
+	}
+}
+
+func (s *SQLDiagnosticService) enforceInstanceKillPolicies(ctx context.Context, instance sqldomain.Instance, credential mysqlapp.DiagnosticCredential, policies []compiledKillPolicy, needsLive, needsIdle bool, exempt map[string]bool) {
+	matched := map[string]bool{}
+	defer func() { s.forgetKillerMatches(instance.Key(), matched) }()
+	db, err := s.client.Open(instance, credential)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	role := ""
+	for _, policy := range policies {
+		if policy.InstanceRole != sqldomain.InstanceRoleAny {
+			if role, err = s.client.InstanceRole(ctx, db); err != nil {
+				return
+			}
+			break
+		}
+	}
+	cfg := s.Config()
+	var live, idle []sqldomain.Session
+	if needsLive {
+		if live, _, err = s.client.LiveSessions(ctx, db, instance, cfg); err != nil {
+			return
+		}
+	}
+	if needsIdle {
+		if idle, err = s.client.IdleTransactions(ctx, db, instance, cfg); err != nil {
+			return
+		}
+	}
+	handled := map[uint64]bool{}
+	for _, policy := range policies {
+		candidates, scope := live, sqldomain.KillScopeQuery
+		if policy.Target == sqldomain.KillTargetIdleTransaction {
+			candidates, scope = idle, sqldomain.KillScopeConnection
+		}
+		for _, session := range candidates {
+			if handled[session.ProcessID] || !matchKillPolicy(policy, role, session, exempt) {
+				continue
+			}
+			key := strings.Join([]string{policy.ID, instance.Key(), fmt.Sprint(session.ProcessID), session.Digest}, "|")
+			matched[key] = true
+			handled[session.ProcessID] = true
+			if !s.claimKillerMatch(key, instance.Key(), policy.KillPolicy, time.Now()) {
+				continue
+			}
+			s.killForPolicy(ctx, db, instance, policy.KillPolicy, scope, session)
+		}
+	}
+}
+
+// claimKillerMatch returns true once per continuous match of a session, and
+// only while the policy is inside its per-minute budget. A match refused by
+// the budget is retried on the next cycle.
+func (s *SQLDiagnosticService) claimKillerMatch(key, instanceKey string, policy sqldomain.KillPolicy, now time.Time) bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.killerSeen == nil {
+		s.killerSeen = make(map[string]string)
+	}
+	if s.killerHits == nil {
+		s.killerHits = make(map[string][]time.Time)
+	}
+	if _, ok := s.killerSeen[key]; ok {
+		return false
+	}
+	hits := s.killerHits[policy.ID][:0]
+	for _, hit := range s.killerHits[policy.ID] {
+		if now.Sub(hit) < time.Minute {
+			hits = append(hits, hit)
+		}
+	}
+	if len(hits) >= policy.MaxKillsPerMinute {
+		s.killerHits[policy.ID] = hits
+		return false
+	}
+	s.killerHits[policy.ID] = append(hits, now)
+	s.killerSeen[key] = instanceKey
+	return true
+}
+
+// forgetKillerMatches drops matches of an instance that were not seen again,
+// so a session that matches later is handled as a new occurrence. An empty
+// instance key clears every instance.
+func (s *SQLDiagnosticService) forgetKillerMatches(instanceKey string, matched map[string]bool) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	for key, owner := range s.killerSeen {
+		if (instanceKey == "" || owner == instanceKey) && !matched[key] {
+			delete(s.killerSeen, key)
+		}
+	}
+}
+
+func (s *SQLDiagnosticService) killForPolicy(ctx context.Context, db *sql.DB, instance sqldomain.Instance, policy sqldomain.KillPolicy, scope string, session sqldomain.Session) {
+	now := time.Now().UTC()
+	subject := "SQL 已执行"
+	if scope == sqldomain.KillScopeConnection {
+		subject = "事务空闲未提交"
+	}
+	audit := sqldomain.KillAudit{
+		ID: killAuditID(instance, session.ProcessID), Instance: instance, ProcessID: session.ProcessID,
+		ExpectedDigest: session.Digest, ExpectedStartedAt: session.QueryStartedAt,
+		SQLText: session.SQLText, User: session.User, ClientHost: session.ClientHost,
+		Reason:        fmt.Sprintf("自动查杀策略 %s 命中：%s %s", policy.Name, subject, (time.Duration(session.ElapsedMS) * time.Millisecond).String()),
+		RequestSource: killPolicySource + ":" + policy.ID, PolicyID: policy.ID,
+		Scope: scope, Status: "requested", RequestedAt: now,
+	}
+	if policy.DryRun {
+		audit.Status, audit.CompletedAt = sqldomain.KillStatusDryRun, &now
+		_ = s.repo.SaveKillAudit(ctx, audit)
+		return
+	}
+	_, _ = s.auditedKill(ctx, audit, func(ctx context.Context) error {
+		if scope == sqldomain.KillScopeConnection {
+			return s.client.KillConnection(ctx, db, session.ProcessID)
+		}
+		return s.client.KillQuery(ctx, db, session.ProcessID)
+	})
+}
+
+func killPolicyCoversCluster(policy compiledKillPolicy, instance sqldomain.Instance) bool {
+	return len(policy.clusters) == 0 || matchKillPatterns(policy.clusters, instance.Cluster)
+}
+
+// matchKillPolicy checks one session against a policy. An empty role skips
+// the role condition, which lets the caller pre-filter before asking the
+// server for its role.
+func matchKillPolicy(policy compiledKillPolicy, role string, session sqldomain.Session, exempt map[string]bool) bool {
+	if protectedDiagnosticUser(session.User) || exempt[strings.ToLower(strings.TrimSpace(session.User))] || killerExemptCommand(session.Command) {
+		return false
+	}
+	if role != "" && policy.InstanceRole != sqldomain.InstanceRoleAny && policy.InstanceRole != role {
+		return false
+	}
+	if policy.MinElapsedSeconds <= 0 || session.ElapsedMS < policy.MinElapsedSeconds*1000 {
+		return false
+	}
+	host := session.ClientHost
+	if parsed, _, err := net.SplitHostPort(host); err == nil {
+		host = parsed
+	}
+	if len(policy.Digests) > 0 {
+		found := false
+		for _, digest := range policy.Digests {
+			if strings.EqualFold(digest, session.Digest) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return (len(policy.users) == 0 || matchKillPatterns(policy.users, session.User)) &&
+		(len(policy.hosts) == 0 || matchKillPatterns(policy.hosts, host)) &&
+		(len(policy.databases) == 0 || matchKillPatterns(policy.databases, session.Database)) &&
+		(len(policy.commands) == 0 || matchKillPatterns(policy.commands, session.Command)) &&
+		(len(policy.states) == 0 || matchKillPatterns(policy.states, session.State))
+}
+
+// killerExemptCommand keeps replication and server threads out of reach of
+// broad policies such as "anything running longer than 60s".
+func killerExemptCommand(command string) bool {
+	command = strings.ToLower(strings.TrimSpace(command))
+	return strings.HasPrefix(command, "binlog dump") || command == "daemon" ||
+		command == "register slave" || command == "register replica" || command == "connect"
+}
+
+func matchKillPatterns(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileLikePattern translates a case-insensitive MySQL LIKE pattern with %
+// and _ wildcards into an anchored regular expression.
+func compileLikePattern(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
@@ -0,0 +1,488 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+const (
+	blockingTreeMaxDepth     = 32
+	lockHistoryMaxSamples    = 500
+	killRootBlockerSource    = "root_blocker"
+	defaultDeadlockLookback  = 24 * time.Hour
+	defaultLockHistoryWindow = time.Hour
+)
+
+// SQLBlockingNode is one session in a blocking tree. The lock fields describe
+// how this session waits for its parent and are empty on the root.
+type SQLBlockingNode struct {
+	ProcessID    uint64            `json:"process_id"`
+	ThreadID     uint64            `json:"thread_id,omitempty"`
+	TrxID        string            `json:"trx_id,omitempty"`
+	User         string            `json:"user"`
+	ClientHost   string            `json:"client_host"`
+	Command      string            `json:"command,omitempty"`
+	SQLText      string            `json:"sql_text"`
+	TrxStartedAt *time.Time        `json:"trx_started_at,omitempty"`
+	LockKind     string            `json:"lock_kind,omitempty"`
+	Object       string            `json:"object,omitempty"`
+	LockMode     string            `json:"lock_mode,omitempty"`
+	HeldLockMode string            `json:"held_lock_mode,omitempty"`
+	WaitMS       int64             `json:"wait_ms,omitempty"`
+	Blocked      []SQLBlockingNode `json:"blocked,omitempty"`
+}
+
+// SQLBlockingTree is rooted at a session that blocks others without waiting
+// itself. Killing the root releases the whole tree.
+type SQLBlockingTree struct {
+	Instance        sqldomain.Instance `json:"instance"`
+	CollectedAt     time.Time          `json:"collected_at"`
+	Root            SQLBlockingNode    `json:"root"`
+	BlockedSessions int                `json:"blocked_sessions"`
+	MaxWaitMS       int64              `json:"max_wait_ms"`
+	Cycle           bool               `json:"cycle,omitempty"`
+}
+
+type SQLLockResult struct {
+	CollectedAt time.Time                  `json:"collected_at"`
+	Trees       []SQLBlockingTree          `json:"trees"`
+	WaitCount   int                        `json:"wait_count"`
+	Statuses    []sqldomain.InstanceStatus `json:"statuses"`
+	Complete    bool                       `json:"complete"`
+	Warnings    []string                   `json:"warnings,omitempty"`
+}
+
+type SQLLockHistoryResult struct {
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Trees     []SQLBlockingTree `json:"trees"`
+	Truncated bool              `json:"truncated"`
+}
+
+type SQLDeadlockResult struct {
+	Start time.Time                  `json:"start"`
+	End   time.Time                  `json:"end"`
+	Items []sqldomain.DeadlockReport `json:"items"`
+}
+
+type KillRootBlockerRequest struct {
+	MachineID        string
+	Port             int
+	ProcessID        uint64
+	ExpectedThreadID uint64
+	ExpectedTrxID    string
+	Confirmation     string
+	Reason           string
+	RequestSource    string
+}
+
+type KillRootBlockerResult struct {
+	KillSQLResult
+	Tree SQLBlockingTree `json:"tree"`
+}
+
+// collectLocks samples lock waits and the latest deadlock during a full
+// collection cycle. Failures degrade the instance status, like the other
+// optional sources.
+func (s *SQLDiagnosticService) collectLocks(ctx context.Context, db *sql.DB, instance sqldomain.Instance, caps mysqlapp.DiagnosticCapabilities, cfg sqldomain.Config) []string {
+	var degraded []string
+	waits, err := s.client.LockWaits(ctx, db, instance, caps, cfg)
+	if err != nil {
+		degraded = append(degraded, "lock waits: "+err.Error())
+	}
+	if len(waits) > 0 {
+		if err := s.repo.SaveLockWaits(ctx, waits); err != nil {
+			degraded = append(degraded, "save lock waits: "+err.Error())
+		}
+	}
+	report, found, err := s.client.LatestDeadlock(ctx, db, instance, cfg)
+	if err != nil {
+		degraded = append(degraded, "latest deadlock: "+err.Error())
+	} else if found {
+		if _, err := s.repo.SaveDeadlockReport(ctx, report); err != nil {
+			degraded = append(degraded, "save deadlock: "+err.Error())
+		}
+	}
+	return degraded
+}
+
+// Locks samples lock waits live and renders blocking trees, root blocker
+// first and the largest tree first.
+func (s *SQLDiagnosticService) Locks(ctx context.Context, cluster, machine string, port int) (SQLLockResult, error) {
+	targets, err := s.targets(ctx)
+	if err != nil {
+		return SQLLockResult{}, err
+	}
+	readCredential, _, err := s.credentials(ctx)
+	if err != nil {
+		return SQLLockResult{}, err
+	}
+	var filtered []sqldomain.Instance
+	for _, target := range targets {
+		if matchesInstance(target, cluster, machine, port) {
+			filtered = append(filtered, target)
+		}
+	}
+	result := SQLLockResult{CollectedAt: time.Now().UTC(), Complete: true}
+	if len(filtered) == 0 {
+		result.Complete = false
+		result.Warnings = []string{"当前筛选范围没有已登记且可连接的 MySQL 实例"}
+		return result, nil
+	}
+	cfg := s.Config()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 4)
+	for _, target := range filtered {
+		target := target
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			status := sqldomain.InstanceStatus{Instance: target, Status: "ok", CollectionMode: "locks", LastAttemptAt: time.Now().UTC()}
+			waits, err := s.liveLockWaits(ctx, target, readCredential, cfg)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				status.Status, status.LastError = "error", err.Error()
+				result.Complete = false
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s:%d: %v", target.MachineIP, target.Port, err))
+			} else {
+				status.LastSuccessAt = time.Now().UTC()
+			}
+			result.Statuses = append(result.Statuses, status)
+			result.WaitCount += len(waits)
+			result.Trees = append(result.Trees, buildBlockingTrees(waits)...)
+		}()
+	}
+	wg.Wait()
+	sort.Slice(result.Statuses, func(i, j int) bool {
+		return result.Statuses[i].Instance.Key() < result.Statuses[j].Instance.Key()
+	})
+	sortBlockingTrees(result.Trees)
+	if len(result.Warnings) == len(filtered) {
+		return result, fmt.Errorf("%d/%d mysql instances failed lock collection", len(filtered), len(filtered))
+	}
+	return result, nil
+}
+
+func (s *SQLDiagnosticService) liveLockWaits(ctx context.Context, instance sqldomain.Instance, credential mysqlapp.DiagnosticCredential, cfg sqldomain.Config) ([]sqldomain.LockWait, error) {
+	db, err := s.client.Open(instance, credential)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// Without capabilities only the metadata lock source is skipped.
+	caps, _ := s.client.Capabilities(ctx, db)
+	return s.client.LockWaits(ctx, db, instance, caps, cfg)
+}
+
+// LockHistory rebuilds blocking trees from the lock waits persisted by the
+// collection loop, one set of trees per instance and collection cycle.
+func (s *SQLDiagnosticService) LockHistory(ctx context.Context, start, end time.Time, cluster, machine string, port int) (SQLLockHistoryResult, error) {
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultLockHistoryWindow)
+	}
+	if !start.Before(end) {
+		return SQLLockHistoryResult{}, errors.New("开始时间必须早于结束时间")
+	}
+	waits, err := s.repo.ListLockWaits(ctx, start.UTC(), end.UTC())
+	if err != nil {
+		return SQLLockHistoryResult{}, err
+	}
+	samples := map[string][]sqldomain.LockWait{}
+	for _, wait := range waits {
+		if !matchesInstance(wait.Instance, cluster, machine, port) {
+			continue
+		}
+		key := wait.Instance.Key() + "@" + wait.CollectedAt.Format(time.RFC3339Nano)
+		samples[key] = append(samples[key], wait)
+	}
+	result := SQLLockHistoryResult{Start: start.UTC(), End: end.UTC(), Trees: []SQLBlockingTree{}}
+	for _, sample := range samples {
+		result.Trees = append(result.Trees, buildBlockingTrees(sample)...)
+	}
+	sort.SliceStable(result.Trees, func(i, j int) bool {
+		if !result.Trees[i].CollectedAt.Equal(result.Trees[j].CollectedAt) {
+			return result.Trees[i].CollectedAt.After(result.Trees[j].CollectedAt)
+		}
+		return result.Trees[i].BlockedSessions > result.Trees[j].BlockedSessions
+	})
+	if len(result.Trees) > lockHistoryMaxSamples {
+		result.Trees, result.Truncated = result.Trees[:lockHistoryMaxSamples], true
+	}
+	return result, nil
+}
+
+func (s *SQLDiagnosticService) Deadlocks(ctx context.Context, start, end time.Time, cluster, machine string, port int) (SQLDeadlockResult, error) {
+	if end.IsZero() {
+		end = time.Now().UTC()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultDeadlockLookback)
+	}
+	items, err := s.repo.ListDeadlockReports(ctx, start.UTC(), end.UTC())
+	if err != nil {
+		return SQLDeadlockResult{}, err
+	}
+	result := SQLDeadlockResult{Start: start.UTC(), End: end.UTC(), Items: []sqldomain.DeadlockReport{}}
+	for _, item := range items {
+		if matchesInstance(item.Instance, cluster, machine, port) {
+			result.Items = append(result.Items, item)
+		}
+	}
+	return result, nil
+}
+
+// KillRootBlocker kills the connection at the root of a live blocking tree.
+// The root is often idle inside an open transaction, so KILL QUERY would not
+// release its locks; the connection is killed to roll the transaction back.
+// The request is re-validated against a fresh sample and audited like
+// KillQuery.
+func (s *SQLDiagnosticService) KillRootBlocker(ctx context.Context, req KillRootBlockerRequest) (KillRootBlockerResult, error) {
+	if req.ProcessID == 0 || strings.TrimSpace(req.MachineID) == "" || req.Port <= 0 {
+		return KillRootBlockerResult{}, errors.New("查杀必须指定 machine_id、port 和 process_id")
+	}
+	if req.ExpectedThreadID == 0 && strings.TrimSpace(req.ExpectedTrxID) == "" {
+		return KillRootBlockerResult{}, errors.New("查杀根阻塞会话必须携带 expected_thread_id 或 expected_trx_id")
+	}
+	if req.Confirmation != fmt.Sprintf("KILL %d", req.ProcessID) {
+		return KillRootBlockerResult{}, errors.New("确认短语必须精确匹配 KILL <process_id>")
+	}
+	if len(strings.TrimSpace(req.Reason)) < 3 {
+		return KillRootBlockerResult{}, errors.New("查杀原因至少需要 3 个字符")
+	}
+	instance, ok, err := s.target(ctx, req.MachineID, req.Port)
+	if err != nil {
+		return KillRootBlockerResult{}, err
+	}
+	if !ok {
+		return KillRootBlockerResult{}, errors.New("未找到已登记的 MySQL 实例")
+	}
+	_, killCredential, err := s.credentials(ctx)
+	if err != nil {
+		return KillRootBlockerResult{}, err
+	}
+	db, err := s.client.Open(instance, killCredential)
+	if err != nil {
+		return KillRootBlockerResult{}, err
+	}
+	defer db.Close()
+	caps, _ := s.client.Capabilities(ctx, db)
+	waits, err := s.client.LockWaits(ctx, db, instance, caps, s.Config())
+	if err != nil {
+		return KillRootBlockerResult{}, err
+	}
+	var tree *SQLBlockingTree
+	trees := buildBlockingTrees(waits)
+	for index := range trees {
+		if trees[index].Root.ProcessID == req.ProcessID && !trees[index].Cycle {
+			tree = &trees[index]
+			break
+		}
+	}
+	if tree == nil {
+		return KillRootBlockerResult{}, fmt.Errorf("%w：进程 %d 已不是根阻塞会话", ErrSQLDiagnosticConflict, req.ProcessID)
+	}
+	root := tree.Root
+	if (req.ExpectedThreadID != 0 && root.ThreadID != 0 && root.ThreadID != req.ExpectedThreadID) ||
+		(strings.TrimSpace(req.ExpectedTrxID) != "" && root.TrxID != strings.TrimSpace(req.ExpectedTrxID)) {
+		return KillRootBlockerResult{}, fmt.Errorf("%w：进程 %d 已开始另一个会话或事务", ErrSQLDiagnosticConflict, req.ProcessID)
+	}
+	if protectedDiagnosticUser(root.User) {
+		return KillRootBlockerResult{}, fmt.Errorf("%w：拒绝查杀 MySQL 受保护账号 %s", ErrSQLDiagnosticForbidden, root.User)
+	}
+	expectedStartedAt := time.Now().UTC()
+	if root.TrxStartedAt != nil {
+		expectedStartedAt = *root.TrxStartedAt
+	}
+	audit := sqldomain.KillAudit{
+		ID: killAuditID(instance, req.ProcessID), Instance: instance, ProcessID: req.ProcessID,
+		ExpectedDigest: mysqlapp.SQLFingerprint(root.SQLText), ExpectedStartedAt: expectedStartedAt,
+		SQLText: root.SQLText, User: root.User, ClientHost: root.ClientHost,
+		Reason:        fmt.Sprintf("%s（根阻塞会话，阻塞 %d 个会话）", strings.TrimSpace(req.Reason), tree.BlockedSessions),
+		RequestSource: strings.TrimSpace(req.RequestSource + "; " + killRootBlockerSource),
+		Scope:         sqldomain.KillScopeConnection, Status: "requested", RequestedAt: time.Now().UTC(),
+	}
+	result, err := s.auditedKill(ctx, audit, func(ctx context.Context) error {
+		return s.client.KillConnection(ctx, db, req.ProcessID)
+	})
+	return KillRootBlockerResult{KillSQLResult: result, Tree: *tree}, err
+}
+
+func blockingNodeKey(processID, threadID uint64) string {
+	if processID > 0 {
+		return fmt.Sprintf("p%d", processID)
+	}
+	return fmt.Sprintf("t%d", threadID)
+}
+
+// buildBlockingTrees turns wait edges of one instance sample into trees.
+// Roots block others without waiting themselves; blocked sessions that are
+// only reachable through a wait cycle get a tree rooted inside the cycle.
+func buildBlockingTrees(waits []sqldomain.LockWait) []SQLBlockingTree {
+	if len(waits) == 0 {
+		return nil
+	}
+	nodes := map[string]*SQLBlockingNode{}
+	merge := func(key string, node SQLBlockingNode) {
+		existing, ok := nodes[key]
+		if !ok {
+			nodes[key] = &node
+			return
+		}
+		if existing.ThreadID == 0 {
+			existing.ThreadID = node.ThreadID
+		}
+		if existing.TrxID == "" {
+			existing.TrxID = node.TrxID
+		}
+		if existing.User == "" {
+			existing.User, existing.ClientHost = node.User, node.ClientHost
+		}
+		if existing.Command == "" {
+			existing.Command = node.Command
+		}
+		if existing.SQLText == "" {
+			existing.SQLText = node.SQLText
+		}
+		if existing.TrxStartedAt == nil {
+			existing.TrxStartedAt = node.TrxStartedAt
+		}
+	}
+	children := map[string][]sqldomain.LockWait{}
+	waiting := map[string]bool{}
+	for _, wait := range waits {
+		waiter := blockingNodeKey(wait.WaitingProcessID, wait.WaitingThreadID)
+		blocker := blockingNodeKey(wait.BlockingProcessID, wait.BlockingThreadID)
+		if waiter == blocker {
+			continue
+		}
+		merge(waiter, SQLBlockingNode{
+			ProcessID: wait.WaitingProcessID, ThreadID: wait.WaitingThreadID, TrxID: wait.WaitingTrxID,
+			User: wait.WaitingUser, ClientHost: wait.WaitingHost, SQLText: wait.WaitingSQL,
+		})
+		blockerNode := SQLBlockingNode{
+			ProcessID: wait.BlockingProcessID, ThreadID: wait.BlockingThreadID, TrxID: wait.BlockingTrxID,
+			User: wait.BlockingUser, ClientHost: wait.BlockingHost, Command: wait.BlockingCommand, SQLText: wait.BlockingSQL,
+		}
+		if !wait.BlockingTrxStartedAt.IsZero() {
+			started := wait.BlockingTrxStartedAt
+			blockerNode.TrxStartedAt = &started
+		}
+		merge(blocker, blockerNode)
+		children[blocker] = append(children[blocker], wait)
+		waiting[waiter] = true
+	}
+	var roots []string
+	for key := range children {
+		if !waiting[key] {
+			roots = append(roots, key)
+		}
+	}
+	sort.Strings(roots)
+	reached := map[string]bool{}
+	var mark func(string)
+	mark = func(key string) {
+		if reached[key] {
+			return
+		}
+		reached[key] = true
+		for _, wait := range children[key] {
+			mark(blockingNodeKey(wait.WaitingProcessID, wait.WaitingThreadID))
+		}
+	}
+	for _, root := range roots {
+		mark(root)
+	}
+	cycleRoots := map[string]bool{}
+	var remaining []string
+	for key := range children {
+		if !reached[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	sort.Strings(remaining)
+	for _, key := range remaining {
+		if !reached[key] {
+			cycleRoots[key] = true
+			roots = append(roots, key)
+			mark(key)
+		}
+	}
+	collectedAt, instance := waits[0].CollectedAt, waits[0].Instance
+	trees := make([]SQLBlockingTree, 0, len(roots))
+	for _, key := range roots {
+		tree := SQLBlockingTree{Instance: instance, CollectedAt: collectedAt, Cycle: cycleRoots[key]}
+		blocked := map[string]bool{}
+		var render func(string, map[string]bool, int) []SQLBlockingNode
+		render = func(key string, path map[string]bool, depth int) []SQLBlockingNode {
+			if depth >= blockingTreeMaxDepth {
+				return nil
+			}
+			var out []SQLBlockingNode
+			for _, wait := range children[key] {
+				childKey := blockingNodeKey(wait.WaitingProcessID, wait.WaitingThreadID)
+				if path[childKey] {
+					continue
+				}
+				blocked[childKey] = true
+				if wait.WaitMS > tree.MaxWaitMS {
+					tree.MaxWaitMS = wait.WaitMS
+				}
+				child := *nodes[childKey]
+				child.LockKind, child.LockMode, child.HeldLockMode, child.WaitMS = wait.Kind, wait.LockMode, wait.BlockingLockMode, wait.WaitMS
+				child.Object = lockWaitObject(wait)
+				path[childKey] = true
+				child.Blocked = render(childKey, path, depth+1)
+				delete(path, childKey)
+				out = append(out, child)
+			}
+			sort.SliceStable(out, func(i, j int) bool { return out[i].WaitMS > out[j].WaitMS })
+			return out
+		}
+		tree.Root = *nodes[key]
+		tree.Root.Blocked = render(key, map[string]bool{key: true}, 0)
+		delete(blocked, key)
+		tree.BlockedSessions = len(blocked)
+		trees = append(trees, tree)
+	}
+	sortBlockingTrees(trees)
+	return trees
+}
+
+func sortBlockingTrees(trees []SQLBlockingTree) {
+	sort.SliceStable(trees, func(i, j int) bool {
+		if trees[i].BlockedSessions != trees[j].BlockedSessions {
+			return trees[i].BlockedSessions > trees[j].BlockedSessions
+		}
+		return trees[i].MaxWaitMS > trees[j].MaxWaitMS
+	})
+}
+
+func lockWaitObject(wait sqldomain.LockWait) string {
+	object := wait.ObjectName
+	if wait.ObjectSchema != "" {
+		object = wait.ObjectSchema + "." + object
+	}
+	if wait.Kind == sqldomain.LockKindMetadata && wait.ObjectType != "" && wait.ObjectType != "TABLE" {
+		object = strings.TrimSpace(wait.ObjectType + " " + object)
+	}
+	if wait.IndexName != "" {
+		object += " (" + wait.IndexName + ")"
+	}
+	return object
+}
@@ -0,0 +1,468 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	alertdomain "gmha/internal/domain/alert"
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+var ErrSQLRegressionInvalid = errors.New("SQL 回退对比请求无效")
+
+const (
+	SQLRegressionModePrevious     = "previous"
+	SQLRegressionModeDayOverDay   = "day_over_day"
+	SQLRegressionModeWeekOverWeek = "week_over_week"
+	SQLRegressionModeCustom       = "custom"
+
+	SQLRegressionStatusRegressed = "regressed"
+	SQLRegressionStatusNew       = "new"
+	SQLRegressionStatusUnchanged = "unchanged"
+
+	sqlRegressionRuleID          = "sql_regression"
+	sqlRegressionMinLatencyDelta = 1.0
+	sqlRegressionMinRowsDelta    = 100.0
+	sqlRegressionMaxPlans        = 10
+)
+
+// SQLRegressionQuery compares a current window with a baseline window. Mode
+// derives the baseline from the current window unless it is custom.
+type SQLRegressionQuery struct {
+	Mode             string    `json:"mode"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end"`
+	BaselineStart    time.Time `json:"baseline_start"`
+	BaselineEnd      time.Time `json:"baseline_end"`
+	Cluster          string    `json:"cluster"`
+	Machine          string    `json:"machine"`
+	Port             int       `json:"port"`
+	Database         string    `json:"database"`
+	ThresholdPercent float64   `json:"threshold_percent"`
+	MinExecutions    uint64    `json:"min_executions"`
+	Limit            int       `json:"limit"`
+	CapturePlans     bool      `json:"capture_plans"`
+	RaiseAlerts      bool      `json:"raise_alerts"`
+}
+
+type SQLRegressionWindowStats struct {
+	ExecutionCount      uint64  `json:"execution_count"`
+	ExecutionsPerHour   float64 `json:"executions_per_hour"`
+	TotalLatencyMS      float64 `json:"total_latency_ms"`
+	AverageLatencyMS    float64 `json:"average_latency_ms"`
+	RowsExaminedPerCall float64 `json:"rows_examined_per_call"`
+}
+
+type SQLRegressionItem struct {
+	Digest                      string                    `json:"digest"`
+	DigestText                  string                    `json:"digest_text"`
+	Database                    string                    `json:"database"`
+	Status                      string                    `json:"status"`
+	Reasons                     []string                  `json:"reasons,omitempty"`
+	Baseline                    *SQLRegressionWindowStats `json:"baseline,omitempty"`
+	Current                     SQLRegressionWindowStats  `json:"current"`
+	AverageLatencyChangePercent float64                   `json:"average_latency_change_percent"`
+	RowsExaminedChangePercent   float64                   `json:"rows_examined_change_percent"`
+	ExecutionRateChangePercent  float64                   `json:"execution_rate_change_percent"`
+	ExtraLatencyMS              float64                   `json:"extra_latency_ms"`
+	Instances                   []sqldomain.Instance      `json:"instances"`
+	Plan                        *SQLPlanDiff              `json:"plan,omitempty"`
+}
+
+// SQLPlanDiff compares the current plan of a sample statement with the plan
+// captured before the current window. Without such a snapshot the baseline
+// window's own sample is explained now, which only shows parameter-dependent
+// differences.
+type SQLPlanDiff struct {
+	Instance       sqldomain.Instance      `json:"instance"`
+	Database       string                  `json:"database"`
+	SampleSQL      string                  `json:"sample_sql"`
+	Current        *sqldomain.PlanSnapshot `json:"current,omitempty"`
+	Baseline       *sqldomain.PlanSnapshot `json:"baseline,omitempty"`
+	BaselineSource string                  `json:"baseline_source,omitempty"`
+	Changed        bool                    `json:"changed"`
+	Changes        []string                `json:"changes,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+type SQLRegressionResult struct {
+	Mode             string              `json:"mode"`
+	Start            time.Time           `json:"start"`
+	End              time.Time           `json:"end"`
+	BaselineStart    time.Time           `json:"baseline_start"`
+	BaselineEnd      time.Time           `json:"baseline_end"`
+	ThresholdPercent float64             `json:"threshold_percent"`
+	MinExecutions    uint64              `json:"min_executions"`
+	Compared         int                 `json:"compared"`
+	Regressed        int                 `json:"regressed"`
+	New              int                 `json:"new"`
+	Items            []SQLRegressionItem `json:"items"`
+	Truncated        bool                `json:"truncated"`
+	AlertsRaised     int                 `json:"alerts_raised"`
+	Coverage         SQLCoverage         `json:"coverage"`
+}
+
+// SetAlertService enables SQL regression alerts.
+func (s *SQLDiagnosticService) SetAlertService(alerts *AlertService) {
+	s.alerts = alerts
+}
+
+func (s *SQLDiagnosticService) Regressions(ctx context.Context, req SQLRegressionQuery) (SQLRegressionResult, error) {
+	req, err := normalizeSQLRegressionQuery(req, time.Now().UTC())
+	if err != nil {
+		return SQLRegressionResult{}, err
+	}
+	current, err := s.normalizeHistoryQuery(SQLDiagnosticHistoryQuery{
+		Start: req.Start, End: req.End, Cluster: req.Cluster, Machine: req.Machine, Port: req.Port, Database: req.Database,
+	})
+	if err != nil {
+		return SQLRegressionResult{}, fmt.Errorf("%w：当前区间 %v", ErrSQLRegressionInvalid, err)
+	}
+	baseline, err := s.normalizeHistoryQuery(SQLDiagnosticHistoryQuery{
+		Start: req.BaselineStart, End: req.BaselineEnd, Cluster: req.Cluster, Machine: req.Machine, Port: req.Port, Database: req.Database,
+	})
+	if err != nil {
+		return SQLRegressionResult{}, fmt.Errorf("%w：基线区间 %v", ErrSQLRegressionInvalid, err)
+	}
+	baselineWindow, err := s.aggregateTopSQL(ctx, baseline)
+	if err != nil {
+		return SQLRegressionResult{}, err
+	}
+	currentWindow, err := s.aggregateTopSQL(ctx, current)
+	if err != nil {
+		return SQLRegressionResult{}, err
+	}
+	all := compareSQLWindows(baselineWindow.items, baseline.End.Sub(baseline.Start), currentWindow.items, current.End.Sub(current.Start), req)
+	result := SQLRegressionResult{
+		Mode: req.Mode, Start: current.Start, End: current.End, BaselineStart: baseline.Start, BaselineEnd: baseline.End,
+		ThresholdPercent: req.ThresholdPercent, MinExecutions: req.MinExecutions,
+	}
+	var unchanged []SQLRegressionItem
+	for _, item := range all {
+		switch item.Status {
+		case SQLRegressionStatusRegressed:
+			result.Regressed++
+			result.Items = append(result.Items, item)
+		case SQLRegressionStatusNew:
+			result.New++
+			result.Items = append(result.Items, item)
+		default:
+			unchanged = append(unchanged, item)
+		}
+		if item.Baseline != nil {
+			result.Compared++
+		}
+	}
+	if len(result.Items) > req.Limit {
+		result.Items, result.Truncated = result.Items[:req.Limit], true
+	}
+	if req.CapturePlans {
+		s.attachRegressionPlans(ctx, result.Items, baseline, current)
+	}
+	if req.RaiseAlerts {
+		result.AlertsRaised = s.signalRegressions(ctx, req, result.Items, unchanged)
+	}
+	currentCoverage := s.topCoverage(ctx, current, currentWindow)
+	baselineCoverage := s.topCoverage(ctx, baseline, baselineWindow)
+	result.Coverage = currentCoverage
+	result.Coverage.Complete = currentCoverage.Complete && baselineCoverage.Complete
+	for _, warning := range baselineCoverage.Warnings {
+		result.Coverage.Warnings = append(result.Coverage.Warnings, "基线区间："+warning)
+	}
+	return result, nil
+}
+
+func normalizeSQLRegressionQuery(req SQLRegressionQuery, now time.Time) (SQLRegressionQuery, error) {
+	if req.End.IsZero() {
+		req.End = now
+	}
+	if req.Start.IsZero() {
+		req.Start = req.End.Add(-time.Hour)
+	}
+	req.Start, req.End = req.Start.UTC(), req.End.UTC()
+	if !req.Start.Before(req.End) {
+		return req, fmt.Errorf("%w：开始时间必须早于结束时间", ErrSQLRegressionInvalid)
+	}
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	if req.Mode == "" {
+		req.Mode = SQLRegressionModePrevious
+		if !req.BaselineStart.IsZero() || !req.BaselineEnd.IsZero() {
+			req.Mode = SQLRegressionModeCustom
+		}
+	}
+	switch req.Mode {
+	case SQLRegressionModePrevious:
+		req.BaselineStart, req.BaselineEnd = req.Start.Add(-req.End.Sub(req.Start)), req.Start
+	case SQLRegressionModeDayOverDay:
+		req.BaselineStart, req.BaselineEnd = req.Start.Add(-24*time.Hour), req.End.Add(-24*time.Hour)
+	case SQLRegressionModeWeekOverWeek:
+		req.BaselineStart, req.BaselineEnd = req.Start.Add(-7*24*time.Hour), req.End.Add(-7*24*time.Hour)
+	case SQLRegressionModeCustom:
+		if req.BaselineStart.IsZero() || req.BaselineEnd.IsZero() {
+			return req, fmt.Errorf("%w：custom 模式必须指定 baseline_start 和 baseline_end", ErrSQLRegressionInvalid)
+		}
+		req.BaselineStart, req.BaselineEnd = req.BaselineStart.UTC(), req.BaselineEnd.UTC()
+		if !req.BaselineStart.Before(req.BaselineEnd) || req.BaselineEnd.After(req.Start) {
+			return req, fmt.Errorf("%w：基线区间必须早于当前区间且不重叠", ErrSQLRegressionInvalid)
+		}
+	default:
+		return req, fmt.Errorf("%w：mode 只能是 previous、day_over_day、week_over_week 或 custom", ErrSQLRegressionInvalid)
+	}
+	if req.ThresholdPercent == 0 {
+		req.ThresholdPercent = 50
+	}
+	if req.ThresholdPercent < 1 || req.ThresholdPercent > 10000 {
+		return req, fmt.Errorf("%w：threshold_percent 必须在 1–10000 之间", ErrSQLRegressionInvalid)
+	}
+	if req.MinExecutions == 0 {
+		req.MinExecutions = 10
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	if req.Limit > 500 {
+		req.Limit = 500
+	}
+	return req, nil
+}
+
+// compareSQLWindows classifies every digest of the current window. Rates are
+// normalised per hour so windows of different length stay comparable; a
+// percentage change only counts when it also moves by an absolute floor,
+// which keeps sub-millisecond jitter out of the report.
+func compareSQLWindows(baseline []SQLTopItem, baselineSpan time.Duration, current []SQLTopItem, currentSpan time.Duration, req SQLRegressionQuery) []SQLRegressionItem {
+	previous := make(map[string]SQLTopItem, len(baseline))
+	for _, item := range baseline {
+		previous[item.Digest+"\x00"+item.Database] = item
+	}
+	var out []SQLRegressionItem
+	for _, item := range current {
+		if item.ExecutionCount < req.MinExecutions {
+			continue
+		}
+		entry := SQLRegressionItem{
+			Digest: item.Digest, DigestText: item.DigestText, Database: item.Database,
+			Current: regressionStats(item, currentSpan), Instances: item.Instances, Status: SQLRegressionStatusUnchanged,
+		}
+		before, ok := previous[item.Digest+"\x00"+item.Database]
+		if !ok || before.ExecutionCount == 0 {
+			entry.Status = SQLRegressionStatusNew
+			entry.ExtraLatencyMS = entry.Current.TotalLatencyMS
+			out = append(out, entry)
+			continue
+		}
+		stats := regressionStats(before, baselineSpan)
+		entry.Baseline = &stats
+		if before.ExecutionCount < req.MinExecutions {
+			out = append(out, entry)
+			continue
+		}
+		entry.AverageLatencyChangePercent = changePercent(stats.AverageLatencyMS, entry.Current.AverageLatencyMS)
+		entry.RowsExaminedChangePercent = changePercent(stats.RowsExaminedPerCall, entry.Current.RowsExaminedPerCall)
+		entry.ExecutionRateChangePercent = changePercent(stats.ExecutionsPerHour, entry.Current.ExecutionsPerHour)
+		entry.ExtraLatencyMS = (entry.Current.AverageLatencyMS - stats.AverageLatencyMS) * float64(entry.Current.ExecutionCount)
+		if entry.AverageLatencyChangePercent >= req.ThresholdPercent && entry.Current.AverageLatencyMS-stats.AverageLatencyMS >= sqlRegressionMinLatencyDelta {
+			entry.Reasons = append(entry.Reasons, "average_latency")
+		}
+		if entry.RowsExaminedChangePercent >= req.ThresholdPercent && entry.Current.RowsExaminedPerCall-stats.RowsExaminedPerCall >= sqlRegressionMinRowsDelta {
+			entry.Reasons = append(entry.Reasons, "rows_examined_per_call")
+		}
+		if entry.ExecutionRateChangePercent >= req.ThresholdPercent {
+			entry.Reasons = append(entry.Reasons, "executions")
+		}
+		if len(entry.Reasons) > 0 {
+			entry.Status = SQLRegressionStatusRegressed
+		}
+		out = append(out, entry)
+	}
+	rank := map[string]int{SQLRegressionStatusRegressed: 0, SQLRegressionStatusNew: 1, SQLRegressionStatusUnchanged: 2}
+	sort.SliceStable(out, func(i, j int) bool {
+		if rank[out[i].Status] != rank[out[j].Status] {
+			return rank[out[i].Status] < rank[out[j].Status]
+		}
+		if out[i].ExtraLatencyMS != out[j].ExtraLatencyMS {
+			return out[i].ExtraLatencyMS > out[j].ExtraLatencyMS
+		}
+		return out[i].Digest < out[j].Digest
+	})
+	return out
+}
+
+func regressionStats(item SQLTopItem, span time.Duration) SQLRegressionWindowStats {
+	stats := SQLRegressionWindowStats{ExecutionCount: item.ExecutionCount, TotalLatencyMS: item.TotalLatencyMS, AverageLatencyMS: item.AverageLatencyMS}
+	if item.ExecutionCount > 0 {
+		stats.RowsExaminedPerCall = float64(item.RowsExamined) / float64(item.ExecutionCount)
+	}
+	if hours := span.Hours(); hours > 0 {
+		stats.ExecutionsPerHour = float64(item.ExecutionCount) / hours
+	}
+	return stats
+}
+
+func changePercent(before, after float64) float64 {
+	if before <= 0 {
+		if after > 0 {
+			return 100
+		}
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+func (s *SQLDiagnosticService) attachRegressionPlans(ctx context.Context, items []SQLRegressionItem, baseline, current SQLDiagnosticHistoryQuery) {
+	if s.explainer == nil {
+		return
+	}
+	_, credential, err := s.credentials(ctx)
+	cfg := s.Config()
+	captured := 0
+	for index := range items {
+		if captured >= sqlRegressionMaxPlans {
+			return
+		}
+		captured++
+		diff := &SQLPlanDiff{Database: items[index].Database}
+		items[index].Plan = diff
+		switch {
+		case err != nil:
+			diff.Error = err.Error()
+			continue
+		case !cfg.CaptureSQLText || cfg.RedactLiterals:
+			diff.Error = "未保存 SQL 原文或已开启字面量遮蔽，样本 SQL 无法 EXPLAIN"
+			continue
+		}
+		sample, ok := s.regressionSample(ctx, current, items[index])
+		if !ok {
+			diff.Error = "当前区间没有该 Digest 的已完成 SQL 样本"
+			continue
+		}
+		diff.Instance, diff.Database, diff.SampleSQL = sample.Instance, sample.Database, sample.SQLText
+		snapshot, explainErr := s.explainSnapshot(ctx, sample, credential)
+		if explainErr != nil {
+			diff.Error = explainErr.Error()
+			continue
+		}
+		_ = s.repo.SavePlanSnapshot(ctx, snapshot)
+		diff.Current = &snapshot
+		if previous, found, _ := s.repo.LatestPlanSnapshot(ctx, sample.Instance, sample.Digest, sample.Database, current.Start); found {
+			diff.Baseline, diff.BaselineSource = &previous, "snapshot"
+		} else if baselineSample, ok := s.regressionSample(ctx, baseline, items[index]); ok {
+			if plan, err := s.explainSnapshot(ctx, baselineSample, credential); err == nil {
+				diff.Baseline, diff.BaselineSource = &plan, "baseline_sample"
+			}
+		}
+		if diff.Baseline != nil {
+			diff.Changed = diff.Baseline.Signature != snapshot.Signature
+			diff.Changes = mysqlapp.DiffPlanSteps(diff.Baseline.Steps, snapshot.Steps)
+		}
+	}
+}
+
+// regressionSample picks the slowest completed statement of the digest in the
+// window as the EXPLAIN sample.
+func (s *SQLDiagnosticService) regressionSample(ctx context.Context, query SQLDiagnosticHistoryQuery, item SQLRegressionItem) (sqldomain.StatementEvent, bool) {
+	eventQuery := statementEventQuery(query, 0)
+	eventQuery.Database, eventQuery.Digest, eventQuery.Limit = item.Database, item.Digest, 200
+	events, err := s.repo.ListStatementEvents(ctx, eventQuery)
+	if err != nil {
+		return sqldomain.StatementEvent{}, false
+	}
+	var best sqldomain.StatementEvent
+	found := false
+	for _, event := range events {
+		if strings.TrimSpace(event.SQLText) == "" || !matchesInstance(event.Instance, query.Cluster, query.Machine, query.Port) {
+			continue
+		}
+		if !found || event.DurationMS > best.DurationMS {
+			best, found = event, true
+		}
+	}
+	return best, found
+}
+
+func (s *SQLDiagnosticService) explainSnapshot(ctx context.Context, sample sqldomain.StatementEvent, credential mysqlapp.DiagnosticCredential) (sqldomain.PlanSnapshot, error) {
+	plan, err := s.explainer.Explain(ctx, sample.Instance, credential, sample.Database, sample.SQLText)
+	if err != nil {
+		return sqldomain.PlanSnapshot{}, err
+	}
+	steps := mysqlapp.PlanSteps(plan)
+	return sqldomain.PlanSnapshot{
+		ID: stableID(sample.Instance.Key(), sample.Digest, fmt.Sprint(plan.GeneratedAt.UnixNano())), Instance: sample.Instance,
+		Digest: sample.Digest, Database: sample.Database, SQLText: sample.SQLText, Steps: steps,
+		Signature: mysqlapp.PlanSignature(steps), CapturedAt: plan.GeneratedAt,
+	}, nil
+}
+
+// signalRegressions raises one alert per regressed digest and resolves the
+// alerts of digests that were compared again and are back to normal.
+func (s *SQLDiagnosticService) signalRegressions(ctx context.Context, req SQLRegressionQuery, items, unchanged []SQLRegressionItem) int {
+	if s.alerts == nil {
+		return 0
+	}
+	signal := func(item SQLRegressionItem) AlertSignal {
+		result := AlertSignal{
+			RuleID: sqlRegressionRuleID, RuleName: "SQL 性能回退", Metric: "sql_regression_percent", Category: "sql_diagnostic",
+			ClusterID: req.Cluster, Threshold: req.ThresholdPercent, Operator: ">=",
+			Labels: map[string]string{"digest": item.Digest, "database": item.Database, "cluster": req.Cluster},
+		}
+		if len(item.Instances) > 0 {
+			result.MachineName, result.MachineIP = item.Instances[0].MachineName, item.Instances[0].MachineIP
+		}
+		return result
+	}
+	raised := 0
+	for _, item := range items {
+		if item.Status != SQLRegressionStatusRegressed {
+			continue
+		}
+		current := signal(item)
+		current.Severity = alertdomain.SeverityWarning
+		current.Value = worstRegressionPercent(item)
+		current.Message = fmt.Sprintf("Digest %s 平均耗时 %.1fms → %.1fms，单次扫描行数 %.0f → %.0f，回退指标：%s",
+			shortDigest(item.Digest), item.Baseline.AverageLatencyMS, item.Current.AverageLatencyMS,
+			item.Baseline.RowsExaminedPerCall, item.Current.RowsExaminedPerCall, strings.Join(item.Reasons, ", "))
+		if item.Plan != nil && item.Plan.Changed {
+			current.Message += "；执行计划已变化"
+		}
+		if err := s.alerts.RaiseSignal(ctx, current); err == nil {
+			raised++
+		}
+	}
+	for _, item := range unchanged {
+		if item.Baseline != nil {
+			_ = s.alerts.ResolveSignal(ctx, signal(item))
+		}
+	}
+	return raised
+}
+
+// worstRegressionPercent is the largest change among the metrics that caused
+// the regression.
+func worstRegressionPercent(item SQLRegressionItem) float64 {
+	worst := 0.0
+	for _, reason := range item.Reasons {
+		value := item.ExecutionRateChangePercent
+		switch reason {
+		case "average_latency":
+			value = item.AverageLatencyChangePercent
+		case "rows_examined_per_call":
+			value = item.RowsExaminedChangePercent
+		}
+		if value > worst {
+			worst = value
+		}
+	}
+	return worst
+}
+
+func shortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
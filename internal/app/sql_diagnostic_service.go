@@ -36,6 +36,17 @@ type SQLDiagnosticRepository interface {
 	ListDigestSnapshots(ctx context.Context, baselineStart, end time.Time) ([]sqldomain.DigestSnapshot, error)
 	SaveKillAudit(ctx context.Context, item sqldomain.KillAudit) error
 	ListKillAudits(ctx context.Context, start, end time.Time) ([]sqldomain.KillAudit, error)
+	SaveLockWaits(ctx context.Context, items []sqldomain.LockWait) error
+	ListLockWaits(ctx context.Context, start, end time.Time) ([]sqldomain.LockWait, error)
+	SaveDeadlockReport(ctx context.Context, item sqldomain.DeadlockReport) (bool, error)
+	ListDeadlockReports(ctx context.Context, start, end time.Time) ([]sqldomain.DeadlockReport, error)
+	ListKillPolicies(ctx context.Context) ([]sqldomain.KillPolicy, error)
+	SaveKillPolicy(ctx context.Context, item sqldomain.KillPolicy) error
+	DeleteKillPolicy(ctx context.Context, id string) (bool, error)
+	SavePlanSnapshot(ctx context.Context, item sqldomain.PlanSnapshot) error
+	LatestPlanSnapshot(ctx context.Context, instance sqldomain.Instance, digest, database string, before time.Time) (sqldomain.PlanSnapshot, bool, error)
+	GetSlowLogCursor(ctx context.Context, machineID string, port int) (sqldomain.SlowLogCursor, bool, error)
+	SaveSlowLogCursor(ctx context.Context, item sqldomain.SlowLogCursor) error
 	PurgeBefore(ctx context.Context, cutoff time.Time) (int64, error)
 }
 
@@ -46,6 +57,7 @@ type SQLDiagnosticService struct {
 	presets   MySQLAccountPresetRepository
 	client    mysqlapp.DiagnosticClient
 	explainer mysqlapp.ExecutionPlanExplainer
+	alerts    *AlertService
 
 	configMu       sync.RWMutex
 	config         sqldomain.Config
@@ -53,6 +65,9 @@ type SQLDiagnosticService struct {
 	stateMu        sync.Mutex
 	digests        map[string]digestCounter
 	slowLogCursors map[string]time.Time
+	killerHits     map[string][]time.Time
+	killerSeen     map[string]string
+	slowLogMu      sync.Mutex
 	cancel         context.CancelFunc
 	wg             sync.WaitGroup
 }
@@ -298,7 +313,8 @@ func (s *SQLDiagnosticService) collectionLoop(ctx context.Context) {
 	for {
 		cfg := s.Config()
 		if cfg.Enabled {
-			_, _ = s.collectAll(ctx, false)
+			result, _ := s.collectAll(ctx, false)
+			s.enforceKillPolicies(ctx, result.Items)
 			if time.Since(lastPurge) >= time.Hour {
 				_, _ = s.repo.PurgeBefore(ctx, time.Now().UTC().Add(-time.Duration(cfg.RetentionHours)*time.Hour))
 				lastPurge = time.Now()
@@ -474,6 +490,7 @@ func (s *SQLDiagnosticService) collectInstance(ctx context.Context, instance sql
 				degraded = append(degraded, "save digest summary: "+err.Error())
 			}
 		}
+		degraded = append(degraded, s.collectLocks(ctx, db, instance, caps, cfg)...)
 	}
 	status.LastSuccessAt = observedAt
 	if len(degraded) > 0 {
@@ -590,10 +607,49 @@ func (s *SQLDiagnosticService) TopSQL(ctx context.Context, query SQLDiagnosticHi
 	if err != nil {
 		return SQLTopResult{}, err
 	}
+	window, err := s.aggregateTopSQL(ctx, query)
+	if err != nil {
+		return SQLTopResult{}, err
+	}
+	items := window.items
+	orderBy = normalizeTopOrder(orderBy)
+	sortDirection := normalizeSortDirection(query.SortDirection)
+	sort.SliceStable(items, func(i, j int) bool {
+		left, right := topValue(items[i], orderBy), topValue(items[j], orderBy)
+		if left == right {
+			return items[i].Digest < items[j].Digest
+		}
+		if sortDirection == "asc" {
+			return left < right
+		}
+		return left > right
+	})
+	if len(items) > query.Limit {
+		items = items[:query.Limit]
+	}
+	for index := range items {
+		items[index].Rank = index + 1
+	}
+	coverage := s.topCoverage(ctx, query, window)
+	return SQLTopResult{
+		Start: query.Start, End: query.End, OrderBy: orderBy, SortDirection: sortDirection, Items: items, Coverage: coverage,
+		CounterSemantics: "performance_schema cumulative counters converted to adjacent-snapshot deltas; reset-safe",
+		MaxLatencySource: "events_statements_history_long completed events observed in the selected window",
+	}, nil
+}
+
+// topSQLWindow is the per digest and schema aggregation of one time window.
+type topSQLWindow struct {
+	items            []SQLTopItem
+	missingBaselines int
+	eventSamples     int
+}
+
+func (s *SQLDiagnosticService) aggregateTopSQL(ctx context.Context, query SQLDiagnosticHistoryQuery) (topSQLWindow, error) {
 	baselineStart := query.Start.Add(-time.Duration(s.Config().RetentionHours) * time.Hour)
 	snapshots, err := s.repo.ListDigestSnapshots(ctx, baselineStart, query.End)
 	if err != nil {
-		return SQLTopResult{}, err
+		return topSQLWindow{}, err
 	}
 	type topAggregate struct {
 		item      SQLTopItem
@@ -677,24 +733,10 @@ func (s *SQLDiagnosticService) TopSQL(ctx context.Context, query SQLDiagnosticHi
 		sort.Slice(aggregate.item.Instances, func(i, j int) bool { return aggregate.item.Instances[i].Key() < aggregate.item.Instances[j].Key() })
 		items = append(items, aggregate.item)
 	}
-	orderBy = normalizeTopOrder(orderBy)
-	sortDirection := normalizeSortDirection(query.SortDirection)
-	sort.SliceStable(items, func(i, j int) bool {
-		left, right := topValue(items[i], orderBy), topValue(items[j], orderBy)
-		if left == right {
-			return items[i].Digest < items[j].Digest
-		}
-		if sortDirection == "asc" {
-			return left < right
-		}
-		return left > right
-	})
-	if len(items) > query.Limit {
-		items = items[:query.Limit]
-	}
-	for index := range items {
-		items[index].Rank = index + 1
-	}
+	return topSQLWindow{items: items, missingBaselines: missingBaselines, eventSamples: len(events)}, nil
+}
+
+func (s *SQLDiagnosticService) topCoverage(ctx context.Context, query SQLDiagnosticHistoryQuery, window topSQLWindow) SQLCoverage {
 	coverage, _ := s.coverage(ctx, query.Start, query.End, query.Cluster, query.Machine, query.Port)
 	for _, status := range coverage.Statuses {
 		if !status.DigestConsumerEnabled {
@@ -702,19 +744,15 @@ func (s *SQLDiagnosticService) TopSQL(ctx context.Context, query SQLDiagnosticHi
 			coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%s:%d 未启用 performance_schema statements_digest，无法获得 TOP-SQL 计数", status.Instance.MachineIP, status.Instance.Port))
 		}
 	}
-	if missingBaselines > 0 {
+	if window.missingBaselines > 0 {
 		coverage.Complete = false
-		coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%d 个 Digest 序列缺少区间前基线，已排除以避免把生命周期累计值误算到当前区间", missingBaselines))
+		coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%d 个 Digest 序列缺少区间前基线，已排除以避免把生命周期累计值误算到当前区间", window.missingBaselines))
 	}
-	if len(events) == 100000 {
+	if window.eventSamples == 100000 {
 		coverage.Complete = false
 		coverage.Warnings = append(coverage.Warnings, "区间最大耗时样本达到 100000 行安全上限；总耗时仍使用完整的 Digest 计数器增量")
 	}
-	return SQLTopResult{
-		Start: query.Start, End: query.End, OrderBy: orderBy, SortDirection: sortDirection, Items: items, Coverage: coverage,
-		CounterSemantics: "performance_schema cumulative counters converted to adjacent-snapshot deltas; reset-safe",
-		MaxLatencySource: "events_statements_history_long completed events observed in the selected window",
-	}, nil
+	return coverage
 }
 
 func (s *SQLDiagnosticService) SlowSQL(ctx context.Context, query SQLDiagnosticHistoryQuery, thresholdMS int64) (SQLSlowResult, error) {
@@ -759,9 +797,13 @@ func (s *SQLDiagnosticService) SlowSQL(ctx context.Context, query SQLDiagnosticH
 	}
 	coverage, _ := s.coverage(ctx, query.Start, query.End, query.Cluster, query.Machine, query.Port)
 	for _, status := range coverage.Statuses {
+		slowLogFile := false
 		if !status.HistoryLongConsumerEnabled && !status.SlowLogTableAvailable {
+			_, slowLogFile, _ = s.repo.GetSlowLogCursor(ctx, status.Instance.MachineID, status.Instance.Port)
+		}
+		if !status.HistoryLongConsumerEnabled && !status.SlowLogTableAvailable && !slowLogFile {
 			coverage.Complete = false
-			coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%s:%d 既无语句历史消费者也无 TABLE 慢日志，可能漏掉已完成的慢 SQL", status.Instance.MachineIP, status.Instance.Port))
+			coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%s:%d 既无语句历史消费者也无 TABLE 或 Agent 文件慢日志，可能漏掉已完成的慢 SQL", status.Instance.MachineIP, status.Instance.Port))
 		} else if !status.HistoryLongConsumerEnabled && status.SlowLogThresholdMS > thresholdMS {
 			coverage.Complete = false
 			coverage.Warnings = append(coverage.Warnings, fmt.Sprintf("%s:%d 慢日志阈值为 %d 毫秒，高于本次查询的 %d 毫秒", status.Instance.MachineIP, status.Instance.Port, status.SlowLogThresholdMS, thresholdMS))
@@ -830,12 +872,20 @@ func (s *SQLDiagnosticService) KillQuery(ctx context.Context, req KillSQLRequest
 		ExpectedDigest: req.ExpectedDigest, ExpectedStartedAt: req.ExpectedStartedAt,
 		SQLText: target.SQLText, User: target.User, ClientHost: target.ClientHost,
 		Reason: strings.TrimSpace(req.Reason), RequestSource: req.RequestSource,
-		Status: "requested", RequestedAt: time.Now().UTC(),
+		Scope: sqldomain.KillScopeQuery, Status: "requested", RequestedAt: time.Now().UTC(),
 	}
+	return s.auditedKill(ctx, audit, func(ctx context.Context) error {
+		return s.client.KillQuery(ctx, db, req.ProcessID)
+	})
+}
+
+// auditedKill records the request before issuing the kill and the outcome
+// after it, so a kill never happens without an audit row.
+func (s *SQLDiagnosticService) auditedKill(ctx context.Context, audit sqldomain.KillAudit, kill func(context.Context) error) (KillSQLResult, error) {
 	if err := s.repo.SaveKillAudit(ctx, audit); err != nil {
 		return KillSQLResult{}, err
 	}
-	err = s.client.KillQuery(ctx, db, req.ProcessID)
+	err := kill(ctx)
 	completed := time.Now().UTC()
 	audit.CompletedAt = &completed
 	if err != nil {
@@ -2,9 +2,16 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"gmha/internal/agent/slowlog"
 	machinedomain "gmha/internal/domain/machine"
 	sqldomain "gmha/internal/domain/sqldiagnostic"
 	mysqlapp "gmha/internal/mysql"
@@ -179,3 +186,362 @@ func TestSessionHasCompletedEventUsesDigestInstanceAndStart(t *testing.T) {
 		t.Fatal("different digest must not be de-duplicated")
 	}
 }
+
+func TestBuildBlockingTreesPutsRootBlockerFirst(t *testing.T) {
+	instance := sqldomain.Instance{MachineID: "machine-1", Port: 3306}
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	edge := func(waiter, blocker uint64, kind string, waitMS int64) sqldomain.LockWait {
+		return sqldomain.LockWait{Instance: instance, CollectedAt: now, Kind: kind, WaitingProcessID: waiter, BlockingProcessID: blocker,
+			WaitMS: waitMS, ObjectSchema: "shop", ObjectName: "orders"}
+	}
+	idle := edge(11, 10, sqldomain.LockKindMetadata, 9000)
+	idle.BlockingCommand, idle.BlockingUser = "Sleep", "app"
+	waits := []sqldomain.LockWait{
+		edge(12, 11, sqldomain.LockKindMetadata, 4000),
+		edge(13, 11, sqldomain.LockKindMetadata, 6000),
+		idle,
+		edge(21, 20, sqldomain.LockKindRow, 500),
+		edge(30, 31, sqldomain.LockKindRow, 100),
+		edge(31, 30, sqldomain.LockKindRow, 200),
+	}
+	trees := buildBlockingTrees(waits)
+	if len(trees) != 3 {
+		t.Fatalf("expected three trees, got %+v", trees)
+	}
+	root := trees[0]
+	if root.Root.ProcessID != 10 || root.Root.Command != "Sleep" || root.BlockedSessions != 3 || root.MaxWaitMS != 9000 || root.Cycle {
+		t.Fatalf("idle transaction must be the root blocker: %+v", root)
+	}
+	alter := root.Root.Blocked[0]
+	if alter.ProcessID != 11 || len(alter.Blocked) != 2 || alter.Blocked[0].ProcessID != 13 || alter.Object != "shop.orders" {
+		t.Fatalf("queued sessions must hang below the pending ALTER ordered by wait: %+v", alter)
+	}
+	if trees[1].Root.ProcessID != 20 || trees[1].Cycle || !trees[2].Cycle || trees[2].BlockedSessions != 1 {
+		t.Fatalf("unexpected trailing trees: %+v", trees[1:])
+	}
+}
+
+func TestKillPolicyMatchingAndBudget(t *testing.T) {
+	normalized, err := normalizeKillPolicy(sqldomain.KillPolicy{
+		Name: "report timeout", Users: []string{" report_ro ", "report_ro"}, Hosts: []string{"10.0.%"},
+		Digests: []string{"ABC"}, InstanceRole: "Primary", MinElapsedSeconds: 60, MaxKillsPerMinute: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normalized.Target != sqldomain.KillTargetQuery || len(normalized.Users) != 1 || normalized.Digests[0] != "abc" {
+		t.Fatalf("unexpected normalized policy: %+v", normalized)
+	}
+	policy, err := compileKillPolicy(normalized)
+	if err != nil || len(policy.users) != 1 || len(policy.hosts) != 1 {
+		t.Fatalf("compileKillPolicy() = %+v, %v", policy, err)
+	}
+	session := sqldomain.Session{ProcessID: 7, User: "REPORT_RO", ClientHost: "10.0.3.4:52110", Command: "Query", Digest: "abc", ElapsedMS: 61000}
+	if !matchKillPolicy(policy, sqldomain.InstanceRolePrimary, session, nil) || !matchKillPolicy(policy, "", session, nil) {
+		t.Fatal("session should match the policy on the primary")
+	}
+	if matchKillPolicy(policy, sqldomain.InstanceRoleReplica, session, nil) {
+		t.Fatal("instance role must be honoured")
+	}
+	short := session
+	short.ElapsedMS = 59000
+	exempt := map[string]bool{"report_ro": true}
+	dump := session
+	dump.Command = "Binlog Dump GTID"
+	system := session
+	system.User = "system user"
+	for _, candidate := range []sqldomain.Session{short, dump, system} {
+		if matchKillPolicy(policy, sqldomain.InstanceRolePrimary, candidate, nil) {
+			t.Fatalf("session must not match: %+v", candidate)
+		}
+	}
+	if matchKillPolicy(policy, sqldomain.InstanceRolePrimary, session, exempt) {
+		t.Fatal("GMHA credential users must be exempt")
+	}
+	lock, err := compileLikePattern("%metadata lock%")
+	if err != nil || !lock.MatchString("Waiting for table metadata lock") {
+		t.Fatalf("LIKE matching is wrong: %v", err)
+	}
+	if exact, _ := compileLikePattern("report_"); exact.MatchString("report_ro") || !exact.MatchString("REPORT1") {
+		t.Fatal("_ must match exactly one character")
+	}
+	if _, err := normalizeKillPolicy(sqldomain.KillPolicy{Name: "no threshold"}); err == nil {
+		t.Fatal("min_elapsed_seconds is required")
+	}
+
+	service := &SQLDiagnosticService{}
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	if !service.claimKillerMatch("p|a|1", "a", normalized, now) || service.claimKillerMatch("p|a|1", "a", normalized, now) {
+		t.Fatal("a continuous match must be handled once")
+	}
+	if !service.claimKillerMatch("p|a|2", "a", normalized, now) || service.claimKillerMatch("p|a|3", "a", normalized, now) {
+		t.Fatal("the per-minute budget must stop the third kill")
+	}
+	if !service.claimKillerMatch("p|a|3", "a", normalized, now.Add(61*time.Second)) {
+		t.Fatal("a refused match must be retried once the budget frees up")
+	}
+	service.forgetKillerMatches("a", map[string]bool{"p|a|3": true})
+	if service.claimKillerMatch("p|a|3", "a", normalized, now.Add(2*time.Minute)) || !service.claimKillerMatch("p|a|1", "a", normalized, now.Add(2*time.Minute)) {
+		t.Fatal("only matches that disappeared are forgotten")
+	}
+}
+
+func TestCompareSQLWindowsFlagsRegressionsAndNewDigests(t *testing.T) {
+	req, err := normalizeSQLRegressionQuery(SQLRegressionQuery{
+		Mode:  SQLRegressionModeWeekOverWeek,
+		Start: time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC), End: time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC),
+	}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.BaselineEnd.Equal(req.End.Add(-7*24*time.Hour)) || req.ThresholdPercent != 50 || req.MinExecutions != 10 {
+		t.Fatalf("unexpected normalized query: %+v", req)
+	}
+	baseline := []SQLTopItem{
+		{Digest: "slow", Database: "app", ExecutionCount: 100, AverageLatencyMS: 10, TotalLatencyMS: 1000, RowsExamined: 1000},
+		{Digest: "scan", Database: "app", ExecutionCount: 100, AverageLatencyMS: 1, TotalLatencyMS: 100, RowsExamined: 100},
+		{Digest: "jitter", Database: "app", ExecutionCount: 100, AverageLatencyMS: 0.1, TotalLatencyMS: 10},
+		{Digest: "slow", Database: "other", ExecutionCount: 100, AverageLatencyMS: 10, TotalLatencyMS: 1000},
+	}
+	current := []SQLTopItem{
+		{Digest: "slow", Database: "app", ExecutionCount: 100, AverageLatencyMS: 30, TotalLatencyMS: 3000, RowsExamined: 1000},
+		{Digest: "scan", Database: "app", ExecutionCount: 100, AverageLatencyMS: 1.2, TotalLatencyMS: 120, RowsExamined: 50000},
+		{Digest: "jitter", Database: "app", ExecutionCount: 100, AverageLatencyMS: 0.5, TotalLatencyMS: 50},
+		{Digest: "slow", Database: "other", ExecutionCount: 100, AverageLatencyMS: 10, TotalLatencyMS: 1000},
+		{Digest: "fresh", Database: "app", ExecutionCount: 20, AverageLatencyMS: 5, TotalLatencyMS: 100},
+		{Digest: "rare", Database: "app", ExecutionCount: 3, AverageLatencyMS: 500, TotalLatencyMS: 1500},
+	}
+	items := compareSQLWindows(baseline, time.Hour, current, time.Hour, req)
+	if len(items) != 5 {
+		t.Fatalf("digests below min_executions must be skipped: %+v", items)
+	}
+	if items[0].Digest != "slow" || items[0].Database != "app" || items[0].Status != SQLRegressionStatusRegressed ||
+		items[0].AverageLatencyChangePercent != 200 || items[0].ExtraLatencyMS != 2000 || items[0].Reasons[0] != "average_latency" {
+		t.Fatalf("latency regression must rank first: %+v", items[0])
+	}
+	if items[1].Digest != "scan" || items[1].Status != SQLRegressionStatusRegressed || len(items[1].Reasons) != 1 || items[1].Reasons[0] != "rows_examined_per_call" {
+		t.Fatalf("rows examined regression was not detected: %+v", items[1])
+	}
+	if items[2].Digest != "fresh" || items[2].Status != SQLRegressionStatusNew || items[2].Baseline != nil {
+		t.Fatalf("new digest was not detected: %+v", items[2])
+	}
+	for _, item := range items[3:] {
+		if item.Status != SQLRegressionStatusUnchanged {
+			t.Fatalf("sub-millisecond jitter and other databases must not regress: %+v", item)
+		}
+	}
+	if worstRegressionPercent(items[1]) != items[1].RowsExaminedChangePercent {
+		t.Fatalf("alert value must follow the triggering metric: %+v", items[1])
+	}
+	if _, err := normalizeSQLRegressionQuery(SQLRegressionQuery{Mode: "custom", Start: req.Start, End: req.End}, time.Now()); err == nil {
+		t.Fatal("custom mode requires a baseline window")
+	}
+}
+
+func TestIndexAdviceSelectsHeavyDigestsAndPrefillsTask(t *testing.T) {
+	req := normalizeSQLIndexAdviceQuery(SQLIndexAdviceQuery{})
+	items := []SQLTopItem{
+		{Digest: "scan", DigestText: "SELECT * FROM `orders` WHERE `tenant_id` = ?", ExecutionCount: 100, TotalLatencyMS: 900, RowsExamined: 5000000, RowsSent: 100},
+		{Digest: "noindex", DigestText: "SELECT * FROM `tiny` WHERE `k` = ?", ExecutionCount: 50, TotalLatencyMS: 1000, RowsExamined: 500, RowsSent: 50},
+		{Digest: "point", DigestText: "SELECT * FROM `orders` WHERE `id` = ?", ExecutionCount: 1000, TotalLatencyMS: 5000, RowsExamined: 1000, RowsSent: 1000},
+		{Digest: "rare", DigestText: "SELECT * FROM `orders`", ExecutionCount: 2, TotalLatencyMS: 9000, RowsExamined: 9000000, RowsSent: 2},
+	}
+	heavy := heavyIndexDigests(items, map[string]int{"noindex\x00": 3}, req)
+	if len(heavy) != 2 || heavy[0].item.Digest != "noindex" || heavy[1].item.Digest != "scan" || heavy[1].evidence.RowsExaminedPerCall != 50000 {
+		t.Fatalf("unexpected heavy digests: %+v", heavy)
+	}
+
+	stats := mysqlapp.TableIndexStats{
+		Schema: "app", Table: "orders", Rows: 2000000, DataLength: 6 << 30,
+		Indexes: []mysqlapp.ExistingIndex{{Name: "idx_tenant_id"}},
+	}
+	instance := sqldomain.Instance{MachineID: "machine-1", Port: 3306}
+	columns := []mysqlapp.IndexColumn{{Name: "tenant_id"}}
+	draft := indexTaskDraft(stats, instance, columns)
+	if draft.Name != "idx_tenant_id_2" || draft.Machine != "machine-1" || draft.Action != "create" || !draft.OnlineWithPT || draft.LockAcknowledged {
+		t.Fatalf("unexpected draft: %+v", draft)
+	}
+	suggestion := SQLIndexSuggestion{
+		Columns: columns, TableRows: stats.Rows, TableDataBytes: stats.DataLength, EstimatedSizeBytes: 40 << 20,
+		RedundantIndexes: []string{"idx_old"}, Evidence: []SQLIndexEvidence{heavy[1].evidence},
+	}
+	purpose, impact := indexTaskJustification(suggestion, SQLDiagnosticHistoryQuery{Start: time.Unix(0, 0), End: time.Unix(3600, 0)})
+	if !strings.Contains(purpose, "平均每次扫描 50000 行") || !strings.Contains(impact, "40.0 MiB") || !strings.Contains(impact, "idx_old") || len(purpose) > 500 {
+		t.Fatalf("unexpected justification: %q %q", purpose, impact)
+	}
+	if got := truncateUTF8("索引建议", 7); got != "索引" {
+		t.Fatalf("truncation must keep valid UTF-8, got %q", got)
+	}
+}
+
+type slowLogIngestRepo struct {
+	SQLDiagnosticRepository
+	cursors map[string]sqldomain.SlowLogCursor
+	events  map[string]sqldomain.StatementEvent
+}
+
+func (r *slowLogIngestRepo) GetSlowLogCursor(_ context.Context, machineID string, port int) (sqldomain.SlowLogCursor, bool, error) {
+	item, ok := r.cursors[fmt.Sprintf("%s:%d", machineID, port)]
+	return item, ok, nil
+}
+func (r *slowLogIngestRepo) SaveSlowLogCursor(_ context.Context, item sqldomain.SlowLogCursor) error {
+	r.cursors[fmt.Sprintf("%s:%d", item.MachineID, item.Port)] = item
+	return nil
+}
+func (r *slowLogIngestRepo) SaveStatementEvents(_ context.Context, events []sqldomain.StatementEvent) error {
+	for _, event := range events {
+		r.events[event.ID] = event
+	}
+	return nil
+}
+
+func TestIngestSlowLogFollowsCursorWithoutDoubleCounting(t *testing.T) {
+	repo := &slowLogIngestRepo{cursors: map[string]sqldomain.SlowLogCursor{}, events: map[string]sqldomain.StatementEvent{}}
+	service := &SQLDiagnosticService{
+		repo:      repo,
+		instances: &diagnosticInstanceRepo{items: []mysqlapp.Instance{{MachineID: "machine-1", Port: 3306, Version: "5.7.44"}}},
+		machines: &diagnosticMachineRepo{items: map[string]machinedomain.Machine{
+			"machine-1": {ID: "machine-1", Name: "db-1", IP: "10.0.0.1", Cluster: "orders"},
+		}},
+		config: sqldomain.DefaultConfig(),
+	}
+	ctx := context.Background()
+	batch := func(file string, start, end int64, offsets ...uint64) sqldomain.SlowLogBatch {
+		item := sqldomain.SlowLogBatch{MachineID: "machine-1", Port: 3306, FileID: file, Path: "/data/mysql/slow.log", StartOffset: start, EndOffset: end}
+		for _, offset := range offsets {
+			item.Events = append(item.Events, sqldomain.StatementEvent{EventID: offset, SQLText: fmt.Sprintf("SELECT * FROM t WHERE id = %d", offset), DurationMS: 1200})
+		}
+		return item
+	}
+
+	result, err := service.IngestSlowLog(ctx, batch("1:10", 500, 900, 500, 700))
+	if err != nil || result.Accepted != 2 || result.Cursor.Offset != 900 {
+		t.Fatalf("first batch should be accepted at any offset: %+v %v", result, err)
+	}
+	if result, err = service.IngestSlowLog(ctx, batch("1:10", 500, 900, 500, 700)); err != nil || !result.Duplicate {
+		t.Fatalf("a resent batch is a duplicate: %+v %v", result, err)
+	}
+	if result, err = service.IngestSlowLog(ctx, batch("1:10", 1000, 1200, 1000)); !errors.Is(err, ErrSlowLogCursorConflict) || result.Cursor.Offset != 900 {
+		t.Fatalf("a gap must conflict and report the cursor: %+v %v", result, err)
+	}
+	if _, err = service.IngestSlowLog(ctx, batch("1:11", 100, 200, 100)); !errors.Is(err, ErrSlowLogCursorConflict) {
+		t.Fatalf("a new file must start at 0: %v", err)
+	}
+	if result, err = service.IngestSlowLog(ctx, batch("1:11", 0, 300, 0)); err != nil || result.Cursor.FileID != "1:11" || result.Cursor.Offset != 300 {
+		t.Fatalf("a rotated file starts at 0: %+v %v", result, err)
+	}
+	if _, err = service.IngestSlowLog(ctx, batch("1:11", 300, 400, 450)); !errors.Is(err, ErrSlowLogBatchInvalid) {
+		t.Fatalf("events outside the batch range are rejected: %v", err)
+	}
+	if len(repo.events) != 3 {
+		t.Fatalf("expected three stored events, got %d", len(repo.events))
+	}
+	for _, event := range repo.events {
+		if event.Instance.MachineIP != "10.0.0.1" || event.Digest == "" || event.EventName != mysqlapp.SlowLogFileEventName {
+			t.Fatalf("event was not prepared for storage: %+v", event)
+		}
+	}
+}
+
+func TestIngestSlowLogKeepsContentRewrittenAfterCopytruncate(t *testing.T) {
+	repo := &slowLogIngestRepo{cursors: map[string]sqldomain.SlowLogCursor{}, events: map[string]sqldomain.StatementEvent{}}
+	service := &SQLDiagnosticService{
+		repo:      repo,
+		instances: &diagnosticInstanceRepo{items: []mysqlapp.Instance{{MachineID: "machine-1", Port: 3306, Version: "8.0.36"}}},
+		machines:  &diagnosticMachineRepo{items: map[string]machinedomain.Machine{"machine-1": {ID: "machine-1", IP: "10.0.0.1"}}},
+		config:    sqldomain.DefaultConfig(),
+	}
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "slow.log")
+	entry := func(id int, sql string) string {
+		return fmt.Sprintf("# Time: 2026-07-23T01:00:0%d.000000Z\n# User@Host: app[app] @  [10.0.0.8]  Id: %d\n"+
+			"# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 1\nSET timestamp=1784768400;\n%s;\n", id, id, sql)
+	}
+	write := func(text string, flag int) {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ship runs collector rounds until the file is drained, the way the Agent
+	// does: commit on success or duplicate, resume from the cursor on conflict.
+	ship := func(tailer *slowlog.Tailer) {
+		for round := 0; round < 10; round++ {
+			batch, ok, err := tailer.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				continue
+			}
+			result, err := service.IngestSlowLog(ctx, sqldomain.SlowLogBatch{
+				MachineID: "machine-1", Port: 3306, FileID: batch.FileID, Path: batch.Path,
+				StartOffset: batch.Start, EndOffset: batch.End, Events: batch.Events,
+			})
+			if errors.Is(err, ErrSlowLogCursorConflict) {
+				if err := tailer.Resume(result.Cursor, true); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tailer.Commit(batch); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	stored := func() []string {
+		var out []string
+		for _, event := range repo.events {
+			out = append(out, event.SQLText)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	write(entry(1, "select 1")+entry(2, "select 2")+entry(3, "select 3"), os.O_APPEND)
+	tailer := slowlog.NewTailer(path)
+	defer tailer.Close()
+	if err := tailer.Resume(sqldomain.SlowLogCursor{}, true); err != nil {
+		t.Fatal(err)
+	}
+	ship(tailer)
+
+	// copytruncate: same inode, shorter content written from offset 0.
+	write(entry(4, "select 4"), os.O_TRUNC)
+	ship(tailer)
+	if got := strings.Join(stored(), ","); got != "select 1,select 2,select 3,select 4" {
+		t.Fatalf("content written after the truncation must be ingested, got %s", got)
+	}
+
+	// An Agent restart keeps the generation from the Manager cursor, and a
+	// truncation while it was down is detected from the shorter file.
+	cursor, _, _ := service.SlowLogCursor(ctx, "machine-1", 3306)
+	if !strings.Contains(cursor.FileID, "#1") {
+		t.Fatalf("cursor must carry the truncation generation: %+v", cursor)
+	}
+	tailer.Close()
+	write(entry(5, "select 5"), os.O_APPEND)
+	restarted := slowlog.NewTailer(path)
+	defer restarted.Close()
+	if err := restarted.Resume(cursor, true); err != nil {
+		t.Fatal(err)
+	}
+	ship(restarted)
+	restarted.Close()
+	cursor, _, _ = service.SlowLogCursor(ctx, "machine-1", 3306)
+	write(entry(6, "select 6"), os.O_TRUNC)
+	if err := restarted.Resume(cursor, true); err != nil {
+		t.Fatal(err)
+	}
+	ship(restarted)
+	if got := strings.Join(stored(), ","); got != "select 1,select 2,select 3,select 4,select 5,select 6" {
+		t.Fatalf("events = %s", got)
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+	mysqlapp "gmha/internal/mysql"
+)
+
+var (
+	ErrSlowLogBatchInvalid   = errors.New("慢日志批次无效")
+	ErrSlowLogCursorConflict = errors.New("慢日志批次与游标不连续")
+)
+
+const maxSlowLogBatchEvents = 5000
+
+// SlowLogCursor returns how far the Agent-side slow log file of an instance
+// has been ingested.
+func (s *SQLDiagnosticService) SlowLogCursor(ctx context.Context, machineID string, port int) (sqldomain.SlowLogCursor, bool, error) {
+	if strings.TrimSpace(machineID) == "" || port < 1 || port > 65535 {
+		return sqldomain.SlowLogCursor{}, false, fmt.Errorf("%w：请指定 machine_id 和 port", ErrSlowLogBatchInvalid)
+	}
+	return s.repo.GetSlowLogCursor(ctx, strings.TrimSpace(machineID), port)
+}
+
+// IngestSlowLog stores a batch parsed by the Agent from a slow log file. A
+// batch must start exactly where the cursor stopped (or at 0 of a new file),
+// so retries and concurrent senders never double count; a batch that ends
+// before the cursor was already stored and is acknowledged as a duplicate.
+// On ErrSlowLogCursorConflict the result carries the stored cursor.
+func (s *SQLDiagnosticService) IngestSlowLog(ctx context.Context, batch sqldomain.SlowLogBatch) (sqldomain.SlowLogIngestResult, error) {
+	batch.MachineID, batch.FileID = strings.TrimSpace(batch.MachineID), strings.TrimSpace(batch.FileID)
+	switch {
+	case batch.MachineID == "" || batch.Port < 1 || batch.Port > 65535:
+		return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：请指定 machine_id 和 port", ErrSlowLogBatchInvalid)
+	case batch.FileID == "":
+		return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：缺少 file_id", ErrSlowLogBatchInvalid)
+	case batch.StartOffset < 0 || batch.EndOffset < batch.StartOffset:
+		return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：偏移范围 %d-%d 无效", ErrSlowLogBatchInvalid, batch.StartOffset, batch.EndOffset)
+	case len(batch.Events) > maxSlowLogBatchEvents:
+		return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：单批最多 %d 条事件", ErrSlowLogBatchInvalid, maxSlowLogBatchEvents)
+	}
+	for _, event := range batch.Events {
+		if offset := int64(event.EventID); offset < batch.StartOffset || offset >= batch.EndOffset {
+			return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：事件偏移 %d 不在批次范围内", ErrSlowLogBatchInvalid, offset)
+		}
+	}
+	instance, found, err := s.target(ctx, batch.MachineID, batch.Port)
+	if err != nil {
+		return sqldomain.SlowLogIngestResult{}, err
+	}
+	if !found {
+		return sqldomain.SlowLogIngestResult{}, fmt.Errorf("%w：MySQL 实例 %s:%d 未登记", ErrSlowLogBatchInvalid, batch.MachineID, batch.Port)
+	}
+
+	s.slowLogMu.Lock()
+	defer s.slowLogMu.Unlock()
+	cursor, exists, err := s.repo.GetSlowLogCursor(ctx, batch.MachineID, batch.Port)
+	if err != nil {
+		return sqldomain.SlowLogIngestResult{}, err
+	}
+	if exists {
+		switch {
+		case cursor.FileID == batch.FileID && batch.EndOffset <= cursor.Offset:
+			return sqldomain.SlowLogIngestResult{Duplicate: true, Cursor: cursor}, nil
+		case cursor.FileID == batch.FileID && batch.StartOffset != cursor.Offset,
+			cursor.FileID != batch.FileID && batch.StartOffset != 0:
+			return sqldomain.SlowLogIngestResult{Cursor: cursor}, ErrSlowLogCursorConflict
+		}
+	}
+
+	now := time.Now().UTC()
+	cfg := s.Config()
+	events := make([]sqldomain.StatementEvent, 0, len(batch.Events))
+	if cfg.Enabled {
+		for _, event := range batch.Events {
+			events = append(events, mysqlapp.PrepareSlowLogFileEvent(instance, batch.FileID, event, cfg, now))
+		}
+		if err := s.repo.SaveStatementEvents(ctx, events); err != nil {
+			return sqldomain.SlowLogIngestResult{}, err
+		}
+	}
+	cursor = sqldomain.SlowLogCursor{
+		MachineID: batch.MachineID, Port: batch.Port, FileID: batch.FileID,
+		Path: strings.TrimSpace(batch.Path), Offset: batch.EndOffset, UpdatedAt: now,
+	}
+	if err := s.repo.SaveSlowLogCursor(ctx, cursor); err != nil {
+		return sqldomain.SlowLogIngestResult{}, err
+	}
+	return sqldomain.SlowLogIngestResult{Accepted: len(events), Cursor: cursor}, nil
+}
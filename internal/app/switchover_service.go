@@ -0,0 +1,693 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	hadomain "gmha/internal/domain/ha"
+	machinedomain "gmha/internal/domain/machine"
+	taskdomain "gmha/internal/domain/task"
+	mysqlapp "gmha/internal/mysql"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+const (
+	switchoverDefaultMaxLag   = 5
+	switchoverDefaultBudgetMS = 5000
+	switchoverLockTTL         = 5 * time.Minute
+	switchoverPollInterval    = 100 * time.Millisecond
+	switchoverCommandTimeout  = time.Minute
+	switchoverRollbackCatchup = 60
+	switchoverFenceMarker     = "__GMHA_SWITCHOVER_FENCED__"
+	switchoverPromotedMarker  = "__GMHA_SWITCHOVER_PROMOTED__"
+	switchoverCatchupTimeout  = "GMHA_SWITCHOVER_CATCHUP_TIMEOUT"
+)
+
+type switchoverRepository interface {
+	SaveSwitchover(context.Context, hadomain.Switchover) error
+	GetSwitchover(context.Context, string, string) (hadomain.Switchover, bool, error)
+	ListSwitchovers(context.Context, string, int) ([]hadomain.Switchover, error)
+}
+
+type switchoverRecoveryRepository interface {
+	MarkInterruptedSwitchovers(context.Context) error
+}
+
+// switchoverTopology is the live view a planned switchover acts on. Replicas
+// are the direct replicas of the old primary other than the target; cascaded
+// replicas keep following their own source.
+type switchoverTopology struct {
+	primary  replicationNode
+	target   replicationNode
+	replicas []replicationNode
+	skipped  []string
+}
+
+// errSwitchoverCatchup marks a target that did not reach the fenced GTID set
+// within the freeze budget; nothing was promoted, so the old primary reopens.
+var errSwitchoverCatchup = errors.New("target did not apply the fenced GTID set within the write-freeze budget")
+
+// StartSwitchover runs a planned primary switchover. Preflight (live probe,
+// target selection and the lag gate) runs synchronously so a request that
+// cannot proceed fails without touching any server; the rest runs in the
+// background and is recorded phase by phase.
+func (s *HAService) StartSwitchover(ctx context.Context, clusterID string, req hadomain.SwitchoverRequest) (hadomain.Switchover, error) {
+	if s.tasks == nil {
+		return hadomain.Switchover{}, errors.New("switchover executor is not configured")
+	}
+	store, ok := s.repo.(switchoverRepository)
+	if !ok {
+		return hadomain.Switchover{}, errors.New("switchover repository is not configured")
+	}
+	clusterID = strings.TrimSpace(clusterID)
+	req, err := normalizeSwitchoverRequest(clusterID, req)
+	if err != nil {
+		return hadomain.Switchover{}, err
+	}
+	vips, err := s.repo.ListVIPConfigs(ctx, clusterID)
+	if err != nil {
+		return hadomain.Switchover{}, err
+	}
+	moveVIP := len(vips) > 0
+	if req.MoveVIP != nil {
+		moveVIP = *req.MoveVIP
+	}
+	if moveVIP && len(vips) == 0 {
+		return hadomain.Switchover{}, errors.New("move_vip requested but no enabled VIP is configured")
+	}
+	now := time.Now().UTC()
+	item := hadomain.Switchover{
+		SwitchoverID: "so-" + strings.TrimPrefix(newFailoverID(), "fo-"), ClusterID: clusterID, Status: hadomain.SwitchoverPending,
+		TargetMode: req.TargetMode, MaxLagSeconds: req.MaxLagSeconds, FreezeBudgetMS: req.FreezeBudgetMS, MoveVIP: moveVIP,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if err := s.repo.AcquireFailoverLock(ctx, clusterID, item.SwitchoverID, "gmha-switchover", switchoverLockTTL); err != nil {
+		return hadomain.Switchover{}, err
+	}
+	parent, err := s.tasks.CreateBatchTrackingTask(ctx, "mysql_switchover", "计划内主从切换 "+clusterID, clusterID)
+	if err != nil {
+		_ = s.repo.ReleaseFailoverLock(context.Background(), clusterID, item.SwitchoverID)
+		return hadomain.Switchover{}, err
+	}
+	item.TaskID = parent.Task.ID
+	var topology switchoverTopology
+	preflightErr := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhasePreflight, func() ([]string, string, error) {
+		nodes, ids, err := s.probeSwitchoverNodes(ctx, clusterID, item.TaskID)
+		if err != nil {
+			return ids, "", err
+		}
+		topology, err = selectSwitchoverTopology(nodes, req)
+		if err != nil {
+			return ids, "", err
+		}
+		for _, node := range append([]replicationNode{topology.primary, topology.target}, topology.replicas...) {
+			if compatible, reason := s.tasks.MachineCapability(node.machine.ID, taskdomain.CapabilityMySQLDefaultsFile); !compatible {
+				return ids, "", fmt.Errorf("node %s cannot run switchover: %s", node.machine.Name, reason)
+			}
+		}
+		detail := fmt.Sprintf("%s -> %s, target lag %ds", topology.primary.endpoint(), topology.target.endpoint(), topology.target.lagSeconds)
+		if len(topology.skipped) > 0 {
+			detail += "; not repointed: " + strings.Join(topology.skipped, ", ")
+		}
+		return ids, detail, nil
+	})
+	if preflightErr != nil {
+		s.finishSwitchover(store, &item, hadomain.SwitchoverAborted, preflightErr)
+		return item, preflightErr
+	}
+	item.OldPrimaryMachineID, item.OldPrimaryEndpoint = topology.primary.machine.ID, topology.primary.endpoint()
+	item.NewPrimaryMachineID, item.NewPrimaryEndpoint = topology.target.machine.ID, topology.target.endpoint()
+	item.TargetLagSeconds = topology.target.lagSeconds
+	item.Status = hadomain.SwitchoverRunning
+	item.UpdatedAt = time.Now().UTC()
+	if err := store.SaveSwitchover(ctx, item); err != nil {
+		s.finishSwitchover(store, &item, hadomain.SwitchoverFailed, err)
+		return item, err
+	}
+	go s.executeSwitchover(context.Background(), store, item, topology)
+	return item, nil
+}
+
+func (s *HAService) GetSwitchover(ctx context.Context, clusterID, switchoverID string) (hadomain.Switchover, bool, error) {
+	store, ok := s.repo.(switchoverRepository)
+	if !ok {
+		return hadomain.Switchover{}, false, errors.New("switchover repository is not configured")
+	}
+	return store.GetSwitchover(ctx, clusterID, switchoverID)
+}
+
+func (s *HAService) ListSwitchovers(ctx context.Context, clusterID string, limit int) ([]hadomain.Switchover, error) {
+	store, ok := s.repo.(switchoverRepository)
+	if !ok {
+		return nil, errors.New("switchover repository is not configured")
+	}
+	return store.ListSwitchovers(ctx, clusterID, limit)
+}
+
+func normalizeSwitchoverRequest(clusterID string, req hadomain.SwitchoverRequest) (hadomain.SwitchoverRequest, error) {
+	if clusterID == "" {
+		return req, errors.New("cluster is required")
+	}
+	if strings.TrimSpace(req.Confirm) != clusterID {
+		return req, fmt.Errorf("confirm must equal the cluster name %s", clusterID)
+	}
+	req.TargetMode = strings.ToLower(strings.TrimSpace(req.TargetMode))
+	req.TargetMachineID = strings.TrimSpace(req.TargetMachineID)
+	switch req.TargetMode {
+	case "":
+		req.TargetMode = hadomain.SwitchoverTargetBest
+		if req.TargetMachineID != "" {
+			req.TargetMode = hadomain.SwitchoverTargetExplicit
+		}
+	case hadomain.SwitchoverTargetBest, hadomain.SwitchoverTargetExplicit:
+	default:
+		return req, errors.New("target_mode must be explicit or best")
+	}
+	if req.TargetMode == hadomain.SwitchoverTargetExplicit && req.TargetMachineID == "" {
+		return req, errors.New("target_machine_id is required for explicit target mode")
+	}
+	if req.MaxLagSeconds < 0 || req.FreezeBudgetMS < 0 {
+		return req, errors.New("max_lag_seconds and freeze_budget_ms cannot be negative")
+	}
+	if req.MaxLagSeconds == 0 {
+		req.MaxLagSeconds = switchoverDefaultMaxLag
+	}
+	if req.FreezeBudgetMS == 0 {
+		req.FreezeBudgetMS = switchoverDefaultBudgetMS
+	}
+	return req, nil
+}
+
+// selectSwitchoverTopology identifies the old primary and picks the target.
+// A target must be a direct, non-delayed replica with running threads, lag
+// within the gate and no transactions the primary lacks.
+func selectSwitchoverTopology(nodes []replicationNode, req hadomain.SwitchoverRequest) (switchoverTopology, error) {
+	var writers []replicationNode
+	for _, node := range nodes {
+		if node.reachable && !node.readOnly && !node.superReadOnly && node.channels == 0 {
+			writers = append(writers, node)
+		}
+	}
+	if len(writers) != 1 {
+		return switchoverTopology{}, fmt.Errorf("expected exactly one writable primary without replication channels, found %d", len(writers))
+	}
+	topology := switchoverTopology{primary: writers[0]}
+	primarySet, err := mysqlapp.ParseGTIDSet(topology.primary.executed)
+	if err != nil {
+		return topology, fmt.Errorf("cannot parse primary gtid_executed: %w", err)
+	}
+	rejections := map[string][]string{}
+	var candidates []replicationNode
+	for _, node := range nodes {
+		if node.endpoint() == topology.primary.endpoint() {
+			continue
+		}
+		if !node.reachable {
+			topology.skipped = append(topology.skipped, node.endpoint()+" (unreachable)")
+			rejections[node.endpoint()] = []string{"unreachable"}
+			continue
+		}
+		if node.sourceHost != topology.primary.machine.IP || node.sourcePort != topology.primary.instance.Port {
+			rejections[node.endpoint()] = []string{"not a direct replica of the primary"}
+			continue
+		}
+		var reasons []string
+		if !node.ioRunning || !node.sqlRunning {
+			reasons = append(reasons, "replication threads are not running")
+		}
+		if node.delay > 0 {
+			reasons = append(reasons, "delayed replica")
+		}
+		if node.lagSeconds < 0 {
+			reasons = append(reasons, "replication lag is unknown")
+		} else if node.lagSeconds > req.MaxLagSeconds {
+			reasons = append(reasons, fmt.Sprintf("lag %ds exceeds max_lag_seconds %d", node.lagSeconds, req.MaxLagSeconds))
+		}
+		if set, err := mysqlapp.ParseGTIDSet(node.executed); err != nil || !primarySet.Contains(set) {
+			reasons = append(reasons, "has transactions the primary does not have")
+		}
+		rejections[node.endpoint()] = reasons
+		if len(reasons) == 0 {
+			candidates = append(candidates, node)
+		}
+	}
+	if req.TargetMode == hadomain.SwitchoverTargetExplicit {
+		var matched []replicationNode
+		for _, node := range nodes {
+			if node.machine.ID == req.TargetMachineID && (req.TargetPort <= 0 || node.instance.Port == req.TargetPort) {
+				matched = append(matched, node)
+			}
+		}
+		if len(matched) != 1 {
+			return topology, fmt.Errorf("target %s does not identify exactly one instance in the cluster", req.TargetMachineID)
+		}
+		if matched[0].endpoint() == topology.primary.endpoint() {
+			return topology, fmt.Errorf("target %s is already the primary", matched[0].endpoint())
+		}
+		if reasons := rejections[matched[0].endpoint()]; len(reasons) > 0 {
+			return topology, fmt.Errorf("target %s is not eligible: %s", matched[0].endpoint(), strings.Join(reasons, ", "))
+		}
+		topology.target = matched[0]
+	} else {
+		if len(candidates) == 0 {
+			var details []string
+			for endpoint, reasons := range rejections {
+				details = append(details, endpoint+": "+strings.Join(reasons, ", "))
+			}
+			sort.Strings(details)
+			return topology, fmt.Errorf("no eligible switchover target (%s)", strings.Join(details, "; "))
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].lagSeconds != candidates[j].lagSeconds {
+				return candidates[i].lagSeconds < candidates[j].lagSeconds
+			}
+			si, _ := mysqlapp.ParseGTIDSet(candidates[i].executed)
+			sj, _ := mysqlapp.ParseGTIDSet(candidates[j].executed)
+			if si.Count() != sj.Count() {
+				return si.Count() > sj.Count()
+			}
+			return candidates[i].endpoint() < candidates[j].endpoint()
+		})
+		topology.target = candidates[0]
+	}
+	for _, node := range nodes {
+		if node.reachable && node.endpoint() != topology.target.endpoint() && node.sourceHost == topology.primary.machine.IP && node.sourcePort == topology.primary.instance.Port {
+			topology.replicas = append(topology.replicas, node)
+		}
+	}
+	return topology, nil
+}
+
+func (s *HAService) executeSwitchover(ctx context.Context, store switchoverRepository, item hadomain.Switchover, topology switchoverTopology) {
+	executionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-executionCtx.Done():
+				return
+			case <-ticker.C:
+				if err := s.repo.RenewFailoverLock(context.Background(), item.ClusterID, item.SwitchoverID, switchoverLockTTL); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	ctx = executionCtx
+	user, password := s.architectureManagementAccount(ctx)
+	oldPrimary, target := topology.primary, topology.target
+	budget := time.Duration(item.FreezeBudgetMS) * time.Millisecond
+
+	var fenceGTID string
+	freezeStart := time.Now()
+	if err := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhaseFence, func() ([]string, string, error) {
+		id, output, err := s.runSwitchoverCommand(ctx, item.TaskID, oldPrimary, switchoverFenceCommand(oldPrimary.instance.Port), "冻结旧主写入并读取 GTID")
+		if err != nil {
+			return []string{id}, "", err
+		}
+		fenceGTID, err = parseSwitchoverFence(output)
+		return []string{id}, "fenced at " + fenceGTID, err
+	}); err != nil {
+		s.reopenSwitchoverPrimary(item, oldPrimary)
+		s.finishSwitchover(store, &item, hadomain.SwitchoverAborted, err)
+		return
+	}
+	item.FenceGTIDSet = fenceGTID
+
+	promoted := false
+	if err := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhasePromote, func() ([]string, string, error) {
+		remaining := budget - time.Since(freezeStart)
+		if remaining <= 0 {
+			return nil, "", errSwitchoverCatchup
+		}
+		id, output, err := s.runSwitchoverCommand(ctx, item.TaskID, target, switchoverPromoteCommand(target.instance.Port, fenceGTID, remaining), "在冻结预算内追平并提升新主")
+		if err != nil {
+			if strings.Contains(output, switchoverCatchupTimeout) || strings.Contains(err.Error(), switchoverCatchupTimeout) {
+				return []string{id}, "", errSwitchoverCatchup
+			}
+			// Replication may already be reset on the target; treat it as promoted
+			// so rollback re-attaches it to the old primary.
+			promoted = true
+			return []string{id}, "", err
+		}
+		promoted = true
+		if !strings.Contains(output, switchoverPromotedMarker) {
+			return []string{id}, "", errors.New("target did not confirm it is writable")
+		}
+		return []string{id}, fmt.Sprintf("%s writable after %dms of write freeze", target.endpoint(), time.Since(freezeStart).Milliseconds()), nil
+	}); err != nil {
+		if !promoted {
+			s.reopenSwitchoverPrimary(item, oldPrimary)
+			s.finishSwitchover(store, &item, hadomain.SwitchoverAborted, err)
+			return
+		}
+		s.rollbackSwitchover(store, &item, topology, user, password, err)
+		return
+	}
+
+	if err := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhaseRouting, func() ([]string, string, error) {
+		return s.switchSwitchoverRouting(ctx, item, topology, target)
+	}); err != nil {
+		s.recordSwitchoverFreeze(&item, freezeStart)
+		s.rollbackSwitchover(store, &item, topology, user, password, err)
+		return
+	}
+	s.recordSwitchoverFreeze(&item, freezeStart)
+
+	if err := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhaseRepoint, func() ([]string, string, error) {
+		return s.repointSwitchoverReplicas(ctx, item, target, append([]replicationNode{oldPrimary}, topology.replicas...), user, password)
+	}); err != nil {
+		s.rollbackSwitchover(store, &item, topology, user, password, err)
+		return
+	}
+	if err := s.switchoverPhase(ctx, store, &item, hadomain.SwitchoverPhaseVerify, func() ([]string, string, error) {
+		return s.verifySwitchover(ctx, item, target, append([]replicationNode{oldPrimary}, topology.replicas...))
+	}); err != nil {
+		s.rollbackSwitchover(store, &item, topology, user, password, err)
+		return
+	}
+	s.finishSwitchover(store, &item, hadomain.SwitchoverSucceeded, nil)
+}
+
+func (s *HAService) recordSwitchoverFreeze(item *hadomain.Switchover, freezeStart time.Time) {
+	item.WriteFreezeMS = time.Since(freezeStart).Milliseconds()
+	item.WithinBudget = item.WriteFreezeMS <= item.FreezeBudgetMS
+}
+
+// switchSwitchoverRouting moves the VIP and re-syncs route layers to primary.
+// The write outage ends when this phase completes.
+func (s *HAService) switchSwitchoverRouting(ctx context.Context, item hadomain.Switchover, topology switchoverTopology, primary replicationNode) ([]string, string, error) {
+	var ids []string
+	var details []string
+	if item.MoveVIP {
+		machines := map[string]machinedomain.Machine{topology.primary.machine.ID: topology.primary.machine, topology.target.machine.ID: topology.target.machine}
+		for _, node := range topology.replicas {
+			machines[node.machine.ID] = node.machine
+		}
+		run := hadomain.ArchitectureRun{RunID: item.SwitchoverID, ClusterID: item.ClusterID, Plan: hadomain.ArchitectureAdjustmentPlan{
+			SelectedCandidate: hadomain.CandidateScore{MachineID: primary.machine.ID, InstanceID: instanceID(primary.instance)},
+		}}
+		created, err := s.moveArchitectureVIP(ctx, run, hadomain.ArchitectureAdjustmentRequest{}, machines)
+		ids = append(ids, created...)
+		if err != nil {
+			return ids, "", err
+		}
+		details = append(details, "VIP moved to "+primary.machine.Name)
+	}
+	if s.routes != nil && s.routes.ClusterRoutesConfigured(ctx, item.ClusterID) {
+		route := ClusterRouteTopology{RunID: item.SwitchoverID, PrimaryMachineID: primary.machine.ID}
+		for _, node := range append([]replicationNode{topology.primary, topology.target}, topology.replicas...) {
+			route.Backends = append(route.Backends, ClusterRouteBackend{MachineID: node.machine.ID, Host: node.machine.IP, Port: node.instance.Port})
+		}
+		created, err := s.routes.SyncClusterRoutes(ctx, item.ClusterID, route)
+		ids = append(ids, created...)
+		if err != nil {
+			return ids, "", err
+		}
+		details = append(details, "route layer synced")
+	}
+	if len(details) == 0 {
+		details = append(details, "no VIP or route layer configured")
+	}
+	return ids, strings.Join(details, "; "), nil
+}
+
+func (s *HAService) repointSwitchoverReplicas(ctx context.Context, item hadomain.Switchover, primary replicationNode, replicas []replicationNode, user, password string) ([]string, string, error) {
+	var ids []string
+	primaryClient := mysqlArchitectureClient("", primary.instance.Port)
+	id, _, err := s.runSwitchoverCommand(ctx, item.TaskID, primary, mysqlRolePersistenceCommand(primaryClient, false), "持久化新主可写角色")
+	ids = append(ids, id)
+	if err != nil {
+		return ids, "", err
+	}
+	for _, replica := range replicas {
+		tls := taskusecase.ReplicationTLS{}
+		if s.tls != nil {
+			tls, _ = s.tls.ReplicationSourceTLS(ctx, replica.machine.ID, replica.instance.Port)
+		}
+		id, _, err := s.runSwitchoverCommand(ctx, item.TaskID, replica, switchoverAttachCommand(replica, primary, user, password, tls), "指向新主 "+primary.endpoint())
+		ids = append(ids, id)
+		if err != nil {
+			return ids, "", fmt.Errorf("repoint %s: %w", replica.endpoint(), err)
+		}
+	}
+	return ids, fmt.Sprintf("%d replica(s) now follow %s", len(replicas), primary.endpoint()), nil
+}
+
+// verifySwitchover re-probes the new topology. Threads are given a short
+// window to connect before the check counts as failed.
+func (s *HAService) verifySwitchover(ctx context.Context, item hadomain.Switchover, primary replicationNode, replicas []replicationNode) ([]string, string, error) {
+	var ids []string
+	var lastErr error
+	for attempt := 0; attempt < 10; attempt++ {
+		if attempt > 0 {
+			time.Sleep(2 * time.Second)
+		}
+		lastErr = nil
+		id, output, err := s.runSwitchoverCommand(ctx, item.TaskID, primary, mysqlArchitectureCommand("", primary.instance.Port, replicationNodeSQL()), "校验新主")
+		ids = append(ids, id)
+		probed, ok := parseReplicationNode(output)
+		switch {
+		case err != nil:
+			lastErr = err
+		case !ok || probed.readOnly || probed.superReadOnly || probed.channels != 0:
+			lastErr = fmt.Errorf("new primary %s is not writable or still has a replication channel", primary.endpoint())
+		}
+		for _, replica := range replicas {
+			if lastErr != nil {
+				break
+			}
+			id, output, err := s.runSwitchoverCommand(ctx, item.TaskID, replica, mysqlArchitectureCommand("", replica.instance.Port, replicationNodeSQL()), "校验副本复制")
+			ids = append(ids, id)
+			probed, ok := parseReplicationNode(output)
+			switch {
+			case err != nil:
+				lastErr = err
+			case !ok || probed.sourceHost != primary.machine.IP || probed.sourcePort != primary.instance.Port:
+				lastErr = fmt.Errorf("replica %s does not follow the new primary", replica.endpoint())
+			case !probed.ioRunning || !probed.sqlRunning:
+				lastErr = fmt.Errorf("replica %s replication threads are not running", replica.endpoint())
+			case !probed.readOnly || !probed.superReadOnly:
+				lastErr = fmt.Errorf("replica %s is not read-only", replica.endpoint())
+			}
+		}
+		if lastErr == nil {
+			return ids, fmt.Sprintf("%s writable, %d replica(s) replicating", primary.endpoint(), len(replicas)), nil
+		}
+	}
+	return ids, "", lastErr
+}
+
+// rollbackSwitchover returns the primary role to the old primary after a
+// post-promotion failure. The new primary is fenced first and the old one
+// applies anything written to it meanwhile before reopening, so no
+// transaction is lost.
+func (s *HAService) rollbackSwitchover(store switchoverRepository, item *hadomain.Switchover, topology switchoverTopology, user, password string, cause error) {
+	ctx := context.Background()
+	oldPrimary, target := topology.primary, topology.target
+	rollbackErr := s.switchoverPhase(ctx, store, item, hadomain.SwitchoverPhaseRollback, func() ([]string, string, error) {
+		var ids []string
+		id, output, err := s.runSwitchoverCommand(ctx, item.TaskID, target, switchoverFenceCommand(target.instance.Port), "回滚：冻结新主")
+		ids = append(ids, id)
+		if err != nil {
+			return ids, "", fmt.Errorf("fence new primary: %w", err)
+		}
+		gtid, err := parseSwitchoverFence(output)
+		if err != nil {
+			return ids, "", err
+		}
+		tls := taskusecase.ReplicationTLS{}
+		if s.tls != nil {
+			tls, _ = s.tls.ReplicationSourceTLS(ctx, oldPrimary.machine.ID, oldPrimary.instance.Port)
+		}
+		id, _, err = s.runSwitchoverCommand(ctx, item.TaskID, oldPrimary, switchoverReclaimCommand(oldPrimary, target, user, password, tls, gtid), "回滚：旧主追平并恢复写入")
+		ids = append(ids, id)
+		if err != nil {
+			return ids, "", fmt.Errorf("reopen old primary: %w", err)
+		}
+		created, _, err := s.switchSwitchoverRouting(ctx, *item, topology, oldPrimary)
+		ids = append(ids, created...)
+		if err != nil {
+			return ids, "", fmt.Errorf("route back to old primary: %w", err)
+		}
+		created, _, err = s.repointSwitchoverReplicas(ctx, *item, oldPrimary, append([]replicationNode{target}, topology.replicas...), user, password)
+		ids = append(ids, created...)
+		if err != nil {
+			return ids, "", err
+		}
+		created, _, err = s.verifySwitchover(ctx, *item, oldPrimary, append([]replicationNode{target}, topology.replicas...))
+		ids = append(ids, created...)
+		return ids, "primary role returned to " + oldPrimary.endpoint(), err
+	})
+	item.RolledBack = rollbackErr == nil
+	if rollbackErr != nil {
+		s.finishSwitchover(store, item, hadomain.SwitchoverRollbackFailed, fmt.Errorf("%v; rollback failed: %w", cause, rollbackErr))
+		return
+	}
+	s.finishSwitchover(store, item, hadomain.SwitchoverRolledBack, cause)
+}
+
+// reopenSwitchoverPrimary lifts the fence when nothing was promoted.
+func (s *HAService) reopenSwitchoverPrimary(item hadomain.Switchover, primary replicationNode) {
+	_, _, _ = s.runSwitchoverCommand(context.Background(), item.TaskID, primary, mysqlArchitectureCommand("", primary.instance.Port,
+		"SET GLOBAL super_read_only=OFF; SET GLOBAL read_only=OFF; SET GLOBAL offline_mode=OFF;"), "放弃切换并恢复旧主写入")
+}
+
+func (s *HAService) switchoverPhase(ctx context.Context, store switchoverRepository, item *hadomain.Switchover, name string, execute func() ([]string, string, error)) error {
+	started := time.Now()
+	ids, detail, err := execute()
+	phase := hadomain.SwitchoverPhase{Name: name, Status: "success", StartedAt: started.UTC(), DurationMS: time.Since(started).Milliseconds(), Detail: detail}
+	for _, id := range ids {
+		if id != "" {
+			phase.TaskIDs = append(phase.TaskIDs, id)
+		}
+	}
+	if err != nil {
+		phase.Status, phase.Detail = "failed", err.Error()
+	}
+	item.Phases = append(item.Phases, phase)
+	item.UpdatedAt = time.Now().UTC()
+	_ = store.SaveSwitchover(ctx, *item)
+	return err
+}
+
+func (s *HAService) finishSwitchover(store switchoverRepository, item *hadomain.Switchover, status string, err error) {
+	now := time.Now().UTC()
+	item.Status, item.UpdatedAt, item.FinishedAt = status, now, &now
+	if err != nil {
+		item.Error = err.Error()
+	}
+	_ = store.SaveSwitchover(context.Background(), *item)
+	failed := 0
+	if status != hadomain.SwitchoverSucceeded {
+		failed = 1
+	}
+	if item.TaskID != "" {
+		_ = s.tasks.FinalizeBatchTrackingTask(context.Background(), item.TaskID, 1, failed)
+	}
+	_ = s.repo.ReleaseFailoverLock(context.Background(), item.ClusterID, item.SwitchoverID)
+}
+
+func (s *HAService) probeSwitchoverNodes(ctx context.Context, clusterID, parentID string) ([]replicationNode, []string, error) {
+	machines, err := s.machines.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := map[string]machinedomain.Machine{}
+	for _, machine := range machines {
+		if machine.Cluster == clusterID {
+			byID[machine.ID] = machine
+		}
+	}
+	instances, err := s.instances.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var nodes []replicationNode
+	var ids []string
+	for _, instance := range instances {
+		machine, ok := byID[instance.MachineID]
+		if !ok {
+			continue
+		}
+		node := replicationNode{machine: machine, instance: instance}
+		command := mysqlArchitectureCommand("", instance.Port, replicationNodeSQL()) + "; " + switchoverReplicaStatusCommand(instance.Port)
+		id, output, err := s.runSwitchoverCommand(ctx, parentID, node, command, "探测复制角色与延迟")
+		ids = append(ids, id)
+		if err == nil {
+			if probed, ok := parseReplicationNode(output); ok {
+				probed.machine, probed.instance = machine, instance
+				node = probed
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, ids, fmt.Errorf("cluster %s has no MySQL instances", clusterID)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].endpoint() < nodes[j].endpoint() })
+	return nodes, ids, nil
+}
+
+// runSwitchoverCommand polls the Agent task at a short interval because the
+// fence and promote steps sit inside the write-freeze window.
+func (s *HAService) runSwitchoverCommand(ctx context.Context, parentID string, node replicationNode, command, stepName string) (string, string, error) {
+	return s.tasks.runExecTaskEvery(ctx, node.machine.IP, command, ExecTaskOptions{
+		ParentTaskID: parentID, Operation: "mysql_switchover_step", DisplayName: "计划内切换 " + node.machine.Name,
+		StepName: stepName, Port: node.instance.Port,
+	}, switchoverCommandTimeout, switchoverPollInterval)
+}
+
+func switchoverReplicaStatusCommand(port int) string {
+	client := mysqlArchitectureClient("", port)
+	return "(" + client + " --execute='SHOW REPLICA STATUS\\G' 2>/dev/null || " + client + " --execute='SHOW SLAVE STATUS\\G' 2>/dev/null || true)"
+}
+
+// switchoverFenceCommand disconnects applications and blocks writes, then
+// reports the final GTID set. super_read_only waits for in-flight commits, so
+// the reported set is complete.
+func switchoverFenceCommand(port int) string {
+	return mysqlArchitectureCommand("", port, fmt.Sprintf("SET GLOBAL offline_mode=ON; SET GLOBAL read_only=ON; SET GLOBAL super_read_only=ON; "+
+		"SELECT '%s', @@global.super_read_only, CONCAT('gtid:', REPLACE(@@global.gtid_executed, '\\n', ''));", switchoverFenceMarker))
+}
+
+func parseSwitchoverFence(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) == 3 && fields[0] == switchoverFenceMarker {
+			if fields[1] != "1" {
+				return "", errors.New("super_read_only did not take effect")
+			}
+			return strings.TrimPrefix(fields[2], "gtid:"), nil
+		}
+	}
+	return "", errors.New("fence result was not reported")
+}
+
+// switchoverPromoteCommand waits at most the remaining budget for the fenced
+// set, then detaches the target and opens it for writes in the same task so
+// the freeze window costs one Agent round trip.
+func switchoverPromoteCommand(port int, gtid string, remaining time.Duration) string {
+	client := mysqlArchitectureClient("", port)
+	wait := fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET(%s, %s)", sqlLiteral(gtid), strconv.FormatFloat(remaining.Seconds(), 'f', 3, 64))
+	promote := fmt.Sprintf("SET GLOBAL super_read_only=OFF; SET GLOBAL read_only=OFF; SET GLOBAL offline_mode=OFF; SELECT '%s', @@global.read_only;", switchoverPromotedMarker)
+	return "reached=$(" + client + " --batch --raw --skip-column-names --execute=" + shellQuote(wait) + ") || exit 70; " +
+		"[ \"$reached\" = 0 ] || { echo " + switchoverCatchupTimeout + " >&2; exit 75; }; " +
+		"(" + client + " --execute=" + shellQuote("STOP REPLICA FOR CHANNEL ''; RESET REPLICA ALL FOR CHANNEL '';") + " 2>/dev/null || " +
+		client + " --execute=" + shellQuote("STOP SLAVE FOR CHANNEL ''; RESET SLAVE ALL FOR CHANNEL '';") + "); " +
+		client + " --batch --raw --skip-column-names --execute=" + shellQuote(promote)
+}
+
+// switchoverAttachCommand makes node a read-only replica of primary, keeping
+// its SOURCE_DELAY, and reopens it for read traffic.
+func switchoverAttachCommand(node, primary replicationNode, user, password string, tls taskusecase.ReplicationTLS) string {
+	client := mysqlArchitectureClient("", node.instance.Port)
+	modern, legacy := replicaSourceSQL(primary, user, password, node.delay, tls)
+	return "(" + client + " --execute=" + shellQuote("SET GLOBAL read_only=ON; SET GLOBAL super_read_only=ON; "+modern) + " 2>/dev/null || " +
+		client + " --execute=" + shellQuote("SET GLOBAL read_only=ON; SET GLOBAL super_read_only=ON; "+legacy) + "); " +
+		mysqlRolePersistenceCommand(client, true) + "; " +
+		client + " --execute=" + shellQuote("SET GLOBAL offline_mode=OFF;")
+}
+
+// switchoverReclaimCommand has the old primary replicate from the fenced new
+// primary until it holds gtid, then detaches it and reopens writes.
+func switchoverReclaimCommand(oldPrimary, newPrimary replicationNode, user, password string, tls taskusecase.ReplicationTLS, gtid string) string {
+	client := mysqlArchitectureClient("", oldPrimary.instance.Port)
+	modern, legacy := replicaSourceSQL(newPrimary, user, password, 0, tls)
+	wait := fmt.Sprintf("SELECT WAIT_FOR_EXECUTED_GTID_SET(%s, %d)", sqlLiteral(gtid), switchoverRollbackCatchup)
+	return "(" + client + " --execute=" + shellQuote(modern) + " 2>/dev/null || " + client + " --execute=" + shellQuote(legacy) + "); " +
+		"reached=$(" + client + " --batch --raw --skip-column-names --execute=" + shellQuote(wait) + ") || exit 70; " +
+		"[ \"$reached\" = 0 ] || { echo 'old primary did not catch up with the fenced new primary' >&2; exit 75; }; " +
+		"(" + client + " --execute=" + shellQuote("STOP REPLICA FOR CHANNEL ''; RESET REPLICA ALL FOR CHANNEL '';") + " 2>/dev/null || " +
+		client + " --execute=" + shellQuote("STOP SLAVE FOR CHANNEL ''; RESET SLAVE ALL FOR CHANNEL '';") + "); " +
+		mysqlRolePersistenceCommand(client, false) + "; " +
+		client + " --execute=" + shellQuote("SET GLOBAL offline_mode=OFF;")
+}
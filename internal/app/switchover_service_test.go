@@ -0,0 +1,123 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	hadomain "gmha/internal/domain/ha"
+	taskusecase "gmha/internal/usecase/task"
+)
+
+func TestSelectSwitchoverTopologyAppliesLagGateAndPicksBestCandidate(t *testing.T) {
+	primary := rebuildTestNode("db-1", "10.0.0.1", "8.0.36", "1-100", false, "")
+	behind := rebuildTestNode("db-2", "10.0.0.2", "8.0.36", "1-90", true, "10.0.0.1")
+	behind.lagSeconds = 2
+	current := rebuildTestNode("db-3", "10.0.0.3", "8.0.36", "1-100", true, "10.0.0.1")
+	lagging := rebuildTestNode("db-4", "10.0.0.4", "8.0.36", "1-40", true, "10.0.0.1")
+	lagging.lagSeconds = 30
+	errant := rebuildTestNode("db-5", "10.0.0.5", "8.0.36", "1-100", true, "10.0.0.1")
+	errant.executed += ",aaaaaaaa-71ca-11e1-9e33-c80aa9429562:1"
+	cascaded := rebuildTestNode("db-6", "10.0.0.6", "8.0.36", "1-100", true, "10.0.0.3")
+	nodes := []replicationNode{primary, behind, current, lagging, errant, cascaded}
+
+	req, err := normalizeSwitchoverRequest("demo", hadomain.SwitchoverRequest{Confirm: "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	topology, err := selectSwitchoverTopology(nodes, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topology.primary.machine.ID != "db-1" || topology.target.machine.ID != "db-3" {
+		t.Fatalf("expected db-1 -> db-3, got %s -> %s", topology.primary.machine.ID, topology.target.machine.ID)
+	}
+	var repointed []string
+	for _, node := range topology.replicas {
+		repointed = append(repointed, node.machine.ID)
+	}
+	if strings.Join(repointed, ",") != "db-2,db-4,db-5" {
+		t.Fatalf("only direct replicas other than the target are repointed, got %v", repointed)
+	}
+
+	_, err = selectSwitchoverTopology(nodes, hadomain.SwitchoverRequest{TargetMode: hadomain.SwitchoverTargetExplicit, TargetMachineID: "db-4", MaxLagSeconds: 5})
+	if err == nil || !strings.Contains(err.Error(), "exceeds max_lag_seconds") {
+		t.Fatalf("lagging target must be refused, got %v", err)
+	}
+	_, err = selectSwitchoverTopology(nodes, hadomain.SwitchoverRequest{TargetMode: hadomain.SwitchoverTargetExplicit, TargetMachineID: "db-5", MaxLagSeconds: 5})
+	if err == nil || !strings.Contains(err.Error(), "transactions the primary does not have") {
+		t.Fatalf("errant target must be refused, got %v", err)
+	}
+	_, err = selectSwitchoverTopology(nodes, hadomain.SwitchoverRequest{TargetMode: hadomain.SwitchoverTargetExplicit, TargetMachineID: "db-6", MaxLagSeconds: 5})
+	if err == nil || !strings.Contains(err.Error(), "not a direct replica") {
+		t.Fatalf("cascaded target must be refused, got %v", err)
+	}
+	topology, err = selectSwitchoverTopology(nodes, hadomain.SwitchoverRequest{TargetMode: hadomain.SwitchoverTargetExplicit, TargetMachineID: "db-2", MaxLagSeconds: 5})
+	if err != nil || topology.target.machine.ID != "db-2" {
+		t.Fatalf("explicit eligible target must be honoured, got %v", err)
+	}
+
+	current.lagSeconds = -1
+	_, err = selectSwitchoverTopology([]replicationNode{primary, current, lagging}, req)
+	if err == nil || !strings.Contains(err.Error(), "no eligible switchover target") {
+		t.Fatalf("unknown lag and lag over the gate leave no target, got %v", err)
+	}
+	demoted := primary
+	demoted.readOnly, demoted.superReadOnly = true, true
+	if _, err := selectSwitchoverTopology([]replicationNode{demoted, behind}, req); err == nil {
+		t.Fatal("a cluster without a writable primary cannot switch over")
+	}
+}
+
+func TestNormalizeSwitchoverRequestDefaults(t *testing.T) {
+	if _, err := normalizeSwitchoverRequest("demo", hadomain.SwitchoverRequest{Confirm: "other"}); err == nil {
+		t.Fatal("confirm must match the cluster")
+	}
+	req, err := normalizeSwitchoverRequest("demo", hadomain.SwitchoverRequest{Confirm: "demo", TargetMachineID: "db-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.TargetMode != hadomain.SwitchoverTargetExplicit || req.MaxLagSeconds != switchoverDefaultMaxLag || req.FreezeBudgetMS != switchoverDefaultBudgetMS {
+		t.Fatalf("unexpected defaults: %+v", req)
+	}
+	if _, err := normalizeSwitchoverRequest("demo", hadomain.SwitchoverRequest{Confirm: "demo", TargetMode: "explicit"}); err == nil {
+		t.Fatal("explicit mode requires a target")
+	}
+}
+
+func TestSwitchoverCommandsFenceWithinBudgetAndKeepDelay(t *testing.T) {
+	fence := switchoverFenceCommand(3306)
+	for _, expected := range []string{"offline_mode=ON", "super_read_only=ON", switchoverFenceMarker} {
+		if !strings.Contains(fence, expected) {
+			t.Fatalf("fence command missing %q:\n%s", expected, fence)
+		}
+	}
+	gtid, err := parseSwitchoverFence("mysql: [Warning] Using a password\n" + switchoverFenceMarker + "\t1\tgtid:" + rebuildTestUUID + ":1-100")
+	if err != nil || gtid != rebuildTestUUID+":1-100" {
+		t.Fatalf("unexpected fence parse: %q %v", gtid, err)
+	}
+	if _, err := parseSwitchoverFence(switchoverFenceMarker + "\t0\tgtid:"); err == nil {
+		t.Fatal("fence without super_read_only must fail")
+	}
+
+	promote := switchoverPromoteCommand(3306, gtid, 1250*time.Millisecond)
+	for _, expected := range []string{"WAIT_FOR_EXECUTED_GTID_SET('\\''" + gtid + "'\\'', 1.250)", switchoverCatchupTimeout, "exit 75", "RESET REPLICA ALL FOR CHANNEL", "offline_mode=OFF", switchoverPromotedMarker} {
+		if !strings.Contains(promote, expected) {
+			t.Fatalf("promote command missing %q:\n%s", expected, promote)
+		}
+	}
+
+	primary := rebuildTestNode("db-3", "10.0.0.3", "8.0.36", "1-100", false, "")
+	replica := rebuildTestNode("db-2", "10.0.0.2", "8.0.36", "1-100", true, "10.0.0.1")
+	replica.delay = 600
+	attach := switchoverAttachCommand(replica, primary, "mha", "secret", taskusecase.ReplicationTLS{})
+	for _, expected := range []string{"SOURCE_HOST='\\''10.0.0.3'\\''", "SOURCE_DELAY=600", "SOURCE_AUTO_POSITION=1", "PERSIST", "offline_mode=OFF"} {
+		if !strings.Contains(attach, expected) {
+			t.Fatalf("attach command missing %q:\n%s", expected, attach)
+		}
+	}
+	reclaim := switchoverReclaimCommand(replica, primary, "mha", "secret", taskusecase.ReplicationTLS{}, gtid)
+	if !strings.Contains(reclaim, "WAIT_FOR_EXECUTED_GTID_SET") || !strings.Contains(reclaim, "RESET REPLICA ALL FOR CHANNEL") || strings.Contains(reclaim, "SOURCE_DELAY=600") {
+		t.Fatalf("reclaim must catch up without delay and detach:\n%s", reclaim)
+	}
+}
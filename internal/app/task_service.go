@@ -171,6 +171,9 @@ type ClusterMySQLInstallRequest struct {
 	MemoryAllocator   string
 	RuntimeParameters map[string]string
 	Accounts          []taskdomain.MySQLAccountSpec
+	// EnableTLS 为每个实例签发 Manager CA 证书；RequireSecureTransport 依赖它。
+	EnableTLS              bool
+	RequireSecureTransport bool
 }
 
 // ClusterMySQLInstallItem 是集群 MySQL 安装的单台机器结果。
@@ -342,6 +345,18 @@ func (s *TaskService) FinalizeBatchTrackingTask(ctx context.Context, parentTaskI
 	return s.syncParentTask(ctx, task.ID)
 }
 
+// AppendBatchTrackingEvent records a Manager-side progress line on a tracking
+// task, so per-target outcomes are visible in the task center.
+func (s *TaskService) AppendBatchTrackingEvent(ctx context.Context, taskID, content string, failed bool) error {
+	eventType := taskdomain.EventInfo
+	if failed {
+		eventType = taskdomain.EventError
+	}
+	now := time.Now().UTC()
+	taskID = strings.TrimSpace(taskID)
+	return s.repo.AppendEvent(ctx, taskdomain.Event{ID: fmt.Sprintf("%s-event-%d", taskID, now.UnixNano()), TaskID: taskID, StepID: taskID + "-children", EventType: eventType, Content: content, CreatedAt: now})
+}
+
 // AttachChildTasks establishes the only supported parent-child relation.
 func (s *TaskService) AttachChildTasks(ctx context.Context, parentTaskID string, childTaskIDs []string) error {
 	repo, ok := s.repo.(taskHierarchyRepository)
@@ -369,7 +384,7 @@ func (s *TaskService) aggregateParentTask(ctx context.Context, parent taskdomain
 	// Manager-driven workflows own their state machine and step progress. Their
 	// Agent children are displayed hierarchically, but must not complete the
 	// parent before later workflow steps have even been created.
-	if parent.Type == taskdomain.TypeArchitecture || parent.Type == taskdomain.TypeClusterBootstrap || parent.Type == taskdomain.TypeMySQLClusterUpgrade || parent.Type == taskdomain.TypeAIWorkflow {
+	if parent.Type == taskdomain.TypeArchitecture || parent.Type == taskdomain.TypeClusterBootstrap || parent.Type == taskdomain.TypeMySQLClusterUpgrade || parent.Type == taskdomain.TypeAIWorkflow || parent.Type == taskdomain.TypeClusterSpecApply {
 		return parent, children, nil
 	}
 	completed, failed, progress := 0, 0, 0
@@ -1005,6 +1020,40 @@ func (s *TaskService) CreateFlameGraphTask(ctx context.Context, machine string,
 	return s.GetTaskDetail(ctx, result.Task.ID)
 }
 
+// CreateAgentSelfUpgradeTask dispatches an Agent self-upgrade (or backup
+// restore) over the task channel. sign runs after the task ID is assigned so
+// the signature covers it.
+func (s *TaskService) CreateAgentSelfUpgradeTask(ctx context.Context, machine string, spec taskdomain.AgentSelfUpgradeSpec, sign func(*taskdomain.AgentSelfUpgradeSpec)) (TaskDetail, error) {
+	if s.createExec == nil {
+		return TaskDetail{}, errors.New("task usecase not configured")
+	}
+	displayName, stepName := "Agent 自升级到 "+spec.Version, "校验、替换并重启 Agent"
+	if spec.RestoreVersion != "" {
+		displayName, stepName = "Agent 回滚到 "+spec.RestoreVersion, "恢复备份并重启 Agent"
+	}
+	result, err := s.createExec.Execute(ctx, taskusecase.CreateExecTaskRequest{
+		Machine: machine, Command: "agent-native-self-upgrade",
+		Operation: "agent_self_upgrade", DisplayName: displayName,
+		StepName: stepName, TaskType: taskdomain.TypeAgentSelfUpgrade,
+	})
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	spec.TaskID = result.Task.ID
+	sign(&spec)
+	result.Task.SpecJSON, err = json.Marshal(spec)
+	if err != nil {
+		return TaskDetail{}, err
+	}
+	if err := s.repo.CreateTask(ctx, result.Task, result.Steps, result.Events); err != nil {
+		return TaskDetail{}, err
+	}
+	if err := s.tryDispatchPendingTask(ctx, result.Task.ID); err != nil {
+		return TaskDetail{}, err
+	}
+	return s.GetTaskDetail(ctx, result.Task.ID)
+}
+
 // RedactExecTaskCommand removes a completed one-off command from durable task
 // storage. Architecture operations use this after the Agent has consumed the
 // command because the transient command can contain database credentials.
@@ -1438,33 +1487,35 @@ func (s *TaskService) CreateClusterMySQLInstallTasks(ctx context.Context, req Cl
 		}
 		item := ClusterMySQLInstallItem{MachineID: machine.ID, Name: machine.Name, IP: machine.IP}
 		installReq := taskusecase.CreateMySQLInstallTaskRequest{
-			ParentTaskID:      parent.Task.ID,
-			Machine:           machine.IP,
-			Port:              req.Port,
-			ServerID:          serverID,
-			MySQLUser:         req.MySQLUser,
-			InstanceDir:       req.InstanceDir,
-			DataDir:           req.DataDir,
-			BinlogDir:         req.BinlogDir,
-			RedoDir:           req.RedoDir,
-			UndoDir:           req.UndoDir,
-			TmpDir:            req.TmpDir,
-			BaseDir:           req.BaseDir,
-			MyCnfPath:         req.MyCnfPath,
-			SocketPath:        req.SocketPath,
-			ErrorLog:          req.ErrorLog,
-			PIDFile:           req.PIDFile,
-			CharacterSetsDir:  req.CharacterSetsDir,
-			PluginDir:         req.PluginDir,
-			RootPassword:      req.RootPassword,
-			Profile:           req.Profile,
-			Version:           req.Version,
-			Architecture:      req.Architecture,
-			InstallPTTools:    req.InstallPTTools,
-			InstallXtraBackup: req.InstallXtraBackup,
-			MemoryAllocator:   req.MemoryAllocator,
-			RuntimeParameters: req.RuntimeParameters,
-			Accounts:          req.Accounts,
+			ParentTaskID:           parent.Task.ID,
+			Machine:                machine.IP,
+			Port:                   req.Port,
+			ServerID:               serverID,
+			MySQLUser:              req.MySQLUser,
+			InstanceDir:            req.InstanceDir,
+			DataDir:                req.DataDir,
+			BinlogDir:              req.BinlogDir,
+			RedoDir:                req.RedoDir,
+			UndoDir:                req.UndoDir,
+			TmpDir:                 req.TmpDir,
+			BaseDir:                req.BaseDir,
+			MyCnfPath:              req.MyCnfPath,
+			SocketPath:             req.SocketPath,
+			ErrorLog:               req.ErrorLog,
+			PIDFile:                req.PIDFile,
+			CharacterSetsDir:       req.CharacterSetsDir,
+			PluginDir:              req.PluginDir,
+			RootPassword:           req.RootPassword,
+			Profile:                req.Profile,
+			Version:                req.Version,
+			Architecture:           req.Architecture,
+			InstallPTTools:         req.InstallPTTools,
+			InstallXtraBackup:      req.InstallXtraBackup,
+			MemoryAllocator:        req.MemoryAllocator,
+			RuntimeParameters:      req.RuntimeParameters,
+			Accounts:               req.Accounts,
+			EnableTLS:              req.EnableTLS,
+			RequireSecureTransport: req.RequireSecureTransport,
 		}
 		detail, err := s.CreateMySQLInstallTask(ctx, installReq)
 		if err != nil {
@@ -2008,15 +2059,53 @@ func (s *TaskService) applyTerminalTaskSideEffects(ctx context.Context, task tas
 	return nil
 }
 
+// RunExecTask 创建 exec 任务并等待其结束，返回任务 ID 与最后一步的输出。
+// Agent 会把 stdout 与 stderr 合并为同一条步骤消息，因此输出是两者的合并内容。
+// 任务结束后命令文本会被脱敏，避免内联的凭据留在任务记录中；任务失败时返回
+// 带输出的错误。
+func (s *TaskService) RunExecTask(ctx context.Context, machineIP, command string, opts ExecTaskOptions, timeout time.Duration) (string, string, error) {
+	return s.runExecTaskEvery(ctx, machineIP, command, opts, timeout, time.Second)
+}
+
+func (s *TaskService) runExecTaskEvery(ctx context.Context, machineIP, command string, opts ExecTaskOptions, timeout, interval time.Duration) (string, string, error) {
+	detail, err := s.CreateExecTaskWithOptions(ctx, machineIP, command, opts)
+	if err != nil {
+		return "", "", err
+	}
+	taskID := detail.Task.ID
+	defer func() { _ = s.RedactExecTaskCommand(context.Background(), taskID) }()
+	completed, err := s.waitForTaskEvery(ctx, taskID, timeout, interval)
+	if err != nil {
+		return taskID, "", err
+	}
+	output := ""
+	if len(completed.Steps) > 0 {
+		output = completed.Steps[len(completed.Steps)-1].Message
+	}
+	if completed.Task.Status != taskdomain.StatusSuccess {
+		if message := strings.TrimSpace(output); message != "" {
+			return taskID, output, fmt.Errorf("agent task %s failed: %s", taskID, message)
+		}
+		return taskID, output, fmt.Errorf("agent task %s failed", taskID)
+	}
+	return taskID, output, nil
+}
+
 // WaitForTask 等待任务完成（成功或失败），支持超时。
 func (s *TaskService) WaitForTask(ctx context.Context, taskID string, timeout time.Duration) (TaskDetail, error) {
+	return s.waitForTaskEvery(ctx, taskID, timeout, time.Second)
+}
+
+// waitForTaskEvery polls at the given interval; latency-sensitive workflows
+// such as planned switchover use a short interval on their critical path.
+func (s *TaskService) waitForTaskEvery(ctx context.Context, taskID string, timeout, interval time.Duration) (TaskDetail, error) {
 	waitCtx := ctx
 	var cancel context.CancelFunc
 	if timeout > 0 {
 		waitCtx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
-	ticker := time.NewTicker(1 * time.Second)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
 		item, err := s.GetTaskDetail(waitCtx, taskID)
@@ -2420,7 +2509,7 @@ func taskForDisplay(task taskdomain.Task) taskdomain.Task {
 			return task
 		}
 		display = spec
-	case taskdomain.TypeBatchOperation, taskdomain.TypeClusterBootstrap, taskdomain.TypeArchitecture, taskdomain.TypeMySQLClusterUpgrade, taskdomain.TypeAIWorkflow:
+	case taskdomain.TypeBatchOperation, taskdomain.TypeClusterBootstrap, taskdomain.TypeArchitecture, taskdomain.TypeMySQLClusterUpgrade, taskdomain.TypeAIWorkflow, taskdomain.TypeClusterSpecApply:
 		var spec map[string]any
 		if json.Unmarshal(task.SpecJSON, &spec) != nil {
 			task.SpecJSON = json.RawMessage(`{}`)
@@ -3,7 +3,7 @@ set -Eeuo pipefail
 
 FULL_DIR=""; INCREMENTAL_DIRS=(); DATA_DIR=""; MYSQL_OS_USER="mysql"; SYSTEMD_UNIT=""; XTRABACKUP_BIN="xtrabackup"
 RECOVERY_MODE="physical"; RESTORE_TIME=""; BINLOG_DIR=""; PORT="3306"; SOCKET=""; DB_USER="root"; DB_PASSWORD_B64=""; REPAIR_REPLICATION="false"
-DEFAULTS_FILE=""; INSTANCE_BINLOG_DIR=""; REDO_DIR=""; UNDO_DIR=""
+DEFAULTS_FILE=""; INSTANCE_BINLOG_DIR=""; REDO_DIR=""; UNDO_DIR=""; SKIP_REPLICA_START="false"
 while [[ $# -gt 0 ]]; do
   case "$1" in
     --full-dir) FULL_DIR="$2"; shift 2;;
@@ -24,6 +24,7 @@ while [[ $# -gt 0 ]]; do
     --mysql-os-user) MYSQL_OS_USER="$2"; shift 2;;
     --systemd-unit) SYSTEMD_UNIT="$2"; shift 2;;
     --xtrabackup) XTRABACKUP_BIN="$2"; shift 2;;
+    --skip-replica-start) SKIP_REPLICA_START="$2"; shift 2;;
     *) echo "[gmha-restore][ERROR] unknown argument: $1" >&2; exit 2;;
   esac
 done
@@ -172,7 +173,15 @@ copy_args=()
 copy_args+=(--copy-back "--target-dir=$STAGING" "--datadir=$DATA_DIR")
 "$XTRABACKUP_BIN" "${copy_args[@]}"
 for path in "${MANAGED_DIRS[@]}"; do chown -R "$MYSQL_OS_USER:$MYSQL_OS_USER" "$path"; done
+# A copy streamed from another replica carries that replica's connection
+# metadata. Replica rebuilds re-point replication themselves, so keep the
+# threads down for the first start instead of replaying from stale positions.
+SKIP_START_ADDED="false"
+if [[ "$SKIP_REPLICA_START" == "true" && -f "$DEFAULTS_FILE" ]] && ! grep -Eq '^[[:space:]]*skip[-_](slave|replica)[-_]start' "$DEFAULTS_FILE"; then
+  sed -i '/^\[mysqld\]/a skip_slave_start=1' "$DEFAULTS_FILE"; SKIP_START_ADDED="true"
+fi
 systemctl start "$SYSTEMD_UNIT"
+if [[ "$SKIP_START_ADDED" == "true" ]]; then sed -i '/^skip_slave_start=1$/d' "$DEFAULTS_FILE"; fi
 
 MYSQL_PWD="$(printf '%s' "$DB_PASSWORD_B64" | base64 -d)"
 AUTH_FILE="$(mktemp "/tmp/gmha-restore-auth-${PORT}.XXXXXX.cnf")"; chmod 600 "$AUTH_FILE"
@@ -203,7 +212,9 @@ if [[ "$RECOVERY_MODE" == "point_in_time" ]]; then
   echo "[gmha-restore][SUCCESS] point-in-time binlog replay completed"
 fi
 
-mysql "${mysql_args[@]}" -e 'START REPLICA' >/dev/null 2>&1 || mysql "${mysql_args[@]}" -e 'START SLAVE' >/dev/null 2>&1 || true
+if [[ "$SKIP_REPLICA_START" != "true" ]]; then
+  mysql "${mysql_args[@]}" -e 'START REPLICA' >/dev/null 2>&1 || mysql "${mysql_args[@]}" -e 'START SLAVE' >/dev/null 2>&1 || true
+fi
 if [[ "$REPAIR_REPLICATION" == "true" ]]; then
   command -v pt-table-sync >/dev/null 2>&1 || { echo "[gmha-restore][ERROR] pt-table-sync is required for replication repair" >&2; exit 127; }
   echo "[gmha-restore][WARN] running pt-table-sync --sync-to-master to repair replica consistency"
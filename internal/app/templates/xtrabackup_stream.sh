@@ -0,0 +1,80 @@
+#!/usr/bin/env bash
+set -Eeuo pipefail
+
+# Streams a physical copy of a donor instance straight into a receiver
+# directory on the replica being rebuilt. The receiver is started first and
+# accepts exactly one connection; the result is laid out like a GMHA full
+# backup so xtrabackup_restore.sh can prepare and install it.
+MODE=""; LISTEN_PORT=""; TARGET_DIR=""; TARGET_HOST=""; TARGET_PORT=""; TIMEOUT="21600"
+PORT="3306"; SOCKET=""; DEFAULTS_FILE=""; CREDENTIALS_FILE=""; MYSQL_VERSION=""; XTRABACKUP_BIN="xtrabackup"
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --mode) MODE="$2"; shift 2;;
+    --listen-port) LISTEN_PORT="$2"; shift 2;;
+    --target-dir) TARGET_DIR="$2"; shift 2;;
+    --target-host) TARGET_HOST="$2"; shift 2;;
+    --target-port) TARGET_PORT="$2"; shift 2;;
+    --timeout) TIMEOUT="$2"; shift 2;;
+    --port) PORT="$2"; shift 2;;
+    --socket) SOCKET="$2"; shift 2;;
+    --defaults-file) DEFAULTS_FILE="$2"; shift 2;;
+    --credentials-file) CREDENTIALS_FILE="$2"; shift 2;;
+    --mysql-version) MYSQL_VERSION="$2"; shift 2;;
+    --xtrabackup) XTRABACKUP_BIN="$2"; shift 2;;
+    *) echo "[gmha-stream][ERROR] unknown argument: $1" >&2; exit 2;;
+  esac
+done
+
+receive_from_network() {
+  if command -v socat >/dev/null 2>&1; then timeout "$TIMEOUT" socat -u "TCP-LISTEN:${LISTEN_PORT},reuseaddr" STDOUT
+  elif command -v ncat >/dev/null 2>&1; then timeout "$TIMEOUT" ncat -l "$LISTEN_PORT" --recv-only
+  elif command -v nc >/dev/null 2>&1; then timeout "$TIMEOUT" nc -l "$LISTEN_PORT" 2>/dev/null || timeout "$TIMEOUT" nc -l -p "$LISTEN_PORT"
+  else echo "[gmha-stream][ERROR] socat, ncat or nc is required on the receiver" >&2; return 127; fi
+}
+
+send_to_network() {
+  if command -v socat >/dev/null 2>&1; then socat -u STDIN "TCP:${TARGET_HOST}:${TARGET_PORT},retry=12,interval=5"
+  elif command -v ncat >/dev/null 2>&1; then ncat --send-only "$TARGET_HOST" "$TARGET_PORT"
+  elif command -v nc >/dev/null 2>&1; then nc -N "$TARGET_HOST" "$TARGET_PORT" 2>/dev/null || nc -q 0 "$TARGET_HOST" "$TARGET_PORT"
+  else echo "[gmha-stream][ERROR] socat, ncat or nc is required on the donor" >&2; return 127; fi
+}
+
+case "$MODE" in
+  receive)
+    [[ "$LISTEN_PORT" =~ ^[0-9]+$ ]] || { echo "[gmha-stream][ERROR] --listen-port is required" >&2; exit 2; }
+    [[ -n "$TARGET_DIR" && "$TARGET_DIR" = /* && "$TARGET_DIR" != "/" ]] || { echo "[gmha-stream][ERROR] safe absolute --target-dir is required" >&2; exit 2; }
+    command -v xbstream >/dev/null 2>&1 || { echo "[gmha-stream][ERROR] xbstream is not installed" >&2; exit 127; }
+    rm -rf "$TARGET_DIR"; mkdir -p "$TARGET_DIR"
+    trap 'rc=$?; [[ $rc -eq 0 ]] || rm -rf "$TARGET_DIR"; exit $rc' EXIT
+    echo "[gmha-stream][INFO] listening on port ${LISTEN_PORT}, extracting into ${TARGET_DIR}"
+    receive_from_network | xbstream -x -C "$TARGET_DIR"
+    [[ -f "$TARGET_DIR/xtrabackup_checkpoints" ]] || { echo "[gmha-stream][ERROR] stream ended without xtrabackup_checkpoints; donor backup failed" >&2; exit 1; }
+    # The donor's server UUID must not be inherited, or both servers would
+    # claim the same GTID source.
+    rm -f "$TARGET_DIR/auto.cnf"
+    series="$(printf '%s' "$MYSQL_VERSION" | awk -F. '{print $1"."$2}')"
+    [[ "$series" == "5.7" ]] && series="2.4"
+    printf 'created_at=%s\nbackup_type=full\nmysql_version=%s\nxtrabackup_series=%s\n' "$(date -u +%FT%TZ)" "$MYSQL_VERSION" "$series" > "$TARGET_DIR/gmha-backup.meta"
+    touch "$TARGET_DIR/.gmha-backup-complete"
+    echo "[gmha-stream][SUCCESS] received $(du -sh "$TARGET_DIR" | awk '{print $1}') from donor"
+    ;;
+  send)
+    [[ -n "$TARGET_HOST" && "$TARGET_PORT" =~ ^[0-9]+$ ]] || { echo "[gmha-stream][ERROR] --target-host and --target-port are required" >&2; exit 2; }
+    [[ -f "$CREDENTIALS_FILE" ]] || { echo "[gmha-stream][ERROR] MySQL credentials file is missing" >&2; exit 2; }
+    command -v "$XTRABACKUP_BIN" >/dev/null 2>&1 || { echo "[gmha-stream][ERROR] xtrabackup is not installed: $XTRABACKUP_BIN" >&2; exit 127; }
+    AUTH_FILE="$(mktemp "/tmp/gmha-stream-auth-${PORT}.XXXXXX.cnf")"; chmod 600 "$AUTH_FILE"
+    STAGING="$(mktemp -d "/tmp/gmha-stream-${PORT}.XXXXXX")"
+    trap 'rm -rf "$AUTH_FILE" "$STAGING"' EXIT
+    {
+      [[ -n "$DEFAULTS_FILE" ]] && printf '!include %s\n' "$DEFAULTS_FILE"
+      printf '!include %s\n' "$CREDENTIALS_FILE"
+    } > "$AUTH_FILE"
+    xb_args=("--defaults-file=$AUTH_FILE" --backup --stream=xbstream "--target-dir=$STAGING" "--port=$PORT")
+    [[ -n "$SOCKET" ]] && xb_args+=("--socket=$SOCKET")
+    echo "[gmha-stream][INFO] streaming donor port ${PORT} to ${TARGET_HOST}:${TARGET_PORT}"
+    "$XTRABACKUP_BIN" "${xb_args[@]}" | send_to_network
+    echo "[gmha-stream][SUCCESS] donor stream completed"
+    ;;
+  *)
+    echo "[gmha-stream][ERROR] --mode must be send or receive" >&2; exit 2;;
+esac
@@ -0,0 +1,469 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	hbdomain "gmha/internal/domain/heartbeat"
+	machinedomain "gmha/internal/domain/machine"
+)
+
+const (
+	defaultAgentUpgradeBatchSize = 5
+	defaultAgentUpgradeSoak      = 60
+	maxAgentUpgradeSoak          = 3600
+)
+
+// Target states of a batched Agent upgrade.
+const (
+	UpgradeTargetPending        = "pending"
+	UpgradeTargetUpgrading      = "upgrading"
+	UpgradeTargetSoaking        = "soaking"
+	UpgradeTargetHealthy        = "healthy"
+	UpgradeTargetFailed         = "failed"
+	UpgradeTargetRolledBack     = "rolled_back"
+	UpgradeTargetRollbackFailed = "rollback_failed"
+)
+
+// ErrUpgradeJobNotFound is returned when a job id does not exist.
+var ErrUpgradeJobNotFound = errors.New("升级任务不存在")
+
+// AgentUpgradePlan 描述 Agent 分批升级的节奏：先升级 CanarySize 台金丝雀，
+// 其后每批 BatchSize 台；每批替换完成后浸泡 SoakSeconds 秒再检查健康门禁。
+type AgentUpgradePlan struct {
+	CanarySize   int  `json:"canary_size"`
+	BatchSize    int  `json:"batch_size"`
+	SoakSeconds  int  `json:"soak_seconds"`
+	AutoRollback bool `json:"auto_rollback"`
+}
+
+// UpgradeTarget 记录单台 Agent 在分批升级中的进度。
+type UpgradeTarget struct {
+	IP          string    `json:"ip"`
+	MachineID   string    `json:"machine_id,omitempty"`
+	FromVersion string    `json:"from_version,omitempty"`
+	Batch       int       `json:"batch"`
+	Channel     string    `json:"channel,omitempty"`
+	Status      string    `json:"status"`
+	Message     string    `json:"message,omitempty"`
+	UpgradedAt  time.Time `json:"upgraded_at,omitempty"`
+}
+
+// upgradeAgentFleet is the part of AgentService the upgrade runner needs.
+type upgradeAgentFleet interface {
+	ListViews(ctx context.Context) ([]AgentView, error)
+	GetViewByIP(ctx context.Context, ip string) (AgentView, bool, error)
+	HeartbeatByIP(ctx context.Context, ip string) (HeartbeatView, bool, error)
+	UpgradeByIPPackage(ctx context.Context, ip string, pkg PackageItem, binary []byte) (string, error)
+	RollbackByIP(ctx context.Context, ip, version string) error
+	resolveMachineByIP(ctx context.Context, ip string) (machinedomain.Machine, bool, error)
+	detectRemotePlatform(ctx context.Context, machine machinedomain.Machine) (string, string, error)
+	selfUpgradeReady(machineID string) bool
+}
+
+// DefaultAgentUpgradePlan is one canary, then batches of five with a one
+// minute soak and automatic rollback.
+func DefaultAgentUpgradePlan() AgentUpgradePlan {
+	return AgentUpgradePlan{CanarySize: 1, BatchSize: defaultAgentUpgradeBatchSize, SoakSeconds: defaultAgentUpgradeSoak, AutoRollback: true}
+}
+
+func normalizeAgentUpgradePlan(plan AgentUpgradePlan) (AgentUpgradePlan, error) {
+	if plan.CanarySize < 0 || plan.BatchSize < 0 || plan.SoakSeconds < 0 {
+		return plan, errors.New("金丝雀数量、批次大小和浸泡时间不能为负数")
+	}
+	if plan.SoakSeconds > maxAgentUpgradeSoak {
+		return plan, fmt.Errorf("浸泡时间不能超过 %d 秒", maxAgentUpgradeSoak)
+	}
+	if plan.CanarySize == 0 {
+		plan.CanarySize = 1
+	}
+	if plan.BatchSize == 0 {
+		plan.BatchSize = defaultAgentUpgradeBatchSize
+	}
+	return plan, nil
+}
+
+func uniqueUpgradeTargets(targets []string) []string {
+	seen := make(map[string]bool, len(targets))
+	out := make([]string, 0, len(targets))
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target != "" && !seen[target] {
+			seen[target] = true
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// agentUpgradeBatches splits the targets into the canary batch followed by
+// batches of plan.BatchSize, returning the batch number of every target.
+func agentUpgradeBatches(count int, plan AgentUpgradePlan) ([]int, int) {
+	batches := make([]int, count)
+	batch, filled, size := 1, 0, plan.CanarySize
+	for i := range batches {
+		if filled == size {
+			batch, filled, size = batch+1, 0, plan.BatchSize
+		}
+		batches[i] = batch
+		filled++
+	}
+	if count == 0 {
+		return batches, 0
+	}
+	return batches, batch
+}
+
+func (s *UpgradeService) attachAgentPlan(id string, plan AgentUpgradePlan) UpgradeJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	batches, total := agentUpgradeBatches(len(job.Targets), plan)
+	job.Plan, job.Batches = &plan, total
+	job.TargetStates = make([]UpgradeTarget, len(job.Targets))
+	for i, ip := range job.Targets {
+		job.TargetStates[i] = UpgradeTarget{IP: ip, Batch: batches[i], Status: UpgradeTargetPending}
+	}
+	s.jobs[id] = job
+	_ = s.saveLocked()
+	return job
+}
+
+// PauseAgentUpgrade asks a running Agent upgrade to stop after the current
+// batch passes its health gates. Targets already upgraded stay upgraded.
+func (s *UpgradeService) PauseAgentUpgrade(id string) (UpgradeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return UpgradeJob{}, ErrUpgradeJobNotFound
+	}
+	if job.Plan == nil || (job.Status != "pending" && job.Status != "running") {
+		return UpgradeJob{}, fmt.Errorf("任务状态 %s 不允许暂停", job.Status)
+	}
+	job.PauseRequested, job.UpdatedAt = true, time.Now().UTC()
+	s.jobs[id] = job
+	_ = s.saveLocked()
+	return job, nil
+}
+
+// ResumeAgentUpgrade continues a paused Agent upgrade with the next batch, or
+// withdraws a pause request that has not taken effect yet.
+func (s *UpgradeService) ResumeAgentUpgrade(id string) (UpgradeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return UpgradeJob{}, ErrUpgradeJobNotFound
+	}
+	if job.Plan == nil || (job.Status != "paused" && !job.PauseRequested) {
+		return UpgradeJob{}, fmt.Errorf("任务状态 %s 不允许继续", job.Status)
+	}
+	job.PauseRequested, job.UpdatedAt = false, time.Now().UTC()
+	if job.Status == "paused" {
+		job.Status = "running"
+		if resume, ok := s.resumes[id]; ok {
+			close(resume)
+			delete(s.resumes, id)
+		}
+	}
+	s.jobs[id] = job
+	_ = s.saveLocked()
+	return job, nil
+}
+
+// waitIfPaused parks the runner between batches while a pause is requested.
+func (s *UpgradeService) waitIfPaused(id string, nextBatch int) {
+	s.mu.Lock()
+	job := s.jobs[id]
+	if !job.PauseRequested {
+		s.mu.Unlock()
+		return
+	}
+	if s.resumes == nil {
+		s.resumes = make(map[string]chan struct{})
+	}
+	resume := make(chan struct{})
+	s.resumes[id] = resume
+	job.Status, job.UpdatedAt = "paused", time.Now().UTC()
+	job.Steps[2].Message = fmt.Sprintf("已暂停，继续后从第 %d/%d 批开始", nextBatch, job.Batches)
+	s.jobs[id] = job
+	_ = s.saveLocked()
+	s.mu.Unlock()
+	<-resume
+}
+
+func (s *UpgradeService) updateTarget(id string, index int, update func(*UpgradeTarget)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	if index < 0 || index >= len(job.TargetStates) {
+		return
+	}
+	// Copy on write: jobs handed out by Get share the slice.
+	job.TargetStates = append([]UpgradeTarget(nil), job.TargetStates...)
+	update(&job.TargetStates[index])
+	job.UpdatedAt = time.Now().UTC()
+	s.jobs[id] = job
+	_ = s.saveLocked()
+}
+
+func (s *UpgradeService) setBatch(id string, batch int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	job.CurrentBatch, job.UpdatedAt = batch, time.Now().UTC()
+	s.jobs[id] = job
+	_ = s.saveLocked()
+}
+
+func (s *UpgradeService) runAgent(id string, pkg PackageItem, binary []byte) {
+	version, packageArch := pkg.Version, pkg.Arch
+	ctx := context.Background()
+	s.step(id, 0, "running", "检查目标在线状态、升级通道与当前版本")
+	job, _ := s.Get(id)
+	for index, ip := range job.Targets {
+		view, ok, err := s.agents.GetViewByIP(ctx, ip)
+		if err != nil || !ok || (strings.ToLower(view.HeartbeatState) != "online" && strings.ToLower(view.InstallState) != "online") {
+			s.fail(id, 0, fmt.Errorf("%s 升级前检查失败：Agent 不在线", ip))
+			return
+		}
+		machine, found, err := s.agents.resolveMachineByIP(ctx, ip)
+		if err != nil || !found {
+			s.fail(id, 0, fmt.Errorf("%s 升级前检查失败：机器不存在", ip))
+			return
+		}
+		// Agents that upgrade themselves check the package architecture on
+		// the host, so SSH is only needed for the fallback path.
+		if !s.agents.selfUpgradeReady(machine.ID) {
+			_, targetArch, err := s.agents.detectRemotePlatform(ctx, machine)
+			if err != nil || (packageArch != "未识别" && normalizeComponentArch(targetArch) != normalizeComponentArch(packageArch)) {
+				s.fail(id, 0, fmt.Errorf("%s 架构不兼容：目标 %s，安装包 %s", ip, targetArch, packageArch))
+				return
+			}
+		}
+		s.updateTarget(id, index, func(target *UpgradeTarget) { target.MachineID, target.FromVersion = machine.ID, view.Version })
+	}
+	s.step(id, 0, "success", "目标 Agent 均在线，当前版本已记录")
+	s.step(id, 1, "success", fmt.Sprintf("安装包已读取，目标版本 %s", version))
+
+	job, _ = s.Get(id)
+	plan := *job.Plan
+	for batch := 1; batch <= job.Batches; batch++ {
+		if batch > 1 {
+			s.waitIfPaused(id, batch)
+		}
+		s.setBatch(id, batch)
+		label := fmt.Sprintf("第 %d/%d 批", batch, job.Batches)
+		if batch == 1 {
+			label = fmt.Sprintf("金丝雀批次（%d/%d）", batch, job.Batches)
+		}
+		indexes := make([]int, 0)
+		for index, target := range job.TargetStates {
+			if target.Batch == batch {
+				indexes = append(indexes, index)
+			}
+		}
+		// The baseline is taken right before the batch is touched, so checks
+		// that were already degraded do not block the gate.
+		baselines := make(map[int]HeartbeatView, len(indexes))
+		for _, index := range indexes {
+			if view, ok, err := s.agents.HeartbeatByIP(ctx, job.Targets[index]); err == nil && ok {
+				baselines[index] = view
+			}
+		}
+		s.step(id, 2, "running", label+"：备份并替换 Agent 二进制")
+		var problem error
+		failedStep := 2
+		for _, index := range indexes {
+			ip := job.Targets[index]
+			s.updateTarget(id, index, func(target *UpgradeTarget) { target.Status = UpgradeTargetUpgrading })
+			channel, err := s.agents.UpgradeByIPPackage(ctx, ip, pkg, binary)
+			s.updateTarget(id, index, func(target *UpgradeTarget) { target.Channel = channel })
+			if err != nil {
+				// The SSH usecase restores its own backup when the new binary
+				// fails to start. A task-channel Agent swaps the binary and
+				// reports success before restarting, so when it never comes
+				// back on the new version the target counts as upgraded and
+				// is rolled back with the rest of the batch.
+				upgradedAt := time.Time{}
+				if errors.Is(err, ErrAgentUpgradeUnconfirmed) {
+					upgradedAt = time.Now().UTC()
+				}
+				s.updateTarget(id, index, func(target *UpgradeTarget) {
+					target.Status, target.Message, target.UpgradedAt = UpgradeTargetFailed, err.Error(), upgradedAt
+				})
+				problem = fmt.Errorf("%s: %w", ip, err)
+				break
+			}
+			upgradedAt := time.Now().UTC()
+			s.updateTarget(id, index, func(target *UpgradeTarget) { target.Status, target.UpgradedAt = UpgradeTargetSoaking, upgradedAt })
+		}
+		if problem == nil {
+			failedStep = 3
+			s.step(id, 3, "running", fmt.Sprintf("%s：浸泡 %d 秒后检查健康门禁", label, plan.SoakSeconds))
+			time.Sleep(time.Duration(plan.SoakSeconds) * time.Second)
+			current, _ := s.Get(id)
+			var failures []string
+			for _, index := range indexes {
+				view, ok, err := s.agents.HeartbeatByIP(ctx, job.Targets[index])
+				if err != nil {
+					ok = false
+				}
+				baseline, hasBaseline := baselines[index]
+				problems := agentUpgradeGate(baseline, hasBaseline, view, ok, current.TargetStates[index].UpgradedAt, version)
+				if len(problems) > 0 {
+					message := strings.Join(problems, "；")
+					s.updateTarget(id, index, func(target *UpgradeTarget) { target.Status, target.Message = UpgradeTargetFailed, message })
+					failures = append(failures, job.Targets[index]+" "+message)
+					continue
+				}
+				s.updateTarget(id, index, func(target *UpgradeTarget) { target.Status, target.Message = UpgradeTargetHealthy, "" })
+			}
+			if len(failures) > 0 {
+				problem = fmt.Errorf("健康门禁未通过：%s", strings.Join(failures, "；"))
+			}
+		}
+		if problem != nil {
+			s.failAgentBatch(id, failedStep, label, indexes, plan.AutoRollback, problem)
+			return
+		}
+		s.step(id, 3, "success", label+" 健康门禁通过")
+	}
+	s.step(id, 2, "success", fmt.Sprintf("%d 台 Agent 已分 %d 批完成替换", len(job.Targets), job.Batches))
+	s.step(id, 4, "running", "核对全部目标的心跳与上报版本")
+	for _, ip := range job.Targets {
+		view, ok, err := s.agents.GetViewByIP(ctx, ip)
+		if err != nil || !ok || !sameComponentVersion(view.Version, version) {
+			s.fail(id, 4, fmt.Errorf("%s 版本后检失败：上报 %s，期望 %s", ip, view.Version, version))
+			return
+		}
+	}
+	s.step(id, 4, "success", "所有 Agent 心跳在线且版本匹配")
+	s.complete(id)
+}
+
+// failAgentBatch rolls back the targets of the failed batch that received the
+// new binary and marks the job failed. Earlier batches passed their gates and
+// keep the new version.
+func (s *UpgradeService) failAgentBatch(id string, stepIndex int, label string, indexes []int, rollback bool, cause error) {
+	job, _ := s.Get(id)
+	if !rollback {
+		s.fail(id, stepIndex, fmt.Errorf("%s 失败，未启用自动回滚：%w", label, cause))
+		return
+	}
+	s.step(id, stepIndex, "running", label+" 失败，正在回滚本批次")
+	var rollbackErrors []string
+	rolledBack := 0
+	for _, index := range indexes {
+		target := job.TargetStates[index]
+		if target.UpgradedAt.IsZero() {
+			continue
+		}
+		if err := s.agents.RollbackByIP(context.Background(), target.IP, target.FromVersion); err != nil {
+			rollbackErrors = append(rollbackErrors, fmt.Sprintf("%s: %v", target.IP, err))
+			s.updateTarget(id, index, func(item *UpgradeTarget) {
+				item.Status, item.Message = UpgradeTargetRollbackFailed, strings.TrimSpace(item.Message+"；回滚失败："+err.Error())
+			})
+			continue
+		}
+		rolledBack++
+		s.updateTarget(id, index, func(item *UpgradeTarget) {
+			item.Status = UpgradeTargetRolledBack
+			item.Message = strings.TrimPrefix(item.Message+"；已回滚到 "+item.FromVersion, "；")
+		})
+	}
+	if len(rollbackErrors) > 0 {
+		s.fail(id, stepIndex, fmt.Errorf("%s 失败：%w；回滚失败：%s", label, cause, strings.Join(rollbackErrors, "；")))
+		return
+	}
+	s.fail(id, stepIndex, fmt.Errorf("%s 失败，已回滚本批次 %d 台：%w", label, rolledBack, cause))
+}
+
+// agentUpgradeGate checks one upgraded Agent against its pre-upgrade heartbeat:
+// a heartbeat newer than the upgrade, the target version, no health check that
+// turned WARN/FAIL and no collector that stopped reporting successfully.
+func agentUpgradeGate(baseline HeartbeatView, hasBaseline bool, current HeartbeatView, ok bool, upgradedAt time.Time, version string) []string {
+	if !ok {
+		return []string{"没有心跳"}
+	}
+	var problems []string
+	if current.LastHeartbeatAt.Before(upgradedAt) {
+		problems = append(problems, "升级后没有新鲜心跳")
+	}
+	if current.CurrentState == hbdomain.StateOffline || current.CurrentState == hbdomain.StateSuspect {
+		problems = append(problems, "心跳状态 "+string(current.CurrentState))
+	}
+	if !sameComponentVersion(current.Version, version) {
+		problems = append(problems, fmt.Sprintf("上报版本 %s，期望 %s", current.Version, version))
+	}
+	if !hasBaseline {
+		return problems
+	}
+	if agentHealthRank(current.OverallHealth) > agentHealthRank(baseline.OverallHealth) {
+		problems = append(problems, fmt.Sprintf("整体健康从 %s 变为 %s", baseline.OverallHealth, current.OverallHealth))
+	}
+	before := make(map[string]hbdomain.CheckStatus, len(baseline.Checks))
+	for _, check := range baseline.Checks {
+		before[check.Name] = check.Status
+	}
+	for _, check := range current.Checks {
+		if check.Status != hbdomain.CheckWarn && check.Status != hbdomain.CheckFail {
+			continue
+		}
+		if previous := before[check.Name]; previous != check.Status && previous != hbdomain.CheckFail {
+			problems = append(problems, fmt.Sprintf("新增异常检查 %s=%s", check.Name, check.Status))
+		}
+	}
+	reporting := make(map[string]bool, len(current.Metrics))
+	for _, metric := range current.Metrics {
+		reporting[metric.Name] = metric.Success
+	}
+	for _, metric := range baseline.Metrics {
+		if metric.Success && !reporting[metric.Name] {
+			problems = append(problems, "采集项停止上报 "+metric.Name)
+		}
+	}
+	return problems
+}
+
+func agentHealthRank(level hbdomain.HealthLevel) int {
+	switch level {
+	case hbdomain.HealthDegraded:
+		return 1
+	case hbdomain.HealthUnhealthy:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func sameComponentVersion(left, right string) bool {
+	if comparison, ok := compareComponentVersions(left, right); ok {
+		return comparison == 0
+	}
+	return strings.EqualFold(strings.TrimSpace(left), strings.TrimSpace(right))
+}
+
+// reconcileAgentJobs fails Agent jobs interrupted by a Manager restart: the
+// runner and the package bytes lived in the old process.
+func (s *UpgradeService) reconcileAgentJobs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for id, job := range s.jobs {
+		if job.Component != "agent" || (job.Status != "pending" && job.Status != "running" && job.Status != "paused") {
+			continue
+		}
+		job.Status, job.PauseRequested, job.UpdatedAt = "failed", false, time.Now().UTC()
+		job.Error = "Manager 重启导致 Agent 升级任务中断，已通过门禁的批次保持新版本，请核对目标状态后重新发起"
+		s.jobs[id] = job
+		changed = true
+	}
+	if changed {
+		_ = s.saveLocked()
+	}
+}
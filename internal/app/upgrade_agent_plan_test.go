@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	dynamicdomain "gmha/internal/domain/dynamic"
+	hbdomain "gmha/internal/domain/heartbeat"
+	machinedomain "gmha/internal/domain/machine"
+)
+
+type upgradeFleetFake struct {
+	mu       sync.Mutex
+	versions map[string]string
+	degrade  map[string]bool
+	// unconfirmed Agents accept the task-channel swap but never heartbeat
+	// again on the new version.
+	unconfirmed map[string]bool
+	upgraded    []string
+	rolled      []string
+	heartbeat   map[string]time.Time
+}
+
+func newUpgradeFleetFake(ips ...string) *upgradeFleetFake {
+	fleet := &upgradeFleetFake{versions: map[string]string{}, degrade: map[string]bool{}, unconfirmed: map[string]bool{}, heartbeat: map[string]time.Time{}}
+	for _, ip := range ips {
+		fleet.versions[ip] = "V1.0.0"
+		fleet.heartbeat[ip] = time.Now().UTC()
+	}
+	return fleet
+}
+
+func (f *upgradeFleetFake) ListViews(context.Context) ([]AgentView, error) { return nil, nil }
+
+func (f *upgradeFleetFake) GetViewByIP(_ context.Context, ip string) (AgentView, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return AgentView{IP: ip, HeartbeatState: "ONLINE", Version: f.versions[ip]}, true, nil
+}
+
+func (f *upgradeFleetFake) HeartbeatByIP(_ context.Context, ip string) (HeartbeatView, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	view := HeartbeatView{
+		MachineID: "m-" + ip, Version: f.versions[ip], CurrentState: hbdomain.StateOnline, OverallHealth: hbdomain.HealthHealthy,
+		LastHeartbeatAt: f.heartbeat[ip],
+		Checks:          []hbdomain.HealthCheck{{Name: "mysql", Status: hbdomain.CheckOK}},
+		Metrics:         []dynamicdomain.MetricResult{{Name: "mysql_status", Success: true}},
+	}
+	if f.degrade[ip] && f.versions[ip] == "V1.1.0" {
+		view.Checks[0].Status = hbdomain.CheckFail
+	}
+	return view, true, nil
+}
+
+func (f *upgradeFleetFake) UpgradeByIPPackage(_ context.Context, ip string, pkg PackageItem, _ []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.upgraded = append(f.upgraded, ip)
+	if f.unconfirmed[ip] {
+		f.versions[ip] = "broken"
+		return AgentUpgradeChannelTask, fmt.Errorf("%w：Agent 在 1m30s 内未以新版本恢复心跳", ErrAgentUpgradeUnconfirmed)
+	}
+	f.versions[ip], f.heartbeat[ip] = pkg.Version, time.Now().UTC().Add(time.Second)
+	return AgentUpgradeChannelSSH, nil
+}
+
+func (f *upgradeFleetFake) RollbackByIP(_ context.Context, ip, version string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if version == "" {
+		return errors.New("missing version")
+	}
+	f.versions[ip] = version
+	f.rolled = append(f.rolled, ip)
+	return nil
+}
+
+func (f *upgradeFleetFake) resolveMachineByIP(_ context.Context, ip string) (machinedomain.Machine, bool, error) {
+	return machinedomain.Machine{ID: "m-" + ip, IP: ip}, true, nil
+}
+
+func (f *upgradeFleetFake) detectRemotePlatform(context.Context, machinedomain.Machine) (string, string, error) {
+	return "linux", "x86_64", nil
+}
+
+func (f *upgradeFleetFake) selfUpgradeReady(string) bool { return false }
+
+func newUpgradePlanService(t *testing.T, fleet *upgradeFleetFake, targets []string, plan AgentUpgradePlan) (*UpgradeService, UpgradeJob) {
+	t.Helper()
+	service := &UpgradeService{jobs: map[string]UpgradeJob{}, statePath: filepath.Join(t.TempDir(), "jobs.json"), agents: fleet}
+	job := service.newJob("agent", targets, PackageItem{Name: "gmha-agent-V1.1.0", Version: "V1.1.0"}, "mixed", []string{"升级前检查", "校验安装包", "金丝雀与分批替换 Agent", "批次浸泡与健康门禁", "心跳与版本后检"})
+	return service, service.attachAgentPlan(job.ID, plan)
+}
+
+func TestAgentUpgradeBatchesStartWithCanary(t *testing.T) {
+	batches, total := agentUpgradeBatches(6, AgentUpgradePlan{CanarySize: 1, BatchSize: 2})
+	if !reflect.DeepEqual(batches, []int{1, 2, 2, 3, 3, 4}) || total != 4 {
+		t.Fatalf("batches=%v total=%d", batches, total)
+	}
+	if _, err := normalizeAgentUpgradePlan(AgentUpgradePlan{SoakSeconds: maxAgentUpgradeSoak + 1}); err == nil {
+		t.Fatal("soak above the limit should be rejected")
+	}
+}
+
+func TestAgentUpgradeRollsBackFailedBatchOnly(t *testing.T) {
+	targets := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	fleet := newUpgradeFleetFake(targets...)
+	fleet.degrade["10.0.0.5"] = true
+	service, job := newUpgradePlanService(t, fleet, targets, AgentUpgradePlan{CanarySize: 1, BatchSize: 2, AutoRollback: true})
+
+	service.runAgent(job.ID, PackageItem{Name: "gmha-agent-V1.1.0", Version: "V1.1.0", Arch: "x86_64"}, []byte("agent"))
+
+	job, _ = service.Get(job.ID)
+	if job.Status != "failed" || job.CurrentBatch != 3 || job.Batches != 3 {
+		t.Fatalf("third batch should fail the job: status=%s batch=%d/%d err=%s", job.Status, job.CurrentBatch, job.Batches, job.Error)
+	}
+	if !reflect.DeepEqual(fleet.rolled, []string{"10.0.0.4", "10.0.0.5"}) {
+		t.Fatalf("only the failed batch should be rolled back, got %v", fleet.rolled)
+	}
+	want := []string{UpgradeTargetHealthy, UpgradeTargetHealthy, UpgradeTargetHealthy, UpgradeTargetRolledBack, UpgradeTargetRolledBack}
+	for i, target := range job.TargetStates {
+		if target.Status != want[i] || target.FromVersion != "V1.0.0" {
+			t.Fatalf("target %d = %+v, want status %s", i, target, want[i])
+		}
+	}
+	if fleet.versions["10.0.0.5"] != "V1.0.0" || fleet.versions["10.0.0.3"] != "V1.1.0" {
+		t.Fatalf("unexpected fleet versions %v", fleet.versions)
+	}
+}
+
+func TestAgentUpgradeRollsBackTaskChannelAgentThatNeverReturns(t *testing.T) {
+	targets := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	fleet := newUpgradeFleetFake(targets...)
+	fleet.unconfirmed["10.0.0.3"] = true
+	service, job := newUpgradePlanService(t, fleet, targets, AgentUpgradePlan{CanarySize: 1, BatchSize: 2, AutoRollback: true})
+
+	service.runAgent(job.ID, PackageItem{Name: "gmha-agent-V1.1.0", Version: "V1.1.0", Arch: "x86_64"}, []byte("agent"))
+
+	job, _ = service.Get(job.ID)
+	if job.Status != "failed" || !reflect.DeepEqual(fleet.rolled, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Fatalf("the swapped but silent Agent must be rolled back with its batch: status=%s rolled=%v", job.Status, fleet.rolled)
+	}
+	if target := job.TargetStates[2]; target.Status != UpgradeTargetRolledBack || target.Channel != AgentUpgradeChannelTask || fleet.versions["10.0.0.3"] != "V1.0.0" {
+		t.Fatalf("target = %+v, version %s", target, fleet.versions["10.0.0.3"])
+	}
+}
+
+func TestAgentUpgradePausesBetweenBatchesAndResumes(t *testing.T) {
+	targets := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	fleet := newUpgradeFleetFake(targets...)
+	service, job := newUpgradePlanService(t, fleet, targets, AgentUpgradePlan{CanarySize: 1, BatchSize: 2, AutoRollback: true})
+	if _, err := service.PauseAgentUpgrade(job.ID); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		service.runAgent(job.ID, PackageItem{Name: "gmha-agent-V1.1.0", Version: "V1.1.0", Arch: "x86_64"}, []byte("agent"))
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if current, _ := service.Get(job.ID); current.Status == "paused" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job did not pause after the canary batch")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fleet.mu.Lock()
+	upgraded := append([]string(nil), fleet.upgraded...)
+	fleet.mu.Unlock()
+	if !reflect.DeepEqual(upgraded, []string{"10.0.0.1"}) {
+		t.Fatalf("only the canary should be upgraded while paused, got %v", upgraded)
+	}
+	if _, err := service.ResumeAgentUpgrade(job.ID); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	<-done
+	job, _ = service.Get(job.ID)
+	if job.Status != "success" || len(fleet.upgraded) != 3 || job.PauseRequested {
+		t.Fatalf("job should finish after resume: %+v upgraded=%v", job, fleet.upgraded)
+	}
+}
+
+func TestAgentUpgradeGateFlagsNewDegradationAndSilentCollectors(t *testing.T) {
+	upgradedAt := time.Now().UTC()
+	baseline := HeartbeatView{
+		OverallHealth: hbdomain.HealthHealthy,
+		Checks:        []hbdomain.HealthCheck{{Name: "disk", Status: hbdomain.CheckWarn}, {Name: "mysql", Status: hbdomain.CheckOK}},
+		Metrics:       []dynamicdomain.MetricResult{{Name: "cpu", Success: true}, {Name: "binlog", Success: false}},
+	}
+	current := HeartbeatView{
+		Version: "V1.1.0", CurrentState: hbdomain.StateOnline, OverallHealth: hbdomain.HealthHealthy, LastHeartbeatAt: upgradedAt.Add(time.Second),
+		Checks:  []hbdomain.HealthCheck{{Name: "disk", Status: hbdomain.CheckWarn}, {Name: "mysql", Status: hbdomain.CheckOK}},
+		Metrics: []dynamicdomain.MetricResult{{Name: "cpu", Success: true}},
+	}
+	if problems := agentUpgradeGate(baseline, true, current, true, upgradedAt, "V1.1.0"); len(problems) != 0 {
+		t.Fatalf("pre-existing warnings must not block the gate: %v", problems)
+	}
+	current.Checks[1].Status = hbdomain.CheckFail
+	current.Metrics = nil
+	current.LastHeartbeatAt = upgradedAt.Add(-time.Second)
+	if problems := agentUpgradeGate(baseline, true, current, true, upgradedAt, "V1.1.0"); len(problems) != 3 {
+		t.Fatalf("stale heartbeat, new failure and silent collector should all be reported: %v", problems)
+	}
+}
@@ -43,6 +43,13 @@ type UpgradeJob struct {
 	Error          string        `json:"error,omitempty"`
 	CreatedAt      time.Time     `json:"created_at"`
 	UpdatedAt      time.Time     `json:"updated_at"`
+	// Plan, TargetStates and the batch counters are only set on batched Agent
+	// upgrades; Manager jobs leave them empty.
+	Plan           *AgentUpgradePlan `json:"plan,omitempty"`
+	TargetStates   []UpgradeTarget   `json:"target_states,omitempty"`
+	CurrentBatch   int               `json:"current_batch,omitempty"`
+	Batches        int               `json:"batches,omitempty"`
+	PauseRequested bool              `json:"pause_requested,omitempty"`
 }
 
 type UpgradeOverview struct {
@@ -85,14 +92,16 @@ type UpgradeService struct {
 	jobs      map[string]UpgradeJob
 	statePath string
 	packages  *PackageService
-	agents    *AgentService
+	agents    upgradeAgentFleet
 	runtime   *ManagerRuntimeService
+	resumes   map[string]chan struct{}
 }
 
 func NewUpgradeService(statePath string, packages *PackageService, agents *AgentService, managerRuntime *ManagerRuntimeService) *UpgradeService {
 	s := &UpgradeService{statePath: statePath, packages: packages, agents: agents, runtime: managerRuntime, jobs: make(map[string]UpgradeJob)}
 	_ = s.load()
 	s.reconcileManagerRestart()
+	s.reconcileAgentJobs()
 	return s
 }
 
@@ -184,11 +193,24 @@ func (s *UpgradeService) Get(id string) (UpgradeJob, bool) {
 	return item, ok
 }
 
+// StartAgentUpgrade upgrades the targets with the default canary plan.
 func (s *UpgradeService) StartAgentUpgrade(packageName string, targets []string) (UpgradeJob, error) {
+	return s.StartAgentUpgradePlan(packageName, targets, DefaultAgentUpgradePlan())
+}
+
+// StartAgentUpgradePlan upgrades the targets batch by batch: the canary batch
+// first, then batches of plan.BatchSize, each followed by a soak period and
+// health gates. A failed batch is rolled back when plan.AutoRollback is set.
+func (s *UpgradeService) StartAgentUpgradePlan(packageName string, targets []string, plan AgentUpgradePlan) (UpgradeJob, error) {
 	packageName = strings.TrimSpace(packageName)
+	targets = uniqueUpgradeTargets(targets)
 	if packageName == "" || len(targets) == 0 {
 		return UpgradeJob{}, errors.New("安装包和至少一个目标 Agent 必填")
 	}
+	plan, err := normalizeAgentUpgradePlan(plan)
+	if err != nil {
+		return UpgradeJob{}, err
+	}
 	item, path, err := s.resolvePackage("gmha-agent", packageName)
 	if err != nil {
 		return UpgradeJob{}, err
@@ -222,8 +244,9 @@ func (s *UpgradeService) StartAgentUpgrade(packageName string, targets []string)
 	if err := validateAgentBinary(content, item.Arch); err != nil {
 		return UpgradeJob{}, err
 	}
-	job := s.newJob("agent", targets, item, "mixed", []string{"升级前检查", "校验安装包", "备份并替换 Agent", "重启 Agent", "心跳与版本后检"})
-	go s.runAgent(job.ID, item.Version, item.Arch, content)
+	job := s.newJob("agent", targets, item, "mixed", []string{"升级前检查", "校验安装包", "金丝雀与分批替换 Agent", "批次浸泡与健康门禁", "心跳与版本后检"})
+	job = s.attachAgentPlan(job.ID, plan)
+	go s.runAgent(job.ID, item, content)
 	return job, nil
 }
 
@@ -404,49 +427,6 @@ func (s *UpgradeService) newJob(component string, targets []string, pkg PackageI
 	return job
 }
 
-func (s *UpgradeService) runAgent(id, version, packageArch string, binary []byte) {
-	s.step(id, 0, "running", "检查目标在线状态、SSH 权限与当前版本")
-	job, _ := s.Get(id)
-	for _, ip := range job.Targets {
-		view, ok, err := s.agents.GetViewByIP(context.Background(), ip)
-		if err != nil || !ok || (strings.ToLower(view.HeartbeatState) != "online" && strings.ToLower(view.InstallState) != "online") {
-			s.fail(id, 0, fmt.Errorf("%s 升级前检查失败：Agent 不在线", ip))
-			return
-		}
-		machine, found, err := s.agents.resolveMachineByIP(context.Background(), ip)
-		if err != nil || !found {
-			s.fail(id, 0, fmt.Errorf("%s 升级前检查失败：机器不存在", ip))
-			return
-		}
-		_, targetArch, err := s.agents.detectRemotePlatform(context.Background(), machine)
-		if err != nil || (packageArch != "未识别" && normalizeComponentArch(targetArch) != normalizeComponentArch(packageArch)) {
-			s.fail(id, 0, fmt.Errorf("%s 架构不兼容：目标 %s，安装包 %s", ip, targetArch, packageArch))
-			return
-		}
-	}
-	s.step(id, 0, "success", "目标 Agent 均在线，当前版本已记录")
-	s.step(id, 1, "success", fmt.Sprintf("安装包已读取，目标版本 %s", version))
-	s.step(id, 2, "running", "逐台备份并原子替换 Agent 二进制")
-	for _, ip := range job.Targets {
-		if _, err := s.agents.UpgradeByIPBinary(context.Background(), ip, version, binary); err != nil {
-			s.fail(id, 2, fmt.Errorf("%s: %w", ip, err))
-			return
-		}
-	}
-	s.step(id, 2, "success", fmt.Sprintf("%d 台 Agent 已完成替换", len(job.Targets)))
-	s.step(id, 3, "success", "systemd 服务已重启")
-	s.step(id, 4, "running", "核对新鲜心跳与上报版本")
-	for _, ip := range job.Targets {
-		view, ok, err := s.agents.GetViewByIP(context.Background(), ip)
-		if err != nil || !ok || !strings.EqualFold(view.Version, version) {
-			s.fail(id, 4, fmt.Errorf("%s 版本后检失败：上报 %s，期望 %s", ip, view.Version, version))
-			return
-		}
-	}
-	s.step(id, 4, "success", "所有 Agent 心跳在线且版本匹配")
-	s.complete(id)
-}
-
 func (s *UpgradeService) runManager(id, packagePath, packageArch string) {
 	s.step(id, 0, "running", fmt.Sprintf("检查操作系统 %s、架构 %s 与写权限", runtime.GOOS, runtime.GOARCH))
 	if packageArch != "未识别" && normalizeComponentArch(packageArch) != normalizeComponentArch(runtime.GOARCH) {
@@ -640,7 +620,7 @@ func (s *UpgradeService) fail(id string, index int, err error) {
 func (s *UpgradeService) complete(id string) {
 	s.mu.Lock()
 	job := s.jobs[id]
-	job.Status, job.Progress, job.UpdatedAt = "success", 100, time.Now().UTC()
+	job.Status, job.Progress, job.PauseRequested, job.UpdatedAt = "success", 100, false, time.Now().UTC()
 	s.jobs[id] = job
 	_ = s.saveLocked()
 	s.mu.Unlock()
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type yamlLine struct {
+	no     int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	label string
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAMLTree 把 YAML 文本解析为由 map[string]any、[]any 与 string 组成的树。
+// 只支持块风格的映射与列表、`[a, b]` 行内列表、`{}` 和带引号的字符串，这已覆盖
+// 集群规格与纳管清单需要的写法；标量一律保留为字符串，由调用方按目标类型转换。
+// label 用于错误信息（如“规格第 3 行”），内容为空时返回 nil。
+func parseYAMLTree(content, label string) (any, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	var lines []yamlLine
+	for index, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line := strings.TrimRight(stripYAMLComment(raw), " \t")
+		text := strings.TrimLeft(line, " \t")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.Contains(line[:len(line)-len(text)], "\t") {
+			return nil, fmt.Errorf("%s第 %d 行使用了制表符缩进", label, index+1)
+		}
+		lines = append(lines, yamlLine{no: index + 1, indent: len(line) - len(text), text: text})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	parser := &yamlParser{label: label, lines: lines}
+	tree, err := parser.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(lines) {
+		return nil, parser.errorf(lines[parser.pos].no, "缩进不正确")
+	}
+	return tree, nil
+}
+
+func (p *yamlParser) errorf(lineNo int, format string, args ...any) error {
+	return fmt.Errorf("%s第 %d 行"+format, append([]any{p.label, lineNo}, args...)...)
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	if isYAMLListItem(p.lines[p.pos].text) {
+		return p.list(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) list(indent int) ([]any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isYAMLListItem(line.text) {
+			break
+		}
+		content := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if content == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				value, err := p.block(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, value)
+			} else {
+				items = append(items, "")
+			}
+			continue
+		}
+		if _, _, ok := splitYAMLKey(content); ok {
+			// "- key: value" 开启一个映射，后续字段与 key 对齐。
+			column := line.indent + len(line.text) - len(content)
+			p.lines[p.pos] = yamlLine{no: line.no, indent: column, text: content}
+			value, err := p.mapping(column)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			continue
+		}
+		value, err := p.scalar(content, line.no)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	out := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line.no, "缩进不正确")
+		}
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, p.errorf(line.no, "不是 key: value 格式")
+		}
+		if _, exists := out[key]; exists {
+			return nil, p.errorf(line.no, "重复定义字段 %q", key)
+		}
+		p.pos++
+		if value != "" {
+			scalar, err := p.scalar(value, line.no)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = scalar
+			continue
+		}
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLListItem(next.text)) {
+				nested, err := p.block(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				out[key] = nested
+				continue
+			}
+		}
+		out[key] = ""
+	}
+	return out, nil
+}
+
+func (p *yamlParser) scalar(value string, lineNo int) (any, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, p.errorf(lineNo, "字符串引号不完整")
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, p.errorf(lineNo, "字符串引号不完整")
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, p.errorf(lineNo, "行内列表缺少 ]")
+		}
+		items := []any{}
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			scalar, err := p.scalar(item, lineNo)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, scalar)
+		}
+		return items, nil
+	case value == "{}":
+		return map[string]any{}, nil
+	case value == "~" || value == "null":
+		return "", nil
+	}
+	return value, nil
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func splitYAMLKey(text string) (string, string, bool) {
+	if isYAMLListItem(text) {
+		return "", "", false
+	}
+	index := strings.Index(text, ": ")
+	if index < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false
+		}
+		index = len(text) - 1
+	}
+	key := strings.Trim(strings.TrimSpace(text[:index]), `"'`)
+	if key == "" || strings.ContainsAny(key, " \"'{}[]") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(text[index+1:]), true
+}
+
+func stripYAMLComment(line string) string {
+	quote := rune(0)
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
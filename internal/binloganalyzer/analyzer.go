@@ -359,14 +359,7 @@ func resolveFiles(ctx context.Context, cfg Config) ([]string, bool, error) {
 }
 
 func listBinaryLogs(ctx context.Context, cfg Config) ([]string, error) {
-	driverCfg := mysqldriver.NewConfig()
-	driverCfg.User = cfg.User
-	driverCfg.Passwd = cfg.Password
-	driverCfg.Net = "tcp"
-	driverCfg.Addr = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	driverCfg.Timeout = 5 * time.Second
-	driverCfg.ReadTimeout = 15 * time.Second
-	db, err := sql.Open("mysql", driverCfg.FormatDSN())
+	db, err := openServerDB(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -403,6 +396,17 @@ func listBinaryLogs(ctx context.Context, cfg Config) ([]string, error) {
 	return files, nil
 }
 
+func openServerDB(cfg Config) (*sql.DB, error) {
+	driverCfg := mysqldriver.NewConfig()
+	driverCfg.User = cfg.User
+	driverCfg.Passwd = cfg.Password
+	driverCfg.Net = "tcp"
+	driverCfg.Addr = fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	driverCfg.Timeout = 5 * time.Second
+	driverCfg.ReadTimeout = 15 * time.Second
+	return sql.Open("mysql", driverCfg.FormatDSN())
+}
+
 func locateStartFile(ctx context.Context, cfg Config, files []string) (string, error) {
 	low, high, best := 0, len(files)-1, -1
 	for low <= high {
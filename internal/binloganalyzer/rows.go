@@ -0,0 +1,691 @@
+package binloganalyzer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	ModeSummary = "summary"
+	ModeRows    = "rows"
+
+	DefaultMaxRowChanges = 10000
+	MaxRowChanges        = 200000
+)
+
+// RowFilter selects the row changes returned by SearchRows. Schema and Table
+// are matched case-insensitively; an empty Table selects the whole schema.
+// Match holds column=value conditions that must all hold on the before or the
+// after image, so "id=123" finds the insert, every update and the delete of
+// that row. Columns without names in the binlog can be addressed as "@1".
+type RowFilter struct {
+	Schema  string            `json:"schema"`
+	Table   string            `json:"table,omitempty"`
+	Types   []string          `json:"types,omitempty"`
+	Match   map[string]string `json:"match,omitempty"`
+	MaxRows int               `json:"max_rows"`
+}
+
+// RowChange is one row of a rows event with its before and after images.
+// Values are JSON friendly: integers, floats, decimals as strings, temporal
+// values as strings (TIMESTAMP in UTC) and binary values that are not valid
+// UTF-8 as hex strings listed in HexColumns.
+type RowChange struct {
+	Seq              int64     `json:"seq"`
+	Time             time.Time `json:"time"`
+	Schema           string    `json:"schema"`
+	Table            string    `json:"table"`
+	Type             string    `json:"type"`
+	GTID             string    `json:"gtid,omitempty"`
+	ThreadID         uint32    `json:"thread_id,omitempty"`
+	BinlogFile       string    `json:"binlog_file"`
+	EndLogPos        uint32    `json:"end_log_pos"`
+	Columns          []string  `json:"columns"`
+	PrimaryKey       []string  `json:"primary_key,omitempty"`
+	Generated        []string  `json:"generated_columns,omitempty"`
+	HexColumns       []int     `json:"hex_columns,omitempty"`
+	Before           []any     `json:"before,omitempty"`
+	After            []any     `json:"after,omitempty"`
+	Query            string    `json:"query,omitempty"`
+	NamesUnavailable bool      `json:"names_unavailable,omitempty"`
+	PartialImage     bool      `json:"partial_image,omitempty"`
+}
+
+type RowSearchSummary struct {
+	StartFile     string    `json:"start_file"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	FilesAnalyzed int       `json:"files_analyzed"`
+	EventsScanned int64     `json:"events_scanned"`
+	RowsScanned   int64     `json:"rows_scanned"`
+	RowsMatched   int64     `json:"rows_matched"`
+	MaxRows       int       `json:"max_rows"`
+	Truncated     bool      `json:"truncated"`
+	Warnings      []string  `json:"warnings,omitempty"`
+}
+
+type tableMetadata struct {
+	columns    []string
+	primaryKey []string
+	generated  map[string]bool
+	unsigned   map[int]bool
+}
+
+type tableMetadataFunc func(ctx context.Context, schema, table string) (tableMetadata, error)
+
+// rowScanner holds the state of one sequential row search. It is separate
+// from the replication stream so the event handling can be tested without a
+// server.
+type rowScanner struct {
+	cfg      Config
+	filter   RowFilter
+	types    map[string]bool
+	match    map[string]string
+	lookup   tableMetadataFunc
+	emit     func(RowChange) error
+	file     string
+	gtid     string
+	threadID uint32
+	query    string
+	tables   map[uint64]*replication.TableMapEvent
+	meta     map[string]*tableMetadata
+	warned   map[string]bool
+	summary  RowSearchSummary
+	seq      int64
+}
+
+// ValidateRowFilter normalizes the filter; it is also used by Manager before
+// a run is queued.
+func ValidateRowFilter(filter RowFilter) (RowFilter, error) {
+	filter.Schema = strings.TrimSpace(filter.Schema)
+	filter.Table = strings.TrimSpace(filter.Table)
+	if filter.Schema == "" {
+		return filter, errors.New("行级检索必须指定库名")
+	}
+	if filter.Table == "" && len(filter.Match) > 0 {
+		return filter, errors.New("按列值过滤时必须指定表名")
+	}
+	types := make([]string, 0, len(filter.Types))
+	for _, kind := range filter.Types {
+		kind = strings.ToUpper(strings.TrimSpace(kind))
+		if kind != "INSERT" && kind != "UPDATE" && kind != "DELETE" {
+			return filter, fmt.Errorf("不支持的变更类型 %q", kind)
+		}
+		types = append(types, kind)
+	}
+	filter.Types = uniqueSorted(types)
+	match := make(map[string]string, len(filter.Match))
+	for column, value := range filter.Match {
+		column = strings.TrimSpace(column)
+		if column == "" {
+			return filter, errors.New("过滤列名不能为空")
+		}
+		match[column] = value
+	}
+	if len(match) > 0 {
+		filter.Match = match
+	} else {
+		filter.Match = nil
+	}
+	if filter.MaxRows <= 0 {
+		filter.MaxRows = DefaultMaxRowChanges
+	}
+	if filter.MaxRows > MaxRowChanges {
+		return filter, fmt.Errorf("单次行级检索最多返回 %d 行", MaxRowChanges)
+	}
+	return filter, nil
+}
+
+// SearchRows streams the row changes matching filter to emit in binlog order.
+// Unlike Analyze it reads the files sequentially with a single replication
+// connection, so the order of emitted changes is the commit order and GTID
+// and thread id can be attributed to every row. emit may return an error to
+// abort the search; nothing is buffered besides table metadata.
+func SearchRows(ctx context.Context, cfg Config, filter RowFilter, emit func(RowChange) error, progress func(Progress)) (RowSearchSummary, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return RowSearchSummary{}, err
+	}
+	filter, err := ValidateRowFilter(filter)
+	if err != nil {
+		return RowSearchSummary{}, err
+	}
+	files, _, err := resolveFiles(ctx, cfg)
+	if err != nil {
+		return RowSearchSummary{}, err
+	}
+	if len(files) == 0 {
+		return RowSearchSummary{}, errors.New("没有可分析的 Binlog 文件")
+	}
+
+	db, err := openServerDB(cfg)
+	if err != nil {
+		return RowSearchSummary{}, err
+	}
+	defer db.Close()
+	scanner := newRowScanner(cfg, filter, func(ctx context.Context, schema, table string) (tableMetadata, error) {
+		return queryTableMetadata(ctx, db, schema, table)
+	}, emit)
+	scanner.summary.StartFile = files[0]
+
+	state := Progress{Phase: "running", Message: "正在按顺序检索行变更", FilesTotal: len(files), Workers: 1, CurrentFile: files[0]}
+	if progress != nil {
+		progress(state)
+	}
+	syncerCfg := syncerConfig(cfg)
+	syncerCfg.UseDecimal = true
+	syncerCfg.TimestampStringLocation = time.UTC
+	syncer := replication.NewBinlogSyncer(syncerCfg)
+	defer syncer.Close()
+	streamer, err := syncer.StartSync(mysql.Position{Name: files[0], Pos: 4})
+	if err != nil {
+		return scanner.summary, fmt.Errorf("启动复制协议失败: %w", err)
+	}
+	scanner.file = files[0]
+	for {
+		event, err := streamer.GetEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return scanner.summary, ctx.Err()
+			}
+			if time.Now().After(cfg.EndTime) && strings.Contains(strings.ToLower(err.Error()), "timeout") {
+				break
+			}
+			return scanner.summary, err
+		}
+		if event.Header.EventType == replication.HEARTBEAT_EVENT || event.Header.EventType == replication.HEARTBEAT_LOG_EVENT_V2 {
+			// Heartbeats are only sent once the dump reached the end of the
+			// active binlog, so nothing later than EndTime can follow.
+			if time.Now().After(cfg.EndTime) {
+				break
+			}
+			continue
+		}
+		done, err := scanner.handle(ctx, event)
+		if err != nil {
+			return scanner.summary, err
+		}
+		if done {
+			break
+		}
+		if progress != nil && (scanner.summary.EventsScanned%1000 == 0 || state.CurrentFile != scanner.file) {
+			if state.CurrentFile != scanner.file {
+				state.FilesCompleted++
+			}
+			state.CurrentFile = scanner.file
+			state.EventsProcessed = scanner.summary.EventsScanned
+			state.LastEventTime = eventTime(event.Header.Timestamp, cfg.StartTime.Location())
+			state.Message = fmt.Sprintf("已匹配 %d 行变更", scanner.summary.RowsMatched)
+			progress(state)
+		}
+	}
+	if progress != nil {
+		state.Phase = "completed"
+		state.Message = "检索完成"
+		state.CurrentFile = ""
+		state.FilesCompleted = scanner.summary.FilesAnalyzed
+		state.EventsProcessed = scanner.summary.EventsScanned
+		progress(state)
+	}
+	return scanner.summary, nil
+}
+
+func newRowScanner(cfg Config, filter RowFilter, lookup tableMetadataFunc, emit func(RowChange) error) *rowScanner {
+	scanner := &rowScanner{
+		cfg: cfg, filter: filter, lookup: lookup, emit: emit,
+		tables: make(map[uint64]*replication.TableMapEvent), meta: make(map[string]*tableMetadata),
+		warned: make(map[string]bool), summary: RowSearchSummary{StartTime: cfg.StartTime, EndTime: cfg.EndTime, MaxRows: filter.MaxRows},
+	}
+	if len(filter.Types) > 0 {
+		scanner.types = make(map[string]bool, len(filter.Types))
+		for _, kind := range filter.Types {
+			scanner.types[kind] = true
+		}
+	}
+	if len(filter.Match) > 0 {
+		scanner.match = make(map[string]string, len(filter.Match))
+		for column, value := range filter.Match {
+			scanner.match[strings.ToLower(column)] = value
+		}
+	}
+	return scanner
+}
+
+// handle processes one event; it reports true when the search is finished.
+func (s *rowScanner) handle(ctx context.Context, event *replication.BinlogEvent) (bool, error) {
+	s.summary.EventsScanned++
+	ts := eventTime(event.Header.Timestamp, s.cfg.StartTime.Location())
+	if !ts.IsZero() && ts.After(s.cfg.EndTime) {
+		return true, nil
+	}
+	switch value := event.Event.(type) {
+	case *replication.RotateEvent:
+		next := string(value.NextLogName)
+		if next != "" && (next != s.file || s.summary.FilesAnalyzed == 0) {
+			s.file = next
+			s.summary.FilesAnalyzed++
+			s.tables = make(map[uint64]*replication.TableMapEvent)
+		}
+	case *replication.GTIDEvent:
+		uuid := value.SID
+		s.gtid = fmt.Sprintf("%x-%x-%x-%x-%x:%d", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:], value.GNO)
+		s.threadID, s.query = 0, ""
+	case *replication.MariadbGTIDEvent:
+		s.gtid = value.GTID.String()
+		s.threadID, s.query = 0, ""
+	case *replication.QueryEvent:
+		if strings.EqualFold(strings.TrimSpace(string(value.Query)), "BEGIN") {
+			s.threadID = value.SlaveProxyID
+		}
+	case *replication.RowsQueryEvent:
+		s.query = compactSQL(string(value.Query), 2000)
+	case *replication.TableMapEvent:
+		s.tables[value.TableID] = value
+	case *replication.XIDEvent:
+		s.query = ""
+	case *replication.RowsEvent:
+		if ts.Before(s.cfg.StartTime) {
+			return false, nil
+		}
+		table := value.Table
+		if table == nil {
+			table = s.tables[value.TableID]
+		}
+		if table == nil {
+			return false, nil
+		}
+		kind, ok := classifyDML(event.Header.EventType)
+		if !ok || (s.types != nil && !s.types[kind]) {
+			return false, nil
+		}
+		schemaName, tableName := string(table.Schema), string(table.Table)
+		if !strings.EqualFold(schemaName, s.filter.Schema) || (s.filter.Table != "" && !strings.EqualFold(tableName, s.filter.Table)) {
+			return false, nil
+		}
+		return s.emitRows(ctx, event, value, table, kind, ts)
+	}
+	return false, nil
+}
+
+func (s *rowScanner) emitRows(ctx context.Context, event *replication.BinlogEvent, rows *replication.RowsEvent, table *replication.TableMapEvent, kind string, ts time.Time) (bool, error) {
+	meta := s.metadata(ctx, table)
+	step := 1
+	if kind == "UPDATE" {
+		step = 2
+	}
+	for index := 0; index+step <= len(rows.Rows); index += step {
+		s.summary.RowsScanned++
+		change := RowChange{
+			Time: ts, Schema: string(table.Schema), Table: string(table.Table), Type: kind,
+			GTID: s.gtid, ThreadID: s.threadID, BinlogFile: s.file, EndLogPos: event.Header.LogPos,
+			Columns: meta.columns, PrimaryKey: meta.primaryKey, Query: s.query,
+			PartialImage: len(rows.SkippedColumns) > index && len(rows.SkippedColumns[index]) > 0,
+		}
+		for column := range meta.columns {
+			if meta.generated[meta.columns[column]] {
+				change.Generated = append(change.Generated, meta.columns[column])
+			}
+		}
+		change.NamesUnavailable = len(meta.columns) > 0 && strings.HasPrefix(meta.columns[0], "@")
+		hex := binaryColumns(rows.Rows[index : index+step]...)
+		switch kind {
+		case "INSERT":
+			change.After = normalizeRow(rows.Rows[index], meta.unsigned, hex)
+		case "DELETE":
+			change.Before = normalizeRow(rows.Rows[index], meta.unsigned, hex)
+		case "UPDATE":
+			change.Before = normalizeRow(rows.Rows[index], meta.unsigned, hex)
+			change.After = normalizeRow(rows.Rows[index+1], meta.unsigned, hex)
+			change.PartialImage = change.PartialImage || (len(rows.SkippedColumns) > index+1 && len(rows.SkippedColumns[index+1]) > 0)
+		}
+		for column := range meta.columns {
+			if hex[column] {
+				change.HexColumns = append(change.HexColumns, column)
+			}
+		}
+		if !s.matches(change) {
+			continue
+		}
+		if s.summary.RowsMatched >= int64(s.filter.MaxRows) {
+			s.summary.Truncated = true
+			return true, nil
+		}
+		s.seq++
+		change.Seq = s.seq
+		s.summary.RowsMatched++
+		if err := s.emit(change); err != nil {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// metadata resolves column names, primary key and signedness. Binlog table
+// map metadata (binlog_row_metadata=FULL) describes the table as it was when
+// the row was written and wins; information_schema describes the current
+// table and is only used when its column count still matches the event.
+func (s *rowScanner) metadata(ctx context.Context, table *replication.TableMapEvent) tableMetadata {
+	key := string(table.Schema) + "." + string(table.Table)
+	current := s.meta[key]
+	if current == nil {
+		current = &tableMetadata{}
+		if s.lookup != nil {
+			item, err := s.lookup(ctx, string(table.Schema), string(table.Table))
+			if err != nil {
+				s.warn(key+":lookup", fmt.Sprintf("读取 %s 的表结构失败: %v", key, err))
+			} else {
+				*current = item
+			}
+		}
+		s.meta[key] = current
+	}
+	count := int(table.ColumnCount)
+	meta := tableMetadata{generated: current.generated}
+	if names := table.ColumnNameString(); len(names) == count {
+		meta.columns = names
+	} else if len(current.columns) == count {
+		meta.columns = current.columns
+	} else {
+		if len(current.columns) > 0 {
+			s.warn(key+":columns", fmt.Sprintf("%s 当前表结构与 Binlog 列数不一致，列名以 @序号 显示，无法生成回滚 SQL", key))
+		}
+		meta.columns = make([]string, count)
+		for index := range meta.columns {
+			meta.columns[index] = "@" + strconv.Itoa(index+1)
+		}
+		meta.generated = nil
+	}
+	if len(table.PrimaryKey) > 0 && len(table.ColumnName) == count {
+		for _, index := range table.PrimaryKey {
+			if int(index) < count {
+				meta.primaryKey = append(meta.primaryKey, meta.columns[index])
+			}
+		}
+	} else if len(current.columns) == count {
+		meta.primaryKey = current.primaryKey
+	}
+	if unsigned := table.UnsignedMap(); unsigned != nil {
+		meta.unsigned = unsigned
+	} else if len(current.columns) == count {
+		meta.unsigned = current.unsigned
+	}
+	return meta
+}
+
+func (s *rowScanner) warn(key, message string) {
+	if s.warned[key] || len(s.summary.Warnings) >= 20 {
+		return
+	}
+	s.warned[key] = true
+	s.summary.Warnings = append(s.summary.Warnings, message)
+}
+
+func (s *rowScanner) matches(change RowChange) bool {
+	if len(s.match) == 0 {
+		return true
+	}
+	return imageMatches(change, change.Before, s.match) || imageMatches(change, change.After, s.match)
+}
+
+func imageMatches(change RowChange, image []any, match map[string]string) bool {
+	if image == nil {
+		return false
+	}
+	for column, expected := range match {
+		index := -1
+		for candidate, name := range change.Columns {
+			if strings.EqualFold(name, column) || "@"+strconv.Itoa(candidate+1) == column {
+				index = candidate
+				break
+			}
+		}
+		if index < 0 || index >= len(image) || image[index] == nil || valueText(image[index]) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// binaryColumns returns the columns holding bytes that are not valid UTF-8 in
+// any of the images; they are hex encoded in all images of the row.
+func binaryColumns(images ...[]any) map[int]bool {
+	columns := make(map[int]bool)
+	for _, image := range images {
+		for index, value := range image {
+			if raw, ok := value.([]byte); ok && !utf8.Valid(raw) {
+				columns[index] = true
+			}
+		}
+	}
+	return columns
+}
+
+// normalizeRow converts decoded values into the JSON-friendly form documented
+// on RowChange. Integers of unsigned columns come back from the decoder as
+// negative signed values and are reinterpreted.
+func normalizeRow(row []any, unsigned map[int]bool, hexColumns map[int]bool) []any {
+	out := make([]any, len(row))
+	for index, value := range row {
+		switch typed := value.(type) {
+		case nil:
+			out[index] = nil
+		case int8:
+			out[index] = unsignedValue(int64(typed), 8, unsigned[index])
+		case int16:
+			out[index] = unsignedValue(int64(typed), 16, unsigned[index])
+		case int32:
+			out[index] = unsignedValue(int64(typed), 32, unsigned[index])
+		case int64:
+			out[index] = unsignedValue(typed, 64, unsigned[index])
+		case int:
+			out[index] = unsignedValue(int64(typed), 64, unsigned[index])
+		case float32:
+			out[index] = float64(typed)
+		case []byte:
+			if hexColumns[index] {
+				out[index] = hex.EncodeToString(typed)
+			} else {
+				out[index] = string(typed)
+			}
+		case string, uint8, uint16, uint32, uint64, float64:
+			out[index] = typed
+		case fmt.Stringer:
+			out[index] = typed.String()
+		default:
+			out[index] = fmt.Sprint(typed)
+		}
+	}
+	return out
+}
+
+func unsignedValue(value int64, bits uint, unsigned bool) any {
+	if !unsigned || value >= 0 {
+		return value
+	}
+	if bits == 64 {
+		return uint64(value)
+	}
+	return uint64(value) & (1<<bits - 1)
+}
+
+func valueText(value any) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+// FlashbackSQL returns the statement that reverts change. INSERT becomes a
+// DELETE, DELETE an INSERT and UPDATE restores the before image. Rows are
+// addressed by primary key when it is known and by the full image otherwise,
+// always with LIMIT 1. Statements assume time_zone '+00:00' because TIMESTAMP
+// values are captured in UTC.
+func FlashbackSQL(change RowChange) (string, error) {
+	if change.NamesUnavailable || len(change.Columns) == 0 {
+		return "", fmt.Errorf("第 %d 行缺少列名，无法生成回滚 SQL", change.Seq)
+	}
+	if change.PartialImage {
+		return "", fmt.Errorf("第 %d 行不是完整行镜像（binlog_row_image 非 FULL），无法生成回滚 SQL", change.Seq)
+	}
+	table := quoteIdentifier(change.Schema) + "." + quoteIdentifier(change.Table)
+	generated := make(map[string]bool, len(change.Generated))
+	for _, name := range change.Generated {
+		generated[name] = true
+	}
+	hexColumns := make(map[int]bool, len(change.HexColumns))
+	for _, index := range change.HexColumns {
+		hexColumns[index] = true
+	}
+	switch change.Type {
+	case "INSERT":
+		if len(change.After) != len(change.Columns) {
+			return "", fmt.Errorf("第 %d 行的行镜像不完整", change.Seq)
+		}
+		return fmt.Sprintf("DELETE FROM %s WHERE %s LIMIT 1;", table, rowCondition(change, change.After, generated, hexColumns)), nil
+	case "DELETE":
+		if len(change.Before) != len(change.Columns) {
+			return "", fmt.Errorf("第 %d 行的行镜像不完整", change.Seq)
+		}
+		var columns, values []string
+		for index, name := range change.Columns {
+			if generated[name] {
+				continue
+			}
+			columns = append(columns, quoteIdentifier(name))
+			values = append(values, sqlLiteral(change.Before[index], hexColumns[index]))
+		}
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);", table, strings.Join(columns, ", "), strings.Join(values, ", ")), nil
+	case "UPDATE":
+		if len(change.Before) != len(change.Columns) || len(change.After) != len(change.Columns) {
+			return "", fmt.Errorf("第 %d 行的行镜像不完整", change.Seq)
+		}
+		var assignments []string
+		for index, name := range change.Columns {
+			if generated[name] {
+				continue
+			}
+			assignments = append(assignments, quoteIdentifier(name)+"="+sqlLiteral(change.Before[index], hexColumns[index]))
+		}
+		return fmt.Sprintf("UPDATE %s SET %s WHERE %s LIMIT 1;", table, strings.Join(assignments, ", "), rowCondition(change, change.After, generated, hexColumns)), nil
+	default:
+		return "", fmt.Errorf("第 %d 行的变更类型 %q 不支持回滚", change.Seq, change.Type)
+	}
+}
+
+func rowCondition(change RowChange, image []any, generated map[string]bool, hexColumns map[int]bool) string {
+	keys := make(map[string]bool, len(change.PrimaryKey))
+	for _, name := range change.PrimaryKey {
+		keys[name] = true
+	}
+	var conditions []string
+	for index, name := range change.Columns {
+		if (len(keys) > 0 && !keys[name]) || (len(keys) == 0 && generated[name]) {
+			continue
+		}
+		if image[index] == nil {
+			conditions = append(conditions, quoteIdentifier(name)+" IS NULL")
+			continue
+		}
+		conditions = append(conditions, quoteIdentifier(name)+"="+sqlLiteral(image[index], hexColumns[index]))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func sqlLiteral(value any, hexValue bool) string {
+	switch typed := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		if hexValue {
+			return "X'" + typed + "'"
+		}
+		return quoteString(typed)
+	case json.Number:
+		return typed.String()
+	case float64:
+		return strconv.FormatFloat(typed, 'g', -1, 64)
+	case int64, uint64, int, uint8, uint16, uint32:
+		return fmt.Sprint(typed)
+	default:
+		return quoteString(fmt.Sprint(typed))
+	}
+}
+
+func quoteString(value string) string {
+	var builder strings.Builder
+	builder.Grow(len(value) + 2)
+	builder.WriteByte('\'')
+	for _, char := range value {
+		switch char {
+		case 0:
+			builder.WriteString(`\0`)
+		case '\'':
+			builder.WriteString(`\'`)
+		case '\\':
+			builder.WriteString(`\\`)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case 0x1a:
+			builder.WriteString(`\Z`)
+		default:
+			builder.WriteRune(char)
+		}
+	}
+	builder.WriteByte('\'')
+	return builder.String()
+}
+
+func queryTableMetadata(ctx context.Context, db *sql.DB, schema, table string) (tableMetadata, error) {
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, COLUMN_KEY, COLUMN_TYPE, EXTRA
+FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION`, schema, table)
+	if err != nil {
+		return tableMetadata{}, err
+	}
+	defer rows.Close()
+	meta := tableMetadata{generated: make(map[string]bool), unsigned: make(map[int]bool)}
+	for rows.Next() {
+		var name, key, columnType, extra string
+		if err := rows.Scan(&name, &key, &columnType, &extra); err != nil {
+			return tableMetadata{}, err
+		}
+		if strings.EqualFold(key, "PRI") {
+			meta.primaryKey = append(meta.primaryKey, name)
+		}
+		if upper := strings.ToUpper(extra); strings.Contains(upper, "VIRTUAL GENERATED") || strings.Contains(upper, "STORED GENERATED") {
+			meta.generated[name] = true
+		}
+		if strings.Contains(strings.ToLower(columnType), "unsigned") {
+			meta.unsigned[len(meta.columns)] = true
+		}
+		meta.columns = append(meta.columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return tableMetadata{}, err
+	}
+	if len(meta.columns) == 0 {
+		return tableMetadata{}, errors.New("表不存在或无权限读取")
+	}
+	return meta, nil
+}
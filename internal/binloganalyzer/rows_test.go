@@ -0,0 +1,139 @@
+package binloganalyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func rowsTestEvent(ts time.Time, eventType replication.EventType, pos uint32, event replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{Timestamp: uint32(ts.Unix()), EventType: eventType, LogPos: pos},
+		Event:  event,
+	}
+}
+
+func TestRowScannerStreamsMatchingChangesWithTransactionContext(t *testing.T) {
+	start := time.Date(2026, 7, 23, 10, 0, 0, 0, time.UTC)
+	cfg := Config{StartTime: start, EndTime: start.Add(5 * time.Minute)}
+	filter, err := ValidateRowFilter(RowFilter{Schema: "shop", Table: "orders", Match: map[string]string{"id": "123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []RowChange
+	scanner := newRowScanner(cfg, filter, func(context.Context, string, string) (tableMetadata, error) {
+		return tableMetadata{
+			columns: []string{"id", "status", "amount"}, primaryKey: []string{"id"},
+			unsigned: map[int]bool{2: true},
+		}, nil
+	}, func(change RowChange) error {
+		got = append(got, change)
+		return nil
+	})
+	table := &replication.TableMapEvent{TableID: 7, Schema: []byte("shop"), Table: []byte("orders"), ColumnCount: 3}
+	other := &replication.TableMapEvent{TableID: 8, Schema: []byte("shop"), Table: []byte("users"), ColumnCount: 1}
+	at := start.Add(time.Minute)
+	events := []*replication.BinlogEvent{
+		{Header: &replication.EventHeader{EventType: replication.ROTATE_EVENT}, Event: &replication.RotateEvent{NextLogName: []byte("binlog.000007")}},
+		rowsTestEvent(at, replication.GTID_EVENT, 100, &replication.GTIDEvent{SID: bytes.Repeat([]byte{0xab}, 16), GNO: 42}),
+		rowsTestEvent(at, replication.QUERY_EVENT, 150, &replication.QueryEvent{SlaveProxyID: 88, Query: []byte("BEGIN")}),
+		rowsTestEvent(at, replication.ROWS_QUERY_EVENT, 200, &replication.RowsQueryEvent{Query: []byte("update orders set status='paid' where id in (123,124)")}),
+		rowsTestEvent(at, replication.TABLE_MAP_EVENT, 250, table),
+		rowsTestEvent(at, replication.TABLE_MAP_EVENT, 260, other),
+		rowsTestEvent(at, replication.UPDATE_ROWS_EVENTv2, 300, &replication.RowsEvent{TableID: 7, Rows: [][]any{
+			{int64(123), "new", int8(-1)}, {int64(123), "paid", int8(-1)},
+			{int64(124), "new", int8(1)}, {int64(124), "paid", int8(1)},
+		}}),
+		rowsTestEvent(at, replication.WRITE_ROWS_EVENTv2, 320, &replication.RowsEvent{TableID: 8, Rows: [][]any{{int64(123)}}}),
+		rowsTestEvent(at, replication.XID_EVENT, 340, &replication.XIDEvent{}),
+		rowsTestEvent(at.Add(time.Minute), replication.DELETE_ROWS_EVENTv2, 400, &replication.RowsEvent{TableID: 7, Rows: [][]any{{int64(123), "paid", int8(-1)}}}),
+		rowsTestEvent(cfg.EndTime.Add(time.Second), replication.DELETE_ROWS_EVENTv2, 500, &replication.RowsEvent{TableID: 7, Rows: [][]any{{int64(123), "paid", int8(-1)}}}),
+	}
+	for index, event := range events {
+		done, err := scanner.handle(context.Background(), event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done != (index == len(events)-1) {
+			t.Fatalf("event %d: done=%v", index, done)
+		}
+	}
+	if len(got) != 2 || scanner.summary.RowsMatched != 2 || scanner.summary.RowsScanned != 3 {
+		t.Fatalf("unexpected matches %+v summary=%+v", got, scanner.summary)
+	}
+	update := got[0]
+	if update.Seq != 1 || update.Type != "UPDATE" || update.ThreadID != 88 || update.BinlogFile != "binlog.000007" || update.EndLogPos != 300 ||
+		!strings.HasSuffix(update.GTID, ":42") || !strings.Contains(update.Query, "status='paid'") {
+		t.Fatalf("transaction context was not attributed: %+v", update)
+	}
+	if update.Before[1] != "new" || update.After[1] != "paid" || update.Before[2] != uint64(255) {
+		t.Fatalf("unexpected images before=%v after=%v", update.Before, update.After)
+	}
+	if got[1].Type != "DELETE" || got[1].Seq != 2 || got[1].After != nil {
+		t.Fatalf("unexpected delete %+v", got[1])
+	}
+}
+
+func TestRowScannerStopsAtMaxRowsAndFlagsUnknownColumns(t *testing.T) {
+	start := time.Date(2026, 7, 23, 10, 0, 0, 0, time.UTC)
+	filter, _ := ValidateRowFilter(RowFilter{Schema: "shop", MaxRows: 1})
+	var got []RowChange
+	scanner := newRowScanner(Config{StartTime: start, EndTime: start.Add(time.Hour)}, filter, nil, func(change RowChange) error {
+		got = append(got, change)
+		return nil
+	})
+	table := &replication.TableMapEvent{TableID: 1, Schema: []byte("shop"), Table: []byte("t"), ColumnCount: 2}
+	scanner.handle(context.Background(), rowsTestEvent(start, replication.TABLE_MAP_EVENT, 10, table))
+	done, err := scanner.handle(context.Background(), rowsTestEvent(start, replication.WRITE_ROWS_EVENTv2, 20, &replication.RowsEvent{
+		TableID: 1, Rows: [][]any{{int64(1), []byte{0xff, 0x00}}, {int64(2), nil}},
+	}))
+	if err != nil || !done || !scanner.summary.Truncated || len(got) != 1 {
+		t.Fatalf("search should stop at max rows: done=%v err=%v summary=%+v", done, err, scanner.summary)
+	}
+	if !got[0].NamesUnavailable || got[0].Columns[1] != "@2" || got[0].After[1] != "ff00" || len(got[0].HexColumns) != 1 {
+		t.Fatalf("unexpected change %+v", got[0])
+	}
+	if _, err := FlashbackSQL(got[0]); err == nil {
+		t.Fatal("flashback without column names must be refused")
+	}
+}
+
+func TestFlashbackSQLRevertsEachChangeType(t *testing.T) {
+	base := RowChange{
+		Seq: 1, Schema: "shop", Table: "orders", Columns: []string{"id", "note", "payload", "total"},
+		PrimaryKey: []string{"id"}, Generated: []string{"total"}, HexColumns: []int{2},
+	}
+	insert := base
+	insert.Type, insert.After = "INSERT", []any{json.Number("123"), "it's", "ff00", json.Number("5")}
+	del := base
+	del.Type, del.Before = "DELETE", insert.After
+	update := base
+	update.Type, update.Before, update.After = "UPDATE", []any{json.Number("123"), nil, "00", json.Number("1")}, insert.After
+	noKey := update
+	noKey.PrimaryKey = nil
+
+	for _, tc := range []struct {
+		change RowChange
+		want   string
+	}{
+		{insert, "DELETE FROM `shop`.`orders` WHERE `id`=123 LIMIT 1;"},
+		{del, "INSERT INTO `shop`.`orders` (`id`, `note`, `payload`) VALUES (123, 'it\\'s', X'ff00');"},
+		{update, "UPDATE `shop`.`orders` SET `id`=123, `note`=NULL, `payload`=X'00' WHERE `id`=123 LIMIT 1;"},
+		{noKey, "UPDATE `shop`.`orders` SET `id`=123, `note`=NULL, `payload`=X'00' WHERE `id`=123 AND `note`='it\\'s' AND `payload`=X'ff00' LIMIT 1;"},
+	} {
+		got, err := FlashbackSQL(tc.change)
+		if err != nil || got != tc.want {
+			t.Fatalf("FlashbackSQL(%s) = %q err=%v, want %q", tc.change.Type, got, err, tc.want)
+		}
+	}
+	partial := update
+	partial.PartialImage = true
+	if _, err := FlashbackSQL(partial); err == nil {
+		t.Fatal("partial row images must be refused")
+	}
+}
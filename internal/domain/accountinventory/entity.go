@@ -0,0 +1,94 @@
+package accountinventory
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+
+	RuleWildcardHost     = "wildcard_host"
+	RuleGlobalAll        = "global_all_privileges"
+	RuleEmptyPassword    = "empty_password"
+	RuleNativePassword84 = "native_password_deprecated"
+
+	// ChangeMissing accounts exist only on the primary, ChangeExtra only on
+	// the replica; sync always turns the replica into the primary.
+	ChangeMissing = "missing"
+	ChangeExtra   = "extra"
+	ChangeChanged = "changed"
+)
+
+// Account is one row of mysql.user with its grants. Roles are accounts too;
+// IsRole marks those granted to other accounts or created by CREATE ROLE.
+type Account struct {
+	User                string     `json:"user"`
+	Host                string     `json:"host"`
+	Plugin              string     `json:"plugin"`
+	IsRole              bool       `json:"is_role,omitempty"`
+	Locked              bool       `json:"locked"`
+	PasswordExpired     bool       `json:"password_expired"`
+	EmptyPassword       bool       `json:"empty_password"`
+	PasswordLastChanged *time.Time `json:"password_last_changed,omitempty"`
+	PasswordAgeDays     int        `json:"password_age_days"`
+	// PasswordLifetime is the per-account override in days; nil follows
+	// default_password_lifetime.
+	PasswordLifetime *int `json:"password_lifetime,omitempty"`
+	// PasswordDigest fingerprints the authentication string so nodes can be
+	// compared without storing it. It never leaves the Manager.
+	PasswordDigest string   `json:"-"`
+	Grants         []string `json:"grants"`
+	Roles          []string `json:"roles,omitempty"`
+	// Connection evidence from performance_schema.accounts, aggregated by
+	// user since the server started.
+	CurrentConnections int64    `json:"current_connections"`
+	TotalConnections   int64    `json:"total_connections"`
+	ClientHosts        []string `json:"client_hosts,omitempty"`
+	Preset             string   `json:"preset,omitempty"`
+}
+
+type Finding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	User     string `json:"user"`
+	Host     string `json:"host"`
+	Message  string `json:"message"`
+}
+
+// Snapshot is the latest inventory of one instance.
+type Snapshot struct {
+	Cluster       string    `json:"cluster"`
+	MachineID     string    `json:"machine_id"`
+	MachineName   string    `json:"machine_name,omitempty"`
+	MachineIP     string    `json:"machine_ip,omitempty"`
+	Port          int       `json:"port"`
+	Role          string    `json:"role,omitempty"`
+	ServerVersion string    `json:"server_version,omitempty"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	Accounts      []Account `json:"accounts"`
+	Findings      []Finding `json:"findings"`
+	Warnings      []string  `json:"warnings,omitempty"`
+	CollectedAt   time.Time `json:"collected_at"`
+}
+
+// Difference is one account that differs between a primary and a replica.
+// Fields names what differs: plugin, password, locked or grants.
+type Difference struct {
+	User          string   `json:"user"`
+	Host          string   `json:"host"`
+	Change        string   `json:"change"`
+	Fields        []string `json:"fields,omitempty"`
+	MissingGrants []string `json:"missing_grants,omitempty"`
+	ExtraGrants   []string `json:"extra_grants,omitempty"`
+}
+
+type Repository interface {
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	GetSnapshot(ctx context.Context, machineID string, port int) (Snapshot, bool, error)
+	// ListSnapshots returns the snapshots of a cluster, or of every instance
+	// when cluster is empty.
+	ListSnapshots(ctx context.Context, cluster string) ([]Snapshot, error)
+	DeleteSnapshot(ctx context.Context, machineID string, port int) error
+}
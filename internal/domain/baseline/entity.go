@@ -0,0 +1,143 @@
+package baseline
+
+import (
+	"context"
+	"time"
+)
+
+// Fact keys reported by the Agent. Keys that exist once per device or mount
+// point carry the target after a colon, e.g. "io.scheduler:sda" or
+// "mount.options:/data". FactNotApplicable marks facts that do not apply to
+// the host, such as NUMA interleave on a single-node machine.
+const (
+	FactSysctlPrefix   = "sysctl."
+	FactTHPEnabled     = "thp.enabled"
+	FactTHPDefrag      = "thp.defrag"
+	FactNUMANodes      = "numa.nodes"
+	FactNUMAInterleave = "numa.interleave"
+	FactIOScheduler    = "io.scheduler"
+	FactUlimitNoFile   = "ulimit.nofile"
+	FactUlimitNProc    = "ulimit.nproc"
+	FactTimeSync       = "time.sync"
+	FactSELinux        = "selinux"
+	FactFirewall       = "firewall"
+	FactMountOptions   = "mount.options"
+	FactMountFSType    = "mount.fstype"
+
+	FactNotApplicable = "n/a"
+)
+
+const (
+	OperatorEq       = "eq"
+	OperatorNe       = "ne"
+	OperatorGe       = "ge"
+	OperatorLe       = "le"
+	OperatorIn       = "in"
+	OperatorContains = "contains"
+)
+
+const (
+	StatusPass    = "pass"
+	StatusFail    = "fail"
+	StatusUnknown = "unknown"
+	StatusSkipped = "skipped"
+)
+
+const (
+	ProfileSourceBuiltin = "builtin"
+	ProfileSourceDefault = "default"
+	ProfileSourceCluster = "cluster"
+)
+
+// Rule is one expectation of a compliance profile. Expected holds a comma
+// separated list for the in and contains operators.
+type Rule struct {
+	Key         string `json:"key"`
+	Operator    string `json:"operator"`
+	Expected    string `json:"expected"`
+	Severity    string `json:"severity"`
+	Enabled     bool   `json:"enabled"`
+	Description string `json:"description,omitempty"`
+}
+
+// Profile is the baseline of a cluster. The profile with an empty cluster is
+// the default for clusters without their own; without a stored default the
+// built-in profile applies.
+type Profile struct {
+	Cluster   string    `json:"cluster"`
+	Source    string    `json:"source"`
+	Rules     []Rule    `json:"rules"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Report is what the Agent sends after each collection. The Manager stamps
+// it with its own clock because the host clock is one of the checks.
+type Report struct {
+	MachineID string            `json:"machine_id"`
+	AgentID   string            `json:"agent_id,omitempty"`
+	Hostname  string            `json:"hostname,omitempty"`
+	Facts     map[string]string `json:"facts"`
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// ReportResponse tells the Agent which sysctl keys the profile of its
+// cluster checks, so the next collection reads them.
+type ReportResponse struct {
+	Status     string   `json:"status"`
+	Failed     int      `json:"failed"`
+	SysctlKeys []string `json:"sysctl_keys"`
+}
+
+// CheckResult is the evaluation of one rule against one fact.
+type CheckResult struct {
+	Key        string `json:"key"`
+	Target     string `json:"target,omitempty"`
+	Operator   string `json:"operator"`
+	Expected   string `json:"expected"`
+	Actual     string `json:"actual"`
+	Status     string `json:"status"`
+	Severity   string `json:"severity"`
+	Remediable bool   `json:"remediable"`
+	Message    string `json:"message,omitempty"`
+}
+
+// HostState is the latest evaluation of one host; history rows share the
+// same shape and are only written when a result changes.
+type HostState struct {
+	ID            string            `json:"id,omitempty"`
+	Cluster       string            `json:"cluster"`
+	MachineID     string            `json:"machine_id"`
+	MachineName   string            `json:"machine_name,omitempty"`
+	MachineIP     string            `json:"machine_ip,omitempty"`
+	ProfileSource string            `json:"profile_source"`
+	Status        string            `json:"status"`
+	Passed        int               `json:"passed"`
+	Failed        int               `json:"failed"`
+	Unknown       int               `json:"unknown"`
+	Skipped       int               `json:"skipped"`
+	Fingerprint   string            `json:"fingerprint"`
+	Results       []CheckResult     `json:"results"`
+	Facts         map[string]string `json:"facts,omitempty"`
+	Errors        []string          `json:"errors,omitempty"`
+	CollectedAt   time.Time         `json:"collected_at"`
+	Stale         bool              `json:"stale,omitempty"`
+}
+
+type Repository interface {
+	GetProfile(ctx context.Context, cluster string) (Profile, bool, error)
+	SaveProfile(ctx context.Context, profile Profile) error
+	DeleteProfile(ctx context.Context, cluster string) error
+	ListProfiles(ctx context.Context) ([]Profile, error)
+
+	GetHostState(ctx context.Context, machineID string) (HostState, bool, error)
+	// SaveHostState replaces the latest state of the host and, when
+	// appendHistory is set, also appends it to the history.
+	SaveHostState(ctx context.Context, state HostState, appendHistory bool) error
+	ListHostStates(ctx context.Context, cluster string) ([]HostState, error)
+	DeleteHostState(ctx context.Context, machineID string) error
+	// ListHistory returns history rows of a host newest first without facts.
+	ListHistory(ctx context.Context, machineID string, limit int) ([]HostState, error)
+	LastHistoryAt(ctx context.Context, machineID string) (time.Time, bool, error)
+	PurgeHistory(ctx context.Context, before time.Time) (int64, error)
+}
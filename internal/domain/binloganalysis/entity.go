@@ -0,0 +1,98 @@
+package binloganalysis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	ScheduleInterval = "interval"
+	ScheduleDaily    = "daily"
+)
+
+// Analysis is one durable analysis run. Request, Summary and Report keep the
+// analyzer's JSON shapes; Report holds buckets, hot tables, big transactions
+// and DDL statements but not the per-event DML detail, which is only kept in
+// Manager memory while the run is recent.
+type Analysis struct {
+	ID          string          `json:"id"`
+	ScheduleID  string          `json:"schedule_id,omitempty"`
+	Cluster     string          `json:"cluster"`
+	MachineID   string          `json:"machine_id"`
+	Port        int             `json:"port"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	WindowStart time.Time       `json:"window_start"`
+	WindowEnd   time.Time       `json:"window_end"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Summary     json.RawMessage `json:"summary,omitempty"`
+	Report      json.RawMessage `json:"report,omitempty"`
+}
+
+// TableVolume is the write volume of one table within one completed analysis.
+// It is stored separately from Report so trends across weeks can be queried
+// without decoding every report.
+type TableVolume struct {
+	AnalysisID  string    `json:"analysis_id"`
+	ScheduleID  string    `json:"schedule_id,omitempty"`
+	Cluster     string    `json:"cluster"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	InsertRows  int64     `json:"insert_rows"`
+	UpdateRows  int64     `json:"update_rows"`
+	DeleteRows  int64     `json:"delete_rows"`
+	TotalRows   int64     `json:"total_rows"`
+	DDLCount    int64     `json:"ddl_count"`
+}
+
+// Schedule analyses the WindowHours before each run. An empty MachineID means
+// the cluster primary is resolved at run time, so the schedule keeps
+// following writes after a switchover. ExpectedDDL lists "schema.object" glob
+// patterns whose DDL does not raise an alert.
+type Schedule struct {
+	ID                   string    `json:"id"`
+	Name                 string    `json:"name"`
+	Cluster              string    `json:"cluster"`
+	MachineID            string    `json:"machine_id,omitempty"`
+	Port                 int       `json:"port,omitempty"`
+	WindowHours          int       `json:"window_hours"`
+	ScheduleType         string    `json:"schedule_type"`
+	IntervalMinutes      int       `json:"interval_minutes,omitempty"`
+	StartAt              time.Time `json:"start_at"`
+	BigTxnMode           string    `json:"big_txn_mode"`
+	BigTxnRowsThreshold  int       `json:"big_txn_rows_threshold"`
+	BigTxnBytesThreshold uint64    `json:"big_txn_bytes_threshold"`
+	AlertBigTransactions bool      `json:"alert_big_transactions"`
+	AlertDDL             bool      `json:"alert_ddl"`
+	ExpectedDDL          []string  `json:"expected_ddl"`
+	Enabled              bool      `json:"enabled"`
+	LastRunAt            time.Time `json:"last_run_at,omitempty"`
+	NextRunAt            time.Time `json:"next_run_at,omitempty"`
+	LastAnalysisID       string    `json:"last_analysis_id,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type Repository interface {
+	SaveAnalysis(context.Context, Analysis) error
+	GetAnalysis(context.Context, string) (Analysis, bool, error)
+	ListAnalyses(context.Context, string, int) ([]Analysis, error)
+	FailInterruptedAnalyses(context.Context, string, time.Time) (int64, error)
+	PurgeAnalyses(context.Context, time.Time) (int64, error)
+
+	SaveTableVolumes(context.Context, string, []TableVolume) error
+	ListTableVolumes(context.Context, string, string, time.Time) ([]TableVolume, error)
+
+	SaveSchedule(context.Context, Schedule) error
+	GetSchedule(context.Context, string) (Schedule, bool, error)
+	ListSchedules(context.Context, string) ([]Schedule, error)
+	ListDueSchedules(context.Context, time.Time) ([]Schedule, error)
+	UpdateScheduleRun(context.Context, string, time.Time, time.Time, bool, string) error
+	DeleteSchedule(context.Context, string) error
+}
@@ -0,0 +1,102 @@
+package capacity
+
+import (
+	"context"
+	"time"
+)
+
+// DayLayout is the resolution of the history: one sample per table and
+// instance per UTC day, the last capture of the day wins.
+const DayLayout = "2006-01-02"
+
+const (
+	ForecastOK           = "ok"
+	ForecastWarning      = "warning"
+	ForecastCritical     = "critical"
+	ForecastStable       = "stable"
+	ForecastInsufficient = "insufficient_data"
+	ForecastNoDisk       = "no_disk_metric"
+)
+
+// TableSample is the size of one table on one day as estimated by
+// information_schema.tables.
+type TableSample struct {
+	Cluster     string    `json:"cluster"`
+	MachineID   string    `json:"machine_id"`
+	Port        int       `json:"port"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table"`
+	Day         string    `json:"day"`
+	Rows        int64     `json:"rows"`
+	DataBytes   int64     `json:"data_bytes"`
+	IndexBytes  int64     `json:"index_bytes"`
+	FreeBytes   int64     `json:"free_bytes"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// InstanceSample sums the tables of an instance on one day together with the
+// usage of the filesystem holding its datadir.
+type InstanceSample struct {
+	Cluster            string    `json:"cluster"`
+	MachineID          string    `json:"machine_id"`
+	MachineName        string    `json:"machine_name,omitempty"`
+	MachineIP          string    `json:"machine_ip,omitempty"`
+	Port               int       `json:"port"`
+	Day                string    `json:"day"`
+	TableCount         int       `json:"table_count"`
+	Rows               int64     `json:"rows"`
+	TableBytes         int64     `json:"table_bytes"`
+	DataDir            string    `json:"data_dir,omitempty"`
+	DiskTotalBytes     int64     `json:"disk_total_bytes"`
+	DiskUsedBytes      int64     `json:"disk_used_bytes"`
+	DiskAvailableBytes int64     `json:"disk_available_bytes"`
+	CollectedAt        time.Time `json:"collected_at"`
+}
+
+// Forecast estimates when the datadir filesystem of an instance runs full.
+// The growth rate is the larger of table growth and filesystem growth, so
+// binlogs, undo and neighbouring instances on the same disk are not ignored.
+type Forecast struct {
+	Cluster                string     `json:"cluster"`
+	MachineID              string     `json:"machine_id"`
+	MachineName            string     `json:"machine_name,omitempty"`
+	MachineIP              string     `json:"machine_ip,omitempty"`
+	Port                   int        `json:"port"`
+	DataDir                string     `json:"data_dir,omitempty"`
+	Status                 string     `json:"status"`
+	Samples                int        `json:"samples"`
+	FirstDay               string     `json:"first_day,omitempty"`
+	LastDay                string     `json:"last_day,omitempty"`
+	TableBytes             int64      `json:"table_bytes"`
+	TableGrowthBytesPerDay float64    `json:"table_growth_bytes_per_day"`
+	DiskTotalBytes         int64      `json:"disk_total_bytes"`
+	DiskAvailableBytes     int64      `json:"disk_available_bytes"`
+	DiskGrowthBytesPerDay  float64    `json:"disk_growth_bytes_per_day"`
+	DaysToFull             *float64   `json:"days_to_full,omitempty"`
+	FullAt                 *time.Time `json:"full_at,omitempty"`
+}
+
+// TableGrowth is the growth of one table over the requested period.
+type TableGrowth struct {
+	Cluster            string  `json:"cluster"`
+	MachineID          string  `json:"machine_id"`
+	Port               int     `json:"port"`
+	Schema             string  `json:"schema"`
+	Table              string  `json:"table"`
+	FirstDay           string  `json:"first_day"`
+	LastDay            string  `json:"last_day"`
+	Rows               int64   `json:"rows"`
+	TotalBytes         int64   `json:"total_bytes"`
+	GrowthBytes        int64   `json:"growth_bytes"`
+	GrowthBytesPerDay  float64 `json:"growth_bytes_per_day"`
+	GrowthRowsPerDay   float64 `json:"growth_rows_per_day"`
+	ShareOfGrowthRatio float64 `json:"share_of_growth_ratio"`
+}
+
+type Repository interface {
+	// SaveSamples replaces the samples of the instance for sample.Day.
+	SaveSamples(context.Context, InstanceSample, []TableSample) error
+	ListInstanceSamples(ctx context.Context, machineID string, port int, sinceDay string) ([]InstanceSample, error)
+	ListTableSamples(ctx context.Context, cluster, sinceDay string) ([]TableSample, error)
+	Purge(ctx context.Context, beforeDay string) (int64, error)
+}
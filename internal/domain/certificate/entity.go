@@ -0,0 +1,111 @@
+// Package certificate models the Manager-owned certificate authority and the
+// per-instance MySQL server certificates it issues for client and
+// replication TLS.
+package certificate
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultCAValidityDays     = 3650
+	DefaultValidityDays       = 365
+	DefaultWarnDays           = 30
+	DefaultCriticalDays       = 7
+	DefaultDirectoryName      = "tls"
+	CAFileName                = "ca.pem"
+	CertFileName              = "server-cert.pem"
+	KeyFileName               = "server-key.pem"
+	StatusActive              = "active"
+	StatusSuperseded          = "superseded"
+	StatusFailed              = "failed"
+	ReasonInstall             = "install"
+	ReasonDeploy              = "deploy"
+	ReasonRotate              = "rotate"
+	DefaultAuthorityID        = "gmha-ca"
+	DefaultAuthorityName      = "GMHA MySQL CA"
+	DefaultCertificateOrgName = "GMHA"
+)
+
+// Authority is the Manager CA. The private key never leaves the Manager; only
+// CertPEM is distributed to instances as ca.pem.
+type Authority struct {
+	ID         string    `json:"id"`
+	CommonName string    `json:"common_name"`
+	Serial     string    `json:"serial"`
+	CertPEM    string    `json:"cert_pem"`
+	KeyPEM     string    `json:"key_pem,omitempty"`
+	NotBefore  time.Time `json:"not_before"`
+	NotAfter   time.Time `json:"not_after"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Redacted returns a copy that is safe to return from the API.
+func (a Authority) Redacted() Authority {
+	a.KeyPEM = ""
+	return a
+}
+
+// Certificate is one issued MySQL server certificate. At most one certificate
+// per machine and port is active; rotation marks the previous one superseded.
+type Certificate struct {
+	ID          string     `json:"id"`
+	ClusterID   string     `json:"cluster_id,omitempty"`
+	MachineID   string     `json:"machine_id"`
+	MachineName string     `json:"machine_name,omitempty"`
+	Host        string     `json:"host"`
+	Port        int        `json:"port"`
+	Serial      string     `json:"serial"`
+	CommonName  string     `json:"common_name"`
+	DNSNames    []string   `json:"dns_names,omitempty"`
+	IPAddresses []string   `json:"ip_addresses,omitempty"`
+	CertPEM     string     `json:"cert_pem"`
+	KeyPEM      string     `json:"key_pem,omitempty"`
+	Directory   string     `json:"directory"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	NotBefore   time.Time  `json:"not_before"`
+	NotAfter    time.Time  `json:"not_after"`
+	DeployedAt  *time.Time `json:"deployed_at,omitempty"`
+	ReloadedAt  *time.Time `json:"reloaded_at,omitempty"`
+	TaskID      string     `json:"task_id,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Redacted returns a copy without the private key.
+func (c Certificate) Redacted() Certificate {
+	c.KeyPEM = ""
+	return c
+}
+
+// DaysLeft reports whole days until expiry, negative once expired.
+func (c Certificate) DaysLeft(now time.Time) int {
+	return int(c.NotAfter.Sub(now).Hours() / 24)
+}
+
+// Policy is the per-cluster TLS configuration. ReplicationSSL makes GMHA add
+// SOURCE_SSL options whenever it (re)configures a replica of the cluster.
+type Policy struct {
+	ClusterID              string    `json:"cluster_id"`
+	ReplicationSSL         bool      `json:"replication_ssl"`
+	VerifyServerCert       bool      `json:"verify_server_cert"`
+	RequireSecureTransport bool      `json:"require_secure_transport"`
+	ValidityDays           int       `json:"validity_days"`
+	WarnDays               int       `json:"warn_days"`
+	CriticalDays           int       `json:"critical_days"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+type Repository interface {
+	GetAuthority(ctx context.Context, id string) (Authority, bool, error)
+	SaveAuthority(ctx context.Context, authority Authority) error
+	SaveCertificate(ctx context.Context, certificate Certificate) error
+	GetCertificate(ctx context.Context, id string) (Certificate, bool, error)
+	GetActiveCertificate(ctx context.Context, machineID string, port int) (Certificate, bool, error)
+	ListCertificates(ctx context.Context, clusterID string) ([]Certificate, error)
+	SavePolicy(ctx context.Context, policy Policy) error
+	GetPolicy(ctx context.Context, clusterID string) (Policy, bool, error)
+}
@@ -0,0 +1,149 @@
+package configdrift
+
+import (
+	"context"
+	"time"
+)
+
+// Finding kinds. Desired findings compare against the cluster's desired
+// parameter set; the others need no desired state.
+const (
+	KindDesiredRuntime    = "desired_runtime"
+	KindDesiredConfig     = "desired_config"
+	KindConfigRuntime     = "config_runtime"
+	KindPersistedOverride = "persisted_override"
+	KindClusterDivergence = "cluster_divergence"
+)
+
+const (
+	StatusInSync  = "in_sync"
+	StatusDrifted = "drifted"
+	StatusUnknown = "unknown"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// Desired is the parameter set every instance of a cluster should run with.
+// Ignore lists variables excluded from every comparison, e.g. a buffer pool
+// sized per machine.
+type Desired struct {
+	Cluster    string            `json:"cluster"`
+	Parameters map[string]string `json:"parameters"`
+	Ignore     []string          `json:"ignore,omitempty"`
+	UpdatedBy  string            `json:"updated_by,omitempty"`
+	UpdatedAt  time.Time         `json:"updated_at,omitempty"`
+}
+
+// InstanceReport is what the Agent collects for one local instance: the
+// [mysqld] options of the on-disk my.cnf, performance_schema.global_variables
+// and performance_schema.persisted_variables.
+type InstanceReport struct {
+	Port        int               `json:"port"`
+	ConfigPath  string            `json:"config_path,omitempty"`
+	Config      map[string]string `json:"config"`
+	ConfigError string            `json:"config_error,omitempty"`
+	Runtime     map[string]string `json:"runtime"`
+	Persisted   map[string]string `json:"persisted,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type Report struct {
+	MachineID string           `json:"machine_id"`
+	AgentID   string           `json:"agent_id,omitempty"`
+	Instances []InstanceReport `json:"instances"`
+}
+
+// ReportResponse hands the Agent the my.cnf path the Manager recorded for
+// each local instance at install time.
+type ReportResponse struct {
+	ConfigPaths map[int]string `json:"config_paths"`
+	Drifted     int            `json:"drifted"`
+}
+
+// Finding is one variable of one instance that does not match. Empty values
+// mean the source does not set the variable.
+type Finding struct {
+	Variable  string `json:"variable"`
+	Kind      string `json:"kind"`
+	Severity  string `json:"severity"`
+	Desired   string `json:"desired,omitempty"`
+	Config    string `json:"config,omitempty"`
+	Persisted string `json:"persisted,omitempty"`
+	Runtime   string `json:"runtime,omitempty"`
+	Reference string `json:"reference,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Snapshot is the latest report of one instance together with the findings
+// of its last evaluation.
+type Snapshot struct {
+	Cluster     string            `json:"cluster"`
+	MachineID   string            `json:"machine_id"`
+	MachineName string            `json:"machine_name,omitempty"`
+	MachineIP   string            `json:"machine_ip,omitempty"`
+	Port        int               `json:"port"`
+	ConfigPath  string            `json:"config_path,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+	Runtime     map[string]string `json:"runtime,omitempty"`
+	Persisted   map[string]string `json:"persisted,omitempty"`
+	Errors      []string          `json:"errors,omitempty"`
+	CollectedAt time.Time         `json:"collected_at"`
+	Findings    []Finding         `json:"findings"`
+	EvaluatedAt time.Time         `json:"evaluated_at,omitempty"`
+}
+
+// InstanceView is one instance in the cluster drift report.
+type InstanceView struct {
+	MachineID   string    `json:"machine_id"`
+	MachineName string    `json:"machine_name,omitempty"`
+	MachineIP   string    `json:"machine_ip,omitempty"`
+	Port        int       `json:"port"`
+	Role        string    `json:"role,omitempty"`
+	Status      string    `json:"status"`
+	Stale       bool      `json:"stale,omitempty"`
+	ConfigPath  string    `json:"config_path,omitempty"`
+	Errors      []string  `json:"errors,omitempty"`
+	CollectedAt time.Time `json:"collected_at"`
+	Findings    []Finding `json:"findings"`
+}
+
+// Divergence lists the runtime value of a variable on every node when the
+// nodes of a cluster disagree.
+type Divergence struct {
+	Variable string            `json:"variable"`
+	Values   []DivergenceValue `json:"values"`
+}
+
+type DivergenceValue struct {
+	MachineID   string `json:"machine_id"`
+	MachineName string `json:"machine_name,omitempty"`
+	Port        int    `json:"port"`
+	Role        string `json:"role,omitempty"`
+	Value       string `json:"value"`
+}
+
+type ClusterReport struct {
+	Cluster     string         `json:"cluster"`
+	Desired     Desired        `json:"desired"`
+	Status      string         `json:"status"`
+	Drifted     int            `json:"drifted"`
+	Instances   []InstanceView `json:"instances"`
+	Divergences []Divergence   `json:"divergences"`
+}
+
+type Repository interface {
+	GetDesired(ctx context.Context, cluster string) (Desired, bool, error)
+	SaveDesired(ctx context.Context, desired Desired) error
+	DeleteDesired(ctx context.Context, cluster string) error
+	ListDesired(ctx context.Context) ([]Desired, error)
+
+	GetSnapshot(ctx context.Context, machineID string, port int) (Snapshot, bool, error)
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	// ListSnapshots returns the snapshots of a cluster, or of every cluster
+	// when cluster is empty.
+	ListSnapshots(ctx context.Context, cluster string) ([]Snapshot, error)
+	DeleteSnapshot(ctx context.Context, machineID string, port int) error
+}
@@ -0,0 +1,134 @@
+package credrotation
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	StatusPlanned    = "planned"
+	StatusRunning    = "running"
+	StatusSucceeded  = "success"
+	StatusFailed     = "failed"
+	StatusRolledBack = "rolled_back"
+)
+
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "success"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// Phases run in this order. Discovery materializes the steps of every later
+// phase, so a retried rotation continues from the first unfinished step.
+const (
+	PhaseDiscover    = "discover"
+	PhaseAlter       = "alter"
+	PhaseAgent       = "agent"
+	PhaseReplication = "replication"
+	PhaseProxySQL    = "proxysql"
+	PhaseManager     = "manager"
+	PhaseVerify      = "verify"
+	PhaseDiscard     = "discard"
+)
+
+const (
+	TriggerManual   = "manual"
+	TriggerSchedule = "schedule"
+)
+
+// Account is one rotated preset role and the host entries found for its
+// user on the writable nodes.
+type Account struct {
+	Role     string   `json:"role"`
+	Username string   `json:"username"`
+	Hosts    []string `json:"hosts,omitempty"`
+}
+
+// StepAccount names one MySQL account touched by a step.
+type StepAccount struct {
+	Role     string `json:"role"`
+	Username string `json:"username"`
+	Host     string `json:"host,omitempty"`
+}
+
+// Step is one unit of a rotation: an instance, a replication channel, a
+// ProxySQL node or the Manager itself (empty MachineID).
+type Step struct {
+	Phase       string        `json:"phase"`
+	Cluster     string        `json:"cluster,omitempty"`
+	MachineID   string        `json:"machine_id,omitempty"`
+	MachineName string        `json:"machine_name,omitempty"`
+	MachineIP   string        `json:"machine_ip,omitempty"`
+	Port        int           `json:"port,omitempty"`
+	Role        string        `json:"role,omitempty"`
+	Accounts    []StepAccount `json:"accounts,omitempty"`
+	Channels    []string      `json:"channels,omitempty"`
+	Status      string        `json:"status"`
+	TaskID      string        `json:"task_id,omitempty"`
+	Message     string        `json:"message,omitempty"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+}
+
+// Secret holds the generated password of a role while a rotation is open.
+// Previous is the password the Manager stored before; a rollback rotates
+// back to it. Secrets are never serialized into the audit record and are
+// cleared once the rotation is closed.
+type Secret struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Previous string `json:"previous"`
+}
+
+// Rotation is the audit record of one password rotation across every
+// managed MySQL instance. Rollback rotations restore the passwords of a
+// failed rotation named by RollbackOf.
+type Rotation struct {
+	ID           string            `json:"id"`
+	Roles        []string          `json:"roles"`
+	Accounts     []Account         `json:"accounts"`
+	DualPassword bool              `json:"dual_password"`
+	Trigger      string            `json:"trigger"`
+	Rollback     bool              `json:"rollback,omitempty"`
+	RollbackOf   string            `json:"rollback_of,omitempty"`
+	Status       string            `json:"status"`
+	Phase        string            `json:"phase,omitempty"`
+	ParentTaskID string            `json:"parent_task_id,omitempty"`
+	Steps        []Step            `json:"steps"`
+	Warnings     []string          `json:"warnings,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	CreatedBy    string            `json:"created_by,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	FinishedAt   *time.Time        `json:"finished_at,omitempty"`
+	Secrets      map[string]Secret `json:"-"`
+}
+
+// Schedule rotates the configured roles every IntervalDays.
+type Schedule struct {
+	Enabled        bool      `json:"enabled"`
+	Roles          []string  `json:"roles"`
+	IntervalDays   int       `json:"interval_days"`
+	NextRunAt      time.Time `json:"next_run_at,omitempty"`
+	LastRunAt      time.Time `json:"last_run_at,omitempty"`
+	LastRotationID string    `json:"last_rotation_id,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+	UpdatedBy      string    `json:"updated_by,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Repository interface {
+	GetRotation(ctx context.Context, id string) (Rotation, bool, error)
+	// SaveRotation stores the record together with its secrets; a nil or
+	// empty Secrets map clears them.
+	SaveRotation(ctx context.Context, rotation Rotation) error
+	// ListRotations returns the newest rotations first; an empty status
+	// lists every status.
+	ListRotations(ctx context.Context, status string, limit int) ([]Rotation, error)
+
+	GetSchedule(ctx context.Context) (Schedule, bool, error)
+	SaveSchedule(ctx context.Context, schedule Schedule) error
+}
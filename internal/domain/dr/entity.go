@@ -0,0 +1,102 @@
+// Package dr models cross-cluster disaster-recovery links: the primary of a
+// DR cluster replicating from a source cluster over a dedicated channel, its
+// health, and the promotions that turn the DR cluster into the writer.
+package dr
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ChannelName                  = "gmha_dr"
+	DefaultMaxLagSeconds         = 300
+	DefaultCatchUpTimeoutSeconds = 300
+	SourceModeVIP                = "vip"
+	SourceModePrimary            = "primary"
+	StatusConfiguring            = "configuring"
+	StatusRunning                = "running"
+	StatusPromoting              = "promoting"
+	StatusPromoted               = "promoted"
+	StatusFailed                 = "failed"
+	PromotionRunning             = "running"
+	PromotionSucceeded           = "succeeded"
+	PromotionFailed              = "failed"
+)
+
+// Link replicates SourceClusterID into TargetClusterID. The DR primary
+// (TargetMachineID) is a read-only replica of the source endpoint on
+// ChannelName; the DR cluster's own replicas keep following the DR primary.
+type Link struct {
+	ID              string     `json:"id"`
+	Name            string     `json:"name"`
+	SourceClusterID string     `json:"source_cluster_id"`
+	TargetClusterID string     `json:"target_cluster_id"`
+	SourceMode      string     `json:"source_mode"`
+	SourceHost      string     `json:"source_host"`
+	SourcePort      int        `json:"source_port"`
+	SourceMachineID string     `json:"source_machine_id,omitempty"`
+	TargetMachineID string     `json:"target_machine_id"`
+	TargetHost      string     `json:"target_host"`
+	TargetPort      int        `json:"target_port"`
+	MaxLagSeconds   int        `json:"max_lag_seconds"`
+	ReversedFrom    string     `json:"reversed_from,omitempty"`
+	Status          string     `json:"status"`
+	Health          LinkHealth `json:"health"`
+	LastTaskID      string     `json:"last_task_id,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// LinkHealth is the last observation of the DR channel. GTIDGap counts source
+// transactions not yet executed on the DR primary; -1 means the source could
+// not be read.
+type LinkHealth struct {
+	CheckedAt       *time.Time `json:"checked_at,omitempty"`
+	IORunning       bool       `json:"io_running"`
+	SQLRunning      bool       `json:"sql_running"`
+	LagSeconds      int64      `json:"lag_seconds"`
+	SourceGTIDSet   string     `json:"source_gtid_set,omitempty"`
+	ExecutedGTIDSet string     `json:"executed_gtid_set,omitempty"`
+	ReceivedGTIDSet string     `json:"received_gtid_set,omitempty"`
+	GTIDGap         int64      `json:"gtid_gap"`
+	Healthy         bool       `json:"healthy"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// Promotion records one "promote DR cluster" run and its recovery point.
+// RPOExact is true when the source was reachable and the DR primary caught up
+// to its final GTID set before the link was broken.
+type Promotion struct {
+	ID                     string     `json:"id"`
+	LinkID                 string     `json:"link_id"`
+	SourceClusterID        string     `json:"source_cluster_id"`
+	TargetClusterID        string     `json:"target_cluster_id"`
+	Status                 string     `json:"status"`
+	Force                  bool       `json:"force"`
+	Reverse                bool       `json:"reverse"`
+	SourceReachable        bool       `json:"source_reachable"`
+	LastAppliedGTIDSet     string     `json:"last_applied_gtid_set,omitempty"`
+	LastAppliedTransaction string     `json:"last_applied_transaction,omitempty"`
+	LastAppliedCommitAt    *time.Time `json:"last_applied_commit_at,omitempty"`
+	MissingGTIDSet         string     `json:"missing_gtid_set,omitempty"`
+	MissingTransactions    int64      `json:"missing_transactions"`
+	RPOSeconds             int64      `json:"rpo_seconds"`
+	RPOExact               bool       `json:"rpo_exact"`
+	ReverseLinkID          string     `json:"reverse_link_id,omitempty"`
+	TaskID                 string     `json:"task_id,omitempty"`
+	Steps                  []string   `json:"steps,omitempty"`
+	Error                  string     `json:"error,omitempty"`
+	StartedAt              time.Time  `json:"started_at"`
+	FinishedAt             *time.Time `json:"finished_at,omitempty"`
+}
+
+type Repository interface {
+	SaveLink(ctx context.Context, link Link) error
+	GetLink(ctx context.Context, id string) (Link, bool, error)
+	ListLinks(ctx context.Context) ([]Link, error)
+	DeleteLink(ctx context.Context, id string) error
+	SavePromotion(ctx context.Context, promotion Promotion) error
+	ListPromotions(ctx context.Context, linkID string, limit int) ([]Promotion, error)
+}
@@ -80,9 +80,18 @@ type ArchitectureAdjustmentPlan struct {
 	Executable                bool                   `json:"executable"`
 	BlockingReasons           []string               `json:"blocking_reasons,omitempty"`
 	Warnings                  []string               `json:"warnings,omitempty"`
+	RebuildSuggestions        []RebuildSuggestion    `json:"rebuild_suggestions,omitempty"`
 	CreatedAt                 time.Time              `json:"created_at"`
 }
 
+// RebuildSuggestion 指向一个应先通过副本重建修复、再参与架构调整的节点。
+type RebuildSuggestion struct {
+	MachineID string `json:"machine_id"`
+	Port      int    `json:"port,omitempty"`
+	Reason    string `json:"reason"`
+	Endpoint  string `json:"endpoint"`
+}
+
 // ArchitectureRun 保存一次在线架构调整的可审计状态。密码不会写入该结构或数据库。
 type ArchitectureRun struct {
 	RunID          string                        `json:"run_id"`
@@ -0,0 +1,72 @@
+package ha
+
+import "time"
+
+const (
+	SwitchoverTargetExplicit = "explicit"
+	SwitchoverTargetBest     = "best"
+
+	SwitchoverPending        = "pending"
+	SwitchoverRunning        = "running"
+	SwitchoverSucceeded      = "success"
+	SwitchoverAborted        = "aborted"
+	SwitchoverRolledBack     = "rolled_back"
+	SwitchoverRollbackFailed = "rollback_failed"
+	SwitchoverFailed         = "failed"
+
+	SwitchoverPhasePreflight = "preflight"
+	SwitchoverPhaseFence     = "fence_old_primary"
+	SwitchoverPhasePromote   = "catch_up_and_promote"
+	SwitchoverPhaseRouting   = "switch_routing"
+	SwitchoverPhaseRepoint   = "repoint_replicas"
+	SwitchoverPhaseVerify    = "verify"
+	SwitchoverPhaseRollback  = "rollback"
+)
+
+// SwitchoverRequest 描述一次计划内主从切换。Confirm 必须等于集群名。
+type SwitchoverRequest struct {
+	TargetMode      string `json:"target_mode"`
+	TargetMachineID string `json:"target_machine_id,omitempty"`
+	TargetPort      int    `json:"target_port,omitempty"`
+	MaxLagSeconds   int    `json:"max_lag_seconds"`
+	FreezeBudgetMS  int64  `json:"freeze_budget_ms"`
+	MoveVIP         *bool  `json:"move_vip,omitempty"`
+	Confirm         string `json:"confirm,omitempty"`
+}
+
+// SwitchoverPhase 是切换中单个阶段的耗时记录。
+type SwitchoverPhase struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	Detail     string    `json:"detail,omitempty"`
+	TaskIDs    []string  `json:"task_ids,omitempty"`
+}
+
+// Switchover 记录一次计划内切换的选择结果、各阶段耗时与写入中断时长。
+// WriteFreezeMS 从旧主进入只读开始，到新主可写且路由切换完成为止。
+type Switchover struct {
+	SwitchoverID        string            `json:"switchover_id"`
+	ClusterID           string            `json:"cluster_id"`
+	Status              string            `json:"status"`
+	TargetMode          string            `json:"target_mode"`
+	MaxLagSeconds       int               `json:"max_lag_seconds"`
+	FreezeBudgetMS      int64             `json:"freeze_budget_ms"`
+	MoveVIP             bool              `json:"move_vip"`
+	OldPrimaryMachineID string            `json:"old_primary_machine_id,omitempty"`
+	OldPrimaryEndpoint  string            `json:"old_primary_endpoint,omitempty"`
+	NewPrimaryMachineID string            `json:"new_primary_machine_id,omitempty"`
+	NewPrimaryEndpoint  string            `json:"new_primary_endpoint,omitempty"`
+	TargetLagSeconds    int               `json:"target_lag_seconds"`
+	FenceGTIDSet        string            `json:"fence_gtid_set,omitempty"`
+	WriteFreezeMS       int64             `json:"write_freeze_ms"`
+	WithinBudget        bool              `json:"within_budget"`
+	RolledBack          bool              `json:"rolled_back"`
+	Phases              []SwitchoverPhase `json:"phases"`
+	TaskID              string            `json:"task_id,omitempty"`
+	Error               string            `json:"error,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	FinishedAt          *time.Time        `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,155 @@
+package paramtemplate
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	RolloutPlanned   = "planned"
+	RolloutRunning   = "running"
+	RolloutSucceeded = "success"
+	RolloutFailed    = "failed"
+)
+
+const (
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "success"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// Template is a named parameter set. Its content lives in immutable
+// versions; LatestVersion is the highest one created.
+type Template struct {
+	Name          string    `json:"name"`
+	Description   string    `json:"description,omitempty"`
+	LatestVersion int       `json:"latest_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Version is one immutable revision of a template. BaseProfile names a YAML
+// profile under configs/profiles/mysql whose memory-derived values are
+// calculated per machine; Parameters override or extend them.
+type Version struct {
+	Template    string            `json:"template"`
+	Version     int               `json:"version"`
+	BaseProfile string            `json:"base_profile,omitempty"`
+	Parameters  map[string]string `json:"parameters"`
+	Comment     string            `json:"comment,omitempty"`
+	CreatedBy   string            `json:"created_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Attachment binds a cluster to a template. Version is the version last
+// rolled out successfully (0 before the first rollout) and PreviousVersion
+// the one a rollback returns to.
+type Attachment struct {
+	Cluster         string    `json:"cluster"`
+	Template        string    `json:"template"`
+	Version         int       `json:"version"`
+	PreviousVersion int       `json:"previous_version,omitempty"`
+	RolloutID       string    `json:"rollout_id,omitempty"`
+	UpdatedBy       string    `json:"updated_by,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Change is one parameter of one instance. Restart is set when the runtime
+// value differs and the variable is not dynamic.
+type Change struct {
+	Name    string `json:"name"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Dynamic bool   `json:"dynamic"`
+	Restart bool   `json:"restart,omitempty"`
+}
+
+// RolloutStep is one instance of a rollout. Parameters are the resolved
+// template values for the instance; Changes are what actually differed when
+// the step ran (or, in a plan, what the latest Agent report suggests).
+type RolloutStep struct {
+	MachineID    string            `json:"machine_id"`
+	MachineName  string            `json:"machine_name,omitempty"`
+	MachineIP    string            `json:"machine_ip,omitempty"`
+	Port         int               `json:"port"`
+	Role         string            `json:"role,omitempty"`
+	Parameters   map[string]string `json:"parameters"`
+	Changes      []Change          `json:"changes"`
+	Restart      bool              `json:"restart"`
+	Status       string            `json:"status"`
+	ApplyTaskID  string            `json:"apply_task_id,omitempty"`
+	VerifyTaskID string            `json:"verify_task_id,omitempty"`
+	Message      string            `json:"message,omitempty"`
+	StartedAt    *time.Time        `json:"started_at,omitempty"`
+	FinishedAt   *time.Time        `json:"finished_at,omitempty"`
+}
+
+// Rollout applies one template version to a cluster, one instance at a time
+// with replicas first and the primary last.
+type Rollout struct {
+	ID               string        `json:"id"`
+	Cluster          string        `json:"cluster"`
+	Template         string        `json:"template"`
+	FromVersion      int           `json:"from_version"`
+	ToVersion        int           `json:"to_version"`
+	Rollback         bool          `json:"rollback,omitempty"`
+	RestartConfirmed bool          `json:"restart_confirmed,omitempty"`
+	Status           string        `json:"status"`
+	ParentTaskID     string        `json:"parent_task_id,omitempty"`
+	Steps            []RolloutStep `json:"steps"`
+	Warnings         []string      `json:"warnings,omitempty"`
+	Error            string        `json:"error,omitempty"`
+	CreatedBy        string        `json:"created_by,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+	FinishedAt       *time.Time    `json:"finished_at,omitempty"`
+}
+
+// InstanceChange is the per-instance history entry of a rollout step.
+type InstanceChange struct {
+	ID           string    `json:"id"`
+	MachineID    string    `json:"machine_id"`
+	Port         int       `json:"port"`
+	Cluster      string    `json:"cluster"`
+	Template     string    `json:"template"`
+	FromVersion  int       `json:"from_version"`
+	ToVersion    int       `json:"to_version"`
+	Rollback     bool      `json:"rollback,omitempty"`
+	RolloutID    string    `json:"rollout_id"`
+	ApplyTaskID  string    `json:"apply_task_id,omitempty"`
+	VerifyTaskID string    `json:"verify_task_id,omitempty"`
+	Changes      []Change  `json:"changes"`
+	Restarted    bool      `json:"restarted,omitempty"`
+	Status       string    `json:"status"`
+	Message      string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Repository interface {
+	GetTemplate(ctx context.Context, name string) (Template, bool, error)
+	SaveTemplate(ctx context.Context, template Template) error
+	ListTemplates(ctx context.Context) ([]Template, error)
+	// DeleteTemplate removes the template with all of its versions.
+	DeleteTemplate(ctx context.Context, name string) error
+
+	GetVersion(ctx context.Context, template string, version int) (Version, bool, error)
+	SaveVersion(ctx context.Context, version Version) error
+	ListVersions(ctx context.Context, template string) ([]Version, error)
+
+	GetAttachment(ctx context.Context, cluster string) (Attachment, bool, error)
+	SaveAttachment(ctx context.Context, attachment Attachment) error
+	DeleteAttachment(ctx context.Context, cluster string) error
+	ListAttachments(ctx context.Context) ([]Attachment, error)
+
+	GetRollout(ctx context.Context, id string) (Rollout, bool, error)
+	SaveRollout(ctx context.Context, rollout Rollout) error
+	// ListRollouts returns the newest rollouts first; an empty cluster lists
+	// every cluster and an empty status every status.
+	ListRollouts(ctx context.Context, cluster, status string, limit int) ([]Rollout, error)
+
+	AppendInstanceChange(ctx context.Context, change InstanceChange) error
+	// ListInstanceChanges returns the newest entries of an instance first.
+	ListInstanceChanges(ctx context.Context, machineID string, port int, limit int) ([]InstanceChange, error)
+}
@@ -0,0 +1,150 @@
+// Package proxysql 定义 ProxySQL 路由层的领域模型。
+// GMHA 通过 Agent 在代理节点上部署 ProxySQL，并根据集群拓扑维护写/读主机组、
+// 业务账号和查询路由规则；切换完成后由架构执行器原子地刷新后端集合。
+package proxysql
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultAdminPort                = 6032
+	DefaultListenPort               = 6033
+	DefaultWriterHostgroup          = 10
+	DefaultReaderHostgroup          = 20
+	DefaultMaxReplicationLagSeconds = 30
+
+	DestinationWriter = "writer"
+	DestinationReader = "reader"
+
+	SyncReasonManual       = "manual"
+	SyncReasonDeploy       = "deploy"
+	SyncReasonArchitecture = "architecture"
+
+	SyncStatusSuccess = "success"
+	SyncStatusFailed  = "failed"
+
+	DriftMissing    = "missing"
+	DriftUnexpected = "unexpected"
+	DriftStatus     = "status"
+)
+
+// User 是需要在 ProxySQL mysql_users 中维护的业务账号。
+type User struct {
+	Username         string `json:"username"`
+	Password         string `json:"password,omitempty"`
+	DefaultHostgroup int    `json:"default_hostgroup,omitempty"`
+	MaxConnections   int    `json:"max_connections,omitempty"`
+	Active           bool   `json:"active"`
+}
+
+// QueryRule 对应 mysql_query_rules 中的一条路由规则。Destination 使用
+// writer/reader 引用集群的写/读主机组，切换后无需改写规则。
+type QueryRule struct {
+	RuleID       int    `json:"rule_id"`
+	Active       bool   `json:"active"`
+	Username     string `json:"username,omitempty"`
+	MatchDigest  string `json:"match_digest,omitempty"`
+	MatchPattern string `json:"match_pattern,omitempty"`
+	Destination  string `json:"destination"`
+	Apply        bool   `json:"apply"`
+	Comment      string `json:"comment,omitempty"`
+}
+
+// Config 是一个集群的 ProxySQL 路由配置。AdminPassword 与账号密码只在
+// Manager 内部使用，对外展示时由 Redacted 去除。
+type Config struct {
+	ClusterID                string      `json:"cluster_id"`
+	Enabled                  bool        `json:"enabled"`
+	ProxyMachineIDs          []string    `json:"proxy_machine_ids"`
+	AdminPort                int         `json:"admin_port"`
+	AdminUser                string      `json:"admin_user"`
+	AdminPassword            string      `json:"admin_password,omitempty"`
+	ListenPort               int         `json:"listen_port"`
+	BackendPort              int         `json:"backend_port"`
+	WriterHostgroup          int         `json:"writer_hostgroup"`
+	ReaderHostgroup          int         `json:"reader_hostgroup"`
+	ReadersIncludePrimary    bool        `json:"readers_include_primary"`
+	MaxReplicationLagSeconds int         `json:"max_replication_lag_seconds"`
+	Users                    []User      `json:"users"`
+	QueryRules               []QueryRule `json:"query_rules"`
+	CreatedAt                time.Time   `json:"created_at"`
+	UpdatedAt                time.Time   `json:"updated_at"`
+}
+
+// Redacted 返回去除管理口令和账号密码后的配置副本。
+func (c Config) Redacted() Config {
+	out := c
+	out.AdminPassword = ""
+	out.Users = make([]User, len(c.Users))
+	for index, user := range c.Users {
+		user.Password = ""
+		out.Users[index] = user
+	}
+	out.ProxyMachineIDs = append([]string(nil), c.ProxyMachineIDs...)
+	out.QueryRules = append([]QueryRule(nil), c.QueryRules...)
+	return out
+}
+
+// Backend 是一个 MySQL 后端在某个主机组中的期望或运行时状态。
+type Backend struct {
+	Hostgroup int    `json:"hostgroup_id"`
+	Hostname  string `json:"hostname"`
+	Port      int    `json:"port"`
+	Status    string `json:"status,omitempty"`
+	MachineID string `json:"machine_id,omitempty"`
+}
+
+// SyncEvent 记录一次后端集合刷新，便于在切换审计中追溯路由变化。
+type SyncEvent struct {
+	ID               string    `json:"id"`
+	ClusterID        string    `json:"cluster_id"`
+	Reason           string    `json:"reason"`
+	RunID            string    `json:"run_id,omitempty"`
+	PrimaryMachineID string    `json:"primary_machine_id,omitempty"`
+	Backends         []Backend `json:"backends"`
+	TaskIDs          []string  `json:"task_ids,omitempty"`
+	Status           string    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Drift 描述 ProxySQL 运行时后端与 GMHA 拓扑之间的一处差异。
+type Drift struct {
+	Kind     string  `json:"kind"`
+	Expected Backend `json:"expected"`
+	Actual   Backend `json:"actual"`
+	Message  string  `json:"message"`
+}
+
+// NodeHealth 是单个代理节点的运行时检查结果。
+type NodeHealth struct {
+	MachineID   string    `json:"machine_id"`
+	MachineName string    `json:"machine_name,omitempty"`
+	MachineIP   string    `json:"machine_ip,omitempty"`
+	Reachable   bool      `json:"reachable"`
+	Runtime     []Backend `json:"runtime_servers"`
+	Drift       []Drift   `json:"drift"`
+	TaskID      string    `json:"task_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// HealthReport 汇总集群所有代理节点的漂移检查结果。
+type HealthReport struct {
+	ClusterID        string       `json:"cluster_id"`
+	PrimaryMachineID string       `json:"primary_machine_id,omitempty"`
+	Expected         []Backend    `json:"expected_servers"`
+	Nodes            []NodeHealth `json:"nodes"`
+	Healthy          bool         `json:"healthy"`
+	CheckedAt        time.Time    `json:"checked_at"`
+}
+
+type Repository interface {
+	SaveConfig(context.Context, Config) error
+	GetConfig(context.Context, string) (Config, bool, error)
+	ListConfigs(context.Context) ([]Config, error)
+	DeleteConfig(context.Context, string) error
+	SaveSyncEvent(context.Context, SyncEvent) error
+	ListSyncEvents(context.Context, string, int) ([]SyncEvent, error)
+}
@@ -0,0 +1,98 @@
+package schemachange
+
+import (
+	"context"
+	"time"
+
+	taskdomain "gmha/internal/domain/task"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusLinted    = "linted"
+	StatusApproved  = "approved"
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusRejected  = "rejected"
+
+	LevelError   = "error"
+	LevelWarning = "warning"
+)
+
+// Options are the pt-online-schema-change load gates the change runs with.
+type Options struct {
+	MaxLoadThreadsRunning  int     `json:"max_load_threads_running"`
+	CriticalThreadsRunning int     `json:"critical_threads_running"`
+	MaxLagSeconds          int     `json:"max_lag_seconds"`
+	ChunkTimeSeconds       float64 `json:"chunk_time_seconds"`
+	CheckIntervalSeconds   int     `json:"check_interval_seconds"`
+	AlterForeignKeysMethod string  `json:"alter_foreign_keys_method"`
+}
+
+// Finding is one lint result. Errors block approval; warnings are for the
+// reviewer to weigh.
+type Finding struct {
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Event is one entry of the audit trail of a change request.
+type Event struct {
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// Request is a reviewed single-table ALTER executed through the online DDL
+// task. The dry-run and execute commands are built when the request is drafted,
+// so the approved commands are exactly what runs in the window.
+type Request struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Cluster     string    `json:"cluster"`
+	MachineID   string    `json:"machine_id"`
+	MachineName string    `json:"machine_name,omitempty"`
+	MachineIP   string    `json:"machine_ip,omitempty"`
+	Port        int       `json:"port"`
+	Schema      string    `json:"schema"`
+	Table       string    `json:"table"`
+	Alter       string    `json:"alter"`
+	Purpose     string    `json:"purpose"`
+	Impact      string    `json:"impact"`
+	Options     Options   `json:"options"`
+	SubmittedBy string    `json:"submitted_by"`
+	Status      string    `json:"status"`
+	Findings    []Finding `json:"findings"`
+	// LintedAt is nil until the request was submitted for review.
+	LintedAt      *time.Time `json:"linted_at,omitempty"`
+	DryRunTaskID  string     `json:"dry_run_task_id,omitempty"`
+	DryRunStatus  string     `json:"dry_run_status,omitempty"`
+	ApprovedBy    string     `json:"approved_by,omitempty"`
+	ApprovedAt    *time.Time `json:"approved_at,omitempty"`
+	WindowStart   *time.Time `json:"window_start,omitempty"`
+	WindowEnd     *time.Time `json:"window_end,omitempty"`
+	ExecuteTaskID string     `json:"execute_task_id,omitempty"`
+	Message       string     `json:"message,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	History       []Event    `json:"history"`
+
+	DryRunCommands  []taskdomain.ExecCommandStep `json:"-"`
+	ExecuteCommands []taskdomain.ExecCommandStep `json:"-"`
+}
+
+type Repository interface {
+	Save(context.Context, Request) error
+	Get(context.Context, string) (Request, bool, error)
+	List(context.Context, string, string, int) ([]Request, error)
+	ListByStatus(context.Context, ...string) ([]Request, error)
+}
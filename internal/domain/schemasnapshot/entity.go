@@ -0,0 +1,128 @@
+package schemasnapshot
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	ObjectSchema     = "schema"
+	ObjectTable      = "table"
+	ObjectColumn     = "column"
+	ObjectIndex      = "index"
+	ObjectConstraint = "constraint"
+	ObjectOptions    = "table_options"
+	ObjectView       = "view"
+	ObjectTrigger    = "trigger"
+	ObjectRoutine    = "routine"
+
+	// ChangeMissing objects exist only in the diff source, ChangeExtra only in
+	// the target; reconcile DDL always turns the target into the source.
+	ChangeMissing = "missing"
+	ChangeExtra   = "extra"
+	ChangeChanged = "changed"
+)
+
+// Definition is the captured schema of one instance, system schemas
+// excluded. Table parts keep the exact SHOW CREATE TABLE line so reconcile
+// DDL can reuse it verbatim.
+type Definition struct {
+	Schemas []Schema `json:"schemas"`
+}
+
+type Schema struct {
+	Name      string    `json:"name"`
+	Charset   string    `json:"charset"`
+	Collation string    `json:"collation"`
+	Tables    []Table   `json:"tables"`
+	Views     []Object  `json:"views,omitempty"`
+	Triggers  []Object  `json:"triggers,omitempty"`
+	Routines  []Routine `json:"routines,omitempty"`
+}
+
+type Table struct {
+	Name        string `json:"name"`
+	Columns     []Part `json:"columns"`
+	Indexes     []Part `json:"indexes,omitempty"`
+	Constraints []Part `json:"constraints,omitempty"`
+	// Options is the text after the closing parenthesis (engine, charset,
+	// comment, partitioning) with AUTO_INCREMENT removed.
+	Options   string `json:"options"`
+	CreateSQL string `json:"create_sql"`
+}
+
+// Part is one column, index or constraint line of a table definition.
+type Part struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+type Object struct {
+	Name      string `json:"name"`
+	Table     string `json:"table,omitempty"`
+	CreateSQL string `json:"create_sql"`
+}
+
+type Routine struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	CreateSQL string `json:"create_sql"`
+}
+
+// Snapshot is one version of an instance schema. A new version is only
+// stored when the checksum changes; CheckedAt records the last capture that
+// found the same schema.
+type Snapshot struct {
+	ID            string     `json:"id"`
+	Cluster       string     `json:"cluster"`
+	MachineID     string     `json:"machine_id"`
+	MachineName   string     `json:"machine_name,omitempty"`
+	MachineIP     string     `json:"machine_ip,omitempty"`
+	Port          int        `json:"port"`
+	Role          string     `json:"role,omitempty"`
+	ServerVersion string     `json:"server_version,omitempty"`
+	Checksum      string     `json:"checksum"`
+	SchemaCount   int        `json:"schema_count"`
+	TableCount    int        `json:"table_count"`
+	ObjectCount   int        `json:"object_count"`
+	Warnings      []string   `json:"warnings,omitempty"`
+	TakenAt       time.Time  `json:"taken_at"`
+	CheckedAt     time.Time  `json:"checked_at"`
+	Definition    Definition `json:"definition"`
+}
+
+type DiffItem struct {
+	ObjectType string `json:"object_type"`
+	Change     string `json:"change"`
+	Schema     string `json:"schema"`
+	Table      string `json:"table,omitempty"`
+	Name       string `json:"name"`
+	Source     string `json:"source,omitempty"`
+	Target     string `json:"target,omitempty"`
+	// DDL applied to the target reconciles this item. Destructive marks
+	// statements that drop objects or columns.
+	DDL         []string `json:"ddl,omitempty"`
+	Destructive bool     `json:"destructive,omitempty"`
+	Note        string   `json:"note,omitempty"`
+}
+
+type Diff struct {
+	Items   []DiffItem `json:"items"`
+	Missing int        `json:"missing"`
+	Extra   int        `json:"extra"`
+	Changed int        `json:"changed"`
+}
+
+// Equal reports whether the two definitions had no differences.
+func (d Diff) Equal() bool {
+	return len(d.Items) == 0
+}
+
+type Repository interface {
+	SaveSnapshot(context.Context, Snapshot) error
+	TouchSnapshot(context.Context, string, string, time.Time) error
+	GetSnapshot(context.Context, string) (Snapshot, bool, error)
+	LatestSnapshot(context.Context, string, int) (Snapshot, bool, error)
+	ListSnapshots(context.Context, string, string, int, int) ([]Snapshot, error)
+	PurgeSnapshots(context.Context, time.Time) (int64, error)
+}
@@ -111,6 +111,7 @@ type StatementEventQuery struct {
 	Machine           string
 	Port              int
 	Database          string
+	Digest            string
 	Keyword           string
 	Limit             int
 }
@@ -168,12 +169,79 @@ type KillAudit struct {
 	ClientHost        string     `json:"client_host"`
 	Reason            string     `json:"reason"`
 	RequestSource     string     `json:"request_source"`
+	Scope             string     `json:"scope"`
+	PolicyID          string     `json:"policy_id,omitempty"`
 	Status            string     `json:"status"`
 	Error             string     `json:"error,omitempty"`
 	RequestedAt       time.Time  `json:"requested_at"`
 	CompletedAt       *time.Time `json:"completed_at,omitempty"`
 }
 
+const (
+	KillScopeQuery      = "query"
+	KillScopeConnection = "connection"
+
+	LockKindRow      = "row"
+	LockKindMetadata = "metadata"
+)
+
+// LockWait is one "waiting session -> blocking session" edge sampled from
+// data_lock_waits (innodb_lock_waits before 8.0) or metadata_locks.
+// ProcessID is the processlist id; ThreadID is the performance_schema thread.
+type LockWait struct {
+	ID                   string    `json:"id"`
+	Instance             Instance  `json:"instance"`
+	CollectedAt          time.Time `json:"collected_at"`
+	Kind                 string    `json:"kind"`
+	WaitingProcessID     uint64    `json:"waiting_process_id"`
+	WaitingThreadID      uint64    `json:"waiting_thread_id,omitempty"`
+	WaitingTrxID         string    `json:"waiting_trx_id,omitempty"`
+	WaitingUser          string    `json:"waiting_user"`
+	WaitingHost          string    `json:"waiting_host"`
+	WaitingSQL           string    `json:"waiting_sql"`
+	WaitMS               int64     `json:"wait_ms"`
+	BlockingProcessID    uint64    `json:"blocking_process_id"`
+	BlockingThreadID     uint64    `json:"blocking_thread_id,omitempty"`
+	BlockingTrxID        string    `json:"blocking_trx_id,omitempty"`
+	BlockingUser         string    `json:"blocking_user"`
+	BlockingHost         string    `json:"blocking_host"`
+	BlockingCommand      string    `json:"blocking_command"`
+	BlockingSQL          string    `json:"blocking_sql"`
+	BlockingTrxStartedAt time.Time `json:"blocking_trx_started_at,omitempty"`
+	ObjectType           string    `json:"object_type"`
+	ObjectSchema         string    `json:"object_schema"`
+	ObjectName           string    `json:"object_name"`
+	IndexName            string    `json:"index_name,omitempty"`
+	LockMode             string    `json:"lock_mode"`
+	BlockingLockMode     string    `json:"blocking_lock_mode,omitempty"`
+}
+
+// DeadlockTransaction is one participant of an InnoDB deadlock as printed in
+// SHOW ENGINE INNODB STATUS.
+type DeadlockTransaction struct {
+	Index      int    `json:"index"`
+	TrxID      string `json:"trx_id"`
+	ProcessID  uint64 `json:"process_id"`
+	User       string `json:"user"`
+	ClientHost string `json:"client_host"`
+	Statement  string `json:"statement"`
+	HoldsLock  string `json:"holds_lock,omitempty"`
+	WaitsFor   string `json:"waits_for,omitempty"`
+	RolledBack bool   `json:"rolled_back"`
+}
+
+// DeadlockReport is the LATEST DETECTED DEADLOCK section of one instance.
+// The same deadlock is reported on every cycle until a newer one replaces
+// it, so ID is derived from the instance and the section text.
+type DeadlockReport struct {
+	ID           string                `json:"id"`
+	Instance     Instance              `json:"instance"`
+	DetectedAt   time.Time             `json:"detected_at"`
+	Transactions []DeadlockTransaction `json:"transactions"`
+	Raw          string                `json:"raw,omitempty"`
+	CollectedAt  time.Time             `json:"collected_at"`
+}
+
 func itoa(value int) string {
 	if value == 0 {
 		return "0"
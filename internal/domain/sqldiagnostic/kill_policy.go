@@ -0,0 +1,42 @@
+package sqldiagnostic
+
+import "time"
+
+const (
+	KillTargetQuery           = "query"
+	KillTargetIdleTransaction = "idle_transaction"
+
+	InstanceRoleAny     = "any"
+	InstanceRolePrimary = "primary"
+	InstanceRoleReplica = "replica"
+
+	// KillStatusDryRun marks an audit row a dry-run policy wrote instead of
+	// issuing the kill.
+	KillStatusDryRun = "dry_run"
+)
+
+// KillPolicy kills sessions that satisfy every configured condition during
+// the collection cycle. Text conditions are case-insensitive MySQL LIKE
+// patterns and a list matches when any entry matches; empty lists match all.
+// Target "query" issues KILL QUERY against running statements, while
+// "idle_transaction" issues KILL CONNECTION against Sleep sessions with an
+// open InnoDB transaction, whose elapsed time is the transaction age.
+type KillPolicy struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Enabled           bool      `json:"enabled"`
+	DryRun            bool      `json:"dry_run"`
+	Target            string    `json:"target"`
+	InstanceRole      string    `json:"instance_role"`
+	Clusters          []string  `json:"clusters,omitempty"`
+	Users             []string  `json:"users,omitempty"`
+	Hosts             []string  `json:"hosts,omitempty"`
+	Databases         []string  `json:"databases,omitempty"`
+	Digests           []string  `json:"digests,omitempty"`
+	Commands          []string  `json:"commands,omitempty"`
+	States            []string  `json:"states,omitempty"`
+	MinElapsedSeconds int64     `json:"min_elapsed_seconds"`
+	MaxKillsPerMinute int       `json:"max_kills_per_minute"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package sqldiagnostic
+
+import "time"
+
+// PlanStep is one EXPLAIN row reduced to the columns that describe the
+// access path. Rows is the optimizer estimate and is not part of the plan
+// identity.
+type PlanStep struct {
+	ID         string  `json:"id"`
+	SelectType string  `json:"select_type"`
+	Table      string  `json:"table"`
+	AccessType string  `json:"access_type"`
+	Key        string  `json:"key"`
+	Rows       int64   `json:"rows"`
+	Filtered   float64 `json:"filtered"`
+	Extra      string  `json:"extra"`
+}
+
+// PlanSnapshot is an EXPLAIN of a sample statement captured for one digest
+// on one instance. Later captures are diffed against earlier ones.
+type PlanSnapshot struct {
+	ID         string     `json:"id"`
+	Instance   Instance   `json:"instance"`
+	Digest     string     `json:"digest"`
+	Database   string     `json:"database"`
+	SQLText    string     `json:"sql_text"`
+	Steps      []PlanStep `json:"steps"`
+	Signature  string     `json:"signature"`
+	CapturedAt time.Time  `json:"captured_at"`
+}
@@ -0,0 +1,36 @@
+package sqldiagnostic
+
+import "time"
+
+// SlowLogCursor is the position up to which an instance's slow log file has
+// been ingested. FileID identifies the file independently of its path
+// (device and inode), so a rotated file is never mistaken for its successor;
+// a "#N" suffix counts copytruncate truncations of the same inode.
+type SlowLogCursor struct {
+	MachineID string    `json:"machine_id"`
+	Port      int       `json:"port"`
+	FileID    string    `json:"file_id"`
+	Path      string    `json:"path"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SlowLogBatch is one chunk of a slow log file parsed by the Agent. Events
+// carry their byte offset in EventID; StartOffset must equal the Manager's
+// cursor for the batch to be accepted.
+type SlowLogBatch struct {
+	AgentID     string           `json:"agent_id"`
+	MachineID   string           `json:"machine_id"`
+	Port        int              `json:"port"`
+	FileID      string           `json:"file_id"`
+	Path        string           `json:"path"`
+	StartOffset int64            `json:"start_offset"`
+	EndOffset   int64            `json:"end_offset"`
+	Events      []StatementEvent `json:"events"`
+}
+
+type SlowLogIngestResult struct {
+	Accepted  int           `json:"accepted"`
+	Duplicate bool          `json:"duplicate"`
+	Cursor    SlowLogCursor `json:"cursor"`
+}
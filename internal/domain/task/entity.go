@@ -5,6 +5,7 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -25,6 +26,8 @@ const (
 	TypeAIWorkflow          Type = "ai_workflow"
 	TypePlatformOperation   Type = "platform_operation"
 	TypeFlameGraph          Type = "flamegraph"
+	TypeAgentSelfUpgrade    Type = "agent_self_upgrade"
+	TypeClusterSpecApply    Type = "cluster_spec_apply"
 )
 
 type Status string
@@ -157,12 +160,56 @@ type FlameGraphResult struct {
 	FoldedStacks string `json:"folded_stacks"`
 }
 
+// AgentSelfUpgradeSpec asks an Agent to replace its own binary. The Agent
+// downloads DownloadURL from the Manager, checks SHA256 and Version, swaps the
+// file atomically and exits so systemd starts the new binary. RestoreVersion
+// instead restores the local agentd.backup-<RestoreVersion> left by an earlier
+// upgrade. Signature is the Manager's ed25519 signature over SigningPayload and
+// is checked against the public key pinned in agent.yaml. MachineID binds the
+// signature to one host so a captured task cannot be replayed to another
+// Agent within its TTL, and TaskID binds it to one dispatched task so the same
+// host refuses to apply it twice.
+type AgentSelfUpgradeSpec struct {
+	TaskID         string    `json:"task_id"`
+	MachineID      string    `json:"machine_id"`
+	Version        string    `json:"version"`
+	Arch           string    `json:"arch,omitempty"`
+	PackageName    string    `json:"package_name,omitempty"`
+	DownloadURL    string    `json:"download_url,omitempty"`
+	SHA256         string    `json:"sha256,omitempty"`
+	RestoreVersion string    `json:"restore_version,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Signature      string    `json:"signature"`
+}
+
+// SigningPayload returns the bytes covered by Signature. The download URL is
+// left out on purpose: Agents rebase it onto their active Manager endpoint and
+// the SHA-256 already binds the content.
+func (s AgentSelfUpgradeSpec) SigningPayload() []byte {
+	return []byte(strings.Join([]string{
+		"gmha-agent-self-upgrade-v3", s.TaskID, s.MachineID, s.Version, s.Arch, s.PackageName,
+		strings.ToLower(s.SHA256), s.RestoreVersion, s.ExpiresAt.UTC().Format(time.RFC3339),
+	}, "\n"))
+}
+
+// AgentSelfUpgradeResult is reported by the Agent right before it restarts.
+type AgentSelfUpgradeResult struct {
+	PreviousVersion string `json:"previous_version"`
+	Version         string `json:"version"`
+	BackupPath      string `json:"backup_path,omitempty"`
+}
+
 // CapabilityMySQLDefaultsFile marks Agents that can replace the Manager-side
 // credential placeholder with a short-lived local MySQL defaults file. It is
 // deliberately separate from the generic exec task capability: older Agents
 // can execute shell commands but would pass the placeholder to mysql literally.
 const CapabilityMySQLDefaultsFile = "feature:mysql-defaults-file-v1"
 
+// CapabilityMySQLInstallTLS marks Agents whose mysql_install handler writes
+// MySQLInstallSpec.TLS next to my.cnf. Older Agents would render ssl_* options
+// that point at files they never created, so MySQL would refuse to start.
+const CapabilityMySQLInstallTLS = "feature:mysql-install-tls-v1"
+
 type CollectMachineInfoSpec struct{}
 
 type CollectStaticInfoSpec struct {
@@ -220,6 +267,16 @@ type MySQLInstallSpec struct {
 	MemoryAllocator              string             `json:"memory_allocator,omitempty"`
 	RuntimeParameters            map[string]string  `json:"runtime_parameters,omitempty"`
 	Accounts                     []MySQLAccountSpec `json:"accounts"`
+	TLS                          *MySQLTLSSpec      `json:"tls,omitempty"`
+}
+
+// MySQLTLSSpec carries a Manager-issued server certificate. The Agent writes
+// the files while generating my.cnf; the key is created with mode 0600.
+type MySQLTLSSpec struct {
+	Directory string `json:"directory"`
+	CAPEM     string `json:"ca_pem"`
+	CertPEM   string `json:"cert_pem"`
+	KeyPEM    string `json:"key_pem"`
 }
 
 type MySQLAccountSpec struct {
@@ -347,6 +404,10 @@ type MySQLTopologyNodeSpec struct {
 	SuperReadOnly            bool   `json:"super_read_only"`
 	RequiresReplicationSetup bool   `json:"requires_replication_setup"`
 	RequiresClone            bool   `json:"requires_clone"`
+	// ReplicationSSLCA enables SOURCE_SSL for this replica's channel; the path
+	// is the Manager CA deployed next to the replica's own certificate.
+	ReplicationSSLCA     string `json:"replication_ssl_ca,omitempty"`
+	ReplicationSSLVerify bool   `json:"replication_ssl_verify,omitempty"`
 }
 
 type MySQLTopologyResult struct {
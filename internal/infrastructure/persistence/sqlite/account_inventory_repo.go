@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+)
+
+// AccountInventoryRepository 保存每个实例最近一次的账号清单。密码摘要不进入
+// API 输出，单独存放在 digests_json 列中，只用于比较主从账号的密码是否一致。
+type AccountInventoryRepository struct{ db *DB }
+
+func NewAccountInventoryRepository(db *DB) *AccountInventoryRepository {
+	return &AccountInventoryRepository{db: db}
+}
+
+func (r *AccountInventoryRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists mysql_account_inventories (
+			machine_id varchar(160) not null, port integer not null, cluster_name varchar(255) not null default '',
+			findings integer not null default 0, collected_at varchar(64) not null, snapshot_json text not null,
+			digests_json text not null default '',
+			primary key (machine_id, port)
+		);
+		create index if not exists idx_mysql_account_inventories_cluster on mysql_account_inventories(cluster_name);
+	`)
+	return err
+}
+
+func (r *AccountInventoryRepository) GetSnapshot(ctx context.Context, machineID string, port int) (inventorydomain.Snapshot, bool, error) {
+	var payload, digests string
+	err := r.db.QueryRowContext(ctx, `select snapshot_json, digests_json from mysql_account_inventories where machine_id=? and port=?`, strings.TrimSpace(machineID), port).Scan(&payload, &digests)
+	if errors.Is(err, sql.ErrNoRows) {
+		return inventorydomain.Snapshot{}, false, nil
+	}
+	if err != nil {
+		return inventorydomain.Snapshot{}, false, err
+	}
+	snapshot, err := decodeAccountInventory(payload, digests)
+	return snapshot, err == nil, err
+}
+
+func (r *AccountInventoryRepository) SaveSnapshot(ctx context.Context, snapshot inventorydomain.Snapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	digests := make(map[string]string, len(snapshot.Accounts))
+	for _, account := range snapshot.Accounts {
+		if account.PasswordDigest != "" {
+			digests[account.User+"@"+account.Host] = account.PasswordDigest
+		}
+	}
+	digestPayload, err := json.Marshal(digests)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_account_inventories (machine_id, port, cluster_name, findings, collected_at, snapshot_json, digests_json)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on conflict(machine_id, port) do update set cluster_name=excluded.cluster_name, findings=excluded.findings,
+		collected_at=excluded.collected_at, snapshot_json=excluded.snapshot_json, digests_json=excluded.digests_json`,
+		snapshot.MachineID, snapshot.Port, snapshot.Cluster, len(snapshot.Findings), formatAccountInventoryTime(snapshot.CollectedAt), string(payload), string(digestPayload))
+	return err
+}
+
+func (r *AccountInventoryRepository) ListSnapshots(ctx context.Context, cluster string) ([]inventorydomain.Snapshot, error) {
+	cluster = strings.TrimSpace(cluster)
+	rows, err := r.db.QueryContext(ctx, `select snapshot_json, digests_json from mysql_account_inventories where (?='' or cluster_name=?) order by cluster_name, machine_id, port`, cluster, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]inventorydomain.Snapshot, 0)
+	for rows.Next() {
+		var payload, digests string
+		if err := rows.Scan(&payload, &digests); err != nil {
+			return nil, err
+		}
+		snapshot, err := decodeAccountInventory(payload, digests)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, snapshot)
+	}
+	return out, rows.Err()
+}
+
+func (r *AccountInventoryRepository) DeleteSnapshot(ctx context.Context, machineID string, port int) error {
+	_, err := r.db.ExecContext(ctx, `delete from mysql_account_inventories where machine_id=? and port=?`, strings.TrimSpace(machineID), port)
+	return err
+}
+
+func decodeAccountInventory(payload, digests string) (inventorydomain.Snapshot, error) {
+	var snapshot inventorydomain.Snapshot
+	if err := json.Unmarshal([]byte(payload), &snapshot); err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	if strings.TrimSpace(digests) == "" {
+		return snapshot, nil
+	}
+	values := make(map[string]string)
+	if err := json.Unmarshal([]byte(digests), &values); err != nil {
+		return inventorydomain.Snapshot{}, err
+	}
+	for index := range snapshot.Accounts {
+		account := &snapshot.Accounts[index]
+		account.PasswordDigest = values[account.User+"@"+account.Host]
+	}
+	return snapshot, nil
+}
+
+func formatAccountInventoryTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+	_ "modernc.org/sqlite"
+)
+
+func TestAccountInventoryRepositoryKeepsDigestsOutOfSnapshotJSON(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewAccountInventoryRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, snapshot := range []inventorydomain.Snapshot{
+		{Cluster: "orders", MachineID: "m1", Port: 3306, CollectedAt: time.Now(), Accounts: []inventorydomain.Account{{User: "app", Host: "%", PasswordDigest: "abc"}}},
+		{Cluster: "orders", MachineID: "m2", Port: 3306, CollectedAt: time.Now(), Accounts: []inventorydomain.Account{{User: "app", Host: "%"}}},
+		{Cluster: "billing", MachineID: "m3", Port: 3306, CollectedAt: time.Now()},
+	} {
+		if err := repo.SaveSnapshot(ctx, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var payload string
+	if err := db.QueryRow(`select snapshot_json from mysql_account_inventories where machine_id='m1'`).Scan(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) == 0 || strings.Contains(payload, "abc") {
+		t.Fatalf("snapshot json leaks the digest: %s", payload)
+	}
+	stored, ok, err := repo.GetSnapshot(ctx, "m1", 3306)
+	if err != nil || !ok || stored.Accounts[0].PasswordDigest != "abc" {
+		t.Fatalf("stored = %+v, %v, %v", stored, ok, err)
+	}
+	items, err := repo.ListSnapshots(ctx, "orders")
+	if err != nil || len(items) != 2 || items[1].Accounts[0].PasswordDigest != "" {
+		t.Fatalf("items = %+v, %v", items, err)
+	}
+	if err := repo.DeleteSnapshot(ctx, "m3", 3306); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := repo.ListSnapshots(ctx, ""); len(items) != 2 {
+		t.Fatalf("after delete = %+v", items)
+	}
+}
@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	baselinedomain "gmha/internal/domain/baseline"
+)
+
+type BaselineRepository struct{ db *DB }
+
+func NewBaselineRepository(db *DB) *BaselineRepository {
+	return &BaselineRepository{db: db}
+}
+
+func (r *BaselineRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists baseline_profiles (
+			cluster_name varchar(255) primary key, profile_json text not null, updated_at varchar(64) not null
+		);
+		create table if not exists baseline_host_states (
+			machine_id varchar(160) primary key, cluster_name varchar(255) not null default '',
+			status varchar(32) not null, failed integer not null default 0,
+			collected_at varchar(64) not null, state_json text not null
+		);
+		create index if not exists idx_baseline_host_states_cluster on baseline_host_states(cluster_name);
+		create table if not exists baseline_history (
+			id varchar(160) primary key, machine_id varchar(160) not null, cluster_name varchar(255) not null default '',
+			status varchar(32) not null, failed integer not null default 0,
+			collected_at varchar(64) not null, state_json text not null
+		);
+		create index if not exists idx_baseline_history_machine on baseline_history(machine_id, collected_at);
+		create index if not exists idx_baseline_history_collected on baseline_history(collected_at);
+	`)
+	return err
+}
+
+func (r *BaselineRepository) GetProfile(ctx context.Context, cluster string) (baselinedomain.Profile, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select profile_json from baseline_profiles where cluster_name=?`, strings.TrimSpace(cluster)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return baselinedomain.Profile{}, false, nil
+	}
+	if err != nil {
+		return baselinedomain.Profile{}, false, err
+	}
+	var profile baselinedomain.Profile
+	if err := json.Unmarshal([]byte(payload), &profile); err != nil {
+		return baselinedomain.Profile{}, false, err
+	}
+	return profile, true, nil
+}
+
+func (r *BaselineRepository) SaveProfile(ctx context.Context, profile baselinedomain.Profile) error {
+	payload, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into baseline_profiles (cluster_name, profile_json, updated_at) values (?, ?, ?)
+		on conflict(cluster_name) do update set profile_json=excluded.profile_json, updated_at=excluded.updated_at`,
+		profile.Cluster, string(payload), formatBaselineTime(profile.UpdatedAt))
+	return err
+}
+
+func (r *BaselineRepository) DeleteProfile(ctx context.Context, cluster string) error {
+	_, err := r.db.ExecContext(ctx, `delete from baseline_profiles where cluster_name=?`, strings.TrimSpace(cluster))
+	return err
+}
+
+func (r *BaselineRepository) ListProfiles(ctx context.Context) ([]baselinedomain.Profile, error) {
+	rows, err := r.db.QueryContext(ctx, `select profile_json from baseline_profiles order by cluster_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]baselinedomain.Profile, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var profile baselinedomain.Profile
+		if err := json.Unmarshal([]byte(payload), &profile); err != nil {
+			return nil, err
+		}
+		out = append(out, profile)
+	}
+	return out, rows.Err()
+}
+
+func (r *BaselineRepository) GetHostState(ctx context.Context, machineID string) (baselinedomain.HostState, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select state_json from baseline_host_states where machine_id=?`, strings.TrimSpace(machineID)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return baselinedomain.HostState{}, false, nil
+	}
+	if err != nil {
+		return baselinedomain.HostState{}, false, err
+	}
+	state, err := decodeBaselineState(payload)
+	return state, err == nil, err
+}
+
+// SaveHostState replaces the latest state and optionally appends it to the
+// history in one transaction. History rows drop the raw facts.
+func (r *BaselineRepository) SaveHostState(ctx context.Context, state baselinedomain.HostState, appendHistory bool) error {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	collected := formatBaselineTime(state.CollectedAt)
+	if _, err := tx.ExecContext(ctx, `insert into baseline_host_states (machine_id, cluster_name, status, failed, collected_at, state_json)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict(machine_id) do update set cluster_name=excluded.cluster_name, status=excluded.status, failed=excluded.failed,
+		collected_at=excluded.collected_at, state_json=excluded.state_json`,
+		state.MachineID, state.Cluster, state.Status, state.Failed, collected, string(payload)); err != nil {
+		return err
+	}
+	if appendHistory {
+		history := state
+		history.Facts = nil
+		historyPayload, err := json.Marshal(history)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `insert into baseline_history (id, machine_id, cluster_name, status, failed, collected_at, state_json)
+			values (?, ?, ?, ?, ?, ?, ?)`,
+			state.ID, state.MachineID, state.Cluster, state.Status, state.Failed, collected, string(historyPayload)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *BaselineRepository) ListHostStates(ctx context.Context, cluster string) ([]baselinedomain.HostState, error) {
+	return r.listStates(ctx, `select state_json from baseline_host_states where (?='' or cluster_name=?) order by cluster_name, machine_id`, cluster, cluster)
+}
+
+func (r *BaselineRepository) DeleteHostState(ctx context.Context, machineID string) error {
+	_, err := r.db.ExecContext(ctx, `delete from baseline_host_states where machine_id=?`, strings.TrimSpace(machineID))
+	return err
+}
+
+func (r *BaselineRepository) ListHistory(ctx context.Context, machineID string, limit int) ([]baselinedomain.HostState, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return r.listStates(ctx, `select state_json from baseline_history where machine_id=? order by collected_at desc limit ?`, strings.TrimSpace(machineID), limit)
+}
+
+func (r *BaselineRepository) LastHistoryAt(ctx context.Context, machineID string) (time.Time, bool, error) {
+	var collected string
+	err := r.db.QueryRowContext(ctx, `select collected_at from baseline_history where machine_id=? order by collected_at desc limit 1`, strings.TrimSpace(machineID)).Scan(&collected)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return parseBaselineTime(collected), true, nil
+}
+
+func (r *BaselineRepository) PurgeHistory(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `delete from baseline_history where collected_at<?`, formatBaselineTime(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *BaselineRepository) listStates(ctx context.Context, query string, args ...any) ([]baselinedomain.HostState, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]baselinedomain.HostState, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		state, err := decodeBaselineState(payload)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, state)
+	}
+	return out, rows.Err()
+}
+
+func decodeBaselineState(payload string) (baselinedomain.HostState, error) {
+	var state baselinedomain.HostState
+	err := json.Unmarshal([]byte(payload), &state)
+	return state, err
+}
+
+func formatBaselineTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func parseBaselineTime(value string) time.Time {
+	result, _ := time.Parse(time.RFC3339Nano, value)
+	return result
+}
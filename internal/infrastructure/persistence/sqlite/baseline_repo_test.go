@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	baselinedomain "gmha/internal/domain/baseline"
+	_ "modernc.org/sqlite"
+)
+
+func TestBaselineRepositoryKeepsLatestStateAndHistory(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewBaselineRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	profile := baselinedomain.Profile{Cluster: "orders", Rules: []baselinedomain.Rule{{Key: "selinux", Operator: "eq", Expected: "disabled", Enabled: true}}, UpdatedBy: "dba"}
+	if err := repo.SaveProfile(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	profile.Rules[0].Expected = "permissive"
+	if err := repo.SaveProfile(ctx, profile); err != nil {
+		t.Fatal(err)
+	}
+	stored, ok, err := repo.GetProfile(ctx, "orders")
+	if err != nil || !ok || stored.Rules[0].Expected != "permissive" {
+		t.Fatalf("profile = %+v, %v, %v", stored, ok, err)
+	}
+	if _, ok, _ := repo.GetProfile(ctx, ""); ok {
+		t.Fatal("default profile must not exist")
+	}
+
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	state := baselinedomain.HostState{
+		ID: "s1", Cluster: "orders", MachineID: "m1", Status: baselinedomain.StatusFail, Failed: 1, Fingerprint: "a",
+		Results: []baselinedomain.CheckResult{{Key: "selinux", Actual: "enforcing", Status: baselinedomain.StatusFail}},
+		Facts:   map[string]string{"selinux": "enforcing"}, CollectedAt: now.AddDate(0, 0, -100),
+	}
+	if err := repo.SaveHostState(ctx, state, true); err != nil {
+		t.Fatal(err)
+	}
+	state.ID, state.Status, state.Failed, state.Fingerprint, state.CollectedAt = "s2", baselinedomain.StatusPass, 0, "b", now
+	state.Facts = map[string]string{"selinux": "permissive"}
+	if err := repo.SaveHostState(ctx, state, true); err != nil {
+		t.Fatal(err)
+	}
+	state.ID, state.CollectedAt = "s3", now.Add(10*time.Minute)
+	if err := repo.SaveHostState(ctx, state, false); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, ok, err := repo.GetHostState(ctx, "m1")
+	if err != nil || !ok || latest.ID != "s3" || latest.Facts["selinux"] != "permissive" || !latest.CollectedAt.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("latest = %+v, %v, %v", latest, ok, err)
+	}
+	if states, _ := repo.ListHostStates(ctx, "billing"); len(states) != 0 {
+		t.Fatalf("states of another cluster = %+v", states)
+	}
+	history, err := repo.ListHistory(ctx, "m1", 10)
+	if err != nil || len(history) != 2 || history[0].ID != "s2" || history[0].Facts != nil {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+	last, ok, err := repo.LastHistoryAt(ctx, "m1")
+	if err != nil || !ok || !last.Equal(now) {
+		t.Fatalf("last history = %v, %v, %v", last, ok, err)
+	}
+	if purged, err := repo.PurgeHistory(ctx, now.AddDate(0, 0, -90)); err != nil || purged != 1 {
+		t.Fatalf("purged = %d, %v", purged, err)
+	}
+	if err := repo.DeleteHostState(ctx, "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := repo.GetHostState(ctx, "m1"); ok {
+		t.Fatal("state must be deleted")
+	}
+}
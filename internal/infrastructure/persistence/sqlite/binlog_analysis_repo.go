@@ -0,0 +1,323 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	binlogdomain "gmha/internal/domain/binloganalysis"
+)
+
+type BinlogAnalysisRepository struct{ db *DB }
+
+func NewBinlogAnalysisRepository(db *DB) *BinlogAnalysisRepository {
+	return &BinlogAnalysisRepository{db: db}
+}
+
+func (r *BinlogAnalysisRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists binlog_analyses (
+			id varchar(160) primary key, schedule_id varchar(160) not null default '',
+			cluster_name varchar(255) not null default '', machine_id varchar(160) not null, port integer not null,
+			status varchar(32) not null, error text not null,
+			window_start varchar(64) not null, window_end varchar(64) not null,
+			created_at varchar(64) not null, started_at varchar(64) not null default '', finished_at varchar(64) not null default '',
+			request_json text not null, summary_json text not null, report_json text not null
+		);
+		create index if not exists idx_binlog_analyses_cluster on binlog_analyses(cluster_name, created_at);
+		create index if not exists idx_binlog_analyses_schedule on binlog_analyses(schedule_id, created_at);
+		create index if not exists idx_binlog_analyses_status on binlog_analyses(status);
+		create table if not exists binlog_analysis_table_volumes (
+			analysis_id varchar(160) not null, schedule_id varchar(160) not null default '',
+			cluster_name varchar(255) not null default '', schema_name varchar(64) not null, table_name varchar(64) not null,
+			window_start varchar(64) not null, window_end varchar(64) not null,
+			insert_rows integer not null default 0, update_rows integer not null default 0, delete_rows integer not null default 0,
+			total_rows integer not null default 0, ddl_count integer not null default 0,
+			primary key (analysis_id, schema_name, table_name)
+		);
+		create index if not exists idx_binlog_table_volumes_trend on binlog_analysis_table_volumes(cluster_name, schedule_id, window_start);
+		create table if not exists binlog_analysis_schedules (
+			id varchar(160) primary key, name varchar(255) not null, cluster_name varchar(255) not null,
+			machine_id varchar(160) not null default '', port integer not null default 0, window_hours integer not null,
+			schedule_type varchar(32) not null, interval_minutes integer not null default 0, start_at varchar(64) not null,
+			big_txn_mode varchar(32) not null default 'rows', big_txn_rows_threshold integer not null default 0,
+			big_txn_bytes_threshold integer not null default 0,
+			alert_big_transactions integer not null default 1, alert_ddl integer not null default 1,
+			expected_ddl_json text not null, enabled integer not null default 1,
+			last_run_at varchar(64) not null default '', next_run_at varchar(64) not null default '',
+			last_analysis_id varchar(160) not null default '',
+			created_at varchar(64) not null, updated_at varchar(64) not null
+		);
+		create index if not exists idx_binlog_analysis_schedule_due on binlog_analysis_schedules(enabled, next_run_at);
+		create index if not exists idx_binlog_analysis_schedule_cluster on binlog_analysis_schedules(cluster_name);
+	`)
+	return err
+}
+
+func (r *BinlogAnalysisRepository) SaveAnalysis(ctx context.Context, a binlogdomain.Analysis) error {
+	_, err := r.db.ExecContext(ctx, `insert into binlog_analyses
+		(id,schedule_id,cluster_name,machine_id,port,status,error,window_start,window_end,created_at,started_at,finished_at,request_json,summary_json,report_json)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(id) do update set status=excluded.status,error=excluded.error,started_at=excluded.started_at,
+		finished_at=excluded.finished_at,summary_json=excluded.summary_json,report_json=excluded.report_json`,
+		a.ID, a.ScheduleID, a.Cluster, a.MachineID, a.Port, a.Status, a.Error,
+		formatBinlogTime(a.WindowStart), formatBinlogTime(a.WindowEnd), formatBinlogTime(a.CreatedAt),
+		formatBinlogTimePtr(a.StartedAt), formatBinlogTimePtr(a.FinishedAt),
+		string(a.Request), string(a.Summary), string(a.Report))
+	return err
+}
+
+func (r *BinlogAnalysisRepository) GetAnalysis(ctx context.Context, id string) (binlogdomain.Analysis, bool, error) {
+	a, err := scanBinlogAnalysis(r.db.QueryRowContext(ctx, binlogAnalysisSelect+` where id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return binlogdomain.Analysis{}, false, nil
+	}
+	return a, err == nil, err
+}
+
+func (r *BinlogAnalysisRepository) ListAnalyses(ctx context.Context, cluster string, limit int) ([]binlogdomain.Analysis, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := r.db.QueryContext(ctx, binlogAnalysisListSelect+` where (?='' or cluster_name=?) order by created_at desc limit ?`, cluster, cluster, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]binlogdomain.Analysis, 0)
+	for rows.Next() {
+		a, err := scanBinlogAnalysis(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// FailInterruptedAnalyses marks runs left queued or running by a previous
+// Manager process; their analyzer goroutines no longer exist.
+func (r *BinlogAnalysisRepository) FailInterruptedAnalyses(ctx context.Context, message string, now time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `update binlog_analyses set status='failed',error=?,finished_at=? where status in ('queued','running')`,
+		message, formatBinlogTime(now))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *BinlogAnalysisRepository) PurgeAnalyses(ctx context.Context, before time.Time) (int64, error) {
+	cutoff := formatBinlogTime(before)
+	if _, err := r.db.ExecContext(ctx, `delete from binlog_analysis_table_volumes where window_end<?`, cutoff); err != nil {
+		return 0, err
+	}
+	result, err := r.db.ExecContext(ctx, `delete from binlog_analyses where created_at<? and status not in ('queued','running')`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *BinlogAnalysisRepository) SaveTableVolumes(ctx context.Context, analysisID string, items []binlogdomain.TableVolume) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `delete from binlog_analysis_table_volumes where analysis_id=?`, analysisID); err != nil {
+		return err
+	}
+	for _, v := range items {
+		if _, err := tx.ExecContext(ctx, `insert into binlog_analysis_table_volumes
+			(analysis_id,schedule_id,cluster_name,schema_name,table_name,window_start,window_end,insert_rows,update_rows,delete_rows,total_rows,ddl_count)
+			values(?,?,?,?,?,?,?,?,?,?,?,?)`,
+			analysisID, v.ScheduleID, v.Cluster, v.Schema, v.Table, formatBinlogTime(v.WindowStart), formatBinlogTime(v.WindowEnd),
+			v.InsertRows, v.UpdateRows, v.DeleteRows, v.TotalRows, v.DDLCount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListTableVolumes returns volumes recorded by scheduled analyses only: manual
+// runs may overlap scheduled windows and would double count a trend.
+func (r *BinlogAnalysisRepository) ListTableVolumes(ctx context.Context, cluster, scheduleID string, since time.Time) ([]binlogdomain.TableVolume, error) {
+	rows, err := r.db.QueryContext(ctx, `select analysis_id,schedule_id,cluster_name,schema_name,table_name,window_start,window_end,
+		insert_rows,update_rows,delete_rows,total_rows,ddl_count from binlog_analysis_table_volumes
+		where schedule_id<>'' and (?='' or cluster_name=?) and (?='' or schedule_id=?) and window_start>=?
+		order by window_start, schema_name, table_name`,
+		cluster, cluster, scheduleID, scheduleID, formatBinlogTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]binlogdomain.TableVolume, 0)
+	for rows.Next() {
+		var v binlogdomain.TableVolume
+		var start, end string
+		if err := rows.Scan(&v.AnalysisID, &v.ScheduleID, &v.Cluster, &v.Schema, &v.Table, &start, &end,
+			&v.InsertRows, &v.UpdateRows, &v.DeleteRows, &v.TotalRows, &v.DDLCount); err != nil {
+			return nil, err
+		}
+		v.WindowStart = parseBinlogTime(start)
+		v.WindowEnd = parseBinlogTime(end)
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (r *BinlogAnalysisRepository) SaveSchedule(ctx context.Context, s binlogdomain.Schedule) error {
+	expected, err := json.Marshal(s.ExpectedDDL)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into binlog_analysis_schedules
+		(id,name,cluster_name,machine_id,port,window_hours,schedule_type,interval_minutes,start_at,big_txn_mode,big_txn_rows_threshold,
+		big_txn_bytes_threshold,alert_big_transactions,alert_ddl,expected_ddl_json,enabled,last_run_at,next_run_at,last_analysis_id,created_at,updated_at)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(id) do update set name=excluded.name,cluster_name=excluded.cluster_name,machine_id=excluded.machine_id,
+		port=excluded.port,window_hours=excluded.window_hours,schedule_type=excluded.schedule_type,
+		interval_minutes=excluded.interval_minutes,start_at=excluded.start_at,big_txn_mode=excluded.big_txn_mode,
+		big_txn_rows_threshold=excluded.big_txn_rows_threshold,big_txn_bytes_threshold=excluded.big_txn_bytes_threshold,
+		alert_big_transactions=excluded.alert_big_transactions,alert_ddl=excluded.alert_ddl,
+		expected_ddl_json=excluded.expected_ddl_json,enabled=excluded.enabled,next_run_at=excluded.next_run_at,
+		updated_at=excluded.updated_at`,
+		s.ID, s.Name, s.Cluster, s.MachineID, s.Port, s.WindowHours, s.ScheduleType, s.IntervalMinutes,
+		formatBinlogTime(s.StartAt), s.BigTxnMode, s.BigTxnRowsThreshold, int64(s.BigTxnBytesThreshold),
+		binlogBool(s.AlertBigTransactions), binlogBool(s.AlertDDL), string(expected), binlogBool(s.Enabled),
+		formatBinlogTime(s.LastRunAt), formatBinlogTime(s.NextRunAt), s.LastAnalysisID,
+		formatBinlogTime(s.CreatedAt), formatBinlogTime(s.UpdatedAt))
+	return err
+}
+
+func (r *BinlogAnalysisRepository) GetSchedule(ctx context.Context, id string) (binlogdomain.Schedule, bool, error) {
+	s, err := scanBinlogAnalysisSchedule(r.db.QueryRowContext(ctx, binlogAnalysisScheduleSelect+` where id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return binlogdomain.Schedule{}, false, nil
+	}
+	return s, err == nil, err
+}
+
+func (r *BinlogAnalysisRepository) ListSchedules(ctx context.Context, cluster string) ([]binlogdomain.Schedule, error) {
+	return r.listSchedules(ctx, binlogAnalysisScheduleSelect+` where (?='' or cluster_name=?) order by created_at desc`, cluster, cluster)
+}
+
+func (r *BinlogAnalysisRepository) ListDueSchedules(ctx context.Context, now time.Time) ([]binlogdomain.Schedule, error) {
+	return r.listSchedules(ctx, binlogAnalysisScheduleSelect+` where enabled=1 and next_run_at<>'' and next_run_at<=? order by next_run_at`, formatBinlogTime(now))
+}
+
+func (r *BinlogAnalysisRepository) listSchedules(ctx context.Context, query string, args ...any) ([]binlogdomain.Schedule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]binlogdomain.Schedule, 0)
+	for rows.Next() {
+		s, err := scanBinlogAnalysisSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *BinlogAnalysisRepository) UpdateScheduleRun(ctx context.Context, id string, last, next time.Time, enabled bool, analysisID string) error {
+	_, err := r.db.ExecContext(ctx, `update binlog_analysis_schedules set last_run_at=?,next_run_at=?,enabled=?,
+		last_analysis_id=case when ?='' then last_analysis_id else ? end,updated_at=? where id=?`,
+		formatBinlogTime(last), formatBinlogTime(next), binlogBool(enabled), analysisID, analysisID,
+		formatBinlogTime(time.Now().UTC()), id)
+	return err
+}
+
+func (r *BinlogAnalysisRepository) DeleteSchedule(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `delete from binlog_analysis_schedules where id=?`, id)
+	return err
+}
+
+const binlogAnalysisSelect = `select id,schedule_id,cluster_name,machine_id,port,status,error,window_start,window_end,created_at,started_at,finished_at,request_json,summary_json,report_json from binlog_analyses`
+const binlogAnalysisListSelect = `select id,schedule_id,cluster_name,machine_id,port,status,error,window_start,window_end,created_at,started_at,finished_at,request_json,summary_json,'' as report_json from binlog_analyses`
+const binlogAnalysisScheduleSelect = `select id,name,cluster_name,machine_id,port,window_hours,schedule_type,interval_minutes,start_at,big_txn_mode,big_txn_rows_threshold,big_txn_bytes_threshold,alert_big_transactions,alert_ddl,expected_ddl_json,enabled,last_run_at,next_run_at,last_analysis_id,created_at,updated_at from binlog_analysis_schedules`
+
+func scanBinlogAnalysis(row interface{ Scan(...any) error }) (binlogdomain.Analysis, error) {
+	var a binlogdomain.Analysis
+	var windowStart, windowEnd, created, started, finished, request, summary, report string
+	err := row.Scan(&a.ID, &a.ScheduleID, &a.Cluster, &a.MachineID, &a.Port, &a.Status, &a.Error,
+		&windowStart, &windowEnd, &created, &started, &finished, &request, &summary, &report)
+	a.WindowStart = parseBinlogTime(windowStart)
+	a.WindowEnd = parseBinlogTime(windowEnd)
+	a.CreatedAt = parseBinlogTime(created)
+	a.StartedAt = parseBinlogTimePtr(started)
+	a.FinishedAt = parseBinlogTimePtr(finished)
+	a.Request = binlogRawJSON(request)
+	a.Summary = binlogRawJSON(summary)
+	a.Report = binlogRawJSON(report)
+	return a, err
+}
+
+func scanBinlogAnalysisSchedule(row interface{ Scan(...any) error }) (binlogdomain.Schedule, error) {
+	var s binlogdomain.Schedule
+	var bytesThreshold int64
+	var alertBig, alertDDL, enabled int
+	var start, expected, last, next, created, updated string
+	err := row.Scan(&s.ID, &s.Name, &s.Cluster, &s.MachineID, &s.Port, &s.WindowHours, &s.ScheduleType, &s.IntervalMinutes,
+		&start, &s.BigTxnMode, &s.BigTxnRowsThreshold, &bytesThreshold, &alertBig, &alertDDL, &expected, &enabled,
+		&last, &next, &s.LastAnalysisID, &created, &updated)
+	if bytesThreshold > 0 {
+		s.BigTxnBytesThreshold = uint64(bytesThreshold)
+	}
+	s.AlertBigTransactions = alertBig == 1
+	s.AlertDDL = alertDDL == 1
+	s.Enabled = enabled == 1
+	_ = json.Unmarshal([]byte(expected), &s.ExpectedDDL)
+	s.StartAt = parseBinlogTime(start)
+	s.LastRunAt = parseBinlogTime(last)
+	s.NextRunAt = parseBinlogTime(next)
+	s.CreatedAt = parseBinlogTime(created)
+	s.UpdatedAt = parseBinlogTime(updated)
+	return s, err
+}
+
+func binlogRawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
+}
+
+func binlogBool(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func formatBinlogTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func formatBinlogTimePtr(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return formatBinlogTime(*value)
+}
+
+func parseBinlogTime(value string) time.Time {
+	result, _ := time.Parse(time.RFC3339Nano, value)
+	return result
+}
+
+func parseBinlogTimePtr(value string) *time.Time {
+	result := parseBinlogTime(value)
+	if result.IsZero() {
+		return nil
+	}
+	return &result
+}
@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	binlogdomain "gmha/internal/domain/binloganalysis"
+	_ "modernc.org/sqlite"
+)
+
+func newBinlogAnalysisTestRepository(t *testing.T) *BinlogAnalysisRepository {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewBinlogAnalysisRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestBinlogAnalysisRepositoryAnalysesVolumesAndPurge(t *testing.T) {
+	repo := newBinlogAnalysisTestRepository(t)
+	ctx := context.Background()
+	now := time.Date(2026, 7, 23, 0, 10, 0, 0, time.UTC)
+	analysis := binlogdomain.Analysis{
+		ID: "binlog-1", ScheduleID: "schedule-1", Cluster: "orders", MachineID: "machine-1", Port: 3306,
+		Status: "running", WindowStart: now.Add(-24 * time.Hour), WindowEnd: now, CreatedAt: now,
+		Request: json.RawMessage(`{"port":3306}`),
+	}
+	if err := repo.SaveAnalysis(ctx, analysis); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.FailInterruptedAnalyses(ctx, "interrupted", now); err != nil || n != 1 {
+		t.Fatalf("FailInterruptedAnalyses() n=%d err=%v", n, err)
+	}
+	analysis.Status, analysis.Error = "completed", ""
+	analysis.Summary = json.RawMessage(`{"total_rows":9}`)
+	analysis.Report = json.RawMessage(`{"tables":[{"schema":"orders","table":"items"}]}`)
+	if err := repo.SaveAnalysis(ctx, analysis); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.GetAnalysis(ctx, analysis.ID)
+	if err != nil || !ok || got.Status != "completed" || string(got.Report) != string(analysis.Report) || !got.WindowEnd.Equal(now) {
+		t.Fatalf("GetAnalysis() = %+v ok=%v err=%v", got, ok, err)
+	}
+	list, err := repo.ListAnalyses(ctx, "orders", 10)
+	if err != nil || len(list) != 1 || list[0].Report != nil || string(list[0].Summary) != `{"total_rows":9}` {
+		t.Fatalf("ListAnalyses() should omit reports: %+v err=%v", list, err)
+	}
+
+	volumes := []binlogdomain.TableVolume{{
+		ScheduleID: "schedule-1", Cluster: "orders", Schema: "orders", Table: "items",
+		WindowStart: analysis.WindowStart, WindowEnd: now, UpdateRows: 7, TotalRows: 9,
+	}}
+	if err := repo.SaveTableVolumes(ctx, analysis.ID, volumes); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveTableVolumes(ctx, "manual-1", []binlogdomain.TableVolume{{Cluster: "orders", Schema: "orders", Table: "items", WindowStart: now, WindowEnd: now}}); err != nil {
+		t.Fatal(err)
+	}
+	trend, err := repo.ListTableVolumes(ctx, "orders", "", now.AddDate(0, 0, -7))
+	if err != nil || len(trend) != 1 || trend[0].AnalysisID != analysis.ID || trend[0].UpdateRows != 7 {
+		t.Fatalf("ListTableVolumes() should return scheduled volumes only: %+v err=%v", trend, err)
+	}
+
+	if n, err := repo.PurgeAnalyses(ctx, now.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("PurgeAnalyses() n=%d err=%v", n, err)
+	}
+	if _, ok, _ := repo.GetAnalysis(ctx, analysis.ID); ok {
+		t.Fatal("purged analysis is still stored")
+	}
+	if trend, _ := repo.ListTableVolumes(ctx, "", "schedule-1", time.Time{}); len(trend) != 0 {
+		t.Fatalf("volumes of purged windows should be removed: %+v", trend)
+	}
+}
+
+func TestBinlogAnalysisRepositorySchedules(t *testing.T) {
+	repo := newBinlogAnalysisTestRepository(t)
+	ctx := context.Background()
+	now := time.Date(2026, 7, 23, 0, 0, 0, 0, time.UTC)
+	schedule := binlogdomain.Schedule{
+		ID: "schedule-1", Name: "orders daily", Cluster: "orders", WindowHours: 24, ScheduleType: binlogdomain.ScheduleDaily,
+		StartAt: now, BigTxnMode: "bytes", BigTxnBytesThreshold: 64 << 20, AlertDDL: true,
+		ExpectedDDL: []string{"orders.tmp_*"}, Enabled: true, NextRunAt: now, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repo.SaveSchedule(ctx, schedule); err != nil {
+		t.Fatal(err)
+	}
+	due, err := repo.ListDueSchedules(ctx, now.Add(time.Minute))
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ListDueSchedules() = %+v err=%v", due, err)
+	}
+	got := due[0]
+	if got.BigTxnBytesThreshold != 64<<20 || got.AlertBigTransactions || !got.AlertDDL || len(got.ExpectedDDL) != 1 || got.ExpectedDDL[0] != "orders.tmp_*" {
+		t.Fatalf("schedule fields were not round-tripped: %+v", got)
+	}
+	next := now.Add(24 * time.Hour)
+	if err := repo.UpdateScheduleRun(ctx, schedule.ID, now, next, true, "binlog-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateScheduleRun(ctx, schedule.ID, now, next, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, _, _ = repo.GetSchedule(ctx, schedule.ID)
+	if got.LastAnalysisID != "binlog-1" || !got.NextRunAt.Equal(next) {
+		t.Fatalf("failed runs must keep the last analysis: %+v", got)
+	}
+	if due, _ := repo.ListDueSchedules(ctx, now.Add(time.Minute)); len(due) != 0 {
+		t.Fatalf("advanced schedule is still due: %+v", due)
+	}
+}
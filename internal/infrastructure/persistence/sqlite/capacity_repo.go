@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	capacitydomain "gmha/internal/domain/capacity"
+)
+
+type CapacityRepository struct{ db *DB }
+
+func NewCapacityRepository(db *DB) *CapacityRepository {
+	return &CapacityRepository{db: db}
+}
+
+func (r *CapacityRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists capacity_instance_samples (
+			machine_id varchar(160) not null, port integer not null, day varchar(10) not null,
+			cluster_name varchar(255) not null default '', machine_name varchar(255) not null default '',
+			machine_ip varchar(64) not null default '', table_count integer not null default 0,
+			row_count bigint not null default 0, table_bytes bigint not null default 0, data_dir text not null,
+			disk_total_bytes bigint not null default 0, disk_used_bytes bigint not null default 0,
+			disk_available_bytes bigint not null default 0, collected_at varchar(64) not null,
+			primary key (machine_id, port, day)
+		);
+		create table if not exists capacity_table_samples (
+			machine_id varchar(160) not null, port integer not null, day varchar(10) not null,
+			schema_name varchar(64) not null, table_name varchar(64) not null,
+			cluster_name varchar(255) not null default '', row_count bigint not null default 0,
+			data_bytes bigint not null default 0, index_bytes bigint not null default 0,
+			free_bytes bigint not null default 0, collected_at varchar(64) not null,
+			primary key (machine_id, port, day, schema_name, table_name)
+		);
+		create index if not exists idx_capacity_table_samples_cluster on capacity_table_samples(cluster_name, day);
+		create index if not exists idx_capacity_table_samples_day on capacity_table_samples(day);
+	`)
+	return err
+}
+
+// SaveSamples replaces the samples of one instance and day in a single
+// transaction, so a table dropped later in the day disappears from the day.
+func (r *CapacityRepository) SaveSamples(ctx context.Context, instance capacitydomain.InstanceSample, tables []capacitydomain.TableSample) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	collected := formatCapacityTime(instance.CollectedAt)
+	if _, err := tx.ExecContext(ctx, `insert into capacity_instance_samples
+		(machine_id,port,day,cluster_name,machine_name,machine_ip,table_count,row_count,table_bytes,data_dir,
+		disk_total_bytes,disk_used_bytes,disk_available_bytes,collected_at)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(machine_id,port,day) do update set cluster_name=excluded.cluster_name,machine_name=excluded.machine_name,
+		machine_ip=excluded.machine_ip,table_count=excluded.table_count,row_count=excluded.row_count,table_bytes=excluded.table_bytes,
+		data_dir=excluded.data_dir,disk_total_bytes=excluded.disk_total_bytes,disk_used_bytes=excluded.disk_used_bytes,
+		disk_available_bytes=excluded.disk_available_bytes,collected_at=excluded.collected_at`,
+		instance.MachineID, instance.Port, instance.Day, instance.Cluster, instance.MachineName, instance.MachineIP,
+		instance.TableCount, instance.Rows, instance.TableBytes, instance.DataDir,
+		instance.DiskTotalBytes, instance.DiskUsedBytes, instance.DiskAvailableBytes, collected); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `delete from capacity_table_samples where machine_id=? and port=? and day=?`,
+		instance.MachineID, instance.Port, instance.Day); err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, `insert into capacity_table_samples
+			(machine_id,port,day,schema_name,table_name,cluster_name,row_count,data_bytes,index_bytes,free_bytes,collected_at)
+			values(?,?,?,?,?,?,?,?,?,?,?)`,
+			instance.MachineID, instance.Port, instance.Day, table.Schema, table.Table, instance.Cluster,
+			table.Rows, table.DataBytes, table.IndexBytes, table.FreeBytes, collected); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *CapacityRepository) ListInstanceSamples(ctx context.Context, machineID string, port int, sinceDay string) ([]capacitydomain.InstanceSample, error) {
+	rows, err := r.db.QueryContext(ctx, `select machine_id,port,day,cluster_name,machine_name,machine_ip,table_count,row_count,table_bytes,
+		data_dir,disk_total_bytes,disk_used_bytes,disk_available_bytes,collected_at
+		from capacity_instance_samples where machine_id=? and port=? and day>=? order by day`, machineID, port, sinceDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []capacitydomain.InstanceSample
+	for rows.Next() {
+		var s capacitydomain.InstanceSample
+		var collected string
+		if err := rows.Scan(&s.MachineID, &s.Port, &s.Day, &s.Cluster, &s.MachineName, &s.MachineIP, &s.TableCount, &s.Rows,
+			&s.TableBytes, &s.DataDir, &s.DiskTotalBytes, &s.DiskUsedBytes, &s.DiskAvailableBytes, &collected); err != nil {
+			return nil, err
+		}
+		s.CollectedAt = parseCapacityTime(collected)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// ListTableSamples returns table samples of a cluster (or every cluster)
+// ordered by table and day.
+func (r *CapacityRepository) ListTableSamples(ctx context.Context, cluster, sinceDay string) ([]capacitydomain.TableSample, error) {
+	query := `select machine_id,port,day,schema_name,table_name,cluster_name,row_count,data_bytes,index_bytes,free_bytes,collected_at
+		from capacity_table_samples where day>=?`
+	args := []any{sinceDay}
+	if cluster != "" {
+		query += ` and cluster_name=?`
+		args = append(args, cluster)
+	}
+	rows, err := r.db.QueryContext(ctx, query+` order by machine_id, port, schema_name, table_name, day`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []capacitydomain.TableSample
+	for rows.Next() {
+		var s capacitydomain.TableSample
+		var collected string
+		if err := rows.Scan(&s.MachineID, &s.Port, &s.Day, &s.Schema, &s.Table, &s.Cluster, &s.Rows,
+			&s.DataBytes, &s.IndexBytes, &s.FreeBytes, &collected); err != nil {
+			return nil, err
+		}
+		s.CollectedAt = parseCapacityTime(collected)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *CapacityRepository) Purge(ctx context.Context, beforeDay string) (int64, error) {
+	var total int64
+	for _, table := range []string{"capacity_table_samples", "capacity_instance_samples"} {
+		result, err := r.db.ExecContext(ctx, `delete from `+table+` where day<?`, beforeDay)
+		if err != nil {
+			return total, err
+		}
+		n, _ := result.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+func formatCapacityTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func parseCapacityTime(value string) time.Time {
+	result, _ := time.Parse(time.RFC3339Nano, value)
+	return result
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	capacitydomain "gmha/internal/domain/capacity"
+	_ "modernc.org/sqlite"
+)
+
+func TestCapacityRepositoryKeepsOneSamplePerDay(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewCapacityRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	instance := capacitydomain.InstanceSample{Cluster: "orders", MachineID: "m1", Port: 3306, Day: "2026-10-19", TableBytes: 10, CollectedAt: now}
+	if err := repo.SaveSamples(ctx, instance, []capacitydomain.TableSample{{Schema: "shop", Table: "orders", DataBytes: 8}, {Schema: "shop", Table: "tmp", DataBytes: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	// A later capture the same day replaces the day, including dropped tables.
+	instance.TableBytes, instance.CollectedAt = 12, now.Add(6*time.Hour)
+	if err := repo.SaveSamples(ctx, instance, []capacitydomain.TableSample{{Schema: "shop", Table: "orders", DataBytes: 12, Rows: 5}}); err != nil {
+		t.Fatal(err)
+	}
+	old := instance
+	old.Day, old.CollectedAt = "2025-01-01", now.AddDate(-1, 0, 0)
+	if err := repo.SaveSamples(ctx, old, []capacitydomain.TableSample{{Schema: "shop", Table: "orders", DataBytes: 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, err := repo.ListInstanceSamples(ctx, "m1", 3306, "2026-01-01")
+	if err != nil || len(instances) != 1 || instances[0].TableBytes != 12 || !instances[0].CollectedAt.Equal(now.Add(6*time.Hour)) {
+		t.Fatalf("unexpected instance samples %+v err=%v", instances, err)
+	}
+	tables, err := repo.ListTableSamples(ctx, "orders", "2026-01-01")
+	if err != nil || len(tables) != 1 || tables[0].Table != "orders" || tables[0].Rows != 5 || tables[0].Cluster != "orders" {
+		t.Fatalf("unexpected table samples %+v err=%v", tables, err)
+	}
+	if n, err := repo.Purge(ctx, "2026-01-01"); err != nil || n != 2 {
+		t.Fatalf("purge removed %d rows err=%v", n, err)
+	}
+}
@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	certdomain "gmha/internal/domain/certificate"
+)
+
+type CertificateRepository struct{ db *DB }
+
+func NewCertificateRepository(db *DB) *CertificateRepository {
+	return &CertificateRepository{db: db}
+}
+
+func (r *CertificateRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists tls_authorities (
+			id varchar(64) primary key,
+			authority_json text not null,
+			not_after varchar(64) not null,
+			created_at varchar(64) not null
+		);
+		create table if not exists tls_certificates (
+			id varchar(160) primary key,
+			cluster_id varchar(255) not null default '',
+			machine_id varchar(255) not null,
+			port integer not null,
+			status varchar(32) not null,
+			certificate_json text not null,
+			not_after varchar(64) not null,
+			created_at varchar(64) not null,
+			updated_at varchar(64) not null
+		);
+		create index if not exists idx_tls_certificates_instance on tls_certificates(machine_id, port, status);
+		create index if not exists idx_tls_certificates_cluster on tls_certificates(cluster_id, status);
+		create table if not exists tls_policies (
+			cluster_id varchar(255) primary key,
+			policy_json text not null,
+			updated_at varchar(64) not null
+		);
+	`)
+	return err
+}
+
+func (r *CertificateRepository) GetAuthority(ctx context.Context, id string) (certdomain.Authority, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select authority_json from tls_authorities where id = ?`, strings.TrimSpace(id)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return certdomain.Authority{}, false, nil
+	}
+	if err != nil {
+		return certdomain.Authority{}, false, err
+	}
+	var authority certdomain.Authority
+	if err := json.Unmarshal([]byte(payload), &authority); err != nil {
+		return certdomain.Authority{}, false, err
+	}
+	return authority, true, nil
+}
+
+func (r *CertificateRepository) SaveAuthority(ctx context.Context, authority certdomain.Authority) error {
+	payload, err := json.Marshal(authority)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into tls_authorities (id, authority_json, not_after, created_at)
+		values (?, ?, ?, ?)
+		on conflict(id) do update set authority_json=excluded.authority_json, not_after=excluded.not_after
+	`, authority.ID, string(payload), authority.NotAfter.UTC().Format(time.RFC3339Nano), authority.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *CertificateRepository) SaveCertificate(ctx context.Context, certificate certdomain.Certificate) error {
+	payload, err := json.Marshal(certificate)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into tls_certificates (id, cluster_id, machine_id, port, status, certificate_json, not_after, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do update set
+			cluster_id=excluded.cluster_id, status=excluded.status, certificate_json=excluded.certificate_json, updated_at=excluded.updated_at
+	`, certificate.ID, certificate.ClusterID, certificate.MachineID, certificate.Port, certificate.Status, string(payload),
+		certificate.NotAfter.UTC().Format(time.RFC3339Nano), certificate.CreatedAt.UTC().Format(time.RFC3339Nano), certificate.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *CertificateRepository) GetCertificate(ctx context.Context, id string) (certdomain.Certificate, bool, error) {
+	return r.getCertificate(ctx, `select certificate_json from tls_certificates where id = ?`, strings.TrimSpace(id))
+}
+
+func (r *CertificateRepository) GetActiveCertificate(ctx context.Context, machineID string, port int) (certdomain.Certificate, bool, error) {
+	return r.getCertificate(ctx, `select certificate_json from tls_certificates where machine_id = ? and port = ? and status = ? order by created_at desc limit 1`,
+		strings.TrimSpace(machineID), port, certdomain.StatusActive)
+}
+
+func (r *CertificateRepository) getCertificate(ctx context.Context, query string, args ...any) (certdomain.Certificate, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return certdomain.Certificate{}, false, nil
+	}
+	if err != nil {
+		return certdomain.Certificate{}, false, err
+	}
+	var certificate certdomain.Certificate
+	if err := json.Unmarshal([]byte(payload), &certificate); err != nil {
+		return certdomain.Certificate{}, false, err
+	}
+	return certificate, true, nil
+}
+
+// ListCertificates returns every certificate of a cluster, or of all clusters
+// when clusterID is empty, newest first.
+func (r *CertificateRepository) ListCertificates(ctx context.Context, clusterID string) ([]certdomain.Certificate, error) {
+	query := `select certificate_json from tls_certificates order by created_at desc`
+	args := []any{}
+	if clusterID = strings.TrimSpace(clusterID); clusterID != "" {
+		query = `select certificate_json from tls_certificates where cluster_id = ? order by created_at desc`
+		args = append(args, clusterID)
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]certdomain.Certificate, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var certificate certdomain.Certificate
+		if err := json.Unmarshal([]byte(payload), &certificate); err != nil {
+			return nil, err
+		}
+		out = append(out, certificate)
+	}
+	return out, rows.Err()
+}
+
+func (r *CertificateRepository) SavePolicy(ctx context.Context, policy certdomain.Policy) error {
+	payload, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into tls_policies (cluster_id, policy_json, updated_at)
+		values (?, ?, ?)
+		on conflict(cluster_id) do update set policy_json=excluded.policy_json, updated_at=excluded.updated_at
+	`, policy.ClusterID, string(payload), policy.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *CertificateRepository) GetPolicy(ctx context.Context, clusterID string) (certdomain.Policy, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select policy_json from tls_policies where cluster_id = ?`, strings.TrimSpace(clusterID)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return certdomain.Policy{}, false, nil
+	}
+	if err != nil {
+		return certdomain.Policy{}, false, err
+	}
+	var policy certdomain.Policy
+	if err := json.Unmarshal([]byte(payload), &policy); err != nil {
+		return certdomain.Policy{}, false, err
+	}
+	return policy, true, nil
+}
@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	certdomain "gmha/internal/domain/certificate"
+	_ "modernc.org/sqlite"
+)
+
+func TestCertificateRepositoryTracksActiveCertificatePerInstance(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewCertificateRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 8, 1, 2, 0, 0, 0, time.UTC)
+	authority := certdomain.Authority{ID: certdomain.DefaultAuthorityID, CertPEM: "ca", KeyPEM: "ca-key", NotAfter: now.AddDate(10, 0, 0), CreatedAt: now}
+	if err := repo.SaveAuthority(ctx, authority); err != nil {
+		t.Fatal(err)
+	}
+	gotCA, ok, err := repo.GetAuthority(ctx, certdomain.DefaultAuthorityID)
+	if err != nil || !ok || gotCA.KeyPEM != "ca-key" || gotCA.Redacted().KeyPEM != "" {
+		t.Fatalf("unexpected authority: %+v ok=%v err=%v", gotCA, ok, err)
+	}
+	old := certdomain.Certificate{ID: "cert-1", ClusterID: "orders", MachineID: "m1", Port: 3306, KeyPEM: "key-1", Status: certdomain.StatusActive, NotAfter: now.AddDate(1, 0, 0), CreatedAt: now, UpdatedAt: now}
+	if err := repo.SaveCertificate(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	old.Status = certdomain.StatusSuperseded
+	if err := repo.SaveCertificate(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	rotated := certdomain.Certificate{ID: "cert-2", ClusterID: "orders", MachineID: "m1", Port: 3306, KeyPEM: "key-2", Status: certdomain.StatusActive, NotAfter: now.AddDate(2, 0, 0), CreatedAt: now.Add(time.Minute), UpdatedAt: now.Add(time.Minute)}
+	if err := repo.SaveCertificate(ctx, rotated); err != nil {
+		t.Fatal(err)
+	}
+	active, ok, err := repo.GetActiveCertificate(ctx, "m1", 3306)
+	if err != nil || !ok || active.ID != "cert-2" || active.KeyPEM != "key-2" {
+		t.Fatalf("rotation must leave exactly the new certificate active: %+v ok=%v err=%v", active, ok, err)
+	}
+	items, err := repo.ListCertificates(ctx, "orders")
+	if err != nil || len(items) != 2 || items[0].ID != "cert-2" {
+		t.Fatalf("unexpected certificates: %+v err=%v", items, err)
+	}
+	policy := certdomain.Policy{ClusterID: "orders", ReplicationSSL: true, VerifyServerCert: true, WarnDays: 30, UpdatedAt: now}
+	if err := repo.SavePolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.GetPolicy(ctx, "orders")
+	if err != nil || !ok || !got.ReplicationSSL || !got.VerifyServerCert {
+		t.Fatalf("unexpected policy: %+v ok=%v err=%v", got, ok, err)
+	}
+	if _, ok, err := repo.GetPolicy(ctx, "missing"); err != nil || ok {
+		t.Fatalf("missing policy must not be found: ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	driftdomain "gmha/internal/domain/configdrift"
+)
+
+type ConfigDriftRepository struct{ db *DB }
+
+func NewConfigDriftRepository(db *DB) *ConfigDriftRepository {
+	return &ConfigDriftRepository{db: db}
+}
+
+func (r *ConfigDriftRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists mysql_config_desired (
+			cluster_name varchar(255) primary key, desired_json text not null, updated_at varchar(64) not null
+		);
+		create table if not exists mysql_config_snapshots (
+			machine_id varchar(160) not null, port integer not null, cluster_name varchar(255) not null default '',
+			drifted integer not null default 0, collected_at varchar(64) not null, snapshot_json text not null,
+			primary key (machine_id, port)
+		);
+		create index if not exists idx_mysql_config_snapshots_cluster on mysql_config_snapshots(cluster_name);
+	`)
+	return err
+}
+
+func (r *ConfigDriftRepository) GetDesired(ctx context.Context, cluster string) (driftdomain.Desired, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select desired_json from mysql_config_desired where cluster_name=?`, strings.TrimSpace(cluster)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return driftdomain.Desired{}, false, nil
+	}
+	if err != nil {
+		return driftdomain.Desired{}, false, err
+	}
+	var desired driftdomain.Desired
+	if err := json.Unmarshal([]byte(payload), &desired); err != nil {
+		return driftdomain.Desired{}, false, err
+	}
+	return desired, true, nil
+}
+
+func (r *ConfigDriftRepository) SaveDesired(ctx context.Context, desired driftdomain.Desired) error {
+	payload, err := json.Marshal(desired)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_config_desired (cluster_name, desired_json, updated_at) values (?, ?, ?)
+		on conflict(cluster_name) do update set desired_json=excluded.desired_json, updated_at=excluded.updated_at`,
+		desired.Cluster, string(payload), formatConfigDriftTime(desired.UpdatedAt))
+	return err
+}
+
+func (r *ConfigDriftRepository) DeleteDesired(ctx context.Context, cluster string) error {
+	_, err := r.db.ExecContext(ctx, `delete from mysql_config_desired where cluster_name=?`, strings.TrimSpace(cluster))
+	return err
+}
+
+func (r *ConfigDriftRepository) ListDesired(ctx context.Context) ([]driftdomain.Desired, error) {
+	rows, err := r.db.QueryContext(ctx, `select desired_json from mysql_config_desired order by cluster_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]driftdomain.Desired, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var desired driftdomain.Desired
+		if err := json.Unmarshal([]byte(payload), &desired); err != nil {
+			return nil, err
+		}
+		out = append(out, desired)
+	}
+	return out, rows.Err()
+}
+
+func (r *ConfigDriftRepository) GetSnapshot(ctx context.Context, machineID string, port int) (driftdomain.Snapshot, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select snapshot_json from mysql_config_snapshots where machine_id=? and port=?`, strings.TrimSpace(machineID), port).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return driftdomain.Snapshot{}, false, nil
+	}
+	if err != nil {
+		return driftdomain.Snapshot{}, false, err
+	}
+	var snapshot driftdomain.Snapshot
+	if err := json.Unmarshal([]byte(payload), &snapshot); err != nil {
+		return driftdomain.Snapshot{}, false, err
+	}
+	return snapshot, true, nil
+}
+
+func (r *ConfigDriftRepository) SaveSnapshot(ctx context.Context, snapshot driftdomain.Snapshot) error {
+	payload, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_config_snapshots (machine_id, port, cluster_name, drifted, collected_at, snapshot_json)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict(machine_id, port) do update set cluster_name=excluded.cluster_name, drifted=excluded.drifted,
+		collected_at=excluded.collected_at, snapshot_json=excluded.snapshot_json`,
+		snapshot.MachineID, snapshot.Port, snapshot.Cluster, len(snapshot.Findings), formatConfigDriftTime(snapshot.CollectedAt), string(payload))
+	return err
+}
+
+func (r *ConfigDriftRepository) ListSnapshots(ctx context.Context, cluster string) ([]driftdomain.Snapshot, error) {
+	cluster = strings.TrimSpace(cluster)
+	rows, err := r.db.QueryContext(ctx, `select snapshot_json from mysql_config_snapshots where (?='' or cluster_name=?) order by cluster_name, machine_id, port`, cluster, cluster)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]driftdomain.Snapshot, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var snapshot driftdomain.Snapshot
+		if err := json.Unmarshal([]byte(payload), &snapshot); err != nil {
+			return nil, err
+		}
+		out = append(out, snapshot)
+	}
+	return out, rows.Err()
+}
+
+func (r *ConfigDriftRepository) DeleteSnapshot(ctx context.Context, machineID string, port int) error {
+	_, err := r.db.ExecContext(ctx, `delete from mysql_config_snapshots where machine_id=? and port=?`, strings.TrimSpace(machineID), port)
+	return err
+}
+
+func formatConfigDriftTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	driftdomain "gmha/internal/domain/configdrift"
+	_ "modernc.org/sqlite"
+)
+
+func TestConfigDriftRepositoryStoresDesiredAndSnapshots(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewConfigDriftRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	desired := driftdomain.Desired{Cluster: "orders", Parameters: map[string]string{"max_connections": "2000"}, UpdatedAt: time.Now()}
+	if err := repo.SaveDesired(ctx, desired); err != nil {
+		t.Fatal(err)
+	}
+	desired.Parameters["max_connections"] = "3000"
+	if err := repo.SaveDesired(ctx, desired); err != nil {
+		t.Fatal(err)
+	}
+	stored, ok, err := repo.GetDesired(ctx, "orders")
+	if err != nil || !ok || stored.Parameters["max_connections"] != "3000" {
+		t.Fatalf("desired = %+v, %v, %v", stored, ok, err)
+	}
+
+	now := time.Now().UTC()
+	for _, snapshot := range []driftdomain.Snapshot{
+		{Cluster: "orders", MachineID: "m1", Port: 3306, Runtime: map[string]string{"max_connections": "2000"}, CollectedAt: now},
+		{Cluster: "orders", MachineID: "m2", Port: 3306, CollectedAt: now, Findings: []driftdomain.Finding{{Variable: "max_connections", Kind: driftdomain.KindDesiredRuntime}}},
+		{Cluster: "billing", MachineID: "m3", Port: 3306, CollectedAt: now},
+	} {
+		if err := repo.SaveSnapshot(ctx, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := repo.ListSnapshots(ctx, "orders")
+	if err != nil || len(items) != 2 || items[0].Runtime["max_connections"] != "2000" || len(items[1].Findings) != 1 {
+		t.Fatalf("snapshots = %+v, %v", items, err)
+	}
+	if all, _ := repo.ListSnapshots(ctx, ""); len(all) != 3 {
+		t.Fatalf("all snapshots = %d", len(all))
+	}
+	if err := repo.DeleteSnapshot(ctx, "m1", 3306); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := repo.GetSnapshot(ctx, "m1", 3306); ok {
+		t.Fatal("snapshot must be deleted")
+	}
+	if err := repo.DeleteDesired(ctx, "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := repo.ListDesired(ctx); len(items) != 0 {
+		t.Fatalf("desired after delete = %+v", items)
+	}
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	rotationdomain "gmha/internal/domain/credrotation"
+)
+
+const credentialRotationScheduleID = "default"
+
+// CredentialRotationRepository 持久化 MySQL 账号密码轮换的审计记录和计划。
+// 轮换进行中的新旧密码与 mysql_account_presets 一样以明文保存在单独的列中，
+// 轮换结束后清空，审计记录本身不包含任何密码。
+type CredentialRotationRepository struct{ db *DB }
+
+func NewCredentialRotationRepository(db *DB) *CredentialRotationRepository {
+	return &CredentialRotationRepository{db: db}
+}
+
+func (r *CredentialRotationRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists mysql_credential_rotations (
+			id varchar(64) primary key, status varchar(32) not null, rotation_json text not null,
+			secrets_json text not null default '', created_at varchar(64) not null
+		);
+		create index if not exists idx_mysql_credential_rotations_created on mysql_credential_rotations(created_at);
+		create table if not exists mysql_credential_rotation_schedules (
+			id varchar(32) primary key, schedule_json text not null, updated_at varchar(64) not null
+		);
+	`)
+	return err
+}
+
+func (r *CredentialRotationRepository) GetRotation(ctx context.Context, id string) (rotationdomain.Rotation, bool, error) {
+	var payload, secrets string
+	err := r.db.QueryRowContext(ctx, `select rotation_json, secrets_json from mysql_credential_rotations where id=?`, strings.TrimSpace(id)).Scan(&payload, &secrets)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rotationdomain.Rotation{}, false, nil
+	}
+	if err != nil {
+		return rotationdomain.Rotation{}, false, err
+	}
+	var rotation rotationdomain.Rotation
+	if err := json.Unmarshal([]byte(payload), &rotation); err != nil {
+		return rotationdomain.Rotation{}, false, err
+	}
+	if strings.TrimSpace(secrets) != "" {
+		if err := json.Unmarshal([]byte(secrets), &rotation.Secrets); err != nil {
+			return rotationdomain.Rotation{}, false, err
+		}
+	}
+	return rotation, true, nil
+}
+
+func (r *CredentialRotationRepository) SaveRotation(ctx context.Context, rotation rotationdomain.Rotation) error {
+	payload, err := json.Marshal(rotation)
+	if err != nil {
+		return err
+	}
+	secrets := ""
+	if len(rotation.Secrets) > 0 {
+		data, err := json.Marshal(rotation.Secrets)
+		if err != nil {
+			return err
+		}
+		secrets = string(data)
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_credential_rotations (id, status, rotation_json, secrets_json, created_at) values (?, ?, ?, ?, ?)
+		on conflict(id) do update set status=excluded.status, rotation_json=excluded.rotation_json, secrets_json=excluded.secrets_json`,
+		rotation.ID, rotation.Status, string(payload), secrets, formatCredentialRotationTime(rotation.CreatedAt))
+	return err
+}
+
+func (r *CredentialRotationRepository) ListRotations(ctx context.Context, status string, limit int) ([]rotationdomain.Rotation, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	status = strings.TrimSpace(status)
+	rows, err := r.db.QueryContext(ctx, `select rotation_json from mysql_credential_rotations where (?='' or status=?) order by created_at desc, id desc limit ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]rotationdomain.Rotation, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var rotation rotationdomain.Rotation
+		if err := json.Unmarshal([]byte(payload), &rotation); err != nil {
+			return nil, err
+		}
+		out = append(out, rotation)
+	}
+	return out, rows.Err()
+}
+
+func (r *CredentialRotationRepository) GetSchedule(ctx context.Context) (rotationdomain.Schedule, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select schedule_json from mysql_credential_rotation_schedules where id=?`, credentialRotationScheduleID).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rotationdomain.Schedule{}, false, nil
+	}
+	if err != nil {
+		return rotationdomain.Schedule{}, false, err
+	}
+	var schedule rotationdomain.Schedule
+	return schedule, true, json.Unmarshal([]byte(payload), &schedule)
+}
+
+func (r *CredentialRotationRepository) SaveSchedule(ctx context.Context, schedule rotationdomain.Schedule) error {
+	payload, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_credential_rotation_schedules (id, schedule_json, updated_at) values (?, ?, ?)
+		on conflict(id) do update set schedule_json=excluded.schedule_json, updated_at=excluded.updated_at`,
+		credentialRotationScheduleID, string(payload), formatCredentialRotationTime(schedule.UpdatedAt))
+	return err
+}
+
+func formatCredentialRotationTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
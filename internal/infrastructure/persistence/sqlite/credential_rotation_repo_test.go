@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	rotationdomain "gmha/internal/domain/credrotation"
+	_ "modernc.org/sqlite"
+)
+
+func TestCredentialRotationRepositoryKeepsSecretsOutOfTheAuditRecord(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewCredentialRotationRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	rotation := rotationdomain.Rotation{
+		ID: "rotation-1", Roles: []string{"mha"}, Status: rotationdomain.StatusFailed, Steps: []rotationdomain.Step{}, CreatedAt: now, UpdatedAt: now,
+		Secrets: map[string]rotationdomain.Secret{"mha": {Username: "mha", Password: "new-secret", Previous: "old-secret"}},
+	}
+	if err := repo.SaveRotation(ctx, rotation); err != nil {
+		t.Fatal(err)
+	}
+	var payload string
+	if err := db.QueryRow(`select rotation_json from mysql_credential_rotations where id='rotation-1'`).Scan(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(payload, "secret") {
+		t.Fatalf("audit record must not contain passwords: %s", payload)
+	}
+	got, ok, err := repo.GetRotation(ctx, "rotation-1")
+	if err != nil || !ok || got.Secrets["mha"].Password != "new-secret" || got.Secrets["mha"].Previous != "old-secret" {
+		t.Fatalf("rotation = %+v, %v, %v", got, ok, err)
+	}
+	later := rotation
+	later.ID, later.Status, later.CreatedAt, later.Secrets = "rotation-2", rotationdomain.StatusSucceeded, now.Add(time.Minute), nil
+	if err := repo.SaveRotation(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := repo.GetRotation(ctx, "rotation-2"); len(got.Secrets) != 0 {
+		t.Fatalf("closed rotation must not keep secrets: %+v", got.Secrets)
+	}
+	items, err := repo.ListRotations(ctx, "", 10)
+	if err != nil || len(items) != 2 || items[0].ID != "rotation-2" {
+		t.Fatalf("rotations = %+v, %v", items, err)
+	}
+	if items, _ := repo.ListRotations(ctx, rotationdomain.StatusFailed, 10); len(items) != 1 || items[0].ID != "rotation-1" {
+		t.Fatalf("failed rotations = %+v", items)
+	}
+
+	if _, ok, err := repo.GetSchedule(ctx); err != nil || ok {
+		t.Fatalf("schedule before save = %v, %v", ok, err)
+	}
+	schedule := rotationdomain.Schedule{Enabled: true, Roles: []string{"mha", "monitor"}, IntervalDays: 90, NextRunAt: now, UpdatedAt: now}
+	if err := repo.SaveSchedule(ctx, schedule); err != nil {
+		t.Fatal(err)
+	}
+	saved, ok, err := repo.GetSchedule(ctx)
+	if err != nil || !ok || !saved.Enabled || saved.IntervalDays != 90 || len(saved.Roles) != 2 {
+		t.Fatalf("schedule = %+v, %v, %v", saved, ok, err)
+	}
+}
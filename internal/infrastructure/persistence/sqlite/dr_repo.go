@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	drdomain "gmha/internal/domain/dr"
+)
+
+type DRRepository struct{ db *DB }
+
+func NewDRRepository(db *DB) *DRRepository {
+	return &DRRepository{db: db}
+}
+
+func (r *DRRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists dr_links (
+			id varchar(64) primary key,
+			source_cluster_id varchar(255) not null,
+			target_cluster_id varchar(255) not null,
+			status varchar(32) not null,
+			link_json text not null,
+			created_at varchar(64) not null,
+			updated_at varchar(64) not null
+		);
+		create table if not exists dr_promotions (
+			id varchar(64) primary key,
+			link_id varchar(64) not null,
+			status varchar(32) not null,
+			promotion_json text not null,
+			started_at varchar(64) not null
+		);
+		create index if not exists idx_dr_promotions_link on dr_promotions(link_id, started_at);
+	`)
+	return err
+}
+
+func (r *DRRepository) SaveLink(ctx context.Context, link drdomain.Link) error {
+	payload, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into dr_links (id, source_cluster_id, target_cluster_id, status, link_json, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do update set
+			source_cluster_id=excluded.source_cluster_id, target_cluster_id=excluded.target_cluster_id,
+			status=excluded.status, link_json=excluded.link_json, updated_at=excluded.updated_at
+	`, link.ID, link.SourceClusterID, link.TargetClusterID, link.Status, string(payload),
+		link.CreatedAt.UTC().Format(time.RFC3339Nano), link.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *DRRepository) GetLink(ctx context.Context, id string) (drdomain.Link, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select link_json from dr_links where id = ?`, strings.TrimSpace(id)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return drdomain.Link{}, false, nil
+	}
+	if err != nil {
+		return drdomain.Link{}, false, err
+	}
+	var link drdomain.Link
+	if err := json.Unmarshal([]byte(payload), &link); err != nil {
+		return drdomain.Link{}, false, err
+	}
+	return link, true, nil
+}
+
+func (r *DRRepository) ListLinks(ctx context.Context) ([]drdomain.Link, error) {
+	rows, err := r.db.QueryContext(ctx, `select link_json from dr_links order by created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]drdomain.Link, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var link drdomain.Link
+		if err := json.Unmarshal([]byte(payload), &link); err != nil {
+			return nil, err
+		}
+		out = append(out, link)
+	}
+	return out, rows.Err()
+}
+
+func (r *DRRepository) DeleteLink(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `delete from dr_links where id = ?`, strings.TrimSpace(id))
+	return err
+}
+
+func (r *DRRepository) SavePromotion(ctx context.Context, promotion drdomain.Promotion) error {
+	payload, err := json.Marshal(promotion)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into dr_promotions (id, link_id, status, promotion_json, started_at)
+		values (?, ?, ?, ?, ?)
+		on conflict(id) do update set status=excluded.status, promotion_json=excluded.promotion_json
+	`, promotion.ID, promotion.LinkID, promotion.Status, string(payload), promotion.StartedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *DRRepository) ListPromotions(ctx context.Context, linkID string, limit int) ([]drdomain.Promotion, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := r.db.QueryContext(ctx, `select promotion_json from dr_promotions where link_id = ? order by started_at desc limit ?`, strings.TrimSpace(linkID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]drdomain.Promotion, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var promotion drdomain.Promotion
+		if err := json.Unmarshal([]byte(payload), &promotion); err != nil {
+			return nil, err
+		}
+		out = append(out, promotion)
+	}
+	return out, rows.Err()
+}
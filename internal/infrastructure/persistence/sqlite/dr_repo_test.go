@@ -0,0 +1,55 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	drdomain "gmha/internal/domain/dr"
+	_ "modernc.org/sqlite"
+)
+
+func TestDRRepositoryStoresLinksAndPromotions(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewDRRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 8, 1, 2, 0, 0, 0, time.UTC)
+	link := drdomain.Link{ID: "dr-1", SourceClusterID: "orders", TargetClusterID: "orders-dr", Status: drdomain.StatusConfiguring, Health: drdomain.LinkHealth{GTIDGap: -1}, CreatedAt: now, UpdatedAt: now}
+	if err := repo.SaveLink(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	link.Status = drdomain.StatusRunning
+	link.Health.GTIDGap = 3
+	if err := repo.SaveLink(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.GetLink(ctx, "dr-1")
+	if err != nil || !ok || got.Status != drdomain.StatusRunning || got.Health.GTIDGap != 3 || !got.CreatedAt.Equal(now) {
+		t.Fatalf("unexpected link: %+v ok=%v err=%v", got, ok, err)
+	}
+	for i, started := range []time.Time{now, now.Add(time.Hour)} {
+		promotion := drdomain.Promotion{ID: "drp-" + string(rune('a'+i)), LinkID: "dr-1", Status: drdomain.PromotionSucceeded, StartedAt: started}
+		if err := repo.SavePromotion(ctx, promotion); err != nil {
+			t.Fatal(err)
+		}
+	}
+	promotions, err := repo.ListPromotions(ctx, "dr-1", 0)
+	if err != nil || len(promotions) != 2 || promotions[0].ID != "drp-b" {
+		t.Fatalf("promotions must be newest first: %+v err=%v", promotions, err)
+	}
+	if err := repo.DeleteLink(ctx, "dr-1"); err != nil {
+		t.Fatal(err)
+	}
+	if links, err := repo.ListLinks(ctx); err != nil || len(links) != 0 {
+		t.Fatalf("link must be deleted: %+v err=%v", links, err)
+	}
+}
@@ -249,6 +249,15 @@ func (r *HARepository) Migrate() error {
 			updated_at text not null
 		);
 		create index if not exists idx_architecture_run_cluster on architecture_adjustment_run(cluster_id, created_at);
+		create table if not exists ha_switchover (
+			switchover_id text primary key,
+			cluster_id text not null,
+			status text not null,
+			switchover_json text not null,
+			created_at text not null,
+			updated_at text not null
+		);
+		create index if not exists idx_ha_switchover_cluster on ha_switchover(cluster_id, created_at);
 	`)
 	return err
 }
@@ -323,6 +332,98 @@ func (r *HARepository) MarkInterruptedArchitectureRuns(ctx context.Context) erro
 	return nil
 }
 
+// SaveSwitchover 持久化计划内切换记录及其阶段耗时。
+func (r *HARepository) SaveSwitchover(ctx context.Context, item hadomain.Switchover) error {
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into ha_switchover (switchover_id, cluster_id, status, switchover_json, created_at, updated_at)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict(switchover_id) do update set
+			status=excluded.status, switchover_json=excluded.switchover_json, updated_at=excluded.updated_at
+	`, item.SwitchoverID, item.ClusterID, item.Status, string(payload), item.CreatedAt.UTC().Format(time.RFC3339Nano), item.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// GetSwitchover 读取一条计划内切换记录。
+func (r *HARepository) GetSwitchover(ctx context.Context, clusterID, switchoverID string) (hadomain.Switchover, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select switchover_json from ha_switchover where cluster_id = ? and switchover_id = ?`, strings.TrimSpace(clusterID), strings.TrimSpace(switchoverID)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hadomain.Switchover{}, false, nil
+	}
+	if err != nil {
+		return hadomain.Switchover{}, false, err
+	}
+	var item hadomain.Switchover
+	if err := json.Unmarshal([]byte(payload), &item); err != nil {
+		return hadomain.Switchover{}, false, err
+	}
+	return item, true, nil
+}
+
+// ListSwitchovers 按时间倒序返回集群的切换记录。
+func (r *HARepository) ListSwitchovers(ctx context.Context, clusterID string, limit int) ([]hadomain.Switchover, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := r.db.QueryContext(ctx, `select switchover_json from ha_switchover where cluster_id = ? order by created_at desc limit ?`, strings.TrimSpace(clusterID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []hadomain.Switchover
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var item hadomain.Switchover
+		if err := json.Unmarshal([]byte(payload), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// MarkInterruptedSwitchovers 把 Manager 重启时仍在进行的切换标记为失败，需人工确认角色后重新发起。
+func (r *HARepository) MarkInterruptedSwitchovers(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, `select switchover_json from ha_switchover where status in (?, ?)`, hadomain.SwitchoverPending, hadomain.SwitchoverRunning)
+	if err != nil {
+		return err
+	}
+	var items []hadomain.Switchover
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		var item hadomain.Switchover
+		if err := json.Unmarshal([]byte(payload), &item); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, item := range items {
+		item.Status = hadomain.SwitchoverFailed
+		item.Error = "Manager restarted during switchover; inspect MySQL roles, replication and VIP holders before retrying."
+		item.UpdatedAt, item.FinishedAt = now, &now
+		if err := r.SaveSwitchover(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *HARepository) EnsureDefaultPolicies(ctx context.Context, clusterID string) error {
 	clusterID = strings.TrimSpace(clusterID)
 	if clusterID == "" {
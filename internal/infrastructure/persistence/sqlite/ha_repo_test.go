@@ -146,3 +146,46 @@ func TestHARepositoryArchitectureRunRoundTripAndRestartRecovery(t *testing.T) {
 		t.Fatal("architecture credentials must never be persisted")
 	}
 }
+
+func TestHARepositorySwitchoverRoundTripAndRestartRecovery(t *testing.T) {
+	db, err := sql.Open("sqlite", t.TempDir()+"/switchover.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewDB(db, DialectSQLite)
+	if err := NewClusterRepository(store).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewMySQLInstanceRepository(store).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewHARepository(store)
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	done := hadomain.Switchover{SwitchoverID: "so-1", ClusterID: "demo", Status: hadomain.SwitchoverSucceeded, WriteFreezeMS: 850, WithinBudget: true,
+		Phases: []hadomain.SwitchoverPhase{{Name: hadomain.SwitchoverPhaseFence, Status: "success", DurationMS: 120}}, CreatedAt: now.Add(-time.Hour), UpdatedAt: now}
+	running := hadomain.Switchover{SwitchoverID: "so-2", ClusterID: "demo", Status: hadomain.SwitchoverRunning, CreatedAt: now, UpdatedAt: now}
+	for _, item := range []hadomain.Switchover{done, running} {
+		if err := repo.SaveSwitchover(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.MarkInterruptedSwitchovers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	items, err := repo.ListSwitchovers(ctx, "demo", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].SwitchoverID != "so-2" || items[0].Status != hadomain.SwitchoverFailed || items[0].FinishedAt == nil {
+		t.Fatalf("interrupted switchover was not reconciled or ordered: %+v", items)
+	}
+	saved, found, err := repo.GetSwitchover(ctx, "demo", "so-1")
+	if err != nil || !found || saved.Status != hadomain.SwitchoverSucceeded || len(saved.Phases) != 1 || saved.Phases[0].DurationMS != 120 {
+		t.Fatalf("finished switchover must be kept intact: %+v found=%v err=%v", saved, found, err)
+	}
+}
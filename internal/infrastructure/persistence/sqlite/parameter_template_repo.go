@@ -0,0 +1,246 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	templatedomain "gmha/internal/domain/paramtemplate"
+)
+
+type ParameterTemplateRepository struct{ db *DB }
+
+func NewParameterTemplateRepository(db *DB) *ParameterTemplateRepository {
+	return &ParameterTemplateRepository{db: db}
+}
+
+func (r *ParameterTemplateRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists mysql_parameter_templates (
+			name varchar(128) primary key, template_json text not null, updated_at varchar(64) not null
+		);
+		create table if not exists mysql_parameter_template_versions (
+			template_name varchar(128) not null, version integer not null, version_json text not null, created_at varchar(64) not null,
+			primary key (template_name, version)
+		);
+		create table if not exists mysql_parameter_template_attachments (
+			cluster_name varchar(255) primary key, template_name varchar(128) not null, attachment_json text not null, updated_at varchar(64) not null
+		);
+		create table if not exists mysql_parameter_template_rollouts (
+			id varchar(64) primary key, cluster_name varchar(255) not null, status varchar(32) not null,
+			rollout_json text not null, created_at varchar(64) not null
+		);
+		create index if not exists idx_mysql_parameter_template_rollouts_cluster on mysql_parameter_template_rollouts(cluster_name, created_at);
+		create table if not exists mysql_parameter_instance_changes (
+			id varchar(64) primary key, machine_id varchar(160) not null, port integer not null,
+			change_json text not null, created_at varchar(64) not null
+		);
+		create index if not exists idx_mysql_parameter_instance_changes_instance on mysql_parameter_instance_changes(machine_id, port, created_at);
+	`)
+	return err
+}
+
+func (r *ParameterTemplateRepository) GetTemplate(ctx context.Context, name string) (templatedomain.Template, bool, error) {
+	var template templatedomain.Template
+	ok, err := r.getJSON(ctx, `select template_json from mysql_parameter_templates where name=?`, &template, strings.TrimSpace(name))
+	return template, ok, err
+}
+
+func (r *ParameterTemplateRepository) SaveTemplate(ctx context.Context, template templatedomain.Template) error {
+	payload, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_parameter_templates (name, template_json, updated_at) values (?, ?, ?)
+		on conflict(name) do update set template_json=excluded.template_json, updated_at=excluded.updated_at`,
+		template.Name, string(payload), formatParameterTemplateTime(template.UpdatedAt))
+	return err
+}
+
+func (r *ParameterTemplateRepository) ListTemplates(ctx context.Context) ([]templatedomain.Template, error) {
+	out := make([]templatedomain.Template, 0)
+	err := r.listJSON(ctx, `select template_json from mysql_parameter_templates order by name`, func(payload []byte) error {
+		var template templatedomain.Template
+		if err := json.Unmarshal(payload, &template); err != nil {
+			return err
+		}
+		out = append(out, template)
+		return nil
+	})
+	return out, err
+}
+
+func (r *ParameterTemplateRepository) DeleteTemplate(ctx context.Context, name string) error {
+	name = strings.TrimSpace(name)
+	if _, err := r.db.ExecContext(ctx, `delete from mysql_parameter_template_versions where template_name=?`, name); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `delete from mysql_parameter_templates where name=?`, name)
+	return err
+}
+
+func (r *ParameterTemplateRepository) GetVersion(ctx context.Context, template string, version int) (templatedomain.Version, bool, error) {
+	var item templatedomain.Version
+	ok, err := r.getJSON(ctx, `select version_json from mysql_parameter_template_versions where template_name=? and version=?`, &item, strings.TrimSpace(template), version)
+	return item, ok, err
+}
+
+// SaveVersion inserts a new version; versions are immutable, so saving an
+// existing number fails.
+func (r *ParameterTemplateRepository) SaveVersion(ctx context.Context, version templatedomain.Version) error {
+	payload, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_parameter_template_versions (template_name, version, version_json, created_at) values (?, ?, ?, ?)`,
+		version.Template, version.Version, string(payload), formatParameterTemplateTime(version.CreatedAt))
+	return err
+}
+
+func (r *ParameterTemplateRepository) ListVersions(ctx context.Context, template string) ([]templatedomain.Version, error) {
+	out := make([]templatedomain.Version, 0)
+	err := r.listJSON(ctx, `select version_json from mysql_parameter_template_versions where template_name=? order by version desc`, func(payload []byte) error {
+		var item templatedomain.Version
+		if err := json.Unmarshal(payload, &item); err != nil {
+			return err
+		}
+		out = append(out, item)
+		return nil
+	}, strings.TrimSpace(template))
+	return out, err
+}
+
+func (r *ParameterTemplateRepository) GetAttachment(ctx context.Context, cluster string) (templatedomain.Attachment, bool, error) {
+	var attachment templatedomain.Attachment
+	ok, err := r.getJSON(ctx, `select attachment_json from mysql_parameter_template_attachments where cluster_name=?`, &attachment, strings.TrimSpace(cluster))
+	return attachment, ok, err
+}
+
+func (r *ParameterTemplateRepository) SaveAttachment(ctx context.Context, attachment templatedomain.Attachment) error {
+	payload, err := json.Marshal(attachment)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_parameter_template_attachments (cluster_name, template_name, attachment_json, updated_at) values (?, ?, ?, ?)
+		on conflict(cluster_name) do update set template_name=excluded.template_name, attachment_json=excluded.attachment_json, updated_at=excluded.updated_at`,
+		attachment.Cluster, attachment.Template, string(payload), formatParameterTemplateTime(attachment.UpdatedAt))
+	return err
+}
+
+func (r *ParameterTemplateRepository) DeleteAttachment(ctx context.Context, cluster string) error {
+	_, err := r.db.ExecContext(ctx, `delete from mysql_parameter_template_attachments where cluster_name=?`, strings.TrimSpace(cluster))
+	return err
+}
+
+func (r *ParameterTemplateRepository) ListAttachments(ctx context.Context) ([]templatedomain.Attachment, error) {
+	out := make([]templatedomain.Attachment, 0)
+	err := r.listJSON(ctx, `select attachment_json from mysql_parameter_template_attachments order by cluster_name`, func(payload []byte) error {
+		var attachment templatedomain.Attachment
+		if err := json.Unmarshal(payload, &attachment); err != nil {
+			return err
+		}
+		out = append(out, attachment)
+		return nil
+	})
+	return out, err
+}
+
+func (r *ParameterTemplateRepository) GetRollout(ctx context.Context, id string) (templatedomain.Rollout, bool, error) {
+	var rollout templatedomain.Rollout
+	ok, err := r.getJSON(ctx, `select rollout_json from mysql_parameter_template_rollouts where id=?`, &rollout, strings.TrimSpace(id))
+	return rollout, ok, err
+}
+
+func (r *ParameterTemplateRepository) SaveRollout(ctx context.Context, rollout templatedomain.Rollout) error {
+	payload, err := json.Marshal(rollout)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_parameter_template_rollouts (id, cluster_name, status, rollout_json, created_at) values (?, ?, ?, ?, ?)
+		on conflict(id) do update set status=excluded.status, rollout_json=excluded.rollout_json`,
+		rollout.ID, rollout.Cluster, rollout.Status, string(payload), formatParameterTemplateTime(rollout.CreatedAt))
+	return err
+}
+
+func (r *ParameterTemplateRepository) ListRollouts(ctx context.Context, cluster, status string, limit int) ([]templatedomain.Rollout, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	cluster, status = strings.TrimSpace(cluster), strings.TrimSpace(status)
+	out := make([]templatedomain.Rollout, 0)
+	err := r.listJSON(ctx, `select rollout_json from mysql_parameter_template_rollouts where (?='' or cluster_name=?) and (?='' or status=?) order by created_at desc, id desc limit ?`, func(payload []byte) error {
+		var rollout templatedomain.Rollout
+		if err := json.Unmarshal(payload, &rollout); err != nil {
+			return err
+		}
+		out = append(out, rollout)
+		return nil
+	}, cluster, cluster, status, status, limit)
+	return out, err
+}
+
+func (r *ParameterTemplateRepository) AppendInstanceChange(ctx context.Context, change templatedomain.InstanceChange) error {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into mysql_parameter_instance_changes (id, machine_id, port, change_json, created_at) values (?, ?, ?, ?, ?)`,
+		change.ID, change.MachineID, change.Port, string(payload), formatParameterTemplateTime(change.CreatedAt))
+	return err
+}
+
+func (r *ParameterTemplateRepository) ListInstanceChanges(ctx context.Context, machineID string, port int, limit int) ([]templatedomain.InstanceChange, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	out := make([]templatedomain.InstanceChange, 0)
+	err := r.listJSON(ctx, `select change_json from mysql_parameter_instance_changes where machine_id=? and port=? order by created_at desc, id desc limit ?`, func(payload []byte) error {
+		var change templatedomain.InstanceChange
+		if err := json.Unmarshal(payload, &change); err != nil {
+			return err
+		}
+		out = append(out, change)
+		return nil
+	}, strings.TrimSpace(machineID), port, limit)
+	return out, err
+}
+
+func (r *ParameterTemplateRepository) getJSON(ctx context.Context, query string, out any, args ...any) (bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(payload), out)
+}
+
+func (r *ParameterTemplateRepository) listJSON(ctx context.Context, query string, decode func([]byte) error, args ...any) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return err
+		}
+		if err := decode([]byte(payload)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func formatParameterTemplateTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	templatedomain "gmha/internal/domain/paramtemplate"
+	_ "modernc.org/sqlite"
+)
+
+func TestParameterTemplateRepositoryStoresVersionsRolloutsAndHistory(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewParameterTemplateRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if err := repo.SaveTemplate(ctx, templatedomain.Template{Name: "oltp", LatestVersion: 2, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for version := 1; version <= 2; version++ {
+		if err := repo.SaveVersion(ctx, templatedomain.Version{Template: "oltp", Version: version, Parameters: map[string]string{"max_connections": "1000"}, CreatedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SaveVersion(ctx, templatedomain.Version{Template: "oltp", Version: 2, CreatedAt: now}); err == nil {
+		t.Fatal("versions must be immutable")
+	}
+	versions, err := repo.ListVersions(ctx, "oltp")
+	if err != nil || len(versions) != 2 || versions[0].Version != 2 || versions[0].Parameters["max_connections"] != "1000" {
+		t.Fatalf("versions = %+v, %v", versions, err)
+	}
+
+	if err := repo.SaveAttachment(ctx, templatedomain.Attachment{Cluster: "orders", Template: "oltp", Version: 1, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SaveAttachment(ctx, templatedomain.Attachment{Cluster: "orders", Template: "oltp", Version: 2, PreviousVersion: 1, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	attachment, ok, err := repo.GetAttachment(ctx, "orders")
+	if err != nil || !ok || attachment.Version != 2 || attachment.PreviousVersion != 1 {
+		t.Fatalf("attachment = %+v, %v, %v", attachment, ok, err)
+	}
+
+	for index, status := range []string{templatedomain.RolloutSucceeded, templatedomain.RolloutRunning} {
+		rollout := templatedomain.Rollout{ID: "r" + string(rune('1'+index)), Cluster: "orders", Status: status, CreatedAt: now.Add(time.Duration(index) * time.Second)}
+		if err := repo.SaveRollout(ctx, rollout); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SaveRollout(ctx, templatedomain.Rollout{ID: "r3", Cluster: "billing", Status: templatedomain.RolloutRunning, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := repo.ListRollouts(ctx, "orders", "", 10); len(items) != 2 || items[0].ID != "r2" {
+		t.Fatalf("orders rollouts = %+v", items)
+	}
+	if items, _ := repo.ListRollouts(ctx, "", templatedomain.RolloutRunning, 10); len(items) != 2 {
+		t.Fatalf("running rollouts = %+v", items)
+	}
+
+	for index := 0; index < 3; index++ {
+		change := templatedomain.InstanceChange{ID: "c" + string(rune('1'+index)), MachineID: "m1", Port: 3306 + index%2, ToVersion: index + 1, CreatedAt: now.Add(time.Duration(index) * time.Second)}
+		if err := repo.AppendInstanceChange(ctx, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := repo.ListInstanceChanges(ctx, "m1", 3306, 10)
+	if err != nil || len(history) != 2 || history[0].ToVersion != 3 {
+		t.Fatalf("history = %+v, %v", history, err)
+	}
+
+	if err := repo.DeleteTemplate(ctx, "oltp"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := repo.ListVersions(ctx, "oltp"); len(versions) != 0 {
+		t.Fatalf("versions after delete = %+v", versions)
+	}
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	proxysqldomain "gmha/internal/domain/proxysql"
+)
+
+type ProxySQLRepository struct{ db *DB }
+
+func NewProxySQLRepository(db *DB) *ProxySQLRepository {
+	return &ProxySQLRepository{db: db}
+}
+
+func (r *ProxySQLRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists proxysql_configs (
+			cluster_id varchar(255) primary key,
+			enabled integer not null default 1,
+			config_json text not null,
+			created_at varchar(64) not null,
+			updated_at varchar(64) not null
+		);
+		create table if not exists proxysql_sync_events (
+			id varchar(160) primary key,
+			cluster_id varchar(255) not null,
+			reason varchar(32) not null,
+			status varchar(32) not null,
+			event_json text not null,
+			created_at varchar(64) not null
+		);
+		create index if not exists idx_proxysql_sync_events_cluster on proxysql_sync_events(cluster_id, created_at);
+	`)
+	return err
+}
+
+func (r *ProxySQLRepository) SaveConfig(ctx context.Context, config proxysqldomain.Config) error {
+	payload, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into proxysql_configs (cluster_id, enabled, config_json, created_at, updated_at)
+		values (?, ?, ?, ?, ?)
+		on conflict(cluster_id) do update set
+			enabled=excluded.enabled, config_json=excluded.config_json, updated_at=excluded.updated_at
+	`, config.ClusterID, boolInt(config.Enabled), string(payload), config.CreatedAt.UTC().Format(time.RFC3339Nano), config.UpdatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *ProxySQLRepository) GetConfig(ctx context.Context, clusterID string) (proxysqldomain.Config, bool, error) {
+	var payload string
+	err := r.db.QueryRowContext(ctx, `select config_json from proxysql_configs where cluster_id = ?`, strings.TrimSpace(clusterID)).Scan(&payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return proxysqldomain.Config{}, false, nil
+	}
+	if err != nil {
+		return proxysqldomain.Config{}, false, err
+	}
+	var config proxysqldomain.Config
+	if err := json.Unmarshal([]byte(payload), &config); err != nil {
+		return proxysqldomain.Config{}, false, err
+	}
+	return config, true, nil
+}
+
+func (r *ProxySQLRepository) ListConfigs(ctx context.Context) ([]proxysqldomain.Config, error) {
+	rows, err := r.db.QueryContext(ctx, `select config_json from proxysql_configs order by cluster_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]proxysqldomain.Config, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var config proxysqldomain.Config
+		if err := json.Unmarshal([]byte(payload), &config); err != nil {
+			return nil, err
+		}
+		out = append(out, config)
+	}
+	return out, rows.Err()
+}
+
+func (r *ProxySQLRepository) DeleteConfig(ctx context.Context, clusterID string) error {
+	_, err := r.db.ExecContext(ctx, `delete from proxysql_configs where cluster_id = ?`, strings.TrimSpace(clusterID))
+	return err
+}
+
+func (r *ProxySQLRepository) SaveSyncEvent(ctx context.Context, event proxysqldomain.SyncEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into proxysql_sync_events (id, cluster_id, reason, status, event_json, created_at)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict(id) do update set status=excluded.status, event_json=excluded.event_json
+	`, event.ID, event.ClusterID, event.Reason, event.Status, string(payload), event.CreatedAt.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+func (r *ProxySQLRepository) ListSyncEvents(ctx context.Context, clusterID string, limit int) ([]proxysqldomain.SyncEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	rows, err := r.db.QueryContext(ctx, `select event_json from proxysql_sync_events where cluster_id = ? order by created_at desc limit ?`, strings.TrimSpace(clusterID), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]proxysqldomain.SyncEvent, 0)
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var event proxysqldomain.SyncEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return nil, err
+		}
+		out = append(out, event)
+	}
+	return out, rows.Err()
+}
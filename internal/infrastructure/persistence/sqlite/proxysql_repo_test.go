@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	proxysqldomain "gmha/internal/domain/proxysql"
+	_ "modernc.org/sqlite"
+)
+
+func TestProxySQLRepositoryPersistsConfigAndSyncEvents(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewProxySQLRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 8, 1, 2, 0, 0, 0, time.UTC)
+	config := proxysqldomain.Config{
+		ClusterID: "orders", Enabled: true, ProxyMachineIDs: []string{"proxy-1"}, AdminPort: 6032, AdminUser: "gmha", AdminPassword: "secret",
+		WriterHostgroup: 10, ReaderHostgroup: 20, Users: []proxysqldomain.User{{Username: "app", Password: "app-secret", Active: true}},
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repo.SaveConfig(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	config.ReaderHostgroup = 30
+	if err := repo.SaveConfig(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.GetConfig(ctx, "orders")
+	if err != nil || !ok {
+		t.Fatalf("config not found: %v", err)
+	}
+	if got.ReaderHostgroup != 30 || got.AdminPassword != "secret" || len(got.Users) != 1 || got.Users[0].Password != "app-secret" {
+		t.Fatalf("unexpected config: %+v", got)
+	}
+	if redacted := got.Redacted(); redacted.AdminPassword != "" || redacted.Users[0].Password != "" || got.Users[0].Password == "" {
+		t.Fatalf("redaction must not leak or mutate passwords: %+v", redacted)
+	}
+	for index, status := range []string{proxysqldomain.SyncStatusSuccess, proxysqldomain.SyncStatusFailed} {
+		event := proxysqldomain.SyncEvent{
+			ID: "sync-" + status, ClusterID: "orders", Reason: proxysqldomain.SyncReasonArchitecture, Status: status,
+			Backends: []proxysqldomain.Backend{{Hostgroup: 10, Hostname: "10.0.0.2", Port: 3306}}, CreatedAt: now.Add(time.Duration(index) * time.Minute),
+		}
+		if err := repo.SaveSyncEvent(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := repo.ListSyncEvents(ctx, "orders", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Status != proxysqldomain.SyncStatusFailed || len(events[1].Backends) != 1 {
+		t.Fatalf("unexpected sync events: %+v", events)
+	}
+	if err := repo.DeleteConfig(ctx, "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := repo.GetConfig(ctx, "orders"); err != nil || ok {
+		t.Fatalf("config must be deleted: ok=%v err=%v", ok, err)
+	}
+}
@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	changedomain "gmha/internal/domain/schemachange"
+	taskdomain "gmha/internal/domain/task"
+)
+
+type SchemaChangeRepository struct{ db *DB }
+
+func NewSchemaChangeRepository(db *DB) *SchemaChangeRepository {
+	return &SchemaChangeRepository{db: db}
+}
+
+func (r *SchemaChangeRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists schema_change_requests (
+			id varchar(160) primary key, cluster_name varchar(255) not null default '',
+			machine_id varchar(160) not null, port integer not null,
+			schema_name varchar(64) not null, table_name varchar(64) not null,
+			status varchar(32) not null, submitted_by varchar(255) not null,
+			window_start varchar(64) not null default '',
+			created_at varchar(64) not null, updated_at varchar(64) not null,
+			request_json text not null, commands_json text not null
+		);
+		create index if not exists idx_schema_change_status on schema_change_requests(status, window_start);
+		create index if not exists idx_schema_change_cluster on schema_change_requests(cluster_name, created_at);
+	`)
+	return err
+}
+
+type schemaChangeCommands struct {
+	DryRun  []taskdomain.ExecCommandStep `json:"dry_run"`
+	Execute []taskdomain.ExecCommandStep `json:"execute"`
+}
+
+func (r *SchemaChangeRepository) Save(ctx context.Context, item changedomain.Request) error {
+	request, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	commands, err := json.Marshal(schemaChangeCommands{DryRun: item.DryRunCommands, Execute: item.ExecuteCommands})
+	if err != nil {
+		return err
+	}
+	windowStart := ""
+	if item.WindowStart != nil {
+		windowStart = formatSchemaChangeTime(*item.WindowStart)
+	}
+	_, err = r.db.ExecContext(ctx, `insert into schema_change_requests
+		(id,cluster_name,machine_id,port,schema_name,table_name,status,submitted_by,window_start,created_at,updated_at,request_json,commands_json)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(id) do update set cluster_name=excluded.cluster_name,machine_id=excluded.machine_id,port=excluded.port,
+		schema_name=excluded.schema_name,table_name=excluded.table_name,status=excluded.status,window_start=excluded.window_start,
+		updated_at=excluded.updated_at,request_json=excluded.request_json,commands_json=excluded.commands_json`,
+		item.ID, item.Cluster, item.MachineID, item.Port, item.Schema, item.Table, item.Status, item.SubmittedBy, windowStart,
+		formatSchemaChangeTime(item.CreatedAt), formatSchemaChangeTime(item.UpdatedAt), string(request), string(commands))
+	return err
+}
+
+func (r *SchemaChangeRepository) Get(ctx context.Context, id string) (changedomain.Request, bool, error) {
+	item, err := scanSchemaChange(r.db.QueryRowContext(ctx, `select request_json,commands_json from schema_change_requests where id=?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return changedomain.Request{}, false, nil
+	}
+	return item, err == nil, err
+}
+
+func (r *SchemaChangeRepository) List(ctx context.Context, cluster, status string, limit int) ([]changedomain.Request, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	return r.list(ctx, `select request_json,'' from schema_change_requests where (?='' or cluster_name=?) and (?='' or status=?)
+		order by created_at desc limit ?`, cluster, cluster, status, status, limit)
+}
+
+// ListByStatus returns requests in the given states with their commands,
+// oldest window first.
+func (r *SchemaChangeRepository) ListByStatus(ctx context.Context, statuses ...string) ([]changedomain.Request, error) {
+	if len(statuses) == 0 {
+		return []changedomain.Request{}, nil
+	}
+	args := make([]any, 0, len(statuses))
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	return r.list(ctx, `select request_json,commands_json from schema_change_requests where status in (?`+strings.Repeat(",?", len(statuses)-1)+`)
+		order by window_start, created_at`, args...)
+}
+
+func (r *SchemaChangeRepository) list(ctx context.Context, query string, args ...any) ([]changedomain.Request, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]changedomain.Request, 0)
+	for rows.Next() {
+		item, err := scanSchemaChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func scanSchemaChange(row interface{ Scan(...any) error }) (changedomain.Request, error) {
+	var item changedomain.Request
+	var request, commands string
+	if err := row.Scan(&request, &commands); err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal([]byte(request), &item); err != nil {
+		return item, err
+	}
+	if commands != "" {
+		var stored schemaChangeCommands
+		if err := json.Unmarshal([]byte(commands), &stored); err != nil {
+			return item, err
+		}
+		item.DryRunCommands, item.ExecuteCommands = stored.DryRun, stored.Execute
+	}
+	return item, nil
+}
+
+func formatSchemaChangeTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	changedomain "gmha/internal/domain/schemachange"
+	taskdomain "gmha/internal/domain/task"
+	_ "modernc.org/sqlite"
+)
+
+func TestSchemaChangeRepositoryKeepsCommandsOutOfLists(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewSchemaChangeRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 8, 3, 9, 0, 0, 0, time.UTC)
+	window := now.Add(12 * time.Hour)
+	item := changedomain.Request{
+		ID: "change-1", Cluster: "orders", MachineID: "m1", Port: 3306, Schema: "shop", Table: "orders",
+		Alter: "ADD COLUMN `note` varchar(64)", SubmittedBy: "dev", Status: changedomain.StatusScheduled,
+		WindowStart: &window, CreatedAt: now, UpdatedAt: now,
+		Findings:        []changedomain.Finding{{Rule: "no_snapshot", Level: changedomain.LevelWarning}},
+		History:         []changedomain.Event{{At: now, Actor: "dev", Action: "create", To: changedomain.StatusDraft}},
+		ExecuteCommands: []taskdomain.ExecCommandStep{{Name: "PT 在线复制与原子切换", Command: "pt-online-schema-change --execute"}},
+	}
+	if err := repo.Save(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := repo.Get(ctx, item.ID)
+	if err != nil || !ok || got.WindowStart == nil || !got.WindowStart.Equal(window) || len(got.ExecuteCommands) != 1 || len(got.History) != 1 {
+		t.Fatalf("Get() = %+v ok=%v err=%v", got, ok, err)
+	}
+	due, err := repo.ListByStatus(ctx, changedomain.StatusScheduled, changedomain.StatusRunning)
+	if err != nil || len(due) != 1 || len(due[0].ExecuteCommands) != 1 {
+		t.Fatalf("ListByStatus() = %+v err=%v", due, err)
+	}
+	list, err := repo.List(ctx, "orders", changedomain.StatusScheduled, 10)
+	if err != nil || len(list) != 1 || list[0].ExecuteCommands != nil {
+		t.Fatalf("List() = %+v err=%v", list, err)
+	}
+	if list, _ := repo.List(ctx, "", changedomain.StatusDone, 10); len(list) != 0 {
+		t.Fatalf("status filter not applied: %+v", list)
+	}
+}
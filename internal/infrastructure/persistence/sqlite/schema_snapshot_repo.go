@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	schemadomain "gmha/internal/domain/schemasnapshot"
+)
+
+type SchemaSnapshotRepository struct{ db *DB }
+
+func NewSchemaSnapshotRepository(db *DB) *SchemaSnapshotRepository {
+	return &SchemaSnapshotRepository{db: db}
+}
+
+func (r *SchemaSnapshotRepository) Migrate() error {
+	_, err := r.db.Exec(`
+		create table if not exists schema_snapshots (
+			id varchar(160) primary key, cluster_name varchar(255) not null default '',
+			machine_id varchar(160) not null, machine_name varchar(255) not null default '', machine_ip varchar(64) not null default '',
+			port integer not null, role varchar(32) not null default '', server_version varchar(128) not null default '',
+			checksum varchar(64) not null, schema_count integer not null default 0, table_count integer not null default 0,
+			object_count integer not null default 0, warnings_json text not null,
+			taken_at varchar(64) not null, checked_at varchar(64) not null, definition_json text not null
+		);
+		create index if not exists idx_schema_snapshots_instance on schema_snapshots(machine_id, port, checked_at);
+		create index if not exists idx_schema_snapshots_cluster on schema_snapshots(cluster_name, checked_at);
+	`)
+	return err
+}
+
+func (r *SchemaSnapshotRepository) SaveSnapshot(ctx context.Context, s schemadomain.Snapshot) error {
+	warnings, err := json.Marshal(s.Warnings)
+	if err != nil {
+		return err
+	}
+	definition, err := json.Marshal(s.Definition)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `insert into schema_snapshots
+		(id,cluster_name,machine_id,machine_name,machine_ip,port,role,server_version,checksum,schema_count,table_count,object_count,
+		warnings_json,taken_at,checked_at,definition_json)
+		values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on conflict(id) do update set role=excluded.role,checked_at=excluded.checked_at,warnings_json=excluded.warnings_json`,
+		s.ID, s.Cluster, s.MachineID, s.MachineName, s.MachineIP, s.Port, s.Role, s.ServerVersion, s.Checksum,
+		s.SchemaCount, s.TableCount, s.ObjectCount, string(warnings),
+		formatSchemaSnapshotTime(s.TakenAt), formatSchemaSnapshotTime(s.CheckedAt), string(definition))
+	return err
+}
+
+// TouchSnapshot records a capture that found the same schema version again.
+func (r *SchemaSnapshotRepository) TouchSnapshot(ctx context.Context, id, role string, checkedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `update schema_snapshots set role=?,checked_at=? where id=?`, role, formatSchemaSnapshotTime(checkedAt), id)
+	return err
+}
+
+func (r *SchemaSnapshotRepository) GetSnapshot(ctx context.Context, id string) (schemadomain.Snapshot, bool, error) {
+	return r.getSnapshot(ctx, schemaSnapshotSelect+` where id=?`, id)
+}
+
+func (r *SchemaSnapshotRepository) LatestSnapshot(ctx context.Context, machineID string, port int) (schemadomain.Snapshot, bool, error) {
+	return r.getSnapshot(ctx, schemaSnapshotSelect+` where machine_id=? and port=? order by checked_at desc, taken_at desc limit 1`, machineID, port)
+}
+
+func (r *SchemaSnapshotRepository) getSnapshot(ctx context.Context, query string, args ...any) (schemadomain.Snapshot, bool, error) {
+	s, err := scanSchemaSnapshot(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return schemadomain.Snapshot{}, false, nil
+	}
+	return s, err == nil, err
+}
+
+// ListSnapshots returns snapshot versions newest first without their
+// definitions.
+func (r *SchemaSnapshotRepository) ListSnapshots(ctx context.Context, cluster, machineID string, port, limit int) ([]schemadomain.Snapshot, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := r.db.QueryContext(ctx, schemaSnapshotListSelect+` where (?='' or cluster_name=?) and (?='' or machine_id=?) and (?=0 or port=?)
+		order by taken_at desc limit ?`, cluster, cluster, machineID, machineID, port, port, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]schemadomain.Snapshot, 0)
+	for rows.Next() {
+		s, err := scanSchemaSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// PurgeSnapshots removes versions that were last seen before the cutoff; the
+// current version of every instance keeps being touched and survives.
+func (r *SchemaSnapshotRepository) PurgeSnapshots(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `delete from schema_snapshots where checked_at<?`, formatSchemaSnapshotTime(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const schemaSnapshotColumns = `id,cluster_name,machine_id,machine_name,machine_ip,port,role,server_version,checksum,schema_count,table_count,object_count,warnings_json,taken_at,checked_at`
+const schemaSnapshotSelect = `select ` + schemaSnapshotColumns + `,definition_json from schema_snapshots`
+const schemaSnapshotListSelect = `select ` + schemaSnapshotColumns + `,'' as definition_json from schema_snapshots`
+
+func scanSchemaSnapshot(row interface{ Scan(...any) error }) (schemadomain.Snapshot, error) {
+	var s schemadomain.Snapshot
+	var warnings, taken, checked, definition string
+	err := row.Scan(&s.ID, &s.Cluster, &s.MachineID, &s.MachineName, &s.MachineIP, &s.Port, &s.Role, &s.ServerVersion, &s.Checksum,
+		&s.SchemaCount, &s.TableCount, &s.ObjectCount, &warnings, &taken, &checked, &definition)
+	_ = json.Unmarshal([]byte(warnings), &s.Warnings)
+	if definition != "" {
+		_ = json.Unmarshal([]byte(definition), &s.Definition)
+	}
+	s.TakenAt = parseSchemaSnapshotTime(taken)
+	s.CheckedAt = parseSchemaSnapshotTime(checked)
+	return s, err
+}
+
+func formatSchemaSnapshotTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func parseSchemaSnapshotTime(value string) time.Time {
+	result, _ := time.Parse(time.RFC3339Nano, value)
+	return result
+}
@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	schemadomain "gmha/internal/domain/schemasnapshot"
+	_ "modernc.org/sqlite"
+)
+
+func TestSchemaSnapshotRepositoryVersionsAndPurge(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	repo := NewSchemaSnapshotRepository(NewDB(db, DialectSQLite))
+	if err := repo.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Date(2026, 8, 1, 10, 0, 0, 0, time.UTC)
+	definition := schemadomain.Definition{Schemas: []schemadomain.Schema{{Name: "shop", Tables: []schemadomain.Table{{Name: "orders", Columns: []schemadomain.Part{{Name: "id", SQL: "`id` bigint NOT NULL"}}}}}}}
+	old := schemadomain.Snapshot{
+		ID: "schema-1", Cluster: "orders", MachineID: "m1", Port: 3306, Role: "primary", Checksum: "a",
+		SchemaCount: 1, TableCount: 1, ObjectCount: 1, TakenAt: now.Add(-200 * 24 * time.Hour), CheckedAt: now.Add(-200 * 24 * time.Hour),
+		Definition: definition,
+	}
+	current := old
+	current.ID, current.Checksum, current.Warnings = "schema-2", "b", []string{"跳过 procedure shop.p"}
+	current.TakenAt, current.CheckedAt = now.Add(-time.Hour), now.Add(-time.Hour)
+	for _, s := range []schemadomain.Snapshot{old, current} {
+		if err := repo.SaveSnapshot(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.TouchSnapshot(ctx, current.ID, "replica", now); err != nil {
+		t.Fatal(err)
+	}
+	latest, ok, err := repo.LatestSnapshot(ctx, "m1", 3306)
+	if err != nil || !ok || latest.ID != current.ID || latest.Role != "replica" || !latest.CheckedAt.Equal(now) ||
+		len(latest.Warnings) != 1 || latest.Definition.Schemas[0].Tables[0].Columns[0].Name != "id" {
+		t.Fatalf("LatestSnapshot() = %+v ok=%v err=%v", latest, ok, err)
+	}
+	list, err := repo.ListSnapshots(ctx, "orders", "", 0, 10)
+	if err != nil || len(list) != 2 || list[0].ID != current.ID || len(list[0].Definition.Schemas) != 0 {
+		t.Fatalf("ListSnapshots() = %+v err=%v", list, err)
+	}
+	if n, err := repo.PurgeSnapshots(ctx, now.Add(-180*24*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("PurgeSnapshots() n=%d err=%v", n, err)
+	}
+	if _, ok, _ := repo.GetSnapshot(ctx, old.ID); ok {
+		t.Fatal("old snapshot version must be purged")
+	}
+}
@@ -3,6 +3,7 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
@@ -194,6 +195,91 @@ func (r *SQLDiagnosticRepository) Migrate() error {
 			completed_at text
 		);
 		create index if not exists idx_sql_diag_kill_audit_time on sql_diagnostic_kill_audit(requested_at);
+		create table if not exists sql_diagnostic_lock_waits (
+			id text primary key,
+			machine_id text not null,
+			machine_name text not null default '',
+			machine_ip text not null default '',
+			cluster_name text not null default '',
+			port integer not null,
+			version text not null default '',
+			collected_at text not null,
+			lock_kind text not null,
+			waiting_process_id bigint not null default 0,
+			waiting_thread_id bigint not null default 0,
+			waiting_trx_id text not null default '',
+			waiting_user text not null default '',
+			waiting_host text not null default '',
+			waiting_sql text not null default '',
+			wait_ms bigint not null default 0,
+			blocking_process_id bigint not null default 0,
+			blocking_thread_id bigint not null default 0,
+			blocking_trx_id text not null default '',
+			blocking_user text not null default '',
+			blocking_host text not null default '',
+			blocking_command text not null default '',
+			blocking_sql text not null default '',
+			blocking_trx_started_at text,
+			object_type text not null default '',
+			object_schema text not null default '',
+			object_name text not null default '',
+			index_name text not null default '',
+			lock_mode text not null default '',
+			blocking_lock_mode text not null default ''
+		);
+		create index if not exists idx_sql_diag_lock_waits_window on sql_diagnostic_lock_waits(collected_at);
+		create table if not exists sql_diagnostic_deadlocks (
+			id text primary key,
+			machine_id text not null,
+			machine_name text not null default '',
+			machine_ip text not null default '',
+			cluster_name text not null default '',
+			port integer not null,
+			version text not null default '',
+			detected_at text not null,
+			transactions_json text not null,
+			raw_text text not null default '',
+			collected_at text not null
+		);
+		create index if not exists idx_sql_diag_deadlocks_window on sql_diagnostic_deadlocks(detected_at);
+		create table if not exists sql_diagnostic_plan_snapshots (
+			id text primary key,
+			machine_id text not null,
+			machine_name text not null default '',
+			machine_ip text not null default '',
+			cluster_name text not null default '',
+			port integer not null,
+			version text not null default '',
+			digest varchar(191) not null,
+			database_name varchar(191) not null default '',
+			sql_text text not null default '',
+			steps_json text not null,
+			signature varchar(64) not null default '',
+			captured_at text not null
+		);
+		create index if not exists idx_sql_diag_plan_digest on sql_diagnostic_plan_snapshots(machine_id, port, digest, captured_at);
+		create table if not exists sql_diagnostic_slow_log_cursors (
+			id varchar(191) primary key,
+			machine_id text not null,
+			port integer not null,
+			file_id varchar(191) not null,
+			path text not null default '',
+			file_offset bigint not null default 0,
+			updated_at text not null
+		);
+		create table if not exists sql_diagnostic_kill_policies (
+			id text primary key,
+			name text not null,
+			enabled integer not null default 1,
+			dry_run integer not null default 1,
+			target varchar(32) not null default 'query',
+			instance_role varchar(32) not null default 'any',
+			conditions_json text not null default '{}',
+			min_elapsed_seconds bigint not null default 0,
+			max_kills_per_minute integer not null default 10,
+			created_at text not null,
+			updated_at text not null
+		);
 	`)
 	if err != nil {
 		return err
@@ -209,6 +295,8 @@ func (r *SQLDiagnosticRepository) Migrate() error {
 		`alter table sql_diagnostic_instance_status add column slow_log_threshold_ms integer not null default 0`,
 		`alter table sql_diagnostic_collection_runs add column slow_log_table_available integer not null default 0`,
 		`alter table sql_diagnostic_collection_runs add column slow_log_threshold_ms integer not null default 0`,
+		`alter table sql_diagnostic_kill_audit add column kill_scope varchar(32) not null default 'query'`,
+		`alter table sql_diagnostic_kill_audit add column policy_id varchar(64) not null default ''`,
 	} {
 		if _, alterErr := r.db.Exec(statement); alterErr != nil &&
 			!strings.Contains(strings.ToLower(alterErr.Error()), "duplicate column") &&
@@ -553,6 +641,10 @@ func (r *SQLDiagnosticRepository) ListStatementEvents(ctx context.Context, query
 		statement.WriteString(" and database_name = ?")
 		args = append(args, query.Database)
 	}
+	if query.Digest != "" {
+		statement.WriteString(" and digest = ?")
+		args = append(args, query.Digest)
+	}
 	if query.Keyword != "" {
 		statement.WriteString(" and (lower(sql_text) like lower(?) or lower(digest_text) like lower(?) or lower(digest) like lower(?))")
 		like := "%" + query.Keyword + "%"
@@ -608,15 +700,15 @@ func (r *SQLDiagnosticRepository) SaveKillAudit(ctx context.Context, item sqldom
 		insert into sql_diagnostic_kill_audit (
 			id, machine_id, machine_name, machine_ip, cluster_name, port, version,
 			process_id, expected_digest, expected_started_at, sql_text, db_user,
-			client_host, reason, request_source, status, error, requested_at, completed_at
-		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			client_host, reason, request_source, kill_scope, policy_id, status, error, requested_at, completed_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		on conflict(id) do update set
 			sql_text=excluded.sql_text, db_user=excluded.db_user,
 			client_host=excluded.client_host, status=excluded.status,
 			error=excluded.error, completed_at=excluded.completed_at
 	`, item.ID, i.MachineID, i.MachineName, i.MachineIP, i.Cluster, i.Port, i.Version,
 		item.ProcessID, item.ExpectedDigest, formatTime(item.ExpectedStartedAt), item.SQLText,
-		item.User, item.ClientHost, item.Reason, item.RequestSource, item.Status, item.Error,
+		item.User, item.ClientHost, item.Reason, item.RequestSource, killScope(item.Scope), item.PolicyID, item.Status, item.Error,
 		formatTime(item.RequestedAt), nullableTime(item.CompletedAt))
 	return err
 }
@@ -625,7 +717,7 @@ func (r *SQLDiagnosticRepository) ListKillAudits(ctx context.Context, start, end
 	rows, err := r.db.QueryContext(ctx, `
 		select id, machine_id, machine_name, machine_ip, cluster_name, port, version,
 			process_id, expected_digest, expected_started_at, sql_text, db_user,
-			client_host, reason, request_source, status, error, requested_at, completed_at
+			client_host, reason, request_source, kill_scope, policy_id, status, error, requested_at, completed_at
 		from sql_diagnostic_kill_audit
 		where requested_at >= ? and requested_at <= ? order by requested_at desc
 	`, formatTime(start), formatTime(end))
@@ -642,7 +734,7 @@ func (r *SQLDiagnosticRepository) ListKillAudits(ctx context.Context, start, end
 			&item.Instance.MachineIP, &item.Instance.Cluster, &item.Instance.Port,
 			&item.Instance.Version, &item.ProcessID, &item.ExpectedDigest, &expected,
 			&item.SQLText, &item.User, &item.ClientHost, &item.Reason, &item.RequestSource,
-			&item.Status, &item.Error, &requested, &completed); err != nil {
+			&item.Scope, &item.PolicyID, &item.Status, &item.Error, &requested, &completed); err != nil {
 			return nil, err
 		}
 		item.ExpectedStartedAt, item.RequestedAt = parseTime(expected), parseTime(requested)
@@ -655,6 +747,283 @@ func (r *SQLDiagnosticRepository) ListKillAudits(ctx context.Context, start, end
 	return out, rows.Err()
 }
 
+func (r *SQLDiagnosticRepository) SaveLockWaits(ctx context.Context, items []sqldomain.LockWait) error {
+	if len(items) == 0 {
+		return nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, item := range items {
+		i := item.Instance
+		if _, err := tx.ExecContext(ctx, `
+			insert into sql_diagnostic_lock_waits (
+				id, machine_id, machine_name, machine_ip, cluster_name, port, version, collected_at,
+				lock_kind, waiting_process_id, waiting_thread_id, waiting_trx_id, waiting_user,
+				waiting_host, waiting_sql, wait_ms, blocking_process_id, blocking_thread_id,
+				blocking_trx_id, blocking_user, blocking_host, blocking_command, blocking_sql,
+				blocking_trx_started_at, object_type, object_schema, object_name, index_name,
+				lock_mode, blocking_lock_mode
+			) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			on conflict(id) do nothing
+		`, item.ID, i.MachineID, i.MachineName, i.MachineIP, i.Cluster, i.Port, i.Version, formatTime(item.CollectedAt),
+			item.Kind, item.WaitingProcessID, item.WaitingThreadID, item.WaitingTrxID, item.WaitingUser,
+			item.WaitingHost, item.WaitingSQL, item.WaitMS, item.BlockingProcessID, item.BlockingThreadID,
+			item.BlockingTrxID, item.BlockingUser, item.BlockingHost, item.BlockingCommand, item.BlockingSQL,
+			optionalTime(item.BlockingTrxStartedAt), item.ObjectType, item.ObjectSchema, item.ObjectName, item.IndexName,
+			item.LockMode, item.BlockingLockMode); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLDiagnosticRepository) ListLockWaits(ctx context.Context, start, end time.Time) ([]sqldomain.LockWait, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		select id, machine_id, machine_name, machine_ip, cluster_name, port, version, collected_at,
+			lock_kind, waiting_process_id, waiting_thread_id, waiting_trx_id, waiting_user,
+			waiting_host, waiting_sql, wait_ms, blocking_process_id, blocking_thread_id,
+			blocking_trx_id, blocking_user, blocking_host, blocking_command, blocking_sql,
+			blocking_trx_started_at, object_type, object_schema, object_name, index_name,
+			lock_mode, blocking_lock_mode
+		from sql_diagnostic_lock_waits
+		where collected_at >= ? and collected_at <= ? order by collected_at, id
+	`, formatTime(start), formatTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []sqldomain.LockWait
+	for rows.Next() {
+		var item sqldomain.LockWait
+		var collected string
+		var started sql.NullString
+		if err := rows.Scan(&item.ID, &item.Instance.MachineID, &item.Instance.MachineName,
+			&item.Instance.MachineIP, &item.Instance.Cluster, &item.Instance.Port, &item.Instance.Version,
+			&collected, &item.Kind, &item.WaitingProcessID, &item.WaitingThreadID, &item.WaitingTrxID,
+			&item.WaitingUser, &item.WaitingHost, &item.WaitingSQL, &item.WaitMS, &item.BlockingProcessID,
+			&item.BlockingThreadID, &item.BlockingTrxID, &item.BlockingUser, &item.BlockingHost,
+			&item.BlockingCommand, &item.BlockingSQL, &started, &item.ObjectType, &item.ObjectSchema,
+			&item.ObjectName, &item.IndexName, &item.LockMode, &item.BlockingLockMode); err != nil {
+			return nil, err
+		}
+		item.CollectedAt = parseTime(collected)
+		item.BlockingTrxStartedAt = parseDiagnosticNullableTime(started)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// SaveDeadlockReport keeps the first capture of a deadlock; later cycles see
+// the same LATEST DETECTED DEADLOCK section until InnoDB replaces it.
+func (r *SQLDiagnosticRepository) SaveDeadlockReport(ctx context.Context, item sqldomain.DeadlockReport) (bool, error) {
+	payload, err := json.Marshal(item.Transactions)
+	if err != nil {
+		return false, err
+	}
+	i := item.Instance
+	result, err := r.db.ExecContext(ctx, `
+		insert into sql_diagnostic_deadlocks (
+			id, machine_id, machine_name, machine_ip, cluster_name, port, version,
+			detected_at, transactions_json, raw_text, collected_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do nothing
+	`, item.ID, i.MachineID, i.MachineName, i.MachineIP, i.Cluster, i.Port, i.Version,
+		formatTime(item.DetectedAt), string(payload), item.Raw, formatTime(item.CollectedAt))
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+func (r *SQLDiagnosticRepository) ListDeadlockReports(ctx context.Context, start, end time.Time) ([]sqldomain.DeadlockReport, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		select id, machine_id, machine_name, machine_ip, cluster_name, port, version,
+			detected_at, transactions_json, raw_text, collected_at
+		from sql_diagnostic_deadlocks
+		where detected_at >= ? and detected_at <= ? order by detected_at desc
+	`, formatTime(start), formatTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []sqldomain.DeadlockReport
+	for rows.Next() {
+		var item sqldomain.DeadlockReport
+		var detected, payload, collected string
+		if err := rows.Scan(&item.ID, &item.Instance.MachineID, &item.Instance.MachineName,
+			&item.Instance.MachineIP, &item.Instance.Cluster, &item.Instance.Port, &item.Instance.Version,
+			&detected, &payload, &item.Raw, &collected); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payload), &item.Transactions); err != nil {
+			return nil, err
+		}
+		item.DetectedAt, item.CollectedAt = parseTime(detected), parseTime(collected)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLDiagnosticRepository) SavePlanSnapshot(ctx context.Context, item sqldomain.PlanSnapshot) error {
+	steps, err := json.Marshal(item.Steps)
+	if err != nil {
+		return err
+	}
+	i := item.Instance
+	_, err = r.db.ExecContext(ctx, `
+		insert into sql_diagnostic_plan_snapshots (
+			id, machine_id, machine_name, machine_ip, cluster_name, port, version,
+			digest, database_name, sql_text, steps_json, signature, captured_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do nothing
+	`, item.ID, i.MachineID, i.MachineName, i.MachineIP, i.Cluster, i.Port, i.Version,
+		item.Digest, item.Database, item.SQLText, string(steps), item.Signature, formatTime(item.CapturedAt))
+	return err
+}
+
+// LatestPlanSnapshot returns the newest plan of a digest on an instance
+// captured before the given time.
+func (r *SQLDiagnosticRepository) LatestPlanSnapshot(ctx context.Context, instance sqldomain.Instance, digest, database string, before time.Time) (sqldomain.PlanSnapshot, bool, error) {
+	var item sqldomain.PlanSnapshot
+	var steps, captured string
+	err := r.db.QueryRowContext(ctx, `
+		select id, machine_id, machine_name, machine_ip, cluster_name, port, version,
+			digest, database_name, sql_text, steps_json, signature, captured_at
+		from sql_diagnostic_plan_snapshots
+		where machine_id = ? and port = ? and digest = ? and database_name = ? and captured_at < ?
+		order by captured_at desc limit 1
+	`, instance.MachineID, instance.Port, digest, database, formatTime(before)).Scan(
+		&item.ID, &item.Instance.MachineID, &item.Instance.MachineName, &item.Instance.MachineIP,
+		&item.Instance.Cluster, &item.Instance.Port, &item.Instance.Version, &item.Digest,
+		&item.Database, &item.SQLText, &steps, &item.Signature, &captured)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqldomain.PlanSnapshot{}, false, nil
+	}
+	if err != nil {
+		return sqldomain.PlanSnapshot{}, false, err
+	}
+	if err := json.Unmarshal([]byte(steps), &item.Steps); err != nil {
+		return sqldomain.PlanSnapshot{}, false, err
+	}
+	item.CapturedAt = parseTime(captured)
+	return item, true, nil
+}
+
+func (r *SQLDiagnosticRepository) GetSlowLogCursor(ctx context.Context, machineID string, port int) (sqldomain.SlowLogCursor, bool, error) {
+	var item sqldomain.SlowLogCursor
+	var updated string
+	err := r.db.QueryRowContext(ctx, `
+		select machine_id, port, file_id, path, file_offset, updated_at
+		from sql_diagnostic_slow_log_cursors where id = ?
+	`, slowLogCursorID(machineID, port)).Scan(&item.MachineID, &item.Port, &item.FileID, &item.Path, &item.Offset, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sqldomain.SlowLogCursor{}, false, nil
+	}
+	if err != nil {
+		return sqldomain.SlowLogCursor{}, false, err
+	}
+	item.UpdatedAt = parseTime(updated)
+	return item, true, nil
+}
+
+func (r *SQLDiagnosticRepository) SaveSlowLogCursor(ctx context.Context, item sqldomain.SlowLogCursor) error {
+	_, err := r.db.ExecContext(ctx, `
+		insert into sql_diagnostic_slow_log_cursors (id, machine_id, port, file_id, path, file_offset, updated_at)
+		values (?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do update set
+			file_id=excluded.file_id,
+			path=excluded.path,
+			file_offset=excluded.file_offset,
+			updated_at=excluded.updated_at
+	`, slowLogCursorID(item.MachineID, item.Port), item.MachineID, item.Port, item.FileID, item.Path, item.Offset, formatTime(item.UpdatedAt))
+	return err
+}
+
+func slowLogCursorID(machineID string, port int) string {
+	return fmt.Sprintf("%s:%d", machineID, port)
+}
+
+// killPolicyConditions holds the list-valued match conditions of a policy.
+type killPolicyConditions struct {
+	Clusters  []string `json:"clusters,omitempty"`
+	Users     []string `json:"users,omitempty"`
+	Hosts     []string `json:"hosts,omitempty"`
+	Databases []string `json:"databases,omitempty"`
+	Digests   []string `json:"digests,omitempty"`
+	Commands  []string `json:"commands,omitempty"`
+	States    []string `json:"states,omitempty"`
+}
+
+func (r *SQLDiagnosticRepository) ListKillPolicies(ctx context.Context) ([]sqldomain.KillPolicy, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		select id, name, enabled, dry_run, target, instance_role, conditions_json,
+			min_elapsed_seconds, max_kills_per_minute, created_at, updated_at
+		from sql_diagnostic_kill_policies order by name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []sqldomain.KillPolicy
+	for rows.Next() {
+		var item sqldomain.KillPolicy
+		var conditionsJSON, created, updated string
+		if err := rows.Scan(&item.ID, &item.Name, &item.Enabled, &item.DryRun, &item.Target,
+			&item.InstanceRole, &conditionsJSON, &item.MinElapsedSeconds, &item.MaxKillsPerMinute,
+			&created, &updated); err != nil {
+			return nil, err
+		}
+		var conditions killPolicyConditions
+		if err := json.Unmarshal([]byte(conditionsJSON), &conditions); err != nil {
+			return nil, err
+		}
+		item.Clusters, item.Users, item.Hosts = conditions.Clusters, conditions.Users, conditions.Hosts
+		item.Databases, item.Digests = conditions.Databases, conditions.Digests
+		item.Commands, item.States = conditions.Commands, conditions.States
+		item.CreatedAt, item.UpdatedAt = parseTime(created), parseTime(updated)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (r *SQLDiagnosticRepository) SaveKillPolicy(ctx context.Context, item sqldomain.KillPolicy) error {
+	conditions, err := json.Marshal(killPolicyConditions{
+		Clusters: item.Clusters, Users: item.Users, Hosts: item.Hosts, Databases: item.Databases,
+		Digests: item.Digests, Commands: item.Commands, States: item.States,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `
+		insert into sql_diagnostic_kill_policies (
+			id, name, enabled, dry_run, target, instance_role, conditions_json,
+			min_elapsed_seconds, max_kills_per_minute, created_at, updated_at
+		) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict(id) do update set
+			name=excluded.name, enabled=excluded.enabled, dry_run=excluded.dry_run,
+			target=excluded.target, instance_role=excluded.instance_role,
+			conditions_json=excluded.conditions_json,
+			min_elapsed_seconds=excluded.min_elapsed_seconds,
+			max_kills_per_minute=excluded.max_kills_per_minute,
+			updated_at=excluded.updated_at
+	`, item.ID, item.Name, item.Enabled, item.DryRun, item.Target, item.InstanceRole, string(conditions),
+		item.MinElapsedSeconds, item.MaxKillsPerMinute, formatTime(item.CreatedAt), formatTime(item.UpdatedAt))
+	return err
+}
+
+func (r *SQLDiagnosticRepository) DeleteKillPolicy(ctx context.Context, id string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `delete from sql_diagnostic_kill_policies where id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
 func (r *SQLDiagnosticRepository) PurgeBefore(ctx context.Context, cutoff time.Time) (int64, error) {
 	var total int64
 	for _, query := range []string{
@@ -664,6 +1033,9 @@ func (r *SQLDiagnosticRepository) PurgeBefore(ctx context.Context, cutoff time.T
 		// query window can still calculate an interval delta.
 		`delete from sql_diagnostic_digest_snapshots where collected_at < ?`,
 		`delete from sql_diagnostic_kill_audit where requested_at < ?`,
+		`delete from sql_diagnostic_lock_waits where collected_at < ?`,
+		`delete from sql_diagnostic_deadlocks where detected_at < ?`,
+		`delete from sql_diagnostic_plan_snapshots where captured_at < ?`,
 		`delete from sql_diagnostic_collection_runs where last_attempt_at < ?`,
 	} {
 		value := cutoff
@@ -735,6 +1107,13 @@ func scanDigestSnapshot(scanner interface{ Scan(...any) error }) (sqldomain.Dige
 	return item, nil
 }
 
+func killScope(value string) string {
+	if value == "" {
+		return sqldomain.KillScopeQuery
+	}
+	return value
+}
+
 func formatTime(value time.Time) string {
 	// Fixed-width fractional seconds keep lexical ordering identical to
 	// chronological ordering in every supported metadata database.
@@ -128,3 +128,169 @@ func TestSQLDiagnosticRepositoryEventsStatusAndPurge(t *testing.T) {
 		t.Fatalf("expected event to be purged, got %+v", events)
 	}
 }
+
+func TestSQLDiagnosticRepositoryLocksDeadlocksAndKillScope(t *testing.T) {
+	repo, _ := newSQLDiagnosticTestRepository(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	instance := sqldomain.Instance{MachineID: "machine-1", MachineName: "db-1", MachineIP: "10.0.0.1", Cluster: "orders", Port: 3306}
+	wait := sqldomain.LockWait{
+		ID: "wait-1", Instance: instance, CollectedAt: now, Kind: sqldomain.LockKindRow,
+		WaitingProcessID: 12, WaitingSQL: "update orders set status='void' where id=1", WaitMS: 3500,
+		BlockingProcessID: 11, BlockingTrxID: "12345", BlockingCommand: "Sleep", BlockingTrxStartedAt: now.Add(-time.Minute),
+		ObjectSchema: "shop", ObjectName: "orders", IndexName: "PRIMARY", LockMode: "X,REC_NOT_GAP", BlockingLockMode: "X,REC_NOT_GAP",
+	}
+	if err := repo.SaveLockWaits(ctx, []sqldomain.LockWait{wait, wait}); err != nil {
+		t.Fatal(err)
+	}
+	waits, err := repo.ListLockWaits(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 1 || waits[0].BlockingProcessID != 11 || waits[0].WaitMS != 3500 || !waits[0].BlockingTrxStartedAt.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("unexpected lock waits: %+v", waits)
+	}
+
+	report := sqldomain.DeadlockReport{
+		ID: "deadlock-1", Instance: instance, DetectedAt: now.Add(-time.Second), CollectedAt: now,
+		Transactions: []sqldomain.DeadlockTransaction{
+			{Index: 1, TrxID: "12345", ProcessID: 11, Statement: "update orders set status='paid' where id=2"},
+			{Index: 2, TrxID: "12346", ProcessID: 12, Statement: "update orders set status='void' where id=1", RolledBack: true},
+		},
+	}
+	inserted, err := repo.SaveDeadlockReport(ctx, report)
+	if err != nil || !inserted {
+		t.Fatalf("expected deadlock insert, got %v %v", inserted, err)
+	}
+	if inserted, err = repo.SaveDeadlockReport(ctx, report); err != nil || inserted {
+		t.Fatalf("the same deadlock must be stored once, got %v %v", inserted, err)
+	}
+	reports, err := repo.ListDeadlockReports(ctx, now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || len(reports[0].Transactions) != 2 || !reports[0].Transactions[1].RolledBack {
+		t.Fatalf("unexpected deadlock reports: %+v", reports)
+	}
+
+	audit := sqldomain.KillAudit{ID: "kill-1", Instance: instance, ProcessID: 11, ExpectedStartedAt: now, Status: "success", RequestedAt: now, Scope: sqldomain.KillScopeConnection}
+	legacy := audit
+	legacy.ID, legacy.Scope = "kill-2", ""
+	for _, item := range []sqldomain.KillAudit{audit, legacy} {
+		if err := repo.SaveKillAudit(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audits, err := repo.ListKillAudits(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes := map[string]string{}
+	for _, item := range audits {
+		scopes[item.ID] = item.Scope
+	}
+	if scopes["kill-1"] != sqldomain.KillScopeConnection || scopes["kill-2"] != sqldomain.KillScopeQuery {
+		t.Fatalf("unexpected kill scopes: %v", scopes)
+	}
+
+	if _, err := repo.PurgeBefore(ctx, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	waits, _ = repo.ListLockWaits(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	reports, _ = repo.ListDeadlockReports(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if len(waits) != 0 || len(reports) != 0 {
+		t.Fatalf("expected lock data to be purged, got %d waits and %d deadlocks", len(waits), len(reports))
+	}
+}
+
+func TestSQLDiagnosticRepositoryKillPolicies(t *testing.T) {
+	repo, _ := newSQLDiagnosticTestRepository(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	policy := sqldomain.KillPolicy{
+		ID: "policy-1", Name: "idle trx", Enabled: true, DryRun: true, Target: sqldomain.KillTargetIdleTransaction,
+		InstanceRole: sqldomain.InstanceRolePrimary, Users: []string{"app%"}, MinElapsedSeconds: 300,
+		MaxKillsPerMinute: 5, CreatedAt: now, UpdatedAt: now,
+	}
+	if err := repo.SaveKillPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	policy.DryRun, policy.UpdatedAt = false, now.Add(time.Minute)
+	if err := repo.SaveKillPolicy(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	items, err := repo.ListKillPolicies(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].DryRun || items[0].Users[0] != "app%" || items[0].MinElapsedSeconds != 300 || !items[0].CreatedAt.Equal(now) {
+		t.Fatalf("unexpected policies: %+v", items)
+	}
+	audit := sqldomain.KillAudit{ID: "kill-1", Instance: sqldomain.Instance{MachineID: "machine-1", Port: 3306}, ProcessID: 9,
+		ExpectedStartedAt: now, PolicyID: "policy-1", Scope: sqldomain.KillScopeConnection, Status: sqldomain.KillStatusDryRun, RequestedAt: now}
+	if err := repo.SaveKillAudit(ctx, audit); err != nil {
+		t.Fatal(err)
+	}
+	audits, err := repo.ListKillAudits(ctx, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil || len(audits) != 1 || audits[0].PolicyID != "policy-1" || audits[0].Status != sqldomain.KillStatusDryRun {
+		t.Fatalf("unexpected audits: %+v %v", audits, err)
+	}
+	if deleted, err := repo.DeleteKillPolicy(ctx, "policy-1"); err != nil || !deleted {
+		t.Fatalf("expected delete, got %v %v", deleted, err)
+	}
+	if deleted, _ := repo.DeleteKillPolicy(ctx, "policy-1"); deleted {
+		t.Fatal("deleting a missing policy must report false")
+	}
+}
+
+func TestSQLDiagnosticRepositoryPlanSnapshots(t *testing.T) {
+	repo, _ := newSQLDiagnosticTestRepository(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	instance := sqldomain.Instance{MachineID: "machine-1", Port: 3306, Cluster: "c1"}
+	for index, signature := range []string{"old", "new"} {
+		item := sqldomain.PlanSnapshot{
+			ID: "plan-" + signature, Instance: instance, Digest: "abc", Database: "app", SQLText: "select 1",
+			Steps:     []sqldomain.PlanStep{{ID: "1", Table: "orders", AccessType: "ref", Key: "idx_user", Rows: 12, Filtered: 100}},
+			Signature: signature, CapturedAt: now.Add(time.Duration(index) * time.Hour),
+		}
+		if err := repo.SavePlanSnapshot(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item, found, err := repo.LatestPlanSnapshot(ctx, instance, "abc", "app", now.Add(30*time.Minute))
+	if err != nil || !found || item.Signature != "old" || len(item.Steps) != 1 || item.Steps[0].Key != "idx_user" || item.Instance.Cluster != "c1" {
+		t.Fatalf("unexpected snapshot: %+v %v %v", item, found, err)
+	}
+	if _, found, _ := repo.LatestPlanSnapshot(ctx, instance, "abc", "other", now.Add(2*time.Hour)); found {
+		t.Fatal("snapshots are scoped by database")
+	}
+	if removed, err := repo.PurgeBefore(ctx, now.Add(30*time.Minute)); err != nil || removed == 0 {
+		t.Fatalf("expected plan snapshot purge, got %d %v", removed, err)
+	}
+	if _, found, _ := repo.LatestPlanSnapshot(ctx, instance, "abc", "app", now.Add(30*time.Minute)); found {
+		t.Fatal("purged snapshot is still returned")
+	}
+}
+
+func TestSQLDiagnosticRepositorySlowLogCursor(t *testing.T) {
+	repo, _ := newSQLDiagnosticTestRepository(t)
+	ctx := context.Background()
+	if _, found, err := repo.GetSlowLogCursor(ctx, "machine-1", 3306); err != nil || found {
+		t.Fatalf("expected no cursor, got %v %v", found, err)
+	}
+	now := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	for _, offset := range []int64{4096, 8192} {
+		cursor := sqldomain.SlowLogCursor{MachineID: "machine-1", Port: 3306, FileID: "2049:131", Path: "/data/mysql/slow.log", Offset: offset, UpdatedAt: now}
+		if err := repo.SaveSlowLogCursor(ctx, cursor); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cursor, found, err := repo.GetSlowLogCursor(ctx, "machine-1", 3306)
+	if err != nil || !found || cursor.Offset != 8192 || cursor.FileID != "2049:131" || !cursor.UpdatedAt.Equal(now) {
+		t.Fatalf("unexpected cursor: %+v %v %v", cursor, found, err)
+	}
+	if _, found, _ := repo.GetSlowLogCursor(ctx, "machine-1", 3307); found {
+		t.Fatal("cursors are scoped by instance")
+	}
+}
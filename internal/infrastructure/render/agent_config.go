@@ -23,6 +23,9 @@ manager_http_addr: {{ .ManagerHTTPAddr }}
 manager_grpc_addr: {{ .ManagerGRPCAddr }}
 heartbeat_interval: {{ .HeartbeatInterval }}
 token: {{ .Token }}
+{{- if .UpgradePublicKey }}
+upgrade_public_key: {{ .UpgradePublicKey }}
+{{- end }}
 `
 	return executeTemplate("agent-config", tpl, input)
 }
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gmha/internal/app"
+	taskdomain "gmha/internal/domain/task"
+)
+
+// ClusterSpecCommand 处理 plan、apply 两个声明式集群规格命令。
+type ClusterSpecCommand struct {
+	core *app.App
+}
+
+// NewClusterSpecCommand 创建一个新的 ClusterSpecCommand 实例。
+func NewClusterSpecCommand(core *app.App) *ClusterSpecCommand {
+	return &ClusterSpecCommand{core: core}
+}
+
+// Run 执行 plan 或 apply。规格中的 ${NAME} 在本地由环境变量展开，
+// apply 会等待后台任务结束后输出最终任务详情。
+func (c *ClusterSpecCommand) Run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage())
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	file := fs.String("f", "", "集群规格文件（YAML 或 JSON）")
+	fs.StringVar(file, "file", "", "集群规格文件（YAML 或 JSON）")
+	prune := fs.Bool("prune", false, "删除规格中未声明的备份策略、集群告警规则与 VIP")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*file) == "" {
+		return errors.New("请通过 -f 指定集群规格文件")
+	}
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	expanded, err := app.ExpandClusterSpecSecrets(string(content), os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	spec, err := app.ParseClusterSpec(expanded)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "plan":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		plan, err := c.core.ClusterSpecService.Plan(ctx, spec, *prune)
+		if err != nil {
+			return err
+		}
+		return printJSON(plan)
+	case "apply":
+		ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+		defer cancel()
+		result, err := c.core.ClusterSpecService.Apply(ctx, spec, *prune)
+		if err != nil {
+			if len(result.Plan.BlockingReasons) > 0 {
+				_ = printJSON(result.Plan)
+			}
+			return err
+		}
+		if result.Plan.InSync {
+			return printJSON(result)
+		}
+		detail, err := c.core.TaskService.WaitForTask(ctx, result.Task.Task.ID, 0)
+		if err != nil {
+			return err
+		}
+		result.Task = detail
+		if err := printJSON(result); err != nil {
+			return err
+		}
+		if detail.Task.Status != taskdomain.StatusSuccess {
+			return fmt.Errorf("应用集群规格失败，任务 %s 状态为 %s", detail.Task.ID, detail.Task.Status)
+		}
+		return nil
+	default:
+		return errors.New(usage())
+	}
+}
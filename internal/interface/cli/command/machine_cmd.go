@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"gmha/internal/app"
+	taskdomain "gmha/internal/domain/task"
 	machineusecase "gmha/internal/usecase/machine"
 )
 
@@ -22,7 +26,7 @@ func NewMachineCommand(core *app.App) *MachineCommand {
 	return &MachineCommand{core: core}
 }
 
-// Run 解析并执行机器管理子命令，支持 onboard、credential-create、credential-list、credential-delete、
+// Run 解析并执行机器管理子命令，支持 onboard、bulk-onboard、discover、credential-create、credential-list、credential-delete、
 // list、update、delete、assign-cluster、collect、collect-static、static-info、dynamic-info、mysql-dynamic-info 等操作。
 func (c *MachineCommand) Run(args []string) error {
 	if len(args) == 0 {
@@ -54,6 +58,84 @@ func (c *MachineCommand) Run(args []string) error {
 			return err
 		}
 		return printJSON(resp)
+	case "bulk-onboard":
+		fs := flag.NewFlagSet("machine bulk-onboard", flag.ContinueOnError)
+		file := fs.String("file", "", "纳管清单文件（CSV 或 YAML）")
+		format := fs.String("format", "", "清单格式 csv|yaml；默认按扩展名识别")
+		credential := fs.String("credential", "", "默认 SSH 凭证名称或 ID")
+		cidr := fs.String("cidr", "", "可选：同时扫描该网段并纳管发现的 SSH 主机")
+		concurrency := fs.Int("concurrency", 3, "并发数，最大 10")
+		precheckOnly := fs.Bool("precheck-only", false, "只输出合并预检查报告，不纳管")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		req := app.BulkOnboardRequest{CredentialName: *credential, Concurrency: *concurrency}
+		if strings.TrimSpace(*file) != "" {
+			content, err := os.ReadFile(*file)
+			if err != nil {
+				return err
+			}
+			if *format == "" {
+				*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+			}
+			req.Entries, err = app.ParseOnboardInventory(*format, string(content))
+			if err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(*cidr) != "" {
+			req.Discovery = &app.OnboardDiscoveryRequest{CIDR: *cidr}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+		defer cancel()
+		if *precheckOnly {
+			report, err := c.core.MachineService.PrecheckBulkOnboard(ctx, req)
+			if err != nil {
+				return err
+			}
+			return printJSON(report)
+		}
+		result, err := c.core.MachineService.BulkOnboard(ctx, req)
+		if err != nil {
+			return err
+		}
+		detail, err := c.core.TaskService.WaitForTask(ctx, result.TaskID, 0)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(detail); err != nil {
+			return err
+		}
+		if detail.Task.Status != taskdomain.StatusSuccess {
+			return fmt.Errorf("批量纳管未全部成功，任务 %s 状态为 %s", detail.Task.ID, detail.Task.Status)
+		}
+		return nil
+	case "discover":
+		fs := flag.NewFlagSet("machine discover", flag.ContinueOnError)
+		cidr := fs.String("cidr", "", "扫描网段，例如 10.0.1.0/24")
+		sshPort := fs.Int("ssh-port", 22, "SSH 端口")
+		mysqlPorts := fs.String("mysql-ports", "3306", "mysqld 端口，逗号分隔")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		req := app.OnboardDiscoveryRequest{CIDR: *cidr, SSHPort: *sshPort}
+		for _, value := range strings.Split(*mysqlPorts, ",") {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("mysqld 端口 %q 无效", value)
+			}
+			req.MySQLPorts = append(req.MySQLPorts, port)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		hosts, err := c.core.MachineService.DiscoverOnboardTargets(ctx, req)
+		if err != nil {
+			return err
+		}
+		return printJSON(hosts)
 	case "credential-create":
 		fs := flag.NewFlagSet("machine credential-create", flag.ContinueOnError)
 		name := fs.String("name", "", "凭证名称")
@@ -18,7 +18,7 @@ func NewRoot(core *app.App) *Root {
 	return &Root{core: core}
 }
 
-// Run 解析并执行顶层子命令，包括 machine、cluster、vip、failover、mysql、agent、task 等。
+// Run 解析并执行顶层子命令，包括 machine、cluster、vip、failover、mysql、agent、task、plan、apply 等。
 func (r *Root) Run(args []string) error {
 	if len(args) == 0 {
 		return errors.New(usage())
@@ -39,6 +39,8 @@ func (r *Root) Run(args []string) error {
 		return NewAgentCommand(r.core).Run(args[1:])
 	case "task":
 		return NewTaskCommand(r.core).Run(args[1:])
+	case "plan", "apply":
+		return NewClusterSpecCommand(r.core).Run(args)
 	default:
 		return fmt.Errorf("%s", usage())
 	}
@@ -183,6 +185,8 @@ func usage() string {
   gmha machine credential-delete --credential root-cred
   gmha machine onboard --name db-01 --ip 10.0.0.11 --ssh-port 22 --credential root-cred
   gmha machine onboard --name db-01 --ip 10.0.0.11 --ssh-port 22 --ssh-user root [--ssh-password secret]
+  gmha machine bulk-onboard --file inventory.csv --credential root-cred [--cidr 10.0.1.0/24] [--concurrency 5] [--precheck-only]
+  gmha machine discover --cidr 10.0.1.0/24 [--ssh-port 22] [--mysql-ports 3306,3307]
   gmha machine list
   gmha machine update --target 10.0.0.11 --name db-01 --ip 10.0.0.11 --ssh-port 22 --ssh-user root
   gmha machine delete --ip 10.0.0.11
@@ -209,6 +213,8 @@ func usage() string {
   gmha vip adopt --cluster prod-a --vip 10.0.0.100
   gmha vip validate --cluster prod-a
   gmha vip status --cluster prod-a
+  gmha plan -f cluster.yaml [--prune]
+  gmha apply -f cluster.yaml [--prune]
   gmha failover plan --cluster prod-a
   gmha failover start --cluster prod-a
   gmha failover status --cluster prod-a --failover-id fo-xxx
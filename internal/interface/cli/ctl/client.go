@@ -0,0 +1,139 @@
+// Package ctl 实现 gmhactl：通过 Manager HTTP API 运维集群的远程客户端。
+// 它只依赖公开的 API，不访问 Manager 数据库，因此可以在 CI 流水线或运维
+// 终端上使用，并经过 API 的全部校验。
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client 向 Manager 的 /api/v1 发送请求。Token 非空时以 Bearer 方式放在
+// Authorization 头中，供 Manager 前置的认证网关校验。
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+// APIError 是非 2xx 响应。Body 保留完整响应体，409 时通常带有计划或切换
+// 记录，调用方会先输出它再返回错误。
+type APIError struct {
+	Status  int
+	Message string
+	Body    any
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Manager 返回 HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("Manager 返回 HTTP %d: %s", e.Status, e.Message)
+}
+
+// Do 发送请求并把 JSON 响应解码为通用结构；数字保留为 json.Number，
+// 避免大整数和 ID 在输出时丢失精度。
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body any) (any, error) {
+	endpoint := strings.TrimRight(c.BaseURL, "/") + "/api/v1" + path
+	values := url.Values{}
+	for key, items := range query {
+		for _, item := range items {
+			if item != "" {
+				values.Add(key, item)
+			}
+		}
+	}
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	if len(bytes.TrimSpace(raw)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&decoded); err != nil {
+			decoded = nil
+			if resp.StatusCode < 300 {
+				return nil, fmt.Errorf("无法解析 %s %s 的响应: %w", method, path, err)
+			}
+		}
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{Status: resp.StatusCode, Body: decoded}
+		if message, ok := field(decoded, "error").(string); ok {
+			apiErr.Message = message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(raw))
+		}
+		return nil, apiErr
+	}
+	return decoded, nil
+}
+
+// field 按名称读取对象字段，名称不区分大小写：部分领域对象没有 json 标签，
+// 序列化后是 ID、Status 这样的大写字段。
+func field(value any, names ...string) any {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	for _, name := range names {
+		if item, ok := object[name]; ok {
+			return item
+		}
+		for key, item := range object {
+			if strings.EqualFold(key, name) {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func text(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
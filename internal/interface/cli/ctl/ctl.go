@@ -0,0 +1,663 @@
+package ctl
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultServer = "http://127.0.0.1:8080"
+
+var specSecretPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Ctl 保存一次命令调用的全局参数。--server、--token、-o 可以写在任意子命令
+// 的参数中，未指定时依次读取 GMHA_SERVER、GMHA_TOKEN 环境变量。
+type Ctl struct {
+	out      io.Writer
+	server   string
+	token    string
+	output   string
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// Run 执行 gmhactl 命令。
+func Run(ctx context.Context, args []string, out io.Writer) error {
+	c := &Ctl{out: out, server: os.Getenv("GMHA_SERVER"), token: os.Getenv("GMHA_TOKEN"), output: outputTable, timeout: time.Minute, interval: 2 * time.Second}
+	return c.run(ctx, args)
+}
+
+func (c *Ctl) run(ctx context.Context, args []string) error {
+	// 全局参数只能出现在资源名之前，之后的参数交给子命令解析。
+	fs := c.flags("gmhactl")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return errors.New(usage())
+		}
+		return fmt.Errorf("gmhactl: %w", err)
+	}
+	rest := fs.Args()
+	if len(rest) < 2 {
+		return errors.New(usage())
+	}
+	resource, verb, args := rest[0], rest[1], rest[2:]
+	switch resource {
+	case "cluster", "clusters":
+		return c.runCluster(ctx, verb, args)
+	case "machine", "machines":
+		return c.runMachine(ctx, verb, args)
+	case "mysql":
+		return c.runMySQL(ctx, verb, args)
+	case "backup", "backups":
+		return c.runBackup(ctx, verb, args)
+	case "alert", "alerts":
+		return c.runAlert(ctx, verb, args)
+	case "switchover":
+		return c.runSwitchover(ctx, verb, args)
+	case "task", "tasks":
+		return c.runTask(ctx, verb, args)
+	}
+	return errors.New(usage())
+}
+
+// flags 创建绑定了全局参数的 FlagSet。
+func (c *Ctl) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&c.server, "server", c.server, "Manager 地址，默认 $GMHA_SERVER 或 "+defaultServer)
+	fs.StringVar(&c.token, "token", c.token, "访问令牌，默认 $GMHA_TOKEN")
+	fs.StringVar(&c.output, "o", c.output, "输出格式 table|json|yaml")
+	fs.StringVar(&c.output, "output", c.output, "输出格式 table|json|yaml")
+	fs.DurationVar(&c.timeout, "request-timeout", c.timeout, "单次 API 请求超时")
+	return fs
+}
+
+// parseArgs 允许参数与位置参数交错出现，例如 `task get task-1 -o json`。
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, errors.New(usage())
+			}
+			return nil, fmt.Errorf("%s: %w", fs.Name(), err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *Ctl) parse(fs *flag.FlagSet, args []string, want int, usageText string) ([]string, error) {
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != want {
+		return nil, fmt.Errorf("用法: gmhactl %s", usageText)
+	}
+	if !validOutput(c.output) {
+		return nil, fmt.Errorf("不支持的输出格式 %q，可选 table、json、yaml", c.output)
+	}
+	return positional, nil
+}
+
+func (c *Ctl) client() *Client {
+	server := strings.TrimSpace(c.server)
+	if server == "" {
+		server = defaultServer
+	}
+	if !strings.Contains(server, "://") {
+		server = "http://" + server
+	}
+	return &Client{BaseURL: server, Token: c.token, HTTP: &http.Client{Timeout: c.timeout}}
+}
+
+// call 发送请求；API 返回 409 等带有业务内容的错误时，先输出响应体（例如
+// 被阻止的计划）再返回错误，便于 CI 日志定位原因。
+func (c *Ctl) call(ctx context.Context, method, path string, query url.Values, body any) (any, error) {
+	result, err := c.client().Do(ctx, method, path, query, body)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if object, ok := apiErr.Body.(map[string]any); ok && len(object) > 1 {
+			_ = render(c.out, c.output, object, nil)
+		}
+	}
+	return result, err
+}
+
+func (c *Ctl) show(ctx context.Context, path string, query url.Values, columns []column) error {
+	result, err := c.call(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	return render(c.out, c.output, result, columns)
+}
+
+func escape(segment string) string {
+	return url.PathEscape(strings.TrimSpace(segment))
+}
+
+func (c *Ctl) runCluster(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("cluster " + verb)
+	switch verb {
+	case "list":
+		keyword := fs.String("keyword", "", "按名称或描述过滤")
+		if _, err := c.parse(fs, args, 0, "cluster list [--keyword KW]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/clusters", url.Values{"keyword": {*keyword}}, []column{col("NAME", "Name"), col("DESCRIPTION", "Description"), col("MACHINES", "Machines"), col("CREATED", "CreatedAt")})
+	case "get":
+		args, err := c.parse(fs, args, 1, "cluster get NAME")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/clusters/"+escape(args[0]), nil, nil)
+	case "members":
+		args, err := c.parse(fs, args, 1, "cluster members NAME")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/clusters/"+escape(args[0])+"/machines", nil, machineColumns)
+	case "create":
+		description := fs.String("description", "", "集群描述")
+		args, err := c.parse(fs, args, 1, "cluster create NAME [--description TEXT]")
+		if err != nil {
+			return err
+		}
+		result, err := c.call(ctx, http.MethodPost, "/clusters", nil, map[string]string{"name": args[0], "description": *description})
+		if err != nil {
+			return err
+		}
+		return render(c.out, c.output, result, nil)
+	case "delete":
+		args, err := c.parse(fs, args, 1, "cluster delete NAME")
+		if err != nil {
+			return err
+		}
+		result, err := c.call(ctx, http.MethodDelete, "/clusters/"+escape(args[0]), nil, nil)
+		if err != nil {
+			return err
+		}
+		return render(c.out, c.output, result, nil)
+	case "plan", "apply":
+		file := fs.String("f", "", "集群规格文件（YAML 或 JSON）")
+		fs.StringVar(file, "file", "", "集群规格文件（YAML 或 JSON）")
+		prune := fs.Bool("prune", false, "删除规格中未声明的备份策略、集群告警规则与 VIP")
+		wait := fs.Bool("wait", false, "apply 后等待任务结束")
+		waitTimeout := fs.Duration("timeout", 6*time.Hour, "--wait 的最长等待时间")
+		if _, err := c.parse(fs, args, 0, "cluster "+verb+" -f FILE [--prune]"); err != nil {
+			return err
+		}
+		spec, err := readSpec(*file)
+		if err != nil {
+			return err
+		}
+		result, err := c.call(ctx, http.MethodPost, "/cluster-specs/"+verb, nil, map[string]any{"spec": spec, "prune": *prune})
+		if err != nil {
+			return err
+		}
+		if verb == "plan" {
+			return c.renderPlan(result)
+		}
+		taskID := text(field(field(field(result, "task"), "task"), "ID"))
+		if c.output != outputTable {
+			if !*wait || taskID == "" {
+				return render(c.out, c.output, result, nil)
+			}
+		} else {
+			if err := c.renderPlan(field(result, "plan")); err != nil {
+				return err
+			}
+			if taskID != "" {
+				fmt.Fprintf(c.out, "\n已创建任务 %s\n", taskID)
+			}
+		}
+		if !*wait || taskID == "" {
+			return nil
+		}
+		return c.waitTask(ctx, taskID, *waitTimeout)
+	}
+	return errors.New(usage())
+}
+
+// renderPlan 在 table 模式下把计划动作输出为表格，并逐行列出警告与阻止原因。
+func (c *Ctl) renderPlan(plan any) error {
+	if c.output != outputTable {
+		return render(c.out, c.output, plan, nil)
+	}
+	actions, _ := field(plan, "actions").([]any)
+	if len(actions) == 0 {
+		fmt.Fprintf(c.out, "集群 %s 已与规格一致\n", text(field(plan, "cluster")))
+	} else if err := render(c.out, outputTable, actions, []column{col("STEP", "step"), col("TARGET", "target"), col("SUMMARY", "summary"), col("CHANGES", "changes")}); err != nil {
+		return err
+	}
+	for _, label := range []string{"warnings", "blocking_reasons"} {
+		items, _ := field(plan, label).([]any)
+		for _, item := range items {
+			fmt.Fprintf(c.out, "%s: %s\n", map[string]string{"warnings": "警告", "blocking_reasons": "阻止"}[label], text(item))
+		}
+	}
+	return nil
+}
+
+// readSpec 读取规格文件并用环境变量展开 ${NAME}，与 Manager 本机 CLI 一致，
+// 密码等敏感值不必写进文件。
+func readSpec(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", errors.New("请通过 -f 指定集群规格文件")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	expanded := specSecretPattern.ReplaceAllStringFunc(string(content), func(match string) string {
+		name := specSecretPattern.FindStringSubmatch(match)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("未设置规格引用的环境变量: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+var machineColumns = []column{col("ID", "ID"), col("NAME", "Name"), col("IP", "IP"), col("CLUSTER", "Cluster"), col("STATUS", "Status"), col("ARCH", "Architecture")}
+
+func (c *Ctl) runMachine(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("machine " + verb)
+	switch verb {
+	case "list":
+		cluster := fs.String("cluster", "", "只列出该集群的机器")
+		keyword := fs.String("keyword", "", "按 ID、名称、IP 过滤")
+		if _, err := c.parse(fs, args, 0, "machine list [--cluster NAME] [--keyword KW]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/machines", url.Values{"cluster": {*cluster}, "keyword": {*keyword}}, machineColumns)
+	case "get":
+		args, err := c.parse(fs, args, 1, "machine get ID")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/machines/"+escape(args[0]), nil, nil)
+	}
+	return errors.New(usage())
+}
+
+func (c *Ctl) runMySQL(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("mysql " + verb)
+	if verb != "list" {
+		return errors.New(usage())
+	}
+	cluster := fs.String("cluster", "", "只列出该集群的实例")
+	if _, err := c.parse(fs, args, 0, "mysql list [--cluster NAME]"); err != nil {
+		return err
+	}
+	result, err := c.call(ctx, http.MethodGet, "/mysql/instances", nil, nil)
+	if err != nil {
+		return err
+	}
+	if items, ok := result.([]any); ok && *cluster != "" {
+		filtered := []any{}
+		for _, item := range items {
+			if text(field(item, "cluster")) == *cluster {
+				filtered = append(filtered, item)
+			}
+		}
+		result = filtered
+	}
+	return render(c.out, c.output, result, []column{
+		col("MACHINE", "machine_name"), col("IP", "machine_ip"), col("PORT", "port"), col("CLUSTER", "cluster"),
+		col("VERSION", "version"), col("STATUS", "status"), col("HEARTBEAT", "heartbeat_status"),
+	})
+}
+
+func (c *Ctl) runBackup(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("backup " + verb)
+	switch verb {
+	case "policies":
+		cluster := fs.String("cluster", "", "只列出该集群的策略")
+		if _, err := c.parse(fs, args, 0, "backup policies [--cluster NAME]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/backup/policies", url.Values{"cluster": {*cluster}}, []column{
+			col("ID", "id"), col("NAME", "name"), col("CLUSTER", "cluster"), col("TYPE", "backup_type"),
+			col("SCHEDULE", "schedule_type"), col("ENABLED", "enabled"), col("NEXT RUN", "next_run_at"),
+		})
+	case "runs":
+		cluster := fs.String("cluster", "", "只列出该集群的备份")
+		limit := fs.Int("limit", 50, "最多返回条数")
+		if _, err := c.parse(fs, args, 0, "backup runs [--cluster NAME] [--limit N]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/backup/runs", url.Values{"cluster": {*cluster}, "limit": {strconv.Itoa(*limit)}}, []column{
+			col("ID", "id"), col("CLUSTER", "cluster"), col("MACHINE", "machine_name", "machine_id"), col("TYPE", "backup_type"),
+			col("STATUS", "status"), col("TASK", "task_id"), col("STARTED", "started_at", "created_at"),
+		})
+	case "run":
+		wait := fs.Bool("wait", false, "等待备份任务结束")
+		waitTimeout := fs.Duration("timeout", 6*time.Hour, "--wait 的最长等待时间")
+		args, err := c.parse(fs, args, 1, "backup run POLICY_ID [--wait]")
+		if err != nil {
+			return err
+		}
+		result, err := c.call(ctx, http.MethodPost, "/backup/policies/"+escape(args[0])+"/run", nil, nil)
+		if err != nil {
+			return err
+		}
+		if taskID := text(field(result, "task_id")); *wait && taskID != "" {
+			return c.waitTask(ctx, taskID, *waitTimeout)
+		}
+		return render(c.out, c.output, result, nil)
+	}
+	return errors.New(usage())
+}
+
+func (c *Ctl) runAlert(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("alert " + verb)
+	switch verb {
+	case "rules":
+		if _, err := c.parse(fs, args, 0, "alert rules"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/alerts/rules", nil, []column{
+			col("ID", "id"), col("NAME", "name"), col("METRIC", "metric"), col("OP", "operator"), col("THRESHOLD", "threshold"),
+			col("SEVERITY", "severity"), col("CLUSTER", "cluster_id"), col("ENABLED", "enabled"),
+		})
+	case "events":
+		status := fs.String("status", "", "firing|acknowledged|silenced|resolved")
+		severity := fs.String("severity", "", "notice|warning|critical|fatal")
+		cluster := fs.String("cluster", "", "集群名")
+		limit := fs.Int("limit", 100, "最多返回条数")
+		if _, err := c.parse(fs, args, 0, "alert events [--status S] [--severity S] [--cluster NAME]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/alerts/events", url.Values{"status": {*status}, "severity": {*severity}, "cluster_id": {*cluster}, "limit": {strconv.Itoa(*limit)}}, []column{
+			col("ID", "id"), col("RULE", "rule_name"), col("SEVERITY", "severity"), col("STATUS", "status"),
+			col("CLUSTER", "cluster_id"), col("VALUE", "value"), col("LAST SEEN", "last_seen_at"),
+		})
+	case "ack", "resolve", "silence":
+		actor := fs.String("actor", "gmhactl", "操作人")
+		duration := fs.Duration("for", time.Hour, "silence 的静默时长：1h、2h、3h、5h、12h 或 24h")
+		args, err := c.parse(fs, args, 1, "alert "+verb+" EVENT_ID")
+		if err != nil {
+			return err
+		}
+		action := verb
+		if verb == "ack" {
+			action = "acknowledge"
+		}
+		body := map[string]any{"id": args[0], "action": action, "actor": *actor}
+		if verb == "silence" {
+			body["silence_seconds"] = int(duration.Seconds())
+		}
+		result, err := c.call(ctx, http.MethodPost, "/alerts/events/action", nil, body)
+		if err != nil {
+			return err
+		}
+		return render(c.out, c.output, result, nil)
+	}
+	return errors.New(usage())
+}
+
+var switchoverTerminal = map[string]bool{"success": true, "aborted": true, "rolled_back": true, "rollback_failed": true, "failed": true}
+
+func (c *Ctl) runSwitchover(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("switchover " + verb)
+	switch verb {
+	case "start":
+		target := fs.String("target", "", "目标机器 ID；为空时自动选择延迟最小的从库")
+		port := fs.Int("port", 0, "目标端口")
+		maxLag := fs.Int("max-lag", 0, "目标允许的最大复制延迟（秒）")
+		keepVIP := fs.Bool("keep-vip", false, "不迁移 VIP")
+		confirm := fs.String("confirm", "", "必须等于集群名")
+		wait := fs.Bool("wait", false, "等待切换结束")
+		waitTimeout := fs.Duration("timeout", 30*time.Minute, "--wait 的最长等待时间")
+		args, err := c.parse(fs, args, 1, "switchover start CLUSTER --confirm CLUSTER [--target MACHINE_ID] [--wait]")
+		if err != nil {
+			return err
+		}
+		body := map[string]any{"target_machine_id": *target, "target_port": *port, "max_lag_seconds": *maxLag, "confirm": *confirm}
+		if *keepVIP {
+			body["move_vip"] = false
+		}
+		result, err := c.call(ctx, http.MethodPost, "/clusters/"+escape(args[0])+"/switchover", nil, body)
+		if err != nil {
+			return err
+		}
+		id := text(field(result, "switchover_id"))
+		if !*wait || id == "" {
+			return render(c.out, c.output, result, nil)
+		}
+		return c.waitSwitchover(ctx, args[0], id, *waitTimeout)
+	case "list":
+		limit := fs.Int("limit", 20, "最多返回条数")
+		args, err := c.parse(fs, args, 1, "switchover list CLUSTER")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/clusters/"+escape(args[0])+"/switchover", url.Values{"limit": {strconv.Itoa(*limit)}}, []column{
+			col("ID", "switchover_id"), col("STATUS", "status"), col("OLD PRIMARY", "old_primary_endpoint"),
+			col("NEW PRIMARY", "new_primary_endpoint"), col("FREEZE MS", "write_freeze_ms"), col("CREATED", "created_at"),
+		})
+	case "get":
+		args, err := c.parse(fs, args, 2, "switchover get CLUSTER SWITCHOVER_ID")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/clusters/"+escape(args[0])+"/switchover/"+escape(args[1]), nil, nil)
+	}
+	return errors.New(usage())
+}
+
+func (c *Ctl) waitSwitchover(ctx context.Context, cluster, id string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		item, err := c.call(ctx, http.MethodGet, "/clusters/"+escape(cluster)+"/switchover/"+escape(id), nil, nil)
+		if err != nil {
+			return err
+		}
+		if status := text(field(item, "status")); switchoverTerminal[status] {
+			if err := render(c.out, c.output, item, nil); err != nil {
+				return err
+			}
+			if status != "success" {
+				return fmt.Errorf("切换 %s 结束，状态为 %s", id, status)
+			}
+			return nil
+		}
+		if err := sleep(ctx, c.interval); err != nil {
+			return fmt.Errorf("等待切换 %s 超时: %w", id, err)
+		}
+	}
+}
+
+var taskColumns = []column{col("ID", "ID"), col("TYPE", "Type"), col("STATUS", "Status"), col("PROGRESS", "ProgressPercent"), col("STEP", "CurrentStep"), col("CREATED", "CreatedAt")}
+
+func (c *Ctl) runTask(ctx context.Context, verb string, args []string) error {
+	fs := c.flags("task " + verb)
+	switch verb {
+	case "list":
+		status := fs.String("status", "", "running|success|failed")
+		kind := fs.String("type", "", "任务类型")
+		keyword := fs.String("keyword", "", "按任务 ID、类型或机器过滤")
+		limit := fs.Int("limit", 50, "最多返回条数")
+		if _, err := c.parse(fs, args, 0, "task list [--status S] [--type T] [--keyword KW]"); err != nil {
+			return err
+		}
+		return c.show(ctx, "/tasks", url.Values{"page": {"1"}, "page_size": {strconv.Itoa(*limit)}, "status": {*status}, "type": {*kind}, "keyword": {*keyword}}, taskColumns)
+	case "get":
+		args, err := c.parse(fs, args, 1, "task get ID")
+		if err != nil {
+			return err
+		}
+		return c.show(ctx, "/tasks", url.Values{"id": {args[0]}}, nil)
+	case "wait":
+		timeout := fs.Duration("timeout", time.Hour, "最长等待时间")
+		args, err := c.parse(fs, args, 1, "task wait ID [--timeout 1h]")
+		if err != nil {
+			return err
+		}
+		return c.waitTask(ctx, args[0], *timeout)
+	case "logs":
+		follow := fs.Bool("f", false, "持续输出新事件直到任务结束")
+		fs.BoolVar(follow, "follow", false, "持续输出新事件直到任务结束")
+		args, err := c.parse(fs, args, 1, "task logs ID [-f]")
+		if err != nil {
+			return err
+		}
+		return c.taskLogs(ctx, args[0], *follow)
+	}
+	return errors.New(usage())
+}
+
+func taskFinished(status string) bool {
+	return status == "success" || status == "failed"
+}
+
+// waitTask 轮询任务详情直到成功或失败，输出最终任务；失败时返回错误，
+// 使 CI 步骤以非零状态退出。
+func (c *Ctl) waitTask(ctx context.Context, id string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	for {
+		detail, err := c.call(ctx, http.MethodGet, "/tasks", url.Values{"id": {id}}, nil)
+		if err != nil {
+			return err
+		}
+		task := field(detail, "task")
+		if status := text(field(task, "Status")); taskFinished(status) {
+			if err := render(c.out, c.output, task, nil); err != nil {
+				return err
+			}
+			if status != "success" {
+				return fmt.Errorf("任务 %s 失败", id)
+			}
+			return nil
+		}
+		if err := sleep(ctx, c.interval); err != nil {
+			return fmt.Errorf("等待任务 %s 超时: %w", id, err)
+		}
+	}
+}
+
+// taskLogs 输出任务及其子任务的事件；-f 时按事件 ID 去重持续轮询，任务
+// 结束后退出。-o json 时每个事件一行 JSON，便于流水线解析。
+func (c *Ctl) taskLogs(ctx context.Context, id string, follow bool) error {
+	seen := map[string]bool{}
+	for {
+		detail, err := c.call(ctx, http.MethodGet, "/tasks", url.Values{"id": {id}}, nil)
+		if err != nil {
+			return err
+		}
+		for _, event := range taskEvents(detail) {
+			key := text(field(event, "ID"))
+			if key == "" {
+				key = text(field(event, "TaskID")) + "/" + text(field(event, "CreatedAt")) + "/" + text(field(event, "Content"))
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := c.printEvent(event); err != nil {
+				return err
+			}
+		}
+		status := text(field(field(detail, "task"), "Status"))
+		if !follow || taskFinished(status) {
+			if follow && status == "failed" {
+				return fmt.Errorf("任务 %s 失败", id)
+			}
+			return nil
+		}
+		if err := sleep(ctx, c.interval); err != nil {
+			return err
+		}
+	}
+}
+
+func taskEvents(detail any) []any {
+	events, _ := field(detail, "events").([]any)
+	children, _ := field(detail, "child_details").([]any)
+	for _, child := range children {
+		events = append(events, taskEvents(child)...)
+	}
+	return events
+}
+
+func (c *Ctl) printEvent(event any) error {
+	switch c.output {
+	case outputJSON:
+		return render(c.out, outputJSON, event, nil)
+	case outputYAML:
+		return render(c.out, outputYAML, []any{event}, nil)
+	}
+	created := text(field(event, "CreatedAt"))
+	if parsed, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		created = parsed.Local().Format("2006-01-02 15:04:05")
+	}
+	_, err := fmt.Fprintf(c.out, "%s %-5s [%s] %s\n", created, strings.ToUpper(text(field(event, "EventType"))), text(field(event, "TaskID")), text(field(event, "Content")))
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func usage() string {
+	return `用法: gmhactl [--server URL] [--token TOKEN] [-o table|json|yaml] <资源> <操作> [参数]
+  gmhactl cluster list [--keyword KW]
+  gmhactl cluster get prod-a
+  gmhactl cluster members prod-a
+  gmhactl cluster create prod-a [--description "业务集群"]
+  gmhactl cluster delete prod-a
+  gmhactl cluster plan -f cluster.yaml [--prune]
+  gmhactl cluster apply -f cluster.yaml [--prune] [--wait]
+  gmhactl machine list [--cluster prod-a]
+  gmhactl machine get machine-01
+  gmhactl mysql list [--cluster prod-a]
+  gmhactl backup policies [--cluster prod-a]
+  gmhactl backup runs [--cluster prod-a] [--limit 50]
+  gmhactl backup run backup-policy-xxx [--wait]
+  gmhactl alert rules
+  gmhactl alert events [--status firing] [--cluster prod-a]
+  gmhactl alert ack|resolve EVENT_ID
+  gmhactl alert silence EVENT_ID --for 2h
+  gmhactl switchover start prod-a --confirm prod-a [--target machine-02] [--wait]
+  gmhactl switchover list prod-a
+  gmhactl switchover get prod-a so-xxx
+  gmhactl task list [--status running]
+  gmhactl task get task-xxx
+  gmhactl task wait task-xxx [--timeout 1h]
+  gmhactl task logs task-xxx [-f]
+
+环境变量 GMHA_SERVER、GMHA_TOKEN 分别为 --server、--token 的默认值。`
+}
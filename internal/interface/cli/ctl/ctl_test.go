@@ -0,0 +1,171 @@
+package ctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeManager struct {
+	mu       sync.Mutex
+	polls    int
+	requests []string
+	bodies   []map[string]any
+}
+
+func (m *fakeManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		return
+	}
+	m.requests = append(m.requests, r.Method+" "+r.URL.RequestURI())
+	if r.Body != nil {
+		var body map[string]any
+		if raw, _ := io.ReadAll(r.Body); len(raw) > 0 {
+			_ = json.Unmarshal(raw, &body)
+			m.bodies = append(m.bodies, body)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/api/v1/machines":
+		_, _ = io.WriteString(w, `[{"ID":"m-1","Name":"db-01","IP":"10.0.0.1","Cluster":"prod-a","Status":"agent_online","Architecture":"x86_64"}]`)
+	case r.URL.Path == "/api/v1/tasks" && r.URL.Query().Get("id") == "task-1":
+		// 第一次轮询仍在运行，第二次失败；第二次的事件列表包含第一次已输出的事件。
+		m.polls++
+		status, events := "running", `[{"ID":"e-1","TaskID":"task-1","EventType":"info","Content":"开始","CreatedAt":"2026-01-01T00:00:00Z"}]`
+		if m.polls > 1 {
+			status = "failed"
+			events = `[{"ID":"e-1","TaskID":"task-1","EventType":"info","Content":"开始","CreatedAt":"2026-01-01T00:00:00Z"}]`
+		}
+		child := `{"task":{"ID":"task-1-child"},"events":[]}`
+		if m.polls > 1 {
+			child = `{"task":{"ID":"task-1-child"},"events":[{"ID":"e-2","TaskID":"task-1-child","EventType":"error","Content":"exit status 1","CreatedAt":"2026-01-01T00:00:01Z"}]}`
+		}
+		_, _ = io.WriteString(w, `{"task":{"ID":"task-1","Status":"`+status+`"},"events":`+events+`,"child_details":[`+child+`]}`)
+	case r.URL.Path == "/api/v1/cluster-specs/apply":
+		w.WriteHeader(http.StatusConflict)
+		_, _ = io.WriteString(w, `{"error":"集群规格无法应用：机器 db-09 尚未纳管","plan":{"cluster":"prod-a","actions":[],"blocking_reasons":["机器 db-09 尚未纳管"],"executable":false}}`)
+	case r.URL.Path == "/api/v1/cluster-specs/plan":
+		_, _ = io.WriteString(w, `{"cluster":"prod-a","actions":[{"step":"01-assign_member","kind":"assign_member","target":"db-02","summary":"把机器 db-02 加入集群 prod-a"}],"warnings":["db-03 未声明"],"executable":true}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":"not found"}`)
+	}
+}
+
+func runCtl(t *testing.T, server *httptest.Server, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	c := &Ctl{out: &out, server: server.URL, token: "secret-token", output: outputTable, timeout: 5 * time.Second, interval: time.Millisecond}
+	err := c.run(context.Background(), args)
+	return out.String(), err
+}
+
+func TestCtlRendersTableJSONAndYAML(t *testing.T) {
+	manager := &fakeManager{}
+	server := httptest.NewServer(manager)
+	defer server.Close()
+
+	out, err := runCtl(t, server, "machine", "list", "--cluster", "prod-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "db-01") || !strings.Contains(lines[1], "x86_64") {
+		t.Fatalf("unexpected table:\n%s", out)
+	}
+	if manager.requests[0] != "GET /api/v1/machines?cluster=prod-a" {
+		t.Fatalf("empty query values must be dropped, got %s", manager.requests[0])
+	}
+
+	out, err = runCtl(t, server, "machine", "list", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil || decoded[0]["IP"] != "10.0.0.1" {
+		t.Fatalf("json output must be the raw API payload: %v\n%s", err, out)
+	}
+
+	out, err = runCtl(t, server, "-o", "yaml", "machine", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "- Architecture: x86_64\n  Cluster: prod-a\n") || !strings.Contains(out, "  IP: 10.0.0.1\n") {
+		t.Fatalf("unexpected yaml:\n%s", out)
+	}
+
+	if _, err := runCtl(t, server, "machine", "list", "-o", "xml"); err == nil {
+		t.Fatal("unknown output formats must be rejected")
+	}
+}
+
+func TestCtlTaskLogsFollowsEventsUntilFailure(t *testing.T) {
+	manager := &fakeManager{}
+	server := httptest.NewServer(manager)
+	defer server.Close()
+
+	out, err := runCtl(t, server, "task", "logs", "task-1", "-f")
+	if err == nil || !strings.Contains(err.Error(), "task-1") {
+		t.Fatalf("a failed task must return an error, got %v", err)
+	}
+	if strings.Count(out, "开始") != 1 || !strings.Contains(out, "ERROR [task-1-child] exit status 1") {
+		t.Fatalf("events must be printed once, including child tasks:\n%s", out)
+	}
+
+	manager.polls = 0
+	out, err = runCtl(t, server, "task", "wait", "task-1", "-o", "json")
+	if err == nil || !strings.Contains(out, `"Status": "failed"`) {
+		t.Fatalf("wait must print the final task and fail: %v\n%s", err, out)
+	}
+}
+
+func TestCtlClusterSpecExpandsSecretsAndShowsBlockedPlan(t *testing.T) {
+	manager := &fakeManager{}
+	server := httptest.NewServer(manager)
+	defer server.Close()
+	file := filepath.Join(t.TempDir(), "cluster.yaml")
+	if err := os.WriteFile(file, []byte("cluster: prod-a\nmysql:\n  root_password: ${GMHACTL_TEST_PW}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runCtl(t, server, "cluster", "plan", "-f", file); err == nil || !strings.Contains(err.Error(), "GMHACTL_TEST_PW") {
+		t.Fatalf("missing variables must be reported before calling the API, got %v", err)
+	}
+	t.Setenv("GMHACTL_TEST_PW", "s3cret")
+	out, err := runCtl(t, server, "cluster", "plan", "-f", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "01-assign_member") || !strings.Contains(out, "警告: db-03 未声明") {
+		t.Fatalf("unexpected plan table:\n%s", out)
+	}
+	if spec, _ := manager.bodies[0]["spec"].(string); !strings.Contains(spec, "root_password: s3cret") {
+		t.Fatalf("secret was not expanded: %q", spec)
+	}
+
+	out, err = runCtl(t, server, "cluster", "apply", "-f", file, "-o", "json")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusConflict || !strings.Contains(out, "db-09") {
+		t.Fatalf("blocked apply must print the plan and fail: %v\n%s", err, out)
+	}
+
+	c := &Ctl{out: io.Discard, server: server.URL, token: "wrong", output: outputTable, timeout: time.Second, interval: time.Millisecond}
+	if err := c.run(context.Background(), []string{"machine", "list"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("the token must be sent as a bearer token, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package ctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// column 描述表格中的一列；keys 依次尝试，兼容 snake_case 与大写字段名。
+type column struct {
+	header string
+	keys   []string
+}
+
+func col(header string, keys ...string) column {
+	return column{header: header, keys: keys}
+}
+
+func validOutput(format string) bool {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return true
+	}
+	return false
+}
+
+// render 按 -o 输出。table 模式下列表按 columns 输出，单个对象按字段逐行
+// 输出；分页响应会自动取 items。
+func render(w io.Writer, format string, value any, columns []column) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(value)
+	case outputYAML:
+		var b strings.Builder
+		writeYAML(&b, value, 0)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	if items, ok := field(value, "items").([]any); ok && columns != nil {
+		value = items
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch v := value.(type) {
+	case []any:
+		if len(columns) == 0 {
+			for _, item := range v {
+				fmt.Fprintln(tw, cell(item))
+			}
+			break
+		}
+		headers := make([]string, len(columns))
+		for i, c := range columns {
+			headers[i] = c.header
+		}
+		fmt.Fprintln(tw, strings.Join(headers, "\t"))
+		for _, item := range v {
+			cells := make([]string, len(columns))
+			for i, c := range columns {
+				cells[i] = cell(field(item, c.keys...))
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(tw, "%s\t%s\n", key, cell(v[key]))
+		}
+	default:
+		fmt.Fprintln(tw, cell(v))
+	}
+	return tw.Flush()
+}
+
+func cell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		return strings.ReplaceAll(v, "\n", " ")
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	}
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(payload)
+}
+
+// writeYAML 把解码后的 JSON 值输出为块风格 YAML，对象键按字母序排列。
+func writeYAML(b *strings.Builder, value any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(pad + yamlScalar(key) + ":")
+			writeYAMLChild(b, v[key], indent)
+		}
+	case []any:
+		if len(v) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, item := range v {
+			// 非空对象写成紧凑形式：第一个键与 "-" 同行。
+			if object, ok := item.(map[string]any); ok && len(object) > 0 {
+				var nested strings.Builder
+				writeYAML(&nested, object, indent+1)
+				b.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+				continue
+			}
+			b.WriteString(pad + "-")
+			writeYAMLChild(b, item, indent)
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+func writeYAMLChild(b *strings.Builder, value any, indent int) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, v, indent+1)
+			return
+		}
+		b.WriteString(" {}\n")
+	case []any:
+		if len(v) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, v, indent+1)
+			return
+		}
+		b.WriteString(" []\n")
+	default:
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	}
+}
+
+func yamlScalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if yamlNeedsQuote(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	}
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+func yamlNeedsQuote(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	return strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\t\\")
+}
@@ -634,7 +634,7 @@ createApp({
       const steps = taskSteps(detail)
       selectedTaskStep.value = steps.find(step => ['failed', 'error'].includes(state(step.Status || step.status))) || steps.find(step => state(step.Status || step.status) === 'running') || steps[0] || null
     }
-    function taskTypeLabel(value) { return ({ exec: '远程命令执行', collect_machine_info: '采集机器信息', collect_static_info: '采集静态信息', mysql_install: '安装 MySQL', mysql_uninstall: '卸载 MySQL', mysql_topology: '配置 MySQL 拓扑', mysql_upgrade: '升级 MySQL', mysql_cluster_upgrade: 'MySQL 集群滚动升级', mysql_cluster_bootstrap: '批量安装并初始化架构', batch_operation: '批量业务操作', ai_workflow: 'AI 运维工作流', architecture_adjustment: '集群架构切换', agent_recovery: 'Agent 恢复', platform_operation: '平台操作', flamegraph: '生成 Linux 火焰图' })[String(value || '').toLowerCase()] || value || '任务详情' }
+    function taskTypeLabel(value) { return ({ exec: '远程命令执行', collect_machine_info: '采集机器信息', collect_static_info: '采集静态信息', mysql_install: '安装 MySQL', mysql_uninstall: '卸载 MySQL', mysql_topology: '配置 MySQL 拓扑', mysql_upgrade: '升级 MySQL', mysql_cluster_upgrade: 'MySQL 集群滚动升级', mysql_cluster_bootstrap: '批量安装并初始化架构', batch_operation: '批量业务操作', ai_workflow: 'AI 运维工作流', architecture_adjustment: '集群架构切换', cluster_spec_apply: '应用集群规格', agent_recovery: 'Agent 恢复', platform_operation: '平台操作', flamegraph: '生成 Linux 火焰图' })[String(value || '').toLowerCase()] || value || '任务详情' }
     function taskSpec(item = taskObject()) {
       const raw = item?.SpecJSON || item?.spec_json
       if (!raw) return {}
@@ -4369,7 +4369,7 @@ if (!confirm(`确认向集群 ${cluster} 的集群内所有机器创建 MySQL 
   emits: ['select', 'page'],
   data() { return { collapsedTasks: {} } },
   methods: {
-    typeLabel(value) { return ({ exec: '远程命令', collect_machine_info: '机器信息采集', collect_static_info: '静态资产采集', mysql_install: 'MySQL 安装', mysql_uninstall: 'MySQL 卸载', mysql_topology: 'MySQL 拓扑采集', mysql_upgrade: 'MySQL 升级', mysql_cluster_upgrade: 'MySQL 集群滚动升级', mysql_cluster_bootstrap: 'MySQL 集群初始化', batch_operation: '批量业务操作', ai_workflow: 'AI 运维工作流', architecture_adjustment: 'MySQL 架构调整', agent_recovery: 'Agent 恢复', platform_operation: '平台操作', flamegraph: 'Linux 火焰图' })[String(value || '').toLowerCase()] || value || '未知任务' },
+    typeLabel(value) { return ({ exec: '远程命令', collect_machine_info: '机器信息采集', collect_static_info: '静态资产采集', mysql_install: 'MySQL 安装', mysql_uninstall: 'MySQL 卸载', mysql_topology: 'MySQL 拓扑采集', mysql_upgrade: 'MySQL 升级', mysql_cluster_upgrade: 'MySQL 集群滚动升级', mysql_cluster_bootstrap: 'MySQL 集群初始化', batch_operation: '批量业务操作', ai_workflow: 'AI 运维工作流', architecture_adjustment: 'MySQL 架构调整', cluster_spec_apply: '应用集群规格', agent_recovery: 'Agent 恢复', platform_operation: '平台操作', flamegraph: 'Linux 火焰图' })[String(value || '').toLowerCase()] || value || '未知任务' },
     categoryLabel(item) {
       const rawSpec = item.SpecJSON || item.spec_json
       let spec = {}; try { spec = typeof rawSpec === 'string' ? JSON.parse(rawSpec) : (rawSpec || {}) } catch (_) {}
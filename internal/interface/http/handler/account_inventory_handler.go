@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gmha/internal/app"
+)
+
+type AccountInventoryHandler struct {
+	service *app.AccountInventoryService
+}
+
+func NewAccountInventoryHandler(service *app.AccountInventoryService) *AccountInventoryHandler {
+	return &AccountInventoryHandler{service: service}
+}
+
+func (h *AccountInventoryHandler) available(w http.ResponseWriter) bool {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("account inventory service is unavailable"))
+		return false
+	}
+	return true
+}
+
+// HandleInventory returns one instance with machine_id and port, the whole
+// cluster (or every instance) otherwise; POST collects an instance now.
+func (h *AccountInventoryHandler) HandleInventory(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		if machineID := strings.TrimSpace(query.Get("machine_id")); machineID != "" {
+			port, err := optionalPositiveInt(query.Get("port"))
+			if err != nil || port == 0 {
+				writeError(w, http.StatusBadRequest, errors.New("port must be a positive integer"))
+				return
+			}
+			snapshot, err := h.service.Snapshot(r.Context(), machineID, port)
+			if err != nil {
+				writeError(w, accountInventoryStatus(err, http.StatusInternalServerError), err)
+				return
+			}
+			writeJSON(w, http.StatusOK, snapshot)
+			return
+		}
+		items, err := h.service.List(r.Context(), query.Get("cluster"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var body struct {
+			MachineID string `json:"machine_id"`
+			Port      int    `json:"port"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		snapshot, err := h.service.Collect(r.Context(), body.MachineID, body.Port)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshot)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AccountInventoryHandler) HandleFindings(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	items, err := h.service.Findings(r.Context(), query.Get("cluster"), query.Get("severity"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (h *AccountInventoryHandler) HandleCompare(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	comparison, err := h.service.Compare(r.Context(), r.URL.Query().Get("cluster"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+func (h *AccountInventoryHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body app.AccountSyncRequest
+	if err := decodeStrictJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Sync(r.Context(), body)
+	if err != nil {
+		writeError(w, accountInventoryStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func accountInventoryStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, app.ErrAccountInventoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrAccountSyncRunning):
+		return http.StatusConflict
+	}
+	return fallback
+}
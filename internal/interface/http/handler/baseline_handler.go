@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gmha/internal/app"
+	baselinedomain "gmha/internal/domain/baseline"
+)
+
+type BaselineHandler struct {
+	service *app.BaselineService
+}
+
+func NewBaselineHandler(service *app.BaselineService) *BaselineHandler {
+	return &BaselineHandler{service: service}
+}
+
+func (h *BaselineHandler) available(w http.ResponseWriter) bool {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("baseline service is unavailable"))
+		return false
+	}
+	return true
+}
+
+// HandleReport receives the host facts collected by Agents and answers with
+// the sysctl keys the next collection should read.
+func (h *BaselineHandler) HandleReport(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var report baselinedomain.Report
+	if err := decodeStrictJSONLimit(r, &report, 1<<20); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Ingest(r.Context(), report)
+	switch {
+	case errors.Is(err, app.ErrBaselineReportInvalid):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// HandleProfiles lists stored profiles on GET, or returns the profile that
+// applies to ?cluster=; POST saves a profile and DELETE ?cluster= resets it.
+func (h *BaselineHandler) HandleProfiles(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if !query.Has("cluster") {
+			items, err := h.service.Profiles(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			return
+		}
+		profile, err := h.service.Profile(r.Context(), query.Get("cluster"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	case http.MethodPost:
+		var body struct {
+			Cluster string                `json:"cluster"`
+			Rules   []baselinedomain.Rule `json:"rules"`
+			Actor   string                `json:"actor"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		profile, err := h.service.SaveProfile(r.Context(), body.Cluster, body.Rules, body.Actor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	case http.MethodDelete:
+		if err := h.service.ResetProfile(r.Context(), query.Get("cluster")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		profile, err := h.service.Profile(r.Context(), query.Get("cluster"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHosts lists the latest result of every host.
+func (h *BaselineHandler) HandleHosts(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	items, err := h.service.Hosts(r.Context(), r.URL.Query().Get("cluster"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// HandleHostByID serves /baseline/hosts/{machine_id} with the raw facts and
+// /baseline/hosts/{machine_id}/history.
+func (h *BaselineHandler) HandleHostByID(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/baseline/hosts/"), "/")
+	machineID, sub, _ := strings.Cut(rest, "/")
+	if machineID == "" {
+		writeError(w, http.StatusNotFound, errors.New("缺少机器 ID"))
+		return
+	}
+	switch sub {
+	case "":
+		state, err := h.service.Host(r.Context(), machineID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, state)
+	case "history":
+		limit, err := optionalPositiveInt(r.URL.Query().Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.History(r.Context(), machineID, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	default:
+		writeError(w, http.StatusNotFound, errors.New("未知的基线资源"))
+	}
+}
+
+// HandleRemediate starts the Agent task that fixes failing checks of a host.
+func (h *BaselineHandler) HandleRemediate(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req app.BaselineRemediationRequest
+	if err := decodeStrictJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Remediate(r.Context(), req)
+	switch {
+	case errors.Is(err, app.ErrBaselineRemediationRunning):
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "task_id": result.TaskID})
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusAccepted, result)
+	}
+}
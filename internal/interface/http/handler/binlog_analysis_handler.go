@@ -2,12 +2,17 @@ package handler
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"gmha/internal/app"
+	"gmha/internal/binloganalyzer"
+	binlogdomain "gmha/internal/domain/binloganalysis"
 )
 
 type BinlogAnalysisHandler struct {
@@ -25,7 +30,17 @@ func (h *BinlogAnalysisHandler) HandleCollection(w http.ResponseWriter, r *http.
 	}
 	switch r.Method {
 	case http.MethodGet:
-		writeJSON(w, http.StatusOK, map[string]any{"items": h.service.List()})
+		limit, err := optionalPositiveInt(r.URL.Query().Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.List(r.Context(), r.URL.Query().Get("cluster"), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
 	case http.MethodPost:
 		var body struct {
 			MachineID            string `json:"machine_id"`
@@ -36,6 +51,14 @@ func (h *BinlogAnalysisHandler) HandleCollection(w http.ResponseWriter, r *http.
 			BigTxnMode           string `json:"big_txn_mode"`
 			BigTxnRowsThreshold  int    `json:"big_txn_rows_threshold"`
 			BigTxnBytesThreshold uint64 `json:"big_txn_bytes_threshold"`
+			Mode                 string `json:"mode"`
+			RowFilter            *struct {
+				Schema  string            `json:"schema"`
+				Table   string            `json:"table"`
+				Types   []string          `json:"types"`
+				Match   map[string]string `json:"match"`
+				MaxRows int               `json:"max_rows"`
+			} `json:"row_filter"`
 		}
 		if err := decodeStrictJSON(r, &body); err != nil {
 			writeError(w, http.StatusBadRequest, err)
@@ -51,12 +74,19 @@ func (h *BinlogAnalysisHandler) HandleCollection(w http.ResponseWriter, r *http.
 			writeError(w, http.StatusBadRequest, errors.New("结束时间格式不正确"))
 			return
 		}
-		task, err := h.service.Create(r.Context(), app.BinlogAnalysisRequest{
+		req := app.BinlogAnalysisRequest{
 			MachineID: strings.TrimSpace(body.MachineID), Port: body.Port,
 			StartTime: start, EndTime: end, StartFile: strings.TrimSpace(body.StartFile),
 			BigTxnMode: body.BigTxnMode, BigTxnRowsThreshold: body.BigTxnRowsThreshold,
-			BigTxnBytesThreshold: body.BigTxnBytesThreshold,
-		})
+			BigTxnBytesThreshold: body.BigTxnBytesThreshold, Mode: body.Mode,
+		}
+		if body.RowFilter != nil {
+			req.RowFilter = binloganalyzer.RowFilter{
+				Schema: body.RowFilter.Schema, Table: body.RowFilter.Table, Types: body.RowFilter.Types,
+				Match: body.RowFilter.Match, MaxRows: body.RowFilter.MaxRows,
+			}
+		}
+		task, err := h.service.Create(r.Context(), req)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, err)
 			return
@@ -72,22 +102,45 @@ func (h *BinlogAnalysisHandler) HandleTask(w http.ResponseWriter, r *http.Reques
 		writeError(w, http.StatusServiceUnavailable, errors.New("binlog analysis service is unavailable"))
 		return
 	}
-	rawID := strings.TrimPrefix(r.URL.Path, "/api/v1/mysql/binlog-analysis/")
-	id, err := url.PathUnescape(strings.Trim(rawID, "/"))
+	rawID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/mysql/binlog-analysis/"), "/")
+	action := ""
+	if index := strings.Index(rawID, "/"); index >= 0 {
+		rawID, action = rawID[:index], rawID[index+1:]
+	}
+	id, err := url.PathUnescape(rawID)
 	if err != nil || strings.TrimSpace(id) == "" || strings.Contains(id, "/") {
 		writeError(w, http.StatusBadRequest, errors.New("Binlog 分析任务 ID 不正确"))
 		return
 	}
+	switch action {
+	case "":
+	case "rows":
+		h.handleRows(w, r, id)
+		return
+	case "export":
+		h.handleExport(w, r, id)
+		return
+	case "flashback":
+		h.handleFlashback(w, r, id)
+		return
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown binlog analysis action"))
+		return
+	}
 	switch r.Method {
 	case http.MethodGet:
-		task, ok := h.service.Get(id)
+		task, ok, err := h.service.Get(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
 		if !ok {
 			writeError(w, http.StatusNotFound, errors.New("Binlog 分析任务不存在"))
 			return
 		}
 		writeJSON(w, http.StatusOK, task)
 	case http.MethodDelete:
-		task, err := h.service.Cancel(id)
+		task, err := h.service.Cancel(r.Context(), id)
 		if err != nil {
 			writeError(w, http.StatusConflict, err)
 			return
@@ -98,6 +151,207 @@ func (h *BinlogAnalysisHandler) HandleTask(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+func (h *BinlogAnalysisHandler) handleRows(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	offset := 0
+	if raw := strings.TrimSpace(r.URL.Query().Get("offset")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("offset must be a non-negative integer"))
+			return
+		}
+		offset = value
+	}
+	limit, err := optionalPositiveInt(r.URL.Query().Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := h.service.Rows(r.Context(), id, offset, limit)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleExport downloads the analysis report as JSON (format=json, the
+// default) or the changes of a row-level search as JSON Lines (format=jsonl).
+func (h *BinlogAnalysisHandler) handleExport(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); format {
+	case "", "json":
+		task, ok, err := h.service.Get(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("Binlog 分析任务不存在"))
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="binlog-analysis-`+url.PathEscape(task.ID)+`.json"`)
+		writeJSON(w, http.StatusOK, task)
+	case "jsonl":
+		rows, err := h.service.ExportRows(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		defer rows.Close()
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="binlog-rows-`+url.PathEscape(id)+`.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.Copy(w, rows)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported export format %q", format))
+	}
+}
+
+func (h *BinlogAnalysisHandler) handleFlashback(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Seqs []int64 `json:"seqs"`
+	}
+	if err := decodeStrictJSONLimit(r, &body, 4<<20); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	script, err := h.service.Flashback(r.Context(), id, body.Seqs)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="binlog-flashback-`+url.PathEscape(id)+`.sql"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, script)
+}
+
+type binlogAnalysisScheduleRequest struct {
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	Cluster              string   `json:"cluster"`
+	MachineID            string   `json:"machine_id"`
+	Port                 int      `json:"port"`
+	WindowHours          int      `json:"window_hours"`
+	ScheduleType         string   `json:"schedule_type"`
+	IntervalMinutes      int      `json:"interval_minutes"`
+	StartAt              string   `json:"start_at"`
+	BigTxnMode           string   `json:"big_txn_mode"`
+	BigTxnRowsThreshold  int      `json:"big_txn_rows_threshold"`
+	BigTxnBytesThreshold uint64   `json:"big_txn_bytes_threshold"`
+	AlertBigTransactions *bool    `json:"alert_big_transactions"`
+	AlertDDL             *bool    `json:"alert_ddl"`
+	ExpectedDDL          []string `json:"expected_ddl"`
+	Enabled              *bool    `json:"enabled"`
+}
+
+func (h *BinlogAnalysisHandler) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("binlog analysis service is unavailable"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.service.ListSchedules(r.Context(), r.URL.Query().Get("cluster"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": len(items)})
+	case http.MethodPost:
+		var req binlogAnalysisScheduleRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		startAt, err := parseBinlogAnalysisTime(req.StartAt)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("首次执行时间格式不正确"))
+			return
+		}
+		item, err := h.service.SaveSchedule(r.Context(), binlogdomain.Schedule{
+			ID: req.ID, Name: req.Name, Cluster: req.Cluster, MachineID: req.MachineID, Port: req.Port,
+			WindowHours: req.WindowHours, ScheduleType: req.ScheduleType, IntervalMinutes: req.IntervalMinutes, StartAt: startAt,
+			BigTxnMode: req.BigTxnMode, BigTxnRowsThreshold: req.BigTxnRowsThreshold, BigTxnBytesThreshold: req.BigTxnBytesThreshold,
+			AlertBigTransactions: binlogScheduleFlag(req.AlertBigTransactions, true), AlertDDL: binlogScheduleFlag(req.AlertDDL, true),
+			ExpectedDDL: req.ExpectedDDL, Enabled: binlogScheduleFlag(req.Enabled, true),
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, item)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *BinlogAnalysisHandler) HandleScheduleByID(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("binlog analysis service is unavailable"))
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/mysql/binlog-analysis-schedules/"), "/")
+	parts := strings.Split(path, "/")
+	if len(parts) == 2 && parts[1] == "run" && r.Method == http.MethodPost {
+		task, err := h.service.RunSchedule(r.Context(), parts[0])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, task)
+		return
+	}
+	if len(parts) == 1 && parts[0] != "" && r.Method == http.MethodDelete {
+		if err := h.service.DeleteSchedule(r.Context(), parts[0]); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": parts[0]})
+		return
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+func (h *BinlogAnalysisHandler) HandleTrend(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("binlog analysis service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	weeks, err := optionalPositiveInt(query.Get("weeks"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tables, err := optionalPositiveInt(query.Get("tables"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	trend, err := h.service.TableTrend(r.Context(), query.Get("cluster"), query.Get("schedule_id"), weeks, tables)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, trend)
+}
+
 func parseBinlogAnalysisTime(raw string) (time.Time, error) {
 	text := strings.TrimSpace(raw)
 	for _, layout := range []string{
@@ -122,3 +376,10 @@ func parseBinlogAnalysisTime(raw string) (time.Time, error) {
 	}
 	return time.Time{}, errors.New("invalid time")
 }
+
+func binlogScheduleFlag(value *bool, fallback bool) bool {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"gmha/internal/app"
+)
+
+type CapacityHandler struct {
+	service *app.CapacityService
+}
+
+func NewCapacityHandler(service *app.CapacityService) *CapacityHandler {
+	return &CapacityHandler{service: service}
+}
+
+// HandleForecast returns the days-to-full forecast of every instance datadir.
+func (h *CapacityHandler) HandleForecast(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("capacity service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	horizon, err := optionalPositiveInt(query.Get("horizon_days"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	items, err := h.service.Forecasts(r.Context(), query.Get("cluster"), horizon)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// HandleTableGrowth lists the top growing tables on GET and samples one
+// instance immediately on POST.
+func (h *CapacityHandler) HandleTableGrowth(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("capacity service is unavailable"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		days, err := optionalPositiveInt(query.Get("days"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit, err := optionalPositiveInt(query.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.TopGrowingTables(r.Context(), query.Get("cluster"), days, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var body struct {
+			MachineID string `json:"machine_id"`
+			Port      int    `json:"port"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sample, err := h.service.Collect(r.Context(), body.MachineID, body.Port)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sample)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHistory returns the daily size and datadir usage of one instance.
+func (h *CapacityHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("capacity service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	port, err := optionalPositiveInt(query.Get("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	days, err := optionalPositiveInt(query.Get("days"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	items, err := h.service.History(r.Context(), query.Get("machine_id"), port, days)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gmha/internal/app"
+	certdomain "gmha/internal/domain/certificate"
+)
+
+type CertificateHandler struct{ service *app.CertificateService }
+
+func NewCertificateHandler(service *app.CertificateService) *CertificateHandler {
+	return &CertificateHandler{service: service}
+}
+
+// HandleAuthority 返回 Manager CA 证书；?format=pem 时直接输出 PEM 便于客户端下载。
+func (h *CertificateHandler) HandleAuthority(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	authority, err := h.service.Authority(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "pem" {
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+certdomain.CAFileName+`"`)
+		_, _ = w.Write([]byte(authority.CertPEM))
+		return
+	}
+	writeJSON(w, http.StatusOK, authority)
+}
+
+func (h *CertificateHandler) HandleCluster(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"), "/"), "/")
+	if len(parts) < 2 || parts[1] != "tls" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid TLS path"))
+		return
+	}
+	cluster := parts[0]
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	switch action {
+	case "":
+		h.handlePolicy(w, r, cluster)
+	case "certificates":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		items, err := h.service.ListCertificates(r.Context(), cluster)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": len(items)})
+	case "deploy", "rotate":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req app.CertificateDeployRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		run := h.service.Deploy
+		if action == "rotate" {
+			run = h.service.Rotate
+		}
+		task, err := run(r.Context(), cluster, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, task)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown TLS action"))
+	}
+}
+
+func (h *CertificateHandler) handlePolicy(w http.ResponseWriter, r *http.Request, cluster string) {
+	switch r.Method {
+	case http.MethodGet:
+		overview, err := h.service.Overview(r.Context(), cluster)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, overview)
+	case http.MethodPut, http.MethodPost:
+		var policy certdomain.Policy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		policy.ClusterID = cluster
+		saved, err := h.service.SavePolicy(r.Context(), policy)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, saved)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gmha/internal/app"
+)
+
+type ClusterSpecHandler struct{ service *app.ClusterSpecService }
+
+func NewClusterSpecHandler(service *app.ClusterSpecService) *ClusterSpecHandler {
+	return &ClusterSpecHandler{service: service}
+}
+
+// HandlePlan 处理 POST /api/v1/cluster-specs/plan：对比规格与线上状态，只返回计划。
+func (h *ClusterSpecHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	spec, req, ok := decodeClusterSpecRequest(w, r)
+	if !ok {
+		return
+	}
+	plan, err := h.service.Plan(r.Context(), spec, req.Prune)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// HandleApply 处理 POST /api/v1/cluster-specs/apply：重新生成计划并在后台执行，
+// 计划被阻止时返回 409 与计划内容。
+func (h *ClusterSpecHandler) HandleApply(w http.ResponseWriter, r *http.Request) {
+	spec, req, ok := decodeClusterSpecRequest(w, r)
+	if !ok {
+		return
+	}
+	result, err := h.service.Apply(r.Context(), spec, req.Prune)
+	if err != nil {
+		switch {
+		case len(result.Plan.BlockingReasons) > 0:
+			writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "plan": result.Plan})
+		case result.Plan.Executable:
+			writeError(w, http.StatusConflict, err)
+		default:
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	if result.Plan.InSync {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
+
+func decodeClusterSpecRequest(w http.ResponseWriter, r *http.Request) (app.ClusterSpec, app.ClusterSpecRequest, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return app.ClusterSpec{}, app.ClusterSpecRequest{}, false
+	}
+	var req app.ClusterSpecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return app.ClusterSpec{}, req, false
+	}
+	spec, err := app.ParseClusterSpec(req.Spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return app.ClusterSpec{}, req, false
+	}
+	return spec, req, true
+}
@@ -53,6 +53,9 @@ type clusterTopologyNode struct {
 	Uptime      string `json:"uptime,omitempty"`
 	LastUpdated string `json:"last_updated"`
 	Error       string `json:"error,omitempty"`
+	// RebuildRecommended 标记复制线程中断的从库，页面可据此提供副本重建入口。
+	RebuildRecommended bool   `json:"rebuild_recommended,omitempty"`
+	RebuildReason      string `json:"rebuild_reason,omitempty"`
 }
 
 type clusterTopologyEdge struct {
@@ -210,6 +213,13 @@ func (h *ClusterTopologyHandler) buildAt(ctx context.Context, cluster string, ra
 			node.Role = "readonly"
 		}
 	}
+	for _, edge := range view.Edges {
+		if reason := topologyRebuildReason(edge); reason != "" {
+			if node := byEndpoint[topologyEndpoint(edge.TargetIP, edge.TargetPort)]; node != nil {
+				node.RebuildRecommended, node.RebuildReason = true, reason
+			}
+		}
+	}
 	instanceSelector := ""
 	if len(instanceSelectors) > 0 {
 		instanceSelector = strings.TrimSpace(instanceSelectors[0])
@@ -231,6 +241,22 @@ func (h *ClusterTopologyHandler) buildAt(ctx context.Context, cluster string, ra
 	return view, nil
 }
 
+// topologyRebuildReason 在复制线程未运行或存在复制错误时返回原因。
+func topologyRebuildReason(edge clusterTopologyEdge) string {
+	running := func(v string) bool {
+		return strings.EqualFold(v, "yes") || strings.EqualFold(v, "on") || strings.EqualFold(v, "true")
+	}
+	switch {
+	case strings.TrimSpace(edge.LastError) != "":
+		return edge.LastError
+	case edge.IORunning != "" && !running(edge.IORunning):
+		return "IO thread " + edge.IORunning
+	case edge.SQLRunning != "" && !running(edge.SQLRunning):
+		return "SQL thread " + edge.SQLRunning
+	}
+	return ""
+}
+
 func (h *ClusterTopologyHandler) build(ctx context.Context, cluster string, ranges ...int) (clusterTopologyView, error) {
 	rangeMinutes := 60
 	if len(ranges) > 0 && ranges[0] > 0 {
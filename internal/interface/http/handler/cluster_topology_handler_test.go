@@ -21,3 +21,15 @@ func TestTopologyEdgeIncludesConfiguredSQLDelay(t *testing.T) {
 		t.Fatalf("unexpected topology edge: %+v", edge)
 	}
 }
+
+func TestTopologyRebuildReasonFlagsBrokenReplication(t *testing.T) {
+	if reason := topologyRebuildReason(clusterTopologyEdge{IORunning: "Yes", SQLRunning: "Yes"}); reason != "" {
+		t.Fatalf("healthy edge must not suggest rebuild: %q", reason)
+	}
+	if reason := topologyRebuildReason(clusterTopologyEdge{IORunning: "Yes", SQLRunning: "No"}); reason != "SQL thread No" {
+		t.Fatalf("unexpected reason: %q", reason)
+	}
+	if reason := topologyRebuildReason(clusterTopologyEdge{IORunning: "Connecting", SQLRunning: "Yes", LastError: "Got fatal error 1236"}); reason != "Got fatal error 1236" {
+		t.Fatalf("replication error must be reported first: %q", reason)
+	}
+}
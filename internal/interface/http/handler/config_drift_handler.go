@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gmha/internal/app"
+	driftdomain "gmha/internal/domain/configdrift"
+	taskdomain "gmha/internal/domain/task"
+)
+
+type ConfigDriftHandler struct {
+	service *app.ConfigDriftService
+	tasks   *TaskHandler
+}
+
+func NewConfigDriftHandler(service *app.ConfigDriftService, tasks *app.TaskService) *ConfigDriftHandler {
+	return &ConfigDriftHandler{service: service, tasks: NewTaskHandler(tasks)}
+}
+
+func (h *ConfigDriftHandler) available(w http.ResponseWriter) bool {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("config drift service is unavailable"))
+		return false
+	}
+	return true
+}
+
+// HandleReport receives my.cnf, runtime and persisted variables from Agents
+// and answers with the my.cnf path of each local instance.
+func (h *ConfigDriftHandler) HandleReport(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var report driftdomain.Report
+	if err := decodeStrictJSONLimit(r, &report, 8<<20); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Ingest(r.Context(), report)
+	switch {
+	case errors.Is(err, app.ErrConfigDriftReportInvalid):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// HandleClusterReport returns the drift report of ?cluster=.
+func (h *ConfigDriftHandler) HandleClusterReport(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	report, err := h.service.Report(r.Context(), r.URL.Query().Get("cluster"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HandleInstance returns the three sources and findings of one instance.
+func (h *ConfigDriftHandler) HandleInstance(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	port, err := strconv.Atoi(query.Get("port"))
+	if err != nil || port <= 0 || port > 65535 || strings.TrimSpace(query.Get("machine_id")) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("machine_id 与有效的 port 必填"))
+		return
+	}
+	snapshot, err := h.service.Instance(r.Context(), query.Get("machine_id"), port)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// HandleDesired lists desired sets on GET, or returns the set of ?cluster=;
+// POST replaces a cluster's set and DELETE ?cluster= removes it.
+func (h *ConfigDriftHandler) HandleDesired(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if !query.Has("cluster") {
+			items, err := h.service.ListDesired(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			return
+		}
+		desired, err := h.service.Desired(r.Context(), query.Get("cluster"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, desired)
+	case http.MethodPost:
+		var body struct {
+			Cluster    string            `json:"cluster"`
+			Parameters map[string]string `json:"parameters"`
+			Ignore     []string          `json:"ignore"`
+			Actor      string            `json:"actor"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		desired, err := h.service.SaveDesired(r.Context(), body.Cluster, body.Parameters, body.Ignore, body.Actor)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, desired)
+	case http.MethodDelete:
+		if strings.TrimSpace(query.Get("cluster")) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("cluster 不能为空"))
+			return
+		}
+		if err := h.service.DeleteDesired(r.Context(), query.Get("cluster")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleReconcile aligns instances with the desired set through the MySQL
+// parameter task. Dynamic parameters are applied with SET GLOBAL and written
+// to my.cnf on every target at once; restart-required ones need restart and
+// restart_confirmed and then roll replica by replica with the primary last,
+// stopping at the first failed node.
+func (h *ConfigDriftHandler) HandleReconcile(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req app.ConfigDriftReconcileRequest
+	if err := decodeStrictJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := h.service.ReconcilePlan(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	targets := make([]app.ConfigDriftReconcileTarget, 0, len(plan))
+	requiresRestart := false
+	for _, target := range plan {
+		if len(target.Changes) == 0 {
+			continue
+		}
+		targets = append(targets, target)
+		for _, change := range target.Changes {
+			requiresRestart = requiresRestart || !mysqlParameterIsDynamic(change.Name)
+		}
+	}
+	response := map[string]any{"plan": plan, "requires_restart": requiresRestart}
+	if req.DryRun {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	if len(targets) == 0 {
+		response["error"] = "没有可以自动对齐的参数"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if requiresRestart && (!req.Restart || !req.RestartConfirmed) {
+		response["error"] = "包含需要重启才能生效的参数，请设置 restart 与 restart_confirmed"
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+
+	if len(targets) == 1 {
+		detail, err := h.tasks.createMySQLParameterTask(r.Context(), configDriftTaskTarget(targets[0]), configDriftTaskChanges(targets[0]), requiresRestart, "apply")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		response["tasks"] = []app.TaskDetail{detail}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	service := h.tasks.service
+	parent, err := service.CreateBatchTrackingTask(r.Context(), "mysql_config_reconcile", "对齐集群 "+req.Cluster+" 的 MySQL 参数", fmt.Sprintf("%d 个实例", len(targets)))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	response["parent"] = parent
+	if requiresRestart {
+		parentID := parent.Task.ID
+		go func() {
+			created, failed := 0, 0
+			for index, target := range targets {
+				detail, createErr := h.tasks.createMySQLParameterTask(context.Background(), configDriftTaskTarget(target), configDriftTaskChanges(target), true, "apply")
+				if createErr != nil {
+					failed += len(targets) - index
+					break
+				}
+				created++
+				_ = service.AttachChildTasks(context.Background(), parentID, []string{detail.Task.ID})
+				finished, waitErr := service.WaitForTask(context.Background(), detail.Task.ID, 10*time.Minute)
+				if waitErr != nil || finished.Task.Status != taskdomain.StatusSuccess {
+					failed += len(targets) - index - 1
+					break
+				}
+			}
+			_ = service.FinalizeBatchTrackingTask(context.Background(), parentID, created, failed)
+		}()
+		response["restart_mode"] = "rolling"
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	tasks := make([]app.TaskDetail, 0, len(targets))
+	taskIDs := make([]string, 0, len(targets))
+	for _, target := range targets {
+		detail, createErr := h.tasks.createMySQLParameterTask(r.Context(), configDriftTaskTarget(target), configDriftTaskChanges(target), false, "apply")
+		if createErr != nil {
+			_ = service.FinalizeBatchTrackingTask(r.Context(), parent.Task.ID, len(tasks), len(targets)-len(tasks))
+			writeError(w, http.StatusBadRequest, createErr)
+			return
+		}
+		detail.Task.ParentTaskID = parent.Task.ID
+		tasks = append(tasks, detail)
+		taskIDs = append(taskIDs, detail.Task.ID)
+	}
+	if err := service.AttachChildTasks(r.Context(), parent.Task.ID, taskIDs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	_ = service.FinalizeBatchTrackingTask(r.Context(), parent.Task.ID, len(tasks), 0)
+	if detail, err := service.GetTaskDetail(r.Context(), parent.Task.ID); err == nil {
+		response["parent"] = detail
+	}
+	response["tasks"] = tasks
+	writeJSON(w, http.StatusOK, response)
+}
+
+func configDriftTaskTarget(target app.ConfigDriftReconcileTarget) mysqlParameterTargetRequest {
+	return mysqlParameterTargetRequest{Machine: target.MachineID, Port: target.Port, ConfigPath: target.ConfigPath}
+}
+
+func configDriftTaskChanges(target app.ConfigDriftReconcileTarget) []mysqlParameterChangeRequest {
+	changes := make([]mysqlParameterChangeRequest, 0, len(target.Changes))
+	for _, change := range target.Changes {
+		changes = append(changes, mysqlParameterChangeRequest{Action: "update", Name: change.Name, Value: change.Value})
+	}
+	return changes
+}
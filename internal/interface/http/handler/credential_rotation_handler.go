@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gmha/internal/app"
+	rotationdomain "gmha/internal/domain/credrotation"
+)
+
+type CredentialRotationHandler struct {
+	service *app.CredentialRotationService
+}
+
+func NewCredentialRotationHandler(service *app.CredentialRotationService) *CredentialRotationHandler {
+	return &CredentialRotationHandler{service: service}
+}
+
+func (h *CredentialRotationHandler) available(w http.ResponseWriter) bool {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("credential rotation service is unavailable"))
+		return false
+	}
+	return true
+}
+
+// HandlePlan previews a rotation of ?roles=mha,monitor,backup.
+func (h *CredentialRotationHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	plan, err := h.service.Plan(r.Context(), strings.Split(r.URL.Query().Get("roles"), ","))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// HandleRotations lists rotations on GET (?status=, ?limit=) or returns ?id=;
+// POST starts a rotation in the background.
+func (h *CredentialRotationHandler) HandleRotations(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if id := strings.TrimSpace(query.Get("id")); id != "" {
+			rotation, err := h.service.Rotation(r.Context(), id)
+			if err != nil {
+				writeError(w, credentialRotationStatus(err, http.StatusInternalServerError), err)
+				return
+			}
+			writeJSON(w, http.StatusOK, rotation)
+			return
+		}
+		limit, err := optionalPositiveInt(query.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.ListRotations(r.Context(), query.Get("status"), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req app.CredentialRotationRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rotation, err := h.service.Rotate(r.Context(), req)
+		if errors.Is(err, app.ErrCredentialRotationSinglePassword) {
+			writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "plan": rotation})
+			return
+		}
+		if err != nil {
+			writeError(w, credentialRotationStatus(err, http.StatusBadRequest), err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, rotation)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRetry resumes a failed rotation from its first unfinished step.
+func (h *CredentialRotationHandler) HandleRetry(w http.ResponseWriter, r *http.Request) {
+	h.handleFailed(w, r, h.service.Retry)
+}
+
+// HandleRollback restores the passwords in use before a failed rotation.
+func (h *CredentialRotationHandler) HandleRollback(w http.ResponseWriter, r *http.Request) {
+	h.handleFailed(w, r, h.service.Rollback)
+}
+
+func (h *CredentialRotationHandler) handleFailed(w http.ResponseWriter, r *http.Request, action func(context.Context, string, string) (rotationdomain.Rotation, error)) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		ID    string `json:"id"`
+		Actor string `json:"actor"`
+	}
+	if err := decodeStrictJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rotation, err := action(r.Context(), body.ID, body.Actor)
+	if err != nil {
+		writeError(w, credentialRotationStatus(err, http.StatusConflict), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, rotation)
+}
+
+// HandleSchedule returns the rotation schedule on GET and replaces it on PUT.
+func (h *CredentialRotationHandler) HandleSchedule(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := h.service.Schedule(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, schedule)
+	case http.MethodPut:
+		var req app.CredentialRotationScheduleRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		schedule, err := h.service.SaveSchedule(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, schedule)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func credentialRotationStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, app.ErrCredentialRotationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrCredentialRotationActive):
+		return http.StatusConflict
+	}
+	return fallback
+}
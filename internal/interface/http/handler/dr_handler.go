@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gmha/internal/app"
+)
+
+type DRHandler struct{ service *app.DRService }
+
+func NewDRHandler(service *app.DRService) *DRHandler {
+	return &DRHandler{service: service}
+}
+
+// HandleLinks 列出或创建跨集群容灾链路。
+func (h *DRHandler) HandleLinks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.service.ListLinks(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": len(items)})
+	case http.MethodPost:
+		var req app.DRLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		link, err := h.service.CreateLink(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, link)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleLinkByID 处理单条链路的查看、删除、检查、提升与提升记录。
+func (h *DRHandler) HandleLinkByID(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/dr-links/"), "/"), "/")
+	if len(parts) == 0 || parts[0] == "" || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, errors.New("unknown DR link path"))
+		return
+	}
+	id := parts[0]
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		link, ok, err := h.service.GetLink(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("dr link not found"))
+			return
+		}
+		writeJSON(w, http.StatusOK, link)
+	case action == "" && r.Method == http.MethodDelete:
+		if err := h.service.DeleteLink(r.Context(), id); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": id})
+	case action == "check" && r.Method == http.MethodPost:
+		link, err := h.service.CheckLink(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, link)
+	case action == "promote" && r.Method == http.MethodPost:
+		var req app.DRPromoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		promotion, err := h.service.Promote(r.Context(), id, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, promotion)
+	case action == "promotions" && r.Method == http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		items, err := h.service.ListPromotions(r.Context(), id, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": len(items)})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
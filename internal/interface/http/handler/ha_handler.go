@@ -3,6 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"gmha/internal/app"
@@ -19,7 +20,7 @@ func NewHAHandler(ha *app.HAService) *HAHandler {
 	return &HAHandler{ha: ha}
 }
 
-// HandleClusterActions 处理集群级别的 HA 操作请求，包括 VIP 状态/扫描/采纳/验证和故障切换计划/启动/状态查询。
+// HandleClusterActions 处理集群级别的 HA 操作请求，包括 VIP 状态/扫描/采纳/验证、故障切换计划/启动/状态查询和计划内切换。
 func (h *HAHandler) HandleClusterActions(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"), "/"), "/")
 	if len(parts) < 2 {
@@ -116,6 +117,41 @@ func (h *HAHandler) HandleClusterActions(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		writeHAJSON(w, item, nil)
+	case len(parts) == 2 && parts[1] == "switchover" && r.Method == http.MethodPost:
+		var req hadomain.SwitchoverRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeHAError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		item, err := h.ha.StartSwitchover(r.Context(), clusterID, req)
+		if err != nil {
+			if item.SwitchoverID == "" {
+				writeHAError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "switchover": item})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(item)
+	case len(parts) == 2 && parts[1] == "switchover" && r.Method == http.MethodGet:
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		items, err := h.ha.ListSwitchovers(r.Context(), clusterID, limit)
+		writeHAJSON(w, items, err)
+	case len(parts) == 3 && parts[1] == "switchover" && r.Method == http.MethodGet:
+		item, ok, err := h.ha.GetSwitchover(r.Context(), clusterID, parts[2])
+		if err != nil {
+			writeHAError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			writeHAError(w, http.StatusNotFound, "switchover not found")
+			return
+		}
+		writeHAJSON(w, item, nil)
 	default:
 		http.NotFound(w, r)
 	}
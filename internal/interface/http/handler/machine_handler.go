@@ -80,6 +80,14 @@ type batchDeleteMachinesRequest struct {
 	Concurrency int      `json:"concurrency"`
 }
 
+// bulkOnboardRequest 表示批量纳管请求体：inventory 为 CSV/YAML 清单原文，
+// machines 为已解析的条目，两者可以同时提供。
+type bulkOnboardRequest struct {
+	app.BulkOnboardRequest
+	Format    string `json:"format"`
+	Inventory string `json:"inventory"`
+}
+
 // assignClusterRequest 表示分配集群请求体。
 type assignClusterRequest struct {
 	Cluster string `json:"cluster"`
@@ -176,6 +184,75 @@ func (h *MachineHandler) HandleBatchDeleteMachines(w http.ResponseWriter, r *htt
 	writeJSON(w, http.StatusOK, result)
 }
 
+// HandleDiscover 扫描网段内可 SSH 连接的主机与已有 mysqld 监听。
+func (h *MachineHandler) HandleDiscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req app.OnboardDiscoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	hosts, err := h.service.DiscoverOnboardTargets(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hosts)
+}
+
+// HandleBulkPrecheck 对纳管清单与扫描结果逐台执行预检查，返回合并报告。
+func (h *MachineHandler) HandleBulkPrecheck(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeBulkOnboardRequest(w, r)
+	if !ok {
+		return
+	}
+	report, err := h.service.PrecheckBulkOnboard(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// HandleBulkOnboard 按清单批量纳管机器：创建任务中心的父任务后返回 202，纳管在
+// 后台执行，客户端断开不会中断。
+func (h *MachineHandler) HandleBulkOnboard(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeBulkOnboardRequest(w, r)
+	if !ok {
+		return
+	}
+	result, err := h.service.BulkOnboard(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
+
+func decodeBulkOnboardRequest(w http.ResponseWriter, r *http.Request) (app.BulkOnboardRequest, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return app.BulkOnboardRequest{}, false
+	}
+	var req bulkOnboardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return app.BulkOnboardRequest{}, false
+	}
+	if strings.TrimSpace(req.Inventory) != "" {
+		entries, err := app.ParseOnboardInventory(req.Format, req.Inventory)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return app.BulkOnboardRequest{}, false
+		}
+		req.Entries = append(req.Entries, entries...)
+	}
+	return req.BulkOnboardRequest, true
+}
+
 // HandlePrecheck 在机器纳管前执行非破坏性的 SSH 与环境检查。
 func (h *MachineHandler) HandlePrecheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gmha/internal/app"
+	templatedomain "gmha/internal/domain/paramtemplate"
+	taskdomain "gmha/internal/domain/task"
+)
+
+type ParameterTemplateHandler struct {
+	service *app.ParameterTemplateService
+	tasks   *TaskHandler
+}
+
+func NewParameterTemplateHandler(service *app.ParameterTemplateService, tasks *app.TaskService) *ParameterTemplateHandler {
+	return &ParameterTemplateHandler{service: service, tasks: NewTaskHandler(tasks)}
+}
+
+func (h *ParameterTemplateHandler) available(w http.ResponseWriter) bool {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("parameter template service is unavailable"))
+		return false
+	}
+	return true
+}
+
+// HandleTemplates lists templates on GET, or returns ?name= with its versions;
+// POST creates the next version and DELETE ?name= removes a template.
+func (h *ParameterTemplateHandler) HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if !query.Has("name") {
+			items, err := h.service.ListTemplates(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": items})
+			return
+		}
+		detail, err := h.service.Template(r.Context(), query.Get("name"))
+		if err != nil {
+			writeError(w, parameterTemplateStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, detail)
+	case http.MethodPost:
+		var req app.ParameterTemplateVersionRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		version, err := h.service.CreateVersion(r.Context(), req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, version)
+	case http.MethodDelete:
+		if err := h.service.DeleteTemplate(r.Context(), query.Get("name")); err != nil {
+			writeError(w, parameterTemplateStatus(err, http.StatusConflict), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleAttachments lists cluster bindings on GET, binds a cluster on POST and
+// unbinds ?cluster= on DELETE.
+func (h *ParameterTemplateHandler) HandleAttachments(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.service.ListAttachments(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var body struct {
+			Cluster  string `json:"cluster"`
+			Template string `json:"template"`
+			Actor    string `json:"actor"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		attachment, err := h.service.Attach(r.Context(), body.Cluster, body.Template, body.Actor)
+		if err != nil {
+			writeError(w, parameterTemplateStatus(err, http.StatusBadRequest), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, attachment)
+	case http.MethodDelete:
+		cluster := r.URL.Query().Get("cluster")
+		if strings.TrimSpace(cluster) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("cluster 不能为空"))
+			return
+		}
+		if err := h.service.Detach(r.Context(), cluster); err != nil {
+			writeError(w, parameterTemplateStatus(err, http.StatusInternalServerError), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandlePlan previews a rollout of ?cluster= to ?version= (default latest) or,
+// with ?rollback=true, to the previous version.
+func (h *ParameterTemplateHandler) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	version, err := optionalPositiveInt(query.Get("version"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	plan, err := h.service.Plan(r.Context(), query.Get("cluster"), version, query.Get("rollback") == "true")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// HandleRollouts lists rollouts on GET (?cluster=, ?limit=) or returns ?id=;
+// POST starts one.
+func (h *ParameterTemplateHandler) HandleRollouts(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if id := strings.TrimSpace(query.Get("id")); id != "" {
+			rollout, err := h.service.Rollout(r.Context(), id)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, rollout)
+			return
+		}
+		limit, err := optionalPositiveInt(query.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.ListRollouts(r.Context(), query.Get("cluster"), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var req app.ParameterTemplateRolloutRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		h.startRollout(w, r, req)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleRollback rolls a cluster back to its previous template version, or
+// after a failed rollout to the version it was on.
+func (h *ParameterTemplateHandler) HandleRollback(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Cluster          string `json:"cluster"`
+		RestartConfirmed bool   `json:"restart_confirmed"`
+		Confirm          string `json:"confirm"`
+		Actor            string `json:"actor"`
+	}
+	if err := decodeStrictJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.startRollout(w, r, app.ParameterTemplateRolloutRequest{Cluster: body.Cluster, Rollback: true, RestartConfirmed: body.RestartConfirmed, Confirm: body.Confirm, Actor: body.Actor})
+}
+
+// HandleHistory returns the template changes of ?machine_id=&port=.
+func (h *ParameterTemplateHandler) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.available(w) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	port, err := strconv.Atoi(query.Get("port"))
+	if err != nil || port <= 0 || port > 65535 || strings.TrimSpace(query.Get("machine_id")) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("machine_id 与有效的 port 必填"))
+		return
+	}
+	limit, err := optionalPositiveInt(query.Get("limit"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	items, err := h.service.InstanceHistory(r.Context(), query.Get("machine_id"), port, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// startRollout stores the rollout and runs it in the background under a batch
+// parent task; every collect and apply task of the rollout is a child of it.
+func (h *ParameterTemplateHandler) startRollout(w http.ResponseWriter, r *http.Request, req app.ParameterTemplateRolloutRequest) {
+	rollout, err := h.service.StartRollout(r.Context(), req)
+	if errors.Is(err, app.ErrParameterTemplateRestartRequired) {
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "plan": rollout})
+		return
+	}
+	if err != nil {
+		writeError(w, parameterTemplateStatus(err, http.StatusBadRequest), err)
+		return
+	}
+	service := h.tasks.service
+	action := "发布"
+	if rollout.Rollback {
+		action = "回滚"
+	}
+	parent, err := service.CreateBatchTrackingTask(r.Context(), "mysql_parameter_template_rollout",
+		fmt.Sprintf("%s集群 %s 的参数模板 %s v%d", action, rollout.Cluster, rollout.Template, rollout.ToVersion), fmt.Sprintf("%d 个实例", len(rollout.Steps)))
+	if err == nil {
+		rollout.ParentTaskID = parent.Task.ID
+		_ = h.service.SetParentTask(r.Context(), rollout.ID, parent.Task.ID)
+	}
+	go func(rollout templatedomain.Rollout) {
+		runner := &parameterTemplateRunner{tasks: h.tasks, parentID: rollout.ParentTaskID}
+		finished, _ := h.service.RunRollout(context.Background(), rollout.ID, runner)
+		if rollout.ParentTaskID == "" {
+			return
+		}
+		failed := 0
+		for _, step := range finished.Steps {
+			if step.Status == templatedomain.StepFailed || (step.Status == templatedomain.StepSkipped && step.StartedAt == nil) {
+				failed++
+			}
+		}
+		_ = service.FinalizeBatchTrackingTask(context.Background(), rollout.ParentTaskID, runner.created, failed)
+	}(rollout)
+	writeJSON(w, http.StatusAccepted, rollout)
+}
+
+// parameterTemplateRunner runs rollout steps through the MySQL parameter task.
+type parameterTemplateRunner struct {
+	tasks    *TaskHandler
+	parentID string
+	created  int
+}
+
+func (r *parameterTemplateRunner) Collect(ctx context.Context, step templatedomain.RolloutStep) (string, map[string]string, error) {
+	detail, err := r.tasks.createMySQLParameterTask(ctx, mysqlParameterTargetRequest{Machine: step.MachineID, Port: step.Port}, nil, false, "collect")
+	if err != nil {
+		return "", nil, err
+	}
+	finished, err := r.wait(ctx, detail.Task.ID, 5*time.Minute)
+	if err != nil {
+		return detail.Task.ID, nil, err
+	}
+	values := mysqlParameterCollectedValues(finished)
+	if len(values) == 0 {
+		return detail.Task.ID, nil, errors.New("采集任务没有返回运行参数")
+	}
+	return detail.Task.ID, values, nil
+}
+
+func (r *parameterTemplateRunner) Apply(ctx context.Context, step templatedomain.RolloutStep, changes []templatedomain.Change, restart bool) (string, error) {
+	requests := make([]mysqlParameterChangeRequest, 0, len(changes))
+	for _, change := range changes {
+		requests = append(requests, mysqlParameterChangeRequest{Action: "update", Name: change.Name, Value: change.To})
+	}
+	detail, err := r.tasks.createMySQLParameterTask(ctx, mysqlParameterTargetRequest{Machine: step.MachineID, Port: step.Port}, requests, restart, "apply")
+	if err != nil {
+		return "", err
+	}
+	_, err = r.wait(ctx, detail.Task.ID, 10*time.Minute)
+	return detail.Task.ID, err
+}
+
+func (r *parameterTemplateRunner) wait(ctx context.Context, taskID string, timeout time.Duration) (app.TaskDetail, error) {
+	r.created++
+	if r.parentID != "" {
+		_ = r.tasks.service.AttachChildTasks(ctx, r.parentID, []string{taskID})
+	}
+	finished, err := r.tasks.service.WaitForTask(ctx, taskID, timeout)
+	if err != nil {
+		return finished, err
+	}
+	if finished.Task.Status != taskdomain.StatusSuccess {
+		return finished, fmt.Errorf("任务 %s 失败：%s", taskID, automationTaskFailure(finished))
+	}
+	return finished, nil
+}
+
+// mysqlParameterCollectedValues parses the GMHA_MYSQL_PARAMETER lines of a
+// collect task into lower-case variable names and values.
+func mysqlParameterCollectedValues(detail app.TaskDetail) map[string]string {
+	values := make(map[string]string)
+	parse := func(content string) {
+		for _, line := range strings.Split(content, "\n") {
+			index := strings.Index(line, "GMHA_MYSQL_PARAMETER\t")
+			if index < 0 {
+				continue
+			}
+			parts := strings.Split(strings.TrimRight(line[index:], "\r"), "\t")
+			if len(parts) >= 3 && strings.TrimSpace(parts[1]) != "" {
+				values[strings.ToLower(strings.TrimSpace(parts[1]))] = parts[2]
+			}
+		}
+	}
+	for _, event := range detail.Events {
+		parse(event.Content)
+	}
+	for _, step := range detail.Steps {
+		parse(step.Message)
+	}
+	return values
+}
+
+func parameterTemplateStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, app.ErrParameterTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, app.ErrParameterTemplateRolloutActive):
+		return http.StatusConflict
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gmha/internal/app"
+	proxysqldomain "gmha/internal/domain/proxysql"
+)
+
+type ProxySQLHandler struct{ service *app.ProxySQLService }
+
+func NewProxySQLHandler(service *app.ProxySQLService) *ProxySQLHandler {
+	return &ProxySQLHandler{service: service}
+}
+
+func (h *ProxySQLHandler) HandleCluster(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"), "/"), "/")
+	if len(parts) < 2 || parts[1] != "proxysql" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid ProxySQL path"))
+		return
+	}
+	cluster := parts[0]
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	switch action {
+	case "":
+		h.handleConfig(w, r, cluster)
+	case "deploy":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var req app.ProxySQLDeployRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		task, err := h.service.Deploy(r.Context(), cluster, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, task)
+	case "sync":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		event, err := h.service.SyncNow(r.Context(), cluster)
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": err.Error(), "event": event})
+			return
+		}
+		writeJSON(w, http.StatusOK, event)
+	case "health":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		report, err := h.service.Health(r.Context(), cluster)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	case "events":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		items, err := h.service.ListSyncEvents(r.Context(), cluster, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "total": len(items)})
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown ProxySQL action"))
+	}
+}
+
+func (h *ProxySQLHandler) handleConfig(w http.ResponseWriter, r *http.Request, cluster string) {
+	switch r.Method {
+	case http.MethodGet:
+		config, ok, err := h.service.GetConfig(r.Context(), cluster)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.New("集群尚未配置 ProxySQL"))
+			return
+		}
+		writeJSON(w, http.StatusOK, config)
+	case http.MethodPut, http.MethodPost:
+		var config proxysqldomain.Config
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		config.ClusterID = cluster
+		saved, err := h.service.SaveConfig(r.Context(), config)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, saved)
+	case http.MethodDelete:
+		if err := h.service.DeleteConfig(r.Context(), cluster); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"cluster_id": cluster})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
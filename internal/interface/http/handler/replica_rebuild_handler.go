@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gmha/internal/app"
+)
+
+type ReplicaRebuildHandler struct{ service *app.ReplicaRebuildService }
+
+func NewReplicaRebuildHandler(service *app.ReplicaRebuildService) *ReplicaRebuildHandler {
+	return &ReplicaRebuildHandler{service: service}
+}
+
+// HandleCluster 处理 /api/v1/clusters/{name}/replicas/rebuild[/plan]：plan 只做探测与
+// donor 选择，不带 plan 时按同样的计划启动重建。
+func (h *ReplicaRebuildHandler) HandleCluster(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/clusters/"), "/"), "/")
+	if len(parts) < 3 || parts[1] != "replicas" || parts[2] != "rebuild" {
+		writeError(w, http.StatusBadRequest, errors.New("invalid replica rebuild path"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req app.ReplicaRebuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cluster := parts[0]
+	switch {
+	case len(parts) == 4 && parts[3] == "plan":
+		plan, err := h.service.Plan(r.Context(), cluster, req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+	case len(parts) == 3:
+		result, err := h.service.Rebuild(r.Context(), cluster, req)
+		if err != nil {
+			if len(result.Plan.Steps) > 0 {
+				writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "plan": result.Plan})
+				return
+			}
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, result)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("unknown replica rebuild action"))
+	}
+}
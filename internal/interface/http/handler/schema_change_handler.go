@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gmha/internal/app"
+	changedomain "gmha/internal/domain/schemachange"
+	taskdomain "gmha/internal/domain/task"
+)
+
+// schemaChangeBody is the editable part of a change request. The gates have
+// the same names and defaults as /api/v1/tasks/mysql-online-ddl.
+type schemaChangeBody struct {
+	Title                  string  `json:"title"`
+	Machine                string  `json:"machine"`
+	Port                   int     `json:"port"`
+	Schema                 string  `json:"schema"`
+	Table                  string  `json:"table"`
+	Alter                  string  `json:"alter"`
+	Purpose                string  `json:"purpose"`
+	Impact                 string  `json:"impact"`
+	MaxLoadThreadsRunning  int     `json:"max_load_threads_running"`
+	CriticalThreadsRunning int     `json:"critical_threads_running"`
+	MaxLagSeconds          int     `json:"max_lag_seconds"`
+	ChunkTimeSeconds       float64 `json:"chunk_time_seconds"`
+	CheckIntervalSeconds   int     `json:"check_interval_seconds"`
+	AlterForeignKeysMethod string  `json:"alter_foreign_keys_method"`
+	Actor                  string  `json:"actor"`
+}
+
+type schemaChangeReviewBody struct {
+	Actor       string    `json:"actor"`
+	Comment     string    `json:"comment"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+}
+
+type SchemaChangeHandler struct {
+	service *app.SchemaChangeService
+	tasks   *app.TaskService
+}
+
+func NewSchemaChangeHandler(service *app.SchemaChangeService, tasks *app.TaskService) *SchemaChangeHandler {
+	return &SchemaChangeHandler{service: service, tasks: tasks}
+}
+
+func (h *SchemaChangeHandler) HandleChanges(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil || h.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema change service is unavailable"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		limit, err := optionalPositiveInt(query.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.List(r.Context(), query.Get("cluster"), query.Get("status"), limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		draft, err := h.decodeDraft(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item, err := h.service.Create(r.Context(), draft)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, item)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleChangeByID serves GET/PUT on /api/v1/schema-changes/{id} and the
+// workflow actions POST /api/v1/schema-changes/{id}/{submit|approve|reject|schedule}.
+func (h *SchemaChangeHandler) HandleChangeByID(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil || h.tasks == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema change service is unavailable"))
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/schema-changes/"), "/"), "/")
+	id, err := url.PathUnescape(parts[0])
+	if err != nil || strings.TrimSpace(id) == "" || len(parts) > 2 {
+		writeError(w, http.StatusBadRequest, errors.New("变更单 ID 不正确"))
+		return
+	}
+	var item changedomain.Request
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		var ok bool
+		item, ok, err = h.service.Get(r.Context(), id)
+		if err == nil && !ok {
+			err = app.ErrSchemaChangeNotFound
+		}
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var draft app.SchemaChangeDraft
+		if draft, err = h.decodeDraft(r); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item, err = h.service.Update(r.Context(), id, draft)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var body schemaChangeReviewBody
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		review := app.SchemaChangeReview{Actor: body.Actor, Comment: body.Comment, WindowStart: body.WindowStart, WindowEnd: body.WindowEnd}
+		switch parts[1] {
+		case "submit":
+			item, err = h.service.Submit(r.Context(), id, body.Actor)
+		case "approve":
+			item, err = h.service.Approve(r.Context(), id, review)
+		case "reject":
+			item, err = h.service.Reject(r.Context(), id, review)
+		case "schedule":
+			item, err = h.service.Schedule(r.Context(), id, review)
+		default:
+			writeError(w, http.StatusNotFound, errors.New("不支持的变更单操作"))
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, app.ErrSchemaChangeNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, item)
+	}
+}
+
+// decodeDraft validates the change like the online DDL task endpoint and
+// builds both of its command sets. The execute commands carry the risk
+// acknowledgement on behalf of the approval, which is checked by the service
+// before they can run.
+func (h *SchemaChangeHandler) decodeDraft(r *http.Request) (app.SchemaChangeDraft, error) {
+	var body schemaChangeBody
+	if err := decodeStrictJSON(r, &body); err != nil {
+		return app.SchemaChangeDraft{}, err
+	}
+	req := normalizeMySQLOnlineDDLRequest(mysqlOnlineDDLTaskRequest{
+		Machine: body.Machine, Port: body.Port, Action: "dry_run", Schema: body.Schema, Table: body.Table,
+		Alter: body.Alter, Purpose: body.Purpose, Impact: body.Impact,
+		MaxLoadThreadsRunning: body.MaxLoadThreadsRunning, CriticalThreadsRunning: body.CriticalThreadsRunning,
+		MaxLagSeconds: body.MaxLagSeconds, ChunkTimeSeconds: body.ChunkTimeSeconds,
+		CheckIntervalSeconds: body.CheckIntervalSeconds, AlterForeignKeysMethod: body.AlterForeignKeysMethod,
+	})
+	if req.Machine == "" || req.Port <= 0 || req.Port > 65535 {
+		return app.SchemaChangeDraft{}, errors.New("machine and valid port are required")
+	}
+	if err := validateMySQLOnlineDDLRequest(req); err != nil {
+		return app.SchemaChangeDraft{}, err
+	}
+	dryRun, execute, err := h.schemaChangeCommands(r.Context(), req)
+	if err != nil {
+		return app.SchemaChangeDraft{}, err
+	}
+	return app.SchemaChangeDraft{
+		Title: body.Title, MachineID: req.Machine, Port: req.Port, Schema: req.Schema, Table: req.Table,
+		Alter: req.Alter, Purpose: req.Purpose, Impact: req.Impact, Actor: body.Actor,
+		Options: changedomain.Options{
+			MaxLoadThreadsRunning: req.MaxLoadThreadsRunning, CriticalThreadsRunning: req.CriticalThreadsRunning,
+			MaxLagSeconds: req.MaxLagSeconds, ChunkTimeSeconds: req.ChunkTimeSeconds,
+			CheckIntervalSeconds: req.CheckIntervalSeconds, AlterForeignKeysMethod: req.AlterForeignKeysMethod,
+		},
+		DryRunCommands: dryRun, ExecuteCommands: execute,
+	}, nil
+}
+
+func (h *SchemaChangeHandler) schemaChangeCommands(ctx context.Context, req mysqlOnlineDDLTaskRequest) ([]taskdomain.ExecCommandStep, []taskdomain.ExecCommandStep, error) {
+	_, instance, err := h.tasks.ResolveMySQLInstance(ctx, req.Machine, req.Port)
+	if err != nil {
+		return nil, nil, err
+	}
+	dryRun, _, err := mysqlOnlineDDLTaskCommands(instance.BaseDir, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Action, req.RiskAcknowledged, req.Confirmation = "execute", true, req.Schema+"."+req.Table
+	execute, _, err := mysqlOnlineDDLTaskCommands(instance.BaseDir, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dryRun, execute, nil
+}
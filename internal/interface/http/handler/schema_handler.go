@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gmha/internal/app"
+)
+
+type SchemaHandler struct {
+	service *app.SchemaService
+}
+
+func NewSchemaHandler(service *app.SchemaService) *SchemaHandler {
+	return &SchemaHandler{service: service}
+}
+
+func (h *SchemaHandler) HandleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema snapshot service is unavailable"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		port, err := optionalPositiveInt(query.Get("port"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit, err := optionalPositiveInt(query.Get("limit"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		items, err := h.service.ListSnapshots(r.Context(), query.Get("cluster"), query.Get("machine_id"), port, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost:
+		var body struct {
+			MachineID string `json:"machine_id"`
+			Port      int    `json:"port"`
+		}
+		if err := decodeStrictJSON(r, &body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		snapshot, err := h.service.Snapshot(r.Context(), body.MachineID, body.Port)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshot)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *SchemaHandler) HandleSnapshotByID(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema snapshot service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := url.PathUnescape(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/mysql/schema-snapshots/"), "/"))
+	if err != nil || strings.TrimSpace(id) == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusBadRequest, errors.New("结构快照 ID 不正确"))
+		return
+	}
+	snapshot, ok, err := h.service.GetSnapshot(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("结构快照不存在"))
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// HandleDiff returns the diff as JSON, or only the reconcile script with
+// ?format=sql.
+func (h *SchemaHandler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema snapshot service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format != "" && format != "json" && format != "sql" {
+		writeError(w, http.StatusBadRequest, errors.New("format 仅支持 json 或 sql"))
+		return
+	}
+	var body app.SchemaDiffRequest
+	if err := decodeStrictJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Diff(r.Context(), body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if format == "sql" {
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="schema-reconcile-`+url.PathEscape(result.Target.ID)+`.sql"`)
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, result.Script)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *SchemaHandler) HandleDrift(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("schema snapshot service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	items, err := h.service.Drift(r.Context(), r.URL.Query().Get("cluster"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
@@ -226,14 +226,18 @@ func (h *SQLDiagnosticHandler) HandleKillAudits(w http.ResponseWriter, r *http.R
 	}
 	cluster := strings.TrimSpace(r.URL.Query().Get("cluster"))
 	machine := strings.TrimSpace(r.URL.Query().Get("machine"))
+	policyID := strings.TrimSpace(r.URL.Query().Get("policy_id"))
 	port, err := optionalPositiveInt(r.URL.Query().Get("port"))
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	if cluster != "" || machine != "" || port > 0 {
+	if cluster != "" || machine != "" || port > 0 || policyID != "" {
 		filtered := items[:0]
 		for _, item := range items {
+			if policyID != "" && item.PolicyID != policyID {
+				continue
+			}
 			if cluster != "" && !strings.EqualFold(item.Instance.Cluster, cluster) {
 				continue
 			}
@@ -253,6 +257,286 @@ func (h *SQLDiagnosticHandler) HandleKillAudits(w http.ResponseWriter, r *http.R
 	writeJSON(w, http.StatusOK, map[string]any{"start": start, "end": end, "items": items})
 }
 
+func (h *SQLDiagnosticHandler) HandleKillPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		items, err := h.service.KillPolicies(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items})
+	case http.MethodPost, http.MethodPut:
+		var policy sqldomain.KillPolicy
+		if err := decodeStrictJSON(r, &policy); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.Method == http.MethodPost {
+			policy.ID = ""
+		} else if id := strings.TrimSpace(r.URL.Query().Get("id")); id != "" {
+			policy.ID = id
+		}
+		if r.Method == http.MethodPut && strings.TrimSpace(policy.ID) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("id is required"))
+			return
+		}
+		saved, err := h.service.SaveKillPolicy(r.Context(), policy)
+		if err != nil {
+			writeKillPolicyError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, saved)
+	case http.MethodDelete:
+		if err := h.service.DeleteKillPolicy(r.Context(), r.URL.Query().Get("id")); err != nil {
+			writeKillPolicyError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeKillPolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, app.ErrSQLKillPolicyInvalid):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, app.ErrSQLKillPolicyNotFound):
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func (h *SQLDiagnosticHandler) HandleRegressions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req app.SQLRegressionQuery
+	if err := decodeStrictJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Regressions(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, app.ErrSQLRegressionInvalid) {
+			writeError(w, http.StatusBadRequest, err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *SQLDiagnosticHandler) HandleIndexAdvice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query, err := diagnosticHistoryQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req := app.SQLIndexAdviceQuery{
+		Start: query.Start, End: query.End, Cluster: query.Cluster, Machine: query.Machine,
+		Port: query.Port, Database: query.Database, Limit: query.Limit,
+	}
+	values := r.URL.Query()
+	if raw := strings.TrimSpace(values.Get("min_executions")); raw != "" {
+		if req.MinExecutions, err = strconv.ParseUint(raw, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("min_executions must be a non-negative integer"))
+			return
+		}
+	}
+	if raw := strings.TrimSpace(values.Get("min_rows_examined")); raw != "" {
+		if req.MinRowsExaminedPerCall, err = strconv.ParseFloat(raw, 64); err != nil || req.MinRowsExaminedPerCall < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("min_rows_examined must be a non-negative number"))
+			return
+		}
+	}
+	if raw := strings.TrimSpace(values.Get("min_table_rows")); raw != "" {
+		if req.MinTableRows, err = strconv.ParseInt(raw, 10, 64); err != nil || req.MinTableRows < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("min_table_rows must be a non-negative integer"))
+			return
+		}
+	}
+	result, err := h.service.IndexAdvice(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, app.ErrSQLIndexAdviceInvalid) {
+			writeError(w, http.StatusBadRequest, err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// HandleSlowLogIngest receives slow log file batches from Agents. A 409
+// response carries the stored cursor so the Agent can re-seek.
+func (h *SQLDiagnosticHandler) HandleSlowLogIngest(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("sql diagnostic service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var batch sqldomain.SlowLogBatch
+	if err := decodeStrictJSONLimit(r, &batch, 8<<20); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.IngestSlowLog(r.Context(), batch)
+	switch {
+	case errors.Is(err, app.ErrSlowLogCursorConflict):
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "cursor": result.Cursor})
+	case errors.Is(err, app.ErrSlowLogBatchInvalid):
+		writeError(w, http.StatusBadRequest, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func (h *SQLDiagnosticHandler) HandleSlowLogCursor(w http.ResponseWriter, r *http.Request) {
+	if h.service == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("sql diagnostic service is unavailable"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	port, err := optionalPositiveInt(r.URL.Query().Get("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cursor, found, err := h.service.SlowLogCursor(r.Context(), r.URL.Query().Get("machine_id"), port)
+	if err != nil {
+		if errors.Is(err, app.ErrSlowLogBatchInvalid) {
+			writeError(w, http.StatusBadRequest, err)
+		} else {
+			writeError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"found": found, "cursor": cursor})
+}
+
+func (h *SQLDiagnosticHandler) HandleLocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	port, err := optionalPositiveInt(r.URL.Query().Get("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Locks(r.Context(), r.URL.Query().Get("cluster"), r.URL.Query().Get("machine"), port)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *SQLDiagnosticHandler) HandleLockHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	start, end, err := diagnosticTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	port, err := optionalPositiveInt(r.URL.Query().Get("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.LockHistory(r.Context(), start, end, r.URL.Query().Get("cluster"), r.URL.Query().Get("machine"), port)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *SQLDiagnosticHandler) HandleDeadlocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	start, end, err := diagnosticTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	port, err := optionalPositiveInt(r.URL.Query().Get("port"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.Deadlocks(r.Context(), start, end, r.URL.Query().Get("cluster"), r.URL.Query().Get("machine"), port)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *SQLDiagnosticHandler) HandleKillRootBlocker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		MachineID        string `json:"machine_id"`
+		Port             int    `json:"port"`
+		ProcessID        uint64 `json:"process_id"`
+		ExpectedThreadID uint64 `json:"expected_thread_id"`
+		ExpectedTrxID    string `json:"expected_trx_id"`
+		Confirmation     string `json:"confirmation"`
+		Reason           string `json:"reason"`
+	}
+	if err := decodeStrictJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := h.service.KillRootBlocker(r.Context(), app.KillRootBlockerRequest{
+		MachineID: req.MachineID, Port: req.Port, ProcessID: req.ProcessID,
+		ExpectedThreadID: req.ExpectedThreadID, ExpectedTrxID: req.ExpectedTrxID,
+		Confirmation: req.Confirmation, Reason: req.Reason,
+		RequestSource: diagnosticRequestSource(r),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, app.ErrSQLDiagnosticConflict):
+			writeError(w, http.StatusConflict, err)
+		case errors.Is(err, app.ErrSQLDiagnosticForbidden):
+			writeError(w, http.StatusForbidden, err)
+		default:
+			writeError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
 func diagnosticHistoryQuery(r *http.Request) (app.SQLDiagnosticHistoryQuery, error) {
 	start, end, err := diagnosticTimeRange(r)
 	if err != nil {
@@ -317,7 +601,11 @@ func optionalPositiveInt(raw string) (int, error) {
 }
 
 func decodeStrictJSON(r *http.Request, target any) error {
-	decoder := json.NewDecoder(http.MaxBytesReader(nilResponseWriter{}, r.Body, 1<<20))
+	return decodeStrictJSONLimit(r, target, 1<<20)
+}
+
+func decodeStrictJSONLimit(r *http.Request, target any, limit int64) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nilResponseWriter{}, r.Body, limit))
 	decoder.DisallowUnknownFields()
 	if err := decoder.Decode(target); err != nil {
 		return err
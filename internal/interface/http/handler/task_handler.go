@@ -9,7 +9,6 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -316,33 +315,35 @@ type mysqlArchiveTaskRequest struct {
 }
 
 type createMySQLInstallTaskRequest struct {
-	Machine           string                      `json:"machine"`
-	Port              int                         `json:"port"`
-	ServerID          int                         `json:"server_id"`
-	MySQLUser         string                      `json:"mysql_user"`
-	InstanceDir       string                      `json:"instance_dir"`
-	DataDir           string                      `json:"data_dir"`
-	BinlogDir         string                      `json:"binlog_dir"`
-	RedoDir           string                      `json:"redo_dir"`
-	UndoDir           string                      `json:"undo_dir"`
-	TmpDir            string                      `json:"tmp_dir"`
-	BaseDir           string                      `json:"base_dir"`
-	MyCnfPath         string                      `json:"my_cnf_path"`
-	SocketPath        string                      `json:"socket_path"`
-	ErrorLog          string                      `json:"error_log"`
-	PIDFile           string                      `json:"pid_file"`
-	CharacterSetsDir  string                      `json:"character_sets_dir"`
-	PluginDir         string                      `json:"plugin_dir"`
-	RootPassword      string                      `json:"root_password"`
-	Profile           string                      `json:"profile"`
-	PackageName       string                      `json:"package_name"`
-	Version           string                      `json:"version"`
-	Architecture      string                      `json:"architecture"`
-	InstallPTTools    bool                        `json:"install_pt_tools"`
-	InstallXtraBackup bool                        `json:"install_xtrabackup"`
-	MemoryAllocator   string                      `json:"memory_allocator"`
-	RuntimeParameters map[string]string           `json:"runtime_parameters"`
-	Accounts          []createMySQLAccountRequest `json:"accounts"`
+	Machine                string                      `json:"machine"`
+	Port                   int                         `json:"port"`
+	ServerID               int                         `json:"server_id"`
+	MySQLUser              string                      `json:"mysql_user"`
+	InstanceDir            string                      `json:"instance_dir"`
+	DataDir                string                      `json:"data_dir"`
+	BinlogDir              string                      `json:"binlog_dir"`
+	RedoDir                string                      `json:"redo_dir"`
+	UndoDir                string                      `json:"undo_dir"`
+	TmpDir                 string                      `json:"tmp_dir"`
+	BaseDir                string                      `json:"base_dir"`
+	MyCnfPath              string                      `json:"my_cnf_path"`
+	SocketPath             string                      `json:"socket_path"`
+	ErrorLog               string                      `json:"error_log"`
+	PIDFile                string                      `json:"pid_file"`
+	CharacterSetsDir       string                      `json:"character_sets_dir"`
+	PluginDir              string                      `json:"plugin_dir"`
+	RootPassword           string                      `json:"root_password"`
+	Profile                string                      `json:"profile"`
+	PackageName            string                      `json:"package_name"`
+	Version                string                      `json:"version"`
+	Architecture           string                      `json:"architecture"`
+	InstallPTTools         bool                        `json:"install_pt_tools"`
+	InstallXtraBackup      bool                        `json:"install_xtrabackup"`
+	MemoryAllocator        string                      `json:"memory_allocator"`
+	RuntimeParameters      map[string]string           `json:"runtime_parameters"`
+	Accounts               []createMySQLAccountRequest `json:"accounts"`
+	EnableTLS              bool                        `json:"enable_tls"`
+	RequireSecureTransport bool                        `json:"require_secure_transport"`
 }
 
 type createMySQLUninstallTaskRequest struct {
@@ -418,32 +419,34 @@ type createMySQLTopologyNodeRequest struct {
 }
 
 type createClusterMySQLInstallTaskRequest struct {
-	Cluster           string                      `json:"cluster"`
-	Port              int                         `json:"port"`
-	ServerIDStart     int                         `json:"server_id_start"`
-	MySQLUser         string                      `json:"mysql_user"`
-	InstanceDir       string                      `json:"instance_dir"`
-	DataDir           string                      `json:"data_dir"`
-	BinlogDir         string                      `json:"binlog_dir"`
-	RedoDir           string                      `json:"redo_dir"`
-	UndoDir           string                      `json:"undo_dir"`
-	TmpDir            string                      `json:"tmp_dir"`
-	BaseDir           string                      `json:"base_dir"`
-	MyCnfPath         string                      `json:"my_cnf_path"`
-	SocketPath        string                      `json:"socket_path"`
-	ErrorLog          string                      `json:"error_log"`
-	PIDFile           string                      `json:"pid_file"`
-	CharacterSetsDir  string                      `json:"character_sets_dir"`
-	PluginDir         string                      `json:"plugin_dir"`
-	RootPassword      string                      `json:"root_password"`
-	Profile           string                      `json:"profile"`
-	Version           string                      `json:"version"`
-	Architecture      string                      `json:"architecture"`
-	InstallPTTools    bool                        `json:"install_pt_tools"`
-	InstallXtraBackup bool                        `json:"install_xtrabackup"`
-	MemoryAllocator   string                      `json:"memory_allocator"`
-	RuntimeParameters map[string]string           `json:"runtime_parameters"`
-	Accounts          []createMySQLAccountRequest `json:"accounts"`
+	Cluster                string                      `json:"cluster"`
+	Port                   int                         `json:"port"`
+	ServerIDStart          int                         `json:"server_id_start"`
+	MySQLUser              string                      `json:"mysql_user"`
+	InstanceDir            string                      `json:"instance_dir"`
+	DataDir                string                      `json:"data_dir"`
+	BinlogDir              string                      `json:"binlog_dir"`
+	RedoDir                string                      `json:"redo_dir"`
+	UndoDir                string                      `json:"undo_dir"`
+	TmpDir                 string                      `json:"tmp_dir"`
+	BaseDir                string                      `json:"base_dir"`
+	MyCnfPath              string                      `json:"my_cnf_path"`
+	SocketPath             string                      `json:"socket_path"`
+	ErrorLog               string                      `json:"error_log"`
+	PIDFile                string                      `json:"pid_file"`
+	CharacterSetsDir       string                      `json:"character_sets_dir"`
+	PluginDir              string                      `json:"plugin_dir"`
+	RootPassword           string                      `json:"root_password"`
+	Profile                string                      `json:"profile"`
+	Version                string                      `json:"version"`
+	Architecture           string                      `json:"architecture"`
+	InstallPTTools         bool                        `json:"install_pt_tools"`
+	InstallXtraBackup      bool                        `json:"install_xtrabackup"`
+	MemoryAllocator        string                      `json:"memory_allocator"`
+	RuntimeParameters      map[string]string           `json:"runtime_parameters"`
+	Accounts               []createMySQLAccountRequest `json:"accounts"`
+	EnableTLS              bool                        `json:"enable_tls"`
+	RequireSecureTransport bool                        `json:"require_secure_transport"`
 }
 
 type createMySQLAccountRequest struct {
@@ -1588,33 +1591,35 @@ func (h *TaskHandler) HandleCreateMySQLInstallTask(w http.ResponseWriter, r *htt
 		return
 	}
 	item, err := h.service.CreateMySQLInstallTask(r.Context(), taskusecase.CreateMySQLInstallTaskRequest{
-		Machine:           req.Machine,
-		Port:              req.Port,
-		ServerID:          req.ServerID,
-		MySQLUser:         req.MySQLUser,
-		InstanceDir:       req.InstanceDir,
-		DataDir:           req.DataDir,
-		BinlogDir:         req.BinlogDir,
-		RedoDir:           req.RedoDir,
-		UndoDir:           req.UndoDir,
-		TmpDir:            req.TmpDir,
-		BaseDir:           req.BaseDir,
-		MyCnfPath:         req.MyCnfPath,
-		SocketPath:        req.SocketPath,
-		ErrorLog:          req.ErrorLog,
-		PIDFile:           req.PIDFile,
-		CharacterSetsDir:  req.CharacterSetsDir,
-		PluginDir:         req.PluginDir,
-		RootPassword:      req.RootPassword,
-		Profile:           req.Profile,
-		PackageName:       req.PackageName,
-		Version:           req.Version,
-		Architecture:      req.Architecture,
-		InstallPTTools:    req.InstallPTTools,
-		InstallXtraBackup: req.InstallXtraBackup,
-		MemoryAllocator:   req.MemoryAllocator,
-		RuntimeParameters: req.RuntimeParameters,
-		Accounts:          mysqlAccountRequests(req.Accounts),
+		Machine:                req.Machine,
+		Port:                   req.Port,
+		ServerID:               req.ServerID,
+		MySQLUser:              req.MySQLUser,
+		InstanceDir:            req.InstanceDir,
+		DataDir:                req.DataDir,
+		BinlogDir:              req.BinlogDir,
+		RedoDir:                req.RedoDir,
+		UndoDir:                req.UndoDir,
+		TmpDir:                 req.TmpDir,
+		BaseDir:                req.BaseDir,
+		MyCnfPath:              req.MyCnfPath,
+		SocketPath:             req.SocketPath,
+		ErrorLog:               req.ErrorLog,
+		PIDFile:                req.PIDFile,
+		CharacterSetsDir:       req.CharacterSetsDir,
+		PluginDir:              req.PluginDir,
+		RootPassword:           req.RootPassword,
+		Profile:                req.Profile,
+		PackageName:            req.PackageName,
+		Version:                req.Version,
+		Architecture:           req.Architecture,
+		InstallPTTools:         req.InstallPTTools,
+		InstallXtraBackup:      req.InstallXtraBackup,
+		MemoryAllocator:        req.MemoryAllocator,
+		RuntimeParameters:      req.RuntimeParameters,
+		Accounts:               mysqlAccountRequests(req.Accounts),
+		EnableTLS:              req.EnableTLS,
+		RequireSecureTransport: req.RequireSecureTransport,
 	})
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
@@ -2264,11 +2269,10 @@ func mysqlDynamicParameterNameForVersion(name, version string) string {
 }
 
 func mysqlParameterCollectionSQL() string {
-	names := make([]string, 0, len(dynamicMySQLParameterNames))
-	for name := range dynamicMySQLParameterNames {
+	names := make([]string, 0)
+	for _, name := range mysqlapp.DynamicParameterNames() {
 		names = append(names, sqlString(name))
 	}
-	sort.Strings(names)
 	return "SELECT CONCAT('GMHA_MYSQL_PARAMETER\\t', IF(LOWER(VARIABLE_NAME)='tx_isolation','transaction_isolation',VARIABLE_NAME), '\\t', " +
 		"REPLACE(REPLACE(VARIABLE_VALUE, CHAR(10), '\\\\n'), CHAR(9), ' '), '\\t', " +
 		"IF(LOWER(VARIABLE_NAME) IN (" + strings.Join(names, ",") + "), 'dynamic', 'restart')) " +
@@ -2348,23 +2352,8 @@ func mysqlParameterBatchCommand(client string, target mysqlParameterTargetReques
 	return strings.Join(parts, " && "), nil
 }
 
-var dynamicMySQLParameterNames = map[string]struct{}{
-	"autocommit": {}, "binlog_expire_logs_seconds": {}, "expire_logs_days": {}, "binlog_format": {}, "connect_timeout": {}, "event_scheduler": {},
-	"general_log": {}, "general_log_file": {}, "group_concat_max_len": {}, "innodb_buffer_pool_size": {},
-	"innodb_flush_log_at_trx_commit": {}, "innodb_io_capacity": {}, "innodb_io_capacity_max": {}, "innodb_lock_wait_timeout": {},
-	"innodb_max_dirty_pages_pct": {}, "innodb_old_blocks_time": {}, "innodb_online_alter_log_max_size": {}, "innodb_print_all_deadlocks": {},
-	"innodb_purge_threads": {}, "innodb_read_io_threads": {}, "innodb_stats_on_metadata": {}, "innodb_write_io_threads": {},
-	"interactive_timeout": {}, "join_buffer_size": {}, "lock_wait_timeout": {}, "log_output": {}, "long_query_time": {},
-	"max_allowed_packet": {}, "max_connect_errors": {}, "max_connections": {}, "max_execution_time": {}, "max_heap_table_size": {},
-	"max_prepared_stmt_count": {}, "net_read_timeout": {}, "net_write_timeout": {}, "optimizer_switch": {}, "read_buffer_size": {},
-	"read_only": {}, "read_rnd_buffer_size": {}, "slow_query_log": {}, "sort_buffer_size": {}, "sql_mode": {},
-	"super_read_only": {}, "sync_binlog": {}, "table_definition_cache": {}, "table_open_cache": {}, "thread_cache_size": {},
-	"tmp_table_size": {}, "transaction_isolation": {}, "tx_isolation": {}, "wait_timeout": {},
-}
-
 func mysqlParameterIsDynamic(name string) bool {
-	_, ok := dynamicMySQLParameterNames[strings.ToLower(strings.TrimSpace(name))]
-	return ok
+	return mysqlapp.ParameterIsDynamic(name)
 }
 
 func (h *TaskHandler) HandleCreateMySQLUninstallTask(w http.ResponseWriter, r *http.Request) {
@@ -2428,7 +2417,7 @@ func (h *TaskHandler) HandleCreateClusterMySQLInstallTasks(w http.ResponseWriter
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	item, err := h.service.CreateClusterMySQLInstallTasks(r.Context(), app.ClusterMySQLInstallRequest{Cluster: req.Cluster, Port: req.Port, ServerIDStart: req.ServerIDStart, MySQLUser: req.MySQLUser, InstanceDir: req.InstanceDir, DataDir: req.DataDir, BinlogDir: req.BinlogDir, RedoDir: req.RedoDir, UndoDir: req.UndoDir, TmpDir: req.TmpDir, BaseDir: req.BaseDir, MyCnfPath: req.MyCnfPath, SocketPath: req.SocketPath, ErrorLog: req.ErrorLog, PIDFile: req.PIDFile, CharacterSetsDir: req.CharacterSetsDir, PluginDir: req.PluginDir, RootPassword: req.RootPassword, Profile: req.Profile, Version: req.Version, Architecture: req.Architecture, InstallPTTools: req.InstallPTTools, InstallXtraBackup: req.InstallXtraBackup, MemoryAllocator: req.MemoryAllocator, RuntimeParameters: req.RuntimeParameters, Accounts: mysqlAccountRequests(req.Accounts)})
+	item, err := h.service.CreateClusterMySQLInstallTasks(r.Context(), app.ClusterMySQLInstallRequest{Cluster: req.Cluster, Port: req.Port, ServerIDStart: req.ServerIDStart, MySQLUser: req.MySQLUser, InstanceDir: req.InstanceDir, DataDir: req.DataDir, BinlogDir: req.BinlogDir, RedoDir: req.RedoDir, UndoDir: req.UndoDir, TmpDir: req.TmpDir, BaseDir: req.BaseDir, MyCnfPath: req.MyCnfPath, SocketPath: req.SocketPath, ErrorLog: req.ErrorLog, PIDFile: req.PIDFile, CharacterSetsDir: req.CharacterSetsDir, PluginDir: req.PluginDir, RootPassword: req.RootPassword, Profile: req.Profile, Version: req.Version, Architecture: req.Architecture, InstallPTTools: req.InstallPTTools, InstallXtraBackup: req.InstallXtraBackup, MemoryAllocator: req.MemoryAllocator, RuntimeParameters: req.RuntimeParameters, Accounts: mysqlAccountRequests(req.Accounts), EnableTLS: req.EnableTLS, RequireSecureTransport: req.RequireSecureTransport})
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
@@ -1,12 +1,14 @@
 package handler
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"gmha/internal/app"
 	taskdomain "gmha/internal/domain/task"
 	mysqlapp "gmha/internal/mysql"
 )
@@ -832,3 +834,30 @@ func TestClusterAutomationRejectsOversizedOrBinaryShell(t *testing.T) {
 		})
 	}
 }
+
+func TestMySQLIndexAdviceDraftIsAcceptedByIndexTask(t *testing.T) {
+	draft := app.SQLIndexTaskDraft{
+		Machine: "machine-1", Port: 3306, Action: "create", Schema: "app", Table: "orders", Name: "idx_tenant_id_created_at",
+		Kind: "btree", Columns: []mysqlapp.IndexColumn{{Name: "tenant_id"}, {Name: "created_at", Direction: "DESC"}},
+		LockMode: "none", Purpose: "SQL 诊断索引建议", Impact: "预计索引约 12.0 MiB",
+	}
+	body, err := json.Marshal(draft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req mysqlIndexTaskRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateMySQLIndexRequest(req); err == nil || !strings.Contains(err.Error(), "acknowledgement") {
+		t.Fatalf("a draft must still require the lock acknowledgement, got %v", err)
+	}
+	req.LockAcknowledged = true
+	commands, _, err := mysqlIndexTaskCommands("/opt/mysql", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(commands[1].Command, "ADD INDEX `idx_tenant_id_created_at` (`tenant_id`, `created_at` DESC)") {
+		t.Fatalf("draft columns were not carried into the DDL: %s", commands[1].Command)
+	}
+}
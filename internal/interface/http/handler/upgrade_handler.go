@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -35,12 +36,18 @@ func (h *UpgradeHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"items": h.service.List()})
 }
 
+// HandleJob serves GET /api/v1/upgrades/{id} and the pause/resume actions of
+// batched Agent upgrades at POST /api/v1/upgrades/{id}/pause|resume.
 func (h *UpgradeHandler) HandleJob(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/upgrades/"), "/")
+	if action != "" {
+		h.handleJobAction(w, r, id, action)
+		return
+	}
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	id := strings.TrimPrefix(r.URL.Path, "/api/v1/upgrades/")
 	item, ok := h.service.Get(id)
 	if !ok {
 		writeError(w, http.StatusNotFound, http.ErrMissingFile)
@@ -55,14 +62,31 @@ func (h *UpgradeHandler) HandleAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var req struct {
-		PackageName string   `json:"package_name"`
-		Targets     []string `json:"targets"`
+		PackageName  string   `json:"package_name"`
+		Targets      []string `json:"targets"`
+		CanarySize   *int     `json:"canary_size"`
+		BatchSize    *int     `json:"batch_size"`
+		SoakSeconds  *int     `json:"soak_seconds"`
+		AutoRollback *bool    `json:"auto_rollback"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	item, err := h.service.StartAgentUpgrade(req.PackageName, req.Targets)
+	plan := app.DefaultAgentUpgradePlan()
+	if req.CanarySize != nil {
+		plan.CanarySize = *req.CanarySize
+	}
+	if req.BatchSize != nil {
+		plan.BatchSize = *req.BatchSize
+	}
+	if req.SoakSeconds != nil {
+		plan.SoakSeconds = *req.SoakSeconds
+	}
+	if req.AutoRollback != nil {
+		plan.AutoRollback = *req.AutoRollback
+	}
+	item, err := h.service.StartAgentUpgradePlan(req.PackageName, req.Targets, plan)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
@@ -70,6 +94,35 @@ func (h *UpgradeHandler) HandleAgent(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusAccepted, item)
 }
 
+func (h *UpgradeHandler) handleJobAction(w http.ResponseWriter, r *http.Request, id, action string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		item app.UpgradeJob
+		err  error
+	)
+	switch action {
+	case "pause":
+		item, err = h.service.PauseAgentUpgrade(id)
+	case "resume":
+		item, err = h.service.ResumeAgentUpgrade(id)
+	default:
+		writeError(w, http.StatusNotFound, http.ErrMissingFile)
+		return
+	}
+	if errors.Is(err, app.ErrUpgradeJobNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
 func (h *UpgradeHandler) HandleManager(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
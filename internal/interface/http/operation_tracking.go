@@ -102,7 +102,7 @@ func isMutatingMethod(method string) bool {
 }
 
 func isSystemMutation(path string) bool {
-	return path == "/api/v1/agents/register" || path == "/api/v1/agents/heartbeat" || path == "/api/v1/tasks/cluster-automation/report" || path == "/api/v1/tasks" || path == "/api/v1/machines/batch-delete"
+	return path == "/api/v1/agents/register" || path == "/api/v1/agents/heartbeat" || path == "/api/v1/sql-diagnostics/slow-log/ingest" || path == "/api/v1/baseline/report" || path == "/api/v1/mysql/config-drift/report" || path == "/api/v1/tasks/cluster-automation/report" || path == "/api/v1/tasks" || path == "/api/v1/machines/batch-delete"
 }
 
 func platformOperationMetadata(method, path string) (string, string, string) {
@@ -112,7 +112,7 @@ func platformOperationMetadata(method, path string) (string, string, string) {
 		{"upgrades/manager", "升级 Manager"}, {"upgrades/agent", "按版本升级 Agent"},
 		{"retry-install", "重试安装 Agent"}, {"repair-mysql-config", "修复 Agent MySQL 配置"}, {"agents/upgrade", "升级 Agent"}, {"agents/uninstall", "卸载 Agent"}, {"agents/recover", "恢复 Agent"},
 		{"mysql-install", "部署 MySQL"}, {"mysql-uninstall", "卸载 MySQL"}, {"mysql-cluster-upgrade", "MySQL 集群滚动升级"}, {"mysql-upgrade", "升级 MySQL"}, {"mysql-parameters", "维护 MySQL 参数"}, {"mysql-topology", "调整 MySQL 拓扑"},
-		{"backup", "备份与恢复操作"}, {"architecture", "调整集群架构"}, {"failover", "集群故障切换"}, {"/vip/", "维护集群 VIP"},
+		{"backup", "备份与恢复操作"}, {"architecture", "调整集群架构"}, {"failover", "集群故障切换"}, {"/vip/", "维护集群 VIP"}, {"cluster-specs/plan", "生成集群规格计划"}, {"cluster-specs/apply", "应用集群规格"}, {"baseline/profiles", "维护主机基线"}, {"baseline/remediate", "修复主机基线"}, {"config-drift/desired", "维护 MySQL 期望参数"}, {"config-drift/reconcile", "对齐 MySQL 配置漂移"}, {"parameter-templates/attachments", "关联 MySQL 参数模板"}, {"parameter-templates/rollouts", "发布 MySQL 参数模板"}, {"parameter-templates/rollback", "回滚 MySQL 参数模板"}, {"parameter-templates", "维护 MySQL 参数模板"}, {"credential-rotations/retry", "重试 MySQL 账号密码轮换"}, {"credential-rotations/rollback", "回滚 MySQL 账号密码轮换"}, {"credential-rotations/schedule", "维护 MySQL 密码轮换计划"}, {"credential-rotations", "轮换 MySQL 账号密码"}, {"account-inventory/sync", "同步 MySQL 从库账号"}, {"account-inventory", "采集 MySQL 账号清单"},
 		{"machines", "维护机器资源"}, {"ssh-credentials", "维护 SSH 凭证"}, {"clusters", "维护集群"}, {"packages", "维护安装包"},
 		{"manager", "维护 Manager"}, {"dynamic-collect", "维护动态采集配置"}, {"account-presets", "维护 MySQL 账号预设"}, {"mysql/instances", "维护 MySQL 实例"},
 	}
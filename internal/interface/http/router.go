@@ -27,6 +27,14 @@ func NewRouter(core *app.App) http.Handler {
 	agentHandler := handler.NewAgentHandler(core.AgentService, core.RecoveryService)
 	mysqlHandler := handler.NewMySQLHandler(core.MySQLService, core.HistogramService)
 	binlogAnalysisHandler := handler.NewBinlogAnalysisHandler(core.BinlogAnalysisService)
+	schemaHandler := handler.NewSchemaHandler(core.SchemaService)
+	schemaChangeHandler := handler.NewSchemaChangeHandler(core.SchemaChangeService, core.TaskService)
+	capacityHandler := handler.NewCapacityHandler(core.CapacityService)
+	baselineHandler := handler.NewBaselineHandler(core.BaselineService)
+	configDriftHandler := handler.NewConfigDriftHandler(core.ConfigDriftService, core.TaskService)
+	parameterTemplateHandler := handler.NewParameterTemplateHandler(core.ParameterTemplateService, core.TaskService)
+	credentialRotationHandler := handler.NewCredentialRotationHandler(core.CredentialRotationService)
+	accountInventoryHandler := handler.NewAccountInventoryHandler(core.AccountInventoryService)
 	taskHandler := handler.NewTaskHandler(core.TaskService)
 	clusterUpgradeHandler := handler.NewClusterUpgradeHandler(core.ClusterUpgradeService)
 	packageHandler := handler.NewPackageHandler(core.PackageService)
@@ -39,6 +47,11 @@ func NewRouter(core *app.App) http.Handler {
 	performanceHandler := handler.NewPerformanceHandler(core.HeartbeatService)
 	flameGraphHandler := handler.NewFlameGraphHandler(core.FlameGraphService)
 	aiHandler := handler.NewAIHandler(core.AIService)
+	proxySQLHandler := handler.NewProxySQLHandler(core.ProxySQLService)
+	certificateHandler := handler.NewCertificateHandler(core.CertificateService)
+	drHandler := handler.NewDRHandler(core.DRService)
+	replicaRebuildHandler := handler.NewReplicaRebuildHandler(core.ReplicaRebuildService)
+	clusterSpecHandler := handler.NewClusterSpecHandler(core.ClusterSpecService)
 	mux.HandleFunc("/api/v1/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(`{"status":"ok"}`))
@@ -46,6 +59,9 @@ func NewRouter(core *app.App) http.Handler {
 	mux.HandleFunc("/api/v1/machines", machineHandler.HandleMachines)
 	mux.HandleFunc("/api/v1/machines/batch-delete", machineHandler.HandleBatchDeleteMachines)
 	mux.HandleFunc("/api/v1/machines/precheck", machineHandler.HandlePrecheck)
+	mux.HandleFunc("/api/v1/machines/discover", machineHandler.HandleDiscover)
+	mux.HandleFunc("/api/v1/machines/bulk-precheck", machineHandler.HandleBulkPrecheck)
+	mux.HandleFunc("/api/v1/machines/bulk-onboard", machineHandler.HandleBulkOnboard)
 	mux.HandleFunc("/api/v1/machines/cleanup", machineHandler.HandleCleanup)
 	mux.HandleFunc("/api/v1/manager/status", managerHandler.HandleStatus)
 	mux.HandleFunc("/api/v1/manager/config", managerHandler.HandleConfig)
@@ -71,6 +87,8 @@ func NewRouter(core *app.App) http.Handler {
 	mux.HandleFunc("/api/v1/ssh-credentials", machineHandler.HandleCredentials)
 	mux.HandleFunc("/api/v1/ssh-credentials/", machineHandler.HandleCredentialByID)
 	mux.HandleFunc("/api/v1/clusters", machineHandler.HandleClusters)
+	mux.HandleFunc("/api/v1/cluster-specs/plan", clusterSpecHandler.HandlePlan)
+	mux.HandleFunc("/api/v1/cluster-specs/apply", clusterSpecHandler.HandleApply)
 	mux.HandleFunc("/api/v1/clusters/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(strings.Trim(r.URL.Path, "/"), "/machines") {
 			machineHandler.HandleClusterMachines(w, r)
@@ -92,13 +110,65 @@ func NewRouter(core *app.App) http.Handler {
 			haHandler.HandleClusterActions(w, r)
 			return
 		}
+		if isProxySQLClusterPath(r.URL.Path) {
+			proxySQLHandler.HandleCluster(w, r)
+			return
+		}
+		if isTLSClusterPath(r.URL.Path) {
+			certificateHandler.HandleCluster(w, r)
+			return
+		}
+		if isReplicaRebuildClusterPath(r.URL.Path) {
+			replicaRebuildHandler.HandleCluster(w, r)
+			return
+		}
 		machineHandler.HandleClusterByName(w, r)
 	})
 	mux.HandleFunc("/api/v1/agents", agentHandler.HandleAgents)
+	mux.HandleFunc("/api/v1/tls/ca", certificateHandler.HandleAuthority)
+	mux.HandleFunc("/api/v1/dr-links", drHandler.HandleLinks)
+	mux.HandleFunc("/api/v1/dr-links/", drHandler.HandleLinkByID)
 	mux.HandleFunc("/api/v1/mysql/instances", mysqlHandler.HandleInstances)
 	mux.HandleFunc("/api/v1/mysql/histograms", mysqlHandler.HandleHistograms)
 	mux.HandleFunc("/api/v1/mysql/binlog-analysis", binlogAnalysisHandler.HandleCollection)
 	mux.HandleFunc("/api/v1/mysql/binlog-analysis/", binlogAnalysisHandler.HandleTask)
+	mux.HandleFunc("/api/v1/mysql/binlog-analysis-schedules", binlogAnalysisHandler.HandleSchedules)
+	mux.HandleFunc("/api/v1/mysql/binlog-analysis-schedules/", binlogAnalysisHandler.HandleScheduleByID)
+	mux.HandleFunc("/api/v1/mysql/binlog-analysis-trend", binlogAnalysisHandler.HandleTrend)
+	mux.HandleFunc("/api/v1/mysql/schema-snapshots", schemaHandler.HandleSnapshots)
+	mux.HandleFunc("/api/v1/mysql/schema-snapshots/", schemaHandler.HandleSnapshotByID)
+	mux.HandleFunc("/api/v1/mysql/schema-diff", schemaHandler.HandleDiff)
+	mux.HandleFunc("/api/v1/mysql/schema-drift", schemaHandler.HandleDrift)
+	mux.HandleFunc("/api/v1/schema-changes", schemaChangeHandler.HandleChanges)
+	mux.HandleFunc("/api/v1/schema-changes/", schemaChangeHandler.HandleChangeByID)
+	mux.HandleFunc("/api/v1/mysql/capacity-forecast", capacityHandler.HandleForecast)
+	mux.HandleFunc("/api/v1/mysql/table-growth", capacityHandler.HandleTableGrowth)
+	mux.HandleFunc("/api/v1/mysql/table-growth/history", capacityHandler.HandleHistory)
+	mux.HandleFunc("/api/v1/baseline/report", baselineHandler.HandleReport)
+	mux.HandleFunc("/api/v1/baseline/profiles", baselineHandler.HandleProfiles)
+	mux.HandleFunc("/api/v1/baseline/hosts", baselineHandler.HandleHosts)
+	mux.HandleFunc("/api/v1/baseline/hosts/", baselineHandler.HandleHostByID)
+	mux.HandleFunc("/api/v1/baseline/remediate", baselineHandler.HandleRemediate)
+	mux.HandleFunc("/api/v1/mysql/config-drift", configDriftHandler.HandleClusterReport)
+	mux.HandleFunc("/api/v1/mysql/config-drift/report", configDriftHandler.HandleReport)
+	mux.HandleFunc("/api/v1/mysql/config-drift/instance", configDriftHandler.HandleInstance)
+	mux.HandleFunc("/api/v1/mysql/config-drift/desired", configDriftHandler.HandleDesired)
+	mux.HandleFunc("/api/v1/mysql/config-drift/reconcile", configDriftHandler.HandleReconcile)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates", parameterTemplateHandler.HandleTemplates)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates/attachments", parameterTemplateHandler.HandleAttachments)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates/plan", parameterTemplateHandler.HandlePlan)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates/rollouts", parameterTemplateHandler.HandleRollouts)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates/rollback", parameterTemplateHandler.HandleRollback)
+	mux.HandleFunc("/api/v1/mysql/parameter-templates/history", parameterTemplateHandler.HandleHistory)
+	mux.HandleFunc("/api/v1/mysql/credential-rotations", credentialRotationHandler.HandleRotations)
+	mux.HandleFunc("/api/v1/mysql/credential-rotations/plan", credentialRotationHandler.HandlePlan)
+	mux.HandleFunc("/api/v1/mysql/credential-rotations/retry", credentialRotationHandler.HandleRetry)
+	mux.HandleFunc("/api/v1/mysql/credential-rotations/rollback", credentialRotationHandler.HandleRollback)
+	mux.HandleFunc("/api/v1/mysql/credential-rotations/schedule", credentialRotationHandler.HandleSchedule)
+	mux.HandleFunc("/api/v1/mysql/account-inventory", accountInventoryHandler.HandleInventory)
+	mux.HandleFunc("/api/v1/mysql/account-inventory/findings", accountInventoryHandler.HandleFindings)
+	mux.HandleFunc("/api/v1/mysql/account-inventory/compare", accountInventoryHandler.HandleCompare)
+	mux.HandleFunc("/api/v1/mysql/account-inventory/sync", accountInventoryHandler.HandleSync)
 	mux.HandleFunc("/api/v1/mysql/account-presets", mysqlHandler.HandleAccountPresets)
 	mux.HandleFunc("/api/v1/sql-diagnostics/config", sqlDiagnosticHandler.HandleConfig)
 	mux.HandleFunc("/api/v1/sql-diagnostics/explain", sqlDiagnosticHandler.HandleExplain)
@@ -108,6 +178,15 @@ func NewRouter(core *app.App) http.Handler {
 	mux.HandleFunc("/api/v1/sql-diagnostics/slow", sqlDiagnosticHandler.HandleSlow)
 	mux.HandleFunc("/api/v1/sql-diagnostics/kill", sqlDiagnosticHandler.HandleKill)
 	mux.HandleFunc("/api/v1/sql-diagnostics/kill-audits", sqlDiagnosticHandler.HandleKillAudits)
+	mux.HandleFunc("/api/v1/sql-diagnostics/kill-policies", sqlDiagnosticHandler.HandleKillPolicies)
+	mux.HandleFunc("/api/v1/sql-diagnostics/regressions", sqlDiagnosticHandler.HandleRegressions)
+	mux.HandleFunc("/api/v1/sql-diagnostics/index-advice", sqlDiagnosticHandler.HandleIndexAdvice)
+	mux.HandleFunc("/api/v1/sql-diagnostics/slow-log/ingest", sqlDiagnosticHandler.HandleSlowLogIngest)
+	mux.HandleFunc("/api/v1/sql-diagnostics/slow-log/cursor", sqlDiagnosticHandler.HandleSlowLogCursor)
+	mux.HandleFunc("/api/v1/sql-diagnostics/locks", sqlDiagnosticHandler.HandleLocks)
+	mux.HandleFunc("/api/v1/sql-diagnostics/locks/history", sqlDiagnosticHandler.HandleLockHistory)
+	mux.HandleFunc("/api/v1/sql-diagnostics/locks/kill-root", sqlDiagnosticHandler.HandleKillRootBlocker)
+	mux.HandleFunc("/api/v1/sql-diagnostics/deadlocks", sqlDiagnosticHandler.HandleDeadlocks)
 	mux.HandleFunc("/api/v1/performance/catalog", performanceHandler.HandleCatalog)
 	mux.HandleFunc("/api/v1/performance/metrics", performanceHandler.HandleMetrics)
 	mux.HandleFunc("/api/v1/performance/flamegraphs", flameGraphHandler.HandleProfiles)
@@ -175,7 +254,22 @@ func NewRouter(core *app.App) http.Handler {
 
 func isHAClusterActionPath(path string) bool {
 	trimmed := strings.Trim(path, "/")
-	return strings.HasSuffix(trimmed, "/bootstrap") || strings.Contains(trimmed, "/vip/") || strings.Contains(trimmed, "/failover/") || strings.Contains(trimmed, "/architecture/")
+	return strings.HasSuffix(trimmed, "/bootstrap") || strings.Contains(trimmed, "/vip/") || strings.Contains(trimmed, "/failover/") || strings.Contains(trimmed, "/architecture/") || strings.HasSuffix(trimmed, "/switchover") || strings.Contains(trimmed, "/switchover/")
+}
+
+func isProxySQLClusterPath(path string) bool {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v1/clusters/"), "/"), "/")
+	return len(parts) >= 2 && len(parts) <= 3 && parts[0] != "" && parts[1] == "proxysql"
+}
+
+func isTLSClusterPath(path string) bool {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v1/clusters/"), "/"), "/")
+	return len(parts) >= 2 && len(parts) <= 3 && parts[0] != "" && parts[1] == "tls"
+}
+
+func isReplicaRebuildClusterPath(path string) bool {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v1/clusters/"), "/"), "/")
+	return len(parts) >= 3 && len(parts) <= 4 && parts[0] != "" && parts[1] == "replicas" && parts[2] == "rebuild"
 }
 
 // Serve 在指定地址启动 HTTP 服务器。
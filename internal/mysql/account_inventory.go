@@ -0,0 +1,378 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+)
+
+// MaxInventoryAccounts bounds one capture; every account costs a SHOW GRANTS
+// round trip.
+const MaxInventoryAccounts = 5000
+
+var (
+	globalGrantRE = regexp.MustCompile("^GRANT (.+) ON \\*\\.\\* TO ")
+	// globalAllPrivileges is the subset that only ALL PRIVILEGES (printed as
+	// an expanded list since 8.0) grants together.
+	globalAllPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "FILE", "SHUTDOWN", "CREATE USER"}
+)
+
+// InventoryAccountKey identifies an account as user@host.
+func InventoryAccountKey(user, host string) string {
+	return user + "@" + host
+}
+
+// IsSystemAccount reports the accounts MySQL creates for itself
+// (mysql.sys, mysql.session, mysql.infoschema). They are listed but never
+// reported, compared or synced.
+func IsSystemAccount(user, host string) bool {
+	return strings.HasPrefix(user, "mysql.") && host == "localhost"
+}
+
+// AccountInventory captures every account of the server with its grants,
+// password state and the connection evidence kept by performance_schema.
+// Role, cluster and machine fields of the snapshot are left to the caller.
+func (c DiagnosticClient) AccountInventory(ctx context.Context, db *sql.DB) (inventorydomain.Snapshot, error) {
+	snapshot := inventorydomain.Snapshot{Accounts: []inventorydomain.Account{}, Findings: []inventorydomain.Finding{}}
+	if err := c.eachRow(ctx, db, `select @@version`, func(values []sql.NullString) error {
+		snapshot.ServerVersion = values[0].String
+		return nil
+	}); err != nil {
+		return snapshot, err
+	}
+	if err := c.eachRow(ctx, db, `show global status like 'Uptime'`, func(values []sql.NullString) error {
+		snapshot.UptimeSeconds, _ = strconv.ParseInt(values[1].String, 10, 64)
+		return nil
+	}); err != nil {
+		return snapshot, err
+	}
+	now := time.Now().UTC()
+	index := make(map[string]int)
+	if err := c.eachRow(ctx, db, `select User, Host, plugin, authentication_string = '', sha2(authentication_string, 256), password_expired, account_locked,
+		unix_timestamp(password_last_changed), password_lifetime from mysql.user order by User, Host`, func(values []sql.NullString) error {
+		if len(snapshot.Accounts) >= MaxInventoryAccounts {
+			return fmt.Errorf("实例账号超过 %d 个，无法生成账号清单", MaxInventoryAccounts)
+		}
+		account := inventorydomain.Account{
+			User: values[0].String, Host: values[1].String, Plugin: values[2].String, EmptyPassword: values[3].String == "1",
+			PasswordDigest: values[4].String, PasswordExpired: values[5].String == "Y", Locked: values[6].String == "Y", Grants: []string{},
+		}
+		if changed, err := strconv.ParseInt(values[7].String, 10, 64); err == nil && changed > 0 {
+			at := time.Unix(changed, 0).UTC()
+			account.PasswordLastChanged = &at
+			account.PasswordAgeDays = int(now.Sub(at).Hours() / 24)
+		}
+		if lifetime, err := strconv.Atoi(values[8].String); err == nil && values[8].Valid {
+			account.PasswordLifetime = &lifetime
+		}
+		// CREATE ROLE creates a locked account without a password.
+		account.IsRole = account.Locked && account.EmptyPassword
+		index[InventoryAccountKey(account.User, account.Host)] = len(snapshot.Accounts)
+		snapshot.Accounts = append(snapshot.Accounts, account)
+		return nil
+	}); err != nil {
+		return snapshot, err
+	}
+	if major, _, _ := serverVersionNumbers(snapshot.ServerVersion); major >= 8 {
+		if err := c.eachRow(ctx, db, `select FROM_USER, FROM_HOST, TO_USER, TO_HOST from mysql.role_edges order by FROM_USER, FROM_HOST`, func(values []sql.NullString) error {
+			if position, ok := index[InventoryAccountKey(values[0].String, values[1].String)]; ok {
+				snapshot.Accounts[position].IsRole = true
+			}
+			if position, ok := index[InventoryAccountKey(values[2].String, values[3].String)]; ok {
+				snapshot.Accounts[position].Roles = append(snapshot.Accounts[position].Roles, InventoryAccountKey(values[0].String, values[1].String))
+			}
+			return nil
+		}); err != nil {
+			snapshot.Warnings = append(snapshot.Warnings, "读取角色关系失败: "+err.Error())
+		}
+	}
+	type evidence struct {
+		current, total int64
+		hosts          map[string]bool
+	}
+	connections := make(map[string]*evidence)
+	if err := c.eachRow(ctx, db, `select USER, HOST, CURRENT_CONNECTIONS, TOTAL_CONNECTIONS from performance_schema.accounts where USER is not null`, func(values []sql.NullString) error {
+		item := connections[values[0].String]
+		if item == nil {
+			item = &evidence{hosts: make(map[string]bool)}
+			connections[values[0].String] = item
+		}
+		current, _ := strconv.ParseInt(values[2].String, 10, 64)
+		total, _ := strconv.ParseInt(values[3].String, 10, 64)
+		item.current += current
+		item.total += total
+		if values[1].Valid && values[1].String != "" {
+			item.hosts[values[1].String] = true
+		}
+		return nil
+	}); err != nil {
+		snapshot.Warnings = append(snapshot.Warnings, "读取 performance_schema.accounts 失败，缺少登录记录: "+err.Error())
+	}
+	for position := range snapshot.Accounts {
+		account := &snapshot.Accounts[position]
+		if item := connections[account.User]; item != nil {
+			account.CurrentConnections, account.TotalConnections = item.current, item.total
+			for host := range item.hosts {
+				account.ClientHosts = append(account.ClientHosts, host)
+			}
+			sort.Strings(account.ClientHosts)
+		}
+		grants, err := c.showGrants(ctx, db, account.User, account.Host)
+		if err != nil {
+			snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("读取 %s 的授权失败: %v", InventoryAccountKey(account.User, account.Host), err))
+			continue
+		}
+		account.Grants = grants
+	}
+	snapshot.Findings = AccountFindings(snapshot.ServerVersion, snapshot.Accounts)
+	return snapshot, nil
+}
+
+func (c DiagnosticClient) showGrants(ctx context.Context, db *sql.DB, user, host string) ([]string, error) {
+	grants := []string{}
+	err := c.eachRow(ctx, db, "SHOW GRANTS FOR "+accountIdent(user, host), func(values []sql.NullString) error {
+		grants = append(grants, values[0].String)
+		return nil
+	})
+	sort.Strings(grants)
+	return grants, err
+}
+
+// AccountDefinitions returns, for each requested user@host, the CREATE USER
+// statement followed by its GRANT statements, ready to be replayed on another
+// server. Authentication strings are printed as hex where the server supports
+// it (8.0.17+); older servers with binary hashes are rejected because the
+// statement could not be replayed safely.
+func (c DiagnosticClient) AccountDefinitions(ctx context.Context, db *sql.DB, version string, keys [][2]string) (map[string][]string, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	conn, err := db.Conn(queryCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if major, minor, patch := serverVersionNumbers(version); major > 8 || (major == 8 && (minor > 0 || patch >= 17)) {
+		if _, err := conn.ExecContext(queryCtx, "SET SESSION print_identified_with_as_hex = ON"); err != nil {
+			return nil, err
+		}
+	}
+	out := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		var create string
+		if err := conn.QueryRowContext(queryCtx, "SHOW CREATE USER "+accountIdent(key[0], key[1])).Scan(&create); err != nil {
+			return nil, fmt.Errorf("读取 %s 的定义失败: %w", InventoryAccountKey(key[0], key[1]), err)
+		}
+		if strings.IndexFunc(create, func(r rune) bool {
+			return r == unicode.ReplacementChar || (unicode.IsControl(r) && r != '\n' && r != '\t')
+		}) >= 0 {
+			return nil, fmt.Errorf("账号 %s 的认证串包含二进制内容，需要 MySQL 8.0.17 及以上版本才能同步", InventoryAccountKey(key[0], key[1]))
+		}
+		statements := []string{create}
+		rows, err := conn.QueryContext(queryCtx, "SHOW GRANTS FOR "+accountIdent(key[0], key[1]))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var grant string
+			if err := rows.Scan(&grant); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			statements = append(statements, grant)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		out[InventoryAccountKey(key[0], key[1])] = statements
+	}
+	return out, nil
+}
+
+// AccountFindings reports risky accounts: login from any host, global ALL
+// PRIVILEGES, empty passwords and mysql_native_password on 8.4+, where the
+// plugin is disabled by default and removed in 9.0.
+func AccountFindings(version string, accounts []inventorydomain.Account) []inventorydomain.Finding {
+	major, minor, _ := serverVersionNumbers(version)
+	nativeDeprecated := major > 8 || (major == 8 && minor >= 4)
+	findings := []inventorydomain.Finding{}
+	for _, account := range accounts {
+		if IsSystemAccount(account.User, account.Host) {
+			continue
+		}
+		name := InventoryAccountKey(account.User, account.Host)
+		add := func(severity, rule, message string) {
+			findings = append(findings, inventorydomain.Finding{Severity: severity, Rule: rule, User: account.User, Host: account.Host, Message: message})
+		}
+		loginable := !account.Locked && !account.IsRole
+		if loginable && strings.Contains(account.Host, "%") {
+			add(inventorydomain.SeverityWarning, inventorydomain.RuleWildcardHost, fmt.Sprintf("账号 %s 允许从任意匹配主机登录", name))
+		}
+		if hasGlobalAllPrivileges(account.Grants) {
+			severity := inventorydomain.SeverityWarning
+			if !isLocalHost(account.Host) && loginable {
+				severity = inventorydomain.SeverityCritical
+			}
+			add(severity, inventorydomain.RuleGlobalAll, fmt.Sprintf("账号 %s 拥有 *.* 上的全部权限", name))
+		}
+		if loginable && account.EmptyPassword && account.Plugin != "auth_socket" && account.Plugin != "auth_pam" {
+			add(inventorydomain.SeverityCritical, inventorydomain.RuleEmptyPassword, fmt.Sprintf("账号 %s 没有设置密码", name))
+		}
+		if nativeDeprecated && account.Plugin == "mysql_native_password" {
+			add(inventorydomain.SeverityWarning, inventorydomain.RuleNativePassword84, fmt.Sprintf("账号 %s 仍使用 mysql_native_password，8.4 默认禁用、9.0 移除该插件", name))
+		}
+	}
+	return findings
+}
+
+// DiffAccounts compares the accounts of a replica with its primary. System
+// accounts are ignored; passwords are compared by digest.
+func DiffAccounts(primary, replica []inventorydomain.Account) []inventorydomain.Difference {
+	replicas := make(map[string]inventorydomain.Account, len(replica))
+	for _, account := range replica {
+		replicas[InventoryAccountKey(account.User, account.Host)] = account
+	}
+	seen := make(map[string]bool, len(primary))
+	out := []inventorydomain.Difference{}
+	for _, source := range primary {
+		key := InventoryAccountKey(source.User, source.Host)
+		seen[key] = true
+		if IsSystemAccount(source.User, source.Host) {
+			continue
+		}
+		target, ok := replicas[key]
+		if !ok {
+			out = append(out, inventorydomain.Difference{User: source.User, Host: source.Host, Change: inventorydomain.ChangeMissing, MissingGrants: source.Grants})
+			continue
+		}
+		diff := inventorydomain.Difference{User: source.User, Host: source.Host, Change: inventorydomain.ChangeChanged}
+		if source.Plugin != target.Plugin {
+			diff.Fields = append(diff.Fields, "plugin")
+		}
+		if source.PasswordDigest != target.PasswordDigest {
+			diff.Fields = append(diff.Fields, "password")
+		}
+		if source.Locked != target.Locked {
+			diff.Fields = append(diff.Fields, "locked")
+		}
+		diff.MissingGrants, diff.ExtraGrants = grantDifference(source.Grants, target.Grants), grantDifference(target.Grants, source.Grants)
+		if len(diff.MissingGrants) > 0 || len(diff.ExtraGrants) > 0 {
+			diff.Fields = append(diff.Fields, "grants")
+		}
+		if len(diff.Fields) > 0 {
+			out = append(out, diff)
+		}
+	}
+	for _, target := range replica {
+		key := InventoryAccountKey(target.User, target.Host)
+		if !seen[key] && !IsSystemAccount(target.User, target.Host) {
+			out = append(out, inventorydomain.Difference{User: target.User, Host: target.Host, Change: inventorydomain.ChangeExtra, ExtraGrants: target.Grants})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return InventoryAccountKey(out[i].User, out[i].Host) < InventoryAccountKey(out[j].User, out[j].Host)
+	})
+	return out
+}
+
+// AccountSyncStatements turns differences into statements that make a
+// replica match its primary. Changed accounts are dropped and recreated from
+// the primary definition; roles are created before the accounts that use
+// them and every GRANT runs after all accounts exist. Extra accounts are only
+// dropped when dropExtra is set.
+func AccountSyncStatements(diffs []inventorydomain.Difference, definitions map[string][]string, roles map[string]bool, dropExtra bool) ([]string, error) {
+	var drops, roleCreates, creates, grants, extras []string
+	for _, diff := range diffs {
+		key := InventoryAccountKey(diff.User, diff.Host)
+		if diff.Change == inventorydomain.ChangeExtra {
+			if dropExtra {
+				extras = append(extras, "DROP USER "+accountIdent(diff.User, diff.Host))
+			}
+			continue
+		}
+		definition := definitions[key]
+		if len(definition) == 0 {
+			return nil, fmt.Errorf("缺少主库账号 %s 的定义", key)
+		}
+		if diff.Change == inventorydomain.ChangeChanged {
+			drops = append(drops, "DROP USER "+accountIdent(diff.User, diff.Host))
+		}
+		if roles[key] {
+			roleCreates = append(roleCreates, definition[0])
+		} else {
+			creates = append(creates, definition[0])
+		}
+		grants = append(grants, definition[1:]...)
+	}
+	out := append(drops, roleCreates...)
+	out = append(out, creates...)
+	out = append(out, grants...)
+	out = append(out, extras...)
+	if len(out) == 0 {
+		return nil, errors.New("没有需要同步的账号")
+	}
+	return out, nil
+}
+
+func grantDifference(left, right []string) []string {
+	present := make(map[string]bool, len(right))
+	for _, grant := range right {
+		present[grant] = true
+	}
+	var out []string
+	for _, grant := range left {
+		if !present[grant] {
+			out = append(out, grant)
+		}
+	}
+	return out
+}
+
+func hasGlobalAllPrivileges(grants []string) bool {
+	for _, grant := range grants {
+		match := globalGrantRE.FindStringSubmatch(grant)
+		if len(match) != 2 {
+			continue
+		}
+		privileges := strings.ToUpper(match[1])
+		if privileges == "ALL" || privileges == "ALL PRIVILEGES" {
+			return true
+		}
+		held := make(map[string]bool)
+		for _, item := range strings.Split(privileges, ",") {
+			held[strings.TrimSpace(item)] = true
+		}
+		all := true
+		for _, item := range globalAllPrivileges {
+			all = all && held[item]
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocalHost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+func serverVersionNumbers(raw string) (int, int, int) {
+	match := regexp.MustCompile(`^\s*(\d+)\.(\d+)\.(\d+)`).FindStringSubmatch(raw)
+	if len(match) != 4 {
+		return 0, 0, 0
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	patch, _ := strconv.Atoi(match[3])
+	return major, minor, patch
+}
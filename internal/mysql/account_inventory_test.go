@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	inventorydomain "gmha/internal/domain/accountinventory"
+)
+
+const accountTestRootGrants = "GRANT SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, RELOAD, SHUTDOWN, PROCESS, FILE, REFERENCES, INDEX, ALTER, CREATE USER ON *.* TO `root`@`localhost` WITH GRANT OPTION"
+
+func TestAccountFindingsFlagRiskyAccounts(t *testing.T) {
+	accounts := []inventorydomain.Account{
+		{User: "root", Host: "localhost", Plugin: "caching_sha2_password", Grants: []string{accountTestRootGrants}},
+		{User: "admin", Host: "%", Plugin: "mysql_native_password", Grants: []string{"GRANT ALL PRIVILEGES ON *.* TO `admin`@`%`"}},
+		{User: "app", Host: "10.0.%", Plugin: "caching_sha2_password", EmptyPassword: true, Grants: []string{"GRANT SELECT ON `app`.* TO `app`@`10.0.%`"}},
+		{User: "reader", Host: "%", Plugin: "caching_sha2_password", Locked: true, EmptyPassword: true, IsRole: true},
+		{User: "mysql.sys", Host: "localhost", Plugin: "caching_sha2_password", Locked: true},
+		{User: "ops", Host: "localhost", Plugin: "auth_socket", EmptyPassword: true},
+	}
+	findings := AccountFindings("8.4.3", accounts)
+	got := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		got = append(got, finding.Rule+":"+finding.Severity+":"+InventoryAccountKey(finding.User, finding.Host))
+	}
+	want := strings.Join([]string{
+		"global_all_privileges:warning:root@localhost",
+		"wildcard_host:warning:admin@%",
+		"global_all_privileges:critical:admin@%",
+		"native_password_deprecated:warning:admin@%",
+		"wildcard_host:warning:app@10.0.%",
+		"empty_password:critical:app@10.0.%",
+	}, " ")
+	if strings.Join(got, " ") != want {
+		t.Fatalf("findings = %s", strings.Join(got, " "))
+	}
+	if findings := AccountFindings("8.0.36", accounts[1:2]); len(findings) != 2 {
+		t.Fatalf("8.0 should not flag mysql_native_password: %+v", findings)
+	}
+}
+
+func TestDiffAccountsAndSyncStatements(t *testing.T) {
+	primary := []inventorydomain.Account{
+		{User: "app", Host: "%", Plugin: "caching_sha2_password", PasswordDigest: "a1", Grants: []string{"GRANT USAGE ON *.* TO `app`@`%`", "GRANT `reader`@`%` TO `app`@`%`"}},
+		{User: "mysql.sys", Host: "localhost", PasswordDigest: "x"},
+		{User: "reader", Host: "%", Locked: true, IsRole: true, Grants: []string{"GRANT SELECT ON `app`.* TO `reader`@`%`"}},
+		{User: "same", Host: "%", PasswordDigest: "s", Grants: []string{"GRANT USAGE ON *.* TO `same`@`%`"}},
+	}
+	replica := []inventorydomain.Account{
+		{User: "app", Host: "%", Plugin: "caching_sha2_password", PasswordDigest: "old", Grants: []string{"GRANT USAGE ON *.* TO `app`@`%`", "GRANT SELECT ON `app`.* TO `app`@`%`"}},
+		{User: "legacy", Host: "%", Grants: []string{"GRANT USAGE ON *.* TO `legacy`@`%`"}},
+		{User: "mysql.sys", Host: "localhost", PasswordDigest: "y"},
+		{User: "same", Host: "%", PasswordDigest: "s", Grants: []string{"GRANT USAGE ON *.* TO `same`@`%`"}},
+	}
+	diffs := DiffAccounts(primary, replica)
+	if len(diffs) != 3 || diffs[0].User != "app" || strings.Join(diffs[0].Fields, ",") != "password,grants" ||
+		diffs[1].Change != inventorydomain.ChangeExtra || diffs[2].Change != inventorydomain.ChangeMissing || diffs[2].User != "reader" {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+	if diffs[0].MissingGrants[0] != "GRANT `reader`@`%` TO `app`@`%`" || diffs[0].ExtraGrants[0] != "GRANT SELECT ON `app`.* TO `app`@`%`" {
+		t.Fatalf("grant diff = %+v", diffs[0])
+	}
+
+	definitions := map[string][]string{
+		"app@%":    {"CREATE USER `app`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x24 DEFAULT ROLE `reader`@`%`", "GRANT USAGE ON *.* TO `app`@`%`", "GRANT `reader`@`%` TO `app`@`%`"},
+		"reader@%": {"CREATE USER `reader`@`%` ACCOUNT LOCK", "GRANT SELECT ON `app`.* TO `reader`@`%`"},
+	}
+	statements, err := AccountSyncStatements(diffs, definitions, map[string]bool{"reader@%": true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"DROP USER 'app'@'%'",
+		"CREATE USER `reader`@`%` ACCOUNT LOCK",
+		"CREATE USER `app`@`%` IDENTIFIED WITH 'caching_sha2_password' AS 0x24 DEFAULT ROLE `reader`@`%`",
+		"GRANT USAGE ON *.* TO `app`@`%`", "GRANT `reader`@`%` TO `app`@`%`", "GRANT SELECT ON `app`.* TO `reader`@`%`",
+	}
+	if strings.Join(statements, ";\n") != strings.Join(want, ";\n") {
+		t.Fatalf("statements =\n%s", strings.Join(statements, ";\n"))
+	}
+	if statements, _ := AccountSyncStatements(diffs, definitions, nil, true); statements[len(statements)-1] != "DROP USER 'legacy'@'%'" {
+		t.Fatalf("drop extra = %v", statements)
+	}
+	if _, err := AccountSyncStatements(diffs[1:2], definitions, nil, false); err == nil {
+		t.Fatal("extra accounts alone are only synced with drop_extra")
+	}
+}
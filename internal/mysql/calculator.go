@@ -100,6 +100,10 @@ type ConfigVars struct {
 	JoinBufferSizeBytes    int64
 	SkipNameResolve        int
 	SymbolicLinks          int
+	TLSCAPath              string
+	TLSCertPath            string
+	TLSKeyPath             string
+	RequireSecureTransport int
 }
 
 // Calculator 是 MySQL 配置计算器，根据机器信息和配置档案计算最优的数据库参数。
@@ -0,0 +1,265 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	changedomain "gmha/internal/domain/schemachange"
+	schemadomain "gmha/internal/domain/schemasnapshot"
+)
+
+var (
+	lintCharsetRE    = regexp.MustCompile(`(?i)\b(?:CHARACTER\s+SET|CHARSET|COLLATE)\s*=?\s*([A-Za-z0-9_]+)`)
+	lintColumnTypeRE = regexp.MustCompile(`(?i)^([a-z]+)\s*(?:\(([^)]*)\))?(\s+unsigned)?`)
+	lintTableCharset = regexp.MustCompile(`(?i)\bCHARSET=([A-Za-z0-9_]+)`)
+)
+
+var lintTypeRanks = map[string]map[string]int{
+	"integer": {"tinyint": 1, "smallint": 2, "mediumint": 3, "int": 4, "integer": 4, "bigint": 5},
+	"text":    {"tinytext": 1, "text": 2, "mediumtext": 3, "longtext": 4},
+	"blob":    {"tinyblob": 1, "blob": 2, "mediumblob": 3, "longblob": 4},
+	"string":  {"char": 1, "varchar": 1},
+	"binary":  {"binary": 1, "varbinary": 1},
+	"decimal": {"decimal": 1, "numeric": 1},
+}
+
+// LintAlter reviews an ALTER TABLE clause before it is approved. table is the
+// current definition from the latest schema snapshot, or nil when the
+// instance has not been captured yet; the rules that need it are skipped with
+// a warning.
+func LintAlter(table *schemadomain.Table, alter string) []changedomain.Finding {
+	findings := []changedomain.Finding{}
+	add := func(rule, level, column, format string, args ...any) {
+		findings = append(findings, changedomain.Finding{Rule: rule, Level: level, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+	clauses := splitAlterClauses(alter)
+	columns := map[string]string{}
+	hasPrimary := false
+	if table == nil {
+		add("no_snapshot", changedomain.LevelWarning, "", "实例没有结构快照，主键与列变更检查已跳过")
+	} else {
+		for _, column := range table.Columns {
+			columns[strings.ToLower(column.Name)] = column.SQL
+		}
+		for _, index := range table.Indexes {
+			hasPrimary = hasPrimary || index.Name == "PRIMARY"
+		}
+		if match := lintTableCharset.FindStringSubmatch(table.Options); match != nil && !lintUTF8MB4(match[1]) {
+			add("table_charset", changedomain.LevelWarning, "", "表字符集为 %s，建议统一为 utf8mb4", match[1])
+		}
+	}
+
+	addsPrimary, dropsPrimary := false, false
+	for _, clause := range clauses {
+		words := strings.Fields(strings.ToUpper(clause))
+		if len(words) == 0 {
+			continue
+		}
+		for _, match := range lintCharsetRE.FindAllStringSubmatch(clause, -1) {
+			if !lintUTF8MB4(match[1]) {
+				add("charset", changedomain.LevelWarning, "", "变更使用字符集或排序规则 %s，建议使用 utf8mb4", match[1])
+			}
+		}
+		switch {
+		case lintHasPrefix(words, "ADD", "PRIMARY", "KEY"), lintHasPrefix(words, "ADD", "CONSTRAINT") && lintContains(words, "PRIMARY"):
+			addsPrimary = true
+		case lintHasPrefix(words, "DROP", "PRIMARY", "KEY"):
+			dropsPrimary = true
+		case lintHasPrefix(words, "CONVERT", "TO"):
+			add("convert_charset", changedomain.LevelWarning, "", "CONVERT TO 会转换全部文本列的字符集，请确认存量数据与索引长度")
+		case words[0] == "DROP" && lintColumnClause(words):
+			name, _ := lintColumnDefinition(clause, 1)
+			add("drop_column", changedomain.LevelWarning, name, "删除列 %s 不可回滚，请确认应用已不再读写该列", name)
+			if table != nil && columns[strings.ToLower(name)] == "" {
+				add("unknown_column", changedomain.LevelError, name, "列 %s 不存在", name)
+			}
+		case words[0] == "ADD" && lintColumnClause(words):
+			name, definition := lintColumnDefinition(clause, 1)
+			if table != nil && columns[strings.ToLower(name)] != "" {
+				add("duplicate_column", changedomain.LevelError, name, "列 %s 已存在", name)
+			}
+			upper := strings.ToUpper(definition)
+			if strings.Contains(upper, "NOT NULL") && !strings.Contains(upper, "DEFAULT") && !strings.Contains(upper, "AUTO_INCREMENT") && !strings.Contains(upper, " AS ") {
+				add("not_null_without_default", changedomain.LevelWarning, name, "新增 NOT NULL 列 %s 没有默认值，严格模式下复制存量数据会失败", name)
+			}
+		case words[0] == "MODIFY" || words[0] == "CHANGE":
+			old, definition := lintColumnDefinition(clause, 1)
+			if words[0] == "CHANGE" {
+				var name string
+				name, definition = lintColumnDefinition(definition, 0)
+				if !strings.EqualFold(name, old) {
+					add("rename_column", changedomain.LevelWarning, old, "列 %s 将重命名为 %s，依赖旧列名的 SQL 会失败", old, name)
+				}
+			}
+			if table == nil {
+				continue
+			}
+			current := columns[strings.ToLower(old)]
+			if current == "" {
+				add("unknown_column", changedomain.LevelError, old, "列 %s 不存在", old)
+				continue
+			}
+			_, currentDefinition := lintColumnDefinition(current, 0)
+			findings = append(findings, lintColumnChange(old, currentDefinition, definition)...)
+		}
+	}
+	switch {
+	case dropsPrimary && !addsPrimary:
+		add("drop_primary_key", changedomain.LevelError, "", "删除主键后表没有主键，在线 DDL 与复制都依赖主键")
+	case dropsPrimary:
+		add("rebuild_primary_key", changedomain.LevelWarning, "", "主键将被重建，请确认新主键的唯一性")
+	case table != nil && !hasPrimary && !addsPrimary:
+		add("missing_primary_key", changedomain.LevelError, "", "表 %s 没有主键，请在本次变更中补充主键", table.Name)
+	}
+	return findings
+}
+
+// lintColumnChange compares the type and nullability of a column before and
+// after MODIFY or CHANGE.
+func lintColumnChange(column, before, after string) []changedomain.Finding {
+	var findings []changedomain.Finding
+	add := func(rule, format string, args ...any) {
+		findings = append(findings, changedomain.Finding{Rule: rule, Level: changedomain.LevelWarning, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+	oldType, newType := lintColumnTypeRE.FindStringSubmatch(before), lintColumnTypeRE.FindStringSubmatch(after)
+	if oldType != nil && newType != nil {
+		oldBase, newBase := strings.ToLower(oldType[1]), strings.ToLower(newType[1])
+		oldFamily, oldRank := lintTypeFamily(oldBase)
+		newFamily, newRank := lintTypeFamily(newBase)
+		switch {
+		case oldFamily == "" || oldFamily != newFamily:
+			if oldBase != newBase {
+				add("type_change", "列 %s 类型由 %s 改为 %s，存量数据可能被截断或转换失败", column, oldBase, newBase)
+			}
+		case newRank < oldRank:
+			add("type_narrowing", "列 %s 类型由 %s 缩小为 %s，超出范围的数据会被截断或报错", column, oldBase, newBase)
+		case oldFamily != "integer" && lintLengthShrinks(oldType[2], newType[2]):
+			add("type_narrowing", "列 %s 长度由 (%s) 缩小为 (%s)", column, oldType[2], newType[2])
+		}
+		if oldType[3] != "" && newType[3] == "" && oldFamily == "integer" {
+			add("type_narrowing", "列 %s 由 UNSIGNED 改为有符号，较大的值会超出范围", column)
+		}
+	}
+	if !strings.Contains(strings.ToUpper(before), "NOT NULL") && strings.Contains(strings.ToUpper(after), "NOT NULL") {
+		add("null_to_not_null", "列 %s 改为 NOT NULL，存量 NULL 值会导致变更失败", column)
+	}
+	return findings
+}
+
+func lintTypeFamily(base string) (string, int) {
+	for family, ranks := range lintTypeRanks {
+		if rank, ok := ranks[base]; ok {
+			return family, rank
+		}
+	}
+	return "", 0
+}
+
+func lintLengthShrinks(before, after string) bool {
+	oldParts, newParts := strings.Split(before, ","), strings.Split(after, ",")
+	for index := range oldParts {
+		if index >= len(newParts) {
+			return false
+		}
+		oldValue, oldErr := strconv.Atoi(strings.TrimSpace(oldParts[index]))
+		newValue, newErr := strconv.Atoi(strings.TrimSpace(newParts[index]))
+		if oldErr == nil && newErr == nil && newValue < oldValue {
+			return true
+		}
+	}
+	return false
+}
+
+// lintColumnClause reports ADD/DROP clauses that target a column rather than
+// an index, constraint or partition.
+func lintColumnClause(words []string) bool {
+	if len(words) < 2 {
+		return false
+	}
+	switch words[1] {
+	case "COLUMN":
+		return true
+	case "INDEX", "KEY", "UNIQUE", "PRIMARY", "FULLTEXT", "SPATIAL", "FOREIGN", "CONSTRAINT", "CHECK", "PARTITION", "DEFAULT":
+		return false
+	}
+	return !strings.HasPrefix(words[1], "(")
+}
+
+// lintColumnDefinition returns the column name and the rest of the definition
+// after skipping the given number of leading keywords.
+func lintColumnDefinition(clause string, skip int) (string, string) {
+	rest := strings.TrimSpace(clause)
+	for ; skip > 0; skip-- {
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return "", ""
+		}
+		rest = strings.TrimSpace(rest[len(fields[0]):])
+	}
+	if strings.HasPrefix(strings.ToUpper(rest), "COLUMN ") {
+		rest = strings.TrimSpace(rest[len("COLUMN "):])
+	}
+	name := leadingIdentifier(rest)
+	if strings.HasPrefix(rest, "`") {
+		rest = rest[len(quoteMySQLIdentifier(name)):]
+	} else {
+		rest = rest[len(name):]
+	}
+	return name, strings.TrimSpace(rest)
+}
+
+// splitAlterClauses splits an ALTER clause at top-level commas, ignoring
+// commas inside parentheses and quoted strings.
+func splitAlterClauses(alter string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	var quote byte
+	for index := 0; index < len(alter); index++ {
+		char := alter[index]
+		switch {
+		case quote != 0:
+			if char == '\\' && quote != '`' {
+				index++
+			} else if char == quote {
+				quote = 0
+			}
+		case char == '\'' || char == '"' || char == '`':
+			quote = char
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+		case char == ',' && depth == 0:
+			clauses = append(clauses, strings.TrimSpace(alter[start:index]))
+			start = index + 1
+		}
+	}
+	return append(clauses, strings.TrimSpace(alter[start:]))
+}
+
+func lintHasPrefix(words []string, prefix ...string) bool {
+	if len(words) < len(prefix) {
+		return false
+	}
+	for index, word := range prefix {
+		if !strings.HasPrefix(words[index], word) {
+			return false
+		}
+	}
+	return true
+}
+
+func lintContains(words []string, word string) bool {
+	for _, candidate := range words {
+		if candidate == word {
+			return true
+		}
+	}
+	return false
+}
+
+func lintUTF8MB4(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "utf8mb4") || strings.EqualFold(name, "binary") || strings.EqualFold(name, "ascii")
+}
@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	changedomain "gmha/internal/domain/schemachange"
+)
+
+func TestLintAlterFlagsDangerousColumnChanges(t *testing.T) {
+	table := ParseCreateTable("orders", schemaTestOrders)
+	findings := LintAlter(&table, "ADD COLUMN `channel` varchar(16) NOT NULL, MODIFY `status` varchar(8) NOT NULL DEFAULT 'new', "+
+		"CHANGE `total` `amount` int DEFAULT NULL, DROP COLUMN `user_id`, ADD INDEX `idx_status` (`status`), "+
+		"MODIFY COLUMN `note` text CHARACTER SET latin1")
+	got := map[string]string{}
+	for _, finding := range findings {
+		got[finding.Rule+":"+finding.Column] = finding.Level
+	}
+	for _, want := range []string{
+		"not_null_without_default:channel", "type_narrowing:status", "rename_column:total", "type_change:total",
+		"drop_column:user_id", "charset:", "unknown_column:note",
+	} {
+		if _, ok := got[want]; !ok {
+			t.Fatalf("missing finding %s in %+v", want, findings)
+		}
+	}
+	if got["unknown_column:note"] != changedomain.LevelError || got["drop_column:user_id"] != changedomain.LevelWarning {
+		t.Fatalf("unexpected levels %+v", got)
+	}
+	if _, ok := got["missing_primary_key:"]; ok {
+		t.Fatalf("table has a primary key: %+v", findings)
+	}
+
+	for _, tc := range []struct {
+		alter, rule string
+	}{
+		{"DROP PRIMARY KEY", "drop_primary_key"},
+		{"DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `user_id`)", "rebuild_primary_key"},
+	} {
+		if findings := LintAlter(&table, tc.alter); len(findings) != 1 || findings[0].Rule != tc.rule {
+			t.Fatalf("LintAlter(%q) = %+v", tc.alter, findings)
+		}
+	}
+	noKey := ParseCreateTable("logs", "CREATE TABLE `logs` (\n  `msg` varchar(255) DEFAULT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=latin1")
+	findings = LintAlter(&noKey, "ADD COLUMN `at` datetime DEFAULT NULL")
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.Rule)
+	}
+	if strings.Join(rules, ",") != "table_charset,missing_primary_key" {
+		t.Fatalf("unexpected findings %v", rules)
+	}
+	if findings := LintAlter(nil, "ADD COLUMN `x` int"); len(findings) != 1 || findings[0].Rule != "no_snapshot" {
+		t.Fatalf("missing snapshot must only warn: %+v", findings)
+	}
+}
@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GTIDSet is a parsed gtid_executed value keyed by source UUID (or
+// "uuid:tag" for MySQL 8.4 tagged GTIDs). Intervals are inclusive, sorted and
+// non-overlapping.
+type GTIDSet map[string][]GTIDInterval
+
+type GTIDInterval struct {
+	Start int64
+	End   int64
+}
+
+// ParseGTIDSet parses the textual form printed by MySQL, tolerating the
+// newlines MySQL inserts after each comma.
+func ParseGTIDSet(raw string) (GTIDSet, error) {
+	set := GTIDSet{}
+	raw = strings.NewReplacer("\n", "", "\r", "", " ", "", "\\n", "").Replace(raw)
+	if raw == "" {
+		return set, nil
+	}
+	for _, member := range strings.Split(raw, ",") {
+		if member == "" {
+			continue
+		}
+		fields := strings.Split(member, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid GTID set member %q", member)
+		}
+		key := strings.ToLower(fields[0])
+		for _, field := range fields[1:] {
+			bounds := strings.SplitN(field, "-", 2)
+			start, err := strconv.ParseInt(bounds[0], 10, 64)
+			if err != nil {
+				key = strings.ToLower(fields[0]) + ":" + strings.ToLower(field)
+				continue
+			}
+			end := start
+			if len(bounds) == 2 {
+				if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil || end < start {
+					return nil, fmt.Errorf("invalid GTID interval %q", field)
+				}
+			}
+			set[key] = append(set[key], GTIDInterval{Start: start, End: end})
+		}
+	}
+	for key := range set {
+		set[key] = mergeGTIDIntervals(set[key])
+	}
+	return set, nil
+}
+
+func mergeGTIDIntervals(items []GTIDInterval) []GTIDInterval {
+	sort.Slice(items, func(i, j int) bool { return items[i].Start < items[j].Start })
+	out := make([]GTIDInterval, 0, len(items))
+	for _, item := range items {
+		if len(out) > 0 && item.Start <= out[len(out)-1].End+1 {
+			if item.End > out[len(out)-1].End {
+				out[len(out)-1].End = item.End
+			}
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// Subtract returns the transactions of s that are missing from other, the
+// equivalent of GTID_SUBTRACT(s, other).
+func (s GTIDSet) Subtract(other GTIDSet) GTIDSet {
+	out := GTIDSet{}
+	for key, intervals := range s {
+		remaining := append([]GTIDInterval(nil), intervals...)
+		for _, cut := range other[key] {
+			next := make([]GTIDInterval, 0, len(remaining))
+			for _, item := range remaining {
+				if cut.End < item.Start || cut.Start > item.End {
+					next = append(next, item)
+					continue
+				}
+				if cut.Start > item.Start {
+					next = append(next, GTIDInterval{Start: item.Start, End: cut.Start - 1})
+				}
+				if cut.End < item.End {
+					next = append(next, GTIDInterval{Start: cut.End + 1, End: item.End})
+				}
+			}
+			remaining = next
+		}
+		if len(remaining) > 0 {
+			out[key] = remaining
+		}
+	}
+	return out
+}
+
+// Contains reports whether every transaction in other is also in s, the
+// equivalent of GTID_SUBSET(other, s).
+func (s GTIDSet) Contains(other GTIDSet) bool {
+	return other.Subtract(s).Count() == 0
+}
+
+// Count returns the number of transactions in the set.
+func (s GTIDSet) Count() int64 {
+	var total int64
+	for _, intervals := range s {
+		for _, item := range intervals {
+			total += item.End - item.Start + 1
+		}
+	}
+	return total
+}
+
+func (s GTIDSet) String() string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		var b strings.Builder
+		b.WriteString(key)
+		for _, item := range s[key] {
+			if item.Start == item.End {
+				fmt.Fprintf(&b, ":%d", item.Start)
+			} else {
+				fmt.Fprintf(&b, ":%d-%d", item.Start, item.End)
+			}
+		}
+		parts = append(parts, b.String())
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,28 @@
+package mysql
+
+import "testing"
+
+func TestGTIDSetSubtractCountsMissingTransactions(t *testing.T) {
+	source, err := ParseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-100:120,\n4f5c0c1e-0000-11ee-8000-000000000001:1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err := ParseGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := source.Subtract(replica)
+	if missing.Count() != 16 || missing.String() != "3e11fa47-71ca-11e1-9e33-c80aa9429562:91-100:120,4f5c0c1e-0000-11ee-8000-000000000001:1-5" {
+		t.Fatalf("unexpected gap %s (%d)", missing, missing.Count())
+	}
+	if !source.Contains(replica) || replica.Contains(source) {
+		t.Fatal("subset check is inverted")
+	}
+	tagged, err := ParseGTIDSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3:gmha:1-2")
+	if err != nil || tagged.Count() != 5 {
+		t.Fatalf("tagged GTIDs must be counted per tag: %v %d", err, tagged.Count())
+	}
+	if _, err := ParseGTIDSet("uuid:5-1"); err == nil {
+		t.Fatal("reversed interval must be rejected")
+	}
+}
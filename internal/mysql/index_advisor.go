@@ -0,0 +1,796 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const maxIndexAdviceColumns = 5
+
+// IndexColumn is one key part of a suggested index.
+type IndexColumn struct {
+	Name      string `json:"name"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// TableAccess collects the predicates of a normalised statement that an index
+// on one table could serve. Join columns are recorded as equality lookups on
+// both sides because either table may be the inner one.
+type TableAccess struct {
+	Schema   string        `json:"schema"`
+	Table    string        `json:"table"`
+	Equality []string      `json:"equality,omitempty"`
+	Range    []string      `json:"range,omitempty"`
+	OrderBy  []IndexColumn `json:"order_by,omitempty"`
+}
+
+type digestToken struct {
+	text   string
+	quoted bool
+}
+
+func (t digestToken) keyword(words ...string) bool {
+	if t.quoted {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t digestToken) identifier() bool {
+	if t.quoted {
+		return true
+	}
+	if t.text == "" || digestReservedWords[strings.ToUpper(t.text)] {
+		return false
+	}
+	r := []rune(t.text)[0]
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+var digestReservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "IN": true, "IS": true,
+	"NULL": true, "LIKE": true, "BETWEEN": true, "ORDER": true, "GROUP": true, "BY": true, "LIMIT": true,
+	"HAVING": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "OUTER": true, "CROSS": true,
+	"STRAIGHT_JOIN": true, "NATURAL": true, "ON": true, "USING": true, "AS": true, "ASC": true, "DESC": true,
+	"UPDATE": true, "DELETE": true, "SET": true, "FOR": true, "UNION": true, "LOCK": true, "WINDOW": true,
+	"USE": true, "FORCE": true, "IGNORE": true, "INDEX": true, "KEY": true, "OFFSET": true, "DISTINCT": true,
+	"EXISTS": true, "TRUE": true, "FALSE": true, "INTO": true, "VALUES": true, "CASE": true, "WHEN": true,
+	"THEN": true, "ELSE": true, "END": true, "PARTITION": true, "LOW_PRIORITY": true, "QUICK": true,
+}
+
+// ParseDigestAccess extracts per-table equality, range and ORDER BY columns
+// from a statement digest text. Only SELECT, UPDATE and DELETE are analysed;
+// WHERE clauses with a top-level OR contribute nothing, and unqualified
+// columns are attributed only when the statement reads a single table.
+func ParseDigestAccess(digestText, database string) ([]TableAccess, error) {
+	tokens := lexDigest(digestText)
+	if len(tokens) == 0 {
+		return nil, errors.New("empty digest text")
+	}
+	var fromTokens, whereTokens, orderTokens []digestToken
+	switch {
+	case tokens[0].keyword("SELECT"):
+		clauses := splitDigestClauses(tokens[1:], "FROM", "WHERE", "GROUP", "HAVING", "ORDER", "LIMIT", "FOR", "UNION", "LOCK", "WINDOW", "INTO")
+		if clauses["UNION"] != nil {
+			return nil, errors.New("UNION statements are not analysed")
+		}
+		fromTokens, whereTokens, orderTokens = clauses["FROM"], clauses["WHERE"], clauses["ORDER"]
+	case tokens[0].keyword("UPDATE"):
+		clauses := splitDigestClauses(tokens, "UPDATE", "SET", "WHERE", "ORDER", "LIMIT")
+		fromTokens, whereTokens, orderTokens = clauses["UPDATE"], clauses["WHERE"], clauses["ORDER"]
+	case tokens[0].keyword("DELETE"):
+		clauses := splitDigestClauses(tokens, "FROM", "USING", "WHERE", "ORDER", "LIMIT")
+		if clauses["USING"] != nil {
+			return nil, errors.New("multi-table DELETE is not analysed")
+		}
+		fromTokens, whereTokens, orderTokens = clauses["FROM"], clauses["WHERE"], clauses["ORDER"]
+	default:
+		return nil, errors.New("only SELECT, UPDATE and DELETE are analysed")
+	}
+	if len(orderTokens) > 0 && orderTokens[0].keyword("BY") {
+		orderTokens = orderTokens[1:]
+	}
+	refs, onConditions := parseDigestTables(fromTokens, database)
+	if len(refs) == 0 {
+		return nil, errors.New("no base table found")
+	}
+	accesses := make([]TableAccess, len(refs))
+	for index, ref := range refs {
+		accesses[index] = TableAccess{Schema: ref.schema, Table: ref.table}
+	}
+	resolve := func(parts []string) int {
+		switch len(parts) {
+		case 1:
+			if len(refs) == 1 {
+				return 0
+			}
+		case 2, 3:
+			qualifier := parts[len(parts)-2]
+			for index, ref := range refs {
+				if len(parts) == 3 && !strings.EqualFold(parts[0], ref.schema) {
+					continue
+				}
+				if strings.EqualFold(qualifier, ref.alias) || (ref.alias == "" && strings.EqualFold(qualifier, ref.table)) {
+					return index
+				}
+			}
+		}
+		return -1
+	}
+	conditions := onConditions
+	if !digestHasTopLevel(whereTokens, "OR") {
+		conditions = append(conditions, whereTokens)
+	}
+	for _, condition := range conditions {
+		for _, conjunct := range splitDigestConjuncts(condition) {
+			classifyDigestPredicate(conjunct, resolve, accesses)
+		}
+	}
+	if len(orderTokens) > 0 {
+		target, columns := -1, []IndexColumn(nil)
+		for _, item := range splitDigestTopLevel(orderTokens, ",") {
+			parts, rest := digestColumnRef(item)
+			index := resolve(parts)
+			if index < 0 || (target >= 0 && index != target) || len(rest) > 1 || (len(rest) == 1 && !rest[0].keyword("ASC", "DESC")) {
+				columns = nil
+				break
+			}
+			target = index
+			column := IndexColumn{Name: parts[len(parts)-1]}
+			if len(rest) == 1 && rest[0].keyword("DESC") {
+				column.Direction = "DESC"
+			}
+			columns = append(columns, column)
+		}
+		if target >= 0 && len(columns) > 0 {
+			accesses[target].OrderBy = columns
+		}
+	}
+	return accesses, nil
+}
+
+// CandidateIndexColumns orders equality columns first (highest cardinality
+// leading), then either the ORDER BY columns or the first range column, the
+// usual rule for a composite B-tree that serves both lookup and sort.
+func CandidateIndexColumns(access TableAccess, cardinality map[string]int64) []IndexColumn {
+	seen := map[string]bool{}
+	var equality []string
+	for _, column := range access.Equality {
+		if key := strings.ToLower(column); !seen[key] {
+			seen[key] = true
+			equality = append(equality, column)
+		}
+	}
+	sort.SliceStable(equality, func(i, j int) bool {
+		return cardinality[strings.ToLower(equality[i])] > cardinality[strings.ToLower(equality[j])]
+	})
+	columns := make([]IndexColumn, 0, maxIndexAdviceColumns)
+	for _, column := range equality {
+		columns = append(columns, IndexColumn{Name: column})
+	}
+	var tail []IndexColumn
+	for _, column := range access.OrderBy {
+		if !seen[strings.ToLower(column.Name)] {
+			tail = append(tail, column)
+		}
+	}
+	rangeServesSort := len(access.Range) == 0 || (len(tail) > 0 && strings.EqualFold(tail[0].Name, access.Range[0]))
+	if len(tail) == 0 || !rangeServesSort {
+		tail = nil
+		for _, column := range access.Range {
+			if !seen[strings.ToLower(column)] {
+				tail = []IndexColumn{{Name: column}}
+				break
+			}
+		}
+	}
+	columns = append(columns, tail...)
+	if len(columns) > maxIndexAdviceColumns {
+		columns = columns[:maxIndexAdviceColumns]
+	}
+	return columns
+}
+
+type digestTableRef struct{ schema, table, alias string }
+
+func parseDigestTables(tokens []digestToken, database string) ([]digestTableRef, [][]digestToken) {
+	var refs []digestTableRef
+	var conditions [][]digestToken
+	for _, segment := range splitDigestTopLevel(tokens, ",") {
+		for len(segment) > 0 {
+			// skip join keywords before the table reference
+			for len(segment) > 0 && segment[0].keyword("JOIN", "INNER", "LEFT", "RIGHT", "OUTER", "CROSS", "STRAIGHT_JOIN", "NATURAL") {
+				segment = segment[1:]
+			}
+			if len(segment) == 0 {
+				break
+			}
+			end := len(segment)
+			depth := 0
+			for index, token := range segment {
+				switch token.text {
+				case "(":
+					depth++
+				case ")":
+					depth--
+				}
+				if depth == 0 && index > 0 && token.keyword("JOIN", "STRAIGHT_JOIN") {
+					end = index
+					for end > 0 && segment[end-1].keyword("INNER", "LEFT", "RIGHT", "OUTER", "CROSS", "NATURAL") {
+						end--
+					}
+					break
+				}
+			}
+			ref, condition, ok := parseDigestTableRef(segment[:end], database)
+			if ok {
+				refs = append(refs, ref)
+			}
+			if condition != nil {
+				conditions = append(conditions, condition)
+			}
+			segment = segment[end:]
+		}
+	}
+	return refs, conditions
+}
+
+func parseDigestTableRef(tokens []digestToken, database string) (digestTableRef, []digestToken, bool) {
+	var condition []digestToken
+	for index, token := range tokens {
+		if token.keyword("ON") {
+			condition = tokens[index+1:]
+			tokens = tokens[:index]
+			break
+		}
+		if token.keyword("USING") {
+			tokens = tokens[:index]
+			break
+		}
+	}
+	for len(tokens) > 0 && tokens[0].keyword("LOW_PRIORITY", "IGNORE", "QUICK") {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || !tokens[0].identifier() {
+		return digestTableRef{}, condition, false
+	}
+	ref := digestTableRef{schema: database, table: tokens[0].text}
+	rest := tokens[1:]
+	if len(rest) >= 2 && rest[0].text == "." && rest[1].identifier() {
+		ref.schema, ref.table, rest = tokens[0].text, rest[1].text, rest[2:]
+	}
+	if len(rest) > 0 && rest[0].keyword("PARTITION") {
+		rest = skipDigestParenthesised(rest[1:])
+	}
+	if len(rest) > 0 && rest[0].keyword("AS") {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && rest[0].identifier() {
+		ref.alias = rest[0].text
+	}
+	return ref, condition, ref.schema != ""
+}
+
+func skipDigestParenthesised(tokens []digestToken) []digestToken {
+	depth := 0
+	for index, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return tokens[index+1:]
+			}
+		}
+	}
+	return nil
+}
+
+func classifyDigestPredicate(tokens []digestToken, resolve func([]string) int, accesses []TableAccess) {
+	left, rest := digestColumnRef(tokens)
+	if left == nil {
+		// value <op> column is mirrored
+		if len(tokens) >= 3 && digestValue(tokens[0]) {
+			if right, tail := digestColumnRef(tokens[2:]); right != nil && len(tail) == 0 {
+				if index := resolve(right); index >= 0 {
+					switch tokens[1].text {
+					case "=", "<=>":
+						accesses[index].Equality = append(accesses[index].Equality, right[len(right)-1])
+					case "<", ">", "<=", ">=":
+						accesses[index].Range = append(accesses[index].Range, right[len(right)-1])
+					}
+				}
+			}
+		}
+		return
+	}
+	index := resolve(left)
+	column := left[len(left)-1]
+	addEquality := func() {
+		if index >= 0 {
+			accesses[index].Equality = append(accesses[index].Equality, column)
+		}
+	}
+	addRange := func() {
+		if index >= 0 {
+			accesses[index].Range = append(accesses[index].Range, column)
+		}
+	}
+	if len(rest) == 0 {
+		return
+	}
+	op := rest[0]
+	switch {
+	case op.text == "=" || op.text == "<=>":
+		if len(rest) == 2 && digestValue(rest[1]) {
+			addEquality()
+			return
+		}
+		if right, tail := digestColumnRef(rest[1:]); right != nil && len(tail) == 0 {
+			addEquality()
+			if other := resolve(right); other >= 0 && other != index {
+				accesses[other].Equality = append(accesses[other].Equality, right[len(right)-1])
+			}
+		}
+	case op.text == "<" || op.text == ">" || op.text == "<=" || op.text == ">=":
+		if len(rest) == 2 && digestValue(rest[1]) {
+			addRange()
+		}
+	case op.keyword("IN"):
+		if len(rest) >= 3 && rest[1].text == "(" && !digestHasKeyword(rest, "SELECT") {
+			addEquality()
+		}
+	case op.keyword("BETWEEN"), op.keyword("LIKE"):
+		addRange()
+	case op.keyword("IS"):
+		if len(rest) == 2 && rest[1].keyword("NULL") {
+			addEquality()
+		} else if len(rest) == 3 && rest[1].keyword("NOT") && rest[2].keyword("NULL") {
+			addRange()
+		}
+	}
+}
+
+// digestColumnRef reads a possibly qualified column reference. A function
+// call such as DATE(col) is not a column reference.
+func digestColumnRef(tokens []digestToken) ([]string, []digestToken) {
+	if len(tokens) == 0 || !tokens[0].identifier() {
+		return nil, tokens
+	}
+	parts := []string{tokens[0].text}
+	rest := tokens[1:]
+	for len(rest) >= 2 && rest[0].text == "." && rest[1].identifier() && len(parts) < 3 {
+		parts = append(parts, rest[1].text)
+		rest = rest[2:]
+	}
+	if len(rest) > 0 && rest[0].text == "(" {
+		return nil, tokens
+	}
+	return parts, rest
+}
+
+func digestValue(token digestToken) bool {
+	if token.quoted {
+		return false
+	}
+	if token.text == "?" || token.keyword("NULL", "TRUE", "FALSE") || strings.HasPrefix(token.text, "'") || strings.HasPrefix(token.text, "\"") {
+		return true
+	}
+	r := []rune(token.text)
+	return len(r) > 0 && (unicode.IsDigit(r[0]) || ((r[0] == '-' || r[0] == '.') && len(r) > 1))
+}
+
+func splitDigestClauses(tokens []digestToken, keywords ...string) map[string][]digestToken {
+	clauses := map[string][]digestToken{}
+	current := ""
+	depth := 0
+	for _, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && token.keyword(keywords...) {
+			current = strings.ToUpper(token.text)
+			if clauses[current] == nil {
+				clauses[current] = []digestToken{}
+			}
+			continue
+		}
+		if current != "" {
+			clauses[current] = append(clauses[current], token)
+		}
+	}
+	return clauses
+}
+
+func splitDigestTopLevel(tokens []digestToken, separator string) [][]digestToken {
+	var parts [][]digestToken
+	start, depth := 0, 0
+	for index, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && (token.text == separator || token.keyword(separator)) {
+			parts = append(parts, tokens[start:index])
+			start = index + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+// splitDigestConjuncts splits on top-level AND, keeping BETWEEN x AND y
+// together.
+func splitDigestConjuncts(tokens []digestToken) [][]digestToken {
+	var parts [][]digestToken
+	start, depth := 0, 0
+	between := false
+	for index, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth != 0 {
+			continue
+		}
+		if token.keyword("BETWEEN") {
+			between = true
+			continue
+		}
+		if token.keyword("AND") {
+			if between {
+				between = false
+				continue
+			}
+			parts = append(parts, tokens[start:index])
+			start = index + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+func digestHasTopLevel(tokens []digestToken, keyword string) bool {
+	depth := 0
+	for _, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && (token.keyword(keyword) || (keyword == "OR" && token.text == "||")) {
+			return true
+		}
+	}
+	return false
+}
+
+func digestHasKeyword(tokens []digestToken, keyword string) bool {
+	for _, token := range tokens {
+		if token.keyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func lexDigest(text string) []digestToken {
+	var tokens []digestToken
+	runes := []rune(text)
+	for index := 0; index < len(runes); {
+		r := runes[index]
+		switch {
+		case unicode.IsSpace(r):
+			index++
+		case r == '/' && index+1 < len(runes) && runes[index+1] == '*':
+			end := strings.Index(string(runes[index+2:]), "*/")
+			if end < 0 {
+				return tokens
+			}
+			index += 2 + len([]rune(string(runes[index+2:])[:end])) + 2
+		case r == '#' || (r == '-' && index+2 < len(runes) && runes[index+1] == '-' && unicode.IsSpace(runes[index+2])):
+			for index < len(runes) && runes[index] != '\n' {
+				index++
+			}
+		case r == '`':
+			end := index + 1
+			var b strings.Builder
+			for end < len(runes) {
+				if runes[end] == '`' {
+					if end+1 < len(runes) && runes[end+1] == '`' {
+						b.WriteRune('`')
+						end += 2
+						continue
+					}
+					break
+				}
+				b.WriteRune(runes[end])
+				end++
+			}
+			tokens = append(tokens, digestToken{text: b.String(), quoted: true})
+			index = end + 1
+		case r == '\'' || r == '"':
+			end := index + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+			tokens = append(tokens, digestToken{text: string(runes[index : end+1])})
+			index = end + 1
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$':
+			end := index
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '$') {
+				end++
+			}
+			tokens = append(tokens, digestToken{text: string(runes[index:end])})
+			index = end
+		case r == '.' && index+2 < len(runes) && runes[index+1] == '.' && runes[index+2] == '.':
+			tokens = append(tokens, digestToken{text: "..."})
+			index += 3
+		default:
+			op := string(r)
+			if index+2 < len(runes) && string(runes[index:index+3]) == "<=>" {
+				op = "<=>"
+			} else if index+1 < len(runes) {
+				switch pair := string(runes[index : index+2]); pair {
+				case "<=", ">=", "<>", "!=", "||", "&&":
+					op = pair
+				}
+			}
+			index += len([]rune(op))
+			if op == "&&" {
+				op = "AND"
+			}
+			tokens = append(tokens, digestToken{text: op})
+		}
+	}
+	return tokens
+}
+
+// TableIndexStats is the part of the data dictionary the index advisor needs
+// to validate and size a suggestion.
+type TableIndexStats struct {
+	Schema      string                `json:"schema"`
+	Table       string                `json:"table"`
+	Engine      string                `json:"engine"`
+	Rows        int64                 `json:"rows"`
+	DataLength  int64                 `json:"data_length"`
+	IndexLength int64                 `json:"index_length"`
+	Columns     map[string]ColumnInfo `json:"columns"`
+	Indexes     []ExistingIndex       `json:"indexes"`
+	Cardinality map[string]int64      `json:"cardinality,omitempty"`
+	PrimaryKey  []string              `json:"primary_key,omitempty"`
+}
+
+type ColumnInfo struct {
+	Name              string `json:"name"`
+	DataType          string `json:"data_type"`
+	OctetLength       int64  `json:"octet_length,omitempty"`
+	NumericPrecision  int64  `json:"numeric_precision,omitempty"`
+	DatetimePrecision int64  `json:"datetime_precision,omitempty"`
+	Nullable          bool   `json:"nullable"`
+}
+
+type ExistingIndex struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Columns []string `json:"columns"`
+}
+
+// LoadTableIndexStats reads table size, columns and existing indexes from
+// information_schema. The boolean is false when the table does not exist.
+func (c DiagnosticClient) LoadTableIndexStats(ctx context.Context, db *sql.DB, schema, table string) (TableIndexStats, bool, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	stats := TableIndexStats{Schema: schema, Table: table, Columns: map[string]ColumnInfo{}, Cardinality: map[string]int64{}}
+	err := db.QueryRowContext(queryCtx, `
+		select coalesce(engine, ''), coalesce(table_rows, 0), coalesce(data_length, 0), coalesce(index_length, 0)
+		from information_schema.tables
+		where table_schema = ? and table_name = ? and table_type = 'BASE TABLE'
+	`, schema, table).Scan(&stats.Engine, &stats.Rows, &stats.DataLength, &stats.IndexLength)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stats, false, nil
+	}
+	if err != nil {
+		return stats, false, err
+	}
+	columns, err := db.QueryContext(queryCtx, `
+		select column_name, data_type, coalesce(character_octet_length, 0), coalesce(numeric_precision, 0),
+			coalesce(datetime_precision, 0), is_nullable = 'YES'
+		from information_schema.columns
+		where table_schema = ? and table_name = ?
+	`, schema, table)
+	if err != nil {
+		return stats, false, err
+	}
+	for columns.Next() {
+		var column ColumnInfo
+		if err := columns.Scan(&column.Name, &column.DataType, &column.OctetLength, &column.NumericPrecision, &column.DatetimePrecision, &column.Nullable); err != nil {
+			columns.Close()
+			return stats, false, err
+		}
+		column.DataType = strings.ToLower(column.DataType)
+		stats.Columns[strings.ToLower(column.Name)] = column
+	}
+	if err := columns.Close(); err != nil {
+		return stats, false, err
+	}
+	indexes, err := db.QueryContext(queryCtx, `
+		select index_name, non_unique = 0, seq_in_index, column_name, coalesce(cardinality, 0)
+		from information_schema.statistics
+		where table_schema = ? and table_name = ? and column_name is not null
+		order by index_name, seq_in_index
+	`, schema, table)
+	if err != nil {
+		return stats, false, err
+	}
+	defer indexes.Close()
+	positions := map[string]int{}
+	for indexes.Next() {
+		var name, column string
+		var unique bool
+		var seq int
+		var cardinality int64
+		if err := indexes.Scan(&name, &unique, &seq, &column, &cardinality); err != nil {
+			return stats, false, err
+		}
+		position, ok := positions[name]
+		if !ok {
+			position = len(stats.Indexes)
+			positions[name] = position
+			stats.Indexes = append(stats.Indexes, ExistingIndex{Name: name, Unique: unique})
+		}
+		stats.Indexes[position].Columns = append(stats.Indexes[position].Columns, column)
+		if seq == 1 && cardinality > stats.Cardinality[strings.ToLower(column)] {
+			stats.Cardinality[strings.ToLower(column)] = cardinality
+		}
+		if name == "PRIMARY" {
+			stats.PrimaryKey = append(stats.PrimaryKey, column)
+		}
+	}
+	return stats, true, indexes.Err()
+}
+
+// CoveringIndex returns an existing index whose leading columns already are
+// the candidate, in which case the suggestion would be a duplicate.
+func (s TableIndexStats) CoveringIndex(columns []IndexColumn) (string, bool) {
+	for _, index := range s.Indexes {
+		if indexHasPrefix(index.Columns, columns) {
+			return index.Name, true
+		}
+	}
+	return "", false
+}
+
+// RedundantIndexes lists secondary non-unique indexes that become a left
+// prefix of the candidate and could be dropped once it exists.
+func (s TableIndexStats) RedundantIndexes(columns []IndexColumn) []string {
+	var names []string
+	for _, index := range s.Indexes {
+		if index.Unique || index.Name == "PRIMARY" || len(index.Columns) >= len(columns) {
+			continue
+		}
+		if indexHasPrefix(columnNames(columns), namesAsColumns(index.Columns)) {
+			names = append(names, index.Name)
+		}
+	}
+	return names
+}
+
+// EstimateIndexBytes approximates the on-disk size of a secondary index:
+// key columns plus the primary key per row, record overhead, and a page
+// fill factor of roughly 70%. TEXT and BLOB columns need a prefix length
+// and are rejected.
+func (s TableIndexStats) EstimateIndexBytes(columns []IndexColumn) (int64, error) {
+	keyBytes := int64(0)
+	keyed := map[string]bool{}
+	for _, column := range columns {
+		info, ok := s.Columns[strings.ToLower(column.Name)]
+		if !ok {
+			return 0, errors.New("column " + column.Name + " does not exist")
+		}
+		size, err := indexColumnBytes(info)
+		if err != nil {
+			return 0, err
+		}
+		keyed[strings.ToLower(column.Name)] = true
+		keyBytes += size
+	}
+	for _, name := range s.PrimaryKey {
+		if info, ok := s.Columns[strings.ToLower(name)]; ok && !keyed[strings.ToLower(name)] {
+			size, _ := indexColumnBytes(info)
+			keyBytes += size
+		}
+	}
+	if len(s.PrimaryKey) == 0 {
+		keyBytes += 6 // implicit DB_ROW_ID
+	}
+	rows := s.Rows
+	if rows < 0 {
+		rows = 0
+	}
+	return rows * (keyBytes + 6) * 10 / 7, nil
+}
+
+func indexColumnBytes(info ColumnInfo) (int64, error) {
+	size := int64(0)
+	switch info.DataType {
+	case "tinyint", "year":
+		size = 1
+	case "smallint", "enum":
+		size = 2
+	case "mediumint", "date", "time":
+		size = 3
+	case "int", "integer", "float", "timestamp":
+		size = 4
+	case "bigint", "double", "real", "set", "bit":
+		size = 8
+	case "datetime":
+		size = 5
+	case "decimal", "numeric":
+		size = info.NumericPrecision/2 + 1
+	case "char", "binary":
+		size = info.OctetLength
+	case "varchar", "varbinary":
+		// variable-length keys are stored at their actual length; assume half
+		size = info.OctetLength/2 + 2
+	default:
+		return 0, errors.New("column " + info.Name + " (" + info.DataType + ") cannot be indexed without a prefix length")
+	}
+	if info.DataType == "datetime" || info.DataType == "timestamp" || info.DataType == "time" {
+		size += (info.DatetimePrecision + 1) / 2
+	}
+	if info.Nullable {
+		size++
+	}
+	return size, nil
+}
+
+func indexHasPrefix(indexColumns []string, prefix []IndexColumn) bool {
+	if len(prefix) == 0 || len(indexColumns) < len(prefix) {
+		return false
+	}
+	for index, column := range prefix {
+		if !strings.EqualFold(indexColumns[index], column.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func columnNames(columns []IndexColumn) []string {
+	names := make([]string, len(columns))
+	for index, column := range columns {
+		names[index] = column.Name
+	}
+	return names
+}
+
+func namesAsColumns(names []string) []IndexColumn {
+	columns := make([]IndexColumn, len(names))
+	for index, name := range names {
+		columns[index] = IndexColumn{Name: name}
+	}
+	return columns
+}
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDigestAccessSingleTable(t *testing.T) {
+	accesses, err := ParseDigestAccess("SELECT `id` , `status` FROM `orders` WHERE `user_id` = ? AND `status` IN (...) AND `created_at` >= ? ORDER BY `created_at` DESC LIMIT ?", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TableAccess{{
+		Schema: "shop", Table: "orders", Equality: []string{"user_id", "status"}, Range: []string{"created_at"},
+		OrderBy: []IndexColumn{{Name: "created_at", Direction: "DESC"}},
+	}}
+	if !reflect.DeepEqual(accesses, want) {
+		t.Fatalf("unexpected access: %+v", accesses)
+	}
+	columns := CandidateIndexColumns(accesses[0], map[string]int64{"status": 5, "user_id": 90000})
+	if !reflect.DeepEqual(columns, []IndexColumn{{Name: "user_id"}, {Name: "status"}, {Name: "created_at", Direction: "DESC"}}) {
+		t.Fatalf("unexpected candidate: %+v", columns)
+	}
+}
+
+func TestParseDigestAccessJoinsAndUnsupportedShapes(t *testing.T) {
+	accesses, err := ParseDigestAccess("SELECT `o` . `id` FROM `shop` . `orders` AS `o` LEFT JOIN `order_items` `i` ON `i` . `order_id` = `o` . `id` WHERE `o` . `tenant_id` = ? AND `i` . `sku` LIKE ? AND DATE ( `o` . `paid_at` ) = ? ORDER BY `o` . `id`", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 2 || accesses[0].Schema != "shop" || accesses[1].Schema != "app" {
+		t.Fatalf("unexpected tables: %+v", accesses)
+	}
+	if !reflect.DeepEqual(accesses[0].Equality, []string{"id", "tenant_id"}) || len(accesses[0].OrderBy) != 1 {
+		t.Fatalf("unexpected orders access: %+v", accesses[0])
+	}
+	if !reflect.DeepEqual(accesses[1].Equality, []string{"order_id"}) || !reflect.DeepEqual(accesses[1].Range, []string{"sku"}) {
+		t.Fatalf("unexpected items access: %+v", accesses[1])
+	}
+	// A top-level OR makes the WHERE clause unusable for a single index.
+	accesses, err = ParseDigestAccess("UPDATE `orders` SET `status` = ? WHERE `user_id` = ? OR `id` = ?", "shop")
+	if err != nil || len(accesses) != 1 || len(accesses[0].Equality) != 0 {
+		t.Fatalf("OR predicates must be ignored: %+v %v", accesses, err)
+	}
+	accesses, err = ParseDigestAccess("DELETE FROM `jobs` WHERE `state` = ? AND `run_at` BETWEEN ? AND ? AND `owner` = ?", "ops")
+	if err != nil || !reflect.DeepEqual(accesses[0].Equality, []string{"state", "owner"}) || !reflect.DeepEqual(accesses[0].Range, []string{"run_at"}) {
+		t.Fatalf("BETWEEN must not split conjuncts: %+v %v", accesses, err)
+	}
+	for _, text := range []string{"INSERT INTO `t` VALUES (...)", "SELECT ? UNION SELECT ?", "SELECT ?"} {
+		if _, err := ParseDigestAccess(text, "app"); err == nil {
+			t.Fatalf("%q should not be analysed", text)
+		}
+	}
+}
+
+func TestCandidateIndexColumnsPrefersRangeWhenSortCannotBeServed(t *testing.T) {
+	access := TableAccess{Equality: []string{"tenant_id"}, Range: []string{"created_at"}, OrderBy: []IndexColumn{{Name: "amount"}}}
+	if columns := CandidateIndexColumns(access, nil); !reflect.DeepEqual(columns, []IndexColumn{{Name: "tenant_id"}, {Name: "created_at"}}) {
+		t.Fatalf("unexpected candidate: %+v", columns)
+	}
+	access.Range = nil
+	if columns := CandidateIndexColumns(access, nil); !reflect.DeepEqual(columns, []IndexColumn{{Name: "tenant_id"}, {Name: "amount"}}) {
+		t.Fatalf("unexpected candidate: %+v", columns)
+	}
+}
+
+func TestTableIndexStatsValidationAndSize(t *testing.T) {
+	stats := TableIndexStats{
+		Rows: 1000000, PrimaryKey: []string{"id"},
+		Columns: map[string]ColumnInfo{
+			"id":        {Name: "id", DataType: "bigint"},
+			"tenant_id": {Name: "tenant_id", DataType: "int"},
+			"status":    {Name: "status", DataType: "varchar", OctetLength: 64, Nullable: true},
+			"note":      {Name: "note", DataType: "text"},
+		},
+		Indexes: []ExistingIndex{
+			{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+			{Name: "idx_tenant", Columns: []string{"tenant_id"}},
+			{Name: "idx_tenant_status_id", Columns: []string{"tenant_id", "status", "id"}},
+		},
+	}
+	if name, ok := stats.CoveringIndex([]IndexColumn{{Name: "TENANT_ID"}, {Name: "status"}}); !ok || name != "idx_tenant_status_id" {
+		t.Fatalf("expected covering index, got %q %v", name, ok)
+	}
+	if _, ok := stats.CoveringIndex([]IndexColumn{{Name: "status"}}); ok {
+		t.Fatal("a non-leading column is not covered")
+	}
+	if names := stats.RedundantIndexes([]IndexColumn{{Name: "tenant_id"}, {Name: "created_at"}}); !reflect.DeepEqual(names, []string{"idx_tenant"}) {
+		t.Fatalf("unexpected redundant indexes: %v", names)
+	}
+	size, err := stats.EstimateIndexBytes([]IndexColumn{{Name: "tenant_id"}, {Name: "status"}})
+	// int 4 + varchar(16 utf8mb4) 34+1 + bigint pk 8 + 6 overhead = 53 bytes, /0.7 fill
+	if err != nil || size != 1000000*53*10/7 {
+		t.Fatalf("unexpected size %d %v", size, err)
+	}
+	if _, err := stats.EstimateIndexBytes([]IndexColumn{{Name: "note"}}); err == nil {
+		t.Fatal("TEXT columns need a prefix length")
+	}
+	if _, err := stats.EstimateIndexBytes([]IndexColumn{{Name: "missing"}}); err == nil {
+		t.Fatal("missing columns must be rejected")
+	}
+}
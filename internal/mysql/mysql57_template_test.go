@@ -81,3 +81,31 @@ func TestMySQLTemplateUsesPatchLevelOptionNames(t *testing.T) {
 		})
 	}
 }
+
+func TestMySQLTemplateRendersTLSOnlyWhenCertificateIsIssued(t *testing.T) {
+	source, err := os.ReadFile("../../configs/templates/mysql/my.cnf.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := template.New("my.cnf").Parse(string(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain bytes.Buffer
+	if err := tpl.Execute(&plain, ConfigVars{TransactionIsolation: "READ-COMMITTED"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain.String(), "ssl_cert") || strings.Contains(plain.String(), "require_secure_transport") {
+		t.Fatalf("config without certificate must not reference TLS files:\n%s", plain.String())
+	}
+	var secured bytes.Buffer
+	vars := ConfigVars{TransactionIsolation: "READ-COMMITTED", TLSCAPath: "/data/mysql/3306/tls/ca.pem", TLSCertPath: "/data/mysql/3306/tls/server-cert.pem", TLSKeyPath: "/data/mysql/3306/tls/server-key.pem", RequireSecureTransport: 1}
+	if err := tpl.Execute(&secured, vars); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"ssl_ca = /data/mysql/3306/tls/ca.pem", "ssl_cert = /data/mysql/3306/tls/server-cert.pem", "ssl_key = /data/mysql/3306/tls/server-key.pem", "require_secure_transport = 1"} {
+		if !strings.Contains(secured.String(), expected) {
+			t.Fatalf("TLS config missing %q:\n%s", expected, secured.String())
+		}
+	}
+}
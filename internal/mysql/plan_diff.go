@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+)
+
+// PlanSteps reduces traditional EXPLAIN rows to comparable access-path steps.
+func PlanSteps(plan ExecutionPlan) []sqldomain.PlanStep {
+	steps := make([]sqldomain.PlanStep, 0, len(plan.Rows))
+	for _, row := range plan.Rows {
+		values := make(map[string]string, len(row))
+		for column, value := range row {
+			if value == nil {
+				continue
+			}
+			values[strings.ToLower(column)] = strings.TrimSpace(fmt.Sprint(value))
+		}
+		step := sqldomain.PlanStep{
+			ID: values["id"], SelectType: values["select_type"], Table: values["table"],
+			AccessType: values["type"], Key: values["key"], Extra: values["extra"],
+		}
+		step.Rows, _ = strconv.ParseInt(values["rows"], 10, 64)
+		step.Filtered, _ = strconv.ParseFloat(values["filtered"], 64)
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// PlanSignature identifies the access path; row estimates drift with data
+// and are deliberately left out.
+func PlanSignature(steps []sqldomain.PlanStep) string {
+	var b strings.Builder
+	for _, step := range steps {
+		fmt.Fprintf(&b, "%s|%s|%s|%s|%s|%s\n", step.ID, step.SelectType, step.Table, step.AccessType, step.Key, step.Extra)
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// DiffPlanSteps lists access-path changes between two plans, pairing steps by
+// query block id and table. Row estimates are reported when they move by an
+// order of magnitude.
+func DiffPlanSteps(before, after []sqldomain.PlanStep) []string {
+	key := func(step sqldomain.PlanStep) string { return step.ID + "/" + step.Table }
+	previous := make(map[string]sqldomain.PlanStep, len(before))
+	for _, step := range before {
+		previous[key(step)] = step
+	}
+	var changes []string
+	seen := make(map[string]bool, len(after))
+	for _, step := range after {
+		k := key(step)
+		seen[k] = true
+		old, ok := previous[k]
+		name := planStepName(step)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s: 新增访问（type=%s, key=%s）", name, planValue(step.AccessType), planValue(step.Key)))
+			continue
+		}
+		if old.AccessType != step.AccessType {
+			changes = append(changes, fmt.Sprintf("%s: 访问方式 %s → %s", name, planValue(old.AccessType), planValue(step.AccessType)))
+		}
+		if old.Key != step.Key {
+			changes = append(changes, fmt.Sprintf("%s: 使用索引 %s → %s", name, planValue(old.Key), planValue(step.Key)))
+		}
+		if old.Extra != step.Extra {
+			changes = append(changes, fmt.Sprintf("%s: Extra %s → %s", name, planValue(old.Extra), planValue(step.Extra)))
+		}
+		if rowsMovedByMagnitude(old.Rows, step.Rows) {
+			changes = append(changes, fmt.Sprintf("%s: 预估行数 %d → %d", name, old.Rows, step.Rows))
+		}
+	}
+	for _, step := range before {
+		if !seen[key(step)] {
+			changes = append(changes, fmt.Sprintf("%s: 不再访问", planStepName(step)))
+		}
+	}
+	return changes
+}
+
+func planStepName(step sqldomain.PlanStep) string {
+	table := step.Table
+	if table == "" {
+		table = "(no table)"
+	}
+	if step.ID == "" {
+		return table
+	}
+	return "#" + step.ID + " " + table
+}
+
+func planValue(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
+}
+
+func rowsMovedByMagnitude(before, after int64) bool {
+	if before <= 0 || after <= 0 {
+		return before != after && (before >= 10 || after >= 10)
+	}
+	return after >= before*10 || before >= after*10
+}
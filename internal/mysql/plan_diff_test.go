@@ -0,0 +1,40 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanDiffReportsAccessPathChanges(t *testing.T) {
+	before := PlanSteps(ExecutionPlan{Rows: []map[string]any{
+		{"id": int64(1), "select_type": "SIMPLE", "table": "orders", "type": "ref", "key": "idx_user", "rows": int64(12), "filtered": 100.0, "Extra": nil},
+		{"id": int64(1), "select_type": "SIMPLE", "table": "items", "type": "eq_ref", "key": "PRIMARY", "rows": int64(1), "filtered": 100.0},
+	}})
+	after := PlanSteps(ExecutionPlan{Rows: []map[string]any{
+		{"ID": "1", "SELECT_TYPE": "SIMPLE", "TABLE": "orders", "TYPE": "ALL", "KEY": nil, "ROWS": "480000", "FILTERED": "10.00", "EXTRA": "Using where"},
+		{"ID": "1", "SELECT_TYPE": "SIMPLE", "TABLE": "items", "TYPE": "eq_ref", "KEY": "PRIMARY", "ROWS": "3", "FILTERED": "100.00"},
+	}})
+	if after[0].Rows != 480000 || after[0].Filtered != 10 || after[0].Key != "" || before[0].ID != "1" {
+		t.Fatalf("unexpected steps: %+v %+v", before, after)
+	}
+	if PlanSignature(before) == PlanSignature(after) {
+		t.Fatal("different access paths must have different signatures")
+	}
+	rowsOnly := append(before[:0:0], before...)
+	rowsOnly[0].Rows = 15
+	if PlanSignature(before) != PlanSignature(rowsOnly) || len(DiffPlanSteps(before, rowsOnly)) != 0 {
+		t.Fatal("small row estimate drift must not change the plan")
+	}
+	changes := strings.Join(DiffPlanSteps(before, after), "\n")
+	for _, want := range []string{"#1 orders: 访问方式 ref → ALL", "使用索引 idx_user → (none)", "Extra (none) → Using where", "预估行数 12 → 480000"} {
+		if !strings.Contains(changes, want) {
+			t.Fatalf("missing %q in:\n%s", want, changes)
+		}
+	}
+	if strings.Contains(changes, "items") {
+		t.Fatalf("unchanged steps must not be reported:\n%s", changes)
+	}
+	if changes := DiffPlanSteps(before, after[:1]); len(changes) == 0 || !strings.Contains(changes[len(changes)-1], "items: 不再访问") {
+		t.Fatalf("removed step not reported: %v", changes)
+	}
+}
@@ -175,3 +175,18 @@ func parseProfile(name, content string) (Profile, error) {
 	}
 	return p, nil
 }
+
+// ProfileParameters 返回计算结果中由配置档案决定的 my.cnf 参数，参数模板以此作为按机器计算的基线。
+func ProfileParameters(vars ConfigVars) map[string]string {
+	return map[string]string{
+		"innodb_buffer_pool_size":      vars.BufferPoolSize,
+		"innodb_buffer_pool_instances": strconv.Itoa(vars.BufferPoolInstances),
+		"max_connections":              strconv.Itoa(vars.MaxConnections),
+		"table_open_cache":             strconv.Itoa(vars.TableOpenCache),
+		"thread_cache_size":            strconv.Itoa(vars.ThreadCacheSize),
+		"sort_buffer_size":             vars.SortBufferSize,
+		"read_buffer_size":             vars.ReadBufferSize,
+		"read_rnd_buffer_size":         vars.ReadRndBufferSize,
+		"join_buffer_size":             vars.JoinBufferSize,
+	}
+}
@@ -0,0 +1,335 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	schemadomain "gmha/internal/domain/schemasnapshot"
+)
+
+var (
+	definerRE   = regexp.MustCompile("DEFINER=`(?:[^`]|``)*`@`(?:[^`]|``)*`\\s*")
+	intWidthRE  = regexp.MustCompile(`(?i)\b(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+	partitionRE = regexp.MustCompile(`(?is)(/\*!\d+\s*)?\bPARTITION BY\b.*`)
+)
+
+// DiffSchemas compares two definitions and returns the changes that turn
+// target into source, with the DDL to apply on target. schemas optionally
+// restricts the comparison to the named schemas.
+//
+// Definitions are compared after normalizing differences that do not change
+// the schema: definers, whitespace, integer display widths and the utf8mb3
+// alias, so a 5.7 replica does not drift from an 8.0 primary on those alone.
+func DiffSchemas(source, target schemadomain.Definition, schemas []string) schemadomain.Diff {
+	only := make(map[string]bool, len(schemas))
+	for _, name := range schemas {
+		if name = strings.TrimSpace(name); name != "" {
+			only[name] = true
+		}
+	}
+	sourceSchemas, targetSchemas := schemaIndex(source, only), schemaIndex(target, only)
+	diff := schemadomain.Diff{Items: []schemadomain.DiffItem{}}
+	for _, name := range unionKeys(sourceSchemas, targetSchemas) {
+		from, inSource := sourceSchemas[name]
+		to, inTarget := targetSchemas[name]
+		switch {
+		case !inTarget:
+			diff.Items = append(diff.Items, schemadomain.DiffItem{
+				ObjectType: schemadomain.ObjectSchema, Change: schemadomain.ChangeMissing, Schema: name, Name: name,
+				Source: from.Charset + " / " + from.Collation,
+				DDL:    []string{fmt.Sprintf("CREATE DATABASE %s DEFAULT CHARACTER SET %s COLLATE %s;", quoteMySQLIdentifier(name), from.Charset, from.Collation)},
+			})
+			diffSchemaObjects(&diff, from, schemadomain.Schema{Name: name})
+		case !inSource:
+			diff.Items = append(diff.Items, schemadomain.DiffItem{
+				ObjectType: schemadomain.ObjectSchema, Change: schemadomain.ChangeExtra, Schema: name, Name: name,
+				Target: to.Charset + " / " + to.Collation, Destructive: true,
+				DDL: []string{fmt.Sprintf("DROP DATABASE %s;", quoteMySQLIdentifier(name))},
+			})
+		default:
+			if normalizeSchemaSQL(from.Charset+" "+from.Collation) != normalizeSchemaSQL(to.Charset+" "+to.Collation) {
+				diff.Items = append(diff.Items, schemadomain.DiffItem{
+					ObjectType: schemadomain.ObjectSchema, Change: schemadomain.ChangeChanged, Schema: name, Name: name,
+					Source: from.Charset + " / " + from.Collation, Target: to.Charset + " / " + to.Collation,
+					DDL: []string{fmt.Sprintf("ALTER DATABASE %s DEFAULT CHARACTER SET %s COLLATE %s;", quoteMySQLIdentifier(name), from.Charset, from.Collation)},
+				})
+			}
+			diffSchemaObjects(&diff, from, to)
+		}
+	}
+	for _, item := range diff.Items {
+		switch item.Change {
+		case schemadomain.ChangeMissing:
+			diff.Missing++
+		case schemadomain.ChangeExtra:
+			diff.Extra++
+		default:
+			diff.Changed++
+		}
+	}
+	return diff
+}
+
+func diffSchemaObjects(diff *schemadomain.Diff, source, target schemadomain.Schema) {
+	schema := source.Name
+	sourceTables, targetTables := make(map[string]schemadomain.Table), make(map[string]schemadomain.Table)
+	for _, table := range source.Tables {
+		sourceTables[table.Name] = table
+	}
+	for _, table := range target.Tables {
+		targetTables[table.Name] = table
+	}
+	for _, name := range unionKeys(sourceTables, targetTables) {
+		from, inSource := sourceTables[name]
+		to, inTarget := targetTables[name]
+		qualified := quoteMySQLIdentifier(schema) + "." + quoteMySQLIdentifier(name)
+		switch {
+		case !inTarget:
+			diff.Items = append(diff.Items, schemadomain.DiffItem{
+				ObjectType: schemadomain.ObjectTable, Change: schemadomain.ChangeMissing, Schema: schema, Table: name, Name: name,
+				Source: from.CreateSQL, DDL: []string{strings.Replace(from.CreateSQL, quoteMySQLIdentifier(name), qualified, 1) + ";"},
+			})
+		case !inSource:
+			diff.Items = append(diff.Items, schemadomain.DiffItem{
+				ObjectType: schemadomain.ObjectTable, Change: schemadomain.ChangeExtra, Schema: schema, Table: name, Name: name,
+				Target: to.CreateSQL, Destructive: true, DDL: []string{fmt.Sprintf("DROP TABLE %s;", qualified)},
+			})
+		default:
+			if normalizeSchemaSQL(from.CreateSQL) != normalizeSchemaSQL(to.CreateSQL) {
+				diffTable(diff, schema, from, to)
+			}
+		}
+	}
+	diffObjects(diff, schema, schemadomain.ObjectView, source.Views, target.Views)
+	diffObjects(diff, schema, schemadomain.ObjectTrigger, source.Triggers, target.Triggers)
+	sourceRoutines, targetRoutines := make([]schemadomain.Object, 0, len(source.Routines)), make([]schemadomain.Object, 0, len(target.Routines))
+	for _, routine := range source.Routines {
+		sourceRoutines = append(sourceRoutines, schemadomain.Object{Name: routine.Type + " " + routine.Name, CreateSQL: routine.CreateSQL})
+	}
+	for _, routine := range target.Routines {
+		targetRoutines = append(targetRoutines, schemadomain.Object{Name: routine.Type + " " + routine.Name, CreateSQL: routine.CreateSQL})
+	}
+	diffObjects(diff, schema, schemadomain.ObjectRoutine, sourceRoutines, targetRoutines)
+}
+
+func diffTable(diff *schemadomain.Diff, schema string, source, target schemadomain.Table) {
+	qualified := quoteMySQLIdentifier(schema) + "." + quoteMySQLIdentifier(source.Name)
+	alter := func(clause string) string { return fmt.Sprintf("ALTER TABLE %s %s;", qualified, clause) }
+	item := func(objectType, change, name, from, to string, destructive bool, ddl ...string) {
+		diff.Items = append(diff.Items, schemadomain.DiffItem{
+			ObjectType: objectType, Change: change, Schema: schema, Table: source.Name, Name: name,
+			Source: from, Target: to, Destructive: destructive, DDL: ddl,
+		})
+	}
+
+	targetColumns := partIndex(target.Columns)
+	previous := ""
+	for _, column := range source.Columns {
+		existing, ok := targetColumns[column.Name]
+		position := " FIRST"
+		if previous != "" {
+			position = " AFTER " + quoteMySQLIdentifier(previous)
+		}
+		previous = column.Name
+		switch {
+		case !ok:
+			item(schemadomain.ObjectColumn, schemadomain.ChangeMissing, column.Name, column.SQL, "", false, alter("ADD COLUMN "+column.SQL+position))
+		case normalizeSchemaSQL(existing.SQL) != normalizeSchemaSQL(column.SQL):
+			item(schemadomain.ObjectColumn, schemadomain.ChangeChanged, column.Name, column.SQL, existing.SQL, false, alter("MODIFY COLUMN "+column.SQL))
+		}
+	}
+	sourceColumns := partIndex(source.Columns)
+	for _, column := range target.Columns {
+		if _, ok := sourceColumns[column.Name]; !ok {
+			item(schemadomain.ObjectColumn, schemadomain.ChangeExtra, column.Name, "", column.SQL, true, alter("DROP COLUMN "+quoteMySQLIdentifier(column.Name)))
+		}
+	}
+
+	dropIndex := func(name string) string {
+		if name == "PRIMARY" {
+			return "DROP PRIMARY KEY"
+		}
+		return "DROP INDEX " + quoteMySQLIdentifier(name)
+	}
+	sourceIndexes, targetIndexes := partIndex(source.Indexes), partIndex(target.Indexes)
+	for _, name := range unionKeys(sourceIndexes, targetIndexes) {
+		from, inSource := sourceIndexes[name]
+		to, inTarget := targetIndexes[name]
+		switch {
+		case !inTarget:
+			item(schemadomain.ObjectIndex, schemadomain.ChangeMissing, name, from.SQL, "", false, alter("ADD "+from.SQL))
+		case !inSource:
+			item(schemadomain.ObjectIndex, schemadomain.ChangeExtra, name, "", to.SQL, false, alter(dropIndex(name)))
+		case normalizeSchemaSQL(from.SQL) != normalizeSchemaSQL(to.SQL):
+			item(schemadomain.ObjectIndex, schemadomain.ChangeChanged, name, from.SQL, to.SQL, false, alter(dropIndex(name)+", ADD "+from.SQL))
+		}
+	}
+
+	dropConstraint := func(part schemadomain.Part) string {
+		if strings.Contains(strings.ToUpper(part.SQL), " FOREIGN KEY ") {
+			return alter("DROP FOREIGN KEY " + quoteMySQLIdentifier(part.Name))
+		}
+		return alter("DROP CHECK " + quoteMySQLIdentifier(part.Name))
+	}
+	sourceConstraints, targetConstraints := partIndex(source.Constraints), partIndex(target.Constraints)
+	for _, name := range unionKeys(sourceConstraints, targetConstraints) {
+		from, inSource := sourceConstraints[name]
+		to, inTarget := targetConstraints[name]
+		switch {
+		case !inTarget:
+			item(schemadomain.ObjectConstraint, schemadomain.ChangeMissing, name, from.SQL, "", false, alter("ADD "+from.SQL))
+		case !inSource:
+			item(schemadomain.ObjectConstraint, schemadomain.ChangeExtra, name, "", to.SQL, false, dropConstraint(to))
+		case normalizeSchemaSQL(from.SQL) != normalizeSchemaSQL(to.SQL):
+			item(schemadomain.ObjectConstraint, schemadomain.ChangeChanged, name, from.SQL, to.SQL, false, dropConstraint(to), alter("ADD "+from.SQL))
+		}
+	}
+
+	if normalizeSchemaSQL(source.Options) != normalizeSchemaSQL(target.Options) {
+		sourceOptions, sourcePartition := splitPartition(source.Options)
+		targetOptions, targetPartition := splitPartition(target.Options)
+		var ddl []string
+		note := ""
+		if normalizeSchemaSQL(sourceOptions) != normalizeSchemaSQL(targetOptions) {
+			ddl = append(ddl, alter(sourceOptions))
+		}
+		if normalizeSchemaSQL(sourcePartition) != normalizeSchemaSQL(targetPartition) {
+			note = "分区定义不同，需要人工确认分区调整方案"
+		}
+		diff.Items = append(diff.Items, schemadomain.DiffItem{
+			ObjectType: schemadomain.ObjectOptions, Change: schemadomain.ChangeChanged, Schema: schema, Table: source.Name, Name: source.Name,
+			Source: source.Options, Target: target.Options, DDL: ddl, Note: note,
+		})
+	}
+}
+
+// diffObjects compares views, triggers and routines by their normalized
+// CREATE statement. Their bodies are reused verbatim, so DDL switches to the
+// schema first.
+func diffObjects(diff *schemadomain.Diff, schema, objectType string, source, target []schemadomain.Object) {
+	sourceObjects, targetObjects := make(map[string]schemadomain.Object), make(map[string]schemadomain.Object)
+	for _, object := range source {
+		sourceObjects[object.Name] = object
+	}
+	for _, object := range target {
+		targetObjects[object.Name] = object
+	}
+	use := "USE " + quoteMySQLIdentifier(schema) + ";"
+	drop := func(name string) string {
+		kind, objectName := strings.ToUpper(objectType), name
+		if objectType == schemadomain.ObjectRoutine {
+			kind, objectName, _ = strings.Cut(name, " ")
+		}
+		return fmt.Sprintf("DROP %s IF EXISTS %s.%s;", kind, quoteMySQLIdentifier(schema), quoteMySQLIdentifier(objectName))
+	}
+	for _, name := range unionKeys(sourceObjects, targetObjects) {
+		from, inSource := sourceObjects[name]
+		to, inTarget := targetObjects[name]
+		item := schemadomain.DiffItem{ObjectType: objectType, Schema: schema, Table: from.Table, Name: name, Source: from.CreateSQL, Target: to.CreateSQL}
+		switch {
+		case !inTarget:
+			item.Change = schemadomain.ChangeMissing
+			item.DDL = []string{use, from.CreateSQL + ";"}
+		case !inSource:
+			item.Change, item.Table = schemadomain.ChangeExtra, to.Table
+			item.DDL = []string{drop(name)}
+		case normalizeSchemaSQL(from.CreateSQL) != normalizeSchemaSQL(to.CreateSQL):
+			item.Change = schemadomain.ChangeChanged
+			item.DDL = []string{drop(name), use, from.CreateSQL + ";"}
+		default:
+			continue
+		}
+		diff.Items = append(diff.Items, item)
+	}
+}
+
+// ReconcileScript renders the DDL of a diff for review. Destructive
+// statements are commented out so they have to be enabled deliberately, and
+// trigger and routine bodies are wrapped in a DELIMITER block.
+func ReconcileScript(header string, diff schemadomain.Diff) string {
+	var out strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(header), "\n") {
+		if line != "" {
+			out.WriteString("-- " + line + "\n")
+		}
+	}
+	if diff.Equal() {
+		out.WriteString("-- No differences.\n")
+		return out.String()
+	}
+	for _, item := range diff.Items {
+		target := item.Schema
+		if item.Table != "" && item.Table != item.Name {
+			target += "." + item.Table
+		}
+		fmt.Fprintf(&out, "\n-- %s %s %s.%s\n", item.Change, item.ObjectType, target, item.Name)
+		if item.Note != "" {
+			out.WriteString("-- NOTE: " + item.Note + "\n")
+		}
+		for _, statement := range item.DDL {
+			switch {
+			case item.Destructive:
+				out.WriteString("-- [destructive, review before enabling] " + strings.ReplaceAll(statement, "\n", "\n-- ") + "\n")
+			case (item.ObjectType == schemadomain.ObjectTrigger || item.ObjectType == schemadomain.ObjectRoutine) && strings.HasPrefix(strings.ToUpper(statement), "CREATE"):
+				out.WriteString("DELIMITER ;;\n" + strings.TrimSuffix(statement, ";") + " ;;\nDELIMITER ;\n")
+			default:
+				out.WriteString(statement + "\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+func normalizeSchemaSQL(text string) string {
+	text = definerRE.ReplaceAllString(text, "")
+	text = intWidthRE.ReplaceAllStringFunc(text, func(match string) string {
+		if strings.EqualFold(match, "tinyint(1)") {
+			return strings.ToLower(match)
+		}
+		return strings.ToLower(match[:strings.Index(match, "(")])
+	})
+	text = strings.ReplaceAll(text, "utf8mb3", "utf8")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func splitPartition(options string) (string, string) {
+	location := partitionRE.FindStringIndex(options)
+	if location == nil {
+		return strings.TrimSpace(options), ""
+	}
+	return strings.TrimSpace(options[:location[0]]), strings.TrimSpace(options[location[0]:])
+}
+
+func schemaIndex(definition schemadomain.Definition, only map[string]bool) map[string]schemadomain.Schema {
+	index := make(map[string]schemadomain.Schema, len(definition.Schemas))
+	for _, schema := range definition.Schemas {
+		if len(only) == 0 || only[schema.Name] {
+			index[schema.Name] = schema
+		}
+	}
+	return index
+}
+
+func partIndex(parts []schemadomain.Part) map[string]schemadomain.Part {
+	index := make(map[string]schemadomain.Part, len(parts))
+	for _, part := range parts {
+		index[part.Name] = part
+	}
+	return index
+}
+
+func unionKeys[V any](left, right map[string]V) []string {
+	keys := make([]string, 0, len(left)+len(right))
+	for key := range left {
+		keys = append(keys, key)
+	}
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	schemadomain "gmha/internal/domain/schemasnapshot"
+)
+
+const schemaTestOrders = "CREATE TABLE `orders` (\n" +
+	"  `id` bigint NOT NULL AUTO_INCREMENT,\n" +
+	"  `user_id` bigint NOT NULL,\n" +
+	"  `status` varchar(16) NOT NULL DEFAULT 'new',\n" +
+	"  `total` decimal(12,2) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_user` (`user_id`),\n" +
+	"  CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)\n" +
+	") ENGINE=InnoDB AUTO_INCREMENT=981 DEFAULT CHARSET=utf8mb4"
+
+func TestParseCreateTableSplitsDefinitionLines(t *testing.T) {
+	table := ParseCreateTable("orders", schemaTestOrders)
+	if len(table.Columns) != 4 || table.Columns[2].Name != "status" || table.Columns[2].SQL != "`status` varchar(16) NOT NULL DEFAULT 'new'" {
+		t.Fatalf("unexpected columns %+v", table.Columns)
+	}
+	if len(table.Indexes) != 2 || table.Indexes[0].Name != "PRIMARY" || table.Indexes[1].Name != "idx_user" {
+		t.Fatalf("unexpected indexes %+v", table.Indexes)
+	}
+	if len(table.Constraints) != 1 || table.Constraints[0].Name != "fk_user" {
+		t.Fatalf("unexpected constraints %+v", table.Constraints)
+	}
+	if table.Options != "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4" || strings.Contains(table.CreateSQL, "AUTO_INCREMENT=") {
+		t.Fatalf("AUTO_INCREMENT must not be part of the definition: %q", table.Options)
+	}
+}
+
+func TestDiffSchemasGeneratesReconcileDDL(t *testing.T) {
+	primary := schemadomain.Definition{Schemas: []schemadomain.Schema{{
+		Name: "shop", Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci",
+		Tables: []schemadomain.Table{ParseCreateTable("orders", schemaTestOrders)},
+		Triggers: []schemadomain.Object{{Name: "trg_orders", Table: "orders",
+			CreateSQL: "CREATE DEFINER=`root`@`%` TRIGGER trg_orders BEFORE INSERT ON orders FOR EACH ROW BEGIN SET NEW.status = 'new'; END"}},
+	}}}
+	replicaOrders := strings.NewReplacer(
+		"  `total` decimal(12,2) DEFAULT NULL,\n", "",
+		"`status` varchar(16)", "`status` varchar(8)",
+		"`user_id` bigint NOT", "`user_id` bigint(20) NOT",
+		"  KEY `idx_user` (`user_id`),\n", "  KEY `idx_user` (`user_id`),\n  KEY `idx_status` (`status`),\n",
+	).Replace(schemaTestOrders)
+	replica := schemadomain.Definition{Schemas: []schemadomain.Schema{
+		{
+			Name: "shop", Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci",
+			Tables: []schemadomain.Table{ParseCreateTable("orders", replicaOrders), ParseCreateTable("tmp_fix", "CREATE TABLE `tmp_fix` (\n  `id` int NOT NULL\n) ENGINE=InnoDB")},
+			Triggers: []schemadomain.Object{{Name: "trg_orders", Table: "orders",
+				CreateSQL: "CREATE DEFINER=`admin`@`localhost` TRIGGER trg_orders BEFORE INSERT ON orders FOR EACH ROW BEGIN SET NEW.status = 'new'; END"}},
+		},
+		{Name: "scratch", Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci", Tables: []schemadomain.Table{}},
+	}}
+
+	if diff := DiffSchemas(primary, primary, nil); !diff.Equal() {
+		t.Fatalf("identical definitions must not differ: %+v", diff.Items)
+	}
+	diff := DiffSchemas(primary, replica, nil)
+	// Missing: total column. Extra: scratch schema, tmp_fix table, idx_status index.
+	// Changed: status column. The definer and display width differences are ignored.
+	if diff.Missing != 1 || diff.Extra != 3 || diff.Changed != 1 {
+		t.Fatalf("unexpected diff counts %d/%d/%d: %+v", diff.Missing, diff.Extra, diff.Changed, diff.Items)
+	}
+	script := ReconcileScript("shop primary -> replica", diff)
+	for _, want := range []string{
+		"ALTER TABLE `shop`.`orders` ADD COLUMN `total` decimal(12,2) DEFAULT NULL AFTER `status`;",
+		"ALTER TABLE `shop`.`orders` MODIFY COLUMN `status` varchar(16) NOT NULL DEFAULT 'new';",
+		"ALTER TABLE `shop`.`orders` DROP INDEX `idx_status`;",
+		"-- [destructive, review before enabling] DROP TABLE `shop`.`tmp_fix`;",
+		"-- [destructive, review before enabling] DROP DATABASE `scratch`;",
+	} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("missing %q in:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "trg_orders") || strings.Contains(script, "user_id") {
+		t.Fatalf("normalized differences must not be reported:\n%s", script)
+	}
+
+	reverse := DiffSchemas(replica, primary, []string{"shop"})
+	for _, item := range reverse.Items {
+		if item.ObjectType == schemadomain.ObjectTable && item.Name == "tmp_fix" {
+			if item.Change != schemadomain.ChangeMissing || item.DDL[0] != "CREATE TABLE `shop`.`tmp_fix` (\n  `id` int NOT NULL\n) ENGINE=InnoDB;" {
+				t.Fatalf("unexpected create DDL %+v", item)
+			}
+			continue
+		}
+		if item.Schema != "shop" {
+			t.Fatalf("schema filter not applied: %+v", item)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	schemadomain "gmha/internal/domain/schemasnapshot"
+)
+
+// MaxSchemaSnapshotObjects bounds one capture; every object costs a SHOW
+// CREATE round trip.
+const MaxSchemaSnapshotObjects = 20000
+
+var (
+	schemaSystemNames = map[string]bool{"mysql": true, "information_schema": true, "performance_schema": true, "sys": true}
+	autoIncrementRE   = regexp.MustCompile(`\s+AUTO_INCREMENT=\d+`)
+)
+
+// SchemaSnapshot captures tables, views, triggers and routines of every
+// user schema. Objects whose definition cannot be read (usually missing
+// privileges on routines) are skipped with a warning instead of failing the
+// whole capture.
+func (c DiagnosticClient) SchemaSnapshot(ctx context.Context, db *sql.DB) (schemadomain.Definition, []string, error) {
+	var warnings []string
+	schemas := make(map[string]*schemadomain.Schema)
+	var names []string
+	if err := c.eachRow(ctx, db, `select SCHEMA_NAME, DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME from information_schema.SCHEMATA order by SCHEMA_NAME`, func(values []sql.NullString) error {
+		if schemaSystemNames[strings.ToLower(values[0].String)] {
+			return nil
+		}
+		schemas[values[0].String] = &schemadomain.Schema{Name: values[0].String, Charset: values[1].String, Collation: values[2].String, Tables: []schemadomain.Table{}}
+		names = append(names, values[0].String)
+		return nil
+	}); err != nil {
+		return schemadomain.Definition{}, nil, err
+	}
+
+	type objectRef struct{ schema, name, kind, table string }
+	var objects []objectRef
+	collect := func(query string, kind func([]sql.NullString) string, table int) error {
+		return c.eachRow(ctx, db, query, func(values []sql.NullString) error {
+			if schemas[values[0].String] == nil {
+				return nil
+			}
+			ref := objectRef{schema: values[0].String, name: values[1].String, kind: kind(values)}
+			if table >= 0 {
+				ref.table = values[table].String
+			}
+			objects = append(objects, ref)
+			if len(objects) > MaxSchemaSnapshotObjects {
+				return fmt.Errorf("实例对象超过 %d 个，无法生成结构快照", MaxSchemaSnapshotObjects)
+			}
+			return nil
+		})
+	}
+	if err := collect(`select TABLE_SCHEMA, TABLE_NAME, TABLE_TYPE from information_schema.TABLES where TABLE_TYPE in ('BASE TABLE','VIEW') order by TABLE_SCHEMA, TABLE_NAME`, func(values []sql.NullString) string {
+		if values[2].String == "VIEW" {
+			return "VIEW"
+		}
+		return "TABLE"
+	}, -1); err != nil {
+		return schemadomain.Definition{}, nil, err
+	}
+	if err := collect(`select TRIGGER_SCHEMA, TRIGGER_NAME, EVENT_OBJECT_TABLE from information_schema.TRIGGERS order by TRIGGER_SCHEMA, TRIGGER_NAME`, func([]sql.NullString) string { return "TRIGGER" }, 2); err != nil {
+		return schemadomain.Definition{}, nil, err
+	}
+	if err := collect(`select ROUTINE_SCHEMA, ROUTINE_NAME, ROUTINE_TYPE from information_schema.ROUTINES order by ROUTINE_SCHEMA, ROUTINE_TYPE, ROUTINE_NAME`, func(values []sql.NullString) string { return values[2].String }, -1); err != nil {
+		return schemadomain.Definition{}, nil, err
+	}
+
+	for _, ref := range objects {
+		schema := schemas[ref.schema]
+		name := quoteMySQLIdentifier(ref.schema) + "." + quoteMySQLIdentifier(ref.name)
+		column := 1
+		if ref.kind == "TRIGGER" || ref.kind == "PROCEDURE" || ref.kind == "FUNCTION" {
+			column = 2
+		}
+		create, err := c.showCreate(ctx, db, "SHOW CREATE "+ref.kind+" "+name, column)
+		if err != nil || create == "" {
+			if err == nil {
+				err = errors.New("定义不可见，请检查账号权限")
+			}
+			warnings = append(warnings, fmt.Sprintf("跳过 %s %s.%s: %v", strings.ToLower(ref.kind), ref.schema, ref.name, err))
+			continue
+		}
+		switch ref.kind {
+		case "TABLE":
+			schema.Tables = append(schema.Tables, ParseCreateTable(ref.name, create))
+		case "VIEW":
+			schema.Views = append(schema.Views, schemadomain.Object{Name: ref.name, CreateSQL: create})
+		case "TRIGGER":
+			schema.Triggers = append(schema.Triggers, schemadomain.Object{Name: ref.name, Table: ref.table, CreateSQL: create})
+		default:
+			schema.Routines = append(schema.Routines, schemadomain.Routine{Name: ref.name, Type: ref.kind, CreateSQL: create})
+		}
+	}
+	definition := schemadomain.Definition{Schemas: make([]schemadomain.Schema, 0, len(names))}
+	for _, name := range names {
+		definition.Schemas = append(definition.Schemas, *schemas[name])
+	}
+	return definition, warnings, nil
+}
+
+func (c DiagnosticClient) eachRow(ctx context.Context, db *sql.DB, query string, visit func([]sql.NullString) error) error {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(queryCtx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		targets := make([]any, len(columns))
+		for index := range values {
+			targets[index] = &values[index]
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+		if err := visit(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (c DiagnosticClient) showCreate(ctx context.Context, db *sql.DB, statement string, column int) (string, error) {
+	var create string
+	err := c.eachRow(ctx, db, statement, func(values []sql.NullString) error {
+		if column < len(values) {
+			create = values[column].String
+		}
+		return nil
+	})
+	return strings.TrimSpace(create), err
+}
+
+// ParseCreateTable splits SHOW CREATE TABLE output into its column, index and
+// constraint lines. The server prints one definition per line with a two
+// space indent, which keeps the parser simple and the lines reusable as DDL.
+func ParseCreateTable(name, create string) schemadomain.Table {
+	create = autoIncrementRE.ReplaceAllString(strings.TrimSpace(create), "")
+	table := schemadomain.Table{Name: name, Columns: []schemadomain.Part{}, CreateSQL: create}
+	lines := strings.Split(create, "\n")
+	for index := 1; index < len(lines); index++ {
+		line := strings.TrimSpace(lines[index])
+		if strings.HasPrefix(line, ")") {
+			table.Options = strings.TrimSpace(strings.Join(append([]string{strings.TrimPrefix(line, ")")}, lines[index+1:]...), "\n"))
+			break
+		}
+		line = strings.TrimSuffix(line, ",")
+		upper := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(line, "`"):
+			column := leadingIdentifier(line)
+			table.Columns = append(table.Columns, schemadomain.Part{Name: column, SQL: line})
+		case strings.HasPrefix(upper, "PRIMARY KEY"):
+			table.Indexes = append(table.Indexes, schemadomain.Part{Name: "PRIMARY", SQL: line})
+		case strings.HasPrefix(upper, "CONSTRAINT "):
+			constraint := leadingIdentifier(strings.TrimSpace(line[len("CONSTRAINT "):]))
+			table.Constraints = append(table.Constraints, schemadomain.Part{Name: constraint, SQL: line})
+		default:
+			if position := strings.Index(upper, "KEY "); position >= 0 {
+				index := leadingIdentifier(strings.TrimSpace(line[position+len("KEY "):]))
+				table.Indexes = append(table.Indexes, schemadomain.Part{Name: index, SQL: line})
+			}
+		}
+	}
+	return table
+}
+
+// leadingIdentifier reads the (backquoted) identifier at the start of text.
+func leadingIdentifier(text string) string {
+	if !strings.HasPrefix(text, "`") {
+		if fields := strings.Fields(text); len(fields) > 0 {
+			return fields[0]
+		}
+		return ""
+	}
+	var name strings.Builder
+	for index := 1; index < len(text); index++ {
+		if text[index] == '`' {
+			if index+1 < len(text) && text[index+1] == '`' {
+				name.WriteByte('`')
+				index++
+				continue
+			}
+			break
+		}
+		name.WriteByte(text[index])
+	}
+	return name.String()
+}
+
+// SchemaChecksum identifies a definition; snapshots with the same checksum
+// are the same schema version.
+func SchemaChecksum(definition schemadomain.Definition) string {
+	sorted := definition
+	sorted.Schemas = append([]schemadomain.Schema(nil), definition.Schemas...)
+	sort.Slice(sorted.Schemas, func(i, j int) bool { return sorted.Schemas[i].Name < sorted.Schemas[j].Name })
+	payload, _ := json.Marshal(sorted)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// SchemaCounts returns the number of schemas, tables and all objects.
+func SchemaCounts(definition schemadomain.Definition) (schemas, tables, objects int) {
+	for _, schema := range definition.Schemas {
+		tables += len(schema.Tables)
+		objects += len(schema.Tables) + len(schema.Views) + len(schema.Triggers) + len(schema.Routines)
+	}
+	return len(definition.Schemas), tables, objects
+}
@@ -0,0 +1,268 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+)
+
+const SlowLogFileEventName = "slow_log_file"
+
+// SlowLogParser turns slow query log file content into statement events. The
+// file only writes "use db;" when the database changes, so the current
+// database is carried between calls.
+type SlowLogParser struct {
+	Database string
+}
+
+type slowLogEntry struct {
+	offset    int
+	timed     bool
+	hosted    bool
+	database  string
+	timestamp int64
+	sql       []string
+	admin     bool
+	event     sqldomain.StatementEvent
+}
+
+// Parse parses complete entries in data. An entry is complete once the next
+// entry header follows it; the last entry is only emitted when final is set,
+// which the caller does after the file stopped growing. consumed is the number
+// of bytes covered by the returned entries and next is the parser state at
+// that position. EventID holds each entry's offset relative to data.
+func (p SlowLogParser) Parse(data []byte, final bool) ([]sqldomain.StatementEvent, int, SlowLogParser) {
+	var events []sqldomain.StatementEvent
+	state := p
+	next := p
+	consumed := 0
+	var current *slowLogEntry
+	finish := func(end int) {
+		if current == nil {
+			return
+		}
+		if current.database != "" {
+			state.Database = current.database
+		}
+		if len(current.sql) > 0 && !current.admin {
+			event := current.event
+			event.Database = state.Database
+			event.SQLText = strings.TrimSuffix(strings.TrimSpace(strings.Join(current.sql, "\n")), ";")
+			event.EventName = SlowLogFileEventName
+			event.EventID = uint64(current.offset)
+			if event.EndedAt.IsZero() && current.timestamp > 0 {
+				event.StartedAt = time.Unix(current.timestamp, 0).UTC()
+				event.EndedAt = event.StartedAt.Add(time.Duration(event.DurationMS * float64(time.Millisecond)))
+			}
+			if event.StartedAt.IsZero() && !event.EndedAt.IsZero() {
+				event.StartedAt = event.EndedAt.Add(-time.Duration(event.DurationMS * float64(time.Millisecond)))
+			}
+			events = append(events, event)
+		}
+		current = nil
+		consumed, next = end, state
+	}
+	offset := 0
+	for offset < len(data) {
+		newline := bytes.IndexByte(data[offset:], '\n')
+		if newline < 0 {
+			break
+		}
+		lineStart := offset
+		line := strings.TrimRight(string(data[offset:offset+newline]), "\r")
+		offset += newline + 1
+		switch {
+		case slowLogPreamble(line):
+			finish(lineStart)
+			consumed, next = offset, state
+		case current != nil && len(current.sql) == 0 && strings.HasPrefix(line, "# administrator command:"):
+			current.admin = true
+		case strings.HasPrefix(line, "# "):
+			// Older servers only write "# Time:" when the second changes, so
+			// a repeated User@Host also starts a new entry.
+			timeLine, hostLine := strings.HasPrefix(line, "# Time:"), strings.HasPrefix(line, "# User@Host:")
+			if current != nil && (len(current.sql) > 0 || current.admin ||
+				(timeLine && (current.timed || current.hosted)) || (hostLine && current.hosted)) {
+				finish(lineStart)
+			}
+			if current == nil {
+				current = &slowLogEntry{offset: lineStart}
+			}
+			current.timed = current.timed || timeLine
+			current.hosted = current.hosted || hostLine
+			parseSlowLogHeader(line, &current.event)
+		case current == nil:
+			// stray statement text without a header cannot be attributed
+			consumed, next = offset, state
+		default:
+			trimmed := strings.TrimSpace(line)
+			lower := strings.ToLower(trimmed)
+			switch {
+			case len(current.sql) == 0 && strings.HasPrefix(lower, "use ") && strings.HasSuffix(trimmed, ";"):
+				current.database = strings.Trim(strings.TrimSuffix(trimmed[4:], ";"), "` ")
+			case len(current.sql) == 0 && strings.HasPrefix(lower, "set timestamp=") && strings.HasSuffix(trimmed, ";"):
+				current.timestamp, _ = strconv.ParseInt(strings.TrimSuffix(trimmed[len("set timestamp="):], ";"), 10, 64)
+			default:
+				current.sql = append(current.sql, line)
+			}
+		}
+	}
+	if final && current != nil && offset == len(data) {
+		finish(offset)
+	}
+	return events, consumed, next
+}
+
+func slowLogPreamble(line string) bool {
+	return strings.Contains(line, ", Version: ") && strings.Contains(line, "started with:") ||
+		strings.HasPrefix(line, "Tcp port: ") ||
+		strings.HasPrefix(line, "Time                 Id Command")
+}
+
+func parseSlowLogHeader(line string, event *sqldomain.StatementEvent) {
+	body := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+	switch {
+	case strings.HasPrefix(body, "Time:"):
+		value := strings.TrimSpace(strings.TrimPrefix(body, "Time:"))
+		if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			event.EndedAt = parsed.UTC()
+		} else if parsed, err := time.ParseInLocation("060102 15:04:05", strings.Join(strings.Fields(value), " "), time.Local); err == nil {
+			event.EndedAt = parsed.UTC()
+		}
+		return
+	case strings.HasPrefix(body, "User@Host:"):
+		value := strings.TrimSpace(strings.TrimPrefix(body, "User@Host:"))
+		if index := strings.Index(value, "Id:"); index >= 0 {
+			event.ThreadID, _ = strconv.ParseUint(strings.TrimSpace(value[index+3:]), 10, 64)
+			value = value[:index]
+		}
+		event.User, event.ClientHost = splitSlowLogUserHost(value)
+		if event.ClientHost == "" {
+			if index := strings.Index(value, "@"); index >= 0 {
+				event.ClientHost = strings.Trim(strings.TrimSpace(value[index+1:]), "[] ")
+			}
+		}
+		return
+	}
+	fields := strings.Fields(body)
+	for index := 0; index+1 < len(fields); index += 2 {
+		key, value := strings.TrimSuffix(fields[index], ":"), fields[index+1]
+		switch key {
+		case "Query_time":
+			seconds, _ := strconv.ParseFloat(value, 64)
+			event.DurationMS = seconds * 1000
+		case "Lock_time":
+			seconds, _ := strconv.ParseFloat(value, 64)
+			event.LockTimeMS = seconds * 1000
+		case "Rows_sent":
+			event.RowsSent, _ = strconv.ParseUint(value, 10, 64)
+		case "Rows_examined":
+			event.RowsExamined, _ = strconv.ParseUint(value, 10, 64)
+		case "Rows_affected":
+			event.RowsAffected, _ = strconv.ParseUint(value, 10, 64)
+		case "Thread_id":
+			event.ThreadID, _ = strconv.ParseUint(value, 10, 64)
+		case "Errno":
+			if value != "0" {
+				event.ErrorCount = 1
+			}
+		case "Created_tmp_disk_tables":
+			event.CreatedTmpDisk, _ = strconv.ParseUint(value, 10, 64)
+		case "Start":
+			if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				event.StartedAt = parsed.UTC()
+			}
+		case "End":
+			if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				event.EndedAt = parsed.UTC()
+			}
+		}
+	}
+}
+
+// NormalizeDigestText reduces a statement to performance_schema's
+// DIGEST_TEXT style: literals become ?, value lists collapse to (...),
+// identifiers are back-quoted and keywords upper-cased. It is the fallback
+// when the server cannot compute STATEMENT_DIGEST itself.
+func NormalizeDigestText(text string) string {
+	tokens := lexDigest(text)
+	parts := make([]string, 0, len(tokens))
+	for index := 0; index < len(tokens); index++ {
+		token := tokens[index]
+		switch {
+		case token.quoted:
+			parts = append(parts, "`"+token.text+"`")
+		case digestValue(token) && !token.keyword("NULL", "TRUE", "FALSE"):
+			parts = append(parts, "?")
+		case token.text == "(" && index > 0 && tokens[index-1].keyword("IN", "VALUES"):
+			end := index + 1
+			for end < len(tokens) && tokens[end].text != ")" && (digestValue(tokens[end]) || tokens[end].text == ",") {
+				end++
+			}
+			if end < len(tokens) && tokens[end].text == ")" && end > index+1 {
+				parts = append(parts, "(...)")
+				index = end
+				continue
+			}
+			parts = append(parts, "(")
+		case token.identifier() && !(index+1 < len(tokens) && tokens[index+1].text == "("):
+			parts = append(parts, "`"+token.text+"`")
+		default:
+			parts = append(parts, strings.ToUpper(token.text))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// FallbackDigest hashes the normalised text; it is stable across literals
+// but does not equal the server's own digest.
+func FallbackDigest(text string) (string, string) {
+	normalized := NormalizeDigestText(text)
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:]), normalized
+}
+
+// StatementDigest asks the server for the performance_schema digest of a
+// statement (MySQL 8.0.4+), so slow log events join TOP-SQL digests exactly.
+func StatementDigest(ctx context.Context, db *sql.DB, text string) (string, string, error) {
+	var digest, digestText sql.NullString
+	if err := db.QueryRowContext(ctx, `select statement_digest(?), statement_digest_text(?)`, text, text).Scan(&digest, &digestText); err != nil {
+		return "", "", err
+	}
+	return digest.String, digestText.String, nil
+}
+
+// SlowLogFileSettings reports whether the server writes its slow log to a
+// file and where. A relative slow_query_log_file is resolved against datadir.
+func SlowLogFileSettings(ctx context.Context, db *sql.DB) (path string, fileOutput, tableOutput bool, err error) {
+	var enabled int
+	var output, file, datadir string
+	if err := db.QueryRowContext(ctx, `select @@slow_query_log, @@log_output, @@slow_query_log_file, @@datadir`).Scan(&enabled, &output, &file, &datadir); err != nil {
+		return "", false, false, err
+	}
+	if file != "" && !strings.HasPrefix(file, "/") {
+		file = strings.TrimRight(datadir, "/") + "/" + file
+	}
+	return file, enabled == 1 && containsCSVToken(output, "FILE"), enabled == 1 && containsCSVToken(output, "TABLE"), nil
+}
+
+// PrepareSlowLogFileEvent applies the Manager's text policy and a stable ID
+// derived from the file identity and byte offset, so re-sent batches are
+// stored once.
+func PrepareSlowLogFileEvent(instance sqldomain.Instance, fileID string, event sqldomain.StatementEvent, cfg sqldomain.Config, collectedAt time.Time) sqldomain.StatementEvent {
+	event.Instance, event.CollectedAt, event.EventName = instance, collectedAt, SlowLogFileEventName
+	if event.Digest == "" {
+		event.Digest, event.DigestText = FallbackDigest(event.SQLText)
+	}
+	event.Digest = strings.ToLower(event.Digest)
+	event.SQLText, _ = prepareSQLText(event.SQLText, cfg)
+	event.ID = stableDiagnosticID(instance.Key(), SlowLogFileEventName, fileID, event.EventID)
+	return event
+}
@@ -0,0 +1,100 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const slowLog80 = `/usr/sbin/mysqld, Version: 8.0.36 (MySQL Community Server - GPL). started with:
+Tcp port: 3306  Unix socket: /tmp/mysql.sock
+Time                 Id Command    Argument
+# Time: 2026-07-23T01:00:02.500000Z
+# User@Host: app[app] @  [10.0.0.8]  Id:    42
+# Query_time: 2.500000  Lock_time: 0.250000 Rows_sent: 1  Rows_examined: 250000
+use orders;
+SET timestamp=1784768400;
+SELECT *
+FROM orders
+WHERE customer_id = 7;
+# Time: 2026-07-23T01:00:03.000000Z
+# User@Host: app[app] @  [10.0.0.8]  Id:    43
+# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 10
+SET timestamp=1784768402;
+UPDATE orders SET status = 'paid' WHERE id = 9;
+# Time: 2026-07-23T01:00:04.000000Z
+# User@Host: app[app] @  [10.0.0.8]  Id:    44
+# Query_time: 3.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1784768401;
+# administrator command: Ping;
+`
+
+func TestSlowLogParserHandlesMultiLineEntriesAndPartialTail(t *testing.T) {
+	data := []byte(slowLog80)
+	events, consumed, next := SlowLogParser{}.Parse(data, false)
+	if len(events) != 2 {
+		t.Fatalf("expected the two completed entries, got %+v", events)
+	}
+	first := events[0]
+	if first.SQLText != "SELECT *\nFROM orders\nWHERE customer_id = 7" || first.Database != "orders" || first.ThreadID != 42 {
+		t.Fatalf("unexpected first entry: %+v", first)
+	}
+	if first.User != "app" || first.ClientHost != "10.0.0.8" || first.DurationMS != 2500 || first.LockTimeMS != 250 || first.RowsExamined != 250000 || first.RowsSent != 1 {
+		t.Fatalf("unexpected first entry metrics: %+v", first)
+	}
+	if !first.EndedAt.Equal(time.Date(2026, 7, 23, 1, 0, 2, 500000000, time.UTC)) || !first.StartedAt.Equal(first.EndedAt.Add(-2500*time.Millisecond)) {
+		t.Fatalf("unexpected first entry times: %s - %s", first.StartedAt, first.EndedAt)
+	}
+	if int(first.EventID) != strings.Index(slowLog80, "# Time: 2026-07-23T01:00:02") {
+		t.Fatalf("event id should be the entry offset, got %d", first.EventID)
+	}
+	if events[1].Database != "orders" || events[1].SQLText != "UPDATE orders SET status = 'paid' WHERE id = 9" {
+		t.Fatalf("database should carry over to later entries: %+v", events[1])
+	}
+	if consumed != strings.Index(slowLog80, "# Time: 2026-07-23T01:00:04") || next.Database != "orders" {
+		t.Fatalf("the trailing entry must stay unconsumed: consumed=%d next=%+v", consumed, next)
+	}
+
+	rest, restConsumed, _ := next.Parse(data[consumed:], true)
+	if len(rest) != 0 || restConsumed != len(data)-consumed {
+		t.Fatalf("administrator commands are consumed without events: %+v consumed=%d", rest, restConsumed)
+	}
+}
+
+func TestSlowLogParserReadsMySQL57Headers(t *testing.T) {
+	data := []byte(`# Time: 260723  9:00:02
+# User@Host: report[report] @ localhost []  Id:     7
+# Query_time: 5.000000  Lock_time: 1.250000 Rows_sent: 3  Rows_examined: 900
+SET timestamp=1784768397;
+select count(*) from t1;
+# User@Host: report[report] @ localhost []  Id:     8
+# Query_time: 1.500000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 5
+use billing;
+SET timestamp=1784768398;
+delete from t2 where id = 1;
+`)
+	events, consumed, next := SlowLogParser{Database: "reports"}.Parse(data, true)
+	if len(events) != 2 || consumed != len(data) {
+		t.Fatalf("expected both entries, got %+v consumed=%d", events, consumed)
+	}
+	if events[0].Database != "reports" || events[0].LockTimeMS != 1250 || events[0].ThreadID != 7 || events[0].EndedAt.IsZero() {
+		t.Fatalf("unexpected first 5.7 entry: %+v", events[0])
+	}
+	if events[1].Database != "billing" || next.Database != "billing" || events[1].ThreadID != 8 {
+		t.Fatalf("a repeated User@Host header must start a new entry: %+v", events[1])
+	}
+	if !events[1].StartedAt.Equal(time.Unix(1784768398, 0).UTC()) || events[1].EndedAt.Sub(events[1].StartedAt) != 1500*time.Millisecond {
+		t.Fatalf("entries without # Time should use SET timestamp: %s - %s", events[1].StartedAt, events[1].EndedAt)
+	}
+}
+
+func TestNormalizeDigestTextCollapsesLiterals(t *testing.T) {
+	a, textA := FallbackDigest("SELECT * FROM orders WHERE id IN (1, 2, 3) AND note = 'x' -- trailing\n")
+	b, textB := FallbackDigest("select * from `orders` where id in (7) and note = \"y\" /* hint */")
+	if a != b || textA != textB {
+		t.Fatalf("digests should match across literals: %q vs %q", textA, textB)
+	}
+	if textA != "SELECT * FROM `orders` WHERE `id` IN (...) AND `note` = ?" {
+		t.Fatalf("unexpected digest text: %q", textA)
+	}
+}
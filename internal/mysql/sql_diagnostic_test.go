@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -60,3 +61,103 @@ func TestSlowLogCapabilityAndUserHostParsing(t *testing.T) {
 		t.Fatalf("unexpected slow log user_host parse: user=%q host=%q", user, host)
 	}
 }
+
+const innodbStatusWithDeadlock = `
+=====================================
+2026-10-19 10:12:00 0x7f2a INNODB MONITOR OUTPUT
+=====================================
+------------------------
+LATEST DETECTED DEADLOCK
+------------------------
+2026-10-19 10:11:12 0x7f2a5c0f1700
+*** (1) TRANSACTION:
+TRANSACTION 12345, ACTIVE 5 sec starting index read
+mysql tables in use 1, locked 1
+LOCK WAIT 3 lock struct(s), heap size 1136, 2 row lock(s)
+MySQL thread id 11, OS thread handle 140234, query id 200 10.0.0.5 app updating
+update orders set status='paid' where id=2
+
+*** (1) HOLDS THE LOCK(S):
+RECORD LOCKS space id 2 page no 4 n bits 72 index PRIMARY of table ` + "`shop`.`orders`" + ` trx id 12345 lock_mode X locks rec but not gap
+Record lock, heap no 2 PHYSICAL RECORD: n_fields 4; compact format; info bits 0
+
+*** (1) WAITING FOR THIS LOCK TO BE GRANTED:
+RECORD LOCKS space id 2 page no 4 n bits 72 index PRIMARY of table ` + "`shop`.`orders`" + ` trx id 12345 lock_mode X locks rec but not gap waiting
+
+*** (2) TRANSACTION:
+TRANSACTION 12346, ACTIVE 3 sec starting index read
+mysql tables in use 1, locked 1
+MySQL thread id 12, OS thread handle 140235, query id 201 10.0.0.6 batch updating
+update orders
+   set status='void' where id=1
+
+*** (2) HOLDS THE LOCK(S):
+RECORD LOCKS space id 2 page no 4 n bits 72 index PRIMARY of table ` + "`shop`.`orders`" + ` trx id 12346 lock_mode X locks rec but not gap
+
+*** (2) WAITING FOR THIS LOCK TO BE GRANTED:
+RECORD LOCKS space id 2 page no 4 n bits 72 index PRIMARY of table ` + "`shop`.`orders`" + ` trx id 12346 lock_mode X locks rec but not gap waiting
+
+*** WE ROLL BACK TRANSACTION (2)
+------------
+TRANSACTIONS
+------------
+Trx id counter 12350
+`
+
+func TestParseLatestDeadlockExtractsBothTransactions(t *testing.T) {
+	cfg := sqldomain.DefaultConfig()
+	report, ok := ParseLatestDeadlock(innodbStatusWithDeadlock, cfg)
+	if !ok || len(report.Transactions) != 2 {
+		t.Fatalf("expected two transactions, got %+v", report)
+	}
+	first, second := report.Transactions[0], report.Transactions[1]
+	if first.TrxID != "12345" || first.ProcessID != 11 || first.User != "app" || first.ClientHost != "10.0.0.5" ||
+		first.Statement != "update orders set status='paid' where id=2" || first.RolledBack {
+		t.Fatalf("unexpected first transaction: %+v", first)
+	}
+	if !strings.Contains(first.HoldsLock, "`shop`.`orders` index PRIMARY lock_mode X") || !strings.HasSuffix(first.WaitsFor, "waiting") {
+		t.Fatalf("unexpected lock summaries: %+v", first)
+	}
+	if second.ProcessID != 12 || !second.RolledBack || !strings.Contains(second.Statement, "set status='void'") {
+		t.Fatalf("unexpected second transaction: %+v", second)
+	}
+	if deadlockTimestamp(innodbStatusWithDeadlock) != "2026-10-19 10:11:12" || !strings.Contains(report.Raw, "WE ROLL BACK") {
+		t.Fatalf("unexpected timestamp or raw section: %q", deadlockTimestamp(innodbStatusWithDeadlock))
+	}
+	cfg.RedactLiterals = true
+	report, _ = ParseLatestDeadlock(innodbStatusWithDeadlock, cfg)
+	if report.Raw != "" || strings.Contains(report.Transactions[0].Statement, "paid") {
+		t.Fatalf("literal redaction must cover deadlock statements and drop the raw section: %+v", report)
+	}
+	if _, ok := ParseLatestDeadlock("------------\nTRANSACTIONS\n------------\n", cfg); ok {
+		t.Fatal("status without a deadlock section must not produce a report")
+	}
+}
+
+func TestMetadataLockWaitsFollowMDLPriority(t *testing.T) {
+	instance := sqldomain.Instance{MachineID: "machine-1", Port: 3306}
+	table := func(thread uint64, lockType string, pending bool, sql string) MetadataLock {
+		return MetadataLock{ObjectType: "TABLE", ObjectSchema: "shop", ObjectName: "orders", LockType: lockType,
+			Pending: pending, ThreadID: thread, ProcessID: thread - 40, SQLText: sql}
+	}
+	locks := []MetadataLock{
+		table(50, "SHARED_READ", false, "select sleep(600) from orders"),
+		table(51, "SHARED_UPGRADABLE", false, "alter table orders add column note text"),
+		table(51, "EXCLUSIVE", true, "alter table orders add column note text"),
+		table(52, "SHARED_READ", true, "select * from orders where id=1"),
+	}
+	waits := MetadataLockWaits(instance, locks, sqldomain.DefaultConfig())
+	edges := map[string]bool{}
+	for _, wait := range waits {
+		edges[strconv.FormatUint(wait.WaitingProcessID, 10)+">"+strconv.FormatUint(wait.BlockingProcessID, 10)] = true
+		if wait.Kind != sqldomain.LockKindMetadata {
+			t.Fatalf("unexpected kind: %+v", wait)
+		}
+	}
+	if len(edges) != 2 || !edges["11>10"] || !edges["12>11"] {
+		t.Fatalf("expected ALTER blocked by the reader and the new reader queued behind ALTER, got %v", edges)
+	}
+	if !mdlBlocks("GLOBAL", "INTENTION_EXCLUSIVE", "SHARED", false) || mdlBlocks("GLOBAL", "INTENTION_EXCLUSIVE", "INTENTION_EXCLUSIVE", false) {
+		t.Fatal("scoped lock compatibility is wrong")
+	}
+}
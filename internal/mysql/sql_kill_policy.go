@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+)
+
+// IdleTransactions lists Sleep sessions that keep an InnoDB transaction open.
+// ElapsedMS is the transaction age and SQLText the last statement the session
+// ran, which is what an operator needs to find the forgotten COMMIT.
+func (c DiagnosticClient) IdleTransactions(ctx context.Context, db *sql.DB, instance sqldomain.Instance, cfg sqldomain.Config) ([]sqldomain.Session, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(queryCtx, `
+		select unix_timestamp(now(6)), p.id, coalesce(t.thread_id, 0), p.user,
+			p.host, coalesce(p.db, ''), p.command, coalesce(p.state, ''),
+			coalesce(es.sql_text, ''), coalesce(es.digest, ''), coalesce(es.digest_text, ''),
+			timestampdiff(second, trx.trx_started, now()) * 1000, 'innodb_trx_started', 1000
+		from information_schema.innodb_trx trx
+		join information_schema.processlist p on p.id = trx.trx_mysql_thread_id
+		left join performance_schema.threads t on t.processlist_id = p.id
+		left join performance_schema.events_statements_current es on es.thread_id = t.thread_id
+		where p.id <> connection_id() and p.command = 'Sleep'
+		order by 12 desc
+	`)
+	if err != nil {
+		rows, err = db.QueryContext(queryCtx, `
+			select unix_timestamp(now(6)), p.id, 0, p.user, p.host, coalesce(p.db, ''),
+				p.command, coalesce(p.state, ''), coalesce(trx.trx_query, ''), '', '',
+				timestampdiff(second, trx.trx_started, now()) * 1000, 'innodb_trx_started', 1000
+			from information_schema.innodb_trx trx
+			join information_schema.processlist p on p.id = trx.trx_mysql_thread_id
+			where p.id <> connection_id() and p.command = 'Sleep'
+			order by 12 desc
+		`)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+	sessions, _, err := scanLiveSessions(rows, instance, cfg)
+	for index := range sessions {
+		sessions[index].Source = "innodb_trx"
+	}
+	return sessions, err
+}
+
+// InstanceRole reports "replica" for read_only servers and "primary"
+// otherwise, matching how GMHA fences every non-primary member.
+func (c DiagnosticClient) InstanceRole(ctx context.Context, db *sql.DB) (string, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	var readOnly int
+	if err := db.QueryRowContext(queryCtx, `select @@global.read_only`).Scan(&readOnly); err != nil {
+		return "", err
+	}
+	if readOnly != 0 {
+		return sqldomain.InstanceRoleReplica, nil
+	}
+	return sqldomain.InstanceRolePrimary, nil
+}
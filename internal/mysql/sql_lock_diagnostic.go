@@ -0,0 +1,480 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	sqldomain "gmha/internal/domain/sqldiagnostic"
+)
+
+// MetadataLock is one row of performance_schema.metadata_locks together with
+// the owning session. Only objects that have a pending request are fetched.
+type MetadataLock struct {
+	ObjectType   string
+	ObjectSchema string
+	ObjectName   string
+	LockType     string
+	Pending      bool
+	ThreadID     uint64
+	ProcessID    uint64
+	User         string
+	Host         string
+	Command      string
+	SQLText      string
+	StateMS      int64
+	TrxID        string
+	TrxStarted   time.Time
+}
+
+// LockWaits returns row lock and metadata lock wait edges. Metadata locks need
+// performance_schema; row lock waits fall back to information_schema on 5.7.
+func (c DiagnosticClient) LockWaits(ctx context.Context, db *sql.DB, instance sqldomain.Instance, caps DiagnosticCapabilities, cfg sqldomain.Config) ([]sqldomain.LockWait, error) {
+	collectedAt := time.Now().UTC()
+	waits, err := c.rowLockWaits(ctx, db, instance, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("row lock waits: %w", err)
+	}
+	if caps.PerformanceSchema {
+		locks, mdlErr := c.metadataLocks(ctx, db)
+		if mdlErr != nil {
+			return waits, fmt.Errorf("metadata locks: %w", mdlErr)
+		}
+		waits = append(waits, MetadataLockWaits(instance, locks, cfg)...)
+	}
+	for index := range waits {
+		waits[index].CollectedAt = collectedAt
+		waits[index].ID = LockWaitID(waits[index])
+	}
+	return waits, nil
+}
+
+func (c DiagnosticClient) rowLockWaits(ctx context.Context, db *sql.DB, instance sqldomain.Instance, cfg sqldomain.Config) ([]sqldomain.LockWait, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(queryCtx, `
+		select cast(w.requesting_engine_transaction_id as char), cast(w.blocking_engine_transaction_id as char),
+			coalesce(wt.processlist_id, 0), w.requesting_thread_id,
+			coalesce(bt.processlist_id, 0), w.blocking_thread_id,
+			coalesce(wt.processlist_user, ''), coalesce(wt.processlist_host, ''),
+			coalesce(bt.processlist_user, ''), coalesce(bt.processlist_host, ''),
+			coalesce(bt.processlist_command, ''),
+			coalesce(wx.trx_query, wt.processlist_info, ''), coalesce(bx.trx_query, bes.sql_text, ''),
+			coalesce(timestampdiff(microsecond, wx.trx_wait_started, now(6)), 0) div 1000,
+			coalesce(unix_timestamp(bx.trx_started), 0),
+			coalesce(rl.object_schema, ''), coalesce(rl.object_name, ''), coalesce(rl.index_name, ''),
+			coalesce(rl.lock_mode, ''), coalesce(bl.lock_mode, '')
+		from performance_schema.data_lock_waits w
+		left join performance_schema.data_locks rl on rl.engine_lock_id = w.requesting_engine_lock_id
+		left join performance_schema.data_locks bl on bl.engine_lock_id = w.blocking_engine_lock_id
+		left join performance_schema.threads wt on wt.thread_id = w.requesting_thread_id
+		left join performance_schema.threads bt on bt.thread_id = w.blocking_thread_id
+		left join performance_schema.events_statements_current bes on bes.thread_id = w.blocking_thread_id
+		left join information_schema.innodb_trx wx on wx.trx_id = w.requesting_engine_transaction_id
+		left join information_schema.innodb_trx bx on bx.trx_id = w.blocking_engine_transaction_id
+	`)
+	if err != nil {
+		return c.rowLockWaitsFallback(ctx, db, instance, cfg)
+	}
+	defer rows.Close()
+	return scanRowLockWaits(rows, instance, cfg)
+}
+
+func (c DiagnosticClient) rowLockWaitsFallback(ctx context.Context, db *sql.DB, instance sqldomain.Instance, cfg sqldomain.Config) ([]sqldomain.LockWait, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(queryCtx, `
+		select cast(w.requesting_trx_id as char), cast(w.blocking_trx_id as char),
+			coalesce(r.trx_mysql_thread_id, 0), 0, coalesce(b.trx_mysql_thread_id, 0), 0,
+			coalesce(rp.user, ''), coalesce(rp.host, ''), coalesce(bp.user, ''), coalesce(bp.host, ''),
+			coalesce(bp.command, ''), coalesce(r.trx_query, ''), coalesce(b.trx_query, bp.info, ''),
+			coalesce(timestampdiff(microsecond, r.trx_wait_started, now(6)), 0) div 1000,
+			coalesce(unix_timestamp(b.trx_started), 0),
+			replace(substring_index(coalesce(rl.lock_table, ''), '.', 1), '`+"`"+`', ''),
+			replace(substring_index(coalesce(rl.lock_table, ''), '.', -1), '`+"`"+`', ''),
+			coalesce(rl.lock_index, ''), coalesce(rl.lock_mode, ''), coalesce(bl.lock_mode, '')
+		from information_schema.innodb_lock_waits w
+		join information_schema.innodb_trx r on r.trx_id = w.requesting_trx_id
+		join information_schema.innodb_trx b on b.trx_id = w.blocking_trx_id
+		left join information_schema.innodb_locks rl on rl.lock_id = w.requested_lock_id
+		left join information_schema.innodb_locks bl on bl.lock_id = w.blocking_lock_id
+		left join information_schema.processlist rp on rp.id = r.trx_mysql_thread_id
+		left join information_schema.processlist bp on bp.id = b.trx_mysql_thread_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowLockWaits(rows, instance, cfg)
+}
+
+func scanRowLockWaits(rows *sql.Rows, instance sqldomain.Instance, cfg sqldomain.Config) ([]sqldomain.LockWait, error) {
+	var out []sqldomain.LockWait
+	for rows.Next() {
+		item := sqldomain.LockWait{Instance: instance, Kind: sqldomain.LockKindRow, ObjectType: "TABLE"}
+		var waitingSQL, blockingSQL string
+		var startedUnix float64
+		if err := rows.Scan(&item.WaitingTrxID, &item.BlockingTrxID, &item.WaitingProcessID, &item.WaitingThreadID,
+			&item.BlockingProcessID, &item.BlockingThreadID, &item.WaitingUser, &item.WaitingHost,
+			&item.BlockingUser, &item.BlockingHost, &item.BlockingCommand, &waitingSQL, &blockingSQL,
+			&item.WaitMS, &startedUnix, &item.ObjectSchema, &item.ObjectName, &item.IndexName,
+			&item.LockMode, &item.BlockingLockMode); err != nil {
+			return nil, err
+		}
+		item.WaitingSQL, _ = prepareSQLText(waitingSQL, cfg)
+		item.BlockingSQL, _ = prepareSQLText(blockingSQL, cfg)
+		item.BlockingTrxStartedAt = unixFloatTime(startedUnix)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (c DiagnosticClient) metadataLocks(ctx context.Context, db *sql.DB) ([]MetadataLock, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	rows, err := db.QueryContext(queryCtx, `
+		select m.object_type, coalesce(m.object_schema, ''), coalesce(m.object_name, ''),
+			m.lock_type, m.lock_status = 'PENDING', m.owner_thread_id,
+			coalesce(t.processlist_id, 0), coalesce(t.processlist_user, ''), coalesce(t.processlist_host, ''),
+			coalesce(t.processlist_command, ''), coalesce(t.processlist_info, es.sql_text, ''),
+			coalesce(t.processlist_time, 0) * 1000, coalesce(cast(x.trx_id as char), ''),
+			coalesce(unix_timestamp(x.trx_started), 0)
+		from performance_schema.metadata_locks m
+		left join performance_schema.threads t on t.thread_id = m.owner_thread_id
+		left join performance_schema.events_statements_current es on es.thread_id = m.owner_thread_id
+		left join information_schema.innodb_trx x on x.trx_mysql_thread_id = t.processlist_id
+		where m.lock_status in ('GRANTED', 'PENDING')
+			and exists (
+				select 1 from performance_schema.metadata_locks p
+				where p.lock_status = 'PENDING' and p.object_type = m.object_type
+					and p.object_schema <=> m.object_schema and p.object_name <=> m.object_name
+			)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []MetadataLock
+	for rows.Next() {
+		var item MetadataLock
+		var startedUnix float64
+		if err := rows.Scan(&item.ObjectType, &item.ObjectSchema, &item.ObjectName, &item.LockType,
+			&item.Pending, &item.ThreadID, &item.ProcessID, &item.User, &item.Host, &item.Command,
+			&item.SQLText, &item.StateMS, &item.TrxID, &startedUnix); err != nil {
+			return nil, err
+		}
+		item.TrxStarted = unixFloatTime(startedUnix)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+var (
+	mdlOrder = map[string]int{
+		"SHARED": 0, "SHARED_HIGH_PRIO": 1, "SHARED_READ": 2, "SHARED_WRITE": 3, "SHARED_WRITE_LOW_PRIO": 4,
+		"SHARED_UPGRADABLE": 5, "SHARED_READ_ONLY": 6, "SHARED_NO_WRITE": 7, "SHARED_NO_READ_WRITE": 8, "EXCLUSIVE": 9,
+	}
+	// Rows are the requested type, columns the granted / pending type, in
+	// mdlOrder. '-' marks incompatibility. Copied from MDL_lock::
+	// m_object_lock_strategy in sql/mdl.cc.
+	mdlGrantedIncompatible = []string{
+		"+++++++++-",
+		"+++++++++-",
+		"++++++++--",
+		"++++++----",
+		"++++++----",
+		"+++++-+---",
+		"+++--+++--",
+		"+++---+---",
+		"++--------",
+		"----------",
+	}
+	mdlPendingIncompatible = []string{
+		"+++++++++-",
+		"++++++++++",
+		"++++++++--",
+		"+++++++---",
+		"++++++----",
+		"+++++++++-",
+		"+++-+++++-",
+		"+++++++++-",
+		"+++++++++-",
+		"++++++++++",
+	}
+)
+
+// mdlBlocks reports whether a lock of type held (granted, or pending and
+// therefore ahead in priority) prevents a pending request of type requested.
+func mdlBlocks(objectType, requested, held string, heldPending bool) bool {
+	requested, held = strings.ToUpper(requested), strings.ToUpper(held)
+	row, okRow := mdlOrder[requested]
+	column, okColumn := mdlOrder[held]
+	if mdlObjectLock(objectType) && okRow && okColumn {
+		if heldPending {
+			return mdlPendingIncompatible[row][column] == '-'
+		}
+		return mdlGrantedIncompatible[row][column] == '-'
+	}
+	// Scoped locks (GLOBAL, SCHEMA, COMMIT, BACKUP LOCK, user-level locks)
+	// only combine INTENTION_EXCLUSIVE, SHARED and EXCLUSIVE.
+	if heldPending {
+		switch requested {
+		case "INTENTION_EXCLUSIVE":
+			return held == "SHARED" || held == "EXCLUSIVE"
+		case "SHARED":
+			return held == "EXCLUSIVE"
+		default:
+			return false
+		}
+	}
+	return requested == "EXCLUSIVE" || held == "EXCLUSIVE" || requested != held
+}
+
+func mdlObjectLock(objectType string) bool {
+	switch strings.ToUpper(objectType) {
+	case "TABLE", "FUNCTION", "PROCEDURE", "TRIGGER", "EVENT":
+		return true
+	default:
+		return false
+	}
+}
+
+// MetadataLockWaits turns metadata_locks rows into wait edges. A pending
+// request waits for incompatible granted locks of other sessions, and for
+// incompatible pending requests that take priority over it; the latter is
+// how a queued ALTER TABLE piles up later SELECTs behind a long transaction.
+func MetadataLockWaits(instance sqldomain.Instance, locks []MetadataLock, cfg sqldomain.Config) []sqldomain.LockWait {
+	var out []sqldomain.LockWait
+	seen := map[string]bool{}
+	for _, waiting := range locks {
+		if !waiting.Pending {
+			continue
+		}
+		for _, holder := range locks {
+			if holder.ThreadID == waiting.ThreadID || holder.ObjectType != waiting.ObjectType ||
+				holder.ObjectSchema != waiting.ObjectSchema || holder.ObjectName != waiting.ObjectName {
+				continue
+			}
+			if !mdlBlocks(waiting.ObjectType, waiting.LockType, holder.LockType, holder.Pending) {
+				continue
+			}
+			key := fmt.Sprintf("%d>%d:%s.%s.%s", waiting.ThreadID, holder.ThreadID, waiting.ObjectType, waiting.ObjectSchema, waiting.ObjectName)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			item := sqldomain.LockWait{
+				Instance: instance, Kind: sqldomain.LockKindMetadata,
+				WaitingProcessID: waiting.ProcessID, WaitingThreadID: waiting.ThreadID, WaitingTrxID: waiting.TrxID,
+				WaitingUser: waiting.User, WaitingHost: waiting.Host, WaitMS: waiting.StateMS,
+				BlockingProcessID: holder.ProcessID, BlockingThreadID: holder.ThreadID, BlockingTrxID: holder.TrxID,
+				BlockingUser: holder.User, BlockingHost: holder.Host, BlockingCommand: holder.Command,
+				BlockingTrxStartedAt: holder.TrxStarted, ObjectType: waiting.ObjectType,
+				ObjectSchema: waiting.ObjectSchema, ObjectName: waiting.ObjectName,
+				LockMode: waiting.LockType, BlockingLockMode: holder.LockType,
+			}
+			if holder.Pending {
+				item.BlockingLockMode += " (PENDING)"
+			}
+			item.WaitingSQL, _ = prepareSQLText(waiting.SQLText, cfg)
+			item.BlockingSQL, _ = prepareSQLText(holder.SQLText, cfg)
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// LatestDeadlock returns the LATEST DETECTED DEADLOCK section of SHOW ENGINE
+// INNODB STATUS, or false when the server has not seen one since start.
+func (c DiagnosticClient) LatestDeadlock(ctx context.Context, db *sql.DB, instance sqldomain.Instance, cfg sqldomain.Config) (sqldomain.DeadlockReport, bool, error) {
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	var engineType, name, status string
+	if err := db.QueryRowContext(queryCtx, "SHOW ENGINE INNODB STATUS").Scan(&engineType, &name, &status); err != nil {
+		return sqldomain.DeadlockReport{}, false, err
+	}
+	report, ok := ParseLatestDeadlock(status, cfg)
+	if !ok {
+		return report, false, nil
+	}
+	report.Instance, report.CollectedAt = instance, time.Now().UTC()
+	// The section timestamp is in the server time zone; let the server convert it.
+	if stamp := deadlockTimestamp(status); stamp != "" {
+		var detectedUnix float64
+		queryCtx, cancel = c.queryContext(ctx)
+		err := db.QueryRowContext(queryCtx, "select coalesce(unix_timestamp(?), 0)", stamp).Scan(&detectedUnix)
+		cancel()
+		if err == nil {
+			report.DetectedAt = unixFloatTime(detectedUnix)
+		}
+	}
+	if report.DetectedAt.IsZero() {
+		report.DetectedAt = report.CollectedAt
+	}
+	report.ID = stableDiagnosticID(instance.Key(), "deadlock", SQLFingerprint(latestDeadlockSection(status)))
+	return report, true, nil
+}
+
+func (c DiagnosticClient) KillConnection(ctx context.Context, db *sql.DB, processID uint64) error {
+	if processID == 0 {
+		return errors.New("process_id is required")
+	}
+	queryCtx, cancel := c.queryContext(ctx)
+	defer cancel()
+	_, err := db.ExecContext(queryCtx, fmt.Sprintf("KILL CONNECTION %d", processID))
+	return err
+}
+
+func LockWaitID(item sqldomain.LockWait) string {
+	return stableDiagnosticID(item.Instance.Key(), item.CollectedAt.UnixNano(), item.Kind, item.WaitingThreadID,
+		item.WaitingProcessID, item.BlockingThreadID, item.BlockingProcessID, item.ObjectSchema, item.ObjectName, item.LockMode)
+}
+
+var (
+	deadlockTransactionHeader = regexp.MustCompile(`^\*\*\* \((\d+)\) TRANSACTION:`)
+	deadlockSectionHeader     = regexp.MustCompile(`^\*\*\* \((\d+)\) (HOLDS THE LOCK\(S\)|WAITING FOR THIS LOCK TO BE GRANTED):`)
+	deadlockRollback          = regexp.MustCompile(`^\*\*\* WE ROLL BACK TRANSACTION \((\d+)\)`)
+	deadlockThreadLine        = regexp.MustCompile(`^MySQL thread id (\d+), OS thread handle \S+, query id \d+\s*(.*)$`)
+	deadlockRecordLock        = regexp.MustCompile(`index (\S+) of table (\S+) trx id \S+ (.+)$`)
+	deadlockTableLock         = regexp.MustCompile(`^TABLE LOCK table (\S+) trx id \S+ (.+)$`)
+	deadlockTimestampLine     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})`)
+)
+
+func latestDeadlockSection(status string) string {
+	const header = "LATEST DETECTED DEADLOCK"
+	start := strings.Index(status, header)
+	if start < 0 {
+		return ""
+	}
+	section := status[start+len(header):]
+	section = strings.TrimLeft(section, "-\n\r ")
+	// The next section is introduced by a dashed rule followed by its title.
+	if end := strings.Index(section, "\n------------\nTRANSACTIONS"); end >= 0 {
+		section = section[:end]
+	}
+	return strings.TrimSpace(section)
+}
+
+func deadlockTimestamp(status string) string {
+	section := latestDeadlockSection(status)
+	line, _, _ := strings.Cut(section, "\n")
+	if match := deadlockTimestampLine.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// ParseLatestDeadlock extracts both transactions, their statements, the lock
+// each held and waited for, and which one InnoDB rolled back.
+func ParseLatestDeadlock(status string, cfg sqldomain.Config) (sqldomain.DeadlockReport, bool) {
+	section := latestDeadlockSection(status)
+	if section == "" {
+		return sqldomain.DeadlockReport{}, false
+	}
+	var report sqldomain.DeadlockReport
+	byIndex := map[int]int{}
+	current, mode := -1, ""
+	statement := []string{}
+	flushStatement := func() {
+		if current >= 0 && len(statement) > 0 && report.Transactions[current].Statement == "" {
+			report.Transactions[current].Statement, _ = prepareSQLText(strings.Join(statement, "\n"), cfg)
+		}
+		statement = statement[:0]
+	}
+	for _, raw := range strings.Split(section, "\n") {
+		line := strings.TrimRight(raw, "\r")
+		trimmed := strings.TrimSpace(line)
+		if match := deadlockTransactionHeader.FindStringSubmatch(trimmed); match != nil {
+			flushStatement()
+			index, _ := strconv.Atoi(match[1])
+			report.Transactions = append(report.Transactions, sqldomain.DeadlockTransaction{Index: index})
+			current, mode = len(report.Transactions)-1, "transaction"
+			byIndex[index] = current
+			continue
+		}
+		if match := deadlockSectionHeader.FindStringSubmatch(trimmed); match != nil {
+			flushStatement()
+			index, _ := strconv.Atoi(match[1])
+			if position, ok := byIndex[index]; ok {
+				current = position
+			}
+			mode = "holds"
+			if strings.HasPrefix(match[2], "WAITING") {
+				mode = "waits"
+			}
+			continue
+		}
+		if match := deadlockRollback.FindStringSubmatch(trimmed); match != nil {
+			flushStatement()
+			index, _ := strconv.Atoi(match[1])
+			if position, ok := byIndex[index]; ok {
+				report.Transactions[position].RolledBack = true
+			}
+			current, mode = -1, ""
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		tx := &report.Transactions[current]
+		switch mode {
+		case "transaction":
+			if strings.HasPrefix(trimmed, "TRANSACTION ") {
+				fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(trimmed, "TRANSACTION "), ","))
+				if len(fields) > 0 {
+					tx.TrxID = strings.TrimSuffix(fields[0], ",")
+				}
+			} else if match := deadlockThreadLine.FindStringSubmatch(trimmed); match != nil {
+				tx.ProcessID, _ = strconv.ParseUint(match[1], 10, 64)
+				fields := strings.Fields(match[2])
+				if len(fields) >= 2 {
+					tx.ClientHost, tx.User = fields[0], fields[1]
+				}
+				mode = "statement"
+			}
+		case "statement":
+			if trimmed == "" || strings.HasPrefix(trimmed, "***") {
+				flushStatement()
+				mode = ""
+				continue
+			}
+			statement = append(statement, line)
+		case "holds", "waits":
+			summary := deadlockLockSummary(trimmed)
+			if summary == "" {
+				continue
+			}
+			if mode == "holds" && tx.HoldsLock == "" {
+				tx.HoldsLock = summary
+			}
+			if mode == "waits" && tx.WaitsFor == "" {
+				tx.WaitsFor = summary
+			}
+		}
+	}
+	flushStatement()
+	if len(report.Transactions) == 0 {
+		return sqldomain.DeadlockReport{}, false
+	}
+	if cfg.CaptureSQLText && !cfg.RedactLiterals {
+		report.Raw, _ = prepareSQLText(section, cfg)
+	}
+	return report, true
+}
+
+func deadlockLockSummary(line string) string {
+	if strings.HasPrefix(line, "RECORD LOCKS ") {
+		if match := deadlockRecordLock.FindStringSubmatch(line); match != nil {
+			return fmt.Sprintf("%s index %s %s", match[2], match[1], match[3])
+		}
+	}
+	if match := deadlockTableLock.FindStringSubmatch(line); match != nil {
+		return match[1] + " " + match[2]
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	capacitydomain "gmha/internal/domain/capacity"
+)
+
+// MaxTableSizeRows bounds one capacity sample; instances with more tables keep
+// only the largest ones.
+const MaxTableSizeRows = 50000
+
+// TableSizes reads the estimated size of every user base table. The values
+// come from InnoDB statistics and are approximate, which is good enough for
+// growth trends at daily resolution.
+func (c DiagnosticClient) TableSizes(ctx context.Context, db *sql.DB) ([]capacitydomain.TableSample, error) {
+	var out []capacitydomain.TableSample
+	err := c.eachRow(ctx, db, `select TABLE_SCHEMA, TABLE_NAME, COALESCE(TABLE_ROWS,0), COALESCE(DATA_LENGTH,0), COALESCE(INDEX_LENGTH,0), COALESCE(DATA_FREE,0)
+		from information_schema.TABLES
+		where TABLE_TYPE='BASE TABLE' and TABLE_SCHEMA not in ('mysql','information_schema','performance_schema','sys')
+		order by COALESCE(DATA_LENGTH,0)+COALESCE(INDEX_LENGTH,0) desc limit `+strconv.Itoa(MaxTableSizeRows), func(values []sql.NullString) error {
+		out = append(out, capacitydomain.TableSample{
+			Schema: values[0].String, Table: values[1].String,
+			Rows: tableSizeInt(values[2]), DataBytes: tableSizeInt(values[3]),
+			IndexBytes: tableSizeInt(values[4]), FreeBytes: tableSizeInt(values[5]),
+		})
+		return nil
+	})
+	return out, err
+}
+
+func tableSizeInt(value sql.NullString) int64 {
+	result, _ := strconv.ParseInt(value.String, 10, 64)
+	return result
+}
@@ -56,9 +56,11 @@ type VersionCapabilities struct {
 	LegacyReplicationNames    bool
 	LegacyRedoLog             bool
 	SupportsClone             bool
+	SupportsTLSReload         bool
 	SupportsHistograms        bool
 	SupportsSetPersist        bool
 	SupportsDynamicPrivileges bool
+	SupportsDualPassword      bool
 	SupportsPerconaToolkit    bool
 	MinimumPerconaToolkit     string
 	XtraBackupSeries          string
@@ -80,9 +82,11 @@ func CapabilitiesForVersion(raw string) (VersionCapabilities, error) {
 		LegacyReplicationNames:    compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 26}) < 0,
 		LegacyRedoLog:             compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 30}) < 0,
 		SupportsClone:             compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 17}) >= 0,
+		SupportsTLSReload:         compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 16}) >= 0,
 		SupportsHistograms:        v.Major >= 8,
 		SupportsSetPersist:        v.Major >= 8,
 		SupportsDynamicPrivileges: compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 17}) >= 0,
+		SupportsDualPassword:      compareMySQLVersion(v, mysqlVersion{Major: 8, Minor: 0, Patch: 14}) >= 0,
 		SupportsPerconaToolkit:    true,
 		MinimumPerconaToolkit:     "3.7.1",
 		XtraBackupSeries:          fmt.Sprintf("%d.%d", v.Major, v.Minor),
@@ -121,6 +125,48 @@ func SupportsCloneForVersion(raw string) bool {
 	return err == nil && capabilities.SupportsClone
 }
 
+// CloneCompatibleVersions reports whether a recipient may CLONE INSTANCE
+// from the donor. Both sides need the Clone plugin; before 8.0.37 the
+// releases must match exactly, later releases only need the same series.
+func CloneCompatibleVersions(donor, recipient string) bool {
+	if !SupportsCloneForVersion(donor) || !SupportsCloneForVersion(recipient) {
+		return false
+	}
+	d, err := validateSupportedMySQLVersion(donor)
+	if err != nil {
+		return false
+	}
+	r, err := validateSupportedMySQLVersion(recipient)
+	if err != nil {
+		return false
+	}
+	if d == r {
+		return true
+	}
+	patchRelaxed := mysqlVersion{Major: 8, Minor: 0, Patch: 37}
+	return d.Major == r.Major && d.Minor == r.Minor && compareMySQLVersion(d, patchRelaxed) >= 0 && compareMySQLVersion(r, patchRelaxed) >= 0
+}
+
+// SupportsDualPasswordForVersion reports whether an account may keep a
+// secondary password (ALTER USER ... RETAIN CURRENT PASSWORD), introduced in
+// MySQL 8.0.14. Vendor suffixes after the numeric version are ignored.
+func SupportsDualPasswordForVersion(raw string) bool {
+	match := regexp.MustCompile(`^\s*(\d+\.\d+\.\d+)`).FindStringSubmatch(raw)
+	if len(match) != 2 {
+		return false
+	}
+	capabilities, err := CapabilitiesForVersion(match[1])
+	return err == nil && capabilities.SupportsDualPassword
+}
+
+// SupportsTLSReloadForVersion reports whether certificates can be swapped
+// online with ALTER INSTANCE RELOAD TLS (MySQL 8.0.16+). Older servers only
+// read ssl_* files at startup and need a restart after rotation.
+func SupportsTLSReloadForVersion(raw string) bool {
+	capabilities, err := CapabilitiesForVersion(raw)
+	return err == nil && capabilities.SupportsTLSReload
+}
+
 // SupportsDynamicPrivilegeForVersion applies a conservative boundary shared
 // by all platform workflows. Before 8.0.17 GMHA uses SUPER instead, avoiding
 // partial grants across the early 8.0 dynamic-privilege rollout.
@@ -439,3 +485,35 @@ func parseMySQLSizeOrZero(raw string) int64 {
 	value, _ := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
 	return value * multiplier
 }
+
+// dynamicParameterNames lists the variables the parameter tasks change with
+// SET GLOBAL; every other variable only takes effect after a restart.
+var dynamicParameterNames = map[string]struct{}{
+	"autocommit": {}, "binlog_expire_logs_seconds": {}, "expire_logs_days": {}, "binlog_format": {}, "connect_timeout": {}, "event_scheduler": {},
+	"general_log": {}, "general_log_file": {}, "group_concat_max_len": {}, "innodb_buffer_pool_size": {},
+	"innodb_flush_log_at_trx_commit": {}, "innodb_io_capacity": {}, "innodb_io_capacity_max": {}, "innodb_lock_wait_timeout": {},
+	"innodb_max_dirty_pages_pct": {}, "innodb_old_blocks_time": {}, "innodb_online_alter_log_max_size": {}, "innodb_print_all_deadlocks": {},
+	"innodb_purge_threads": {}, "innodb_read_io_threads": {}, "innodb_stats_on_metadata": {}, "innodb_write_io_threads": {},
+	"interactive_timeout": {}, "join_buffer_size": {}, "lock_wait_timeout": {}, "log_output": {}, "long_query_time": {},
+	"max_allowed_packet": {}, "max_connect_errors": {}, "max_connections": {}, "max_execution_time": {}, "max_heap_table_size": {},
+	"max_prepared_stmt_count": {}, "net_read_timeout": {}, "net_write_timeout": {}, "optimizer_switch": {}, "read_buffer_size": {},
+	"read_only": {}, "read_rnd_buffer_size": {}, "slow_query_log": {}, "sort_buffer_size": {}, "sql_mode": {},
+	"super_read_only": {}, "sync_binlog": {}, "table_definition_cache": {}, "table_open_cache": {}, "thread_cache_size": {},
+	"tmp_table_size": {}, "transaction_isolation": {}, "tx_isolation": {}, "wait_timeout": {},
+}
+
+// ParameterIsDynamic reports whether a variable can be changed at runtime.
+func ParameterIsDynamic(name string) bool {
+	_, ok := dynamicParameterNames[strings.ToLower(strings.TrimSpace(name))]
+	return ok
+}
+
+// DynamicParameterNames returns the runtime-changeable variables sorted by name.
+func DynamicParameterNames() []string {
+	names := make([]string, 0, len(dynamicParameterNames))
+	for name := range dynamicParameterNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -103,11 +103,35 @@ func TestCapabilitiesFollowPatchLevelBoundaries(t *testing.T) {
 			t.Fatalf("unexpected capabilities for %s: %+v", tt.version, capabilities)
 		}
 	}
+	for version, want := range map[string]bool{"5.7.44": false, "8.0.13": false, "8.0.14": true, "8.4.3-log": true, "": false} {
+		if got := SupportsDualPasswordForVersion(version); got != want {
+			t.Fatalf("dual password for %q: got %v", version, got)
+		}
+	}
 	if !SupportsPerconaToolkit("9.7.1") {
 		t.Fatal("MySQL 9.7 should use the current Percona Toolkit compatibility path")
 	}
 }
 
+func TestCloneCompatibleVersions(t *testing.T) {
+	for _, tt := range []struct {
+		donor, recipient string
+		ok               bool
+	}{
+		{"8.0.36", "8.0.36", true},
+		{"8.0.35", "8.0.36", false},
+		{"8.0.37", "8.0.41", true},
+		{"8.4.2", "8.4.6", true},
+		{"8.0.41", "8.4.2", false},
+		{"8.0.16", "8.0.16", false},
+		{"5.7.44", "5.7.44", false},
+	} {
+		if got := CloneCompatibleVersions(tt.donor, tt.recipient); got != tt.ok {
+			t.Fatalf("clone %s -> %s: got %v", tt.donor, tt.recipient, got)
+		}
+	}
+}
+
 func TestApplyRuntimeParametersForMySQL57UsesLegacyConfigSemantics(t *testing.T) {
 	vars := ConfigVars{
 		CollationServer:       "utf8mb4_0900_ai_ci",
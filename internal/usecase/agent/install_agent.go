@@ -77,6 +77,8 @@ type AgentConfigRenderInput struct {
 	ManagerGRPCAddr   string
 	HeartbeatInterval string
 	Token             string
+	// UpgradePublicKey pins the Manager key that signs self-upgrade tasks.
+	UpgradePublicKey string
 }
 
 // SystemdRenderInput 是 Systemd 服务单元文件渲染的输入参数。
@@ -91,6 +93,8 @@ type Dependencies struct {
 	SSHClient   SSHClient
 	Renderer    Renderer
 	Waiter      RegistrationWaiter
+	// UpgradePublicKey is rendered into agent.yaml; see AgentConfigRenderInput.
+	UpgradePublicKey string
 }
 
 // InstallAgentUsecase 是安装 Agent 的用例，负责通过 SSH 将 Agent 部署到目标机器。
@@ -100,6 +104,7 @@ type InstallAgentUsecase struct {
 	sshClient   SSHClient
 	renderer    Renderer
 	waiter      RegistrationWaiter
+	publicKey   string
 }
 
 // NewInstallAgentUsecase 创建一个新的安装 Agent 用例实例。
@@ -110,6 +115,7 @@ func NewInstallAgentUsecase(dep Dependencies) *InstallAgentUsecase {
 		sshClient:   dep.SSHClient,
 		renderer:    dep.Renderer,
 		waiter:      dep.Waiter,
+		publicKey:   dep.UpgradePublicKey,
 	}
 }
 
@@ -158,6 +164,7 @@ func (u *InstallAgentUsecase) Execute(ctx context.Context, req InstallAgentReque
 		ManagerGRPCAddr:   managerGRPCAddr,
 		HeartbeatInterval: "5s",
 		Token:             "",
+		UpgradePublicKey:  u.publicKey,
 	})
 	if err != nil {
 		return InstallAgentResponse{}, err
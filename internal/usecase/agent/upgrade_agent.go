@@ -38,6 +38,8 @@ type UpgradeDependencies struct {
 	SSHClient      SSHClient
 	Renderer       Renderer
 	Heartbeat      HeartbeatReader
+	// UpgradePublicKey is rendered into agent.yaml; see AgentConfigRenderInput.
+	UpgradePublicKey string
 }
 
 // UpgradeAgentRequest 是升级 Agent 的请求参数。
@@ -66,6 +68,7 @@ type UpgradeAgentUsecase struct {
 	sshClient      SSHClient
 	renderer       Renderer
 	heartbeat      HeartbeatReader
+	publicKey      string
 }
 
 // NewUpgradeAgentUsecase 创建一个新的升级 Agent 用例实例。
@@ -77,6 +80,7 @@ func NewUpgradeAgentUsecase(dep UpgradeDependencies) *UpgradeAgentUsecase {
 		sshClient:      dep.SSHClient,
 		renderer:       dep.Renderer,
 		heartbeat:      dep.Heartbeat,
+		publicKey:      dep.UpgradePublicKey,
 	}
 }
 
@@ -128,6 +132,7 @@ func (u *UpgradeAgentUsecase) Execute(ctx context.Context, req UpgradeAgentReque
 		ManagerGRPCAddr:   managerGRPCAddr,
 		HeartbeatInterval: "5s",
 		Token:             "",
+		UpgradePublicKey:  u.publicKey,
 	})
 	if err != nil {
 		return UpgradeAgentResponse{}, err
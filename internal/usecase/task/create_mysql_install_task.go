@@ -11,6 +11,8 @@ import (
 
 	collectdomain "gmha/internal/collect"
 	agentdomain "gmha/internal/domain/agent"
+	certdomain "gmha/internal/domain/certificate"
+	machinedomain "gmha/internal/domain/machine"
 	taskdomain "gmha/internal/domain/task"
 	"gmha/internal/infrastructure/render"
 	mysqlapp "gmha/internal/mysql"
@@ -24,6 +26,13 @@ type MachineInfoRepository interface {
 	Get(ctx context.Context, machineID string) (collectdomain.MachineInfo, bool, error)
 }
 
+// MySQLTLSIssuer issues a server certificate for an instance being installed.
+// The returned material is embedded in the install spec and written by the
+// Agent into Directory before my.cnf is generated.
+type MySQLTLSIssuer interface {
+	IssueMySQLServerCertificate(ctx context.Context, machine machinedomain.Machine, port int, directory string) (taskdomain.MySQLTLSSpec, error)
+}
+
 type PerconaToolkitPackageResolver interface {
 	ResolvePerconaToolkitPackage(arch, osName string) (string, error)
 	ResolveXtraBackupPackage(mysqlVersion, arch, glibcVersion string) (string, error)
@@ -59,6 +68,11 @@ type CreateMySQLInstallTaskRequest struct {
 	MemoryAllocator   string
 	RuntimeParameters map[string]string
 	Accounts          []taskdomain.MySQLAccountSpec
+	// EnableTLS provisions a Manager-issued server certificate.
+	// RequireSecureTransport additionally rejects plaintext TCP clients and is
+	// only valid together with EnableTLS.
+	EnableTLS              bool
+	RequireSecureTransport bool
 }
 
 // ListPackages 返回安装任务可选的 MySQL 安装包版本。
@@ -99,6 +113,7 @@ type CreateMySQLInstallTaskUsecase struct {
 	ptPackageResolver PerconaToolkitPackageResolver
 	managerHTTPAddr   string
 	managerAddrForIP  func(string) string
+	tlsIssuer         MySQLTLSIssuer
 }
 
 // NewCreateMySQLInstallTaskUsecase 创建一个新的 MySQL 安装任务用例实例。
@@ -132,6 +147,11 @@ func NewCreateMySQLInstallTaskUsecase(
 	}
 }
 
+// SetTLSIssuer 注入证书签发器，启用安装时的 TLS 证书下发。
+func (u *CreateMySQLInstallTaskUsecase) SetTLSIssuer(issuer MySQLTLSIssuer) {
+	u.tlsIssuer = issuer
+}
+
 // Execute 执行创建 MySQL 安装任务的完整流程，包括验证参数、计算配置、渲染模板和构建任务。
 func (u *CreateMySQLInstallTaskUsecase) Execute(ctx context.Context, req CreateMySQLInstallTaskRequest) (CreateMySQLInstallTaskResult, error) {
 	target := strings.TrimSpace(req.Machine)
@@ -245,6 +265,45 @@ func (u *CreateMySQLInstallTaskUsecase) Execute(ctx context.Context, req CreateM
 	if err := mysqlapp.ApplyRuntimeParametersForVersion(&vars, pkg.Version, req.RuntimeParameters); err != nil {
 		return CreateMySQLInstallTaskResult{}, err
 	}
+	accounts := normalizeInstallAccounts(req.Accounts)
+	if req.InstallXtraBackup {
+		accounts = ensureXtraBackupAccountPrivileges(accounts, pkg.Version)
+	}
+	accountCheck := make([]mysqlapp.AccountSpec, 0, len(accounts))
+	for _, item := range accounts {
+		accountCheck = append(accountCheck, mysqlapp.AccountSpec{
+			Role:           item.Role,
+			Username:       item.Username,
+			Password:       item.Password,
+			Host:           item.Host,
+			Enabled:        item.Enabled,
+			ExtendedBackup: item.ExtendedBackup,
+			Privileges:     item.Privileges,
+		})
+	}
+	if err := mysqlapp.ValidateAccountSpecs(accountCheck); err != nil {
+		return CreateMySQLInstallTaskResult{}, err
+	}
+	if req.RequireSecureTransport && !req.EnableTLS {
+		return CreateMySQLInstallTaskResult{}, errors.New("require_secure_transport needs enable_tls")
+	}
+	var tlsSpec *taskdomain.MySQLTLSSpec
+	if req.EnableTLS {
+		if u.tlsIssuer == nil {
+			return CreateMySQLInstallTaskResult{}, errors.New("TLS certificate issuer is not configured")
+		}
+		issued, err := u.tlsIssuer.IssueMySQLServerCertificate(ctx, machine, input.Port, strings.TrimRight(input.InstanceDir, "/")+"/"+certdomain.DefaultDirectoryName)
+		if err != nil {
+			return CreateMySQLInstallTaskResult{}, err
+		}
+		tlsSpec = &issued
+		vars.TLSCAPath = issued.Directory + "/" + certdomain.CAFileName
+		vars.TLSCertPath = issued.Directory + "/" + certdomain.CertFileName
+		vars.TLSKeyPath = issued.Directory + "/" + certdomain.KeyFileName
+		if req.RequireSecureTransport {
+			vars.RequireSecureTransport = 1
+		}
+	}
 	tpl, err := u.loader.LoadTemplate("mysql", "my.cnf.tmpl")
 	if err != nil {
 		return CreateMySQLInstallTaskResult{}, err
@@ -269,26 +328,6 @@ func (u *CreateMySQLInstallTaskUsecase) Execute(ctx context.Context, req CreateM
 	if err != nil {
 		return CreateMySQLInstallTaskResult{}, err
 	}
-	accounts := normalizeInstallAccounts(req.Accounts)
-	if req.InstallXtraBackup {
-		accounts = ensureXtraBackupAccountPrivileges(accounts, pkg.Version)
-	}
-	accountCheck := make([]mysqlapp.AccountSpec, 0, len(accounts))
-	for _, item := range accounts {
-		accountCheck = append(accountCheck, mysqlapp.AccountSpec{
-			Role:           item.Role,
-			Username:       item.Username,
-			Password:       item.Password,
-			Host:           item.Host,
-			Enabled:        item.Enabled,
-			ExtendedBackup: item.ExtendedBackup,
-			Privileges:     item.Privileges,
-		})
-	}
-	if err := mysqlapp.ValidateAccountSpecs(accountCheck); err != nil {
-		return CreateMySQLInstallTaskResult{}, err
-	}
-
 	spec := taskdomain.MySQLInstallSpec{
 		Port:                         input.Port,
 		ServerID:                     vars.ServerID,
@@ -330,6 +369,7 @@ func (u *CreateMySQLInstallTaskUsecase) Execute(ctx context.Context, req CreateM
 		MemoryAllocator:              memoryAllocator,
 		RuntimeParameters:            normalizedRuntimeParameters(req.RuntimeParameters),
 		Accounts:                     accounts,
+		TLS:                          tlsSpec,
 	}
 	specJSON, _ := json.Marshal(spec)
 
@@ -26,6 +26,17 @@ type MySQLTopologyInstanceRepository interface {
 	Get(ctx context.Context, machineID string, port int) (mysqlapp.Instance, bool, error)
 }
 
+// ReplicationTLS 描述副本连接复制源时使用的 TLS 参数。CAPath 是副本本机上的 CA 文件。
+type ReplicationTLS struct {
+	CAPath           string
+	VerifyServerCert bool
+}
+
+// ReplicationTLSResolver 根据副本所在集群的证书策略决定复制通道是否启用 SOURCE_SSL。
+type ReplicationTLSResolver interface {
+	ReplicationSourceTLS(ctx context.Context, machineID string, port int) (ReplicationTLS, bool)
+}
+
 // CreateMySQLTopologyTaskRequest 是创建 MySQL 拓扑任务的请求参数。
 type CreateMySQLTopologyTaskRequest struct {
 	Topology            string
@@ -65,6 +76,7 @@ type CreateMySQLTopologyTaskUsecase struct {
 	machines  MachineRepository
 	agents    AgentRepository
 	instances MySQLTopologyInstanceRepository
+	tls       ReplicationTLSResolver
 }
 
 // NewCreateMySQLTopologyTaskUsecase 创建一个新的 MySQL 拓扑任务用例实例。
@@ -72,6 +84,11 @@ func NewCreateMySQLTopologyTaskUsecase(machines MachineRepository, agents AgentR
 	return &CreateMySQLTopologyTaskUsecase{machines: machines, agents: agents, instances: instances}
 }
 
+// SetReplicationTLSResolver 注入复制 TLS 策略，副本的复制通道据此追加 SOURCE_SSL 选项。
+func (u *CreateMySQLTopologyTaskUsecase) SetReplicationTLSResolver(resolver ReplicationTLSResolver) {
+	u.tls = resolver
+}
+
 // Execute 执行创建 MySQL 拓扑任务的完整流程，包括验证参数、解析节点、分配复制源和构建任务。
 func (u *CreateMySQLTopologyTaskUsecase) Execute(ctx context.Context, req CreateMySQLTopologyTaskRequest) (CreateMySQLTopologyTaskResult, error) {
 	if u.instances == nil {
@@ -121,6 +138,13 @@ func (u *CreateMySQLTopologyTaskUsecase) Execute(ctx context.Context, req Create
 		if specPort <= 0 {
 			specPort = req.Port
 		}
+		node := item.spec
+		if u.tls != nil && node.RequiresReplicationSetup {
+			if replicationTLS, ok := u.tls.ReplicationSourceTLS(ctx, node.MachineID, specPort); ok {
+				node.ReplicationSSLCA = replicationTLS.CAPath
+				node.ReplicationSSLVerify = replicationTLS.VerifyServerCert
+			}
+		}
 		spec := taskdomain.MySQLTopologySpec{
 			Topology:            req.Topology,
 			Port:                specPort,
@@ -134,7 +158,7 @@ func (u *CreateMySQLTopologyTaskUsecase) Execute(ctx context.Context, req Create
 			CloneSeedMachine:    req.CloneSeedMachine,
 			ParallelType:        req.ParallelType,
 			ParallelWorkers:     req.ParallelWorkers,
-			Node:                item.spec,
+			Node:                node,
 			Nodes:               allNodes,
 		}
 		specJSON, _ := json.Marshal(spec)
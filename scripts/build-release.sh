@@ -20,13 +20,14 @@ mkdir -p "$PACKAGE/bin" "$PACKAGE/data" "$PACKAGE/logs" "$PACKAGE/scripts"
 CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -trimpath -ldflags="-s -w -X gmha/internal/buildinfo.Version=$EMBED_VERSION" -o "$PACKAGE/gmha" ./cmd/gmha
 CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -trimpath -ldflags="-s -w" -o "$PACKAGE/gmha-web" ./cmd/gmha-web
 CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -trimpath -ldflags="-s -w -X gmha/internal/buildinfo.Version=$EMBED_VERSION" -o "$PACKAGE/bin/agentd" ./cmd/agent
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -trimpath -ldflags="-s -w" -o "$PACKAGE/gmhactl" ./cmd/gmhactl
 
 cp "$ROOT/packaging/start-web.sh" "$PACKAGE/start-web.sh"
 cp "$ROOT/scripts/build-pt-offline-bundle.sh" "$PACKAGE/scripts/build-pt-offline-bundle.sh"
 cp "$ROOT/scripts/build-flamegraph-offline-bundle.sh" "$PACKAGE/scripts/build-flamegraph-offline-bundle.sh"
 cp "$ROOT/packaging/flamegraph-install-offline.sh" "$PACKAGE/scripts/flamegraph-install-offline.sh"
 cp "$ROOT/packaging/README-linux.md" "$PACKAGE/README.md"
-chmod +x "$PACKAGE/start-web.sh" "$PACKAGE/scripts/build-pt-offline-bundle.sh" "$PACKAGE/scripts/build-flamegraph-offline-bundle.sh" "$PACKAGE/scripts/flamegraph-install-offline.sh" "$PACKAGE/gmha" "$PACKAGE/gmha-web" "$PACKAGE/bin/agentd"
+chmod +x "$PACKAGE/start-web.sh" "$PACKAGE/scripts/build-pt-offline-bundle.sh" "$PACKAGE/scripts/build-flamegraph-offline-bundle.sh" "$PACKAGE/scripts/flamegraph-install-offline.sh" "$PACKAGE/gmha" "$PACKAGE/gmha-web" "$PACKAGE/gmhactl" "$PACKAGE/bin/agentd"
 cp "$PACKAGE/gmha" "$MANAGER_PACKAGE"
 cp "$PACKAGE/bin/agentd" "$AGENT_PACKAGE"
 touch "$PACKAGE/data/.keep" "$PACKAGE/logs/.keep"